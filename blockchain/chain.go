@@ -321,17 +321,20 @@ type VoteInfo struct {
 	AgendaStatus []ThresholdStateTuple
 }
 
-// prevScript represents script and script version information for a previous
-// outpoint.
+// prevScript represents script, script version, and amount information for a
+// previous outpoint.
 type prevScript struct {
 	scriptVersion uint16
 	pkScript      []byte
+	amount        int64
+	ticketMinOuts *ticketMinimalOutputs
 }
 
-// prevScriptsSnapshot represents a snapshot of script and script version
-// information related to previous outpoints from a utxo viewpoint.
+// prevScriptsSnapshot represents a snapshot of script, script version, and
+// amount information related to previous outpoints from a utxo viewpoint.
 //
-// This implements the indexers.PrevScripter interface.
+// This implements the indexers.PrevScripter, indexers.PrevAmounter, and
+// indexers.PrevTicketOutputer interfaces.
 type prevScriptsSnapshot struct {
 	entries map[wire.OutPoint]prevScript
 }
@@ -339,6 +342,13 @@ type prevScriptsSnapshot struct {
 // Ensure prevScriptSnapshot implements the indexers.PrevScripter interface.
 var _ indexers.PrevScripter = (*prevScriptsSnapshot)(nil)
 
+// Ensure prevScriptSnapshot implements the indexers.PrevAmounter interface.
+var _ indexers.PrevAmounter = (*prevScriptsSnapshot)(nil)
+
+// Ensure prevScriptSnapshot implements the indexers.PrevTicketOutputer
+// interface.
+var _ indexers.PrevTicketOutputer = (*prevScriptsSnapshot)(nil)
+
 // newPrevScriptSnapshot creates a script and script version snapshot from
 // the provided utxo viewpoint.
 func newPrevScriptSnapshot(view *UtxoViewpoint) *prevScriptsSnapshot {
@@ -361,6 +371,8 @@ func newPrevScriptSnapshot(view *UtxoViewpoint) *prevScriptsSnapshot {
 		snapshot.entries[k] = prevScript{
 			scriptVersion: v.scriptVersion,
 			pkScript:      pkScript,
+			amount:        v.amount,
+			ticketMinOuts: v.ticketMinOuts,
 		}
 	}
 
@@ -379,6 +391,39 @@ func (p *prevScriptsSnapshot) PrevScript(prevOut *wire.OutPoint) (uint16, []byte
 	return entry.scriptVersion, entry.pkScript, true
 }
 
+// PrevAmount returns the amount associated with the provided previous outpoint
+// along with a bool that indicates whether or not the requested entry exists.
+func (p *prevScriptsSnapshot) PrevAmount(prevOut *wire.OutPoint) (int64, bool) {
+	entry := p.entries[*prevOut]
+	if entry.pkScript == nil {
+		return 0, false
+	}
+	return entry.amount, true
+}
+
+// PrevTicketOutputs returns the minimal outputs of the ticket purchase that
+// created the provided previous outpoint along with a bool that indicates
+// whether or not the requested entry exists, was created by a ticket, and has
+// minimal outputs that decode successfully.
+//
+// The minimal outputs are only deserialized on demand since they are only
+// needed for the outputs spent by votes and revocations.
+func (p *prevScriptsSnapshot) PrevTicketOutputs(prevOut *wire.OutPoint) ([]*stake.MinimalOutput, bool) {
+	entry := p.entries[*prevOut]
+	if entry.ticketMinOuts == nil {
+		return nil, false
+	}
+
+	// Ensure the minimal outputs are well formed before deserializing them
+	// since deserializing malformed data would otherwise panic.
+	serialized := entry.ticketMinOuts.data
+	if _, err := readDeserializeSizeOfMinimalOutputs(serialized); err != nil {
+		return nil, false
+	}
+	minOuts, _ := deserializeToMinimalOutputs(serialized)
+	return minOuts, true
+}
+
 // EnableBulkImportMode provides a mechanism to indicate that several validation
 // checks can be avoided when bulk importing blocks already known to be valid.
 // This must NOT be enabled in any other circumstance where blocks need to be
@@ -806,3 +806,55 @@ func TestLocateInventory(t *testing.T) {
 		}
 	}
 }
+
+// TestPrevScriptsSnapshotTicketOutputs ensures the ticket outputs provided by a
+// previous scripts snapshot are only reported as found when they exist and
+// decode successfully.
+func TestPrevScriptsSnapshotTicketOutputs(t *testing.T) {
+	t.Parallel()
+
+	// Serialize the minimal outputs of a transaction with a couple of
+	// outputs.
+	msgTx := wire.NewMsgTx()
+	msgTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	msgTx.AddTxOut(wire.NewTxOut(2000, []byte{0x52, 0x53}))
+	tx := dcrutil.NewTx(msgTx)
+	serialized := make([]byte, serializeSizeForMinimalOutputs(tx))
+	putTxToMinimalOutputs(serialized, tx)
+
+	valid := wire.OutPoint{Index: 0}
+	truncated := wire.OutPoint{Index: 1}
+	notTicket := wire.OutPoint{Index: 2}
+	missing := wire.OutPoint{Index: 3}
+	snapshot := &prevScriptsSnapshot{
+		entries: map[wire.OutPoint]prevScript{
+			valid: {
+				pkScript:      []byte{0x51},
+				ticketMinOuts: &ticketMinimalOutputs{data: serialized},
+			},
+			truncated: {
+				pkScript: []byte{0x51},
+				ticketMinOuts: &ticketMinimalOutputs{
+					data: serialized[:len(serialized)-1],
+				},
+			},
+			notTicket: {pkScript: []byte{0x51}},
+		},
+	}
+
+	minOuts, ok := snapshot.PrevTicketOutputs(&valid)
+	if !ok {
+		t.Fatal("ticket outputs for valid entry not found")
+	}
+	if len(minOuts) != 2 || minOuts[0].Value != 1000 ||
+		minOuts[1].Value != 2000 ||
+		!bytes.Equal(minOuts[1].PkScript, []byte{0x52, 0x53}) {
+
+		t.Fatalf("unexpected ticket outputs for valid entry: %+v", minOuts)
+	}
+	for _, prevOut := range []wire.OutPoint{truncated, notTicket, missing} {
+		if _, ok := snapshot.PrevTicketOutputs(&prevOut); ok {
+			t.Fatalf("unexpected ticket outputs found for %v", prevOut)
+		}
+	}
+}
@@ -6,12 +6,20 @@
 package indexers
 
 import (
+	"bytes"
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/decred/dcrd/blockchain/stake/v4"
+	"github.com/decred/dcrd/blockchain/v4/internal/spendpruner"
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/database/v3"
@@ -26,7 +34,7 @@ const (
 	addrIndexName = "address index"
 
 	// addrIndexVersion is the current version of the address index.
-	addrIndexVersion = 2
+	addrIndexVersion = 3
 
 	// level0MaxEntries is the maximum number of transactions that are
 	// stored in level 0 of an address index entry.  Subsequent levels store
@@ -34,6 +42,18 @@ const (
 	// the previous level.
 	level0MaxEntries = 8
 
+	// maxAddrIndexLevel is the maximum level an address index entry may
+	// reach.  It is the highest level whose maximum size in bytes can be
+	// represented by a signed 32-bit integer, which is far more than any
+	// address realistically requires and ensures the calculations involving
+	// the number of entries and bytes of a level never overflow.
+	maxAddrIndexLevel = 23
+
+	// deadlineCheckInterval is the number of entries deserialized or marked
+	// between checks of the deadline by queries that are bounded by one.  It
+	// avoids the overhead of reading the clock for every entry.
+	deadlineCheckInterval = 64
+
 	// addrKeySize is the number of bytes an address key consumes in the
 	// index.  It consists of 1 byte address type + 20 bytes hash160.
 	addrKeySize = 1 + 20
@@ -71,6 +91,213 @@ const (
 	// the hash of a pubkey address might be the same as that of a script
 	// hash.
 	addrKeyTypeScriptHash = 3
+
+	// addrKeyTypePubKey, addrKeyTypePubKeyEdwards, and
+	// addrKeyTypePubKeySchnorr are the address types in an address key which
+	// represent a pay-to-pubkey address and the pay-to-pubkey-alt addresses
+	// using Schnorr signatures over the Ed25519 and secp256k1 curves,
+	// respectively, when the index uses the extended key mode.  They are the
+	// type of the corresponding public key hash variant offset by
+	// addrKeyTypePubKeyOffset.
+	addrKeyTypePubKeyOffset  = 4
+	addrKeyTypePubKey        = addrKeyTypePubKeyHash + addrKeyTypePubKeyOffset
+	addrKeyTypePubKeyEdwards = addrKeyTypePubKeyHashEdwards +
+		addrKeyTypePubKeyOffset
+	addrKeyTypePubKeySchnorr = addrKeyTypePubKeyHashSchnorr +
+		addrKeyTypePubKeyOffset
+
+	// numAddrKeyTypes is the number of address types in an address key
+	// excluding the public key variants used by the extended key mode.
+	numAddrKeyTypes = 4
+
+	// blockIndexBits is the number of bits of the serialized block index
+	// field of an entry which house the index of the transaction within its
+	// tree.  The remaining upper bits house flags that describe the entry.
+	//
+	// NOTE: This must be large enough to house the maximum number of
+	// transactions in a tree.
+	blockIndexBits = 20
+
+	// blockIndexMask is the mask used to extract the index of the
+	// transaction within its tree from the serialized block index field.
+	blockIndexMask = 1<<blockIndexBits - 1
+
+	// entryTreeShift and entryTreeMask are used to extract the tree flags
+	// from the serialized block index field.
+	entryTreeShift = blockIndexBits
+	entryTreeMask  = 0x03 << entryTreeShift
+
+	// entryTreeUnknown, entryTreeRegular, and entryTreeStake are the values
+	// of the tree flags which identify the tree the transaction of an entry
+	// is in.  Entries created by versions of the index prior to version 3 do
+	// not have the flags set and thus have an unknown tree.
+	entryTreeUnknown = 0
+	entryTreeRegular = 1
+	entryTreeStake   = 2
+
+	// addrIndexOptSkipCoinbaseOutputs is the flag of the persisted index
+	// options which indicates the outputs of coinbase transactions are not
+	// indexed.
+	addrIndexOptSkipCoinbaseOutputs = 1 << 0
+
+	// addrIndexOptIndexRedeemScriptAddrs is the flag of the persisted index
+	// options which indicates the addresses embedded in the redeem scripts
+	// revealed by inputs that spend pay-to-script-hash outputs are indexed.
+	addrIndexOptIndexRedeemScriptAddrs = 1 << 1
+
+	// addrIndexOptExtendedKeys is the flag of the persisted index options
+	// which indicates the index uses the extended key mode.
+	addrIndexOptExtendedKeys = 1 << 2
+
+	// addrIndexOptIndexTicketCommitmentAddrs is the flag of the persisted
+	// index options which indicates votes and revocations are also indexed
+	// under the commitment addresses of the tickets they spend.
+	addrIndexOptIndexTicketCommitmentAddrs = 1 << 3
+
+	// addrIndexOptChangeHeuristicV1 is the flag of the persisted index
+	// options which indicates the outputs of regular transactions are tagged
+	// as likely change or payments using version 1 of the change heuristic.
+	// Future versions of the heuristic must use a separate flag so that an
+	// index built with a different version is detected.
+	addrIndexOptChangeHeuristicV1 = 1 << 4
+
+	// addrIndexOptIndexRewardSources is the flag of the persisted index
+	// options which indicates the tickets that earned the reward outputs of
+	// votes are recorded.
+	addrIndexOptIndexRewardSources = 1 << 5
+
+	// addrIndexOptCreditFlags is the flag of the persisted index options
+	// which indicates the entries for addresses paid by the outputs of their
+	// transactions are flagged as credits.
+	addrIndexOptCreditFlags = 1 << 6
+
+	// addrIndexOptIndexGenesisOutputs is the flag of the persisted index
+	// options which indicates the outputs of the genesis block are indexed.
+	addrIndexOptIndexGenesisOutputs = 1 << 7
+
+	// addrIndexOptIndexAtomicSwapAddrs is the flag of the persisted index
+	// options which indicates the participant addresses embedded in the
+	// atomic swap contracts revealed by inputs that spend
+	// pay-to-script-hash outputs are indexed.
+	addrIndexOptIndexAtomicSwapAddrs = 1 << 8
+
+	// addrIndexOptTrackDisapprovals is the flag of the persisted index
+	// options which indicates the blocks whose regular transaction tree was
+	// disapproved by the votes in the next block are recorded.
+	addrIndexOptTrackDisapprovals = 1 << 9
+
+	// addrIndexOptTrackInputIndexes is the flag of the persisted index
+	// options which indicates the indices of the inputs that spend outputs
+	// which pay to addresses are recorded.
+	addrIndexOptTrackInputIndexes = 1 << 10
+
+	// addrIndexOptSkipAddrTypesShift is the bit offset of the flags of the
+	// persisted index options which indicate the types of addresses that are
+	// not indexed.  The flag for each type is the type offset by it.  The
+	// types are recorded as skipped rather than indexed so indexes that
+	// index all types, which includes those created before the option
+	// existed, do not have any of the flags set.
+	addrIndexOptSkipAddrTypesShift = 11
+
+	// addrIndexOptTrackTotals is the flag of the persisted index options
+	// which indicates the total amounts credited to and debited from
+	// addresses are tracked.  It follows the bits reserved for the flags of
+	// the skipped address types.
+	addrIndexOptTrackTotals = 1 << (addrIndexOptSkipAddrTypesShift + 8)
+
+	// genesisBlockID is the internal block ID reserved for the genesis block
+	// when its outputs are indexed.  The transaction index assigns IDs
+	// starting from one to the blocks it connects, which never includes the
+	// genesis block.
+	genesisBlockID = 0
+
+	// entryStakeTagsShift and entryStakeTagsMask are used to extract the
+	// stake tags from the serialized block index field.
+	entryStakeTagsShift = entryTreeShift + 2
+	entryStakeTagsMask  = 0x07 << entryStakeTagsShift
+
+	// entryTxClassShift and entryTxClassMask are used to extract the
+	// transaction class from the serialized block index field.
+	entryTxClassShift = entryStakeTagsShift + 3
+	entryTxClassMask  = 0x0f << entryTxClassShift
+
+	// entryOutputKindShift and entryOutputKindMask are used to extract the
+	// output kind from the serialized block index field.
+	entryOutputKindShift = entryTxClassShift + 4
+	entryOutputKindMask  = 0x03 << entryOutputKindShift
+
+	// entryCreditShift and entryCreditMask are used to extract the credit
+	// flag from the serialized block index field.
+	entryCreditShift = entryOutputKindShift + 2
+	entryCreditMask  = 0x01 << entryCreditShift
+
+	// entryTxLenBits is the number of bits of the serialized tx length field
+	// of an entry which house the length of the transaction.  The remaining
+	// upper bits house the serialization version of the entry.
+	//
+	// NOTE: This must be large enough to house the maximum block size.
+	entryTxLenBits = 24
+
+	// entryTxLenMask is the mask used to extract the length of the
+	// transaction from the serialized tx length field.
+	entryTxLenMask = 1<<entryTxLenBits - 1
+
+	// entryVersionShift is used to extract the serialization version of an
+	// entry from the serialized tx length field.
+	entryVersionShift = entryTxLenBits
+
+	// entryVersionLegacy is the serialization version of the entries written
+	// prior to the introduction of per-entry versions.  The upper bits of
+	// their tx length field are always zero since the length of a
+	// transaction can never exceed the maximum block size.
+	entryVersionLegacy = 0
+
+	// entryVersion is the serialization version of the entries written by
+	// the current version of the index.
+	entryVersion = 1
+
+	// parallelMergeMinAddrs is the minimum number of distinct addresses a
+	// block must involve for the merges of the levels of the addresses to be
+	// computed concurrently when it is connected.
+	parallelMergeMinAddrs = 256
+
+	// nonStandardFlushInterval is the number of blocks the changes to the
+	// number of non-standard scripts encountered by the index are accumulated
+	// in memory before they are written to the database.
+	nonStandardFlushInterval = 100
+
+	// addrCommitmentKeySize is the number of bytes a key in the ticket
+	// commitment amounts bucket consumes.  It consists of the address key +
+	// the hash of the ticket purchase transaction.
+	addrCommitmentKeySize = addrKeySize + chainhash.HashSize
+
+	// addrCommitmentEntrySize is the number of bytes an entry in the ticket
+	// commitment amounts bucket consumes.  It consists of 4 bytes for the
+	// block ID + 8 bytes for the committed amount.
+	addrCommitmentEntrySize = 4 + 8
+
+	// addrRewardSourceKeySize is the number of bytes a key in the reward
+	// sources bucket consumes.  It consists of the address key + the hash of
+	// the block that contains the vote + 4 bytes for the offset of the vote
+	// within the block.
+	addrRewardSourceKeySize = addrKeySize + chainhash.HashSize + 4
+
+	// addrTotalsEntrySize is the number of bytes an entry in the address
+	// totals bucket consumes.  It consists of 8 bytes for the total amount
+	// credited + 8 bytes for the total amount debited.
+	addrTotalsEntrySize = 8 + 8
+
+	// addrBlockTimeEntrySize is the number of bytes an entry in the block
+	// timestamps bucket consumes.  It consists of 8 bytes for the timestamp
+	// of the block.
+	addrBlockTimeEntrySize = 8
+
+	// unconfirmedMappingOverhead is the approximate number of bytes consumed
+	// by each mapping between an address and a transaction in the
+	// unconfirmed index.  Every mapping is stored in both directions, so it
+	// accounts for an address key and transaction hash in each of the maps
+	// along with the transaction pointer.
+	unconfirmedMappingOverhead = 2*(addrKeySize+chainhash.HashSize) + 8
 )
 
 var (
@@ -78,10 +305,105 @@ var (
 	// to house it.
 	addrIndexKey = []byte("txbyaddridx")
 
-	// errUnsupportedAddressType is an error that is used to signal an
-	// unsupported address type has been used.
-	errUnsupportedAddressType = errors.New("address type is not supported " +
+	// addrCommitmentIndexKey is the key of the db bucket used to house the
+	// amounts committed to addresses by ticket purchases.
+	addrCommitmentIndexKey = []byte("txbyaddrcommitidx")
+
+	// addrTotalsIndexKey is the key of the db bucket used to house the total
+	// amounts credited to and debited from addresses.
+	addrTotalsIndexKey = []byte("txbyaddrtotalsidx")
+
+	// addrBlockTimeIndexKey is the key of the db bucket used to house the
+	// timestamps of the blocks referenced by the entries of the index.
+	addrBlockTimeIndexKey = []byte("txbyaddrblocktimeidx")
+
+	// addrRewardSourceIndexKey is the key of the db bucket used to house the
+	// hashes of the tickets that earned the reward outputs of votes.
+	addrRewardSourceIndexKey = []byte("txbyaddrrewardsrcidx")
+
+	// addrUnindexedVersionIndexKey is the key of the db bucket used to house
+	// the heights of the blocks that contain scripts with versions the index
+	// does not support.
+	addrUnindexedVersionIndexKey = []byte("txbyaddrunindexedveridx")
+
+	// addrDisapprovedIndexKey is the key of the db bucket used to house the
+	// hashes of the blocks whose regular transaction tree was disapproved by
+	// the votes in the next block.
+	addrDisapprovedIndexKey = []byte("txbyaddrdisapprovedidx")
+
+	// addrInputIndexKey is the key of the db bucket used to house the indices
+	// of the inputs of transactions that spend outputs which pay to
+	// addresses.
+	addrInputIndexKey = []byte("txbyaddrinputidx")
+
+	// ErrUnsupportedAddressType is returned by queries and other methods
+	// that accept an address when the type of the address is not supported
+	// by the address index.  Callers may use errors.Is to distinguish it from
+	// other errors, such as to report invalid input.
+	ErrUnsupportedAddressType = errors.New("address type is not supported " +
 		"by the address index")
+
+	// ErrAddressNotFound is returned by queries that require at least one
+	// entry for an address when the address index does not have any entries
+	// for it.
+	ErrAddressNotFound = errors.New("no address index entries found for " +
+		"address")
+
+	// ErrAddressTotalsUnavailable is returned when querying the total amounts
+	// credited to and debited from an address while the index does not track
+	// them.  The index must be dropped and rebuilt with the option to track
+	// them to make them available.
+	ErrAddressTotalsUnavailable = errors.New("address totals are not " +
+		"available until the address index is rebuilt")
+
+	// ErrInvalidPageCursor is returned by paged queries when the provided
+	// page cursor is malformed or no longer refers to the same entry it did
+	// when it was created.
+	ErrInvalidPageCursor = errors.New("invalid address index page cursor")
+
+	// ErrRewardSourceNotFound is returned when querying the ticket that
+	// earned the reward paid to an address by a vote and the index does not
+	// have a record of it.
+	ErrRewardSourceNotFound = errors.New("no reward source ticket found " +
+		"for address entry")
+
+	// ErrTxIndexRequired is returned when the address index is created or
+	// queried about its dependency without the transaction index it depends
+	// on.  The transaction index must be enabled in order to use the address
+	// index.
+	ErrTxIndexRequired = errors.New("the address index requires the " +
+		"transaction index to be enabled")
+
+	// ErrAddrIndexOptionsMismatch is returned when the address index is
+	// initialized with options that differ from the ones the existing index
+	// was built with.  The index must be dropped and rebuilt in order to use
+	// the new options.
+	ErrAddrIndexOptionsMismatch = errors.New("address index options do not " +
+		"match the existing index")
+
+	// ErrCreditFlagsUnavailable is returned when querying the entries that
+	// credit an address while the index is not configured to flag them.  The
+	// index must be dropped and rebuilt with the option enabled to make them
+	// available.
+	ErrCreditFlagsUnavailable = errors.New("address index credit flags are " +
+		"not available")
+
+	// ErrStopForEach may be returned by the callback passed to
+	// ForEachAddress in order to stop iterating early without causing an
+	// error to be returned.
+	ErrStopForEach = errors.New("stop address iteration")
+
+	// ErrSnapshotClosed is returned by queries made via an address index
+	// snapshot after it has been closed.
+	ErrSnapshotClosed = errors.New("address index snapshot is closed")
+
+	// ErrIndexTipMismatch is returned when a block that does not extend the
+	// current tip of the address index is connected or a block that is not
+	// the current tip of the address or spend index is disconnected, such as
+	// when notifications are delivered out of order.  The index is not
+	// modified and stale disconnect notifications are logged and skipped
+	// rather than halting the index subscriber.
+	ErrIndexTipMismatch = errors.New("block does not match the index tip")
 )
 
 // -----------------------------------------------------------------------------
@@ -131,30 +453,252 @@ var (
 //
 // The serialized value format is:
 //
-//   [<block id><start offset><tx length><block index>,...]
+//   [<block id><start offset><tx length><block index and flags>,...]
 //
-//   Field           Type      Size
-//   block id        uint32    4 bytes
-//   start offset    uint32    4 bytes
-//   tx length       uint32    4 bytes
-//   block index     uint32    4 bytes
+//   Field                  Type      Size
+//   block id               uint32    4 bytes
+//   start offset           uint32    4 bytes
+//   tx length and version  uint32    4 bytes
+//   block index and flags  uint32    4 bytes
 //   -----
 //   Total: 16 bytes per indexed tx
+//
+// The tx length and version field houses the length of the transaction in the
+// low 24 bits and the serialization version of the entry in the upper 8 bits.
+// Since the length of a transaction can never exceed the maximum block size,
+// the upper bits of the entries written before the version was introduced are
+// always zero, so they are treated as version 0.  This allows entries with
+// different versions to coexist within the levels of an address, so entries
+// written with an older version remain readable as they are instead of
+// requiring the entire index to be rewritten.  Note that the version is not a
+// leading byte because the fixed entry size the level-based scheme relies on is
+// preserved.
+//
+// The block index and flags field houses the index of the transaction within
+// its tree in the low 20 bits and flags that describe the entry in the upper
+// 12 bits as follows:
+//
+//   Bits   Description
+//   0-19   block index
+//   20-21  tree (0 = unknown, 1 = regular, 2 = stake)
+//   22-24  stake tags (bit 0 = stakegen, bit 1 = stakechange,
+//          bit 2 = stakecommitment)
+//   25-28  transaction class (see TxClass)
+//   29-30  output kind (see OutputKind)
+//   31     credit
 // -----------------------------------------------------------------------------
 
+// StakeTag identifies the kinds of stake transaction outputs that pay to an
+// address in an address index entry.  Multiple tags may be combined since a
+// transaction can pay to the same address via several outputs.
+type StakeTag uint8
+
+const (
+	// StakeTagGen identifies an entry for a vote that pays a stake
+	// generation (reward) output to the address.
+	StakeTagGen StakeTag = 1 << iota
+
+	// StakeTagChange identifies an entry for a ticket purchase that pays a
+	// stake change output to the address.
+	StakeTagChange
+
+	// StakeTagCommitment identifies an entry for a ticket purchase that
+	// commits to the address via a commitment output.
+	StakeTagCommitment
+)
+
+// TxClass identifies the kind of transaction of an address index entry.
+type TxClass uint8
+
+const (
+	// TxClassUnknown identifies an entry for a transaction of an unknown
+	// kind.  Entries created by versions of the index prior to version 3 do
+	// not have a class and thus have an unknown class.
+	TxClassUnknown TxClass = iota
+
+	// TxClassRegular identifies an entry for a regular transaction in the
+	// regular tree that is not a coinbase.
+	TxClassRegular
+
+	// TxClassCoinbase identifies an entry for a coinbase.
+	TxClassCoinbase
+
+	// TxClassTicket identifies an entry for a ticket purchase.
+	TxClassTicket
+
+	// TxClassVote identifies an entry for a vote.
+	TxClassVote
+
+	// TxClassRevocation identifies an entry for a ticket revocation.
+	TxClassRevocation
+
+	// TxClassTreasuryAdd identifies an entry for a treasury add.
+	TxClassTreasuryAdd
+
+	// TxClassTreasurySpend identifies an entry for a treasury spend.
+	TxClassTreasurySpend
+
+	// TxClassTreasuryBase identifies an entry for a treasury base.  Treasury
+	// bases do not involve any addresses, so there are never any entries
+	// with this class in practice.
+	TxClassTreasuryBase
+)
+
+// OutputKind identifies whether the outputs of a transaction that pay to the
+// address of an address index entry are likely change or payments as
+// determined by the change heuristic.
+//
+// The heuristic is only applied when the index is configured to do so and the
+// current version of it, version 1, uses the following rule:
+//
+// The addresses paid by the outputs of a regular transaction that is not a
+// coinbase are tagged as change when the same address is also involved in any
+// of the inputs of the transaction, which indicates address reuse, and as
+// payments otherwise.
+//
+// Since it is a heuristic, the tags are only a guess and MUST NOT be relied
+// upon for anything other than analysis.
+type OutputKind uint8
+
+const (
+	// OutputKindUnknown identifies an entry for which the outputs were not
+	// analyzed.  This is the case for entries for addresses that are only
+	// involved in the inputs of a transaction, entries for coinbases and
+	// stake transactions, and all entries when the heuristic is disabled.
+	OutputKindUnknown OutputKind = iota
+
+	// OutputKindPayment identifies an entry for a transaction that likely
+	// pays the address as a payment.
+	OutputKindPayment
+
+	// OutputKindChange identifies an entry for a transaction that likely
+	// pays change back to the address.
+	OutputKindChange
+)
+
+// stakeOutputTags returns the stake tags that describe the passed public key
+// script when it is an output of a stake transaction.  Outputs that are not
+// stake generation, stake change, or ticket commitment outputs, such as the
+// outputs of revocations, do not have any tags.
+func stakeOutputTags(scriptVersion uint16, pkScript []byte, isSStx bool, isTreasuryEnabled bool) StakeTag {
+	switch txscript.GetScriptClass(scriptVersion, pkScript, isTreasuryEnabled) {
+	case txscript.StakeGenTy:
+		return StakeTagGen
+	case txscript.StakeSubChangeTy:
+		return StakeTagChange
+	case txscript.NullDataTy:
+		if isSStx {
+			return StakeTagCommitment
+		}
+	}
+	return 0
+}
+
+// encodeEntryTree returns the tree flags of the serialized block index field
+// for the provided transaction tree.
+func encodeEntryTree(tree int8) uint32 {
+	switch tree {
+	case wire.TxTreeRegular:
+		return entryTreeRegular << entryTreeShift
+	case wire.TxTreeStake:
+		return entryTreeStake << entryTreeShift
+	}
+	return entryTreeUnknown << entryTreeShift
+}
+
+// decodeEntryTree returns the transaction tree identified by the tree flags of
+// the provided serialized block index field.  wire.TxTreeUnknown is returned
+// for entries that do not identify a tree.
+func decodeEntryTree(blockIndexFlags uint32) int8 {
+	switch (blockIndexFlags & entryTreeMask) >> entryTreeShift {
+	case entryTreeRegular:
+		return wire.TxTreeRegular
+	case entryTreeStake:
+		return wire.TxTreeStake
+	}
+	return wire.TxTreeUnknown
+}
+
+// encodeEntryStakeTags returns the stake tag flags of the serialized block index
+// field for the provided stake tags.
+func encodeEntryStakeTags(tags StakeTag) uint32 {
+	return uint32(tags) << entryStakeTagsShift & entryStakeTagsMask
+}
+
+// decodeEntryStakeTags returns the stake tags identified by the stake tag flags
+// of the provided serialized block index field.
+func decodeEntryStakeTags(blockIndexFlags uint32) StakeTag {
+	return StakeTag((blockIndexFlags & entryStakeTagsMask) >>
+		entryStakeTagsShift)
+}
+
+// encodeEntryTxClass returns the transaction class flags of the serialized
+// block index field for the provided transaction class.
+func encodeEntryTxClass(class TxClass) uint32 {
+	return uint32(class) << entryTxClassShift & entryTxClassMask
+}
+
+// decodeEntryTxClass returns the transaction class identified by the
+// transaction class flags of the provided serialized block index field.
+func decodeEntryTxClass(blockIndexFlags uint32) TxClass {
+	return TxClass((blockIndexFlags & entryTxClassMask) >> entryTxClassShift)
+}
+
+// encodeEntryOutputKind returns the output kind flags of the serialized block
+// index field for the provided output kind.
+func encodeEntryOutputKind(kind OutputKind) uint32 {
+	return uint32(kind) << entryOutputKindShift & entryOutputKindMask
+}
+
+// decodeEntryOutputKind returns the output kind identified by the output kind
+// flags of the provided serialized block index field.
+func decodeEntryOutputKind(blockIndexFlags uint32) OutputKind {
+	return OutputKind((blockIndexFlags & entryOutputKindMask) >>
+		entryOutputKindShift)
+}
+
+// encodeEntryCredit returns the credit flag of the serialized block index field
+// for the provided credit status.
+func encodeEntryCredit(credit bool) uint32 {
+	if credit {
+		return entryCreditMask
+	}
+	return 0
+}
+
+// decodeEntryCredit returns whether or not the credit flag of the provided
+// serialized block index field is set.
+func decodeEntryCredit(blockIndexFlags uint32) bool {
+	return blockIndexFlags&entryCreditMask != 0
+}
+
+// encodeEntryTxLen returns the serialized tx length field for the provided
+// transaction length tagged with the provided serialization version.
+func encodeEntryTxLen(txLen uint32, version uint8) uint32 {
+	return txLen&entryTxLenMask | uint32(version)<<entryVersionShift
+}
+
+// decodeEntryTxLen returns the transaction length and serialization version
+// of the provided serialized tx length field.
+func decodeEntryTxLen(txLenField uint32) (uint32, uint8) {
+	return txLenField & entryTxLenMask, uint8(txLenField >> entryVersionShift)
+}
+
 // fetchBlockHashFunc defines a callback function to use in order to convert a
 // serialized block ID to an associated block hash.
 type fetchBlockHashFunc func(serializedID []byte) (*chainhash.Hash, error)
 
-// serializeAddrIndexEntry serializes the provided block id and transaction
-// location according to the format described in detail above.
-func serializeAddrIndexEntry(blockID uint32, txLoc wire.TxLoc, blockIndex uint32) []byte {
+// serializeAddrIndexEntry serializes the provided block id, transaction
+// location, and block index with its flags according to the format described
+// in detail above.
+func serializeAddrIndexEntry(blockID uint32, txLoc wire.TxLoc, blockIndexFlags uint32) []byte {
 	// Serialize the entry.
 	serialized := make([]byte, txEntrySize)
 	byteOrder.PutUint32(serialized, blockID)
 	byteOrder.PutUint32(serialized[4:], uint32(txLoc.TxStart))
-	byteOrder.PutUint32(serialized[8:], uint32(txLoc.TxLen))
-	byteOrder.PutUint32(serialized[12:], blockIndex)
+	byteOrder.PutUint32(serialized[8:], encodeEntryTxLen(uint32(txLoc.TxLen),
+		entryVersion))
+	byteOrder.PutUint32(serialized[12:], blockIndexFlags)
 	return serialized
 }
 
@@ -168,6 +712,17 @@ func deserializeAddrIndexEntry(serialized []byte, entry *TxIndexEntry, fetchBloc
 		return errDeserialize("unexpected end of data")
 	}
 
+	// Ensure the entry was serialized with a supported version.  The legacy
+	// and current versions share the same layout and only differ in the
+	// version tag.
+	txLen, version := decodeEntryTxLen(byteOrder.Uint32(serialized[8:12]))
+	switch version {
+	case entryVersionLegacy, entryVersion:
+	default:
+		return errDeserialize(fmt.Sprintf("unsupported entry version %d",
+			version))
+	}
+
 	hash, err := fetchBlockHash(serialized[0:4])
 	if err != nil {
 		return err
@@ -175,8 +730,14 @@ func deserializeAddrIndexEntry(serialized []byte, entry *TxIndexEntry, fetchBloc
 	region := &entry.BlockRegion
 	region.Hash = hash
 	region.Offset = byteOrder.Uint32(serialized[4:8])
-	region.Len = byteOrder.Uint32(serialized[8:12])
-	entry.BlockIndex = byteOrder.Uint32(serialized[12:16])
+	region.Len = txLen
+	blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+	entry.BlockIndex = blockIndexFlags & blockIndexMask
+	entry.Tree = decodeEntryTree(blockIndexFlags)
+	entry.StakeTags = decodeEntryStakeTags(blockIndexFlags)
+	entry.Class = decodeEntryTxClass(blockIndexFlags)
+	entry.OutputKind = decodeEntryOutputKind(blockIndexFlags)
+	entry.Credit = decodeEntryCredit(blockIndexFlags)
 	return nil
 }
 
@@ -190,15 +751,26 @@ func keyForLevel(addrKey [addrKeySize]byte, level uint8) [levelKeySize]byte {
 }
 
 // dbPutAddrIndexEntry updates the address index to include the provided entry
-// according to the level-based scheme described in detail above.
-func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txLoc wire.TxLoc, blockIndex uint32) error {
+// according to the level-based scheme described in detail above.  An
+// AssertError is returned when adding the entry would require exceeding the
+// maximum allowed level.
+func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txLoc wire.TxLoc, blockIndexFlags uint32) error {
+	return dbPutAddrIndexEntryMaxLevel(bucket, addrKey, blockID, txLoc,
+		blockIndexFlags, maxAddrIndexLevel)
+}
+
+// dbPutAddrIndexEntryMaxLevel is identical to dbPutAddrIndexEntry except it
+// allows the maximum allowed level to be specified.  This allows the level
+// depth guard to be exercised without needing to fill the enormous levels that
+// precede the real maximum.
+func dbPutAddrIndexEntryMaxLevel(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txLoc wire.TxLoc, blockIndexFlags uint32, maxLevel uint8) error {
 	// Start with level 0 and its initial max number of entries.
 	curLevel := uint8(0)
 	maxLevelBytes := level0MaxEntries * txEntrySize
 
 	// Simply append the new entry to level 0 and return now when it will
 	// fit.  This is the most common path.
-	newData := serializeAddrIndexEntry(blockID, txLoc, blockIndex)
+	newData := serializeAddrIndexEntry(blockID, txLoc, blockIndexFlags)
 	level0Key := keyForLevel(addrKey, 0)
 	level0Data := bucket.Get(level0Key[:])
 	if len(level0Data)+len(newData) <= maxLevelBytes {
@@ -216,6 +788,15 @@ func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, block
 	prevLevelData := level0Data
 	for {
 		// Each new level holds twice as much as the previous one.
+		//
+		// Note that all levels up to this point are full and nothing
+		// has been modified yet, so it is safe to bail out here without
+		// leaving the entry in an inconsistent state.
+		if curLevel >= maxLevel {
+			str := fmt.Sprintf("address index entry for key %x would "+
+				"exceed the maximum level of %d", addrKey, maxLevel)
+			return AssertError(str)
+		}
 		curLevel++
 		maxLevelBytes *= 2
 
@@ -258,19 +839,44 @@ func dbPutAddrIndexEntry(bucket internalBucket, addrKey [addrKeySize]byte, block
 	return bucket.Put(level0Key[:], newData)
 }
 
-// dbFetchAddrIndexEntries returns block regions for transactions referenced by
-// the given address key and the number of entries skipped since it could have
-// been less in the case where there are less total entries than the requested
-// number of entries to skip.
-func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, uint32, error) {
+// dbFetchSerializedAddrIndexLevels returns the serialized entries of the levels
+// for the given address key that are needed to satisfy the provided number to
+// skip and number requested ordered from oldest to newest.  All levels are
+// returned when the reverse flag is not set.
+//
+// The returned data might reference the data of the bucket and therefore MUST
+// NOT be modified.
+func dbFetchSerializedAddrIndexLevels(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool) []byte {
+	serialized, _ := dbFetchSerializedAddrIndexLevelsUntil(bucket, addrKey,
+		numToSkip, numRequested, reverse, time.Time{})
+	return serialized
+}
+
+// dbFetchSerializedAddrIndexLevelsUntil is identical to
+// dbFetchSerializedAddrIndexLevels except that it stops loading levels once the
+// provided deadline is reached and returns true to indicate the levels were
+// truncated.  No entries are returned in that case since the levels loaded so
+// far do not necessarily include the entries needed to satisfy the request.
+// The deadline is checked before each level is loaded and a zero deadline
+// disables it.
+func dbFetchSerializedAddrIndexLevelsUntil(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, deadline time.Time) ([]byte, bool) {
 	// When the reverse flag is not set, all levels need to be fetched
 	// because numToSkip and numRequested are counted from the oldest
 	// transactions (highest level) and thus the total count is needed.
 	// However, when the reverse flag is set, only enough records to satisfy
 	// the requested amount are needed.
+	//
+	// Note that the number of bytes needed is calculated with 64-bit
+	// arithmetic since the sum of the number to skip and number requested
+	// can overflow a uint32.
 	var level uint8
 	var serialized []byte
-	for !reverse || len(serialized) < int(numToSkip+numRequested)*txEntrySize {
+	numBytesNeeded := (uint64(numToSkip) + uint64(numRequested)) * txEntrySize
+	for !reverse || uint64(len(serialized)) < numBytesNeeded {
+		if deadlineReached(deadline) {
+			return nil, true
+		}
+
 		curLevelKey := keyForLevel(addrKey, level)
 		levelData := bucket.Get(curLevelKey[:])
 		if levelData == nil {
@@ -278,25 +884,77 @@ func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, n
 			break
 		}
 
+		// Use the first level directly without copying it since the
+		// serialized data is only read by callers.  This is notably the case
+		// for the vast majority of addresses which only have entries in level
+		// 0.
+		level++
+		if serialized == nil {
+			serialized = levelData
+			continue
+		}
+
 		// Higher levels contain older transactions, so prepend them.
 		prepended := make([]byte, len(serialized)+len(levelData))
 		copy(prepended, levelData)
 		copy(prepended[len(levelData):], serialized)
 		serialized = prepended
-		level++
 	}
 
+	return serialized, false
+}
+
+// deadlineReached returns whether or not the provided deadline has been
+// reached.  A zero deadline is never reached.
+func deadlineReached(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// dbFetchAddrIndexEntries returns block regions for transactions referenced by
+// the given address key and the number of entries skipped since it could have
+// been less in the case where there are less total entries than the requested
+// number of entries to skip.
+func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, uint32, error) {
+	serialized := dbFetchSerializedAddrIndexLevels(bucket, addrKey, numToSkip,
+		numRequested, reverse)
+	return deserializeAddrIndexEntries(serialized, addrKey, numToSkip,
+		numRequested, reverse, fetchBlockHash)
+}
+
+// deserializeAddrIndexEntries returns block regions for the transactions
+// referenced by the provided serialized entries for the given address key,
+// which must be ordered from oldest to newest, according to the provided number
+// to skip, number requested, and whether or not the results should be
+// reversed.  It also returns the number of entries skipped since it could have
+// been less in the case where there are less total entries than the requested
+// number of entries to skip.
+//
+// The serialized entries must contain at least the newest entries needed to
+// satisfy the request when the reverse flag is set and all entries otherwise.
+func deserializeAddrIndexEntries(serialized []byte, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, uint32, error) {
+	entries, skipped, _, err := deserializeAddrIndexEntriesUntil(serialized,
+		addrKey, numToSkip, numRequested, reverse, time.Time{},
+		fetchBlockHash)
+	return entries, skipped, err
+}
+
+// deserializeAddrIndexEntriesUntil is identical to deserializeAddrIndexEntries
+// except that it stops deserializing once the provided deadline is reached and
+// returns the entries deserialized so far along with true to indicate the
+// results were truncated.  The deadline is checked periodically rather than for
+// every entry and a zero deadline disables it.
+func deserializeAddrIndexEntriesUntil(serialized []byte, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, deadline time.Time, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, uint32, bool, error) {
 	// When the requested number of entries to skip is larger than the
 	// number available, skip them all and return now with the actual number
 	// skipped.
 	numEntries := uint32(len(serialized) / txEntrySize)
 	if numToSkip >= numEntries {
-		return nil, numEntries, nil
+		return nil, numEntries, false, nil
 	}
 
 	// Nothing more to do when there are no requested entries.
 	if numRequested == 0 {
-		return nil, numToSkip, nil
+		return nil, numToSkip, false, nil
 	}
 
 	// Limit the number to load based on the number of available entries,
@@ -310,6 +968,11 @@ func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, n
 	// number.
 	results := make([]TxIndexEntry, numToLoad)
 	for i := uint32(0); i < numToLoad; i++ {
+		// Stop with the entries loaded so far once the deadline is reached.
+		if i%deadlineCheckInterval == 0 && deadlineReached(deadline) {
+			return results[:i], numToSkip, true, nil
+		}
+
 		// Calculate the read offset according to the reverse flag.
 		var offset uint32
 		if reverse {
@@ -330,167 +993,576 @@ func dbFetchAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, n
 				err = makeDbErr(database.ErrCorruption, str)
 			}
 
-			return nil, 0, err
+			return nil, 0, false, err
 		}
 	}
 
-	return results, numToSkip, nil
-}
-
-// minEntriesToReachLevel returns the minimum number of entries that are
-// required to reach the given address index level.
-func minEntriesToReachLevel(level uint8) int {
-	maxEntriesForLevel := level0MaxEntries
-	minRequired := 1
-	for l := uint8(1); l <= level; l++ {
-		minRequired += maxEntriesForLevel
-		maxEntriesForLevel *= 2
-	}
-	return minRequired
+	return results, numToSkip, false, nil
 }
 
-// maxEntriesForLevel returns the maximum number of entries allowed for the
-// given address index level.
-func maxEntriesForLevel(level uint8) int {
-	numEntries := level0MaxEntries
-	for l := level; l > 0; l-- {
-		numEntries *= 2
-	}
-	return numEntries
-}
+// dbFetchAddrIndexBlockIDs returns the block IDs of the entries for the given
+// address key according to the provided number to skip, number requested, and
+// whether or not the results should be reversed without resolving them to
+// block hashes.
+func dbFetchAddrIndexBlockIDs(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool) []uint32 {
+	serialized := dbFetchSerializedAddrIndexLevels(bucket, addrKey, numToSkip,
+		numRequested, reverse)
 
-// dbRemoveAddrIndexEntries removes the specified number of entries from
-// the address index for the provided key.  An assertion error will be returned
-// if the count exceeds the total number of entries in the index.
-func dbRemoveAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, count int) error {
-	// Nothing to do if no entries are being deleted.
-	if count <= 0 {
+	// Limit the number to load based on the number of available entries,
+	// the number to skip, and the number requested.
+	numEntries := uint32(len(serialized) / txEntrySize)
+	if numToSkip >= numEntries || numRequested == 0 {
 		return nil
 	}
+	numToLoad := numEntries - numToSkip
+	if numToLoad > numRequested {
+		numToLoad = numRequested
+	}
 
-	// Make use of a local map to track pending updates and define a closure
-	// to apply it to the database.  This is done in order to reduce the
-	// number of database reads and because there is more than one exit
-	// path that needs to apply the updates.
-	pendingUpdates := make(map[uint8][]byte)
-	applyPending := func() error {
-		for level, data := range pendingUpdates {
-			curLevelKey := keyForLevel(addrKey, level)
-			if len(data) == 0 {
-				err := bucket.Delete(curLevelKey[:])
-				if err != nil {
-					return err
-				}
-				continue
-			}
-			err := bucket.Put(curLevelKey[:], data)
-			if err != nil {
-				return err
-			}
+	// The block ID is the first field of each serialized entry.
+	blockIDs := make([]uint32, numToLoad)
+	for i := uint32(0); i < numToLoad; i++ {
+		// Calculate the read offset according to the reverse flag.
+		var offset uint32
+		if reverse {
+			offset = (numEntries - numToSkip - i - 1) * txEntrySize
+		} else {
+			offset = (numToSkip + i) * txEntrySize
 		}
-		return nil
+		blockIDs[i] = byteOrder.Uint32(serialized[offset:])
 	}
+	return blockIDs
+}
 
-	// Loop forwards through the levels while removing entries until the
-	// specified number has been removed.  This will potentially result in
-	// entirely empty lower levels which will be backfilled below.
-	var highestLoadedLevel uint8
-	numRemaining := count
-	for level := uint8(0); numRemaining > 0; level++ {
-		// Load the data for the level from the database.
+// addrIndexEntryFilter defines a callback function used to determine whether
+// or not the provided serialized address index entry should be included in the
+// results of a filtered fetch.
+type addrIndexEntryFilter func(serialized []byte) bool
+
+// dbFetchFilteredAddrIndexEntries returns block regions for transactions
+// referenced by the given address key that match the provided filter along with
+// the number of matching entries skipped since it could have been less in the
+// case where there are less total matching entries than the requested number of
+// entries to skip.
+//
+// The number to skip, number requested, and reverse flag all apply to the
+// matching entries as if the non-matching entries did not exist.
+func dbFetchFilteredAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, filter addrIndexEntryFilter, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, uint32, error) {
+	// Load all levels since the filter has to be applied to every entry in
+	// order to determine the number of matching entries.  Higher levels
+	// contain older transactions, so prepend them.
+	var serialized []byte
+	for level := uint8(0); ; level++ {
 		curLevelKey := keyForLevel(addrKey, level)
-		curLevelData := bucket.Get(curLevelKey[:])
-		if len(curLevelData) == 0 && numRemaining > 0 {
-			return AssertError(fmt.Sprintf("dbRemoveAddrIndexEntries "+
-				"not enough entries for address key %x to "+
-				"delete %d entries", addrKey, count))
+		levelData := bucket.Get(curLevelKey[:])
+		if levelData == nil {
+			// Stop when there are no more levels.
+			break
 		}
-		pendingUpdates[level] = curLevelData
-		highestLoadedLevel = level
+		prepended := make([]byte, len(serialized)+len(levelData))
+		copy(prepended, levelData)
+		copy(prepended[len(levelData):], serialized)
+		serialized = prepended
+	}
 
-		// Delete the entire level as needed.
-		numEntries := len(curLevelData) / txEntrySize
-		if numRemaining >= numEntries {
-			pendingUpdates[level] = nil
-			numRemaining -= numEntries
+	// Iterate the entries in the requested order, skip the requested number
+	// of matching entries, and load matching entries until the requested
+	// number is reached.
+	var results []TxIndexEntry
+	var skipped uint32
+	numEntries := len(serialized) / txEntrySize
+	for i := 0; i < numEntries && uint32(len(results)) < numRequested; i++ {
+		offset := i * txEntrySize
+		if reverse {
+			offset = (numEntries - i - 1) * txEntrySize
+		}
+		entryData := serialized[offset : offset+txEntrySize]
+		if !filter(entryData) {
+			continue
+		}
+		if skipped < numToSkip {
+			skipped++
 			continue
 		}
 
-		// Remove remaining entries to delete from the level.
-		offsetEnd := len(curLevelData) - (numRemaining * txEntrySize)
-		pendingUpdates[level] = curLevelData[:offsetEnd]
-		break
-	}
+		// Deserialize and populate the result.
+		var entry TxIndexEntry
+		err := deserializeAddrIndexEntry(entryData, &entry, fetchBlockHash)
+		if err != nil {
+			// Ensure any deserialization errors are returned as
+			// database corruption errors.
+			if isDeserializeErr(err) {
+				str := fmt.Sprintf("failed to deserialized address index "+
+					"for key %x: %v", addrKey, err)
+				err = makeDbErr(database.ErrCorruption, str)
+			}
 
-	// When all elements in level 0 were not removed there is nothing left
-	// to do other than updating the database.
-	if len(pendingUpdates[0]) != 0 {
-		return applyPending()
+			return nil, 0, err
+		}
+		results = append(results, entry)
 	}
 
-	// At this point there are one or more empty levels before the current
-	// level which need to be backfilled and the current level might have
-	// had some entries deleted from it as well.  Since all levels after
-	// level 0 are required to either be empty, half full, or completely
-	// full, the current level must be adjusted accordingly by backfilling
-	// each previous levels in a way which satisfies the requirements.  Any
-	// entries that are left are assigned to level 0 after the loop as they
-	// are guaranteed to fit by the logic in the loop.  In other words, this
-	// effectively squashes all remaining entries in the current level into
-	// the lowest possible levels while following the level rules.
-	//
-	// Note that the level after the current level might also have entries
-	// and gaps are not allowed, so this also keeps track of the lowest
-	// empty level so the code below knows how far to backfill in case it is
-	// required.
-	lowestEmptyLevel := uint8(255)
-	curLevelData := pendingUpdates[highestLoadedLevel]
-	curLevelMaxEntries := maxEntriesForLevel(highestLoadedLevel)
-	for level := highestLoadedLevel; level > 0; level-- {
-		// When there are not enough entries left in the current level
-		// for the number that would be required to reach it, clear the
-		// the current level which effectively moves them all up to the
-		// previous level on the next iteration.  Otherwise, there are
-		// are sufficient entries, so update the current level to
-		// contain as many entries as possible while still leaving
-		// enough remaining entries required to reach the level.
-		numEntries := len(curLevelData) / txEntrySize
-		prevLevelMaxEntries := curLevelMaxEntries / 2
-		minPrevRequired := minEntriesToReachLevel(level - 1)
-		if numEntries < prevLevelMaxEntries+minPrevRequired {
-			lowestEmptyLevel = level
-			pendingUpdates[level] = nil
-		} else {
-			// This level can only be completely full or half full,
-			// so choose the appropriate offset to ensure enough
-			// entries remain to reach the level.
-			var offset int
-			if numEntries-curLevelMaxEntries >= minPrevRequired {
-				offset = curLevelMaxEntries * txEntrySize
-			} else {
-				offset = prevLevelMaxEntries * txEntrySize
+	// Account for any remaining matching entries that need to be skipped
+	// when no entries were requested.
+	if numRequested == 0 {
+		for i := 0; i < numEntries && skipped < numToSkip; i++ {
+			offset := i * txEntrySize
+			if filter(serialized[offset : offset+txEntrySize]) {
+				skipped++
 			}
-			pendingUpdates[level] = curLevelData[:offset]
-			curLevelData = curLevelData[offset:]
 		}
-
-		curLevelMaxEntries = prevLevelMaxEntries
 	}
-	pendingUpdates[0] = curLevelData
-	if len(curLevelData) == 0 {
-		lowestEmptyLevel = 0
+
+	return results, skipped, nil
+}
+
+// addrIndexPageCursorSize is the number of bytes a serialized page cursor
+// consumes.  It consists of 1 byte for the direction + 1 byte for the level +
+// 4 bytes for the index of the entry within the level + the serialized entry
+// at that position.
+const addrIndexPageCursorSize = 1 + 1 + 4 + txEntrySize
+
+// dbFetchAddrIndexEntriesPage returns up to the requested number of entries
+// for the given address key starting at the position identified by the
+// provided page cursor along with the cursor for the next page.  A nil cursor
+// starts at the oldest entry, or the newest entry when the reverse flag is set,
+// and a nil next cursor is returned when there are no more entries.
+//
+// Only the levels that house the returned entries are loaded.
+// ErrInvalidPageCursor is returned when the cursor is malformed, was created
+// for the other direction, or no longer refers to the same entry due to
+// changes to the levels of the address.
+func dbFetchAddrIndexEntriesPage(bucket internalBucket, addrKey [addrKeySize]byte, cursor []byte, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]TxIndexEntry, []byte, error) {
+	// loadLevel returns the data for the provided level of the address.
+	loadLevel := func(level uint8) []byte {
+		levelKey := keyForLevel(addrKey, level)
+		return bucket.Get(levelKey[:])
 	}
 
-	// When the highest loaded level is empty, it's possible the level after
-	// it still has data and thus that data needs to be backfilled as well.
+	// Determine the level and index within the level to start from.
+	var level uint8
+	var index int
+	var levelData []byte
+	switch {
+	case cursor != nil:
+		if len(cursor) != addrIndexPageCursorSize || cursor[0] > 1 ||
+			(cursor[0] == 1) != reverse {
+
+			return nil, nil, fmt.Errorf("%w: malformed cursor",
+				ErrInvalidPageCursor)
+		}
+		level = cursor[1]
+		index = int(byteOrder.Uint32(cursor[2:6]))
+		levelData = loadLevel(level)
+		offset := index * txEntrySize
+		if offset+txEntrySize > len(levelData) ||
+			!bytes.Equal(levelData[offset:offset+txEntrySize], cursor[6:]) {
+
+			return nil, nil, fmt.Errorf("%w: entries for the address have "+
+				"changed", ErrInvalidPageCursor)
+		}
+
+	case reverse:
+		// The newest entry is the last entry of level 0.
+		levelData = loadLevel(0)
+		index = len(levelData)/txEntrySize - 1
+
+	default:
+		// The oldest entry is the first entry of the highest level.
+		levelData = loadLevel(0)
+		for {
+			nextLevelData := loadLevel(level + 1)
+			if nextLevelData == nil {
+				break
+			}
+			level++
+			levelData = nextLevelData
+		}
+	}
+
+	// valid returns whether or not the current position refers to an entry.
+	valid := func() bool {
+		return index >= 0 && (index+1)*txEntrySize <= len(levelData)
+	}
+
+	// advance moves to the next position according to the direction while
+	// loading the next populated level as needed.  It returns false when
+	// there are no more entries.
+	//
+	// Note that levels other than level 0 may be empty, so they are skipped.
+	advance := func() bool {
+		if reverse {
+			index--
+			for !valid() {
+				level++
+				levelData = loadLevel(level)
+				if levelData == nil {
+					return false
+				}
+				index = len(levelData)/txEntrySize - 1
+			}
+			return true
+		}
+
+		index++
+		for !valid() {
+			if level == 0 {
+				return false
+			}
+			level--
+			levelData = loadLevel(level)
+			index = 0
+		}
+		return true
+	}
+
+	// Load the requested number of entries.
+	more := valid() || (cursor == nil && reverse && advance())
+	var results []TxIndexEntry
+	for ; more && uint32(len(results)) < numRequested; more = advance() {
+		offset := index * txEntrySize
+		var entry TxIndexEntry
+		err := deserializeAddrIndexEntry(levelData[offset:], &entry,
+			fetchBlockHash)
+		if err != nil {
+			// Ensure any deserialization errors are returned as database
+			// corruption errors.
+			if isDeserializeErr(err) {
+				str := fmt.Sprintf("failed to deserialized address index "+
+					"for key %x: %v", addrKey, err)
+				err = makeDbErr(database.ErrCorruption, str)
+			}
+
+			return nil, nil, err
+		}
+		results = append(results, entry)
+	}
+	if !more {
+		return results, nil, nil
+	}
+
+	// Create the cursor for the next page.
+	nextCursor := make([]byte, addrIndexPageCursorSize)
+	if reverse {
+		nextCursor[0] = 1
+	}
+	nextCursor[1] = level
+	byteOrder.PutUint32(nextCursor[2:6], uint32(index))
+	offset := index * txEntrySize
+	copy(nextCursor[6:], levelData[offset:offset+txEntrySize])
+	return results, nextCursor, nil
+}
+
+// minEntriesToReachLevel returns the minimum number of entries that are
+// required to reach the given address index level.  An AssertError is returned
+// when the level exceeds the level after the maximum allowed level.
+//
+// The calculation is performed with 64-bit unsigned integers and the levels are
+// limited such that the result always fits in a signed 32-bit integer, so it
+// never overflows regardless of the native integer width of the platform.
+func minEntriesToReachLevel(level uint8) (int, error) {
+	if level > maxAddrIndexLevel+1 {
+		str := fmt.Sprintf("address index level %d exceeds the maximum "+
+			"reachable level of %d", level, maxAddrIndexLevel+1)
+		return 0, AssertError(str)
+	}
+
+	// Every level before the given level must be full to reach it and each
+	// level holds double the entries of the previous one, so the sum of the
+	// maximum entries of all of the previous levels is level0MaxEntries *
+	// (2^level - 1).
+	minRequired := 1 + uint64(level0MaxEntries)*(uint64(1)<<level-1)
+	return int(minRequired), nil
+}
+
+// maxEntriesForLevel returns the maximum number of entries allowed for the
+// given address index level.  An AssertError is returned when the level exceeds
+// the maximum allowed level.
+//
+// Similar to minEntriesToReachLevel, the result always fits in a signed 32-bit
+// integer.
+func maxEntriesForLevel(level uint8) (int, error) {
+	if level > maxAddrIndexLevel {
+		str := fmt.Sprintf("address index level %d exceeds the maximum "+
+			"level of %d", level, maxAddrIndexLevel)
+		return 0, AssertError(str)
+	}
+	return int(uint64(level0MaxEntries) << level), nil
+}
+
+// dbPutAddrIndexLevels replaces all of the levels for the provided address key
+// with the provided serialized entries, which must be ordered from oldest to
+// newest, laid out according to the level-based scheme described in detail
+// above.
+//
+// Level 0 is assigned the newest entries such that the number of remaining
+// entries is a multiple of its max number of entries.  Since every level after
+// level 0 must either be half full or completely full and gaps between levels
+// are not allowed, each subsequent level then holds either one or two times
+// half of its max number of entries according to the digits of the bijective
+// base-2 representation of the number of remaining entries divided by the max
+// number of entries of level 0, which is unique and never contains a zero.
+func dbPutAddrIndexLevels(bucket internalBucket, addrKey [addrKeySize]byte, serialized []byte) error {
+	// Remove all of the existing levels.
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		if bucket.Get(levelKey[:]) == nil {
+			break
+		}
+		if err := bucket.Delete(levelKey[:]); err != nil {
+			return err
+		}
+	}
+	numEntries := len(serialized) / txEntrySize
+	if numEntries == 0 {
+		return nil
+	}
+
+	// Assign the newest entries to level 0.
+	numLevel0 := numEntries % level0MaxEntries
+	if numLevel0 == 0 {
+		numLevel0 = level0MaxEntries
+	}
+	end := len(serialized)
+	start := end - numLevel0*txEntrySize
+	level0Key := keyForLevel(addrKey, 0)
+	if err := bucket.Put(level0Key[:], serialized[start:end]); err != nil {
+		return err
+	}
+
+	// Assign the remaining entries to the subsequent levels from newest to
+	// oldest.
+	remaining := (numEntries - numLevel0) / level0MaxEntries
+	for level := uint8(1); remaining > 0; level++ {
+		digit := 2 - remaining%2
+		remaining = (remaining - digit) / 2
+
+		maxEntries, err := maxEntriesForLevel(level)
+		if err != nil {
+			return err
+		}
+		end = start
+		start = end - digit*(maxEntries/2)*txEntrySize
+		levelKey := keyForLevel(addrKey, level)
+		if err := bucket.Put(levelKey[:], serialized[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveAddrIndexEntries removes the specified number of entries from
+// the address index for the provided key.  An assertion error will be returned
+// if the count exceeds the total number of entries in the index.
+func dbRemoveAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte, count int) error {
+	removal := newAddrLevelRemoval()
+	if err := removal.compute(bucket, addrKey, count); err != nil {
+		return err
+	}
+	return dbApplyAddrLevelUpdates(bucket, addrKey, removal.pendingUpdates)
+}
+
+// dbApplyAddrLevelUpdates applies the provided pending level updates for the
+// provided address key to the provided bucket.  Levels with no data are
+// deleted.
+func dbApplyAddrLevelUpdates(bucket internalBucket, addrKey [addrKeySize]byte, pendingUpdates map[uint8][]byte) error {
+	for level, data := range pendingUpdates {
+		curLevelKey := keyForLevel(addrKey, level)
+		if len(data) == 0 {
+			err := bucket.Delete(curLevelKey[:])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := bucket.Put(curLevelKey[:], data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveAddrBlockEntries removes the entries for each of the provided
+// addresses from the address index in the same way as calling
+// dbRemoveAddrIndexEntries for each of them in order, however, it does so more
+// efficiently.  The number of entries to remove for each address is the number
+// of transactions for it in the provided write index data.
+//
+// The pending level updates for each address are computed in a single pass
+// and applied before moving on to the next address.  The state used to compute
+// them is shared by all of the addresses to avoid allocating new state for
+// each of them.
+func dbRemoveAddrBlockEntries(bucket internalBucket, data writeIndexData, addrKeys [][addrKeySize]byte) error {
+	removal := newAddrLevelRemoval()
+	for _, addrKey := range addrKeys {
+		err := removal.compute(bucket, addrKey, len(data[addrKey]))
+		if err != nil {
+			return err
+		}
+		err = dbApplyAddrLevelUpdates(bucket, addrKey, removal.pendingUpdates)
+		if err != nil {
+			return err
+		}
+		removal.reset()
+	}
+	return nil
+}
+
+// addrLevelRemoval houses the state used to compute the level updates needed
+// to remove entries from the address index.  It may be reused for multiple
+// addresses by resetting it between them.
+type addrLevelRemoval struct {
+	// pendingUpdates houses the pending data for each level that needs to
+	// be updated keyed by the level.  Levels with no data are to be deleted.
+	pendingUpdates map[uint8][]byte
+
+	// levelKey is scratch space used for the keys of the levels that are
+	// read which avoids allocating a new key for each read.
+	levelKey [levelKeySize]byte
+}
+
+// newAddrLevelRemoval returns a new address level removal with no pending
+// updates.
+func newAddrLevelRemoval() *addrLevelRemoval {
+	return &addrLevelRemoval{pendingUpdates: make(map[uint8][]byte)}
+}
+
+// reset clears the pending updates so the removal may be reused for another
+// address.
+func (r *addrLevelRemoval) reset() {
+	for level := range r.pendingUpdates {
+		delete(r.pendingUpdates, level)
+	}
+}
+
+// getLevel returns the data for the provided level of the provided address key
+// from the provided bucket.
+func (r *addrLevelRemoval) getLevel(bucket internalBucket, addrKey [addrKeySize]byte, level uint8) []byte {
+	copy(r.levelKey[:], addrKey[:])
+	r.levelKey[levelOffset] = level
+	return bucket.Get(r.levelKey[:])
+}
+
+// compute populates the pending updates with the level updates needed to
+// remove the specified number of entries from the address index for the
+// provided key according to the level-based scheme described in detail above.
+// There must not be any existing pending updates.  An assertion error will be
+// returned if the count exceeds the total number of entries in the index.
+func (r *addrLevelRemoval) compute(bucket internalBucket, addrKey [addrKeySize]byte, count int) error {
+	// Nothing to do if no entries are being deleted.
+	if count <= 0 {
+		return nil
+	}
+
+	// Make use of a map to track pending updates.  This is done in order to
+	// reduce the number of database reads.
+	pendingUpdates := r.pendingUpdates
+
+	// Loop forwards through the levels while removing entries until the
+	// specified number has been removed.  This will potentially result in
+	// entirely empty lower levels which will be backfilled below.
+	var highestLoadedLevel uint8
+	numRemaining := count
+	for level := uint8(0); numRemaining > 0; level++ {
+		// Load the data for the level from the database.
+		curLevelData := r.getLevel(bucket, addrKey, level)
+		if len(curLevelData) == 0 && numRemaining > 0 {
+			return AssertError(fmt.Sprintf("dbRemoveAddrIndexEntries "+
+				"not enough entries for address key %x to "+
+				"delete %d entries", addrKey, count))
+		}
+		pendingUpdates[level] = curLevelData
+		highestLoadedLevel = level
+
+		// Delete the entire level as needed.
+		numEntries := len(curLevelData) / txEntrySize
+		if numRemaining >= numEntries {
+			pendingUpdates[level] = nil
+			numRemaining -= numEntries
+			continue
+		}
+
+		// Remove remaining entries to delete from the level.
+		offsetEnd := len(curLevelData) - (numRemaining * txEntrySize)
+		pendingUpdates[level] = curLevelData[:offsetEnd]
+		break
+	}
+
+	// When all elements in level 0 were not removed there is nothing left
+	// to do other than updating the database.
+	if len(pendingUpdates[0]) != 0 {
+		return nil
+	}
+
+	// At this point there are one or more empty levels before the current
+	// level which need to be backfilled and the current level might have
+	// had some entries deleted from it as well.  Since all levels after
+	// level 0 are required to either be empty, half full, or completely
+	// full, the current level must be adjusted accordingly by backfilling
+	// each previous levels in a way which satisfies the requirements.  Any
+	// entries that are left are assigned to level 0 after the loop as they
+	// are guaranteed to fit by the logic in the loop.  In other words, this
+	// effectively squashes all remaining entries in the current level into
+	// the lowest possible levels while following the level rules.
+	//
+	// Note that the level after the current level might also have entries
+	// and gaps are not allowed, so this also keeps track of the lowest
+	// empty level so the code below knows how far to backfill in case it is
+	// required.
+	lowestEmptyLevel := uint8(255)
+	curLevelData := pendingUpdates[highestLoadedLevel]
+	curLevelMaxEntries, err := maxEntriesForLevel(highestLoadedLevel)
+	if err != nil {
+		return err
+	}
+	for level := highestLoadedLevel; level > 0; level-- {
+		// When there are not enough entries left in the current level
+		// for the number that would be required to reach it, clear the
+		// the current level which effectively moves them all up to the
+		// previous level on the next iteration.  Otherwise, there are
+		// are sufficient entries, so update the current level to
+		// contain as many entries as possible while still leaving
+		// enough remaining entries required to reach the level.
+		numEntries := len(curLevelData) / txEntrySize
+		prevLevelMaxEntries := curLevelMaxEntries / 2
+		minPrevRequired, err := minEntriesToReachLevel(level - 1)
+		if err != nil {
+			return err
+		}
+		if numEntries < prevLevelMaxEntries+minPrevRequired {
+			lowestEmptyLevel = level
+			pendingUpdates[level] = nil
+		} else {
+			// This level can only be completely full or half full,
+			// so choose the appropriate offset to ensure enough
+			// entries remain to reach the level.
+			var offset int
+			if numEntries-curLevelMaxEntries >= minPrevRequired {
+				offset = curLevelMaxEntries * txEntrySize
+			} else {
+				offset = prevLevelMaxEntries * txEntrySize
+			}
+			pendingUpdates[level] = curLevelData[:offset]
+			curLevelData = curLevelData[offset:]
+		}
+
+		curLevelMaxEntries = prevLevelMaxEntries
+	}
+	pendingUpdates[0] = curLevelData
+	if len(curLevelData) == 0 {
+		lowestEmptyLevel = 0
+	}
+
+	// When the highest loaded level is empty, it's possible the level after
+	// it still has data and thus that data needs to be backfilled as well.
 	for len(pendingUpdates[highestLoadedLevel]) == 0 {
 		// When the next level is empty too, the is no data left to
 		// continue backfilling, so there is nothing left to do.
 		// Otherwise, populate the pending updates map with the newly
 		// loaded data and update the highest loaded level accordingly.
 		level := highestLoadedLevel + 1
-		curLevelKey := keyForLevel(addrKey, level)
-		levelData := bucket.Get(curLevelKey[:])
+		levelData := r.getLevel(bucket, addrKey, level)
 		if len(levelData) == 0 {
 			break
 		}
@@ -503,7 +1575,10 @@ func dbRemoveAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte,
 		// are still empty.  This also means the current level will be
 		// empty, so the loop will perform another iteration to
 		// potentially backfill this level with data from the next one.
-		curLevelMaxEntries := maxEntriesForLevel(level)
+		curLevelMaxEntries, err := maxEntriesForLevel(level)
+		if err != nil {
+			return err
+		}
 		if len(levelData)/txEntrySize != curLevelMaxEntries {
 			pendingUpdates[level] = nil
 			pendingUpdates[level-1] = levelData
@@ -527,16 +1602,39 @@ func dbRemoveAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte,
 		lowestEmptyLevel = highestLoadedLevel
 	}
 
-	// Apply the pending updates.
-	return applyPending()
+	return nil
 }
 
 // addrToKey converts known address types to an addrindex key.  An error is
 // returned for unsupported types.
 func addrToKey(addr stdaddr.Address) ([addrKeySize]byte, error) {
-	// Convert public key addresses to public key hash variants.
+	return addrToKeyWithMode(addr, false)
+}
+
+// addrToKeyWithMode converts known address types to an addrindex key for
+// either the standard or the extended key mode.  An error is returned for
+// unsupported types.
+//
+// In the standard key mode, public key addresses are converted to their public
+// key hash variants, so payments to the raw public key and its hash are
+// indexed under the same key.  In the extended key mode, public key addresses
+// are instead identified by a distinct address type in the key so that they
+// remain distinguishable from their public key hash variants.
+func addrToKeyWithMode(addr stdaddr.Address, extendedKeys bool) ([addrKeySize]byte, error) {
+	// Convert public key addresses to public key hash variants.  This
+	// includes the pay-to-pubkey-alt addresses for the Ed25519 and secp256k1
+	// Schnorr signature types which convert to the public key hash variant
+	// of the same signature type.
 	if addrPKH, ok := addr.(stdaddr.AddressPubKeyHasher); ok {
 		addr = addrPKH.AddressPubKeyHash()
+		if extendedKeys {
+			addrKey, err := addrToKeyWithMode(addr, false)
+			if err != nil {
+				return addrKey, err
+			}
+			addrKey[0] += addrKeyTypePubKeyOffset
+			return addrKey, nil
+		}
 	}
 
 	switch addr := addr.(type) {
@@ -565,7 +1663,79 @@ func addrToKey(addr stdaddr.Address) ([addrKeySize]byte, error) {
 		return result, nil
 	}
 
-	return [addrKeySize]byte{}, errUnsupportedAddressType
+	return [addrKeySize]byte{}, ErrUnsupportedAddressType
+}
+
+// scriptAddrKeys returns the address keys for all of the supported addresses
+// in the passed public key script in the order they appear in the script.  The
+// address a ticket commitment script commits to is included when the isSStx
+// flag is set.  The keys are for the extended key mode when the extendedKeys
+// flag is set.  The returned keys may contain duplicates.
+func scriptAddrKeys(scriptVersion uint16, pkScript []byte, params *chaincfg.Params, isSStx bool, isTreasuryEnabled bool, extendedKeys bool) ([][addrKeySize]byte, error) {
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(scriptVersion,
+		pkScript, params, isTreasuryEnabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSStx && class == txscript.NullDataTy {
+		addr, err := stake.AddrFromSStxPkScrCommitment(pkScript, params)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, addr)
+	}
+
+	addrKeys := make([][addrKeySize]byte, 0, len(addrs))
+	for _, addr := range addrs {
+		addrKey, err := addrToKeyWithMode(addr, extendedKeys)
+		if err != nil {
+			// Ignore unsupported address types.
+			continue
+		}
+		addrKeys = append(addrKeys, addrKey)
+	}
+	return addrKeys, nil
+}
+
+// ScriptAddrExtractor defines the signature of a function that returns the
+// address keys to index for the passed public key script in addition to the
+// keys of the standard addresses the index already recognizes.  This allows
+// custom script types to be indexed.  It must return nil for scripts that it
+// does not recognize.
+//
+// Each key consists of a single byte that identifies the type of the address
+// followed by its hash160.  The function is invoked for the scripts of both the
+// outputs and the spent previous outputs of confirmed and unconfirmed
+// transactions, so it must be safe for concurrent access.
+type ScriptAddrExtractor func(scriptVersion uint16, pkScript []byte) [][addrKeySize]byte
+
+// keyToAddr converts the passed address key back into an address for the
+// provided network.  It is the inverse of addrToKey.
+//
+// NOTE: Since addrToKey collapses public key addresses into their public key
+// hash variants, the original public key is not recoverable and the decoded
+// address is always the pay-to-pubkey-hash form of the relevant signature
+// type.  This is also the case for the public key address types of the
+// extended key mode.
+func keyToAddr(addrKey [addrKeySize]byte, params *chaincfg.Params) (stdaddr.Address, error) {
+	hash160 := addrKey[1:]
+	switch addrKey[0] {
+	case addrKeyTypePubKeyHash, addrKeyTypePubKey:
+		return stdaddr.NewAddressPubKeyHashEcdsaSecp256k1V0(hash160, params)
+
+	case addrKeyTypePubKeyHashEdwards, addrKeyTypePubKeyEdwards:
+		return stdaddr.NewAddressPubKeyHashEd25519V0(hash160, params)
+
+	case addrKeyTypePubKeyHashSchnorr, addrKeyTypePubKeySchnorr:
+		return stdaddr.NewAddressPubKeyHashSchnorrSecp256k1V0(hash160, params)
+
+	case addrKeyTypeScriptHash:
+		return stdaddr.NewAddressScriptHashV0FromHash(hash160, params)
+	}
+
+	return nil, ErrUnsupportedAddressType
 }
 
 // AddrIndex implements a transaction by address index.  That is to say, it
@@ -586,6 +1756,7 @@ type AddrIndex struct {
 	chainParams *chaincfg.Params
 	sub         *IndexSubscription
 	consumer    *SpendConsumer
+	metrics     Metrics
 
 	// The following fields are used to quickly link transactions and
 	// addresses that have not been included into a block yet when an
@@ -600,21 +1771,178 @@ type AddrIndex struct {
 	// keep an index of all addresses which a given transaction involves.
 	// This allows fairly efficient updates when transactions are removed
 	// once they are included into a block.
-	unconfirmedLock sync.RWMutex
-	txnsByAddr      map[[addrKeySize]byte]map[chainhash.Hash]*dcrutil.Tx
-	addrsByTx       map[chainhash.Hash]map[[addrKeySize]byte]struct{}
-
-	subscribers map[chan bool]struct{}
-	mtx         sync.Mutex
-	cancel      context.CancelFunc
-}
-
-// Ensure the AddrIndex type implements the Indexer interface.
+	//
+	// The unconfirmedSubs field houses the channels of clients that wish to
+	// be signalled when transactions involving a given address are added to
+	// or removed from the unconfirmed index keyed by the address.
+	//
+	// The unconfirmedOrder field tracks the transactions in the order they
+	// were added along with their estimated memory usage so the oldest ones
+	// can be evicted once the number of transactions exceeds the maximum
+	// specified by maxUnconfirmedTxns.  A maximum of zero means there is no
+	// limit.  The unconfirmedElems field maps each transaction to its
+	// element in the order list and unconfirmedBytes is the total estimated
+	// number of bytes used by all of them.  The unconfirmedSeq field is the
+	// sequence number assigned to the most recently tracked transaction and
+	// the numEvictedUnconfirmed field is the cumulative number of
+	// transactions that were evicted.
+	//
+	// The maxUnconfirmedPerAddr field is the maximum number of transactions
+	// that are retained for any single address.  Mappings between an address
+	// and additional transactions are refused once it reaches the maximum.
+	// A maximum of zero means there is no limit.
+	//
+	// The droppedUnconfirmedSignals field is the cumulative number of signals
+	// to the unconfirmedSubs channels that were coalesced because the client
+	// had not yet received a previous signal.
+	unconfirmedLock    sync.RWMutex
+	txnsByAddr         map[[addrKeySize]byte]map[chainhash.Hash]*dcrutil.Tx
+	addrsByTx          map[chainhash.Hash]map[[addrKeySize]byte]struct{}
+	unconfirmedSubs    map[[addrKeySize]byte]map[chan struct{}]struct{}
+	unconfirmedOrder   *list.List
+	unconfirmedElems   map[chainhash.Hash]*list.Element
+	unconfirmedBytes   uint64
+	unconfirmedSeq     uint64
+	maxUnconfirmedTxns int
+
+	numEvictedUnconfirmed uint64
+
+	maxUnconfirmedPerAddr     int
+	droppedUnconfirmedSignals uint64
+
+	// unconfirmedQueue houses the unconfirmed transactions that are waiting
+	// to be indexed by a background goroutine when the index is configured
+	// to index unconfirmed transactions asynchronously.  It is nil
+	// otherwise.
+	unconfirmedQueue *unconfirmedQueue
+
+	// skipCoinbaseOutputs indicates the outputs of coinbase transactions are
+	// not indexed.
+	//
+	// indexRedeemScriptAddrs indicates the addresses embedded in the redeem
+	// scripts revealed by inputs that spend pay-to-script-hash outputs are
+	// indexed in addition to the script hash.
+	//
+	// extendedKeys indicates the index uses the extended key mode which
+	// distinguishes public key addresses from their public key hash variants.
+	//
+	// indexTicketCommitmentAddrs indicates votes and revocations are also
+	// indexed under the commitment addresses of the tickets they spend.
+	//
+	// changeHeuristic indicates the outputs of regular transactions are
+	// tagged as likely change or payments.
+	//
+	// indexRewardSources indicates the tickets that earned the reward
+	// outputs of votes are recorded.
+	//
+	// creditFlags indicates the entries for addresses paid by the outputs of
+	// their transactions are flagged as credits.
+	//
+	// indexGenesisOutputs indicates the outputs of the genesis block are
+	// indexed.
+	//
+	// indexAtomicSwapAddrs indicates the recipient and refund addresses
+	// embedded in the atomic swap contracts revealed by inputs that spend
+	// pay-to-script-hash outputs are indexed in addition to the script hash.
+	//
+	// trackDisapprovals indicates the blocks whose regular transaction tree
+	// was disapproved by the votes in the next block are recorded so the
+	// entries for their regular transactions are flagged as disapproved.
+	//
+	// trackInputIndexes indicates the indices of the inputs that spend
+	// outputs which pay to addresses are recorded so the entries for debits
+	// identify the inputs that reference the address.
+	//
+	// trackTotals indicates the total amounts credited to and debited from
+	// addresses are tracked.
+	//
+	// skipAddrTypes houses a flag for each address type that is not indexed
+	// where the bit position is the type.
+	skipCoinbaseOutputs        bool
+	indexRedeemScriptAddrs     bool
+	extendedKeys               bool
+	indexTicketCommitmentAddrs bool
+	changeHeuristic            bool
+	indexRewardSources         bool
+	creditFlags                bool
+	indexGenesisOutputs        bool
+	indexAtomicSwapAddrs       bool
+	trackDisapprovals          bool
+	trackInputIndexes          bool
+	trackTotals                bool
+	skipAddrTypes              uint8
+
+	// addrFilter is an optional filter of the addresses with entries in the
+	// index that is used to avoid database lookups for addresses without any
+	// entries.  It is nil when disabled.  addrFilterSize is the expected
+	// number of distinct addresses the filter is sized for.
+	addrFilter     *addrFilter
+	addrFilterSize uint32
+
+	// retentionWindow is the number of most recent blocks the index retains
+	// entries for.  Zero disables pruning.
+	retentionWindow uint32
+
+	// catchUpBatchSize is the number of blocks connected in each database
+	// transaction when catching the index up to the transaction index during
+	// initialization.  Values of one or less disable the batched catch up.
+	catchUpBatchSize uint32
+
+	// pins is the cache of the entries of the addresses that are pinned via
+	// PinAddress.
+	pins *addrPinCache
+
+	// The pendingNonStandard field houses the change to the number of
+	// non-standard scripts encountered by the index that has not yet been
+	// written to the database and the nonStandardBlocks field is the number
+	// of blocks processed since it was last written.  They are protected by
+	// the nonStandardMtx mutex.
+	nonStandardMtx     sync.Mutex
+	pendingNonStandard int64
+	nonStandardBlocks  int
+
+	// storeBlockTimes indicates the timestamps of connected blocks are
+	// stored for use by time-range queries.
+	storeBlockTimes bool
+
+	// scriptAddrExtractor is an optional function used to index additional
+	// address keys for custom scripts.
+	scriptAddrExtractor ScriptAddrExtractor
+
+	// onUnconfirmedTxEvicted is an optional callback that is invoked with
+	// the hash of each transaction that is evicted from the unconfirmed
+	// index.
+	onUnconfirmedTxEvicted func(hash *chainhash.Hash)
+
+	// updateMtx serializes the updates to the index delivered via
+	// notifications with maintenance operations that update the index over
+	// multiple database transactions.
+	updateMtx sync.Mutex
+
+	// The tipWaiters field houses the channels of clients waiting for the
+	// index to reach a given height.  They are signalled each time an update
+	// to the index is committed.  The droppedTipSignals field is the
+	// cumulative number of those signals that were coalesced because the
+	// client had not yet received a previous signal.
+	subscribers       map[chan bool]struct{}
+	tipWaiters        map[chan struct{}]struct{}
+	droppedTipSignals uint64
+	mtx               sync.Mutex
+	cancel            context.CancelFunc
+}
+
+// Ensure the AddrIndex type implements the Indexer interface.
 var _ Indexer = (*AddrIndex)(nil)
 
 // Ensure the AddrIndex type implements the NeedsInputser interface.
 var _ NeedsInputser = (*AddrIndex)(nil)
 
+// Ensure the AddrIndex type implements the tipWaitersNotifier interface.
+var _ tipWaitersNotifier = (*AddrIndex)(nil)
+
+// Ensure the AddrIndex type implements the updateSerializer interface.
+var _ updateSerializer = (*AddrIndex)(nil)
+
 // NeedsInputs signals that the index requires the referenced inputs in order
 // to properly create the index.
 //
@@ -647,15 +1975,249 @@ func (idx *AddrIndex) Init(ctx context.Context, chainParams *chaincfg.Params) er
 	if err := upgradeIndex(ctx, idx, &chainParams.GenesisHash); err != nil {
 		return err
 	}
+	if err := idx.upgradeToVersion3(ctx); err != nil {
+		return err
+	}
+
+	// Ensure the index was built with the same options.
+	if err := idx.checkOptions(); err != nil {
+		return err
+	}
+
+	// Index the outputs of the genesis block when enabled since it is never
+	// connected.
+	if err := idx.indexGenesisBlock(chainParams); err != nil {
+		return err
+	}
 
 	// Recover the address index and its dependents to the main chain if needed.
 	if err := recover(ctx, idx); err != nil {
 		return err
 	}
 
+	// Catch the index up to the transaction index in batches when enabled.
+	if idx.catchUpBatchSize > 1 {
+		log.Infof("Catching up %s to the transaction index in batches of %d "+
+			"blocks", idx.Name(), idx.catchUpBatchSize)
+		_, err := idx.connectTxIndexBlocks(ctx, idx.catchUpBatchSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Populate the address filter with the existing entries when enabled.
+	if idx.addrFilterSize > 0 {
+		log.Infof("Loading %s address filter", idx.Name())
+		filter, err := loadAddrFilter(ctx, idx.db, idx.addrFilterSize)
+		if err != nil {
+			return err
+		}
+		idx.addrFilter = filter
+	}
+
 	return nil
 }
 
+// upgradeToVersion3 upgrades an address index created prior to version 3 as
+// needed.
+//
+// Version 3 introduced the tree, stake tag, and class flags in the block index
+// field of each entry along with the serialization version stored with each
+// entry.  The flags and version of the entries created by prior versions are
+// all zero, which decodes as an unknown tree and class without any tags and as
+// version 0 of the serialization format, so the existing entries remain
+// readable as they are.
+//
+// It also introduced the persisted index options and the buckets that house
+// the companion data of the entries, such as the ticket commitment amounts,
+// the address totals, and the block timestamps.  Indexes created by prior
+// versions do not record any options, so they are treated as having been built
+// with none of them, and the buckets are created empty since the data for the
+// blocks that were already indexed is not available without reindexing them.
+func (idx *AddrIndex) upgradeToVersion3(ctx context.Context) error {
+	if interruptRequested(ctx) {
+		return errInterruptRequested
+	}
+
+	return idx.db.Update(func(dbTx database.Tx) error {
+		version, err := dbFetchIndexerVersion(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if version >= 3 {
+			return nil
+		}
+
+		log.Infof("Upgrading %s to version 3.  Entries for existing "+
+			"transactions will report an unknown tree and class and the "+
+			"data added by this version will only be available for newly "+
+			"indexed blocks", idx.Name())
+		bucketKeys := [][]byte{addrCommitmentIndexKey, addrTotalsIndexKey,
+			addrBlockTimeIndexKey, addrRewardSourceIndexKey,
+			addrUnindexedVersionIndexKey, addrDisapprovedIndexKey,
+			addrInputIndexKey}
+		for _, bucketKey := range bucketKeys {
+			_, err := dbTx.Metadata().CreateBucketIfNotExists(bucketKey)
+			if err != nil {
+				return err
+			}
+		}
+		return dbPutIndexerVersion(dbTx, idx.Key(), 3)
+	})
+}
+
+// indexGenesisBlock adds the entries for the outputs of the genesis block of
+// the provided network to the index when the index is configured to index them.
+//
+// The genesis block is the initial tip of the index and is therefore never
+// connected, so its outputs are not indexed by default.  Note that the outputs
+// of the genesis coinbase are not spendable and the premine, if any, is paid by
+// the block after it which is always indexed.
+//
+// The entries are only added when the index is at the genesis block since the
+// option is persisted with the index and therefore must have been enabled when
+// the index was created at the genesis block otherwise.  The reserved block ID
+// mapping for the genesis block is always stored so the entries can be resolved
+// even when the block ID index was rebuilt.
+func (idx *AddrIndex) indexGenesisBlock(chainParams *chaincfg.Params) error {
+	if !idx.indexGenesisOutputs {
+		return nil
+	}
+
+	genesis := dcrutil.NewBlock(chainParams.GenesisBlock)
+	return idx.db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIDIndexEntry(dbTx, genesis.Hash(), genesisBlockID)
+		if err != nil {
+			return err
+		}
+
+		_, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if tipHeight != 0 {
+			return nil
+		}
+
+		// Nothing more to do when the entries were already added.
+		prevScripts := txIndexPrevScripter{dbTx: dbTx}
+		addrsToTxns := make(writeIndexData)
+		idx.indexBlock(addrsToTxns, genesis, prevScripts, false)
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		for addrKey := range addrsToTxns {
+			levelKey := keyForLevel(addrKey, 0)
+			if bucket.Get(levelKey[:]) != nil {
+				return nil
+			}
+		}
+
+		log.Infof("Indexing outputs of genesis block %v", genesis.Hash())
+		_, err = idx.putBlockEntries(dbTx, bucket, genesis, prevScripts, false)
+		return err
+	})
+}
+
+// optionFlags returns the persisted representation of the options that affect
+// which data the index contains.
+func (idx *AddrIndex) optionFlags() uint32 {
+	var options uint32
+	if idx.skipCoinbaseOutputs {
+		options |= addrIndexOptSkipCoinbaseOutputs
+	}
+	if idx.indexRedeemScriptAddrs {
+		options |= addrIndexOptIndexRedeemScriptAddrs
+	}
+	if idx.extendedKeys {
+		options |= addrIndexOptExtendedKeys
+	}
+	if idx.indexTicketCommitmentAddrs {
+		options |= addrIndexOptIndexTicketCommitmentAddrs
+	}
+	if idx.changeHeuristic {
+		options |= addrIndexOptChangeHeuristicV1
+	}
+	if idx.indexRewardSources {
+		options |= addrIndexOptIndexRewardSources
+	}
+	if idx.creditFlags {
+		options |= addrIndexOptCreditFlags
+	}
+	if idx.indexGenesisOutputs {
+		options |= addrIndexOptIndexGenesisOutputs
+	}
+	if idx.indexAtomicSwapAddrs {
+		options |= addrIndexOptIndexAtomicSwapAddrs
+	}
+	if idx.trackDisapprovals {
+		options |= addrIndexOptTrackDisapprovals
+	}
+	if idx.trackInputIndexes {
+		options |= addrIndexOptTrackInputIndexes
+	}
+	if idx.trackTotals {
+		options |= addrIndexOptTrackTotals
+	}
+	options |= uint32(idx.skipAddrTypes) << addrIndexOptSkipAddrTypesShift
+	return options
+}
+
+// keyForAddr converts known address types to an address key for the key mode
+// used by the index.  An error is returned for unsupported types.
+func (idx *AddrIndex) keyForAddr(addr stdaddr.Address) ([addrKeySize]byte, error) {
+	return addrToKeyWithMode(addr, idx.extendedKeys)
+}
+
+// checkOptions ensures the options the index is configured with match the
+// options the existing index was built with and stores them when the index has
+// not indexed any blocks yet.  Indexes created before the options were tracked
+// are treated as having been built with the default options.
+//
+// ErrAddrIndexOptionsMismatch is returned when the options do not match since
+// indexing new blocks with different options would otherwise result in an
+// inconsistent index.
+func (idx *AddrIndex) checkOptions() error {
+	return idx.db.Update(func(dbTx database.Tx) error {
+		options := idx.optionFlags()
+		storedOptions, exists, err := dbFetchIndexerOptions(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			_, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+			if err != nil {
+				return err
+			}
+			if tipHeight == 0 {
+				storedOptions = options
+			}
+			err = dbPutIndexerOptions(dbTx, idx.Key(), storedOptions)
+			if err != nil {
+				return err
+			}
+		}
+		// Call out a change to the key mode specifically since the keys of
+		// all existing entries would otherwise be inconsistent with the keys
+		// of new entries.
+		if (storedOptions^options)&addrIndexOptExtendedKeys != 0 {
+			storedMode, mode := "standard", "extended"
+			if !idx.extendedKeys {
+				storedMode, mode = mode, storedMode
+			}
+			return fmt.Errorf("%w: the index was built with the %s key "+
+				"mode and is configured with the %s key mode -- drop the "+
+				"index to rebuild it with the %s key mode",
+				ErrAddrIndexOptionsMismatch, storedMode, mode, mode)
+		}
+		if storedOptions != options {
+			return fmt.Errorf("%w: the index was built with options %#x "+
+				"and is configured with options %#x -- drop the index to "+
+				"rebuild it", ErrAddrIndexOptionsMismatch, storedOptions,
+				options)
+		}
+		return nil
+	})
+}
+
 // Key returns the database key to use for the index as a byte slice.
 //
 // This is part of the Indexer interface.
@@ -684,6 +2246,43 @@ func (idx *AddrIndex) DB() database.DB {
 	return idx.db
 }
 
+// updateConsumerTip arranges for the tip of the spend consumer of the index, if
+// any, to be set to the provided hash once the provided database transaction is
+// committed.
+func (idx *AddrIndex) updateConsumerTip(dbTx database.Tx, hash *chainhash.Hash) {
+	if idx.consumer == nil {
+		return
+	}
+	idx.afterCommit(dbTx, func() { idx.consumer.UpdateTip(hash) })
+}
+
+// lockUpdates prevents updates to the index delivered via notifications until
+// unlockUpdates is called.
+//
+// This is part of the updateSerializer interface.
+func (idx *AddrIndex) lockUpdates() {
+	idx.updateMtx.Lock()
+}
+
+// unlockUpdates allows updates to the index delivered via notifications again
+// after a call to lockUpdates.
+//
+// This is part of the updateSerializer interface.
+func (idx *AddrIndex) unlockUpdates() {
+	idx.updateMtx.Unlock()
+}
+
+// afterCommit arranges for the provided function, which updates in-memory
+// state to reflect changes made in the provided database transaction, to be
+// invoked once the transaction is committed.
+func (idx *AddrIndex) afterCommit(dbTx database.Tx, fn func()) {
+	if db, ok := idx.db.(*commitHookDB); ok {
+		db.afterCommit(dbTx, fn)
+		return
+	}
+	fn()
+}
+
 // Queryer returns the chain queryer.
 //
 // This is part of the Indexer interface.
@@ -727,120 +2326,612 @@ func (idx *AddrIndex) WaitForSync() chan bool {
 	return c
 }
 
+// SubscriberStats houses statistics about the clients waiting for updates to
+// the address index.
+type SubscriberStats struct {
+	// NumSyncSubscribers is the number of clients waiting for the index to
+	// sync via WaitForSync.
+	NumSyncSubscribers int
+
+	// NumTipWaiters is the number of clients waiting for the index to reach
+	// a given height via WaitForHeight.
+	NumTipWaiters int
+
+	// NumUnconfirmedSubscribers is the number of subscriptions to changes in
+	// the unconfirmed index via SubscribeUnconfirmed.
+	NumUnconfirmedSubscribers int
+
+	// DroppedSignals is the cumulative number of signals to the tip waiters
+	// and unconfirmed index subscribers that were coalesced with a previous
+	// signal because the client had not yet received it.  A steadily
+	// increasing count typically indicates clients that stopped receiving
+	// from their channels without unsubscribing.
+	DroppedSignals uint64
+}
+
+// SubscriberStats returns statistics about the clients that are currently
+// waiting for updates to the index along with the cumulative number of signals
+// that were dropped because clients were not receiving them.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) SubscriberStats() SubscriberStats {
+	var stats SubscriberStats
+	idx.mtx.Lock()
+	stats.NumSyncSubscribers = len(idx.subscribers)
+	stats.NumTipWaiters = len(idx.tipWaiters)
+	stats.DroppedSignals = idx.droppedTipSignals
+	idx.mtx.Unlock()
+
+	idx.unconfirmedLock.RLock()
+	for _, subs := range idx.unconfirmedSubs {
+		stats.NumUnconfirmedSubscribers += len(subs)
+	}
+	stats.DroppedSignals += idx.droppedUnconfirmedSignals
+	idx.unconfirmedLock.RUnlock()
+	return stats
+}
+
+// notifyTipWaiters signals all clients waiting for the index to reach a given
+// height that the index tip changed.  Clients that have not yet received a
+// previous signal are skipped so that slow clients can't block the index.
+//
+// This is part of the tipWaitersNotifier interface.
+func (idx *AddrIndex) notifyTipWaiters() {
+	idx.mtx.Lock()
+	for c := range idx.tipWaiters {
+		select {
+		case c <- struct{}{}:
+		default:
+			idx.droppedTipSignals++
+		}
+	}
+	idx.mtx.Unlock()
+}
+
+// WaitForHeight blocks until the index has processed all blocks up to and
+// including the provided height or the provided context is cancelled, in which
+// case the context error is returned.  Unlike WaitForSync, it only waits for the
+// address index itself and does not require it to be synced to the main chain
+// tip, so queries made after it returns are guaranteed to see the data for all
+// blocks up to the height.
+//
+// The tip is rechecked each time an update to the index is committed rather
+// than polled.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) WaitForHeight(ctx context.Context, height int64) error {
+	// Register for tip updates prior to checking the current tip so that no
+	// updates are missed between the check and waiting.
+	c := make(chan struct{}, 1)
+	idx.mtx.Lock()
+	idx.tipWaiters[c] = struct{}{}
+	idx.mtx.Unlock()
+	defer func() {
+		idx.mtx.Lock()
+		delete(idx.tipWaiters, c)
+		idx.mtx.Unlock()
+	}()
+
+	for {
+		tipHeight, _, err := idx.Tip()
+		if err != nil {
+			return err
+		}
+		if tipHeight >= height {
+			return nil
+		}
+
+		select {
+		case <-c:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
 // Create is invoked when the index is created for the first time.  It creates
-// the bucket for the address index.
+// the buckets for the address index, the ticket commitment amounts, the address
+// totals, the block timestamps, the reward sources, and the heights of the
+// blocks with unsupported script versions.
 //
 // This is part of the Indexer interface.
 func (idx *AddrIndex) Create(dbTx database.Tx) error {
-	_, err := dbTx.Metadata().CreateBucket(addrIndexKey)
+	meta := dbTx.Metadata()
+	if _, err := meta.CreateBucket(addrIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrCommitmentIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrTotalsIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrBlockTimeIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrRewardSourceIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrUnindexedVersionIndexKey); err != nil {
+		return err
+	}
+	if _, err := meta.CreateBucketIfNotExists(addrDisapprovedIndexKey); err != nil {
+		return err
+	}
+	_, err := meta.CreateBucketIfNotExists(addrInputIndexKey)
 	return err
 }
 
+// indexedTx identifies a transaction that involves an address in a block along
+// with its class, the stake tags that describe the outputs that pay to the
+// address, whether or not any of its outputs pay to the address, and the
+// indices of its inputs that spend outputs which pay to the address.
+type indexedTx struct {
+	txIdx      int
+	class      TxClass
+	stakeTags  StakeTag
+	outputKind OutputKind
+	credit     bool
+	inputs     []uint32
+}
+
 // writeIndexData represents the address index data to be written for one block.
 // It consists of the address mapped to an ordered list of the transactions
 // that involve the address in block.  It is ordered so the transactions can be
 // stored in the order they appear in the block.
-type writeIndexData map[[addrKeySize]byte][]int
+type writeIndexData map[[addrKeySize]byte][]indexedTx
+
+// sortedKeys returns the address keys in the write index data in ascending
+// order.  This allows the database operations performed for a block to occur in
+// a deterministic order.
+func (data writeIndexData) sortedKeys() [][addrKeySize]byte {
+	addrKeys := make([][addrKeySize]byte, 0, len(data))
+	for addrKey := range data {
+		addrKeys = append(addrKeys, addrKey)
+	}
+	sort.Slice(addrKeys, func(i, j int) bool {
+		return bytes.Compare(addrKeys[i][:], addrKeys[j][:]) < 0
+	})
+	return addrKeys
+}
 
 // indexPkScript extracts all standard addresses from the passed public key
 // script and maps each of them to the associated transaction using the passed
-// map.
-func (idx *AddrIndex) indexPkScript(data writeIndexData, scriptVersion uint16, pkScript []byte, txIdx int, isSStx bool, isTreasuryEnabled bool) {
-	// Nothing to index if the script is non-standard or otherwise doesn't
-	// contain any addresses.
-	class, addrs, _, err := txscript.ExtractPkScriptAddrs(scriptVersion,
-		pkScript, idx.chainParams, isTreasuryEnabled)
-	if err != nil {
-		return
-	}
-
-	if isSStx && class == txscript.NullDataTy {
-		addr, err := stake.AddrFromSStxPkScrCommitment(pkScript, idx.chainParams)
-		if err != nil {
-			return
-		}
-
-		addrs = append(addrs, addr)
-	}
-
-	if len(addrs) == 0 {
-		return
-	}
-
-	for _, addr := range addrs {
-		addrKey, err := addrToKey(addr)
-		if err != nil {
-			// Ignore unsupported address types.
-			continue
-		}
+// map.  The provided stake tags are added to the tags of the transaction for
+// each address.  The address keys the script is indexed under are returned,
+// which excludes the addresses of the types the index is configured to not
+// index.
+func (idx *AddrIndex) indexPkScript(data writeIndexData, scriptVersion uint16, pkScript []byte, txIdx int, class TxClass, stakeTags StakeTag, isSStx bool, isTreasuryEnabled bool) [][addrKeySize]byte {
+	addrKeys := idx.scriptAddrKeys(scriptVersion, pkScript, isSStx,
+		isTreasuryEnabled)
+	indexAddrKeys(data, addrKeys, txIdx, class, stakeTags)
+	return addrKeys
+}
 
+// indexAddrKeys maps each of the passed address keys to the associated
+// transaction using the passed map.  The provided stake tags are added to the
+// tags of the transaction for each address.
+func indexAddrKeys(data writeIndexData, addrKeys [][addrKeySize]byte, txIdx int, class TxClass, stakeTags StakeTag) {
+	for _, addrKey := range addrKeys {
 		// Avoid inserting the transaction more than once.  Since the
 		// transactions are indexed serially any duplicates will be
 		// indexed in a row, so checking the most recent entry for the
-		// address is enough to detect duplicates.
+		// address is enough to detect duplicates.  This includes
+		// addresses that are referenced by both the inputs and outputs
+		// of the same transaction, such as self payments, since all of
+		// them are indexed before moving on to the next transaction.
 		indexedTxns := data[addrKey]
 		numTxns := len(indexedTxns)
-		if numTxns > 0 && indexedTxns[numTxns-1] == txIdx {
+		if numTxns > 0 && indexedTxns[numTxns-1].txIdx == txIdx {
+			indexedTxns[numTxns-1].stakeTags |= stakeTags
 			continue
 		}
-		indexedTxns = append(indexedTxns, txIdx)
+		indexedTxns = append(indexedTxns, indexedTx{txIdx: txIdx,
+			class: class, stakeTags: stakeTags})
 		data[addrKey] = indexedTxns
 	}
 }
 
-// indexBlock extracts all of the standard addresses from all of the regular and
-// stake transactions in the passed block and maps each of them to the
-// associated transaction using the passed map.
-func (idx *AddrIndex) indexBlock(data writeIndexData, block *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) {
-	regularTxns := block.Transactions()
-	for txIdx, tx := range regularTxns {
-		// Coinbases do not reference any inputs.  Since the block is
-		// required to have already gone through full validation, it has
-		// already been proven that the first transaction in the block
-		// is a coinbase.
-		if txIdx != 0 {
-			for _, txIn := range tx.MsgTx().TxIn {
-				// The input should always be available since the index contract
-				// requires it, however, be safe and simply ignore any missing
-				// entries.
-				origin := &txIn.PreviousOutPoint
-				version, pkScript, ok := prevScripts.PrevScript(origin)
-				if !ok {
-					log.Warnf("Missing input %v:%d for tx %v while indexing "+
-						"block %v (height %v)\n", origin, origin.Tree,
-						tx.Hash(), block.Hash(), block.Height())
-					continue
-				}
+// scriptAddrKeys returns the address keys the passed public key script is
+// indexed under in the order they appear in the script followed by any
+// additional keys returned by the custom script address extractor when one is
+// configured.  The keys with the types the index is configured to not index are
+// excluded.  The returned keys may contain duplicates.
+//
+// This is used for both confirmed and unconfirmed transactions so the results
+// of the confirmed and unconfirmed indexes agree.
+func (idx *AddrIndex) scriptAddrKeys(scriptVersion uint16, pkScript []byte, isSStx bool, isTreasuryEnabled bool) [][addrKeySize]byte {
+	// The error is ignored since it only occurs when the script is not a
+	// valid ticket commitment script in which case there are no standard
+	// addresses to index.
+	addrKeys, _ := scriptAddrKeys(scriptVersion, pkScript, idx.chainParams,
+		isSStx, isTreasuryEnabled, idx.extendedKeys)
+	if idx.scriptAddrExtractor != nil {
+		addrKeys = append(addrKeys, idx.scriptAddrExtractor(scriptVersion,
+			pkScript)...)
+	}
+	return idx.filterAddrKeys(addrKeys)
+}
 
-				idx.indexPkScript(data, version, pkScript,
-					txIdx, false, isTreasuryEnabled)
-			}
+// AddressKeysForScript returns the unique address index keys the passed public
+// key script is indexed under given the configuration of the index.  This
+// allows callers to determine whether or not an output will be indexed and
+// under which keys.  An empty result indicates the script is non-standard, does
+// not contain any supported addresses, or only contains addresses with types
+// the index is configured to not index.
+//
+// Each key consists of a single byte that identifies the type of the address
+// followed by its hash160.  The keys for public key addresses are the same as
+// the keys for their public key hash variants unless the index uses the
+// extended key mode.  The keys returned by the custom script address extractor
+// the index is configured with, if any, are included.
+//
+// Since the script alone does not identify whether or not it is an output of a
+// ticket purchase, the address a ticket commitment script commits to is always
+// included when the script is a valid ticket commitment script.  However, note
+// that the address index only indexes it for commitment outputs of ticket
+// purchases.  Also, the addresses embedded in a redeem script are only revealed
+// by the input that spends a pay-to-script-hash output, so they are not
+// included even when the index is configured to index them.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressKeysForScript(scriptVersion uint16, pkScript []byte, isTreasuryEnabled bool) ([][addrKeySize]byte, error) {
+	// Attempt to extract the keys with the ticket commitment handling first
+	// and fall back to extracting them without it when the script is a data
+	// carrier script that is not a valid ticket commitment script.
+	addrKeys, err := scriptAddrKeys(scriptVersion, pkScript, idx.chainParams,
+		true, isTreasuryEnabled, idx.extendedKeys)
+	if err != nil {
+		addrKeys, err = scriptAddrKeys(scriptVersion, pkScript,
+			idx.chainParams, false, isTreasuryEnabled, idx.extendedKeys)
+		if err != nil {
+			return nil, err
 		}
+	}
+	if idx.scriptAddrExtractor != nil {
+		addrKeys = append(addrKeys, idx.scriptAddrExtractor(scriptVersion,
+			pkScript)...)
+	}
+	addrKeys = idx.filterAddrKeys(addrKeys)
 
-		for _, txOut := range tx.MsgTx().TxOut {
-			idx.indexPkScript(data, txOut.Version, txOut.PkScript,
-				txIdx, false, isTreasuryEnabled)
+	// Remove any duplicates while retaining the order.
+	uniqueKeys := addrKeys[:0]
+	seen := make(map[[addrKeySize]byte]struct{}, len(addrKeys))
+	for _, addrKey := range addrKeys {
+		if _, ok := seen[addrKey]; ok {
+			continue
 		}
+		seen[addrKey] = struct{}{}
+		uniqueKeys = append(uniqueKeys, addrKey)
 	}
+	return uniqueKeys, nil
+}
 
-	for txIdx, tx := range block.STransactions() {
-		msgTx := tx.MsgTx()
-		thisTxOffset := txIdx + len(regularTxns)
+// isSkippedAddrKey returns whether or not the type of the passed address key is
+// one of the address types the index is configured to not index.  The public
+// key variants used by the extended key mode are the same type as the
+// corresponding public key hash variant.
+func (idx *AddrIndex) isSkippedAddrKey(addrKey [addrKeySize]byte) bool {
+	addrType := addrKey[0]
+	if addrType >= addrKeyTypePubKeyOffset {
+		addrType -= addrKeyTypePubKeyOffset
+	}
+	return addrType < numAddrKeyTypes && idx.skipAddrTypes&(1<<addrType) != 0
+}
 
-		isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
-		var (
-			isTSpend, isTreasuryBase bool
-		)
-		if isTreasuryEnabled {
-			// Short circuit expensive Is* calls.
-			isTreasuryBase = !isSSGen && stake.IsTreasuryBase(msgTx)
-			isTSpend = !isTreasuryBase && stake.IsTSpend(msgTx)
+// filterAddrKeys removes the address keys with the types the index is
+// configured to not index from the passed address keys.  The passed slice is
+// modified in place.
+func (idx *AddrIndex) filterAddrKeys(addrKeys [][addrKeySize]byte) [][addrKeySize]byte {
+	if idx.skipAddrTypes == 0 {
+		return addrKeys
+	}
+	filtered := addrKeys[:0]
+	for _, addrKey := range addrKeys {
+		if !idx.isSkippedAddrKey(addrKey) {
+			filtered = append(filtered, addrKey)
 		}
-		for i, txIn := range msgTx.TxIn {
-			// Skip stakebases.
-			if isSSGen && i == 0 {
-				continue
-			}
+	}
+	return filtered
+}
+
+// spentRedeemScript returns the redeem script revealed by the signature script
+// of the passed input when the index is configured to index the addresses
+// embedded in redeem scripts or atomic swap contracts and the provided previous
+// output script it spends is a pay-to-script-hash script.  It returns nil
+// otherwise.
+//
+// The redeem script is the final data push of the signature script.  Since it
+// is only used to index addresses, it is not verified to match the script hash.
+func (idx *AddrIndex) spentRedeemScript(prevScriptVersion uint16, prevScript []byte, txIn *wire.TxIn) []byte {
+	if (!idx.indexRedeemScriptAddrs && !idx.indexAtomicSwapAddrs) ||
+		prevScriptVersion != 0 || !txscript.IsPayToScriptHash(prevScript) {
+
+		return nil
+	}
+
+	// Only version 0 scripts are supported.
+	const scriptVersion = 0
+	var redeemScript []byte
+	tokenizer := txscript.MakeScriptTokenizer(scriptVersion,
+		txIn.SignatureScript)
+	for tokenizer.Next() {
+		redeemScript = tokenizer.Data()
+	}
+	if tokenizer.Err() != nil {
+		return nil
+	}
+	return redeemScript
+}
+
+// atomicSwapAddrKeys returns the address keys of the recipient and refund
+// addresses embedded in the passed redeem script when it is an atomic swap
+// contract.  It returns nil otherwise.
+//
+// An atomic swap contract is of the form:
+//
+//	IF
+//	 SIZE <secret size> EQUALVERIFY SHA256 <32-byte secret> EQUALVERIFY DUP
+//	 HASH160 <20-byte recipient hash>
+//	ELSE
+//	 <locktime> CHECKLOCKTIMEVERIFY DROP DUP HASH160 <20-byte refund hash>
+//	ENDIF
+//	EQUALVERIFY CHECKSIG
+//
+// Since both hashes are checked with CHECKSIG, they are the hashes of secp256k1
+// public keys and are indexed under the same keys as the pay-to-pubkey-hash
+// addresses for them.
+func atomicSwapAddrKeys(redeemScript []byte) [][addrKeySize]byte {
+	// Only version 0 scripts are supported.
+	const scriptVersion = 0
+	pushes, err := txscript.ExtractAtomicSwapDataPushes(scriptVersion,
+		redeemScript)
+	if err != nil || pushes == nil {
+		return nil
+	}
+
+	addrKeys := make([][addrKeySize]byte, 2)
+	addrKeys[0][0] = addrKeyTypePubKeyHash
+	copy(addrKeys[0][1:], pushes.RecipientHash160[:])
+	addrKeys[1][0] = addrKeyTypePubKeyHash
+	copy(addrKeys[1][1:], pushes.RefundHash160[:])
+	return addrKeys
+}
+
+// redeemScriptAddrKeys returns the address keys the passed redeem script
+// revealed by an input that spends a pay-to-script-hash output is indexed
+// under according to the configuration of the index.  The returned keys may
+// contain duplicates.
+func (idx *AddrIndex) redeemScriptAddrKeys(redeemScript []byte, isTreasuryEnabled bool) [][addrKeySize]byte {
+	var addrKeys [][addrKeySize]byte
+	if idx.indexRedeemScriptAddrs {
+		addrKeys = idx.scriptAddrKeys(0, redeemScript, false,
+			isTreasuryEnabled)
+	}
+	if idx.indexAtomicSwapAddrs {
+		addrKeys = append(addrKeys,
+			idx.filterAddrKeys(atomicSwapAddrKeys(redeemScript))...)
+	}
+	return addrKeys
+}
+
+// spentTicketCommitments returns the commitment outputs of the ticket that
+// created the provided previous outpoint when the index is configured to index
+// them, the spending transaction is a vote or revocation as indicated by the
+// provided class, and the provided previous scripter is able to provide the
+// outputs of the ticket.  It returns nil otherwise.
+//
+// Only the input that spends the ticket submission output, which is the first
+// output of a ticket, references a ticket with commitments.  All other inputs
+// result in nil.
+func (idx *AddrIndex) spentTicketCommitments(prevScripts PrevScripter, origin *wire.OutPoint, class TxClass) []*stake.MinimalOutput {
+	if !idx.indexTicketCommitmentAddrs || origin.Index != 0 ||
+		origin.Tree != wire.TxTreeStake ||
+		(class != TxClassVote && class != TxClassRevocation) {
+
+		return nil
+	}
+
+	ticketOutputer, ok := prevScripts.(PrevTicketOutputer)
+	if !ok {
+		return nil
+	}
+	ticketOuts, ok := ticketOutputer.PrevTicketOutputs(origin)
+	if !ok {
+		log.Debugf("Missing ticket outputs for %v:%d", origin, origin.Tree)
+		return nil
+	}
+
+	// The commitment outputs are the odd outputs of a ticket purchase.
+	commitments := make([]*stake.MinimalOutput, 0, len(ticketOuts)/2)
+	for i := 1; i < len(ticketOuts); i += 2 {
+		commitments = append(commitments, ticketOuts[i])
+	}
+	return commitments
+}
+
+// markCredits flags the most recently indexed transaction for each of the
+// provided address keys as crediting the address when the index is configured
+// to flag credits.  It must only be called with the address keys of an output
+// immediately after indexing it.
+func (idx *AddrIndex) markCredits(data writeIndexData, addrKeys [][addrKeySize]byte) {
+	if !idx.creditFlags {
+		return
+	}
+	for _, addrKey := range addrKeys {
+		indexedTxns := data[addrKey]
+		indexedTxns[len(indexedTxns)-1].credit = true
+	}
+}
+
+// markInputs records the provided input index for the most recently indexed
+// transaction for each of the provided address keys when the index is
+// configured to track input indices.  It must only be called with the address
+// keys of the output spent by the input immediately after indexing it.  The
+// keys may contain duplicates.
+func (idx *AddrIndex) markInputs(data writeIndexData, addrKeys [][addrKeySize]byte, inputIdx uint32) {
+	if !idx.trackInputIndexes {
+		return
+	}
+	for _, addrKey := range addrKeys {
+		indexedTxns := data[addrKey]
+		txn := &indexedTxns[len(indexedTxns)-1]
+		numInputs := len(txn.inputs)
+		if numInputs > 0 && txn.inputs[numInputs-1] == inputIdx {
+			continue
+		}
+		txn.inputs = append(txn.inputs, inputIdx)
+	}
+}
+
+// indexBlock extracts all of the standard addresses from all of the regular and
+// stake transactions in the passed block and maps each of them to the
+// associated transaction using the passed map.  It returns the number of
+// outputs in the block with non-standard scripts, which are not indexed.
+func (idx *AddrIndex) indexBlock(data writeIndexData, block *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) int {
+	// Missing inputs are summarized by a single warning for the entire block
+	// once it has been indexed in order to avoid flooding the logs when many
+	// of them are missing.  The details for each one are logged at the debug
+	// level.
+	var numMissingInputs int
+
+	// countNonStandard counts the provided output script as non-standard when
+	// it is not indexed under any addresses and is not recognized as any of
+	// the standard script types.  The script is only classified when it is
+	// not indexed, so the cost is limited to outputs without addresses.
+	var numNonStandard int
+	countNonStandard := func(version uint16, pkScript []byte, addrKeys [][addrKeySize]byte, isTreasuryEnabled bool) {
+		if len(addrKeys) == 0 && txscript.GetScriptClass(version, pkScript,
+			isTreasuryEnabled) == txscript.NonStandardTy {
+
+			numNonStandard++
+		}
+	}
+
+	regularTxns := block.Transactions()
+	for txIdx, tx := range regularTxns {
+		// Skip the outputs of the coinbase when requested.
+		if txIdx == 0 && idx.skipCoinbaseOutputs {
+			continue
+		}
+
+		class := TxClassRegular
+		if txIdx == 0 {
+			class = TxClassCoinbase
+		}
+
+		// The addresses involved in the inputs are tracked in order to tag
+		// the outputs as likely change or payments when the change
+		// heuristic is enabled.
+		var inputAddrKeys map[[addrKeySize]byte]struct{}
+		analyzeOutputs := idx.changeHeuristic && txIdx != 0
+		if analyzeOutputs {
+			inputAddrKeys = make(map[[addrKeySize]byte]struct{})
+		}
+
+		// Coinbases do not reference any inputs.  Since the block is
+		// required to have already gone through full validation, it has
+		// already been proven that the first transaction in the block
+		// is a coinbase.
+		if txIdx != 0 {
+			for inputIdx, txIn := range tx.MsgTx().TxIn {
+				// The input should always be available since the index contract
+				// requires it, however, be safe and simply ignore any missing
+				// entries.
+				origin := &txIn.PreviousOutPoint
+				version, pkScript, ok := prevScripts.PrevScript(origin)
+				if !ok {
+					log.Debugf("Missing input %v:%d for tx %v while indexing "+
+						"block %v (height %v)", origin, origin.Tree,
+						tx.Hash(), block.Hash(), block.Height())
+					numMissingInputs++
+					continue
+				}
+
+				addrKeys := idx.indexPkScript(data, version, pkScript,
+					txIdx, class, 0, false, isTreasuryEnabled)
+
+				// Also index the addresses embedded in the redeem script of
+				// pay-to-script-hash outputs when configured to do so.
+				redeemScript := idx.spentRedeemScript(version, pkScript, txIn)
+				if redeemScript != nil {
+					redeemAddrKeys := idx.redeemScriptAddrKeys(redeemScript,
+						isTreasuryEnabled)
+					indexAddrKeys(data, redeemAddrKeys, txIdx, class, 0)
+					addrKeys = append(addrKeys, redeemAddrKeys...)
+				}
+				idx.markInputs(data, addrKeys, uint32(inputIdx))
+
+				if analyzeOutputs {
+					for _, addrKey := range addrKeys {
+						inputAddrKeys[addrKey] = struct{}{}
+					}
+				}
+			}
+		}
+
+		for _, txOut := range tx.MsgTx().TxOut {
+			addrKeys := idx.indexPkScript(data, txOut.Version,
+				txOut.PkScript, txIdx, class, 0, false, isTreasuryEnabled)
+			idx.markCredits(data, addrKeys)
+			countNonStandard(txOut.Version, txOut.PkScript, addrKeys,
+				isTreasuryEnabled)
+			if !analyzeOutputs {
+				continue
+			}
+
+			// Tag the outputs to addresses that are also involved in the
+			// inputs as likely change and all others as likely payments.
+			for _, addrKey := range addrKeys {
+				outputKind := OutputKindPayment
+				if _, ok := inputAddrKeys[addrKey]; ok {
+					outputKind = OutputKindChange
+				}
+				indexedTxns := data[addrKey]
+				indexedTxns[len(indexedTxns)-1].outputKind = outputKind
+			}
+		}
+	}
+
+	for txIdx, tx := range block.STransactions() {
+		msgTx := tx.MsgTx()
+		thisTxOffset := txIdx + len(regularTxns)
+
+		isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
+		var (
+			isTSpend, isTreasuryBase bool
+		)
+		if isTreasuryEnabled {
+			// Short circuit expensive Is* calls.
+			isTreasuryBase = !isSSGen && stake.IsTreasuryBase(msgTx)
+			isTSpend = !isTreasuryBase && stake.IsTSpend(msgTx)
+		}
+
+		// Determine the class of the transaction for its entries.  Note that
+		// the checks enforced by the automatic ticket revocations agenda are
+		// not needed to identify revocations since the block has already been
+		// validated.
+		isSStx := stake.IsSStx(msgTx)
+		var class TxClass
+		switch {
+		case isSStx:
+			class = TxClassTicket
+		case isSSGen:
+			class = TxClassVote
+		case isTreasuryBase:
+			class = TxClassTreasuryBase
+		case isTSpend:
+			class = TxClassTreasurySpend
+		case stake.IsSSRtx(msgTx, false):
+			class = TxClassRevocation
+		case isTreasuryEnabled && stake.IsTAdd(msgTx):
+			class = TxClassTreasuryAdd
+		}
+		for i, txIn := range msgTx.TxIn {
+			// Skip stakebases.
+			if isSSGen && i == 0 {
+				continue
+			}
 
 			// Skip treasury transactions that do not have inputs.
 			if isTreasuryBase || isTSpend {
@@ -853,27 +2944,98 @@ func (idx *AddrIndex) indexBlock(data writeIndexData, block *dcrutil.Block, prev
 			origin := &txIn.PreviousOutPoint
 			version, pkScript, ok := prevScripts.PrevScript(origin)
 			if !ok {
-				log.Warnf("Missing input %v:%d for tx %v while indexing "+
-					"block %v (height %v)\n", origin, origin.Tree,
+				log.Debugf("Missing input %v:%d for tx %v while indexing "+
+					"block %v (height %v)", origin, origin.Tree,
 					tx.Hash(), block.Hash(), block.Height())
+				numMissingInputs++
 				continue
 			}
 
-			idx.indexPkScript(data, version, pkScript, thisTxOffset,
-				false, isTreasuryEnabled)
+			addrKeys := idx.indexPkScript(data, version, pkScript,
+				thisTxOffset, class, 0, false, isTreasuryEnabled)
+
+			// Also index the addresses embedded in the redeem script of
+			// pay-to-script-hash outputs when configured to do so.
+			redeemScript := idx.spentRedeemScript(version, pkScript, txIn)
+			if redeemScript != nil {
+				redeemAddrKeys := idx.redeemScriptAddrKeys(redeemScript,
+					isTreasuryEnabled)
+				indexAddrKeys(data, redeemAddrKeys, thisTxOffset, class, 0)
+				addrKeys = append(addrKeys, redeemAddrKeys...)
+			}
+			idx.markInputs(data, addrKeys, uint32(i))
+
+			// Also index the commitment addresses of the ticket spent by
+			// votes and revocations when configured to do so.  They are not
+			// recorded as referenced by the input since it spends the
+			// ticket rather than an output that pays them.
+			commitments := idx.spentTicketCommitments(prevScripts, origin,
+				class)
+			for _, commitment := range commitments {
+				idx.indexPkScript(data, commitment.Version,
+					commitment.PkScript, thisTxOffset, class, 0, true,
+					isTreasuryEnabled)
+			}
 		}
 
-		isSStx := stake.IsSStx(msgTx)
+		// Treasury bases only consist of an OP_TADD output that adds to the
+		// treasury balance and an OP_RETURN output that commits to the
+		// height, neither of which involve any addresses.  Thus, they are
+		// never indexed regardless of whether or not the outputs of
+		// coinbases are skipped.
+		if isTreasuryBase {
+			continue
+		}
+
+		// The first output of a treasury spend is an OP_RETURN that
+		// randomizes the transaction hash and all remaining outputs are
+		// OP_TGEN-tagged pay-to-pubkey-hash or pay-to-script-hash scripts
+		// that pay the recipients.  Index the recipients explicitly with the
+		// treasury rules enforced since treasury spends are only valid when
+		// the treasury agenda is active and the tagged scripts are only
+		// recognized under those rules.
+		if isTSpend {
+			for _, txOut := range msgTx.TxOut[1:] {
+				addrKeys := idx.indexPkScript(data, txOut.Version,
+					txOut.PkScript, thisTxOffset, class, 0, false, true)
+				idx.markCredits(data, addrKeys)
+				countNonStandard(txOut.Version, txOut.PkScript, addrKeys, true)
+			}
+			continue
+		}
+
+		// Tag the entries for the outputs which pay stake generation (vote
+		// reward), stake change, and ticket commitment outputs so they can be
+		// distinguished from other payments.
 		for _, txOut := range msgTx.TxOut {
-			idx.indexPkScript(data, txOut.Version, txOut.PkScript,
-				thisTxOffset, isSStx, isTreasuryEnabled)
+			stakeTags := stakeOutputTags(txOut.Version, txOut.PkScript, isSStx,
+				isTreasuryEnabled)
+			addrKeys := idx.indexPkScript(data, txOut.Version, txOut.PkScript,
+				thisTxOffset, class, stakeTags, isSStx, isTreasuryEnabled)
+			countNonStandard(txOut.Version, txOut.PkScript, addrKeys,
+				isTreasuryEnabled)
+
+			// Ticket commitment outputs only commit to an address that
+			// will later be paid by a vote or revocation, so they do not
+			// credit it.
+			if stakeTags&StakeTagCommitment == 0 {
+				idx.markCredits(data, addrKeys)
+			}
 		}
 	}
+
+	if numMissingInputs > 0 {
+		log.Warnf("Missing %d input(s) while indexing block %v (height %v)",
+			numMissingInputs, block.Hash(), block.Height())
+	}
+	return numNonStandard
 }
 
-// connectBlock adds a mapping for all addresses associated with transactions in
-// the provided block.
-func (idx *AddrIndex) connectBlock(dbTx database.Tx, block, parent *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) error {
+// putBlockEntries adds the index entries for all addresses associated with
+// transactions in the provided block to the provided bucket.  It returns the
+// number of outputs in the block with non-standard scripts, which are not
+// indexed.
+func (idx *AddrIndex) putBlockEntries(dbTx database.Tx, bucket internalBucket, block *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) (int, error) {
 	// NOTE: The fact that the block can disapprove the regular tree of the
 	// previous block is ignored for this index because even though the
 	// disapproved transactions no longer apply spend semantics, they still
@@ -883,298 +3045,6032 @@ func (idx *AddrIndex) connectBlock(dbTx database.Tx, block, parent *dcrutil.Bloc
 	// The offset and length of the transactions within the serialized block.
 	txLocs, stakeTxLocs, err := block.TxLoc()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Get the internal block ID associated with the block.
 	blockID, err := dbFetchBlockIDByHash(dbTx, block.Hash())
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Build all of the address to transaction mappings in a local map.
 	addrsToTxns := make(writeIndexData)
-	idx.indexBlock(addrsToTxns, block, prevScripts, isTreasuryEnabled)
+	numNonStandard := idx.indexBlock(addrsToTxns, block, prevScripts,
+		isTreasuryEnabled)
+
+	// Add all of the index entries for each address in order of their keys.
+	// The merges are computed concurrently for blocks that involve enough
+	// addresses for it to be worth the overhead when multiple processor cores
+	// are available.
+	addrKeys := addrsToTxns.sortedKeys()
+	if len(addrKeys) >= parallelMergeMinAddrs && runtime.NumCPU() > 1 {
+		err := dbPutAddrBlockEntriesParallel(bucket, addrsToTxns, addrKeys,
+			blockID, txLocs, stakeTxLocs)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		for _, addrKey := range addrKeys {
+			err := dbPutAddrBlockEntries(bucket, addrKey, blockID,
+				addrsToTxns[addrKey], txLocs, stakeTxLocs)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	idx.afterCommit(dbTx, func() {
+		for _, addrKey := range addrKeys {
+			idx.addrFilter.add(addrKey, len(addrsToTxns[addrKey]))
+			idx.pins.invalidate(addrKey)
+		}
+	})
+
+	// Add the amounts credited to and debited from each address.
+	if idx.trackTotals {
+		totals := idx.indexBlockTotals(block, prevScripts, isTreasuryEnabled)
+		if err := dbAddAddrTotals(dbTx, totals, false); err != nil {
+			return 0, err
+		}
+	}
+
+	// Record the tickets that earned the reward outputs of the votes.
+	if idx.indexRewardSources {
+		sources, err := idx.indexBlockRewardSources(block, isTreasuryEnabled)
+		if err != nil {
+			return 0, err
+		}
+		if err := dbPutAddrRewardSources(dbTx, sources); err != nil {
+			return 0, err
+		}
+	}
+
+	// Record the height of the block when it contains scripts with versions
+	// that are not supported so the affected blocks can be identified and
+	// reindexed once they are.
+	versions := idx.unsupportedScriptVersions(block, prevScripts)
+	if len(versions) > 0 {
+		log.Warnf("Block %v (height %d) contains scripts with unsupported "+
+			"versions %v that are not indexed", block.Hash(), block.Height(),
+			versions)
+		err := dbPutAddrUnindexedHeight(dbTx, uint32(block.Height()))
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	// Add all of the index entries for each address.
+	// Record the parent of the block when the votes in the block disapprove
+	// its regular transaction tree.  The genesis block does not have a
+	// parent.
+	header := &block.MsgBlock().Header
+	if idx.trackDisapprovals && header.Height > 0 &&
+		!dcrutil.IsFlagSet16(header.VoteBits, dcrutil.BlockValid) {
+
+		err := dbPutAddrDisapproval(dbTx, &header.PrevBlock, block.Hash())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Record the indices of the inputs that spend outputs which pay to each
+	// address.
+	if idx.trackInputIndexes {
+		err := dbPutAddrInputs(dbTx, block.Hash(), addrsToTxns, addrKeys,
+			len(txLocs))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Store the timestamp of the block for use by time-range queries.
+	if idx.storeBlockTimes {
+		err := dbPutAddrBlockTime(dbTx, block.Hash(), header.Timestamp.Unix())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Add the amounts committed to each address by ticket purchases.
+	err = dbPutAddrCommitments(dbTx, blockID, idx.indexBlockCommitments(block))
+	if err != nil {
+		return 0, err
+	}
+	return numNonStandard, nil
+}
+
+// dbPutAddrBlockEntries adds an index entry for the provided address for each of
+// the provided transactions of a block.  The transaction indices are those used
+// by indexBlock, so the indices of the stake transactions start after all of
+// the regular transactions.
+func dbPutAddrBlockEntries(bucket internalBucket, addrKey [addrKeySize]byte, blockID uint32, txns []indexedTx, txLocs, stakeTxLocs []wire.TxLoc) error {
 	stakeIdxsStart := len(txLocs)
-	addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
-	for addrKey, txIdxs := range addrsToTxns {
-		for _, txIdx := range txIdxs {
-			// Adjust the block index and slice of transaction locations to use
-			// based on the regular or stake tree.
-			txLocations := txLocs
-			blockIndex := txIdx
-			if txIdx >= stakeIdxsStart {
-				txLocations = stakeTxLocs
-				blockIndex -= stakeIdxsStart
-			}
-
-			err := dbPutAddrIndexEntry(addrIdxBucket, addrKey, blockID,
-				txLocations[blockIndex], uint32(blockIndex))
-			if err != nil {
-				return err
+	for _, txn := range txns {
+		// Adjust the block index, slice of transaction locations, and tree
+		// to use based on the regular or stake tree.
+		txLocations := txLocs
+		blockIndex := txn.txIdx
+		tree := wire.TxTreeRegular
+		if txn.txIdx >= stakeIdxsStart {
+			txLocations = stakeTxLocs
+			blockIndex -= stakeIdxsStart
+			tree = wire.TxTreeStake
+		}
+
+		blockIndexFlags := uint32(blockIndex) | encodeEntryTree(tree) |
+			encodeEntryStakeTags(txn.stakeTags) |
+			encodeEntryTxClass(txn.class) |
+			encodeEntryOutputKind(txn.outputKind) | encodeEntryCredit(txn.credit)
+		err := dbPutAddrIndexEntry(bucket, addrKey, blockID,
+			txLocations[blockIndex], blockIndexFlags)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addrLevelsSnapshot is a read-only implementation of internalBucket that
+// houses a snapshot of the serialized levels of an address keyed by their level
+// keys.  It is used as the underlying bucket of a write batch in order to
+// compute the modifications to the levels of an address independently of the
+// database.
+type addrLevelsSnapshot map[string][]byte
+
+// Ensure the addrLevelsSnapshot type implements the internalBucket interface.
+var _ internalBucket = addrLevelsSnapshot(nil)
+
+// Get returns the serialized level for the provided level key from the
+// snapshot.
+//
+// This is part of the internalBucket interface.
+func (s addrLevelsSnapshot) Get(key []byte) []byte {
+	return s[string(key)]
+}
+
+// Put returns an error since the snapshot is read only.
+//
+// This is part of the internalBucket interface.
+func (s addrLevelsSnapshot) Put(key []byte, value []byte) error {
+	return AssertError("attempt to modify read-only address levels snapshot")
+}
+
+// Delete returns an error since the snapshot is read only.
+//
+// This is part of the internalBucket interface.
+func (s addrLevelsSnapshot) Delete(key []byte) error {
+	return AssertError("attempt to modify read-only address levels snapshot")
+}
+
+// dbPutAddrBlockEntriesParallel adds the entries for the provided addresses to
+// the address index in the same way as calling dbPutAddrBlockEntries for each
+// of them in order, however, the merges of the levels of the addresses are
+// computed concurrently.
+//
+// The merges of the levels of each address are independent of all other
+// addresses, so the existing levels of every address are loaded into separate
+// in-memory write batches, the merges are computed against them by multiple
+// goroutines, and the resulting modifications are then written to the provided
+// bucket in order of the address keys.  All access to the provided bucket
+// happens on the calling goroutine since it is not safe for concurrent access.
+func dbPutAddrBlockEntriesParallel(bucket internalBucket, data writeIndexData, addrKeys [][addrKeySize]byte, blockID uint32, txLocs, stakeTxLocs []wire.TxLoc) error {
+	// Load the existing levels of each address.
+	batches := make([]*writeBatchBucket, len(addrKeys))
+	for i, addrKey := range addrKeys {
+		levels := make(addrLevelsSnapshot)
+		for level := uint8(0); ; level++ {
+			levelKey := keyForLevel(addrKey, level)
+			levelData := bucket.Get(levelKey[:])
+			if levelData == nil {
+				break
 			}
+			levels[string(levelKey[:])] = levelData
 		}
+		batches[i] = newWriteBatchBucket(levels)
+	}
+
+	// Limit the number of goroutines used to compute the merges based on the
+	// number of processor cores.
+	numWorkers := runtime.NumCPU()
+	if numWorkers > len(addrKeys) {
+		numWorkers = len(addrKeys)
+	}
+
+	// Compute the merges for each address.
+	errs := make([]error, len(addrKeys))
+	var nextAddr int64
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&nextAddr, 1) - 1)
+				if i >= len(addrKeys) {
+					return
+				}
+				addrKey := addrKeys[i]
+				errs[i] = dbPutAddrBlockEntries(batches[i], addrKey, blockID,
+					data[addrKey], txLocs, stakeTxLocs)
+			}
+		}()
 	}
+	wg.Wait()
 
-	// Update the current index tip.
-	return dbPutIndexerTip(dbTx, idx.Key(), block.Hash(), int32(block.Height()))
+	// Write the resulting modifications in order of the address keys.
+	for i, batch := range batches {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		if err := batch.flushTo(bucket); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// disconnectBlock removes the mappings for addresses associated with
-// transactions in the provided block.
-func (idx *AddrIndex) disconnectBlock(dbTx database.Tx, block, parent *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) error {
-	// NOTE: The fact that the block can disapprove the regular tree of the
-	// previous block is ignored for this index because even though the
-	// disapproved transactions no longer apply spend semantics, they still
-	// exist within the block and thus have to be processed before the next
-	// block disapproves them.
+// -----------------------------------------------------------------------------
+// The amounts committed to addresses by ticket purchases are stored in a
+// separate bucket keyed by the address key and the hash of the ticket purchase.
+// The amounts committed to the same address by multiple commitment outputs of a
+// ticket are summed.
+//
+// The serialized key format is:
+//
+//   <addr type><addr hash><tx hash>
+//
+//   Field           Type              Size
+//   addr type       uint8             1 byte
+//   addr hash       hash160           20 bytes
+//   tx hash         chainhash.Hash    32 bytes
+//   -----
+//   Total: 53 bytes
+//
+// The serialized value format is:
+//
+//   <block id><amount>
+//
+//   Field           Type      Size
+//   block id        uint32    4 bytes
+//   amount          uint64    8 bytes
+//   -----
+//   Total: 12 bytes
+// -----------------------------------------------------------------------------
 
-	// Build all of the address to transaction mappings in a local map.
-	addrsToTxns := make(writeIndexData)
-	idx.indexBlock(addrsToTxns, block, prevScripts, isTreasuryEnabled)
+// indexBlockCommitments returns the amounts committed to each address by the
+// ticket purchases in the provided block keyed by the address key and hash of
+// the ticket purchase.
+func (idx *AddrIndex) indexBlockCommitments(block *dcrutil.Block) map[[addrCommitmentKeySize]byte]int64 {
+	var commitments map[[addrCommitmentKeySize]byte]int64
+	for _, tx := range block.STransactions() {
+		msgTx := tx.MsgTx()
+		if !stake.IsSStx(msgTx) {
+			continue
+		}
+
+		// The commitment outputs are the odd outputs of a ticket purchase.
+		for i := 1; i < len(msgTx.TxOut); i += 2 {
+			pkScript := msgTx.TxOut[i].PkScript
+			addr, err := stake.AddrFromSStxPkScrCommitment(pkScript,
+				idx.chainParams)
+			if err != nil {
+				continue
+			}
+			amount, err := stake.AmountFromSStxPkScrCommitment(pkScript)
+			if err != nil {
+				continue
+			}
+			addrKey, err := idx.keyForAddr(addr)
+			if err != nil || idx.isSkippedAddrKey(addrKey) {
+				continue
+			}
+
+			var key [addrCommitmentKeySize]byte
+			copy(key[:], addrKey[:])
+			copy(key[addrKeySize:], tx.Hash()[:])
+			if commitments == nil {
+				commitments = make(map[[addrCommitmentKeySize]byte]int64)
+			}
+			commitments[key] += int64(amount)
+		}
+	}
+	return commitments
+}
+
+// sortedCommitmentKeys returns the keys of the provided ticket commitment
+// amounts in ascending order.
+func sortedCommitmentKeys(commitments map[[addrCommitmentKeySize]byte]int64) [][addrCommitmentKeySize]byte {
+	keys := make([][addrCommitmentKeySize]byte, 0, len(commitments))
+	for key := range commitments {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+// dbPutAddrCommitments uses an existing database transaction to add the
+// provided ticket commitment amounts for the block with the given ID in order
+// of their keys.
+func dbPutAddrCommitments(dbTx database.Tx, blockID uint32, commitments map[[addrCommitmentKeySize]byte]int64) error {
+	bucket := dbTx.Metadata().Bucket(addrCommitmentIndexKey)
+	for _, key := range sortedCommitmentKeys(commitments) {
+		amount := commitments[key]
+		var serialized [addrCommitmentEntrySize]byte
+		byteOrder.PutUint32(serialized[0:4], blockID)
+		byteOrder.PutUint64(serialized[4:12], uint64(amount))
+		if err := bucket.Put(key[:], serialized[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveAddrCommitments uses an existing database transaction to remove the
+// provided ticket commitment amounts in order of their keys.
+func dbRemoveAddrCommitments(dbTx database.Tx, commitments map[[addrCommitmentKeySize]byte]int64) error {
+	bucket := dbTx.Metadata().Bucket(addrCommitmentIndexKey)
+	for _, key := range sortedCommitmentKeys(commitments) {
+		if err := bucket.Delete(key[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// The tickets that earned the reward outputs of votes are stored in a separate
+// bucket keyed by the address key of the reward output along with the hash of
+// the block that contains the vote and the offset of the vote within it, which
+// identify the entry of the vote for the address.  The reward outputs of a vote
+// that pay to the same address share a single key.
+//
+// The serialized key format is:
+//
+//   <addr type><addr hash><block hash><tx start offset>
+//
+//   Field           Type              Size
+//   addr type       uint8             1 byte
+//   addr hash       hash160           20 bytes
+//   block hash      chainhash.Hash    32 bytes
+//   tx start offset uint32            4 bytes
+//   -----
+//   Total: 57 bytes
+//
+// The serialized value format is:
+//
+//   <ticket hash>
+//
+//   Field           Type              Size
+//   ticket hash     chainhash.Hash    32 bytes
+//   -----
+//   Total: 32 bytes
+// -----------------------------------------------------------------------------
+
+// indexBlockRewardSources returns the hashes of the tickets that earned the
+// reward outputs of the votes in the provided block keyed by the reward source
+// key of each address the reward outputs pay to.
+func (idx *AddrIndex) indexBlockRewardSources(block *dcrutil.Block, isTreasuryEnabled bool) (map[[addrRewardSourceKeySize]byte]chainhash.Hash, error) {
+	var sources map[[addrRewardSourceKeySize]byte]chainhash.Hash
+	var stakeTxLocs []wire.TxLoc
+	for txIdx, tx := range block.STransactions() {
+		msgTx := tx.MsgTx()
+		if !stake.IsSSGen(msgTx, isTreasuryEnabled) {
+			continue
+		}
+
+		// Load the locations of the stake transactions the first time a
+		// vote is encountered.
+		if stakeTxLocs == nil {
+			var err error
+			_, stakeTxLocs, err = block.TxLoc()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// The reward outputs of a vote start after the outputs that
+		// reference the block being voted on and house the vote bits and
+		// the ticket it spends is referenced by its second input.
+		ticketHash := msgTx.TxIn[1].PreviousOutPoint.Hash
+		for _, txOut := range msgTx.TxOut[2:] {
+			addrKeys := idx.scriptAddrKeys(txOut.Version, txOut.PkScript,
+				false, isTreasuryEnabled)
+			for _, addrKey := range addrKeys {
+				var key [addrRewardSourceKeySize]byte
+				copy(key[:], addrKey[:])
+				copy(key[addrKeySize:], block.Hash()[:])
+				byteOrder.PutUint32(key[addrKeySize+chainhash.HashSize:],
+					uint32(stakeTxLocs[txIdx].TxStart))
+				if sources == nil {
+					sources = make(map[[addrRewardSourceKeySize]byte]chainhash.Hash)
+				}
+				sources[key] = ticketHash
+			}
+		}
+	}
+	return sources, nil
+}
+
+// sortedRewardSourceKeys returns the keys of the provided reward sources in
+// ascending order.
+func sortedRewardSourceKeys(sources map[[addrRewardSourceKeySize]byte]chainhash.Hash) [][addrRewardSourceKeySize]byte {
+	keys := make([][addrRewardSourceKeySize]byte, 0, len(sources))
+	for key := range sources {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i][:], keys[j][:]) < 0
+	})
+	return keys
+}
+
+// dbPutAddrRewardSources uses an existing database transaction to add the
+// provided reward sources in order of their keys.
+func dbPutAddrRewardSources(dbTx database.Tx, sources map[[addrRewardSourceKeySize]byte]chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(addrRewardSourceIndexKey)
+	for _, key := range sortedRewardSourceKeys(sources) {
+		ticketHash := sources[key]
+		if err := bucket.Put(key[:], ticketHash[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbRemoveAddrRewardSources uses an existing database transaction to remove the
+// provided reward sources in order of their keys.
+func dbRemoveAddrRewardSources(dbTx database.Tx, sources map[[addrRewardSourceKeySize]byte]chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(addrRewardSourceIndexKey)
+	for _, key := range sortedRewardSourceKeys(sources) {
+		if err := bucket.Delete(key[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// The heights of the blocks that contain scripts with versions the index does
+// not support, and therefore are unable to be indexed, are stored in a separate
+// bucket so the affected blocks can be reindexed once they are supported.  Only
+// the main chain block at each height is ever recorded, so the height alone
+// identifies the block.
+//
+// The serialized key format is:
+//
+//   <block height>
+//
+//   Field           Type              Size
+//   block height    uint32            4 bytes
+//   -----
+//   Total: 4 bytes
+//
+// The value is empty.
+// -----------------------------------------------------------------------------
+
+// isSupportedScriptVersion returns whether or not the addresses of scripts with
+// the provided version are able to be extracted.
+func (idx *AddrIndex) isSupportedScriptVersion(scriptVersion uint16) bool {
+	// Version 0 scripts are always supported.  Otherwise, the extraction
+	// only fails for an empty script when the version is not supported.
+	if scriptVersion == 0 {
+		return true
+	}
+	_, _, _, err := txscript.ExtractPkScriptAddrs(scriptVersion, nil,
+		idx.chainParams, false)
+	return err == nil
+}
+
+// unsupportedScriptVersions returns the unique versions of the output scripts
+// and spent previous output scripts in the provided block that are not
+// supported in ascending order.  It returns nil when all of them are.
+func (idx *AddrIndex) unsupportedScriptVersions(block *dcrutil.Block, prevScripts PrevScripter) []uint16 {
+	var versions []uint16
+	checkVersion := func(scriptVersion uint16) {
+		if idx.isSupportedScriptVersion(scriptVersion) {
+			return
+		}
+		for _, version := range versions {
+			if version == scriptVersion {
+				return
+			}
+		}
+		versions = append(versions, scriptVersion)
+	}
+	checkTx := func(msgTx *wire.MsgTx, checkInputs bool) {
+		if checkInputs {
+			for _, txIn := range msgTx.TxIn {
+				version, _, ok := prevScripts.PrevScript(&txIn.PreviousOutPoint)
+				if ok {
+					checkVersion(version)
+				}
+			}
+		}
+		for _, txOut := range msgTx.TxOut {
+			checkVersion(txOut.Version)
+		}
+	}
+
+	// Coinbases, stakebases, and treasury bases do not spend any previous
+	// outputs, which the previous scripter simply does not provide.
+	for txIdx, tx := range block.Transactions() {
+		checkTx(tx.MsgTx(), txIdx != 0)
+	}
+	for _, tx := range block.STransactions() {
+		checkTx(tx.MsgTx(), true)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
+
+// dbPutAddrUnindexedHeight uses an existing database transaction to record the
+// provided block height as containing scripts with unsupported versions.
+func dbPutAddrUnindexedHeight(dbTx database.Tx, height uint32) error {
+	var key [4]byte
+	byteOrder.PutUint32(key[:], height)
+	bucket := dbTx.Metadata().Bucket(addrUnindexedVersionIndexKey)
+	return bucket.Put(key[:], nil)
+}
+
+// dbRemoveAddrUnindexedHeight uses an existing database transaction to remove
+// the record of unsupported script versions for the provided block height.  It
+// is not an error if the height is not recorded.
+func dbRemoveAddrUnindexedHeight(dbTx database.Tx, height uint32) error {
+	var key [4]byte
+	byteOrder.PutUint32(key[:], height)
+	bucket := dbTx.Metadata().Bucket(addrUnindexedVersionIndexKey)
+	return bucket.Delete(key[:])
+}
+
+// UnindexedScriptVersionHeights returns the heights of the blocks in the index
+// that contain scripts with versions the index does not support in ascending
+// order.  The addresses involved in those scripts are not indexed, so the
+// blocks at the returned heights must be reindexed, such as via ReindexRange,
+// once the index supports them.
+//
+// NOTE: The heights are only recorded for blocks connected while the index is
+// at version 3 or later.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnindexedScriptVersionHeights() ([]uint32, error) {
+	var heights []uint32
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrUnindexedVersionIndexKey)
+		return bucket.ForEach(func(k, _ []byte) error {
+			if len(k) != 4 {
+				str := fmt.Sprintf("corrupt unindexed script version "+
+					"height key %x", k)
+				return makeDbErr(database.ErrCorruption, str)
+			}
+			heights = append(heights, byteOrder.Uint32(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+	return heights, nil
+}
+
+// -----------------------------------------------------------------------------
+// The total amounts credited to and debited from addresses are stored in a
+// separate bucket keyed by the address key.  An output that pays to multiple
+// addresses, such as a bare multisignature output, credits its full amount to
+// each of them and an input that spends such an output likewise debits its
+// full amount from each of them.
+//
+// The serialized key format is:
+//
+//   <addr type><addr hash>
+//
+//   Field           Type              Size
+//   addr type       uint8             1 byte
+//   addr hash       hash160           20 bytes
+//   -----
+//   Total: 21 bytes
+//
+// The serialized value format is:
+//
+//   <credited><debited>
+//
+//   Field           Type      Size
+//   credited        uint64    8 bytes
+//   debited         uint64    8 bytes
+//   -----
+//   Total: 16 bytes
+// -----------------------------------------------------------------------------
+
+// addrTotals houses the total amounts credited to and debited from an address.
+type addrTotals struct {
+	credited int64
+	debited  int64
+}
+
+// prevOutputAmount returns the amount of the previous output spent by the
+// provided input.  The amount is obtained from the provided previous scripter
+// when it also implements the PrevAmounter interface and has it.  Otherwise, it
+// falls back to the amount committed to by the input which is proven to match
+// the amount of the spent output by consensus.
+func prevOutputAmount(prevScripts PrevScripter, txIn *wire.TxIn) int64 {
+	if amounter, ok := prevScripts.(PrevAmounter); ok {
+		amount, ok := amounter.PrevAmount(&txIn.PreviousOutPoint)
+		if ok {
+			return amount
+		}
+	}
+	return txIn.ValueIn
+}
+
+// indexBlockTotals returns the amounts credited to and debited from each
+// address by the transactions in the provided block keyed by the address key.
+// The same transactions and scripts that the entries of the block are created
+// for are considered with the exception of redeem scripts and ticket
+// commitments since their addresses are not directly credited or debited.
+func (idx *AddrIndex) indexBlockTotals(block *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) map[[addrKeySize]byte]*addrTotals {
+	totals := make(map[[addrKeySize]byte]*addrTotals)
+	addTotals := func(scriptVersion uint16, pkScript []byte, amount int64, isDebit bool, isTreasuryEnabled bool) {
+		addrKeys := idx.scriptAddrKeys(scriptVersion, pkScript, false,
+			isTreasuryEnabled)
+		seen := make(map[[addrKeySize]byte]struct{}, len(addrKeys))
+		for _, addrKey := range addrKeys {
+			if _, ok := seen[addrKey]; ok {
+				continue
+			}
+			seen[addrKey] = struct{}{}
+
+			addrTotal := totals[addrKey]
+			if addrTotal == nil {
+				addrTotal = &addrTotals{}
+				totals[addrKey] = addrTotal
+			}
+			if isDebit {
+				addrTotal.debited += amount
+			} else {
+				addrTotal.credited += amount
+			}
+		}
+	}
+	addDebits := func(txIn *wire.TxIn) {
+		origin := &txIn.PreviousOutPoint
+		version, pkScript, ok := prevScripts.PrevScript(origin)
+		if !ok {
+			return
+		}
+		addTotals(version, pkScript, prevOutputAmount(prevScripts, txIn), true,
+			isTreasuryEnabled)
+	}
+
+	for txIdx, tx := range block.Transactions() {
+		if txIdx == 0 && idx.skipCoinbaseOutputs {
+			continue
+		}
+		if txIdx != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				addDebits(txIn)
+			}
+		}
+		for _, txOut := range tx.MsgTx().TxOut {
+			addTotals(txOut.Version, txOut.PkScript, txOut.Value, false,
+				isTreasuryEnabled)
+		}
+	}
+
+	for _, tx := range block.STransactions() {
+		msgTx := tx.MsgTx()
+		isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
+		var isTSpend, isTreasuryBase bool
+		if isTreasuryEnabled {
+			isTreasuryBase = !isSSGen && stake.IsTreasuryBase(msgTx)
+			isTSpend = !isTreasuryBase && stake.IsTSpend(msgTx)
+		}
+		if isTreasuryBase {
+			continue
+		}
+		if isTSpend {
+			for _, txOut := range msgTx.TxOut[1:] {
+				addTotals(txOut.Version, txOut.PkScript, txOut.Value, false,
+					true)
+			}
+			continue
+		}
+
+		for i, txIn := range msgTx.TxIn {
+			// Skip stakebases.
+			if isSSGen && i == 0 {
+				continue
+			}
+			addDebits(txIn)
+		}
+		for _, txOut := range msgTx.TxOut {
+			addTotals(txOut.Version, txOut.PkScript, txOut.Value, false,
+				isTreasuryEnabled)
+		}
+	}
+	return totals
+}
+
+// dbAddAddrTotals uses an existing database transaction to add the provided
+// amounts credited to and debited from each address to the address totals in
+// order of the address keys.  The amounts are subtracted instead when the
+// subtract flag is set.
+func dbAddAddrTotals(dbTx database.Tx, totals map[[addrKeySize]byte]*addrTotals, subtract bool) error {
+	addrKeys := make([][addrKeySize]byte, 0, len(totals))
+	for addrKey := range totals {
+		addrKeys = append(addrKeys, addrKey)
+	}
+	sort.Slice(addrKeys, func(i, j int) bool {
+		return bytes.Compare(addrKeys[i][:], addrKeys[j][:]) < 0
+	})
+
+	bucket := dbTx.Metadata().Bucket(addrTotalsIndexKey)
+	for _, addrKey := range addrKeys {
+		var credited, debited int64
+		if serialized := bucket.Get(addrKey[:]); len(serialized) ==
+			addrTotalsEntrySize {
+
+			credited = int64(byteOrder.Uint64(serialized[0:8]))
+			debited = int64(byteOrder.Uint64(serialized[8:16]))
+		}
+
+		addrTotal := totals[addrKey]
+		if subtract {
+			credited -= addrTotal.credited
+			debited -= addrTotal.debited
+		} else {
+			credited += addrTotal.credited
+			debited += addrTotal.debited
+		}
+
+		// Remove the totals for addresses that no longer have any.
+		if credited <= 0 && debited <= 0 {
+			if err := bucket.Delete(addrKey[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		var serialized [addrTotalsEntrySize]byte
+		byteOrder.PutUint64(serialized[0:8], uint64(credited))
+		byteOrder.PutUint64(serialized[8:16], uint64(debited))
+		if err := bucket.Put(addrKey[:], serialized[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// The timestamps of the blocks referenced by the entries of the index are
+// stored in a separate bucket keyed by the block hash so that time-range
+// queries do not need to load the header of every referenced block.  They are
+// keyed by hash as opposed to the internal block ID since block IDs are reused
+// once the blocks they were assigned to are disconnected.
+//
+// The serialized key format is:
+//
+//   <block hash>
+//
+//   Field           Type              Size
+//   block hash      chainhash.Hash    32 bytes
+//   -----
+//   Total: 32 bytes
+//
+// The serialized value format is:
+//
+//   <timestamp>
+//
+//   Field           Type      Size
+//   timestamp       int64     8 bytes
+//   -----
+//   Total: 8 bytes
+// -----------------------------------------------------------------------------
+
+// dbPutAddrBlockTime uses an existing database transaction to store the
+// provided timestamp for the block with the given hash.
+func dbPutAddrBlockTime(dbTx database.Tx, hash *chainhash.Hash, timestamp int64) error {
+	var serialized [addrBlockTimeEntrySize]byte
+	byteOrder.PutUint64(serialized[:], uint64(timestamp))
+	bucket := dbTx.Metadata().Bucket(addrBlockTimeIndexKey)
+	return bucket.Put(hash[:], serialized[:])
+}
+
+// dbRemoveAddrBlockTime uses an existing database transaction to remove the
+// stored timestamp for the block with the given hash if there is one.
+func dbRemoveAddrBlockTime(dbTx database.Tx, hash *chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(addrBlockTimeIndexKey)
+	return bucket.Delete(hash[:])
+}
+
+// dbFetchAddrBlockTime uses an existing database transaction to fetch the
+// stored timestamp for the block with the given hash.  It returns false when
+// there is no stored timestamp for the block.
+func dbFetchAddrBlockTime(dbTx database.Tx, hash *chainhash.Hash) (int64, bool) {
+	bucket := dbTx.Metadata().Bucket(addrBlockTimeIndexKey)
+	if bucket == nil {
+		return 0, false
+	}
+	serialized := bucket.Get(hash[:])
+	if len(serialized) != addrBlockTimeEntrySize {
+		return 0, false
+	}
+	return int64(byteOrder.Uint64(serialized)), true
+}
+
+// -----------------------------------------------------------------------------
+// The hashes of the blocks whose regular transaction tree was disapproved by
+// the votes in the next block are stored in a separate bucket keyed by the
+// hash of the disapproved block when the index is configured to track them.
+// This allows the entries for the regular transactions of disapproved blocks
+// to be flagged without rewriting the entries once the disapproval becomes
+// known.  The value is the hash of the block that disapproved it.
+//
+// The serialized key format is:
+//
+//   <disapproved block hash>
+//
+//   Field                   Type              Size
+//   disapproved block hash  chainhash.Hash    32 bytes
+//   -----
+//   Total: 32 bytes
+//
+// The serialized value format is:
+//
+//   <disapproving block hash>
+//
+//   Field                   Type              Size
+//   disapproving block hash chainhash.Hash    32 bytes
+//   -----
+//   Total: 32 bytes
+// -----------------------------------------------------------------------------
+
+// dbPutAddrDisapproval uses an existing database transaction to record that the
+// regular transaction tree of the block with the provided hash was disapproved
+// by the block with the given hash.
+func dbPutAddrDisapproval(dbTx database.Tx, hash, disapprovedBy *chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(addrDisapprovedIndexKey)
+	return bucket.Put(hash[:], disapprovedBy[:])
+}
+
+// dbRemoveAddrDisapproval uses an existing database transaction to remove the
+// record of the disapproval of the block with the provided hash if there is
+// one.
+func dbRemoveAddrDisapproval(dbTx database.Tx, hash *chainhash.Hash) error {
+	bucket := dbTx.Metadata().Bucket(addrDisapprovedIndexKey)
+	return bucket.Delete(hash[:])
+}
+
+// dbFetchAddrDisapproved uses an existing database transaction to return
+// whether or not the regular transaction tree of the block with the provided
+// hash is recorded as disapproved.
+func dbFetchAddrDisapproved(dbTx database.Tx, hash *chainhash.Hash) bool {
+	bucket := dbTx.Metadata().Bucket(addrDisapprovedIndexKey)
+	return bucket != nil && bucket.Get(hash[:]) != nil
+}
+
+// markDisapprovedEntries flags the provided entries for regular transactions
+// in blocks whose regular transaction tree was disapproved as disapproved when
+// the index is configured to track disapprovals.
+func (idx *AddrIndex) markDisapprovedEntries(dbTx database.Tx, entries []TxIndexEntry) {
+	idx.markDisapprovedEntriesUntil(dbTx, entries, time.Time{})
+}
+
+// markDisapprovedEntriesUntil is identical to markDisapprovedEntries except
+// that it stops marking the entries once the provided deadline is reached.  It
+// returns the number of leading entries that were marked, which is all of them
+// unless the deadline was reached.  The deadline is checked periodically after
+// the first entries are marked so the entries loaded before it was reached are
+// not all discarded and a zero deadline disables it.
+func (idx *AddrIndex) markDisapprovedEntriesUntil(dbTx database.Tx, entries []TxIndexEntry, deadline time.Time) int {
+	if !idx.trackDisapprovals {
+		return len(entries)
+	}
+
+	// The results are cached since the entries commonly reference the same
+	// blocks.
+	disapproved := make(map[chainhash.Hash]bool)
+	for i := range entries {
+		if i > 0 && i%deadlineCheckInterval == 0 && deadlineReached(deadline) {
+			return i
+		}
+
+		entry := &entries[i]
+		if entry.Tree != wire.TxTreeRegular {
+			continue
+		}
+		hash := entry.BlockRegion.Hash
+		isDisapproved, ok := disapproved[*hash]
+		if !ok {
+			isDisapproved = dbFetchAddrDisapproved(dbTx, hash)
+			disapproved[*hash] = isDisapproved
+		}
+		entry.Disapproved = isDisapproved
+	}
+	return len(entries)
+}
+
+// -----------------------------------------------------------------------------
+// The indices of the inputs of the transactions in a block that spend outputs
+// which pay to an address are stored in a separate bucket keyed by the hash of
+// the block followed by the address key.  This allows the entries for debits to
+// identify the exact inputs that reference the address without requiring the
+// spending transaction to be parsed.  A marker keyed by the hash of the block
+// alone records that the input indices were tracked for the block, so the input
+// indices of entries for blocks without one, such as those connected by
+// versions of the index prior to version 3, are unknown.
+//
+// The serialized key format for the input indices of an address is:
+//
+//   <block hash><addr key>
+//
+//   Field           Type              Size
+//   block hash      chainhash.Hash    32 bytes
+//   addr key        [addrKeySize]byte 21 bytes
+//   -----
+//   Total: 53 bytes
+//
+// The serialized value format is a sequence of the following record for each
+// transaction in the block that spends outputs which pay to the address:
+//
+//   <tree><block index><num inputs><input index 1>...<input index N>
+//
+//   Field           Type              Size
+//   tree            int8              1 byte
+//   block index     uint32            4 bytes
+//   num inputs      uint32            4 bytes
+//   input index     uint32            4 bytes each
+//
+// The serialized value of the marker for a block is the number of addresses
+// with input indices in the block as a uint32.
+// -----------------------------------------------------------------------------
+
+// addrInputsKey returns the key of the input indices of the provided address
+// for the block with the provided hash.
+func addrInputsKey(hash *chainhash.Hash, addrKey [addrKeySize]byte) [chainhash.HashSize + addrKeySize]byte {
+	var key [chainhash.HashSize + addrKeySize]byte
+	copy(key[:], hash[:])
+	copy(key[chainhash.HashSize:], addrKey[:])
+	return key
+}
+
+// serializeAddrInputs returns the serialized input indices of the provided
+// transactions of a block along with whether or not any of them spend outputs
+// which pay to the address.  The transaction indices are those used by
+// indexBlock, so the indices of the stake transactions start after all of the
+// regular transactions.
+func serializeAddrInputs(txns []indexedTx, numRegularTxns int) ([]byte, bool) {
+	var size int
+	for _, txn := range txns {
+		if len(txn.inputs) > 0 {
+			size += 9 + 4*len(txn.inputs)
+		}
+	}
+	if size == 0 {
+		return nil, false
+	}
+
+	serialized := make([]byte, size)
+	var offset int
+	for _, txn := range txns {
+		if len(txn.inputs) == 0 {
+			continue
+		}
+		blockIndex := txn.txIdx
+		tree := wire.TxTreeRegular
+		if txn.txIdx >= numRegularTxns {
+			blockIndex -= numRegularTxns
+			tree = wire.TxTreeStake
+		}
+		serialized[offset] = byte(tree)
+		byteOrder.PutUint32(serialized[offset+1:], uint32(blockIndex))
+		byteOrder.PutUint32(serialized[offset+5:], uint32(len(txn.inputs)))
+		offset += 9
+		for _, inputIdx := range txn.inputs {
+			byteOrder.PutUint32(serialized[offset:], inputIdx)
+			offset += 4
+		}
+	}
+	return serialized, true
+}
+
+// deserializeAddrInputs returns the input indices of the transaction at the
+// provided tree and index of a block from the provided serialized input indices
+// of an address.  It returns nil when the transaction does not spend any
+// outputs which pay to the address.
+func deserializeAddrInputs(serialized []byte, tree int8, blockIndex uint32) ([]uint32, error) {
+	for offset := 0; offset < len(serialized); {
+		if len(serialized[offset:]) < 9 {
+			return nil, errDeserialize("unexpected end of address input " +
+				"indices")
+		}
+		txTree := int8(serialized[offset])
+		txBlockIndex := byteOrder.Uint32(serialized[offset+1:])
+		numInputs := byteOrder.Uint32(serialized[offset+5:])
+		offset += 9
+		if uint64(len(serialized[offset:])) < 4*uint64(numInputs) {
+			return nil, errDeserialize("unexpected end of address input " +
+				"indices")
+		}
+		if txTree != tree || txBlockIndex != blockIndex {
+			offset += 4 * int(numInputs)
+			continue
+		}
+		inputs := make([]uint32, numInputs)
+		for i := range inputs {
+			inputs[i] = byteOrder.Uint32(serialized[offset:])
+			offset += 4
+		}
+		return inputs, nil
+	}
+	return nil, nil
+}
+
+// dbPutAddrInputs uses an existing database transaction to store the input
+// indices of the provided transactions for each of the provided address keys
+// along with the marker that records they were tracked for the block with the
+// provided hash.
+func dbPutAddrInputs(dbTx database.Tx, hash *chainhash.Hash, data writeIndexData, addrKeys [][addrKeySize]byte, numRegularTxns int) error {
+	bucket := dbTx.Metadata().Bucket(addrInputIndexKey)
+	var numAddrs uint32
+	for _, addrKey := range addrKeys {
+		serialized, ok := serializeAddrInputs(data[addrKey], numRegularTxns)
+		if !ok {
+			continue
+		}
+		key := addrInputsKey(hash, addrKey)
+		if err := bucket.Put(key[:], serialized); err != nil {
+			return err
+		}
+		numAddrs++
+	}
+	var marker [4]byte
+	byteOrder.PutUint32(marker[:], numAddrs)
+	return bucket.Put(hash[:], marker[:])
+}
+
+// dbRemoveAddrInputs uses an existing database transaction to remove the input
+// indices of the provided address keys along with the marker for the block with
+// the provided hash.
+func dbRemoveAddrInputs(dbTx database.Tx, hash *chainhash.Hash, addrKeys [][addrKeySize]byte) error {
+	bucket := dbTx.Metadata().Bucket(addrInputIndexKey)
+	for _, addrKey := range addrKeys {
+		key := addrInputsKey(hash, addrKey)
+		if err := bucket.Delete(key[:]); err != nil {
+			return err
+		}
+	}
+	return bucket.Delete(hash[:])
+}
+
+// markEntryInputs sets the input indices of the provided entries for the
+// provided address key along with whether or not they are known when the index
+// is configured to track input indices.  The input indices are only known for
+// entries in blocks that were connected by a version of the index that tracks
+// them.
+func (idx *AddrIndex) markEntryInputs(dbTx database.Tx, addrKey [addrKeySize]byte, entries []TxIndexEntry) error {
+	_, err := idx.markEntryInputsUntil(dbTx, addrKey, entries, time.Time{})
+	return err
+}
+
+// markEntryInputsUntil is identical to markEntryInputs except that it stops
+// marking the entries once the provided deadline is reached.  It returns the
+// number of leading entries that were marked, which is all of them unless the
+// deadline was reached.  The deadline is checked the same way as
+// markDisapprovedEntriesUntil.
+func (idx *AddrIndex) markEntryInputsUntil(dbTx database.Tx, addrKey [addrKeySize]byte, entries []TxIndexEntry, deadline time.Time) (int, error) {
+	if !idx.trackInputIndexes {
+		return len(entries), nil
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrInputIndexKey)
+	if bucket == nil {
+		return len(entries), nil
+	}
+
+	// The results are cached since the entries commonly reference the same
+	// blocks.
+	type blockInputs struct {
+		known      bool
+		serialized []byte
+	}
+	cache := make(map[chainhash.Hash]blockInputs)
+	for i := range entries {
+		if i > 0 && i%deadlineCheckInterval == 0 && deadlineReached(deadline) {
+			return i, nil
+		}
+
+		entry := &entries[i]
+		hash := entry.BlockRegion.Hash
+		inputs, ok := cache[*hash]
+		if !ok {
+			inputs.known = bucket.Get(hash[:]) != nil
+			if inputs.known {
+				key := addrInputsKey(hash, addrKey)
+				inputs.serialized = bucket.Get(key[:])
+			}
+			cache[*hash] = inputs
+		}
+		if !inputs.known {
+			continue
+		}
+		inputIdxs, err := deserializeAddrInputs(inputs.serialized, entry.Tree,
+			entry.BlockIndex)
+		if err != nil {
+			return 0, err
+		}
+		entry.InputIndexes = inputIdxs
+		entry.InputIndexesKnown = true
+	}
+	return len(entries), nil
+}
+
+// connectBlock adds a mapping for all addresses associated with transactions in
+// the provided block.
+func (idx *AddrIndex) connectBlock(dbTx database.Tx, block, parent *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) error {
+	// Ignore blocks that are already the current index tip since connecting
+	// them again would index all of their entries twice and reject blocks
+	// that do not extend the current index tip.
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	if *tipHash == *block.Hash() {
+		log.Warnf("Ignoring duplicate connect of block %s (height %d) which "+
+			"is already the %s tip", block.Hash(), block.Height(), idx.Name())
+		return nil
+	}
+	if *tipHash != block.MsgBlock().Header.PrevBlock {
+		return fmt.Errorf("%w: block %s (height %d) does not extend tip %s "+
+			"(height %d)", ErrIndexTipMismatch, block.Hash(), block.Height(),
+			tipHash, tipHeight)
+	}
+
+	addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
+	numNonStandard, err := idx.putBlockEntries(dbTx, addrIdxBucket, block,
+		prevScripts, isTreasuryEnabled)
+	if err != nil {
+		return err
+	}
+	if err := idx.pruneExpiredEntries(dbTx, addrIdxBucket, block); err != nil {
+		return err
+	}
+
+	// Update the current index tip and number of processed blocks.
+	err = dbPutIndexerTip(dbTx, idx.Key(), block.Hash(), int32(block.Height()))
+	if err != nil {
+		return err
+	}
+	idx.afterCommit(dbTx, func() { idx.pins.advance(tipHash, block.Hash()) })
+	err = idx.dbAddProcessedBlocks(dbTx, 1, block.Height()-1)
+	if err != nil {
+		return err
+	}
+	err = idx.addNonStandardScripts(dbTx, int64(numNonStandard), 1)
+	if err != nil {
+		return err
+	}
+
+	idx.afterCommit(dbTx, idx.metrics.IncConnectedBlocks)
+	return nil
+}
+
+// connectBlockData houses the data needed to connect a block to the address
+// index via connectBlocks.
+type connectBlockData struct {
+	block             *dcrutil.Block
+	prevScripts       PrevScripter
+	isTreasuryEnabled bool
+}
+
+// connectBlocks adds a mapping for all addresses associated with transactions
+// in the provided blocks, which must be provided in order and each extend the
+// current index tip, and updates the index tip to the final block.
+//
+// This is intended for replaying many historical blocks, such as when
+// reindexing, since all of the level updates for the provided blocks are
+// accumulated in memory and only the final level data for each address is
+// written to the database.  The resulting index is identical to connecting each
+// of the blocks individually via connectBlock.
+func (idx *AddrIndex) connectBlocks(dbTx database.Tx, blocks []connectBlockData) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	// Reject blocks that do not extend the current index tip.
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	first := blocks[0].block
+	if *tipHash != first.MsgBlock().Header.PrevBlock {
+		return fmt.Errorf("%w: block %s (height %d) does not extend tip %s "+
+			"(height %d)", ErrIndexTipMismatch, first.Hash(), first.Height(),
+			tipHash, tipHeight)
+	}
+
+	batch := newWriteBatchBucket(dbTx.Metadata().Bucket(addrIndexKey))
+	var numNonStandard int64
+	for i := range blocks {
+		data := &blocks[i]
+		n, err := idx.putBlockEntries(dbTx, batch, data.block,
+			data.prevScripts, data.isTreasuryEnabled)
+		if err != nil {
+			return err
+		}
+		numNonStandard += int64(n)
+		if err := idx.pruneExpiredEntries(dbTx, batch, data.block); err != nil {
+			return err
+		}
+	}
+	if err := batch.flush(); err != nil {
+		return err
+	}
+
+	// Update the current index tip and number of processed blocks.
+	tip := blocks[len(blocks)-1].block
+	err = dbPutIndexerTip(dbTx, idx.Key(), tip.Hash(), int32(tip.Height()))
+	if err != nil {
+		return err
+	}
+	idx.afterCommit(dbTx, func() { idx.pins.advance(tipHash, tip.Hash()) })
+	err = idx.dbAddProcessedBlocks(dbTx, int64(len(blocks)),
+		blocks[0].block.Height()-1)
+	if err != nil {
+		return err
+	}
+	err = idx.addNonStandardScripts(dbTx, numNonStandard, len(blocks))
+	if err != nil {
+		return err
+	}
+
+	idx.afterCommit(dbTx, func() {
+		for range blocks {
+			idx.metrics.IncConnectedBlocks()
+		}
+	})
+	return nil
+}
+
+// pruneExpiredEntries removes the entries that reference blocks which are no
+// longer within the retention window of the index after connecting the block
+// at the provided height to the provided bucket.  It does nothing when the
+// retention window is disabled.
+//
+// Every connected block causes at most one block, the one at the height that
+// falls out of the window, to expire.  Only the addresses associated with the
+// transactions in that block are checked, so the cost does not depend on the
+// total number of addresses in the index.  The entries of each checked address
+// that reference blocks below the window are all located at the start of its
+// highest levels since they are the oldest ones.
+//
+// The ticket commitment amounts, reward sources, and input indices recorded for
+// the expired block are removed as well and the amounts it credited to and
+// debited from each address are subtracted from the address totals.  This is
+// only done for the addresses that still have entries for the expired block,
+// so connecting another block at the same height after a reorganization does
+// not remove them again.
+//
+// NOTE: The previous outputs spent by the expired block are loaded via the
+// transaction index since their spend journal entries might no longer be
+// available.
+func (idx *AddrIndex) pruneExpiredEntries(dbTx database.Tx, bucket internalBucket, block *dcrutil.Block) error {
+	if idx.retentionWindow == 0 {
+		return nil
+	}
+	expiredHeight := block.Height() - int64(idx.retentionWindow)
+	if expiredHeight < 1 {
+		return nil
+	}
+
+	// Load the expired block and determine the addresses it involves.
+	expiredHash := idx.chain.Ancestor(block.Hash(), expiredHeight)
+	if expiredHash == nil {
+		return fmt.Errorf("unable to find ancestor of block %s at height %d",
+			block.Hash(), expiredHeight)
+	}
+	expiredBlock, err := idx.chain.BlockByHash(expiredHash)
+	if err != nil {
+		return err
+	}
+	parentHash := &expiredBlock.MsgBlock().Header.PrevBlock
+	isTreasuryEnabled, err := idx.chain.IsTreasuryAgendaActive(parentHash)
+	if err != nil {
+		return err
+	}
+	addrsToTxns := make(writeIndexData)
+	idx.indexBlock(addrsToTxns, expiredBlock, txIndexPrevScripter{dbTx: dbTx},
+		isTreasuryEnabled)
+
+	// blockHeightByID returns the height of the block associated with the
+	// provided serialized block ID.  The heights are cached since the entries
+	// of multiple addresses commonly reference the same blocks.
+	heights := make(map[uint32]int64)
+	blockHeightByID := func(serializedID []byte) (int64, error) {
+		id := byteOrder.Uint32(serializedID)
+		if height, ok := heights[id]; ok {
+			return height, nil
+		}
+		hash, err := dbFetchBlockHashBySerializedID(dbTx, serializedID)
+		if err != nil {
+			return 0, err
+		}
+		header, err := idx.chain.BlockHeaderByHash(hash)
+		if err != nil {
+			return 0, err
+		}
+		heights[id] = int64(header.Height)
+		return int64(header.Height), nil
+	}
+
+	// Remove the entries of each address that reference blocks at or below
+	// the expired height.  The address filter is only updated once the
+	// removals are committed so it never reports false negatives.
+	var numRemoved int
+	numExpiredByAddr := make(map[[addrKeySize]byte]int)
+	for _, addrKey := range addrsToTxns.sortedKeys() {
+		serialized := dbFetchAllSerializedAddrIndexEntries(bucket, addrKey)
+		var numExpired int
+		for offset := 0; offset+txEntrySize <= len(serialized); offset +=
+			txEntrySize {
+
+			height, err := blockHeightByID(serialized[offset : offset+4])
+			if err != nil {
+				return err
+			}
+			if height > expiredHeight {
+				break
+			}
+			numExpired++
+		}
+		if numExpired == 0 {
+			continue
+		}
+
+		err := dbPutAddrIndexLevels(bucket, addrKey,
+			serialized[numExpired*txEntrySize:])
+		if err != nil {
+			return err
+		}
+		numExpiredByAddr[addrKey] = numExpired
+		numRemoved += numExpired
+	}
+
+	// Nothing else to do when none of the entries of the expired block remain,
+	// such as when it was already pruned when a block at the same height was
+	// connected prior to a reorganization.
+	if numRemoved == 0 {
+		return nil
+	}
+
+	// isExpiredAddr returns whether or not the entries of the address that is
+	// identified by the provided address key prefix were removed above.
+	isExpiredAddr := func(keyPrefix []byte) bool {
+		var addrKey [addrKeySize]byte
+		copy(addrKey[:], keyPrefix)
+		_, ok := numExpiredByAddr[addrKey]
+		return ok
+	}
+
+	// Remove the data the expired block contributed to the companion buckets
+	// so they do not grow without bound either.  The amounts it credited to
+	// and debited from each address are subtracted from the totals so they
+	// only cover the blocks within the window.
+	//
+	// Only the data of the addresses whose entries were removed above is
+	// removed since the data of any others was already removed along with
+	// their entries.
+	if idx.trackTotals {
+		totals := idx.indexBlockTotals(expiredBlock,
+			txIndexPrevScripter{dbTx: dbTx}, isTreasuryEnabled)
+		for addrKey := range totals {
+			if _, ok := numExpiredByAddr[addrKey]; !ok {
+				delete(totals, addrKey)
+			}
+		}
+		if err := dbAddAddrTotals(dbTx, totals, true); err != nil {
+			return err
+		}
+	}
+	commitments := idx.indexBlockCommitments(expiredBlock)
+	for key := range commitments {
+		if !isExpiredAddr(key[:addrKeySize]) {
+			delete(commitments, key)
+		}
+	}
+	if err := dbRemoveAddrCommitments(dbTx, commitments); err != nil {
+		return err
+	}
+	if idx.indexRewardSources {
+		sources, err := idx.indexBlockRewardSources(expiredBlock,
+			isTreasuryEnabled)
+		if err != nil {
+			return err
+		}
+		for key := range sources {
+			if !isExpiredAddr(key[:addrKeySize]) {
+				delete(sources, key)
+			}
+		}
+		if err := dbRemoveAddrRewardSources(dbTx, sources); err != nil {
+			return err
+		}
+	}
+	expiredAddrKeys := make([][addrKeySize]byte, 0, len(numExpiredByAddr))
+	for _, addrKey := range addrsToTxns.sortedKeys() {
+		if _, ok := numExpiredByAddr[addrKey]; ok {
+			expiredAddrKeys = append(expiredAddrKeys, addrKey)
+		}
+	}
+	err = dbRemoveAddrInputs(dbTx, expiredHash, expiredAddrKeys)
+	if err != nil {
+		return err
+	}
+
+	idx.afterCommit(dbTx, func() {
+		for addrKey, numExpired := range numExpiredByAddr {
+			idx.addrFilter.remove(addrKey, numExpired)
+			idx.pins.invalidate(addrKey)
+		}
+		idx.metrics.IncRemovedEntries(numRemoved)
+	})
+	return nil
+}
+
+// disconnectBlock removes the mappings for addresses associated with
+// transactions in the provided block.
+func (idx *AddrIndex) disconnectBlock(dbTx database.Tx, block, parent *dcrutil.Block, prevScripts PrevScripter, isTreasuryEnabled bool) error {
+	// NOTE: The fact that the block can disapprove the regular tree of the
+	// previous block is ignored for this index because even though the
+	// disapproved transactions no longer apply spend semantics, they still
+	// exist within the block and thus have to be processed before the next
+	// block disapproves them.
+
+	// Reject blocks that are not the current index tip since disconnecting
+	// them would remove the entries of other blocks.
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	if *tipHash != *block.Hash() {
+		return fmt.Errorf("%w: block %s (height %d) is not tip %s (height %d)",
+			ErrIndexTipMismatch, block.Hash(), block.Height(), tipHash,
+			tipHeight)
+	}
+
+	// Build all of the address to transaction mappings in a local map.
+	addrsToTxns := make(writeIndexData)
+	numNonStandard := idx.indexBlock(addrsToTxns, block, prevScripts,
+		isTreasuryEnabled)
+
+	// Remove all of the index entries for each address in order of their keys.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	addrKeys := addrsToTxns.sortedKeys()
+	if err := dbRemoveAddrBlockEntries(bucket, addrsToTxns, addrKeys); err != nil {
+		return err
+	}
+	var numRemoved int
+	for _, addrKey := range addrKeys {
+		numRemoved += len(addrsToTxns[addrKey])
+	}
+	idx.afterCommit(dbTx, func() {
+		for _, addrKey := range addrKeys {
+			idx.addrFilter.remove(addrKey, len(addrsToTxns[addrKey]))
+			idx.pins.invalidate(addrKey)
+		}
+	})
+
+	// Remove the amounts credited to and debited from each address.
+	if idx.trackTotals {
+		totals := idx.indexBlockTotals(block, prevScripts, isTreasuryEnabled)
+		if err := dbAddAddrTotals(dbTx, totals, true); err != nil {
+			return err
+		}
+	}
+
+	// Remove the amounts committed to each address by ticket purchases.
+	err = dbRemoveAddrCommitments(dbTx, idx.indexBlockCommitments(block))
+	if err != nil {
+		return err
+	}
+
+	// Remove the tickets that earned the reward outputs of the votes.
+	if idx.indexRewardSources {
+		sources, err := idx.indexBlockRewardSources(block, isTreasuryEnabled)
+		if err != nil {
+			return err
+		}
+		if err := dbRemoveAddrRewardSources(dbTx, sources); err != nil {
+			return err
+		}
+	}
+
+	// Remove the record of unsupported script versions for the block.
+	if err := dbRemoveAddrUnindexedHeight(dbTx, uint32(block.Height())); err != nil {
+		return err
+	}
+
+	// Remove the timestamp of the block.  This is done regardless of whether
+	// or not block timestamps are stored since they might have been stored
+	// while the option was enabled or loaded by a time-range query.
+	if err := dbRemoveAddrBlockTime(dbTx, block.Hash()); err != nil {
+		return err
+	}
+
+	// Remove the indices of the inputs that spend outputs which pay to each
+	// address.  This is done regardless of whether or not input indices are
+	// tracked for the same reason as the timestamp.
+	if err := dbRemoveAddrInputs(dbTx, block.Hash(), addrKeys); err != nil {
+		return err
+	}
+
+	// Remove the record of the disapproval of the parent of the block, if
+	// any, since the votes that disapproved it are no longer in the main
+	// chain.  This is done regardless of whether or not disapprovals are
+	// tracked for the same reason as the timestamp.
+	parentHash := &block.MsgBlock().Header.PrevBlock
+	if err := dbRemoveAddrDisapproval(dbTx, parentHash); err != nil {
+		return err
+	}
+
+	// Update the current index tip and number of processed blocks.
+	err = dbPutIndexerTip(dbTx, idx.Key(), &block.MsgBlock().Header.PrevBlock,
+		int32(block.Height()-1))
+	if err != nil {
+		return err
+	}
+	idx.afterCommit(dbTx, func() {
+		idx.pins.advance(tipHash, &block.MsgBlock().Header.PrevBlock)
+	})
+	err = idx.dbAddProcessedBlocks(dbTx, -1, block.Height())
+	if err != nil {
+		return err
+	}
+	err = idx.addNonStandardScripts(dbTx, -int64(numNonStandard), 1)
+	if err != nil {
+		return err
+	}
+
+	idx.afterCommit(dbTx, func() { idx.metrics.IncRemovedEntries(numRemoved) })
+	return nil
+}
+
+// dbAddProcessedBlocks uses an existing database transaction to adjust the
+// number of blocks processed by the index by the provided delta.  The count for
+// indexes created before it was tracked starts from the provided tip height the
+// index had prior to the adjustment since that is the number of blocks they
+// have processed.
+func (idx *AddrIndex) dbAddProcessedBlocks(dbTx database.Tx, delta int64, priorTipHeight int64) error {
+	count, exists, err := dbFetchIndexerProcessedBlocks(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	if !exists {
+		count = uint64(priorTipHeight)
+	}
+	if delta < 0 && uint64(-delta) > count {
+		str := fmt.Sprintf("attempt to remove %d processed blocks from the "+
+			"%s when only %d have been processed", -delta, idx.Name(), count)
+		return AssertError(str)
+	}
+	return dbPutIndexerProcessedBlocks(dbTx, idx.Key(), uint64(int64(count)+
+		delta))
+}
+
+// ProcessedBlocks returns the number of blocks the address index has processed
+// since it was created.  Connecting a block increases the count and
+// disconnecting one decreases it.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) ProcessedBlocks() (uint64, error) {
+	var count uint64
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var exists bool
+		var err error
+		count, exists, err = dbFetchIndexerProcessedBlocks(dbTx, idx.Key())
+		if err != nil || exists {
+			return err
+		}
+
+		// Indexes created before the count was tracked have processed the
+		// number of blocks identified by their tip height.
+		_, height, err := dbFetchIndexerTip(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		count = uint64(height)
+		return nil
+	})
+	return count, err
+}
+
+// addNonStandardScripts adjusts the number of non-standard scripts encountered
+// by the index by the provided delta after processing the provided number of
+// blocks.  The changes are accumulated in memory and only written to the
+// database using the provided transaction once enough blocks have been
+// processed since they were last written in order to avoid an additional write
+// for every block.
+//
+// The in-memory changes are only applied once the provided transaction is
+// committed so that changes which are rolled back are not counted.
+func (idx *AddrIndex) addNonStandardScripts(dbTx database.Tx, delta int64, numBlocks int) error {
+	idx.nonStandardMtx.Lock()
+	pending := idx.pendingNonStandard
+	pendingBlocks := idx.nonStandardBlocks
+	idx.nonStandardMtx.Unlock()
+
+	if pendingBlocks+numBlocks < nonStandardFlushInterval {
+		idx.afterCommit(dbTx, func() {
+			idx.nonStandardMtx.Lock()
+			idx.pendingNonStandard += delta
+			idx.nonStandardBlocks += numBlocks
+			idx.nonStandardMtx.Unlock()
+		})
+		return nil
+	}
+
+	count, err := dbFetchIndexerNonStandardScripts(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	newCount := int64(count) + pending + delta
+	if newCount < 0 {
+		newCount = 0
+	}
+	err = dbPutIndexerNonStandardScripts(dbTx, idx.Key(), uint64(newCount))
+	if err != nil {
+		return err
+	}
+
+	// Remove the changes that were written from those accumulated in memory.
+	idx.afterCommit(dbTx, func() {
+		idx.nonStandardMtx.Lock()
+		idx.pendingNonStandard -= pending
+		idx.nonStandardBlocks -= pendingBlocks
+		idx.nonStandardMtx.Unlock()
+	})
+	return nil
+}
+
+// NonStandardScriptCount returns the number of outputs with non-standard
+// scripts in the blocks processed by the address index.  The outputs do not
+// pay to any addresses the index recognizes, so they are not indexed.  This
+// allows an address that is not involved in any transactions to be
+// distinguished from one that might be involved in transactions whose scripts
+// the index is unable to interpret.
+//
+// The count is tracked in memory and periodically written to the database, so
+// the changes from the most recently processed blocks are not retained when
+// the process exits before they are written.  It only includes the blocks
+// processed since the count was introduced.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) NonStandardScriptCount() (uint64, error) {
+	var count uint64
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		count, err = dbFetchIndexerNonStandardScripts(dbTx, idx.Key())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	idx.nonStandardMtx.Lock()
+	total := int64(count) + idx.pendingNonStandard
+	idx.nonStandardMtx.Unlock()
+	if total < 0 {
+		total = 0
+	}
+	return uint64(total), nil
+}
+
+// txIndexPrevScripter provides previous output scripts by looking up the
+// transactions that created them via the transaction index and implements the
+// PrevScripter interface.  It is used when the spend journal for a block might
+// no longer be available.
+type txIndexPrevScripter struct {
+	dbTx database.Tx
+}
+
+// prevTx returns the transaction that created the provided outpoint if it is
+// in the transaction index.
+func (p txIndexPrevScripter) prevTx(op *wire.OutPoint) (*wire.MsgTx, bool) {
+	entry, err := dbFetchTxIndexEntry(p.dbTx, &op.Hash)
+	if err != nil || entry == nil {
+		return nil, false
+	}
+	txBytes, err := p.dbTx.FetchBlockRegion(&entry.BlockRegion)
+	if err != nil {
+		return nil, false
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.FromBytes(txBytes); err != nil {
+		return nil, false
+	}
+	return &msgTx, true
+}
+
+// prevOutput returns the output for the provided outpoint if the transaction
+// that created it is in the transaction index.
+func (p txIndexPrevScripter) prevOutput(op *wire.OutPoint) (*wire.TxOut, bool) {
+	msgTx, ok := p.prevTx(op)
+	if !ok || op.Index >= uint32(len(msgTx.TxOut)) {
+		return nil, false
+	}
+	return msgTx.TxOut[op.Index], true
+}
+
+// PrevScript returns the script and version for the provided outpoint if the
+// transaction that created it is in the transaction index.
+//
+// This is part of the PrevScripter interface.
+func (p txIndexPrevScripter) PrevScript(op *wire.OutPoint) (uint16, []byte, bool) {
+	txOut, ok := p.prevOutput(op)
+	if !ok {
+		return 0, nil, false
+	}
+	return txOut.Version, txOut.PkScript, true
+}
+
+// PrevAmount returns the amount for the provided outpoint if the transaction
+// that created it is in the transaction index.
+//
+// This is part of the PrevAmounter interface.
+func (p txIndexPrevScripter) PrevAmount(op *wire.OutPoint) (int64, bool) {
+	txOut, ok := p.prevOutput(op)
+	if !ok {
+		return 0, false
+	}
+	return txOut.Value, true
+}
+
+// PrevTicketOutputs returns the minimal outputs of the ticket purchase that
+// created the provided outpoint if it is in the transaction index.
+//
+// This is part of the PrevTicketOutputer interface.
+func (p txIndexPrevScripter) PrevTicketOutputs(op *wire.OutPoint) ([]*stake.MinimalOutput, bool) {
+	msgTx, ok := p.prevTx(op)
+	if !ok || !stake.IsSStx(msgTx) {
+		return nil, false
+	}
+	return stake.ConvertToMinimalOutputs(msgTx), true
+}
+
+// dbCheckAddrIndexEntries returns a database corruption error when the levels
+// of the provided address key are malformed or contain entries with block IDs
+// that are not in the block ID index.
+func dbCheckAddrIndexEntries(dbTx database.Tx, bucket internalBucket, addrKey [addrKeySize]byte) error {
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			return nil
+		}
+
+		// Level 0 may hold up to its max number of entries while all other
+		// levels must either be half full or completely full.
+		numEntries := len(levelData) / txEntrySize
+		maxEntries, err := maxEntriesForLevel(level)
+		if err != nil {
+			str := fmt.Sprintf("address index level %d for key %x exceeds "+
+				"the maximum level of %d", level, addrKey, maxAddrIndexLevel)
+			return makeDbErr(database.ErrCorruption, str)
+		}
+		validSize := len(levelData)%txEntrySize == 0 && numEntries <= maxEntries
+		if level > 0 && numEntries != maxEntries && numEntries != maxEntries/2 {
+			validSize = false
+		}
+		if !validSize {
+			str := fmt.Sprintf("address index level %d for key %x has an "+
+				"invalid size of %d bytes", level, addrKey, len(levelData))
+			return makeDbErr(database.ErrCorruption, str)
+		}
+
+		for offset := 0; offset < len(levelData); offset += txEntrySize {
+			serializedID := levelData[offset : offset+4]
+			_, err := dbFetchBlockHashBySerializedID(dbTx, serializedID)
+			if err != nil {
+				str := fmt.Sprintf("address index level %d for key %x "+
+					"references unknown block ID %d", level, addrKey,
+					byteOrder.Uint32(serializedID))
+				return makeDbErr(database.ErrCorruption, str)
+			}
+		}
+	}
+}
+
+// RepairCorruptedAddress checks the entries for the passed address for
+// corruption and, when any is detected, rebuilds them.  It returns whether or
+// not the entries were repaired.
+//
+// The entries are rebuilt by deleting all of the levels for the address and
+// reindexing every main chain block referenced by the existing entries.  The
+// previous outputs spent by those blocks are loaded via the transaction index
+// since their spend journal entries might no longer be available.  This
+// localizes recovery to the damaged address instead of requiring the entire
+// index to be dropped and rebuilt.
+//
+// NOTE: Since the blocks to reindex are determined from the existing entries,
+// any transactions whose entries no longer refer to a known block can not be
+// recovered and are removed.  A full reindex is required to restore them.
+//
+// This is a maintenance operation that must be explicitly invoked.  Every
+// repaired address is logged.
+func (idx *AddrIndex) RepairCorruptedAddress(dbTx database.Tx, addr stdaddr.Address) (bool, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return false, err
+	}
+
+	// Nothing to do when the entries are not corrupt.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	err = dbCheckAddrIndexEntries(dbTx, bucket, addrKey)
+	if err == nil {
+		return false, nil
+	}
+	var dbErr database.Error
+	if !errors.As(err, &dbErr) || dbErr.Err != database.ErrCorruption {
+		return false, err
+	}
+	log.Warnf("Repairing address index entries for %s: %v", addr, err)
+	idx.afterCommit(dbTx, func() { idx.pins.invalidate(addrKey) })
+
+	// Determine the main chain blocks referenced by the existing entries
+	// ordered by their height and remove all of the levels.
+	blockHashes := make(map[int64]*chainhash.Hash)
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+		// Include truncated entries that still have a block ID.
+		for offset := 0; offset+4 <= len(levelData); offset += txEntrySize {
+			hash, err := dbFetchBlockHashBySerializedID(dbTx,
+				levelData[offset:offset+4])
+			if err != nil {
+				continue
+			}
+			height, err := idx.chain.BlockHeightByHash(hash)
+			if err != nil {
+				continue
+			}
+			blockHashes[height] = hash
+		}
+		if err := bucket.Delete(levelKey[:]); err != nil {
+			return false, err
+		}
+	}
+	heights := make([]int64, 0, len(blockHashes))
+	for height := range blockHashes {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	// Reindex the address for each of the blocks in order.
+	prevScripts := txIndexPrevScripter{dbTx: dbTx}
+	var numEntries int
+	for _, height := range heights {
+		block, err := idx.chain.BlockByHash(blockHashes[height])
+		if err != nil {
+			return false, err
+		}
+		parentHash := &block.MsgBlock().Header.PrevBlock
+		isTreasuryEnabled, err := idx.chain.IsTreasuryAgendaActive(parentHash)
+		if err != nil {
+			return false, err
+		}
+		txLocs, stakeTxLocs, err := block.TxLoc()
+		if err != nil {
+			return false, err
+		}
+		blockID, err := dbFetchBlockIDByHash(dbTx, block.Hash())
+		if err != nil {
+			return false, err
+		}
+
+		addrsToTxns := make(writeIndexData)
+		idx.indexBlock(addrsToTxns, block, prevScripts, isTreasuryEnabled)
+		txns := addrsToTxns[addrKey]
+		err = dbPutAddrBlockEntries(bucket, addrKey, blockID, txns, txLocs,
+			stakeTxLocs)
+		if err != nil {
+			return false, err
+		}
+		numEntries += len(txns)
+	}
+
+	log.Infof("Repaired address index entries for %s (%d entries from %d "+
+		"blocks)", addr, numEntries, len(heights))
+	return true, nil
+}
+
+// reindexBlock either connects the provided block to or disconnects it from
+// the address index in its own database transaction and updates the tip of the
+// spend consumer accordingly once it is committed.  The previous outputs spent
+// by the block are loaded via the transaction index since their spend journal
+// entries might no longer be available.
+func (idx *AddrIndex) reindexBlock(block *dcrutil.Block, connect bool) error {
+	parentHash := &block.MsgBlock().Header.PrevBlock
+	isTreasuryEnabled, err := idx.chain.IsTreasuryAgendaActive(parentHash)
+	if err != nil {
+		return err
+	}
+
+	return idx.db.Update(func(dbTx database.Tx) error {
+		prevScripts := txIndexPrevScripter{dbTx: dbTx}
+		if connect {
+			err := idx.connectBlock(dbTx, block, nil, prevScripts,
+				isTreasuryEnabled)
+			if err != nil {
+				return err
+			}
+			idx.updateConsumerTip(dbTx, block.Hash())
+			return nil
+		}
+
+		err := idx.disconnectBlock(dbTx, block, nil, prevScripts,
+			isTreasuryEnabled)
+		if err != nil {
+			return err
+		}
+		idx.updateConsumerTip(dbTx, parentHash)
+		return nil
+	})
+}
+
+// ReindexRange rebuilds the entries for the main chain blocks in the provided
+// inclusive range of heights by disconnecting them from the index in reverse
+// order and then connecting them again.  This allows recovering from issues
+// that only affected a known range of blocks without dropping and rebuilding
+// the entire index.
+//
+// Since the entries of each address are only able to be removed starting from
+// the most recent ones, all of the blocks after the end of the range through
+// the current index tip are also reindexed.  The blocks are identified by
+// walking back from the index tip, and the previous outputs spent by them are
+// loaded via the transaction index since their spend journal entries might no
+// longer be available.
+//
+// Each block is disconnected and connected in a separate database transaction,
+// so the index tip always reflects the entries in the index.  Updates to the
+// index delivered via notifications are paused until the reindex completes
+// since they would otherwise not extend the intermediate tips.  When the
+// process is interrupted or fails while disconnecting blocks, the blocks that
+// were already disconnected are connected again so the index is restored to
+// its original tip.  Interruptions are not honored while connecting blocks for
+// the same reason.
+func (idx *AddrIndex) ReindexRange(ctx context.Context, startHeight, endHeight int64) error {
+	idx.lockUpdates()
+	defer idx.unlockUpdates()
+
+	tipHeight, tipHash, err := idx.Tip()
+	if err != nil {
+		return err
+	}
+	if startHeight < 1 || startHeight > endHeight || endHeight > tipHeight {
+		return fmt.Errorf("invalid reindex range [%d, %d] for %s with tip "+
+			"height %d", startHeight, endHeight, idx.Name(), tipHeight)
+	}
+
+	log.Infof("Reindexing %s from height %d through %d (tip height %d)",
+		idx.Name(), startHeight, endHeight, tipHeight)
+
+	// Disconnect the blocks from the current tip back to the start of the
+	// range.
+	disconnected := make([]*dcrutil.Block, 0, tipHeight-startHeight+1)
+	hash := tipHash
+	for height := tipHeight; height >= startHeight; height-- {
+		if interruptRequested(ctx) {
+			err = errInterruptRequested
+			break
+		}
+		var block *dcrutil.Block
+		block, err = idx.chain.BlockByHash(hash)
+		if err != nil {
+			break
+		}
+		if err = idx.reindexBlock(block, false); err != nil {
+			break
+		}
+		disconnected = append(disconnected, block)
+		hash = &block.MsgBlock().Header.PrevBlock
+	}
+
+	// Connect the disconnected blocks again, even when disconnecting them was
+	// interrupted or failed, so the index is restored to its original tip.
+	for i := len(disconnected) - 1; i >= 0; i-- {
+		if err := idx.reindexBlock(disconnected[i], true); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Reindexed %d blocks of %s", len(disconnected), idx.Name())
+	return nil
+}
+
+// buildFromTxIndexBatchSize is the number of blocks BuildFromTxIndex connects
+// to the index in each database transaction.
+const buildFromTxIndexBatchSize = 500
+
+// BuildFromTxIndex builds the address index by walking the blocks known to the
+// transaction index in the order of their internal block IDs and connecting
+// them directly rather than waiting for them to be replayed via notifications.
+// The previous outputs spent by the blocks are loaded via the transaction
+// index.
+//
+// The blocks are connected in batches via the same logic used when connecting
+// blocks individually, so the resulting index is identical to an index built by
+// the normal sync path.  The index tip is updated with each batch, which serves
+// as a checkpoint, so a build that is interrupted or fails partway through
+// resumes from the last batch the next time it is invoked.
+//
+// The index must have been initialized and the build starts from the current
+// index tip, which is the genesis block for a new or dropped index.  It stops
+// once all blocks known to the transaction index have been connected.
+//
+// NOTE: This is a maintenance operation that must not be invoked while the
+// index is being updated with new blocks since the updates would otherwise not
+// extend the intermediate tips and therefore be rejected.
+func (idx *AddrIndex) BuildFromTxIndex(ctx context.Context) error {
+	tipHeight, _, err := idx.Tip()
+	if err != nil {
+		return err
+	}
+	log.Infof("Building %s from the transaction index starting at height %d",
+		idx.Name(), tipHeight)
+
+	numBlocks, err := idx.connectTxIndexBlocks(ctx, buildFromTxIndexBatchSize)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Built %s from the transaction index with %d blocks",
+		idx.Name(), numBlocks)
+	return nil
+}
+
+// connectTxIndexBlocks connects the blocks known to the transaction index after
+// the current index tip in the order of their internal block IDs in batches of
+// the provided size with each batch connected in its own database transaction.
+// It returns the number of blocks that were connected.
+//
+// The index tip is updated along with the entries of each batch, so a batch is
+// either connected in its entirety or not at all and any batches that are not
+// connected due to an interruption or failure are connected again the next time
+// it is invoked.  The tip of the spend consumer is updated once each batch is
+// committed.
+func (idx *AddrIndex) connectTxIndexBlocks(ctx context.Context, batchSize uint32) (int64, error) {
+	var nextID uint32
+	err := idx.db.View(func(dbTx database.Tx) error {
+		tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if tipHeight == 0 {
+			nextID = 1
+			return nil
+		}
+		tipID, err := dbFetchBlockIDByHash(dbTx, tipHash)
+		if err != nil {
+			return err
+		}
+		nextID = tipID + 1
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var numBlocks int64
+	for {
+		if interruptRequested(ctx) {
+			return numBlocks, errInterruptRequested
+		}
+
+		// Load the hashes of the next batch of blocks from the block ID index.
+		var hashes []*chainhash.Hash
+		err := idx.db.View(func(dbTx database.Tx) error {
+			for uint32(len(hashes)) < batchSize {
+				id := nextID + uint32(len(hashes))
+				hash, err := dbFetchBlockHashByID(dbTx, id)
+				if errors.Is(err, errNoBlockIDEntry) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				hashes = append(hashes, hash)
+			}
+			return nil
+		})
+		if err != nil {
+			return numBlocks, err
+		}
+		if len(hashes) == 0 {
+			return numBlocks, nil
+		}
+
+		// Load the blocks and whether the treasury agenda is active for them.
+		blocks := make([]*dcrutil.Block, 0, len(hashes))
+		treasuryEnabled := make([]bool, 0, len(hashes))
+		for _, hash := range hashes {
+			block, err := idx.chain.BlockByHash(hash)
+			if err != nil {
+				return numBlocks, err
+			}
+			isTreasuryEnabled, err := treasuryEnabledForBlock(idx.chain,
+				block)
+			if err != nil {
+				return numBlocks, err
+			}
+			blocks = append(blocks, block)
+			treasuryEnabled = append(treasuryEnabled, isTreasuryEnabled)
+		}
+
+		err = idx.db.Update(func(dbTx database.Tx) error {
+			prevScripts := txIndexPrevScripter{dbTx: dbTx}
+			batch := make([]connectBlockData, 0, len(blocks))
+			for i, block := range blocks {
+				batch = append(batch, connectBlockData{
+					block:             block,
+					prevScripts:       prevScripts,
+					isTreasuryEnabled: treasuryEnabled[i],
+				})
+			}
+			if err := idx.connectBlocks(dbTx, batch); err != nil {
+				return err
+			}
+			idx.updateConsumerTip(dbTx, blocks[len(blocks)-1].Hash())
+			return nil
+		})
+		if err != nil {
+			return numBlocks, err
+		}
+
+		nextID += uint32(len(blocks))
+		numBlocks += int64(len(blocks))
+		tip := blocks[len(blocks)-1]
+		log.Infof("Connected %s through height %d", idx.Name(), tip.Height())
+	}
+}
+
+// dbFetchAllSerializedAddrIndexEntries returns the serialized entries of all
+// levels for the provided address key ordered from oldest to newest.
+func dbFetchAllSerializedAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte) []byte {
+	var serialized []byte
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+
+		// Higher levels contain older transactions, so prepend them.
+		prepended := make([]byte, len(serialized)+len(levelData))
+		copy(prepended, levelData)
+		copy(prepended[len(levelData):], serialized)
+		serialized = prepended
+	}
+	return serialized
+}
+
+// findDuplicateAddrIndexEntries returns the offsets within the passed serialized
+// entries of every entry that refers to the same block region, as identified by
+// its block ID and start offset, as an earlier entry.
+func findDuplicateAddrIndexEntries(serialized []byte) []int {
+	var duplicates []int
+	seen := make(map[[8]byte]struct{}, len(serialized)/txEntrySize)
+	for offset := 0; offset+txEntrySize <= len(serialized); offset +=
+		txEntrySize {
+
+		var region [8]byte
+		copy(region[:], serialized[offset:offset+8])
+		if _, ok := seen[region]; ok {
+			duplicates = append(duplicates, offset)
+			continue
+		}
+		seen[region] = struct{}{}
+	}
+	return duplicates
+}
+
+// DeleteAddress removes all of the entries for the passed address from the
+// address index along with its ticket commitment amounts and totals.  Deleting
+// an address that does not have any entries is not an error.
+//
+// NOTE: The address is indexed again by any blocks that are connected after it
+// is deleted.  Since the entries for the blocks that were already connected are
+// no longer available, disconnecting any of those blocks that involve the
+// address will fail, so callers should only delete addresses whose entries are
+// not subject to reorganization.
+func (idx *AddrIndex) DeleteAddress(dbTx database.Tx, addr stdaddr.Address) error {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	// Remove all of the levels for the address.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	var numRemoved int
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+		if err := bucket.Delete(levelKey[:]); err != nil {
+			return err
+		}
+		numRemoved += len(levelData) / txEntrySize
+	}
+
+	// Remove the ticket commitment amounts for the address.  The keys are
+	// collected first since the bucket must not be modified while it is
+	// being iterated.
+	var commitmentKeys [][]byte
+	commitmentBucket := dbTx.Metadata().Bucket(addrCommitmentIndexKey)
+	cursor := commitmentBucket.Cursor()
+	for ok := cursor.Seek(addrKey[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, addrKey[:]) {
+			break
+		}
+		commitmentKeys = append(commitmentKeys, append([]byte(nil), key...))
+	}
+	for _, key := range commitmentKeys {
+		if err := commitmentBucket.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	// Remove the totals for the address.
+	totalsBucket := dbTx.Metadata().Bucket(addrTotalsIndexKey)
+	if err := totalsBucket.Delete(addrKey[:]); err != nil {
+		return err
+	}
+
+	idx.afterCommit(dbTx, func() {
+		idx.addrFilter.remove(addrKey, numRemoved)
+		idx.pins.invalidate(addrKey)
+		idx.metrics.IncRemovedEntries(numRemoved)
+	})
+	if numRemoved > 0 {
+		log.Infof("Deleted %d address index entries for %s", numRemoved, addr)
+	}
+	return nil
+}
+
+// FindDuplicates returns a slice of details which identify each entry for the
+// passed address that refers to the same transaction as an older entry.  The
+// entries are ordered from oldest to newest and an empty result indicates there
+// are no duplicates.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) FindDuplicates(dbTx database.Tx, addr stdaddr.Address) ([]TxIndexEntry, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	serialized := dbFetchAllSerializedAddrIndexEntries(bucket, addrKey)
+	duplicates := findDuplicateAddrIndexEntries(serialized)
+	if len(duplicates) == 0 {
+		return nil, nil
+	}
+
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+	entries := make([]TxIndexEntry, len(duplicates))
+	for i, offset := range duplicates {
+		err := deserializeAddrIndexEntry(serialized[offset:], &entries[i],
+			fetchBlockHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// RemoveDuplicates removes every entry for the passed address that refers to
+// the same transaction as an older entry and returns the number of entries
+// removed.  The order of the remaining entries is preserved.
+//
+// The levels of the address are rewritten from the remaining entries since
+// removing entries from the levels in place would violate the sizes required by
+// the level-based scheme.
+//
+// This is a maintenance operation that must be explicitly invoked.
+func (idx *AddrIndex) RemoveDuplicates(dbTx database.Tx, addr stdaddr.Address) (int, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nothing to do when there are no duplicates.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	serialized := dbFetchAllSerializedAddrIndexEntries(bucket, addrKey)
+	duplicates := findDuplicateAddrIndexEntries(serialized)
+	if len(duplicates) == 0 {
+		return 0, nil
+	}
+
+	// Remove all of the levels and add the remaining entries back in order.
+	idx.afterCommit(dbTx, func() { idx.pins.invalidate(addrKey) })
+	numRemoved := len(duplicates)
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		if bucket.Get(levelKey[:]) == nil {
+			break
+		}
+		if err := bucket.Delete(levelKey[:]); err != nil {
+			return 0, err
+		}
+	}
+	for offset := 0; offset+txEntrySize <= len(serialized); offset +=
+		txEntrySize {
+
+		if len(duplicates) > 0 && duplicates[0] == offset {
+			duplicates = duplicates[1:]
+			continue
+		}
+
+		entry := serialized[offset : offset+txEntrySize]
+		txLoc := wire.TxLoc{
+			TxStart: int(byteOrder.Uint32(entry[4:8])),
+			TxLen:   int(byteOrder.Uint32(entry[8:12]) & entryTxLenMask),
+		}
+		err := dbPutAddrIndexEntry(bucket, addrKey,
+			byteOrder.Uint32(entry[0:4]), txLoc, byteOrder.Uint32(entry[12:16]))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	log.Infof("Removed %d duplicate address index entries for %s", numRemoved,
+		addr)
+	return numRemoved, nil
+}
+
+// EntriesForAddress returns a slice of details which identify each transaction,
+// including a block region, that involves the passed address according to the
+// specified number to skip, number requested, and whether or not the results
+// should be reversed.  It also returns the number actually skipped since it
+// could be less in the case where there are not enough entries.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
+// that involve a given address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddress(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return nil, 0, nil
+	}
+
+	var entries []TxIndexEntry
+	var skipped uint32
+	err = idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		entries, skipped, err = idx.entriesForAddressKey(dbTx, addrKey,
+			numToSkip, numRequested, reverse)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, skipped, nil
+}
+
+// EntriesForAddressWithDeadline returns a slice of details which identify each
+// transaction, including a block region, that involves the passed address
+// according to the specified number to skip, number requested, and whether or
+// not the results should be reversed along with the number actually skipped
+// the same as EntriesForAddress, except that it stops loading the entries once
+// the provided deadline is reached.  In that case, the entries loaded so far
+// are returned along with true to indicate the results were truncated.
+//
+// This allows callers with a latency budget, such as RPC servers, to respond
+// with partial results for addresses with a large number of entries instead
+// of failing the request.  The deadline is only checked periodically while the
+// levels that house the entries are loaded and the entries are deserialized
+// and marked, so it may be exceeded by a small amount.  The results are
+// truncated to no entries when the deadline is reached before all of the
+// needed levels are loaded, such as when it has already passed.
+//
+// The entries are loaded using the provided database transaction.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
+// that involve a given address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressWithDeadline(dbTx database.Tx, addr stdaddr.Address, deadline time.Time, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, bool, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return nil, 0, false, nil
+	}
+
+	return idx.entriesForAddressKeyUntil(dbTx, addrKey, deadline, numToSkip,
+		numRequested, reverse)
+}
+
+// EntriesForAddressAtTip returns a slice of details which identify each
+// transaction, including a block region, that involves the passed address
+// according to the specified number to skip, number requested, and whether or
+// not the results should be reversed along with the number actually skipped
+// and the height and hash of the index tip the results reflect.
+//
+// Unlike reading the tip via Tip and then querying the entries via
+// EntriesForAddress, the tip and the entries are both read using the provided
+// database transaction, so the reported tip is guaranteed to be consistent
+// with the returned entries even when blocks are connected or disconnected
+// concurrently.  This is useful for callers that display the results as of a
+// given block.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
+// that involve a given address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressAtTip(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, int64, *chainhash.Hash, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	// Note that the address filter is intentionally not consulted since it
+	// reflects the latest state of the index which might differ from the
+	// state visible to the database transaction.
+	entries, skipped, err := idx.entriesForAddressKey(dbTx, addrKey,
+		numToSkip, numRequested, reverse)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	return entries, skipped, int64(tipHeight), tipHash, nil
+}
+
+// fetchBlockHeightFunc defines a callback function to use in order to convert a
+// serialized block ID to the height of the associated block.
+type fetchBlockHeightFunc func(serializedID []byte) (int64, error)
+
+// dbFetchAddrIndexEntriesSinceHeight returns all of the entries for the
+// provided address key that are in blocks above the provided height ordered
+// from oldest to newest.
+//
+// Since the entries are ordered by height and level 0 houses the newest
+// entries, the levels are walked from level 0 outward and the walk stops at
+// the first level that contains an entry at or below the provided height, so
+// the older levels are never loaded.  Only the heights of the entries probed by
+// a binary search for the boundary within each loaded level are resolved.
+func dbFetchAddrIndexEntriesSinceHeight(bucket internalBucket, addrKey [addrKeySize]byte, sinceHeight int64, fetchBlockHash fetchBlockHashFunc, fetchBlockHeight fetchBlockHeightFunc) ([]TxIndexEntry, error) {
+	// Collect the portions of each level that are above the height ordered
+	// from the lowest (newest) level to the highest (oldest) level.
+	var levels [][]byte
+	var numEntries int
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+
+		var searchErr error
+		numLevelEntries := len(levelData) / txEntrySize
+		boundary := sort.Search(numLevelEntries, func(i int) bool {
+			if searchErr != nil {
+				return true
+			}
+			offset := i * txEntrySize
+			height, err := fetchBlockHeight(levelData[offset : offset+4])
+			if err != nil {
+				searchErr = err
+				return true
+			}
+			return height > sinceHeight
+		})
+		if searchErr != nil {
+			return nil, searchErr
+		}
+		end := numLevelEntries * txEntrySize
+		levels = append(levels, levelData[boundary*txEntrySize:end])
+		numEntries += numLevelEntries - boundary
+
+		// All entries in the higher levels are older than the boundary.
+		if boundary > 0 {
+			break
+		}
+	}
+
+	// Decode the entries starting with the oldest ones.
+	entries := make([]TxIndexEntry, 0, numEntries)
+	for i := len(levels) - 1; i >= 0; i-- {
+		levelData := levels[i]
+		for offset := 0; offset+txEntrySize <= len(levelData); offset +=
+			txEntrySize {
+
+			var entry TxIndexEntry
+			err := deserializeAddrIndexEntry(levelData[offset:], &entry,
+				fetchBlockHash)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// EntriesForAddressSinceHeight returns a slice of details which identify each
+// transaction, including a block region, that involves the passed address in
+// a block above the provided height ordered from oldest to newest.
+//
+// This is much cheaper than querying all of the entries for addresses with a
+// long history since only the levels that house entries above the height are
+// loaded.  It is primarily useful for callers such as wallets that have already
+// processed the entries up to a given height.
+//
+// The entries are read using the provided database transaction and, unlike
+// EntriesForAddress, the address filter is not consulted since it reflects the
+// latest state of the index which might differ from the state visible to the
+// transaction.  An error is returned when an entry that needs its height
+// resolved refers to a block that is no longer in the main chain.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
+// that involve a given address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressSinceHeight(dbTx database.Tx, addr stdaddr.Address, sinceHeight int64) ([]TxIndexEntry, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+	fetchBlockHeight := func(id []byte) (int64, error) {
+		return idx.blockHeightBySerializedID(dbTx, id)
+	}
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	entries, err := dbFetchAddrIndexEntriesSinceHeight(bucket, addrKey,
+		sinceHeight, fetchBlockHash, fetchBlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	idx.markDisapprovedEntries(dbTx, entries)
+	if err := idx.markEntryInputs(dbTx, addrKey, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// addrIndexEncodedEntrySize is the number of bytes each entry in the compact
+// encoding produced by EntriesForAddressEncoded consumes.
+const addrIndexEncodedEntrySize = chainhash.HashSize + 12
+
+// encodeAddrIndexEntries encodes the entries referenced by the provided
+// serialized entries for the given address key, which must be ordered from
+// oldest to newest, according to the provided number to skip, number requested,
+// and whether or not the results should be reversed into the compact format
+// described by EntriesForAddressEncoded.  It also returns the number of entries
+// skipped since it could have been less in the case where there are less total
+// entries than the requested number of entries to skip.
+//
+// The entries are written directly from the serialized entries without
+// deserializing them and the block hash of the most recent block ID is cached
+// since entries for the same block are often adjacent.
+func encodeAddrIndexEntries(serialized []byte, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, fetchBlockHash fetchBlockHashFunc) ([]byte, uint32, error) {
+	// Limit the number to encode based on the number of available entries,
+	// the number to skip, and the number requested.
+	numEntries := uint32(len(serialized) / txEntrySize)
+	if numToSkip > numEntries {
+		numToSkip = numEntries
+	}
+	numToEncode := numEntries - numToSkip
+	if numToEncode > numRequested {
+		numToEncode = numRequested
+	}
+
+	encoded := make([]byte, 4+int(numToEncode)*addrIndexEncodedEntrySize)
+	byteOrder.PutUint32(encoded, numToEncode)
+	var lastID []byte
+	var lastHash *chainhash.Hash
+	for i := uint32(0); i < numToEncode; i++ {
+		// Calculate the read offset according to the reverse flag.
+		var offset uint32
+		if reverse {
+			offset = (numEntries - numToSkip - i - 1) * txEntrySize
+		} else {
+			offset = (numToSkip + i) * txEntrySize
+		}
+		entry := serialized[offset : offset+txEntrySize]
+
+		// Ensure the entry was serialized with a supported version.
+		txLen, version := decodeEntryTxLen(byteOrder.Uint32(entry[8:12]))
+		if version != entryVersionLegacy && version != entryVersion {
+			str := fmt.Sprintf("failed to deserialized address index for "+
+				"key %x: unsupported entry version %d", addrKey, version)
+			return nil, 0, makeDbErr(database.ErrCorruption, str)
+		}
+
+		if !bytes.Equal(entry[0:4], lastID) {
+			hash, err := fetchBlockHash(entry[0:4])
+			if err != nil {
+				return nil, 0, err
+			}
+			lastID, lastHash = entry[0:4], hash
+		}
+
+		out := encoded[4+int(i)*addrIndexEncodedEntrySize:]
+		copy(out, lastHash[:])
+		copy(out[chainhash.HashSize:], entry[4:8])
+		byteOrder.PutUint32(out[chainhash.HashSize+4:], txLen)
+		copy(out[chainhash.HashSize+8:], entry[12:16])
+	}
+	return encoded, numToSkip, nil
+}
+
+// EntriesForAddressEncoded returns the same entries as EntriesForAddress for
+// the specified number to skip, number requested, and whether or not the
+// results should be reversed in a compact binary form that is suitable for
+// binary transports along with the number actually skipped.
+//
+// The entries are encoded directly from their stored form without creating
+// any intermediate TxIndexEntry values, which makes this considerably cheaper
+// than encoding the results of EntriesForAddress for services that serve a
+// high volume of queries.
+//
+// The encoded format is:
+//
+//	<num entries>[<block hash><offset><length><block index and flags>,...]
+//
+//	Field                  Type            Size
+//	num entries            uint32          4 bytes
+//	block hash             chainhash.Hash  32 bytes
+//	offset                 uint32          4 bytes
+//	length                 uint32          4 bytes
+//	block index and flags  uint32          4 bytes
+//	-----
+//	Total: 4 bytes + 44 bytes per entry
+//
+// All integers are encoded in little endian.  The offset and length identify
+// the region of the transaction within the block identified by the block hash
+// and the block index and flags field has the same layout as the field of the
+// stored entries which is described by EntryLayout.
+//
+// The entries are read using the provided database transaction.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
+// that involve a given address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressEncoded(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]byte, uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return encodeAddrIndexEntries(nil, addrKey, numToSkip, numRequested,
+			reverse, nil)
+	}
+
+	serialized, err := idx.serializedEntriesForAddressKey(dbTx, addrKey,
+		numToSkip, numRequested, reverse)
+	if err != nil {
+		return nil, 0, err
+	}
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+	encoded, skipped, err := encodeAddrIndexEntries(serialized, addrKey,
+		numToSkip, numRequested, reverse, fetchBlockHash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	idx.metrics.ObserveEntriesFetched(int(byteOrder.Uint32(encoded)))
+	return encoded, skipped, nil
+}
+
+// The following constants identify the types of the raw hashes accepted by
+// EntriesForHash160.  The public key types are only distinguished from their
+// public key hash variants when the index uses the extended key mode.
+const (
+	// AddrTypePubKeyHash identifies the hash of a secp256k1 public key for
+	// ECDSA signatures.
+	AddrTypePubKeyHash uint8 = addrKeyTypePubKeyHash
+
+	// AddrTypePubKeyHashEd25519 identifies the hash of an Ed25519 public key.
+	AddrTypePubKeyHashEd25519 uint8 = addrKeyTypePubKeyHashEdwards
+
+	// AddrTypePubKeyHashSchnorr identifies the hash of a secp256k1 public key
+	// for Schnorr signatures.
+	AddrTypePubKeyHashSchnorr uint8 = addrKeyTypePubKeyHashSchnorr
+
+	// AddrTypeScriptHash identifies the hash of a script.
+	AddrTypeScriptHash uint8 = addrKeyTypeScriptHash
+
+	// AddrTypePubKey, AddrTypePubKeyEd25519, and AddrTypePubKeySchnorr
+	// identify the hashes of payments made directly to the respective public
+	// keys rather than to their hashes.
+	AddrTypePubKey        uint8 = addrKeyTypePubKey
+	AddrTypePubKeyEd25519 uint8 = addrKeyTypePubKeyEdwards
+	AddrTypePubKeySchnorr uint8 = addrKeyTypePubKeySchnorr
+)
+
+// addrTypeNames maps the names accepted by ParseAddrType to the AddrType
+// constants they identify.
+var addrTypeNames = map[string]uint8{
+	"pubkeyhash":        AddrTypePubKeyHash,
+	"pubkeyhashed25519": AddrTypePubKeyHashEd25519,
+	"pubkeyhashschnorr": AddrTypePubKeyHashSchnorr,
+	"scripthash":        AddrTypeScriptHash,
+}
+
+// ParseAddrType returns the AddrType constant identified by the provided name,
+// which is one of "pubkeyhash", "pubkeyhashed25519", "pubkeyhashschnorr", or
+// "scripthash".  It is primarily intended to allow the address types to index
+// via AddrIndexConfig to be specified by name, such as in configuration files.
+// ErrUnsupportedAddressType is returned for unknown names.
+func ParseAddrType(name string) (uint8, error) {
+	addrType, ok := addrTypeNames[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedAddressType, name)
+	}
+	return addrType, nil
+}
+
+// keyForHash160 converts the provided address type, which must be one of the
+// AddrType constants, and hash to an address key for the key mode used by the
+// index.  An error is returned for unsupported types.
+//
+// Similar to keyForAddr, the public key types are converted to their public key
+// hash variants in the standard key mode.
+func (idx *AddrIndex) keyForHash160(addrType uint8, hash160 *[20]byte) ([addrKeySize]byte, error) {
+	var addrKey [addrKeySize]byte
+	switch addrType {
+	case AddrTypePubKeyHash, AddrTypePubKeyHashEd25519,
+		AddrTypePubKeyHashSchnorr, AddrTypeScriptHash:
+
+		addrKey[0] = addrType
+
+	case AddrTypePubKey, AddrTypePubKeyEd25519, AddrTypePubKeySchnorr:
+		addrKey[0] = addrType
+		if !idx.extendedKeys {
+			addrKey[0] -= addrKeyTypePubKeyOffset
+		}
+
+	default:
+		return addrKey, ErrUnsupportedAddressType
+	}
+	copy(addrKey[1:], hash160[:])
+	return addrKey, nil
+}
+
+// EntriesForHash160 returns a slice of details which identify each transaction,
+// including a block region, that involves the address identified by the passed
+// address type and hash according to the specified number to skip, number
+// requested, and whether or not the results should be reversed.  It also
+// returns the number actually skipped since it could be less in the case where
+// there are not enough entries.
+//
+// This is the same as EntriesForAddress except it allows callers that only
+// have the raw hash of an address, such as those that interoperate with systems
+// that store raw hashes, to query its entries without constructing an address.
+// The address type must be one of the AddrType constants, otherwise an error
+// indicating the address type is not supported is returned.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForHash160(dbTx database.Tx, addrType uint8, hash160 [20]byte, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	addrKey, err := idx.keyForHash160(addrType, &hash160)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return nil, 0, nil
+	}
+
+	return idx.entriesForAddressKey(dbTx, addrKey, numToSkip, numRequested,
+		reverse)
+}
+
+// PinAddress adds the passed address to the set of addresses whose entries are
+// cached in memory so that queries for them, such as EntriesForAddress, are
+// served without loading and merging all of their levels from the database.
+// This is intended for addresses that are queried frequently and have many
+// entries, such as faucet and exchange hot wallet addresses.
+//
+// All of the entries of the address are loaded into the cache by the first
+// query after it is pinned and whenever they are modified by connecting or
+// disconnecting a block that involves it.  Pinning an address that is already
+// pinned has no effect.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) PinAddress(addr stdaddr.Address) error {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return err
+	}
+	idx.pins.pin(addrKey)
+	return nil
+}
+
+// UnpinAddress removes the passed address from the set of addresses whose
+// entries are cached in memory along with its cached entries.  Unpinning an
+// address that is not pinned has no effect.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnpinAddress(addr stdaddr.Address) error {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return err
+	}
+	idx.pins.unpin(addrKey)
+	return nil
+}
+
+// BlockIDsForAddress returns the internal block IDs of the blocks that contain
+// each transaction that involves the passed address according to the specified
+// number to skip, number requested, and whether or not the results should be
+// reversed.  The block IDs are in the same order as the entries returned by
+// EntriesForAddress for the same parameters.
+//
+// Unlike EntriesForAddress, the block IDs are not resolved to block hashes,
+// which allows callers that maintain their own cache of them to resolve them
+// in a single batch.  Note that there is a block ID for every entry, so the
+// same block ID is repeated for each transaction in the same block.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) BlockIDsForAddress(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return nil, nil
+	}
+
+	addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
+	blockIDs := dbFetchAddrIndexBlockIDs(addrIdxBucket, addrKey, numToSkip,
+		numRequested, reverse)
+	return blockIDs, nil
+}
+
+// ActiveBlockHeights returns the distinct heights of the blocks that contain
+// transactions that involve the passed address in ascending order.  Multiple
+// transactions in the same block only result in a single height.
+//
+// This is cheaper than loading all of the entries via EntriesForAddress when
+// only block-level granularity is needed since the block of each entry is only
+// resolved when it differs from the block of the previous entry.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) ActiveBlockHeights(dbTx database.Tx, addr stdaddr.Address) ([]int64, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// There are no entries for addresses that are not in the address filter.
+	if !idx.addrFilter.mayContain(addrKey) {
+		return nil, nil
+	}
+
+	// The entries are ordered from oldest to newest and all of the entries
+	// for the same block are adjacent, so only resolve the height of each
+	// entry when its block ID differs from the previous one.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	serialized := dbFetchAllSerializedAddrIndexEntries(bucket, addrKey)
+	var heights []int64
+	var prevBlockID []byte
+	for offset := 0; offset+txEntrySize <= len(serialized); offset +=
+		txEntrySize {
+
+		blockID := serialized[offset : offset+4]
+		if prevBlockID != nil && bytes.Equal(blockID, prevBlockID) {
+			continue
+		}
+		prevBlockID = blockID
+
+		height, err := idx.blockHeightBySerializedID(dbTx, blockID)
+		if err != nil {
+			return nil, err
+		}
+		if len(heights) > 0 && heights[len(heights)-1] == height {
+			continue
+		}
+		heights = append(heights, height)
+	}
+	return heights, nil
+}
+
+// entriesForAddressKey returns the entries for the passed address key using the
+// provided database transaction according to the specified number to skip,
+// number requested, and whether or not the results should be reversed.  It also
+// returns the number actually skipped.
+func (idx *AddrIndex) entriesForAddressKey(dbTx database.Tx, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	entries, skipped, _, err := idx.entriesForAddressKeyUntil(dbTx, addrKey,
+		time.Time{}, numToSkip, numRequested, reverse)
+	return entries, skipped, err
+}
+
+// entriesForAddressKeyUntil is identical to entriesForAddressKey except that
+// it stops deserializing the entries once the provided deadline is reached and
+// returns the entries deserialized so far along with true to indicate the
+// results were truncated.  A zero deadline disables it.
+func (idx *AddrIndex) entriesForAddressKeyUntil(dbTx database.Tx, addrKey [addrKeySize]byte, deadline time.Time, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, bool, error) {
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		// Deserialize and populate the result.
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	serialized, truncated, err := idx.serializedEntriesForAddressKeyUntil(
+		dbTx, addrKey, numToSkip, numRequested, reverse, deadline)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if truncated {
+		idx.metrics.ObserveEntriesFetched(0)
+		return nil, 0, true, nil
+	}
+	entries, skipped, truncated, err := deserializeAddrIndexEntriesUntil(
+		serialized, addrKey, numToSkip, numRequested, reverse, deadline,
+		fetchBlockHash)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	// Only return the entries that were marked before the deadline was
+	// reached, if any.
+	numMarked := idx.markDisapprovedEntriesUntil(dbTx, entries, deadline)
+	numMarked, err = idx.markEntryInputsUntil(dbTx, addrKey,
+		entries[:numMarked], deadline)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if numMarked < len(entries) {
+		entries, truncated = entries[:numMarked], true
+	}
+
+	idx.metrics.ObserveEntriesFetched(len(entries))
+	return entries, skipped, truncated, nil
+}
+
+// serializedEntriesForAddressKey returns the serialized entries for the passed
+// address key that are needed to satisfy the provided number to skip and
+// number requested ordered from oldest to newest.  See
+// dbFetchSerializedAddrIndexLevels for details.
+//
+// The entries of pinned addresses are served from the pin cache, loading all
+// of their entries into it as needed.
+//
+// The returned data MUST NOT be modified.
+func (idx *AddrIndex) serializedEntriesForAddressKey(dbTx database.Tx, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool) ([]byte, error) {
+	serialized, _, err := idx.serializedEntriesForAddressKeyUntil(dbTx,
+		addrKey, numToSkip, numRequested, reverse, time.Time{})
+	return serialized, err
+}
+
+// serializedEntriesForAddressKeyUntil is identical to
+// serializedEntriesForAddressKey except that it stops loading the entries once
+// the provided deadline is reached and returns true to indicate they were
+// truncated.  No entries are returned in that case.  See
+// dbFetchSerializedAddrIndexLevelsUntil for details.
+func (idx *AddrIndex) serializedEntriesForAddressKeyUntil(dbTx database.Tx, addrKey [addrKeySize]byte, numToSkip, numRequested uint32, reverse bool, deadline time.Time) ([]byte, bool, error) {
+	tipHash, _, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return nil, false, err
+	}
+	addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
+	serialized, pinned, cached := idx.pins.lookup(addrKey, tipHash)
+	if !pinned {
+		serialized, truncated := dbFetchSerializedAddrIndexLevelsUntil(
+			addrIdxBucket, addrKey, numToSkip, numRequested, reverse,
+			deadline)
+		return serialized, truncated, nil
+	}
+	if !cached {
+		// Loading all of the entries of a pinned address is only started
+		// before the deadline is reached so the pin cache is always
+		// populated with all of them.
+		if deadlineReached(deadline) {
+			return nil, true, nil
+		}
+		serialized = dbFetchAllSerializedAddrIndexEntries(addrIdxBucket,
+			addrKey)
+		idx.pins.store(addrKey, tipHash, serialized)
+	}
+	return serialized, false, nil
+}
+
+// TxIndexEntryWithHash houses the details which identify a transaction in an
+// address index entry along with the hash of the transaction.
+type TxIndexEntryWithHash struct {
+	TxIndexEntry
+
+	// TxHash is the hash of the transaction identified by the entry.
+	TxHash chainhash.Hash
+}
+
+// EntriesWithTxHashForAddress returns a slice of details which identify each
+// transaction, including a block region and the transaction hash, that
+// involves the passed address according to the specified number to skip,
+// number requested, and whether or not the results should be reversed.  It
+// also returns the number actually skipped since it could be less in the case
+// where there are not enough entries.
+//
+// The hashes are resolved by loading the serialized transactions from the
+// block regions of the entries, which is more expensive than only fetching the
+// entries.  Callers that do not need the hashes should use EntriesForAddress
+// instead.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesWithTxHashForAddress(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntryWithHash, uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, skipped, err := idx.entriesForAddressKey(dbTx, addrKey,
+		numToSkip, numRequested, reverse)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return nil, skipped, nil
+	}
+
+	// Load the serialized transactions for all of the entries at once and
+	// hash them.
+	regions := make([]database.BlockRegion, len(entries))
+	for i := range entries {
+		regions[i] = entries[i].BlockRegion
+	}
+	serializedTxns, err := dbTx.FetchBlockRegions(regions)
+	if err != nil {
+		return nil, 0, err
+	}
+	results := make([]TxIndexEntryWithHash, len(entries))
+	for i, serializedTx := range serializedTxns {
+		var msgTx wire.MsgTx
+		if err := msgTx.FromBytes(serializedTx); err != nil {
+			str := fmt.Sprintf("failed to deserialize transaction at %s:%d "+
+				"referenced by address index entry: %v", regions[i].Hash,
+				regions[i].Offset, err)
+			return nil, 0, makeDbErr(database.ErrCorruption, str)
+		}
+		results[i] = TxIndexEntryWithHash{
+			TxIndexEntry: entries[i],
+			TxHash:       msgTx.TxHash(),
+		}
+	}
+	return results, skipped, nil
+}
+
+// TxIndexEntryWithConfirmations houses the details which identify a
+// transaction in an address index entry along with the number of
+// confirmations the transaction has as of the current best chain tip.
+type TxIndexEntryWithConfirmations struct {
+	TxIndexEntry
+
+	// Confirmations is the number of confirmations the transaction has.  It
+	// is one for transactions in the current best block.
+	Confirmations int64
+}
+
+// EntriesWithConfirmations returns a slice of details which identify each
+// transaction, including a block region and the number of confirmations, that
+// involves the passed address according to the specified number to skip,
+// number requested, and whether or not the results should be reversed.  It
+// also returns the number actually skipped since it could be less in the case
+// where there are not enough entries.
+//
+// The number of confirmations is calculated against the current best height
+// of the chain.  An error is returned when an entry refers to a block that is
+// no longer in the main chain, such as when the index has not yet processed a
+// reorganization.
+//
+// NOTE: These results only include transactions confirmed in blocks.  See the
+// UnconfirmedTxnsWithConfirmations method for obtaining unconfirmed
+// transactions that involve a given address in the same form.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesWithConfirmations(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntryWithConfirmations, uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries, skipped, err := idx.entriesForAddressKey(dbTx, addrKey,
+		numToSkip, numRequested, reverse)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(entries) == 0 {
+		return nil, skipped, nil
+	}
+
+	// Resolve the height of each referenced block only once since entries
+	// for the same block are adjacent.
+	bestHeight, _ := idx.chain.Best()
+	results := make([]TxIndexEntryWithConfirmations, len(entries))
+	var prevHash *chainhash.Hash
+	var height int64
+	for i := range entries {
+		hash := entries[i].BlockRegion.Hash
+		if prevHash == nil || *hash != *prevHash {
+			height, err = idx.chain.BlockHeightByHash(hash)
+			if err != nil {
+				return nil, 0, err
+			}
+			prevHash = hash
+		}
+
+		var confirmations int64
+		if height <= bestHeight {
+			confirmations = bestHeight - height + 1
+		}
+		results[i] = TxIndexEntryWithConfirmations{
+			TxIndexEntry:  entries[i],
+			Confirmations: confirmations,
+		}
+	}
+	return results, skipped, nil
+}
+
+// FetchTx loads and returns the transaction identified by the block region of
+// the passed entry, such as one returned by EntriesForAddress.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) FetchTx(dbTx database.Tx, entry TxIndexEntry) (*wire.MsgTx, error) {
+	region := &entry.BlockRegion
+	if region.Hash == nil {
+		return nil, AssertError("FetchTx called with an entry that does not " +
+			"have a block hash")
+	}
+	serializedTx, err := dbTx.FetchBlockRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	var msgTx wire.MsgTx
+	if err := msgTx.FromBytes(serializedTx); err != nil {
+		str := fmt.Sprintf("failed to deserialize transaction at %s:%d "+
+			"referenced by address index entry: %v", region.Hash,
+			region.Offset, err)
+		return nil, makeDbErr(database.ErrCorruption, str)
+	}
+	return &msgTx, nil
+}
+
+// EntriesForAddressByTree returns a slice of details which identify each
+// transaction in the provided tree, including a block region, that involves the
+// passed address according to the specified number to skip, number requested,
+// and whether or not the results should be reversed.  It also returns the
+// number actually skipped since it could be less in the case where there are
+// not enough entries.
+//
+// The tree must be wire.TxTreeRegular, wire.TxTreeStake, or wire.TxTreeUnknown.
+// The latter selects the entries created by versions of the index prior to
+// version 3 which did not track the tree.  The number to skip and number
+// requested only apply to the entries in the provided tree.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressByTree(dbTx database.Tx, addr stdaddr.Address, tree int8, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	switch tree {
+	case wire.TxTreeRegular, wire.TxTreeStake, wire.TxTreeUnknown:
+	default:
+		return nil, 0, fmt.Errorf("invalid transaction tree %d", tree)
+	}
+
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// Only include entries with matching tree flags.
+	wantTreeFlags := encodeEntryTree(tree)
+	filter := func(serialized []byte) bool {
+		blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+		return blockIndexFlags&entryTreeMask == wantTreeFlags
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return dbFetchFilteredAddrIndexEntries(bucket, addrKey, numToSkip,
+		numRequested, reverse, filter, fetchBlockHash)
+}
+
+// EntriesForAddressByStakeTags returns a slice of details which identify each
+// transaction that pays the passed address via a stake output with any of the
+// provided stake tags, including a block region, according to the specified
+// number to skip, number requested, and whether or not the results should be
+// reversed.  It also returns the number actually skipped since it could be less
+// in the case where there are not enough entries.
+//
+// The number to skip and number requested only apply to the entries with
+// matching tags.  Entries created by versions of the index prior to version 3
+// do not have any tags and are therefore never included.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressByStakeTags(dbTx database.Tx, addr stdaddr.Address, tags StakeTag, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	if tags == 0 {
+		return nil, 0, errors.New("no stake tags specified")
+	}
+
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// Only include entries with any of the requested stake tags.
+	wantTagFlags := encodeEntryStakeTags(tags)
+	filter := func(serialized []byte) bool {
+		blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+		return blockIndexFlags&wantTagFlags != 0
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return dbFetchFilteredAddrIndexEntries(bucket, addrKey, numToSkip,
+		numRequested, reverse, filter, fetchBlockHash)
+}
+
+// EntriesForAddressByClass returns a slice of details which identify each
+// transaction of the provided class that involves the passed address, including
+// a block region, according to the specified number to skip, number requested,
+// and whether or not the results should be reversed.  It also returns the
+// number actually skipped since it could be less in the case where there are
+// not enough entries.
+//
+// The number to skip and number requested only apply to the entries of the
+// requested class.  Entries created by versions of the index prior to version 3
+// only have the TxClassUnknown class.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressByClass(dbTx database.Tx, addr stdaddr.Address, class TxClass, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	if class > TxClassTreasuryBase {
+		return nil, 0, fmt.Errorf("unknown transaction class %d", class)
+	}
+
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// Only include entries with the requested class.
+	filter := func(serialized []byte) bool {
+		blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+		return decodeEntryTxClass(blockIndexFlags) == class
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return dbFetchFilteredAddrIndexEntries(bucket, addrKey, numToSkip,
+		numRequested, reverse, filter, fetchBlockHash)
+}
+
+// EntriesForAddressByOutputKind returns a slice of details which identify each
+// transaction that pays the passed address via outputs of the provided kind as
+// determined by the change heuristic, including a block region, according to
+// the specified number to skip, number requested, and whether or not the
+// results should be reversed.  It also returns the number actually skipped
+// since it could be less in the case where there are not enough entries.
+//
+// The number to skip and number requested only apply to the entries of the
+// requested kind.  See OutputKind for details regarding the rule used to
+// determine the kind.  Entries are only tagged when the index is configured
+// with the change heuristic, so all entries have the OutputKindUnknown kind
+// otherwise.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressByOutputKind(dbTx database.Tx, addr stdaddr.Address, kind OutputKind, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	if kind > OutputKindChange {
+		return nil, 0, fmt.Errorf("unknown output kind %d", kind)
+	}
+
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// Only include entries with the requested output kind.
+	filter := func(serialized []byte) bool {
+		blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+		return decodeEntryOutputKind(blockIndexFlags) == kind
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return dbFetchFilteredAddrIndexEntries(bucket, addrKey, numToSkip,
+		numRequested, reverse, filter, fetchBlockHash)
+}
+
+// CreditsForAddress returns a slice of details which identify each transaction
+// with an output that pays the passed address, including a block region,
+// according to the specified number to skip, number requested, and whether or
+// not the results should be reversed.  It also returns the number actually
+// skipped since it could be less in the case where there are not enough
+// entries.  Transactions that only involve the address because they spend
+// outputs that pay to it, as well as ticket purchases that only commit to it,
+// are excluded.
+//
+// The number to skip and number requested only apply to the entries that
+// credit the address.  This relies on the credit flags persisted with the
+// entries, so ErrCreditFlagsUnavailable is returned when the index is not
+// configured with the CreditFlags option.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) CreditsForAddress(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	if !idx.creditFlags {
+		return nil, 0, ErrCreditFlagsUnavailable
+	}
+
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// Only include entries that credit the address.
+	filter := func(serialized []byte) bool {
+		return decodeEntryCredit(byteOrder.Uint32(serialized[12:16]))
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return dbFetchFilteredAddrIndexEntries(bucket, addrKey, numToSkip,
+		numRequested, reverse, filter, fetchBlockHash)
+}
+
+// EntriesForAddressByTime returns a slice of details which identify each
+// transaction, including a block region, that involves the passed address in a
+// block with a timestamp at or after the provided start time and before the
+// provided end time, both of which are in seconds since the Unix epoch,
+// according to the specified number to skip, number requested, and whether or
+// not the results should be reversed.  It also returns the number actually
+// skipped since it could be less in the case where there are not enough
+// entries.
+//
+// The number to skip and number requested only apply to the entries in the
+// requested time range.  Note that the filter uses the timestamps stored in the
+// block headers as opposed to a mapping derived from block heights.  Since
+// block timestamps are not strictly increasing with height, the matching
+// entries are not necessarily contiguous.
+//
+// The stored timestamps are used when available.  Otherwise, they are loaded
+// from the block headers and also stored for future queries when the provided
+// database transaction is writable.  See AddrIndexConfig.StoreBlockTimes for
+// details.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressByTime(dbTx database.Tx, addr stdaddr.Address, startUnix, endUnix int64, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	// blockTimeByID returns the timestamp of the block associated with the
+	// provided serialized block ID.  The timestamps are cached since multiple
+	// entries commonly reference the same block.
+	times := make(map[uint32]int64)
+	blockTimeByID := func(serializedID []byte) (int64, error) {
+		id := byteOrder.Uint32(serializedID)
+		if timestamp, ok := times[id]; ok {
+			return timestamp, nil
+		}
+		hash, err := dbFetchBlockHashBySerializedID(dbTx, serializedID)
+		if err != nil {
+			return 0, err
+		}
+		timestamp, ok := dbFetchAddrBlockTime(dbTx, hash)
+		if !ok {
+			header, err := idx.chain.BlockHeaderByHash(hash)
+			if err != nil {
+				return 0, err
+			}
+			timestamp = header.Timestamp.Unix()
+			if dbTx.Metadata().Writable() {
+				err := dbPutAddrBlockTime(dbTx, hash, timestamp)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+		times[id] = timestamp
+		return timestamp, nil
+	}
+
+	// Only include entries in blocks within the requested time range.  The
+	// first error encountered while determining a timestamp is recorded since
+	// the filter is not able to return it.
+	var filterErr error
+	filter := func(serialized []byte) bool {
+		if filterErr != nil {
+			return false
+		}
+		timestamp, err := blockTimeByID(serialized[0:4])
+		if err != nil {
+			filterErr = err
+			return false
+		}
+		return timestamp >= startUnix && timestamp < endUnix
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	entries, skipped, err := dbFetchFilteredAddrIndexEntries(bucket, addrKey,
+		numToSkip, numRequested, reverse, filter, fetchBlockHash)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filterErr != nil {
+		return nil, 0, filterErr
+	}
+	return entries, skipped, nil
+}
+
+// EntriesForAddressPage returns up to the requested number of details which
+// identify each transaction, including a block region, that involves the passed
+// address starting at the position identified by the provided opaque page
+// cursor along with the cursor for the next page.  The entries are ordered from
+// oldest to newest unless the reverse flag is set.
+//
+// A nil cursor requests the first page and a nil next cursor signals there are
+// no more entries.  Unlike paging with EntriesForAddress, each page only
+// requires loading the levels that house its entries, and cursors for the
+// reverse direction remain valid as new entries are added without causing the
+// levels to be merged.  ErrInvalidPageCursor is returned when the cursor does
+// not refer to the same entry it did when it was created, in which case paging
+// must be restarted.
+//
+// NOTE: These results only include transactions confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntriesForAddressPage(dbTx database.Tx, addr stdaddr.Address, cursor []byte, numRequested uint32, reverse bool) ([]TxIndexEntry, []byte, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create closure to lookup the block hash given the ID using the
+	// database transaction.
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	entries, nextCursor, err := dbFetchAddrIndexEntriesPage(bucket, addrKey,
+		cursor, numRequested, reverse, fetchBlockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx.markDisapprovedEntries(dbTx, entries)
+	if err := idx.markEntryInputs(dbTx, addrKey, entries); err != nil {
+		return nil, nil, err
+	}
+
+	idx.metrics.ObserveEntriesFetched(len(entries))
+	return entries, nextCursor, nil
+}
+
+// HasAddress returns whether or not the address index has any entries for the
+// passed address.
+//
+// Only a single lookup of level 0 is performed since it is always populated
+// for addresses with at least one entry and the lookup is avoided entirely
+// for addresses that are not in the address filter when it is enabled.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) HasAddress(dbTx database.Tx, addr stdaddr.Address) (bool, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return false, err
+	}
+	if !idx.addrFilter.mayContain(addrKey) {
+		return false, nil
+	}
+
+	return hasAddressKey(dbTx, addrKey), nil
+}
+
+// hasAddressKey returns whether or not the address index has any entries for
+// the passed address key using the provided database transaction.
+func hasAddressKey(dbTx database.Tx, addrKey [addrKeySize]byte) bool {
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	level0Key := keyForLevel(addrKey, 0)
+	return bucket.Get(level0Key[:]) != nil
+}
+
+// dbPrefetchAddrIndexLevels reads each level of the passed address key from the
+// provided bucket without deserializing them in order to pull the pages that
+// house them into the database cache.  It returns the number of levels read.
+func dbPrefetchAddrIndexLevels(bucket internalBucket, addrKey [addrKeySize]byte) int {
+	var numLevels int
+	for level := uint8(0); level <= maxAddrIndexLevel; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		if bucket.Get(levelKey[:]) == nil {
+			break
+		}
+		numLevels++
+	}
+	return numLevels
+}
+
+// Prefetch reads all of the levels that house the entries for the passed
+// addresses without deserializing or returning them in order to warm the
+// database cache ahead of a burst of queries for them, such as a wallet rescan,
+// which reduces the latency of the subsequent queries.
+//
+// Since it only serves as a hint, addresses with types that are not supported
+// by the index and addresses without any entries are silently skipped.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) Prefetch(dbTx database.Tx, addrs []stdaddr.Address) {
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	if bucket == nil {
+		return
+	}
+	for _, addr := range addrs {
+		addrKey, err := idx.keyForAddr(addr)
+		if err != nil || !idx.addrFilter.mayContain(addrKey) {
+			continue
+		}
+		dbPrefetchAddrIndexLevels(bucket, addrKey)
+	}
+}
+
+// AddressesWithHash160Prefix returns up to the provided maximum number of
+// address keys in the address index with the provided address type byte whose
+// hash160 starts with the provided prefix.  The keys are returned in ascending
+// order and may be converted to addresses with keyToAddr.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressesWithHash160Prefix(dbTx database.Tx, typeByte byte, prefix []byte, max int) ([][addrKeySize]byte, error) {
+	if len(prefix) > addrKeySize-1 {
+		return nil, fmt.Errorf("hash160 prefix length of %d exceeds the max "+
+			"of %d bytes", len(prefix), addrKeySize-1)
+	}
+	if max <= 0 {
+		return nil, nil
+	}
+
+	// Seek to the first key with the requested type and prefix.  Since the
+	// levels for each address key are stored under consecutive keys, only
+	// emit each address key once.
+	seekKey := make([]byte, 1+len(prefix))
+	seekKey[0] = typeByte
+	copy(seekKey[1:], prefix)
+	var results [][addrKeySize]byte
+	cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+	for ok := cursor.Seek(seekKey); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, seekKey) {
+			break
+		}
+		if len(key) != levelKeySize {
+			continue
+		}
+
+		var addrKey [addrKeySize]byte
+		copy(addrKey[:], key[:addrKeySize])
+		if len(results) > 0 && results[len(results)-1] == addrKey {
+			continue
+		}
+		if len(results) == max {
+			break
+		}
+		results = append(results, addrKey)
+	}
+	return results, nil
+}
+
+// LevelStat houses statistics about a single level of the entries for an
+// address in the address index.
+type LevelStat struct {
+	// Level is the level the statistics are for.
+	Level uint8
+
+	// NumEntries is the number of entries in the level.
+	NumEntries int
+}
+
+// ForEachAddress invokes the provided callback for each distinct address key in
+// the index in ascending order.  Each key consists of a single byte that
+// identifies the type of the address followed by its hash160.  Iteration stops
+// when the callback returns an error, which is returned unless it is
+// ErrStopForEach.
+//
+// NOTE: This is a full scan of the index which is intended for maintenance and
+// analysis tooling rather than hot paths.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) ForEachAddress(dbTx database.Tx, fn func(addrKey [addrKeySize]byte) error) error {
+	// Since the levels for each address key are stored under consecutive keys,
+	// only invoke the callback for the first level of each address key.
+	var prevAddrKey [addrKeySize]byte
+	var havePrev bool
+	cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) != levelKeySize {
+			continue
+		}
+
+		var addrKey [addrKeySize]byte
+		copy(addrKey[:], key[:addrKeySize])
+		if havePrev && addrKey == prevAddrKey {
+			continue
+		}
+		prevAddrKey, havePrev = addrKey, true
+
+		if err := fn(addrKey); err != nil {
+			if errors.Is(err, ErrStopForEach) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkAll invokes the provided callback for each distinct address key in the
+// index in ascending order along with all of its entries ordered from oldest to
+// newest.  The entries are the same as those returned by EntriesForAddress for
+// the address when all of them are requested, including the resolved block
+// hashes.  Iteration stops when the callback returns an error, which is
+// returned unless it is ErrStopForEach.
+//
+// This is intended to enable exporting the entire index into an external store
+// since it avoids the need to query each address separately.
+//
+// NOTE: This is a full scan of the index which is intended for maintenance and
+// analysis tooling rather than hot paths.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) WalkAll(dbTx database.Tx, fn func(addrKey [addrKeySize]byte, entries []TxIndexEntry) error) error {
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return dbFetchBlockHashBySerializedID(dbTx, id)
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	return idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+		entries, _, err := dbFetchAddrIndexEntries(bucket, addrKey, 0,
+			math.MaxUint32, false, fetchBlockHash)
+		if err != nil {
+			return err
+		}
+		return fn(addrKey, entries)
+	})
+}
+
+// AddressTypeCounts returns the number of distinct addresses with entries in
+// the index for each address type keyed by the addrKeyType constants of the
+// public key hash and script hash variants.  The public key variants used by
+// the extended key mode are counted under the corresponding public key hash
+// variant, so a public key and its hash are counted as separate addresses in
+// that mode.  Each address is only counted once regardless of how many levels
+// of entries it has.
+//
+// NOTE: This is a full scan of the index which is intended for maintenance and
+// analysis tooling rather than hot paths.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressTypeCounts(dbTx database.Tx) (map[uint8]uint64, error) {
+	counts := map[uint8]uint64{
+		addrKeyTypePubKeyHash:        0,
+		addrKeyTypePubKeyHashEdwards: 0,
+		addrKeyTypePubKeyHashSchnorr: 0,
+		addrKeyTypeScriptHash:        0,
+	}
+	err := idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+		addrType := addrKey[0]
+		if addrType >= addrKeyTypePubKeyOffset {
+			addrType -= addrKeyTypePubKeyOffset
+		}
+		counts[addrType]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// AddressTotals returns the total amounts credited to and debited from the
+// passed address by all of the transactions in the address index.  Zero totals
+// are returned for addresses without any entries.  ErrAddressTotalsUnavailable
+// is returned when the index is not configured with the TrackAddrTotals option.
+//
+// An output that pays to multiple addresses, such as a bare multisignature
+// output, credits its full amount to each of them and an input that spends such
+// an output likewise debits its full amount from each of them.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressTotals(dbTx database.Tx, addr stdaddr.Address) (dcrutil.Amount, dcrutil.Amount, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !idx.trackTotals {
+		return 0, 0, ErrAddressTotalsUnavailable
+	}
+	bucket := dbTx.Metadata().Bucket(addrTotalsIndexKey)
+	serialized := bucket.Get(addrKey[:])
+	if serialized == nil {
+		return 0, 0, nil
+	}
+	if len(serialized) != addrTotalsEntrySize {
+		str := fmt.Sprintf("address totals for key %x have an invalid size "+
+			"of %d bytes", addrKey, len(serialized))
+		return 0, 0, makeDbErr(database.ErrCorruption, str)
+	}
+	credited := dcrutil.Amount(byteOrder.Uint64(serialized[0:8]))
+	debited := dcrutil.Amount(byteOrder.Uint64(serialized[8:16]))
+	return credited, debited, nil
+}
+
+// AddressLevelStats returns statistics about each of the levels that house the
+// entries for the passed address in the address index ordered from the lowest
+// (newest) level to the highest (oldest) level.  No statistics are returned
+// for addresses without any entries.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressLevelStats(dbTx database.Tx, addr stdaddr.Address) ([]LevelStat, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	var stats []LevelStat
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+		stats = append(stats, LevelStat{
+			Level:      level,
+			NumEntries: len(levelData) / txEntrySize,
+		})
+	}
+	return stats, nil
+}
+
+// EstimatedEntryBytes returns the total number of bytes the serialized entries
+// for the passed address consume in the address index.  The entries are not
+// deserialized, so callers may use it to cheaply decide whether or not to
+// fetch the entries for addresses with a large number of transactions.  The
+// number of transactions may be estimated by dividing the result by the size
+// of a serialized entry.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EstimatedEntryBytes(dbTx database.Tx, addr stdaddr.Address) (int, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	var totalBytes int
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+		totalBytes += len(levelData)
+	}
+	return totalBytes, nil
+}
+
+// defaultLevelHistogramSampleSize is the number of addresses sampled by
+// LevelHistogram when no sample size is provided.
+const defaultLevelHistogramSampleSize = 10000
+
+// LevelFullness houses statistics about how full a single level is across the
+// addresses sampled by LevelHistogram.
+type LevelFullness struct {
+	// Level is the level the statistics are for.
+	Level uint8
+
+	// MaxEntries is the maximum number of entries the level is able to
+	// house.
+	MaxEntries int
+
+	// NumAddrs is the number of sampled addresses that occupy the level.
+	NumAddrs int
+
+	// AvgEntries is the average number of entries in the level among the
+	// sampled addresses that occupy it.
+	AvgEntries float64
+
+	// AvgFullness is the average ratio of the number of entries in the level
+	// to the maximum number of entries it is able to house among the sampled
+	// addresses that occupy it.  It ranges from 0 to 1.
+	AvgFullness float64
+}
+
+// AddrLevelHistogram houses the distribution of the levels occupied by the
+// addresses sampled by LevelHistogram.
+type AddrLevelHistogram struct {
+	// NumSampled is the number of addresses that were sampled.
+	NumSampled int
+
+	// NumLevels houses the number of sampled addresses by the number of
+	// levels they occupy.  The entry at index n is the number of sampled
+	// addresses that occupy exactly n+1 levels.
+	NumLevels []int
+
+	// Levels houses statistics about how full each level is among the
+	// sampled addresses ordered from the lowest (newest) level to the highest
+	// (oldest) level.
+	Levels []LevelFullness
+}
+
+// LevelHistogram samples up to the provided number of addresses in the address
+// index and returns the distribution of the number of levels they occupy along
+// with how full each level is on average.  A sample size of zero uses a
+// default of 10000 addresses.
+//
+// This is a diagnostic intended to guide tuning the number of entries in the
+// levels with data from a real chain.  In order to bound the cost, only the
+// levels of the sampled addresses are read.  The addresses are sampled in key
+// order, which is the order of their hash160 within each type of address, and
+// since hashes are uniformly distributed, the sample is effectively random with
+// respect to the activity of the addresses.  However, the addresses of the
+// types that sort first, notably pay-to-pubkey-hash addresses, are favored
+// when the sample does not cover the entire index.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) LevelHistogram(dbTx database.Tx, sampleSize uint32) (*AddrLevelHistogram, error) {
+	if sampleSize == 0 {
+		sampleSize = defaultLevelHistogramSampleSize
+	}
+
+	var histogram AddrLevelHistogram
+	var totalEntries, totalFullness []float64
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	err := idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+		var numLevels int
+		for level := uint8(0); level <= maxAddrIndexLevel; level++ {
+			levelKey := keyForLevel(addrKey, level)
+			levelData := bucket.Get(levelKey[:])
+			if levelData == nil {
+				break
+			}
+			numLevels++
+
+			if int(level) == len(histogram.Levels) {
+				histogram.Levels = append(histogram.Levels, LevelFullness{
+					Level:      level,
+					MaxEntries: level0MaxEntries << level,
+				})
+				totalEntries = append(totalEntries, 0)
+				totalFullness = append(totalFullness, 0)
+			}
+			stats := &histogram.Levels[level]
+			numEntries := float64(len(levelData) / txEntrySize)
+			stats.NumAddrs++
+			totalEntries[level] += numEntries
+			totalFullness[level] += numEntries / float64(stats.MaxEntries)
+		}
+		if numLevels == 0 {
+			return nil
+		}
+
+		for len(histogram.NumLevels) < numLevels {
+			histogram.NumLevels = append(histogram.NumLevels, 0)
+		}
+		histogram.NumLevels[numLevels-1]++
+		histogram.NumSampled++
+		if histogram.NumSampled == int(sampleSize) {
+			return ErrStopForEach
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range histogram.Levels {
+		stats := &histogram.Levels[i]
+		stats.AvgEntries = totalEntries[i] / float64(stats.NumAddrs)
+		stats.AvgFullness = totalFullness[i] / float64(stats.NumAddrs)
+	}
+	return &histogram, nil
+}
+
+// CommittedAmount houses the amount committed to an address by a ticket
+// purchase.
+type CommittedAmount struct {
+	// TxHash is the hash of the ticket purchase.
+	TxHash chainhash.Hash
+
+	// BlockHeight is the height of the block that contains the ticket
+	// purchase.
+	BlockHeight int64
+
+	// Amount is the total amount committed to the address by the ticket
+	// purchase.
+	Amount dcrutil.Amount
+}
+
+// CommittedAmountsForAddress returns the amounts committed to the passed
+// address by all ticket purchases in the main chain ordered by the height of
+// the block that contains them.
+//
+// NOTE: Amounts committed by ticket purchases in blocks that were indexed by
+// versions of the index prior to version 3 are not available.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) CommittedAmountsForAddress(dbTx database.Tx, addr stdaddr.Address) ([]CommittedAmount, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []CommittedAmount
+	bucket := dbTx.Metadata().Bucket(addrCommitmentIndexKey)
+	cursor := bucket.Cursor()
+	for ok := cursor.Seek(addrKey[:]); ok; ok = cursor.Next() {
+		key := cursor.Key()
+		if !bytes.HasPrefix(key, addrKey[:]) {
+			break
+		}
+		serialized := cursor.Value()
+		if len(key) != addrCommitmentKeySize ||
+			len(serialized) != addrCommitmentEntrySize {
+
+			str := fmt.Sprintf("corrupt ticket commitment amount entry for "+
+				"key %x", key)
+			return nil, makeDbErr(database.ErrCorruption, str)
+		}
+
+		height, err := idx.blockHeightBySerializedID(dbTx, serialized[0:4])
+		if err != nil {
+			return nil, err
+		}
+		result := CommittedAmount{
+			BlockHeight: height,
+			Amount:      dcrutil.Amount(byteOrder.Uint64(serialized[4:12])),
+		}
+		copy(result.TxHash[:], key[addrKeySize:])
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].BlockHeight < results[j].BlockHeight
+	})
+	return results, nil
+}
+
+// RewardSourceTicket returns the hash of the ticket that earned the reward paid
+// to the passed address by the vote identified by the provided entry, which
+// must be an entry for the address.  ErrRewardSourceNotFound is returned when
+// the entry does not identify a vote that pays a reward to the address.
+//
+// NOTE: The reward sources are only recorded when the index is configured with
+// the IndexRewardSources option, so ErrRewardSourceNotFound is always returned
+// otherwise.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) RewardSourceTicket(dbTx database.Tx, addr stdaddr.Address, entry *TxIndexEntry) (*chainhash.Hash, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var key [addrRewardSourceKeySize]byte
+	copy(key[:], addrKey[:])
+	copy(key[addrKeySize:], entry.BlockRegion.Hash[:])
+	byteOrder.PutUint32(key[addrKeySize+chainhash.HashSize:],
+		entry.BlockRegion.Offset)
+	bucket := dbTx.Metadata().Bucket(addrRewardSourceIndexKey)
+	serialized := bucket.Get(key[:])
+	if serialized == nil {
+		return nil, ErrRewardSourceNotFound
+	}
+	if len(serialized) != chainhash.HashSize {
+		str := fmt.Sprintf("corrupt reward source entry for key %x", key)
+		return nil, makeDbErr(database.ErrCorruption, str)
+	}
+
+	var ticketHash chainhash.Hash
+	copy(ticketHash[:], serialized)
+	return &ticketHash, nil
+}
+
+// blockHeightBySerializedID returns the main chain height of the block
+// associated with the provided serialized block ID.
+func (idx *AddrIndex) blockHeightBySerializedID(dbTx database.Tx, serializedID []byte) (int64, error) {
+	hash, err := dbFetchBlockHashBySerializedID(dbTx, serializedID)
+	if err != nil {
+		return 0, err
+	}
+	return idx.chain.BlockHeightByHash(hash)
+}
+
+// FirstSeenHeight returns the height of the block that contains the oldest
+// transaction in the address index that involves the passed address.
+// ErrAddressNotFound is returned when there are no entries for the address.
+//
+// Only the first entry of the highest level is decoded, so the cost of this
+// query does not depend on the number of transactions involving the address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) FirstSeenHeight(dbTx database.Tx, addr stdaddr.Address) (int64, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	// The oldest entry is the first one in the highest populated level since
+	// higher levels contain older transactions.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	var highestLevelData []byte
+	for level := uint8(0); ; level++ {
+		levelKey := keyForLevel(addrKey, level)
+		levelData := bucket.Get(levelKey[:])
+		if levelData == nil {
+			break
+		}
+		highestLevelData = levelData
+	}
+	if highestLevelData == nil {
+		return 0, ErrAddressNotFound
+	}
+	if len(highestLevelData) < txEntrySize {
+		str := fmt.Sprintf("failed to deserialize address index for key "+
+			"%x: unexpected end of data", addrKey)
+		return 0, makeDbErr(database.ErrCorruption, str)
+	}
+
+	return idx.blockHeightBySerializedID(dbTx, highestLevelData[0:4])
+}
+
+// LastSeenHeight returns the height of the block that contains the newest
+// transaction in the address index that involves the passed address.
+// ErrAddressNotFound is returned when there are no entries for the address.
+//
+// Only the last entry of level 0 is decoded, so the cost of this query does not
+// depend on the number of transactions involving the address.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) LastSeenHeight(dbTx database.Tx, addr stdaddr.Address) (int64, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	// The newest entry is the last one in level 0 since lower levels contain
+	// newer transactions and level 0 is always populated when there are any
+	// entries.
+	bucket := dbTx.Metadata().Bucket(addrIndexKey)
+	level0Key := keyForLevel(addrKey, 0)
+	level0Data := bucket.Get(level0Key[:])
+	if level0Data == nil {
+		return 0, ErrAddressNotFound
+	}
+	if len(level0Data) < txEntrySize {
+		str := fmt.Sprintf("failed to deserialize address index for key "+
+			"%x: unexpected end of data", addrKey)
+		return 0, makeDbErr(database.ErrCorruption, str)
+	}
+
+	offset := len(level0Data) - txEntrySize
+	return idx.blockHeightBySerializedID(dbTx, level0Data[offset:offset+4])
+}
+
+// AddressTxIndexEntry houses the details which identify a transaction in an
+// address index entry along with the address it involves and the height of the
+// block that contains it.
+type AddressTxIndexEntry struct {
+	TxIndexEntry
+
+	// Address is the address the transaction involves.
+	Address stdaddr.Address
+
+	// BlockHeight is the main chain height of the block that contains the
+	// transaction.
+	BlockHeight int64
+}
+
+// RecentEntriesForAddresses returns up to the requested number of the most
+// recent entries across all of the passed addresses ordered from newest to
+// oldest.  This is useful for providing a merged activity feed for a set of
+// addresses such as those of a wallet.
+//
+// Only the newest entries of each address are loaded, which involves reading
+// at most roughly the requested number of entries from the lowest levels of
+// each address, so the cost of this query does not depend on the number of
+// transactions involving the addresses.
+//
+// NOTE: A transaction that involves more than one of the passed addresses has
+// an entry for each of them.  Also, these results only include transactions
+// confirmed in blocks.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) RecentEntriesForAddresses(dbTx database.Tx, addrs []stdaddr.Address, numRequested uint32) ([]AddressTxIndexEntry, error) {
+	if numRequested == 0 {
+		return nil, nil
+	}
+
+	// Load the newest entries for each unique address along with the heights
+	// of the blocks that contain them.  The heights are cached since the
+	// addresses of a wallet commonly share blocks.
+	var results []AddressTxIndexEntry
+	heights := make(map[chainhash.Hash]int64)
+	seen := make(map[[addrKeySize]byte]struct{}, len(addrs))
+	for _, addr := range addrs {
+		addrKey, err := idx.keyForAddr(addr)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[addrKey]; ok {
+			continue
+		}
+		seen[addrKey] = struct{}{}
+		if !idx.addrFilter.mayContain(addrKey) {
+			continue
+		}
+
+		entries, _, err := idx.entriesForAddressKey(dbTx, addrKey, 0,
+			numRequested, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			hash := entry.BlockRegion.Hash
+			height, ok := heights[*hash]
+			if !ok {
+				height, err = idx.chain.BlockHeightByHash(hash)
+				if err != nil {
+					return nil, err
+				}
+				heights[*hash] = height
+			}
+			results = append(results, AddressTxIndexEntry{
+				TxIndexEntry: entry,
+				Address:      addr,
+				BlockHeight:  height,
+			})
+		}
+	}
+
+	// Order the entries from newest to oldest by the height of their block and
+	// then their position within it and limit them to the number requested.
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].BlockHeight != results[j].BlockHeight {
+			return results[i].BlockHeight > results[j].BlockHeight
+		}
+		return results[i].BlockRegion.Offset > results[j].BlockRegion.Offset
+	})
+	if uint32(len(results)) > numRequested {
+		results = results[:numRequested]
+	}
+	return results, nil
+}
+
+// addUnconfirmedTx modifies the unconfirmed (memory-only) address index to
+// include mappings for the passed address keys to the transaction and accounts
+// for the transaction.  The mappings for addresses that already have the
+// maximum number of transactions allowed per address are refused, so the
+// transaction is only accounted for when it is mapped to at least one address.
+// It returns the hashes of any transactions that were evicted as a result.
+// The caller must pass them to notifyUnconfirmedEvicted once the unconfirmed
+// lock is released.
+//
+// This function MUST be called with the unconfirmed lock held (for writes).
+func (idx *AddrIndex) addUnconfirmedTx(tx *dcrutil.Tx, addrKeys [][addrKeySize]byte) []chainhash.Hash {
+	for _, addrKey := range addrKeys {
+		// Refuse the mapping when the address already has the maximum
+		// number of transactions allowed and does not already include this
+		// one.
+		addrIndexEntry := idx.txnsByAddr[addrKey]
+		if idx.maxUnconfirmedPerAddr > 0 &&
+			len(addrIndexEntry) >= idx.maxUnconfirmedPerAddr {
+
+			if _, ok := addrIndexEntry[*tx.Hash()]; !ok {
+				log.Debugf("Not adding unconfirmed transaction %v to the "+
+					"address index for address key %x due to exceeding "+
+					"the limit of %d transactions per address", tx.Hash(),
+					addrKey, idx.maxUnconfirmedPerAddr)
+				continue
+			}
+		}
+
+		// Add a mapping from the address to the transaction.
+		if addrIndexEntry == nil {
+			addrIndexEntry = make(map[chainhash.Hash]*dcrutil.Tx)
+			idx.txnsByAddr[addrKey] = addrIndexEntry
+		}
+		addrIndexEntry[*tx.Hash()] = tx
+
+		// Add a mapping from the transaction to the address.
+		addrsByTxEntry := idx.addrsByTx[*tx.Hash()]
+		if addrsByTxEntry == nil {
+			addrsByTxEntry = make(map[[addrKeySize]byte]struct{})
+			idx.addrsByTx[*tx.Hash()] = addrsByTxEntry
+		}
+		addrsByTxEntry[addrKey] = struct{}{}
+		idx.signalUnconfirmedSubs(addrKey)
+	}
+
+	// Account for the transaction and enforce the maximum number of
+	// unconfirmed transactions.
+	return idx.trackUnconfirmedTx(tx)
+}
+
+// unconfirmedTxEntry houses the details tracked for each transaction in the
+// unconfirmed index in order to support eviction and memory accounting.
+//
+// The seq field is a sequence number that increases with each tracked
+// transaction, which allows the transactions to be ordered by when they were
+// added without walking the order list.
+type unconfirmedTxEntry struct {
+	hash  chainhash.Hash
+	bytes uint64
+	seq   uint64
+}
+
+// UnconfirmedIndexStats houses statistics about the unconfirmed (memory-only)
+// address index.
+type UnconfirmedIndexStats struct {
+	// NumTxns is the number of transactions in the index.
+	NumTxns int
+
+	// NumAddrs is the number of addresses in the index.
+	NumAddrs int
+
+	// EstimatedBytes is the approximate number of bytes used by the
+	// transactions in the index along with the mappings between them and
+	// their addresses.
+	EstimatedBytes uint64
+
+	// NumEvicted is the cumulative number of transactions that were evicted
+	// from the index due to exceeding the maximum number of transactions.
+	// The evicted transactions are not reported by the index even though
+	// they typically remain in the memory pool.
+	NumEvicted uint64
+}
+
+// trackUnconfirmedTx records the passed transaction as the newest one in the
+// unconfirmed index along with its estimated memory usage and evicts the oldest
+// transactions when the maximum number of allowed transactions is exceeded.
+// It returns the hashes of the evicted transactions.  Transactions that do not
+// involve any addresses are ignored.
+//
+// The estimated memory usage of transactions that are already tracked is
+// replaced rather than added again since adding a transaction again might map
+// it to additional addresses, such as when the mappings were previously
+// refused due to the maximum number of transactions per address.  They retain
+// their position in the eviction order.
+//
+// This function MUST be called with the unconfirmed lock held (for writes).
+func (idx *AddrIndex) trackUnconfirmedTx(tx *dcrutil.Tx) []chainhash.Hash {
+	hash := tx.Hash()
+	addrKeys, ok := idx.addrsByTx[*hash]
+	if !ok {
+		return nil
+	}
+
+	bytes := uint64(tx.MsgTx().SerializeSize()) +
+		uint64(len(addrKeys))*unconfirmedMappingOverhead
+	if elem, ok := idx.unconfirmedElems[*hash]; ok {
+		entry := elem.Value.(*unconfirmedTxEntry)
+		idx.unconfirmedBytes = idx.unconfirmedBytes - entry.bytes + bytes
+		entry.bytes = bytes
+		return nil
+	}
+	idx.unconfirmedSeq++
+	entry := &unconfirmedTxEntry{hash: *hash, bytes: bytes,
+		seq: idx.unconfirmedSeq}
+	idx.unconfirmedElems[*hash] = idx.unconfirmedOrder.PushBack(entry)
+	idx.unconfirmedBytes += bytes
+
+	return idx.evictUnconfirmedTxns()
+}
+
+// evictUnconfirmedTxns removes the oldest transactions from the unconfirmed
+// index until the number of transactions no longer exceeds the maximum and
+// returns their hashes.
+//
+// This function MUST be called with the unconfirmed lock held (for writes).
+func (idx *AddrIndex) evictUnconfirmedTxns() []chainhash.Hash {
+	if idx.maxUnconfirmedTxns <= 0 {
+		return nil
+	}
+	var evicted []chainhash.Hash
+	for idx.unconfirmedOrder.Len() > idx.maxUnconfirmedTxns {
+		oldest := idx.unconfirmedOrder.Front().Value.(*unconfirmedTxEntry)
+		log.Debugf("Evicting unconfirmed transaction %v from the address "+
+			"index due to exceeding the limit of %d transactions",
+			oldest.hash, idx.maxUnconfirmedTxns)
+		hash := oldest.hash
+		idx.removeUnconfirmedTx(&hash)
+		evicted = append(evicted, hash)
+	}
+	idx.numEvictedUnconfirmed += uint64(len(evicted))
+	return evicted
+}
+
+// notifyUnconfirmedEvicted invokes the callback the index was configured with,
+// if any, for each of the provided evicted transactions.
+//
+// This function MUST NOT be called with the unconfirmed lock held since the
+// callback might call back into the unconfirmed index.
+func (idx *AddrIndex) notifyUnconfirmedEvicted(evicted []chainhash.Hash) {
+	if idx.onUnconfirmedTxEvicted == nil {
+		return
+	}
+	for i := range evicted {
+		idx.onUnconfirmedTxEvicted(&evicted[i])
+	}
+}
+
+// SetMaxUnconfirmedTxns sets the maximum number of transactions that are kept
+// in the unconfirmed (memory-only) address index.  The oldest transactions are
+// evicted when adding a transaction would exceed the maximum, including
+// immediately when the new maximum is lower than the current number of
+// transactions.  A maximum of zero, which is the default, means there is no
+// limit.
+//
+// NOTE: The evicted transactions typically remain in the memory pool, so the
+// unconfirmed index no longer reflects all of the transactions in it once any
+// are evicted.  The OnUnconfirmedTxEvicted callback the index is configured
+// with, if any, is invoked for each evicted transaction so the caller is able
+// to react to the divergence and UnconfirmedStats reports the number of
+// evicted transactions.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) SetMaxUnconfirmedTxns(max int) {
+	idx.unconfirmedLock.Lock()
+	idx.maxUnconfirmedTxns = max
+	evicted := idx.evictUnconfirmedTxns()
+	idx.unconfirmedLock.Unlock()
+	idx.notifyUnconfirmedEvicted(evicted)
+}
+
+// SetMaxUnconfirmedTxnsPerAddr sets the maximum number of transactions that are
+// kept for any single address in the unconfirmed (memory-only) address index.
+// This prevents an address that is involved in a huge number of unconfirmed
+// transactions, such as the target of a dust attack, from bloating the index.
+//
+// Once an address reaches the maximum, additional transactions are not added
+// for it, although they are still added for any other addresses they involve
+// that are below the maximum.  Lowering the maximum does not remove any of the
+// transactions that are already in the index.  A maximum of zero, which is the
+// default, means there is no limit.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) SetMaxUnconfirmedTxnsPerAddr(max int) {
+	idx.unconfirmedLock.Lock()
+	idx.maxUnconfirmedPerAddr = max
+	idx.unconfirmedLock.Unlock()
+}
+
+// UnconfirmedStats returns statistics about the current state of the
+// unconfirmed (memory-only) address index.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedStats() UnconfirmedIndexStats {
+	idx.unconfirmedLock.RLock()
+	stats := UnconfirmedIndexStats{
+		NumTxns:        len(idx.addrsByTx),
+		NumAddrs:       len(idx.txnsByAddr),
+		EstimatedBytes: idx.unconfirmedBytes,
+		NumEvicted:     idx.numEvictedUnconfirmed,
+	}
+	idx.unconfirmedLock.RUnlock()
+	return stats
+}
+
+// unconfirmedAddrKeys returns the address keys of all addresses related to the
+// passed unconfirmed transaction.  The returned keys may contain duplicates.
+//
+// NOTE: This transaction MUST have already been validated by the memory pool
+// before calling this function with it and have all of the inputs available via
+// the provided previous scripter interface.  Failure to do so could result in
+// some or all addresses not being returned.
+func (idx *AddrIndex) unconfirmedAddrKeys(tx *dcrutil.Tx, prevScripts PrevScripter, isTreasuryEnabled bool) [][addrKeySize]byte {
+	// Index addresses of all referenced previous transaction outputs.
+	//
+	// The existence checks are elided since this is only called after the
+	// transaction has already been validated and thus all inputs are
+	// already known to exist.
+	var addrKeys [][addrKeySize]byte
+	msgTx := tx.MsgTx()
+	isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
+	isTSpend := isTreasuryEnabled && !isSSGen && stake.IsTSpend(msgTx)
+	var class TxClass
+	switch {
+	case isSSGen:
+		class = TxClassVote
+	case idx.indexTicketCommitmentAddrs && stake.IsSSRtx(msgTx, false):
+		class = TxClassRevocation
+	}
+	for i, txIn := range msgTx.TxIn {
+		// Skip stakebase.
+		if i == 0 && isSSGen {
+			continue
+		}
+
+		// Skip treasury spend inputs since they do not reference any
+		// previous outputs.
+		if isTSpend {
+			break
+		}
+
+		version, pkScript, ok := prevScripts.PrevScript(&txIn.PreviousOutPoint)
+		if !ok {
+			// Ignore missing entries.  This should never happen in practice
+			// since the function comments specifically call out all inputs must
+			// be available.
+			continue
+		}
+		addrKeys = append(addrKeys, idx.scriptAddrKeys(version, pkScript,
+			false, isTreasuryEnabled)...)
+
+		// Also index the addresses embedded in the redeem script of
+		// pay-to-script-hash outputs when configured to do so.
+		redeemScript := idx.spentRedeemScript(version, pkScript, txIn)
+		if redeemScript != nil {
+			addrKeys = append(addrKeys, idx.redeemScriptAddrKeys(redeemScript,
+				isTreasuryEnabled)...)
+		}
+
+		// Also index the commitment addresses of the ticket spent by votes
+		// and revocations when configured to do so.
+		commitments := idx.spentTicketCommitments(prevScripts,
+			&txIn.PreviousOutPoint, class)
+		for _, commitment := range commitments {
+			addrKeys = append(addrKeys, idx.scriptAddrKeys(commitment.Version,
+				commitment.PkScript, true, isTreasuryEnabled)...)
+		}
+	}
+
+	// Index addresses of all created outputs.
+	isSStx := stake.IsSStx(msgTx)
+	for _, txOut := range msgTx.TxOut {
+		addrKeys = append(addrKeys, idx.scriptAddrKeys(txOut.Version,
+			txOut.PkScript, isSStx, isTreasuryEnabled)...)
+	}
+	return addrKeys
+}
+
+// AddUnconfirmedTx adds all addresses related to the transaction to the
+// unconfirmed (memory-only) address index.
+//
+// When the index is configured to index unconfirmed transactions
+// asynchronously, the transaction is queued and its addresses are added by a
+// background goroutine instead, so it might not be reflected by the unconfirmed
+// index immediately after this function returns.  The transaction is indexed
+// synchronously when the queue is full and is not indexed at all once the index
+// is shutting down.
+//
+// NOTE: This transaction MUST have already been validated by the memory pool
+// before calling this function with it and have all of the inputs available via
+// the provided previous scripter interface.  Failure to do so could result in
+// some or all addresses not being indexed.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddUnconfirmedTx(tx *dcrutil.Tx, prevScripts PrevScripter, isTreasuryEnabled bool) {
+	if q := idx.unconfirmedQueue; q != nil {
+		err := q.enqueue(tx, prevScripts, isTreasuryEnabled)
+		switch {
+		case err == nil:
+			return
+
+		// Transactions are no longer indexed once the index is shutting
+		// down.
+		case errors.Is(err, errUnconfirmedQueueClosed):
+			log.Debugf("Not adding unconfirmed transaction %v to the "+
+				"address index since it is shutting down", tx.Hash())
+			return
+		}
+
+		// Index the transaction synchronously when the queue is full.
+		addrKeys := idx.unconfirmedAddrKeys(tx, prevScripts,
+			isTreasuryEnabled)
+		idx.notifyUnconfirmedEvicted(q.add(idx, tx, addrKeys))
+		return
+	}
+
+	addrKeys := idx.unconfirmedAddrKeys(tx, prevScripts, isTreasuryEnabled)
+	idx.unconfirmedLock.Lock()
+	evicted := idx.addUnconfirmedTx(tx, addrKeys)
+	idx.unconfirmedLock.Unlock()
+	idx.notifyUnconfirmedEvicted(evicted)
+}
+
+// RemoveUnconfirmedTx removes the passed transaction from the unconfirmed
+// (memory-only) address index.  When the index is configured to index
+// unconfirmed transactions asynchronously, this also includes any queued
+// additions of the transaction that have not been processed yet.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) RemoveUnconfirmedTx(hash *chainhash.Hash) {
+	if idx.unconfirmedQueue != nil {
+		idx.unconfirmedQueue.remove(idx, hash)
+		return
+	}
+
+	idx.unconfirmedLock.Lock()
+	idx.removeUnconfirmedTx(hash)
+	idx.unconfirmedLock.Unlock()
+}
+
+// removeUnconfirmedTx removes the passed transaction from the unconfirmed
+// (memory-only) address index.
+//
+// This function MUST be called with the unconfirmed lock held (for writes).
+func (idx *AddrIndex) removeUnconfirmedTx(hash *chainhash.Hash) {
+	// Remove all address references to the transaction from the address
+	// index and remove the entry for the address altogether if it no longer
+	// references any transactions.
+	for addrKey := range idx.addrsByTx[*hash] {
+		delete(idx.txnsByAddr[addrKey], *hash)
+		if len(idx.txnsByAddr[addrKey]) == 0 {
+			delete(idx.txnsByAddr, addrKey)
+		}
+		idx.signalUnconfirmedSubs(addrKey)
+	}
+
+	// Remove the entry from the transaction to address lookup map as well.
+	delete(idx.addrsByTx, *hash)
+
+	// Remove the transaction from the eviction order and memory accounting.
+	if elem, ok := idx.unconfirmedElems[*hash]; ok {
+		entry := idx.unconfirmedOrder.Remove(elem).(*unconfirmedTxEntry)
+		idx.unconfirmedBytes -= entry.bytes
+		delete(idx.unconfirmedElems, *hash)
+	}
+}
+
+// UnconfirmedTxnsForAddress returns all transactions currently in the
+// unconfirmed (memory-only) address index that involve the passed address.
+// Unsupported address types are ignored and will result in no results.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedTxnsForAddress(addr stdaddr.Address) []*dcrutil.Tx {
+	// Ignore unsupported address types.
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil
+	}
+
+	// Protect concurrent access.
+	idx.unconfirmedLock.RLock()
+	defer idx.unconfirmedLock.RUnlock()
+
+	// Return a new slice with the results if there are any.  This ensures
+	// safe concurrency.
+	if txns, exists := idx.txnsByAddr[addrKey]; exists {
+		addressTxns := make([]*dcrutil.Tx, 0, len(txns))
+		for _, tx := range txns {
+			addressTxns = append(addressTxns, tx)
+		}
+		return addressTxns
+	}
+
+	return nil
+}
+
+// TxWithConfirmations houses a transaction along with the number of
+// confirmations it has.
+type TxWithConfirmations struct {
+	// Tx is the transaction.
+	Tx *dcrutil.Tx
+
+	// Confirmations is the number of confirmations the transaction has.
+	Confirmations int64
+}
+
+// UnconfirmedTxnsWithConfirmations returns all transactions currently in the
+// unconfirmed (memory-only) address index that involve the passed address in
+// the same form as the confirmed entries returned by EntriesWithConfirmations,
+// which allows callers to process both kinds uniformly.  The transactions are
+// not in any blocks, so they always report zero confirmations.  Unsupported
+// address types are ignored and will result in no results.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedTxnsWithConfirmations(addr stdaddr.Address) []TxWithConfirmations {
+	txns := idx.UnconfirmedTxnsForAddress(addr)
+	if len(txns) == 0 {
+		return nil
+	}
+	results := make([]TxWithConfirmations, 0, len(txns))
+	for _, tx := range txns {
+		results = append(results, TxWithConfirmations{Tx: tx})
+	}
+	return results
+}
+
+// MergedAddrEntry houses either a transaction from the unconfirmed (memory-only)
+// address index or an entry that identifies a transaction confirmed in a block
+// along with the hash of the transaction and the number of confirmations it
+// has.
+type MergedAddrEntry struct {
+	// Tx is the unconfirmed transaction.  It is nil for confirmed
+	// transactions.
+	Tx *dcrutil.Tx
+
+	// Entry identifies the confirmed transaction.  It is only set when Tx is
+	// nil.
+	Entry TxIndexEntry
+
+	// TxHash is the hash of the transaction.
+	TxHash chainhash.Hash
+
+	// Confirmations is the number of confirmations the transaction has.  It
+	// is zero for unconfirmed transactions.
+	Confirmations int64
+}
+
+// AllEntriesForAddress returns a single merged view of up to the requested
+// number of transactions that involve the passed address ordered from newest
+// to oldest.  The unconfirmed transactions from the unconfirmed (memory-only)
+// address index come first, ordered by when they were added, followed by the
+// newest confirmed transactions from the address index.
+//
+// Transactions move from the unconfirmed index to the address index when they
+// are mined.  The unconfirmed transactions are snapshotted before the confirmed
+// entries are read from a new database transaction without holding the
+// unconfirmed lock, so every transaction in the snapshot is reported exactly
+// once, either as confirmed when it was mined before the confirmed entries were
+// read, or as unconfirmed otherwise.  However, note that the address index is
+// updated asynchronously while a mined transaction is typically removed from
+// the unconfirmed index as soon as its block is connected to the chain, so a
+// transaction that is mined shortly before this is called might be missing
+// from both parts until the address index processes the block.  The provided
+// database transaction is not used, which is consistent with EntriesForAddress.
+//
+// The number of confirmations of the confirmed transactions is calculated
+// against the current best height of the chain.  An error is returned when an
+// entry refers to a block that is no longer in the main chain, such as when the
+// index has not yet processed a reorganization.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AllEntriesForAddress(dbTx database.Tx, addr stdaddr.Address, numRequested uint32) ([]MergedAddrEntry, error) {
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if numRequested == 0 {
+		return nil, nil
+	}
+
+	// Snapshot the unconfirmed transactions ordered from newest to oldest.
+	// The unconfirmed lock is not held while the confirmed entries are read
+	// below to avoid blocking updates to the unconfirmed index during IO.
+	idx.unconfirmedLock.RLock()
+	unconfirmed := make([]*dcrutil.Tx, 0, len(idx.txnsByAddr[addrKey]))
+	seqs := make(map[chainhash.Hash]uint64, len(idx.txnsByAddr[addrKey]))
+	for txHash, tx := range idx.txnsByAddr[addrKey] {
+		unconfirmed = append(unconfirmed, tx)
+		if elem, ok := idx.unconfirmedElems[txHash]; ok {
+			seqs[txHash] = elem.Value.(*unconfirmedTxEntry).seq
+		}
+	}
+	idx.unconfirmedLock.RUnlock()
+	sort.Slice(unconfirmed, func(i, j int) bool {
+		return seqs[*unconfirmed[i].Hash()] > seqs[*unconfirmed[j].Hash()]
+	})
+
+	// Load enough of the newest confirmed entries to satisfy the request
+	// even when all of the unconfirmed transactions were mined.
+	numConfirmed := uint64(numRequested) + uint64(len(unconfirmed))
+	if numConfirmed > math.MaxUint32 {
+		numConfirmed = math.MaxUint32
+	}
+	var confirmed []TxIndexEntryWithHash
+	err = idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		confirmed, _, err = idx.EntriesWithTxHashForAddress(dbTx, addr, 0,
+			uint32(numConfirmed), true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	confirmedHashes := make(map[chainhash.Hash]struct{}, len(confirmed))
+	for i := range confirmed {
+		confirmedHashes[confirmed[i].TxHash] = struct{}{}
+	}
+
+	results := make([]MergedAddrEntry, 0, numRequested)
+	for _, tx := range unconfirmed {
+		if len(results) == int(numRequested) {
+			return results, nil
+		}
+		if _, ok := confirmedHashes[*tx.Hash()]; ok {
+			continue
+		}
+		results = append(results, MergedAddrEntry{Tx: tx, TxHash: *tx.Hash()})
+	}
+
+	// Resolve the height of each referenced block only once since entries
+	// for the same block are adjacent.
+	bestHeight, _ := idx.chain.Best()
+	var prevHash *chainhash.Hash
+	var height int64
+	for i := range confirmed {
+		if len(results) == int(numRequested) {
+			break
+		}
+		hash := confirmed[i].BlockRegion.Hash
+		if prevHash == nil || *hash != *prevHash {
+			height, err = idx.chain.BlockHeightByHash(hash)
+			if err != nil {
+				return nil, err
+			}
+			prevHash = hash
+		}
+
+		var confirmations int64
+		if height <= bestHeight {
+			confirmations = bestHeight - height + 1
+		}
+		results = append(results, MergedAddrEntry{
+			Entry:         confirmed[i].TxIndexEntry,
+			TxHash:        confirmed[i].TxHash,
+			Confirmations: confirmations,
+		})
+	}
+	return results, nil
+}
+
+// UnconfirmedTxnsForAddresses returns all transactions currently in the
+// unconfirmed (memory-only) address index that involve any of the passed
+// addresses.  Each transaction is only included once even when it involves
+// more than one of the addresses.  Unsupported address types are ignored.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedTxnsForAddresses(addrs []stdaddr.Address) []*dcrutil.Tx {
+	// Protect concurrent access.
+	idx.unconfirmedLock.RLock()
+	defer idx.unconfirmedLock.RUnlock()
+
+	// Return a new slice with the results if there are any.  This ensures
+	// safe concurrency.
+	var addressTxns []*dcrutil.Tx
+	seen := make(map[chainhash.Hash]struct{})
+	for _, addr := range addrs {
+		// Ignore unsupported address types.
+		addrKey, err := idx.keyForAddr(addr)
+		if err != nil {
+			continue
+		}
+
+		for txHash, tx := range idx.txnsByAddr[addrKey] {
+			if _, ok := seen[txHash]; ok {
+				continue
+			}
+			seen[txHash] = struct{}{}
+			addressTxns = append(addressTxns, tx)
+		}
+	}
+
+	return addressTxns
+}
+
+// AddressesForUnconfirmedTx returns all addresses that the transaction with the
+// passed hash involves according to the unconfirmed (memory-only) address
+// index.  Transactions that are not in the index result in no results.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressesForUnconfirmedTx(hash *chainhash.Hash) []stdaddr.Address {
+	// Protect concurrent access.
+	idx.unconfirmedLock.RLock()
+	defer idx.unconfirmedLock.RUnlock()
+
+	addrKeys, exists := idx.addrsByTx[*hash]
+	if !exists {
+		return nil
+	}
+	addrs := make([]stdaddr.Address, 0, len(addrKeys))
+	for addrKey := range addrKeys {
+		// The keys were created from supported addresses, so this can
+		// only fail if the index is corrupted in memory.  Skip any such
+		// entries.
+		addr, err := keyToAddr(addrKey, idx.chainParams)
+		if err != nil {
+			log.Errorf("Unable to decode unconfirmed address key %x: %v",
+				addrKey, err)
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// VerifyUnconfirmedAgainstConfirmed ensures the addresses the unconfirmed
+// (memory-only) address index associates with the transaction identified by
+// the passed hash are identical to the addresses the address index associates
+// with it in the connected block that contains it.  It returns whether or not
+// the addresses match and logs a warning that details the differences when
+// they do not.  The transaction must be in both the unconfirmed address index
+// and the transaction index, which means it must be verified after the block
+// that contains it is connected and before it is removed from the unconfirmed
+// address index.
+//
+// This is primarily intended to detect differences between the classification
+// of unconfirmed transactions and transactions in blocks, such as those caused
+// by the treasury agenda status differing between the two.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) VerifyUnconfirmedAgainstConfirmed(dbTx database.Tx, hash *chainhash.Hash) (bool, error) {
+	// Copy the addresses associated with the unconfirmed transaction.
+	idx.unconfirmedLock.RLock()
+	unconfirmedKeys := make(map[[addrKeySize]byte]struct{},
+		len(idx.addrsByTx[*hash]))
+	for addrKey := range idx.addrsByTx[*hash] {
+		unconfirmedKeys[addrKey] = struct{}{}
+	}
+	idx.unconfirmedLock.RUnlock()
+	if len(unconfirmedKeys) == 0 {
+		return false, fmt.Errorf("transaction %v is not in the unconfirmed "+
+			"address index", hash)
+	}
+
+	// Load the block that contains the transaction and determine its position
+	// within the block as used by the index.
+	entry, err := dbFetchTxIndexEntry(dbTx, hash)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, fmt.Errorf("transaction %v is not in the transaction "+
+			"index", hash)
+	}
+	block, err := idx.chain.BlockByHash(entry.BlockRegion.Hash)
+	if err != nil {
+		return false, err
+	}
+	txIdx := -1
+	regularTxns := block.Transactions()
+	for i, tx := range regularTxns {
+		if *tx.Hash() == *hash {
+			txIdx = i
+			break
+		}
+	}
+	for i, tx := range block.STransactions() {
+		if txIdx != -1 {
+			break
+		}
+		if *tx.Hash() == *hash {
+			txIdx = i + len(regularTxns)
+		}
+	}
+	if txIdx == -1 {
+		return false, fmt.Errorf("transaction %v is not in block %v", hash,
+			block.Hash())
+	}
+
+	// Determine the addresses associated with the transaction by the index.
+	parentHash := &block.MsgBlock().Header.PrevBlock
+	isTreasuryEnabled, err := idx.chain.IsTreasuryAgendaActive(parentHash)
+	if err != nil {
+		return false, err
+	}
+	addrsToTxns := make(writeIndexData)
+	idx.indexBlock(addrsToTxns, block, txIndexPrevScripter{dbTx: dbTx},
+		isTreasuryEnabled)
+	confirmedKeys := make(map[[addrKeySize]byte]struct{})
+	for addrKey, txns := range addrsToTxns {
+		for _, txn := range txns {
+			if txn.txIdx == txIdx {
+				confirmedKeys[addrKey] = struct{}{}
+				break
+			}
+		}
+	}
+
+	// Log the differences between the address sets, if any.
+	var missingConfirmed, missingUnconfirmed []string
+	for addrKey := range unconfirmedKeys {
+		if _, ok := confirmedKeys[addrKey]; !ok {
+			missingConfirmed = append(missingConfirmed,
+				fmt.Sprintf("%x", addrKey))
+		}
+	}
+	for addrKey := range confirmedKeys {
+		if _, ok := unconfirmedKeys[addrKey]; !ok {
+			missingUnconfirmed = append(missingUnconfirmed,
+				fmt.Sprintf("%x", addrKey))
+		}
+	}
+	if len(missingConfirmed) == 0 && len(missingUnconfirmed) == 0 {
+		return true, nil
+	}
+	sort.Strings(missingConfirmed)
+	sort.Strings(missingUnconfirmed)
+	log.Warnf("Address mismatch between the unconfirmed and confirmed "+
+		"entries for tx %v in block %v (height %d, treasury enabled %v): "+
+		"unconfirmed only %v, confirmed only %v", hash, block.Hash(),
+		block.Height(), isTreasuryEnabled, missingConfirmed,
+		missingUnconfirmed)
+	return false, nil
+}
+
+// AddressesInBlock returns the addresses the address index associates with each
+// transaction in the block with the provided hash keyed by the hash of the
+// transaction.  Transactions that do not involve any addresses are not
+// included.
+//
+// This is a diagnostic that extracts the addresses with the exact same logic
+// and treasury agenda determination used when connecting the block, which
+// allows discrepancies between the expected and stored entries of an address
+// to be localized.  The scripts of the previous outputs spent by the block are
+// loaded via the transaction index.
+//
+// The addresses for public keys are returned as their public key hash variants
+// since that is how they are indexed.  Any address keys returned by a custom
+// script address extractor that do not correspond to a supported address type
+// are not included.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) AddressesInBlock(dbTx database.Tx, blockHash *chainhash.Hash) (map[chainhash.Hash][]stdaddr.Address, error) {
+	block, err := idx.chain.BlockByHash(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	isTreasuryEnabled, err := treasuryEnabledForBlock(idx.chain, block)
+	if err != nil {
+		return nil, err
+	}
+
+	addrsToTxns := make(writeIndexData)
+	idx.indexBlock(addrsToTxns, block, txIndexPrevScripter{dbTx: dbTx},
+		isTreasuryEnabled)
+
+	// Map the transaction indices used by indexBlock, where the indices of the
+	// stake transactions start after all of the regular transactions, to the
+	// addresses in order of their keys.
+	regularTxns := block.Transactions()
+	stakeTxns := block.STransactions()
+	result := make(map[chainhash.Hash][]stdaddr.Address)
+	for _, addrKey := range addrsToTxns.sortedKeys() {
+		addr, err := keyToAddr(addrKey, idx.chainParams)
+		if err != nil {
+			continue
+		}
+		for _, txn := range addrsToTxns[addrKey] {
+			var tx *dcrutil.Tx
+			if txn.txIdx < len(regularTxns) {
+				tx = regularTxns[txn.txIdx]
+			} else {
+				tx = stakeTxns[txn.txIdx-len(regularTxns)]
+			}
+			result[*tx.Hash()] = append(result[*tx.Hash()], addr)
+		}
+	}
+	return result, nil
+}
+
+// UnconfirmedCountForAddress returns the number of transactions currently in
+// the unconfirmed (memory-only) address index that involve the passed address.
+// Unsupported address types are ignored and will result in a count of zero.
+//
+// This is preferred over UnconfirmedTxnsForAddress when only the number of
+// transactions is needed since it does not copy any transactions.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) UnconfirmedCountForAddress(addr stdaddr.Address) int {
+	// Ignore unsupported address types.
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return 0
+	}
+
+	idx.unconfirmedLock.RLock()
+	count := len(idx.txnsByAddr[addrKey])
+	idx.unconfirmedLock.RUnlock()
+	return count
+}
+
+// HasUnconfirmed returns whether or not any transactions currently in the
+// unconfirmed (memory-only) address index involve the passed address.
+// Unsupported address types are ignored and will result in false.
+//
+// This is intended for callers that frequently poll whether or not addresses
+// have pending activity since it does not allocate.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) HasUnconfirmed(addr stdaddr.Address) bool {
+	// Ignore unsupported address types.
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return false
+	}
+
+	idx.unconfirmedLock.RLock()
+	hasUnconfirmed := len(idx.txnsByAddr[addrKey]) != 0
+	idx.unconfirmedLock.RUnlock()
+	return hasUnconfirmed
+}
+
+// signalUnconfirmedSubs notifies all clients subscribed to changes in the
+// unconfirmed index for the provided address key.  Subscribers that have not
+// yet received a previous signal are skipped so that slow subscribers can't
+// block the caller and signals are coalesced instead.
+//
+// This function MUST be called with the unconfirmed lock held.
+func (idx *AddrIndex) signalUnconfirmedSubs(addrKey [addrKeySize]byte) {
+	for c := range idx.unconfirmedSubs[addrKey] {
+		select {
+		case c <- struct{}{}:
+		default:
+			idx.droppedUnconfirmedSignals++
+		}
+	}
+}
+
+// SubscribeUnconfirmed returns a channel that is signalled whenever a
+// transaction that involves the passed address is added to or removed from the
+// unconfirmed (memory-only) address index along with a function that must be
+// called to unsubscribe once the caller is no longer interested in updates.
+//
+// Multiple changes that happen before the caller receives from the channel are
+// coalesced into a single signal, so callers should query the current state of
+// the unconfirmed index upon receiving a signal rather than assuming it
+// represents a single change.
+//
+// Unsupported address types are ignored and result in a nil channel that is
+// never signalled.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) SubscribeUnconfirmed(addr stdaddr.Address) (<-chan struct{}, func()) {
+	// Ignore unsupported address types.
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		return nil, func() {}
+	}
+
+	c := make(chan struct{}, 1)
+	idx.unconfirmedLock.Lock()
+	subs := idx.unconfirmedSubs[addrKey]
+	if subs == nil {
+		subs = make(map[chan struct{}]struct{})
+		idx.unconfirmedSubs[addrKey] = subs
+	}
+	subs[c] = struct{}{}
+	idx.unconfirmedLock.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			idx.unconfirmedLock.Lock()
+			delete(idx.unconfirmedSubs[addrKey], c)
+			if len(idx.unconfirmedSubs[addrKey]) == 0 {
+				delete(idx.unconfirmedSubs, addrKey)
+			}
+			idx.unconfirmedLock.Unlock()
+		})
+	}
+	return c, unsubscribe
+}
+
+// AddrIndexConfig houses optional configuration parameters for the address
+// index.  The zero value is the default configuration.
+type AddrIndexConfig struct {
+	// Metrics is used to instrument the operations of the index.  It may be
+	// nil when instrumentation is not desired.
+	Metrics Metrics
+
+	// SkipCoinbaseOutputs prevents the outputs of coinbase transactions from
+	// being indexed which reduces the size of the index for addresses that
+	// receive mining payouts.  The option is persisted with the index and
+	// changing it requires the index to be dropped and rebuilt.
+	SkipCoinbaseOutputs bool
+
+	// IndexRedeemScriptAddrs causes the addresses embedded in the redeem
+	// scripts revealed by inputs that spend pay-to-script-hash outputs, such
+	// as the member keys of multisignature scripts, to also be indexed.  This
+	// materially increases the size of the index.  The option is persisted
+	// with the index and changing it requires the index to be dropped and
+	// rebuilt.
+	IndexRedeemScriptAddrs bool
+
+	// ExtendedKeys causes the index to use the extended key mode which
+	// identifies public key addresses by a distinct address type in their
+	// keys instead of indexing them under the keys of their public key hash
+	// variants.  This allows payments to a public key to be distinguished
+	// from payments to its hash.  It is persisted with the index and
+	// changing it requires the index to be dropped and rebuilt.
+	ExtendedKeys bool
+
+	// IndexTicketCommitmentAddrs causes votes and revocations to also be
+	// indexed under the commitment addresses of the tickets they spend so
+	// stakers are able to find them by the addresses they used to purchase
+	// the tickets.  The spent ticket outputs are otherwise only indexed under
+	// the voting rights addresses.  The option is persisted with the index
+	// and changing it requires the index to be dropped and rebuilt.
+	IndexTicketCommitmentAddrs bool
+
+	// ChangeHeuristic causes the entries for the addresses paid by the
+	// outputs of regular transactions to be tagged as likely change or
+	// payments according to the rule documented by OutputKind so they can be
+	// filtered via EntriesForAddressByOutputKind.  The version of the rule is
+	// persisted with the index and changing the option or the version
+	// requires the index to be dropped and rebuilt.
+	ChangeHeuristic bool
+
+	// AddrFilterSize is the expected number of distinct addresses to size an
+	// in-memory filter of the addresses with entries in the index for.  The
+	// filter allows queries for addresses without any entries to be answered
+	// without accessing the database.  It consumes 10 bytes per address and
+	// has a false positive rate of roughly 0.8% when the number of distinct
+	// addresses matches the size, which increases to roughly 14% at twice the
+	// size.  The filter is populated from the existing index when it is
+	// initialized.  A size of zero disables the filter.
+	AddrFilterSize uint32
+
+	// RetentionWindow is the number of most recent blocks to retain entries
+	// for.  The entries that reference older blocks are pruned as new blocks
+	// are connected in order to bound the size of the index.  Only the blocks
+	// that fall out of the window while it is configured are pruned, so the
+	// index must be dropped and rebuilt to prune an existing index.  Also, the
+	// entries of pruned blocks are not restored when blocks are disconnected.
+	// The ticket commitment amounts, reward sources, and input indices of the
+	// pruned blocks are removed along with their entries and the address
+	// totals only cover the blocks within the window.  A window of zero,
+	// which is the default, disables pruning.
+	RetentionWindow uint32
+
+	// CatchUpBatchSize is the number of blocks to connect in each database
+	// transaction when catching the index up to the blocks already known to
+	// the transaction index during initialization, such as during initial
+	// sync or after the index is enabled for an existing node.  Larger batches
+	// amortize the overhead of committing the database transactions at the
+	// cost of the memory needed to accumulate the changes of the batch.  The
+	// index tip is updated along with each batch, so any batch that is not
+	// fully committed, such as due to a crash, is connected again the next
+	// time the index is initialized.  Blocks connected after initialization
+	// are always connected individually.  A batch size of zero or one, which
+	// is the default, disables batching such that every block is connected
+	// individually via the index notifications.
+	CatchUpBatchSize uint32
+
+	// ScriptAddrExtractor is an optional function used to index additional
+	// address keys for custom scripts the index does not otherwise recognize.
+	// The index always indexes the standard addresses in scripts, so it may
+	// be nil when there are no custom scripts to index.  Since existing
+	// entries are not modified, the index must be dropped and rebuilt after
+	// the extractor changes in order for the entries of all transactions to
+	// reflect it.
+	ScriptAddrExtractor ScriptAddrExtractor
+
+	// OnUnconfirmedTxEvicted is an optional callback that is invoked with the
+	// hash of each transaction that is evicted from the unconfirmed index due
+	// to exceeding the maximum set via SetMaxUnconfirmedTxns.  The evicted
+	// transactions typically remain in the memory pool, so it allows the
+	// caller to react to the unconfirmed index no longer reflecting all of
+	// them, such as by removing them from the memory pool.  It is invoked
+	// without any locks of the index held, so it may call back into the
+	// index.
+	OnUnconfirmedTxEvicted func(hash *chainhash.Hash)
+
+	// StoreBlockTimes stores the timestamp of each connected block alongside
+	// the index so that time-range queries such as EntriesForAddressByTime do
+	// not need to load the header of every block they examine.  The
+	// timestamps of blocks that were connected while it was not set are
+	// loaded from their headers as needed instead, so it may be enabled or
+	// disabled at any time without rebuilding the index.
+	StoreBlockTimes bool
+
+	// IndexRewardSources records the ticket that earned each reward output
+	// of a vote so that it may be queried via RewardSourceTicket.  This
+	// option is persisted with the index and changing it requires the index
+	// to be dropped and rebuilt.
+	IndexRewardSources bool
+
+	// AsyncUnconfirmed defers the work of indexing unconfirmed transactions
+	// added via AddUnconfirmedTx to a single background goroutine in order to
+	// reduce the work done by and lock contention for the caller.  The
+	// unconfirmed index is updated shortly after the transactions are added
+	// rather than immediately.  The number of queued transactions is bounded,
+	// so transactions are indexed by the caller as usual while the queue is
+	// full.
+	AsyncUnconfirmed bool
+
+	// CreditFlags causes the entries for the addresses paid by the outputs of
+	// their transactions to be flagged as credits so the transactions that
+	// pay an address can be queried via CreditsForAddress.  This option is
+	// persisted with the index and changing it requires the index to be
+	// dropped and rebuilt.
+	CreditFlags bool
+
+	// IndexGenesisOutputs causes the outputs of the genesis block to be
+	// indexed.  The genesis block is the initial tip of the index and is
+	// never connected, so its outputs are not indexed by default.  The
+	// genesis coinbase outputs are not spendable and the premine, if any, is
+	// paid by the block after it which is always indexed.  This option is
+	// persisted with the index and changing it requires the index to be
+	// dropped and rebuilt.
+	IndexGenesisOutputs bool
+
+	// IndexAtomicSwapAddrs causes the recipient and refund addresses embedded
+	// in the atomic swap contracts revealed by inputs that spend
+	// pay-to-script-hash outputs to also be indexed so swap participation is
+	// able to be found by the addresses of the participants in addition to
+	// the hash of the contract.  Recognizing the contracts requires parsing
+	// the redeem script of every input that spends a pay-to-script-hash
+	// output.  The option is persisted with the index and changing it
+	// requires the index to be dropped and rebuilt.
+	IndexAtomicSwapAddrs bool
+
+	// TrackDisapprovals causes the blocks whose regular transaction tree was
+	// disapproved by the votes in the next block to be recorded so the
+	// entries for the regular transactions they contain are flagged as
+	// disapproved when they are queried.  The transactions are indexed
+	// regardless since they exist in the block, however, they no longer
+	// apply spend semantics once disapproved, so this allows the outputs that
+	// were effectively reverted to be identified.  The option is persisted
+	// with the index and changing it requires the index to be dropped and
+	// rebuilt.
+	TrackDisapprovals bool
+
+	// TrackInputIndexes causes the indices of the inputs of transactions that
+	// spend outputs which pay to an address to be recorded so the entries for
+	// debits identify the exact inputs that reference the address when they
+	// are queried.  This allows callers to locate the inputs without parsing
+	// the spending transaction, which is useful for transactions with many
+	// inputs.  The option is persisted with the index and changing it
+	// requires the index to be dropped and rebuilt.
+	TrackInputIndexes bool
+
+	// TrackAddrTotals causes the total amounts credited to and debited from
+	// each address to be tracked so they may be queried via AddressTotals.
+	// The option is persisted with the index and changing it requires the
+	// index to be dropped and rebuilt.
+	TrackAddrTotals bool
+
+	// AddrTypes specifies the types of addresses to index as AddrType
+	// constants.  The public key types are the same as the corresponding
+	// public key hash types for this purpose.  All types are indexed when it
+	// is empty.  Skipping the types of addresses that are not
+	// of interest, such as indexing only pay-to-script-hash addresses for
+	// contract monitoring, greatly reduces the size of the index.  Queries for
+	// addresses of the types that are not indexed do not return any entries.
+	// Unknown types are ignored.  The option is persisted with the index and
+	// changing it requires the index to be dropped and rebuilt.
+	AddrTypes []uint8
+}
+
+// skipAddrTypesFlags returns the flags of the address types that are not
+// indexed for the provided types to index where the bit position of each flag
+// is the type.  None of the types are skipped when no types are provided.
+func skipAddrTypesFlags(addrTypes []uint8) uint8 {
+	if len(addrTypes) == 0 {
+		return 0
+	}
+	const allTypes = 1<<numAddrKeyTypes - 1
+	var indexed uint8
+	for _, addrType := range addrTypes {
+		if addrType >= addrKeyTypePubKeyOffset {
+			addrType -= addrKeyTypePubKeyOffset
+		}
+		if addrType < numAddrKeyTypes {
+			indexed |= 1 << addrType
+		}
+	}
+	return allTypes &^ indexed
+}
+
+// newAddrIndex returns a new address index instance for the provided database
+// and network with the provided configuration applied and all of its in-memory
+// state, including the unconfirmed address index, initialized.
+//
+// Unlike NewAddrIndex, it does not require an index subscriber or a spend
+// consumer, nor does it subscribe to or initialize the index.  This allows the
+// unconfirmed (memory-only) address index, which does not access the database,
+// to be used in isolation such as in tests.
+func newAddrIndex(db database.DB, chainParams *chaincfg.Params, cfg *AddrIndexConfig) *AddrIndex {
+	if cfg == nil {
+		cfg = &AddrIndexConfig{}
+	}
+
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
+	var queue *unconfirmedQueue
+	if cfg.AsyncUnconfirmed {
+		queue = newUnconfirmedQueue()
+	}
+
+	return &AddrIndex{
+		db:                         newCommitHookDB(db),
+		chainParams:                chainParams,
+		metrics:                    metrics,
+		skipCoinbaseOutputs:        cfg.SkipCoinbaseOutputs,
+		indexRedeemScriptAddrs:     cfg.IndexRedeemScriptAddrs,
+		extendedKeys:               cfg.ExtendedKeys,
+		indexTicketCommitmentAddrs: cfg.IndexTicketCommitmentAddrs,
+		changeHeuristic:            cfg.ChangeHeuristic,
+		indexRewardSources:         cfg.IndexRewardSources,
+		creditFlags:                cfg.CreditFlags,
+		indexGenesisOutputs:        cfg.IndexGenesisOutputs,
+		indexAtomicSwapAddrs:       cfg.IndexAtomicSwapAddrs,
+		trackDisapprovals:          cfg.TrackDisapprovals,
+		trackInputIndexes:          cfg.TrackInputIndexes,
+		trackTotals:                cfg.TrackAddrTotals,
+		skipAddrTypes:              skipAddrTypesFlags(cfg.AddrTypes),
+		addrFilterSize:             cfg.AddrFilterSize,
+		retentionWindow:            cfg.RetentionWindow,
+		catchUpBatchSize:           cfg.CatchUpBatchSize,
+		storeBlockTimes:            cfg.StoreBlockTimes,
+		pins:                       newAddrPinCache(),
+		scriptAddrExtractor:        cfg.ScriptAddrExtractor,
+		onUnconfirmedTxEvicted:     cfg.OnUnconfirmedTxEvicted,
+		subscribers:                make(map[chan bool]struct{}),
+		tipWaiters:                 make(map[chan struct{}]struct{}),
+		txnsByAddr:                 make(map[[addrKeySize]byte]map[chainhash.Hash]*dcrutil.Tx),
+		addrsByTx:                  make(map[chainhash.Hash]map[[addrKeySize]byte]struct{}),
+		unconfirmedSubs:            make(map[[addrKeySize]byte]map[chan struct{}]struct{}),
+		unconfirmedOrder:           list.New(),
+		unconfirmedElems:           make(map[chainhash.Hash]*list.Element),
+		unconfirmedQueue:           queue,
+	}
+}
+
+// NewAddrIndex returns a new instance of an indexer that is used to create a
+// mapping of all addresses in the blockchain to the respective transactions
+// that involve them.  The provided configuration may be nil in order to use the
+// default configuration.
+func NewAddrIndex(subscriber *IndexSubscriber, db database.DB, chain ChainQueryer, cfg *AddrIndexConfig) (*AddrIndex, error) {
+	// The address index depends on the transaction index, so ensure it is
+	// subscribed before doing anything else.
+	subscriber.mtx.Lock()
+	_, hasTxIndex := subscriber.findSubscription(txIndexName)
+	subscriber.mtx.Unlock()
+	if !hasTxIndex {
+		return nil, ErrTxIndexRequired
+	}
+
+	idx := newAddrIndex(db, chain.ChainParams(), cfg)
+	idx.chain = chain
+	idx.cancel = subscriber.cancel
+
+	sc, err := chain.FetchSpendConsumer(idx.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, ok := sc.(*SpendConsumer)
+	if !ok {
+		return nil, errors.New("consumer not of type SpendConsumer")
+	}
+
+	idx.consumer = consumer
+
+	// The address index is an optional index. It depends on the
+	// transaction index and as a result synchronously updates with it.
+	sub, err := subscriber.Subscribe(idx, txIndexName)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.sub = sub
+
+	err = idx.Init(subscriber.ctx, idx.chain.ChainParams())
+	if err != nil {
+		return nil, err
+	}
 
-	// Remove all of the index entries for each address.
-	bucket := dbTx.Metadata().Bucket(addrIndexKey)
-	for addrKey, txIdxs := range addrsToTxns {
-		err := dbRemoveAddrIndexEntries(bucket, addrKey, len(txIdxs))
-		if err != nil {
-			return err
-		}
+	if idx.unconfirmedQueue != nil {
+		go idx.unconfirmedQueueHandler(subscriber.ctx)
 	}
 
-	// Update the current index tip.
-	return dbPutIndexerTip(dbTx, idx.Key(), &block.MsgBlock().Header.PrevBlock,
-		int32(block.Height()-1))
+	return idx, nil
 }
 
-// EntriesForAddress returns a slice of details which identify each transaction,
-// including a block region, that involves the passed address according to the
-// specified number to skip, number requested, and whether or not the results
-// should be reversed.  It also returns the number actually skipped since it
-// could be less in the case where there are not enough entries.
+// AddrIndexSnapshot provides a consistent read-only view of the address index
+// that may be reused across many queries without starting a new database
+// transaction for each of them.  Queries made via a snapshot do not observe any
+// changes made to the index after the snapshot was created.
 //
-// NOTE: These results only include transactions confirmed in blocks.  See the
-// UnconfirmedTxnsForAddress method for obtaining unconfirmed transactions
-// that involve a given address.
+// A snapshot holds an open read-only database transaction for its entire
+// lifetime, which pins the state of the database as of its creation and
+// prevents the database from being closed.  Therefore, snapshots should be
+// short lived and they MUST be released with Close once they are no longer
+// needed.
+type AddrIndexSnapshot struct {
+	idx *AddrIndex
+
+	mtx  sync.Mutex
+	dbTx database.Tx
+}
+
+// Snapshot returns a consistent read-only view of the address index as of the
+// time it is called.  The caller MUST call Close on the returned snapshot when
+// it is no longer needed.
 //
 // This function is safe for concurrent access.
-func (idx *AddrIndex) EntriesForAddress(dbTx database.Tx, addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
-	addrKey, err := addrToKey(addr)
+func (idx *AddrIndex) Snapshot() (*AddrIndexSnapshot, error) {
+	dbTx, err := idx.db.Begin(false)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-
-	var entries []TxIndexEntry
-	var skipped uint32
-	err = idx.db.View(func(dbTx database.Tx) error {
-		// Create closure to lookup the block hash given the ID using
-		// the database transaction.
-		fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
-			// Deserialize and populate the result.
-			return dbFetchBlockHashBySerializedID(dbTx, id)
-		}
-
-		var err error
-		addrIdxBucket := dbTx.Metadata().Bucket(addrIndexKey)
-		entries, skipped, err = dbFetchAddrIndexEntries(addrIdxBucket,
-			addrKey, numToSkip, numRequested, reverse,
-			fetchBlockHash)
-		return err
-	})
-
-	return entries, skipped, err
+	return &AddrIndexSnapshot{idx: idx, dbTx: dbTx}, nil
 }
 
-// indexUnconfirmedAddresses modifies the unconfirmed (memory-only) address
-// index to include mappings for the addresses encoded by the passed public key
-// script to the transaction.
+// EntriesForAddress returns the same results as AddrIndex.EntriesForAddress as
+// of the time the snapshot was created.  ErrSnapshotClosed is returned when the
+// snapshot has been closed.
 //
 // This function is safe for concurrent access.
-func (idx *AddrIndex) indexUnconfirmedAddresses(scriptVersion uint16, pkScript []byte, tx *dcrutil.Tx, isSStx bool, isTreasuryEnabled bool) {
-	// The error is ignored here since the only reason it can fail is if the
-	// script fails to parse and it was already validated before being
-	// admitted to the mempool.
-	class, addrs, _, _ := txscript.ExtractPkScriptAddrs(scriptVersion, pkScript,
-		idx.chainParams, isTreasuryEnabled)
-
-	if isSStx && class == txscript.NullDataTy {
-		addr, err := stake.AddrFromSStxPkScrCommitment(pkScript, idx.chainParams)
-		if err != nil {
-			// Fail if this fails to decode. It should.
-			return
-		}
-
-		addrs = append(addrs, addr)
+func (s *AddrIndexSnapshot) EntriesForAddress(addr stdaddr.Address, numToSkip, numRequested uint32, reverse bool) ([]TxIndexEntry, uint32, error) {
+	addrKey, err := s.idx.keyForAddr(addr)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	for _, addr := range addrs {
-		// Ignore unsupported address types.
-		addrKey, err := addrToKey(addr)
-		if err != nil {
-			continue
-		}
-
-		// Add a mapping from the address to the transaction.
-		idx.unconfirmedLock.Lock()
-		addrIndexEntry := idx.txnsByAddr[addrKey]
-		if addrIndexEntry == nil {
-			addrIndexEntry = make(map[chainhash.Hash]*dcrutil.Tx)
-			idx.txnsByAddr[addrKey] = addrIndexEntry
-		}
-		addrIndexEntry[*tx.Hash()] = tx
-
-		// Add a mapping from the transaction to the address.
-		addrsByTxEntry := idx.addrsByTx[*tx.Hash()]
-		if addrsByTxEntry == nil {
-			addrsByTxEntry = make(map[[addrKeySize]byte]struct{})
-			idx.addrsByTx[*tx.Hash()] = addrsByTxEntry
-		}
-		addrsByTxEntry[addrKey] = struct{}{}
-		idx.unconfirmedLock.Unlock()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.dbTx == nil {
+		return nil, 0, ErrSnapshotClosed
 	}
+	return s.idx.entriesForAddressKey(s.dbTx, addrKey, numToSkip,
+		numRequested, reverse)
 }
 
-// AddUnconfirmedTx adds all addresses related to the transaction to the
-// unconfirmed (memory-only) address index.
-//
-// NOTE: This transaction MUST have already been validated by the memory pool
-// before calling this function with it and have all of the inputs available via
-// the provided previous scripter interface.  Failure to do so could result in
-// some or all addresses not being indexed.
+// EntriesForAddressPage returns the same results as
+// AddrIndex.EntriesForAddressPage as of the time the snapshot was created.
+// ErrSnapshotClosed is returned when the snapshot has been closed.
 //
 // This function is safe for concurrent access.
-func (idx *AddrIndex) AddUnconfirmedTx(tx *dcrutil.Tx, prevScripts PrevScripter, isTreasuryEnabled bool) {
-	// Index addresses of all referenced previous transaction outputs.
-	//
-	// The existence checks are elided since this is only called after the
-	// transaction has already been validated and thus all inputs are
-	// already known to exist.
-	msgTx := tx.MsgTx()
-	isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
-	for i, txIn := range msgTx.TxIn {
-		// Skip stakebase.
-		if i == 0 && isSSGen {
-			continue
-		}
+func (s *AddrIndexSnapshot) EntriesForAddressPage(addr stdaddr.Address, cursor []byte, numRequested uint32, reverse bool) ([]TxIndexEntry, []byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.dbTx == nil {
+		return nil, nil, ErrSnapshotClosed
+	}
+	return s.idx.EntriesForAddressPage(s.dbTx, addr, cursor, numRequested,
+		reverse)
+}
 
-		version, pkScript, ok := prevScripts.PrevScript(&txIn.PreviousOutPoint)
-		if !ok {
-			// Ignore missing entries.  This should never happen in practice
-			// since the function comments specifically call out all inputs must
-			// be available.
-			continue
-		}
-		idx.indexUnconfirmedAddresses(version, pkScript, tx, false,
-			isTreasuryEnabled)
+// HasAddress returns the same result as AddrIndex.HasAddress as of the time the
+// snapshot was created.  ErrSnapshotClosed is returned when the snapshot has
+// been closed.
+//
+// This function is safe for concurrent access.
+func (s *AddrIndexSnapshot) HasAddress(addr stdaddr.Address) (bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.dbTx == nil {
+		return false, ErrSnapshotClosed
 	}
 
-	// Index addresses of all created outputs.
-	isSStx := stake.IsSStx(msgTx)
-	for _, txOut := range msgTx.TxOut {
-		idx.indexUnconfirmedAddresses(txOut.Version, txOut.PkScript, tx,
-			isSStx, isTreasuryEnabled)
+	// The address filter is bypassed since it reflects the current state of
+	// the index rather than the state as of the time the snapshot was
+	// created.
+	addrKey, err := s.idx.keyForAddr(addr)
+	if err != nil {
+		return false, err
 	}
+	return hasAddressKey(s.dbTx, addrKey), nil
 }
 
-// RemoveUnconfirmedTx removes the passed transaction from the unconfirmed
-// (memory-only) address index.
+// Close releases the database transaction held by the snapshot.  The snapshot
+// may not be used for any further queries once it is closed.  Closing a
+// snapshot more than once has no effect.
 //
 // This function is safe for concurrent access.
-func (idx *AddrIndex) RemoveUnconfirmedTx(hash *chainhash.Hash) {
-	idx.unconfirmedLock.Lock()
-	defer idx.unconfirmedLock.Unlock()
-
-	// Remove all address references to the transaction from the address
-	// index and remove the entry for the address altogether if it no longer
-	// references any transactions.
-	for addrKey := range idx.addrsByTx[*hash] {
-		delete(idx.txnsByAddr[addrKey], *hash)
-		if len(idx.txnsByAddr[addrKey]) == 0 {
-			delete(idx.txnsByAddr, addrKey)
-		}
+func (s *AddrIndexSnapshot) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.dbTx == nil {
+		return nil
 	}
-
-	// Remove the entry from the transaction to address lookup map as well.
-	delete(idx.addrsByTx, *hash)
+	err := s.dbTx.Rollback()
+	s.dbTx = nil
+	return err
 }
 
-// UnconfirmedTxnsForAddress returns all transactions currently in the
-// unconfirmed (memory-only) address index that involve the passed address.
-// Unsupported address types are ignored and will result in no results.
+// DependencyLag returns the number of blocks the address index is behind the
+// transaction index it depends on.  It is negative when the address index is
+// ahead of the transaction index, which should only happen briefly while the
+// indexes are being updated.  A lag that remains positive indicates the address
+// index has stalled.  ErrTxIndexRequired is returned when the transaction index
+// does not exist.
 //
 // This function is safe for concurrent access.
-func (idx *AddrIndex) UnconfirmedTxnsForAddress(addr stdaddr.Address) []*dcrutil.Tx {
-	// Ignore unsupported address types.
-	addrKey, err := addrToKey(addr)
+func (idx *AddrIndex) DependencyLag() (int64, error) {
+	var lag int64
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		lag, err = idx.dbFetchDependencyLag(dbTx)
+		return err
+	})
+	return lag, err
+}
+
+// dbFetchDependencyLag uses an existing database transaction to return the
+// number of blocks the address index is behind the transaction index it
+// depends on.  See DependencyLag for more details.
+func (idx *AddrIndex) dbFetchDependencyLag(dbTx database.Tx) (int64, error) {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	if indexesBucket == nil || indexesBucket.Get(txIndexKey) == nil {
+		return 0, ErrTxIndexRequired
+	}
+	_, txIdxHeight, err := dbFetchIndexerTip(dbTx, txIndexKey)
 	if err != nil {
-		return nil
+		return 0, err
 	}
+	_, addrIdxHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return 0, err
+	}
+	return int64(txIdxHeight) - int64(addrIdxHeight), nil
+}
 
-	// Protect concurrent access.
-	idx.unconfirmedLock.RLock()
-	defer idx.unconfirmedLock.RUnlock()
+// Health houses a summary of the readiness of the address index.
+type Health struct {
+	// TipHeight and TipHash are the height and hash of the current tip of
+	// the index.
+	TipHeight int64
+	TipHash   chainhash.Hash
 
-	// Return a new slice with the results if there are any.  This ensures
-	// safe concurrency.
-	if txns, exists := idx.txnsByAddr[addrKey]; exists {
-		addressTxns := make([]*dcrutil.Tx, 0, len(txns))
-		for _, tx := range txns {
-			addressTxns = append(addressTxns, tx)
-		}
-		return addressTxns
+	// Synced is whether or not the tip of the index matches the current best
+	// block of the chain.
+	Synced bool
+
+	// DependencyLag is the number of blocks the index is behind the
+	// transaction index it depends on.  See DependencyLag for more details.
+	DependencyLag int64
+
+	// NumUnconfirmedTxns is the number of transactions in the unconfirmed
+	// (memory-only) address index.
+	NumUnconfirmedTxns int
+}
+
+// Health returns a summary of the readiness of the address index that consists
+// of its current tip, whether or not the tip matches the current best block of
+// the chain, how far the index is behind the transaction index it depends on,
+// and the number of transactions in the unconfirmed (memory-only) address
+// index.  ErrTxIndexRequired is returned when the transaction index does not
+// exist.
+//
+// This function does not modify the database and is safe for concurrent access.
+func (idx *AddrIndex) Health(dbTx database.Tx) (Health, error) {
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return Health{}, err
 	}
+	lag, err := idx.dbFetchDependencyLag(dbTx)
+	if err != nil {
+		return Health{}, err
+	}
+	bestHeight, bestHash := idx.chain.Best()
+	synced := bestHash != nil && *bestHash == *tipHash &&
+		bestHeight == int64(tipHeight)
+
+	return Health{
+		TipHeight:          int64(tipHeight),
+		TipHash:            *tipHash,
+		Synced:             synced,
+		DependencyLag:      lag,
+		NumUnconfirmedTxns: idx.UnconfirmedStats().NumTxns,
+	}, nil
+}
 
-	return nil
+// SpendConsumerTipStatus houses the tip of the spend consumer of the address
+// index along with the tip of the index it is expected to track.
+type SpendConsumerTipStatus struct {
+	// ConsumerTip is the current tip of the spend consumer.  It is nil when
+	// the consumer has not been initialized.
+	ConsumerTip *chainhash.Hash
+
+	// IndexTipHeight and IndexTipHash are the height and hash of the current
+	// tip of the index.
+	IndexTipHeight int64
+	IndexTipHash   chainhash.Hash
+
+	// Diverged is whether or not the tip of the spend consumer differs from
+	// the tip of the index.
+	Diverged bool
 }
 
-// NewAddrIndex returns a new instance of an indexer that is used to create a
-// mapping of all addresses in the blockchain to the respective transactions
-// that involve them.
-func NewAddrIndex(subscriber *IndexSubscriber, db database.DB, chain ChainQueryer) (*AddrIndex, error) {
-	idx := &AddrIndex{
-		db:          db,
-		chain:       chain,
-		chainParams: chain.ChainParams(),
-		subscribers: make(map[chan bool]struct{}),
-		txnsByAddr:  make(map[[addrKeySize]byte]map[chainhash.Hash]*dcrutil.Tx),
-		addrsByTx:   make(map[chainhash.Hash]map[[addrKeySize]byte]struct{}),
-		cancel:      subscriber.cancel,
+// SpendConsumerTip returns the current tip of the spend consumer the address
+// index uses to inform the spend journal pruner which spend journal entries it
+// still needs along with whether or not it has diverged from the current tip of
+// the index.
+//
+// The tip of the consumer is updated as each block is connected to or
+// disconnected from the index, so a divergence indicates the consumer is
+// reporting its dependencies for the wrong chain, which signals a bug in the
+// path that removes the spend consumer dependencies.  Note that the tip of the
+// consumer is updated after the database transaction that updates the index
+// tip is committed, so a divergence may be briefly observed while a block is
+// being processed.
+//
+// This function does not modify the database and is safe for concurrent access.
+func (idx *AddrIndex) SpendConsumerTip() (SpendConsumerTipStatus, error) {
+	if idx.consumer == nil {
+		return SpendConsumerTipStatus{}, fmt.Errorf("%s does not have a "+
+			"spend consumer", addrIndexName)
 	}
 
-	sc, err := chain.FetchSpendConsumer(idx.Name())
+	tipHeight, tipHash, err := idx.Tip()
 	if err != nil {
-		return nil, err
+		return SpendConsumerTipStatus{}, err
 	}
-
-	consumer, ok := sc.(*SpendConsumer)
-	if !ok {
-		return nil, errors.New("consumer not of type SpendConsumer")
+	consumerTip := idx.consumer.Tip()
+	diverged := consumerTip == nil || *consumerTip != *tipHash
+	if diverged {
+		log.Debugf("%s: spend consumer tip %v diverged from index tip %v "+
+			"(height %d)", idx.Name(), consumerTip, tipHash, tipHeight)
 	}
+	return SpendConsumerTipStatus{
+		ConsumerTip:    consumerTip,
+		IndexTipHeight: tipHeight,
+		IndexTipHash:   *tipHash,
+		Diverged:       diverged,
+	}, nil
+}
 
-	idx.consumer = consumer
+// spendConsumerDepsName is the name used to identify the spend consumer
+// dependencies maintained by the spend journal pruner in companion orphan
+// reports.
+const spendConsumerDepsName = "spendconsumerdeps"
 
-	// The address index is an optional index. It depends on the
-	// transaction index and as a result synchronously updates with it.
-	sub, err := subscriber.Subscribe(idx, txIndexName)
+// CompanionOrphan describes an entry in one of the companion buckets that house
+// supplementary data for the address index that no longer corresponds to any
+// data in the main address index bucket or to any block known to the index.
+type CompanionOrphan struct {
+	// Bucket is the name of the bucket that houses the orphaned entry.
+	Bucket string
+
+	// Key is the key of the orphaned entry.
+	Key []byte
+
+	// Reason describes why the entry is orphaned.
+	Reason string
+}
+
+// VerifyCompanionConsistency cross-checks the entries of each of the companion
+// buckets that house supplementary data for the address index, such as the
+// ticket commitment amounts, address totals, block timestamps, and vote reward
+// sources, against the main address index bucket and the blocks known to the
+// index and returns the entries that are orphaned, such as due to a bug when
+// disconnecting blocks.  It also ensures every spend journal dependency of the
+// index references a block the chain still knows about.
+//
+// An entry that references a block is orphaned when the block is not in the
+// main chain at or below the index tip and an entry for an address is orphaned
+// when the address does not have any entries in the index.  The latter check
+// is skipped when a retention window is configured since expired entries are
+// removed from the main bucket without their companion data.
+//
+// The orphans are returned in the order of the buckets and keys that house
+// them.  No orphans are returned when the companion data is consistent.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) VerifyCompanionConsistency(dbTx database.Tx) ([]CompanionOrphan, error) {
+	_, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
 	if err != nil {
 		return nil, err
 	}
 
-	idx.sub = sub
+	// isKnownBlock returns whether or not the block with the provided hash is
+	// in the main chain at or below the index tip.  The results are cached
+	// since the entries of multiple addresses commonly reference the same
+	// blocks.
+	known := make(map[chainhash.Hash]bool)
+	isKnownBlock := func(hash *chainhash.Hash) bool {
+		if isKnown, ok := known[*hash]; ok {
+			return isKnown
+		}
+		height, err := idx.chain.BlockHeightByHash(hash)
+		isKnown := err == nil && height <= int64(tipHeight)
+		known[*hash] = isKnown
+		return isKnown
+	}
 
-	err = idx.Init(subscriber.ctx, idx.chain.ChainParams())
+	// checkAddr returns the reason the companion data for the address key at
+	// the start of the provided key is orphaned, if any.
+	checkAddr := func(k []byte) string {
+		if idx.retentionWindow != 0 {
+			return ""
+		}
+		var addrKey [addrKeySize]byte
+		copy(addrKey[:], k)
+		if !hasAddressKey(dbTx, addrKey) {
+			return "address has no entries"
+		}
+		return ""
+	}
+
+	const (
+		malformed    = "malformed entry"
+		unknownBlock = "references a block that is not in the index"
+	)
+	checks := []struct {
+		bucketKey []byte
+		check     func(k, v []byte) (string, error)
+	}{{
+		bucketKey: addrCommitmentIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != addrCommitmentKeySize ||
+				len(v) != addrCommitmentEntrySize {
+
+				return malformed, nil
+			}
+			if reason := checkAddr(k); reason != "" {
+				return reason, nil
+			}
+			hash, err := dbFetchBlockHashByID(dbTx, byteOrder.Uint32(v[0:4]))
+			if errors.Is(err, errNoBlockIDEntry) {
+				return unknownBlock, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			if !isKnownBlock(hash) {
+				return unknownBlock, nil
+			}
+			return "", nil
+		},
+	}, {
+		bucketKey: addrTotalsIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != addrKeySize || len(v) != addrTotalsEntrySize {
+				return malformed, nil
+			}
+			return checkAddr(k), nil
+		},
+	}, {
+		bucketKey: addrBlockTimeIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != chainhash.HashSize || len(v) != addrBlockTimeEntrySize {
+				return malformed, nil
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			if !isKnownBlock(&hash) {
+				return unknownBlock, nil
+			}
+			return "", nil
+		},
+	}, {
+		bucketKey: addrRewardSourceIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != addrRewardSourceKeySize ||
+				len(v) != chainhash.HashSize {
+
+				return malformed, nil
+			}
+			if reason := checkAddr(k); reason != "" {
+				return reason, nil
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k[addrKeySize:])
+			if !isKnownBlock(&hash) {
+				return unknownBlock, nil
+			}
+			return "", nil
+		},
+	}, {
+		bucketKey: addrUnindexedVersionIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != 4 {
+				return malformed, nil
+			}
+			if height := byteOrder.Uint32(k); int64(height) > int64(tipHeight) {
+				return "references a height above the index tip", nil
+			}
+			return "", nil
+		},
+	}, {
+		bucketKey: addrDisapprovedIndexKey,
+		check: func(k, v []byte) (string, error) {
+			if len(k) != chainhash.HashSize || len(v) != chainhash.HashSize {
+				return malformed, nil
+			}
+			var hash, disapprovedBy chainhash.Hash
+			copy(hash[:], k)
+			copy(disapprovedBy[:], v)
+			if !isKnownBlock(&hash) || !isKnownBlock(&disapprovedBy) {
+				return unknownBlock, nil
+			}
+			return "", nil
+		},
+	}, {
+		bucketKey: addrInputIndexKey,
+		check: func(k, v []byte) (string, error) {
+			switch len(k) {
+			case chainhash.HashSize:
+				if len(v) != 4 {
+					return malformed, nil
+				}
+			case chainhash.HashSize + addrKeySize:
+				if reason := checkAddr(k[chainhash.HashSize:]); reason != "" {
+					return reason, nil
+				}
+			default:
+				return malformed, nil
+			}
+			var hash chainhash.Hash
+			copy(hash[:], k)
+			if !isKnownBlock(&hash) {
+				return unknownBlock, nil
+			}
+			return "", nil
+		},
+	}}
+
+	var orphans []CompanionOrphan
+	meta := dbTx.Metadata()
+	for _, c := range checks {
+		bucket := meta.Bucket(c.bucketKey)
+		if bucket == nil {
+			continue
+		}
+		err := bucket.ForEach(func(k, v []byte) error {
+			reason, err := c.check(k, v)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				orphans = append(orphans, CompanionOrphan{
+					Bucket: string(c.bucketKey),
+					Key:    append([]byte(nil), k...),
+					Reason: reason,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Ensure every spend journal dependency of the index references a block
+	// the chain still knows about.
+	deps, err := spendpruner.FetchSpendConsumerDeps(dbTx)
 	if err != nil {
 		return nil, err
 	}
+	depHashes := make([]chainhash.Hash, 0, len(deps))
+	for hash, consumerIDs := range deps {
+		for _, consumerID := range consumerIDs {
+			if consumerID == idx.Name() {
+				depHashes = append(depHashes, hash)
+				break
+			}
+		}
+	}
+	sort.Slice(depHashes, func(i, j int) bool {
+		return bytes.Compare(depHashes[i][:], depHashes[j][:]) < 0
+	})
+	for i := range depHashes {
+		hash := &depHashes[i]
+		if _, err := idx.chain.BlockHeaderByHash(hash); err != nil {
+			orphans = append(orphans, CompanionOrphan{
+				Bucket: spendConsumerDepsName,
+				Key:    append([]byte(nil), hash[:]...),
+				Reason: "references a block that is not known to the chain",
+			})
+		}
+	}
 
-	return idx, nil
+	return orphans, nil
 }
 
 // DropAddrIndex drops the address index from the provided database if it
 // exists.
 func DropAddrIndex(ctx context.Context, db database.DB) error {
+	// Drop the ticket commitment amounts and address totals buckets first
+	// while the index is marked as being dropped so the drop is resumed if it
+	// is interrupted.
+	exists, err := existsIndex(db, addrIndexKey, addrIndexName)
+	if err != nil {
+		return err
+	}
+	auxBucketKeys := [][]byte{addrCommitmentIndexKey, addrTotalsIndexKey,
+		addrBlockTimeIndexKey, addrRewardSourceIndexKey,
+		addrUnindexedVersionIndexKey, addrDisapprovedIndexKey,
+		addrInputIndexKey}
+	for _, bucketKey := range auxBucketKeys {
+		var bucketExists bool
+		err = db.View(func(dbTx database.Tx) error {
+			bucketExists = dbTx.Metadata().Bucket(bucketKey) != nil
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !exists || !bucketExists {
+			continue
+		}
+
+		if err := markIndexDeletion(db, addrIndexKey); err != nil {
+			return err
+		}
+		err := incrementalFlatDrop(ctx, db, bucketKey, addrIndexName)
+		if err != nil {
+			return err
+		}
+		err = db.Update(func(dbTx database.Tx) error {
+			return dbTx.Metadata().DeleteBucket(bucketKey)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return dropFlatIndex(ctx, db, addrIndexKey, addrIndexName)
 }
 
@@ -1183,6 +9079,35 @@ func (*AddrIndex) DropIndex(ctx context.Context, db database.DB) error {
 	return DropAddrIndex(ctx, db)
 }
 
+// DropInProgress returns whether or not a drop of the address index from the
+// provided database was started and has not yet finished, such as when it was
+// interrupted.  An index in this state must not be used until the drop is
+// finished via ResumeDrop or by initializing the index.
+func (*AddrIndex) DropInProgress(db database.DB) (bool, error) {
+	return indexDropInProgress(db, addrIndexKey)
+}
+
+// ResumeDrop finishes dropping the address index from the provided database
+// when a drop was started and has not yet finished.  It does nothing when no
+// drop is in progress.  This allows an interrupted drop to be finished without
+// initializing the index.
+//
+// Like the drop it resumes, it may be interrupted by canceling the provided
+// context, in which case the drop remains in progress and may be resumed
+// again.  The index must not be in use while it is being dropped.
+func (*AddrIndex) ResumeDrop(ctx context.Context, db database.DB) error {
+	drop, err := indexDropInProgress(db, addrIndexKey)
+	if err != nil {
+		return err
+	}
+	if !drop {
+		return nil
+	}
+
+	log.Infof("Resuming %s drop", addrIndexName)
+	return DropAddrIndex(ctx, db)
+}
+
 // ProcessNotification indexes the provided notification based on its
 // notification type.
 //
@@ -1193,16 +9118,39 @@ func (idx *AddrIndex) ProcessNotification(dbTx database.Tx, ntfn *IndexNtfn) err
 		err := idx.connectBlock(dbTx, ntfn.Block, ntfn.Parent,
 			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
 		if err != nil {
-			return fmt.Errorf("%s: unable to connect block: %v", idx.Name(), err)
+			return ConnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
 		}
 
-		idx.consumer.UpdateTip(ntfn.Block.Hash())
+		idx.updateConsumerTip(dbTx, ntfn.Block.Hash())
 
 	case DisconnectNtfn:
-		err := idx.disconnectBlock(dbTx, ntfn.Block, ntfn.Parent,
-			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
+		// Determine whether or not the treasury agenda is active for the
+		// block from the chain rather than the notification since the
+		// entries removed must be identified exactly as they were when the
+		// block was connected.
+		isTreasuryEnabled, err := treasuryEnabledForBlock(idx.chain,
+			ntfn.Block)
+		if err != nil {
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
+		}
+		if isTreasuryEnabled != ntfn.IsTreasuryEnabled {
+			log.Warnf("%s: ignoring stale treasury agenda state %v in "+
+				"disconnect notification for block %s (height %d)",
+				idx.Name(), ntfn.IsTreasuryEnabled, ntfn.Block.Hash(),
+				ntfn.Block.Height())
+		}
+
+		err = idx.disconnectBlock(dbTx, ntfn.Block, ntfn.Parent,
+			ntfn.PrevScripts, isTreasuryEnabled)
 		if err != nil {
-			log.Errorf("%s: unable to disconnect block: %v", idx.Name(), err)
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
 		}
 
 		// Remove the associated spend consumer dependency for the disconnected
@@ -1214,7 +9162,7 @@ func (idx *AddrIndex) ProcessNotification(dbTx database.Tx, ntfn *IndexNtfn) err
 				"for block %s: %v", idx.Name(), ntfn.Block.Hash(), err)
 		}
 
-		idx.consumer.UpdateTip(ntfn.Parent.Hash())
+		idx.updateConsumerTip(dbTx, ntfn.Parent.Hash())
 
 	default:
 		return fmt.Errorf("%s: unknown notification type provided: %d",
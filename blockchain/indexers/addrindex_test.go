@@ -8,14 +8,28 @@ package indexers
 import (
 	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/decred/dcrd/blockchain/stake/v4"
 	"github.com/decred/dcrd/blockchain/v4/chaingen"
+	"github.com/decred/dcrd/blockchain/v4/internal/spendpruner"
+	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrutil/v4"
 	"github.com/decred/dcrd/txscript/v4"
+	"github.com/decred/dcrd/txscript/v4/stdaddr"
 	"github.com/decred/dcrd/wire"
 )
 
@@ -281,6 +295,309 @@ nextTest:
 	}
 }
 
+// TestPutAddrIndexLevels ensures replacing all of the levels for an address key
+// with a given set of entries lays them out according to the level-based rules
+// described by the address index documentation such that entries can still be
+// added and removed afterwards.
+func TestPutAddrIndexLevels(t *testing.T) {
+	t.Parallel()
+
+	const maxEntries = level0MaxEntries * 20
+	key := [addrKeySize]byte{0: addrKeyTypePubKeyHash, 1: 0x01}
+	for numEntries := 0; numEntries <= maxEntries; numEntries++ {
+		// Populate the bucket with more entries than are being put to ensure
+		// any existing levels are replaced.
+		bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+		for i := 0; i < maxEntries+1; i++ {
+			err := dbPutAddrIndexEntry(bucket, key, uint32(i), wire.TxLoc{}, 0)
+			if err != nil {
+				t.Fatalf("unexpected error inserting entry %d: %v", i, err)
+			}
+		}
+
+		// Replace the levels with entries that are numbered in order.
+		serialized := make([]byte, 0, numEntries*txEntrySize)
+		for i := 0; i < numEntries; i++ {
+			serialized = append(serialized, serializeAddrIndexEntry(uint32(i),
+				wire.TxLoc{}, 0)...)
+		}
+		if err := dbPutAddrIndexLevels(bucket, key, serialized); err != nil {
+			t.Fatalf("%d entries: unexpected error: %v", numEntries, err)
+		}
+		if err := bucket.sanityCheck(key, numEntries); err != nil {
+			t.Fatalf("%d entries: sanity check fail: %v", numEntries, err)
+		}
+		got := dbFetchAllSerializedAddrIndexEntries(bucket, key)
+		if !bytes.Equal(got, serialized) {
+			t.Fatalf("%d entries: mismatched entries", numEntries)
+		}
+
+		// Ensure entries can be added to and removed from the new levels.
+		err := dbPutAddrIndexEntry(bucket, key, uint32(numEntries),
+			wire.TxLoc{}, 0)
+		if err != nil {
+			t.Fatalf("%d entries: unexpected error inserting entry: %v",
+				numEntries, err)
+		}
+		if err := bucket.sanityCheck(key, numEntries+1); err != nil {
+			t.Fatalf("%d entries: sanity check fail after insert: %v",
+				numEntries, err)
+		}
+		if err := dbRemoveAddrIndexEntries(bucket, key, 2); err != nil {
+			if numEntries > 0 {
+				t.Fatalf("%d entries: unexpected error removing entries: %v",
+					numEntries, err)
+			}
+			continue
+		}
+		if err := bucket.sanityCheck(key, numEntries-1); err != nil {
+			t.Fatalf("%d entries: sanity check fail after removal: %v",
+				numEntries, err)
+		}
+	}
+}
+
+// TestAddrIndexMaxLevel ensures adding entries for a single address key beyond
+// what the maximum allowed level can hold results in an AssertError without
+// modifying the existing levels and that the maximum number of entries for a
+// level beyond the maximum allowed level is rejected.
+func TestAddrIndexMaxLevel(t *testing.T) {
+	t.Parallel()
+
+	// Fill all levels up to and including the max allowed level.
+	const maxLevel = 3
+	key := [addrKeySize]byte{0: addrKeyTypePubKeyHash, 1: 0x01}
+	bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	numEntries, err := minEntriesToReachLevel(maxLevel + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numEntries--
+	for i := 0; i < numEntries; i++ {
+		err := dbPutAddrIndexEntryMaxLevel(bucket, key, uint32(i),
+			wire.TxLoc{}, 0, maxLevel)
+		if err != nil {
+			t.Fatalf("unexpected error inserting entry %d: %v", i, err)
+		}
+	}
+	if err := bucket.sanityCheck(key, numEntries); err != nil {
+		t.Fatalf("sanity check fail: %v", err)
+	}
+
+	// Ensure adding another entry is rejected and does not modify the levels.
+	want := bucket.Clone()
+	err = dbPutAddrIndexEntryMaxLevel(bucket, key, uint32(numEntries),
+		wire.TxLoc{}, 0, maxLevel)
+	var aErr AssertError
+	if !errors.As(err, &aErr) {
+		t.Fatalf("unexpected error inserting entry beyond max level: %v", err)
+	}
+	if !reflect.DeepEqual(bucket.levels, want.levels) {
+		t.Fatalf("levels modified by rejected insert:\ngot: %s\nwant: %s",
+			bucket.printLevels(key), want.printLevels(key))
+	}
+
+	// Ensure the max number of entries is only available up to the real max
+	// allowed level.
+	maxEntries, err := maxEntriesForLevel(maxAddrIndexLevel)
+	if err != nil {
+		t.Fatalf("unexpected error for max level: %v", err)
+	}
+	if maxEntries*txEntrySize > math.MaxInt32 {
+		t.Fatalf("max level size of %d bytes overflows", maxEntries*txEntrySize)
+	}
+	_, err = maxEntriesForLevel(maxAddrIndexLevel + 1)
+	if !errors.As(err, &aErr) {
+		t.Fatalf("unexpected error for level beyond max: %v", err)
+	}
+}
+
+// TestAddrIndexLevelSizesNoOverflow ensures the number of entries and bytes
+// involved in the level calculations fit in a signed 32-bit integer for every
+// allowed level, so they never overflow on platforms with 32-bit integers, and
+// that the levels beyond the allowed ones are rejected rather than wrapping.
+func TestAddrIndexLevelSizesNoOverflow(t *testing.T) {
+	t.Parallel()
+
+	for level := 0; level <= math.MaxUint8; level++ {
+		level := uint8(level)
+		minEntries, minErr := minEntriesToReachLevel(level)
+		maxEntries, maxErr := maxEntriesForLevel(level)
+		var aErr AssertError
+		if level > maxAddrIndexLevel+1 {
+			if !errors.As(minErr, &aErr) {
+				t.Fatalf("level %d: unexpected min entries error: %v", level,
+					minErr)
+			}
+		} else if minErr != nil {
+			t.Fatalf("level %d: unexpected min entries error: %v", level,
+				minErr)
+		}
+		if level > maxAddrIndexLevel {
+			if !errors.As(maxErr, &aErr) {
+				t.Fatalf("level %d: unexpected max entries error: %v", level,
+					maxErr)
+			}
+			continue
+		}
+		if maxErr != nil {
+			t.Fatalf("level %d: unexpected max entries error: %v", level,
+				maxErr)
+		}
+
+		// Perform the same calculations done when removing entries with
+		// 64-bit integers and ensure they fit in a 32-bit integer.
+		if level == 0 {
+			continue
+		}
+		prevMinEntries, err := minEntriesToReachLevel(level - 1)
+		if err != nil {
+			t.Fatalf("level %d: unexpected min entries error: %v", level, err)
+		}
+		sums := []int64{
+			int64(minEntries),
+			int64(maxEntries) * txEntrySize,
+			int64(maxEntries/2) + int64(prevMinEntries),
+			(int64(maxEntries) + int64(minEntries)) * txEntrySize,
+		}
+		for i, sum := range sums {
+			if sum < 0 || sum > math.MaxInt32 {
+				t.Fatalf("level %d: calculation %d overflows a 32-bit "+
+					"integer: %d", level, i, sum)
+			}
+		}
+	}
+}
+
+// TestFetchAddrIndexEntriesBoundaries ensures fetching entries from the address
+// index works as expected for boundary values of the number of entries to skip
+// and number requested, including values whose sum overflows a uint32.
+func TestFetchAddrIndexEntriesBoundaries(t *testing.T) {
+	t.Parallel()
+
+	// Populate multiple levels of a mock address index bucket with entries
+	// that are identified by their start offset.
+	const numEntries = level0MaxEntries*3 + 1
+	key := [addrKeySize]byte{0: addrKeyTypePubKeyHash, 1: 0x01}
+	bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	for i := 0; i < numEntries; i++ {
+		txLoc := wire.TxLoc{TxStart: i}
+		err := dbPutAddrIndexEntry(bucket, key, uint32(i), txLoc, 0)
+		if err != nil {
+			t.Fatalf("unexpected error inserting entry %d: %v", i, err)
+		}
+	}
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return &chainhash.Hash{}, nil
+	}
+
+	const maxUint32 = ^uint32(0)
+	tests := []struct {
+		name         string
+		numToSkip    uint32
+		numRequested uint32
+		reverse      bool
+		wantSkipped  uint32
+		wantOffsets  []uint32 // expected start offsets of the entries
+	}{{
+		name:         "reverse max requested",
+		numToSkip:    0,
+		numRequested: maxUint32,
+		reverse:      true,
+		wantSkipped:  0,
+		wantOffsets:  []uint32{24, 23, 22},
+	}, {
+		name:         "reverse skip one with max requested (overflows)",
+		numToSkip:    1,
+		numRequested: maxUint32,
+		reverse:      true,
+		wantSkipped:  1,
+		wantOffsets:  []uint32{23, 22, 21},
+	}, {
+		name:         "reverse max skip and max requested (overflows)",
+		numToSkip:    maxUint32,
+		numRequested: maxUint32,
+		reverse:      true,
+		wantSkipped:  numEntries,
+	}, {
+		name:         "forward skip one with max requested",
+		numToSkip:    1,
+		numRequested: maxUint32,
+		reverse:      false,
+		wantSkipped:  1,
+		wantOffsets:  []uint32{1, 2, 3},
+	}, {
+		name:         "reverse normal pagination",
+		numToSkip:    2,
+		numRequested: 3,
+		reverse:      true,
+		wantSkipped:  2,
+		wantOffsets:  []uint32{22, 21, 20},
+	}}
+
+	for _, test := range tests {
+		entries, skipped, err := dbFetchAddrIndexEntries(bucket, key,
+			test.numToSkip, test.numRequested, test.reverse, fetchBlockHash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if skipped != test.wantSkipped {
+			t.Fatalf("%s: unexpected number skipped: got %d, want %d",
+				test.name, skipped, test.wantSkipped)
+		}
+
+		// Only the first few entries are checked for the cases that
+		// request everything, but ensure the total is correct.
+		wantLen := len(test.wantOffsets)
+		if test.numRequested == maxUint32 && skipped < numEntries {
+			wantLen = numEntries - int(skipped)
+		}
+		if len(entries) != wantLen {
+			t.Fatalf("%s: unexpected number of entries: got %d, want %d",
+				test.name, len(entries), wantLen)
+		}
+		for i, wantOffset := range test.wantOffsets {
+			if entries[i].BlockRegion.Offset != wantOffset {
+				t.Fatalf("%s: unexpected offset for entry %d: got %d, "+
+					"want %d", test.name, i, entries[i].BlockRegion.Offset,
+					wantOffset)
+			}
+		}
+	}
+}
+
+// BenchmarkFetchAddrIndexEntries benchmarks fetching all of the entries for
+// addresses that only have a single level as well as addresses that have
+// multiple levels.
+func BenchmarkFetchAddrIndexEntries(b *testing.B) {
+	fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+		return &chainhash.Hash{}, nil
+	}
+
+	for _, numEntries := range []int{1, level0MaxEntries, level0MaxEntries*7 + 1} {
+		key := [addrKeySize]byte{0: addrKeyTypePubKeyHash, 1: 0x01}
+		bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+		for i := 0; i < numEntries; i++ {
+			txLoc := wire.TxLoc{TxStart: i}
+			err := dbPutAddrIndexEntry(bucket, key, uint32(i), txLoc, 0)
+			if err != nil {
+				b.Fatalf("unexpected error inserting entry %d: %v", i, err)
+			}
+		}
+
+		b.Run(fmt.Sprintf("%d entries", numEntries), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, _, err := dbFetchAddrIndexEntries(bucket, key, 0,
+					math.MaxUint32, false, fetchBlockHash)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // TestAddrIndexAsync ensures the address index behaves
 // receiving updates asynchronously.
 func TestAddrIndexAsync(t *testing.T) {
@@ -316,12 +633,20 @@ func TestAddrIndexAsync(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Ensure creating the address index without the tx index fails with the
+	// expected error.
+	_, err = NewAddrIndex(subber, db, chain, nil)
+	if !errors.Is(err, ErrTxIndexRequired) {
+		t.Fatalf("unexpected error without tx index: got %v, want %v", err,
+			ErrTxIndexRequired)
+	}
+
 	txIdx, err := NewTxIndex(subber, db, chain)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	addrIdx, err := NewAddrIndex(subber, db, chain)
+	addrIdx, err := NewAddrIndex(subber, db, chain, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -331,6 +656,16 @@ func TestAddrIndexAsync(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// Ensure the address index is not lagging behind the tx index after
+	// catching up.
+	lag, err := addrIdx.DependencyLag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag != 0 {
+		t.Fatalf("unexpected dependency lag: got %d, want 0", lag)
+	}
+
 	// Ensure the indexes got synced to bk3 on initialization.
 	txIdxTipHeight, txIdxTipHash, err := addrIdx.Tip()
 	if err != nil {
@@ -360,6 +695,27 @@ func TestAddrIndexAsync(t *testing.T) {
 			addrIdxTipHash.String())
 	}
 
+	// Ensure waiting for a height the address index already reached returns
+	// immediately and waiting for a future height is interrupted when the
+	// context is cancelled.
+	if err := addrIdx.WaitForHeight(ctx, bk3.Height()); err != nil {
+		t.Fatalf("unexpected error waiting for reached height: %v", err)
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, time.Millisecond*10)
+	err = addrIdx.WaitForHeight(timeoutCtx, bk3.Height()+1)
+	timeoutCancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error waiting for future height: got %v, want "+
+			"%v", err, context.DeadlineExceeded)
+	}
+
+	// Wait for the address index to reach the height of bk5 while the blocks
+	// are connected.
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- addrIdx.WaitForHeight(ctx, bk3.Height()+2)
+	}()
+
 	// Ensure the address index remains in sync with the main chain when new
 	// blocks are connected.
 	bk4 := addBlock(t, chain, &g, "bk4")
@@ -382,6 +738,23 @@ func TestAddrIndexAsync(t *testing.T) {
 	}
 	notifyAndWait(t, subber, ntfn)
 
+	// Ensure waiting for the address index to reach bk5 completed.
+	select {
+	case err := <-waitErr:
+		if err != nil {
+			t.Fatalf("unexpected error waiting for bk5: %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timeout waiting for the address index to reach bk5")
+	}
+	addrIdx.mtx.Lock()
+	numWaiters := len(addrIdx.tipWaiters)
+	addrIdx.mtx.Unlock()
+	if numWaiters != 0 {
+		t.Fatalf("unexpected number of tip waiters: got %d, want 0",
+			numWaiters)
+	}
+
 	// Ensure the indexes got synced to bk5.
 	txIdxTipHeight, txIdxTipHash, err = addrIdx.Tip()
 	if err != nil {
@@ -476,7 +849,7 @@ func TestAddrIndexAsync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	addrIdx, err = NewAddrIndex(subber, db, chain)
+	addrIdx, err = NewAddrIndex(subber, db, chain, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -635,7 +1008,18 @@ func TestAddrIndexAsync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	addrIdx, err = NewAddrIndex(subber, db, chain)
+	// Ensure the ticket commitment amounts bucket was dropped as well.
+	err = db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(addrCommitmentIndexKey) != nil {
+			t.Fatal("ticket commitment amounts bucket not dropped")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrIdx, err = NewAddrIndex(subber, db, chain, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -721,3 +1105,8831 @@ func TestAddrIndexAsync(t *testing.T) {
 			bk4a.Hash().String(), addrIdxTipHash.String())
 	}
 }
+
+// testPrevScript houses a previous output script and its associated version
+// for use with the mock previous scripter.
+type testPrevScript struct {
+	version uint16
+	script  []byte
+	amount  int64
+}
+
+// testPrevScripter provides a mock previous scripter keyed by outpoint by
+// implementing the PrevScripter interface.
+type testPrevScripter map[wire.OutPoint]testPrevScript
+
+// PrevScript returns the script and version for the provided outpoint if it
+// exists in the mock previous scripter.
+//
+// This is part of the PrevScripter interface.
+func (p testPrevScripter) PrevScript(op *wire.OutPoint) (uint16, []byte, bool) {
+	prevScript, ok := p[*op]
+	if !ok {
+		return 0, nil, false
+	}
+	return prevScript.version, prevScript.script, true
+}
+
+// PrevAmount returns the amount for the provided outpoint if it exists in the
+// mock previous scripter.
+//
+// This is part of the PrevAmounter interface.
+func (p testPrevScripter) PrevAmount(op *wire.OutPoint) (int64, bool) {
+	prevScript, ok := p[*op]
+	if !ok {
+		return 0, false
+	}
+	return prevScript.amount, true
+}
+
+// setupAddrIndexDB initializes a test database for the address index tests and
+// benchmarks.
+func setupAddrIndexDB(t testing.TB, dbName string) (database.DB, string) {
+	dbPath, err := os.MkdirTemp("", dbName)
+	if err != nil {
+		t.Fatalf("unable to create test db path: %v", err)
+	}
+
+	db, err := database.Create("ffldb", dbPath, wire.SimNet)
+	if err != nil {
+		os.RemoveAll(dbPath)
+		t.Fatalf("error creating db: %v", err)
+	}
+
+	return db, dbPath
+}
+
+// newTestAddrIndex returns an address index backed by a fresh test database
+// that has the buckets required by the address index already created.  The
+// returned function must be called to release the database.
+func newTestAddrIndex(t testing.TB, dbName string) (*AddrIndex, func()) {
+	t.Helper()
+
+	db, path := setupAddrIndexDB(t, dbName)
+	chain, err := newTestChain()
+	if err != nil {
+		teardownDB(db, path)
+		t.Fatal(err)
+	}
+
+	idx := newAddrIndex(db, chain.ChainParams(), nil)
+	idx.chain = chain
+	err = createIndex(idx, &idx.chainParams.GenesisHash)
+	if err != nil {
+		teardownDB(db, path)
+		t.Fatal(err)
+	}
+
+	// The address index relies on the internal block ID buckets maintained
+	// by the transaction index.
+	err = db.Update(func(dbTx database.Tx) error {
+		return (&TxIndex{}).Create(dbTx)
+	})
+	if err != nil {
+		teardownDB(db, path)
+		t.Fatal(err)
+	}
+
+	return idx, func() { teardownDB(db, path) }
+}
+
+// connectTestBlock extends the test chain associated with the provided address
+// index with the block, assigns the provided internal block ID to it, and
+// connects it to the address index.
+func connectTestBlock(t testing.TB, idx *AddrIndex, block *dcrutil.Block, blockID uint32, prevScripts PrevScripter, isTreasuryEnabled bool) {
+	t.Helper()
+
+	err := idx.chain.(*testChain).AddBlock(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIDIndexEntry(dbTx, block.Hash(), blockID)
+		if err != nil {
+			return err
+		}
+		return idx.connectBlock(dbTx, block, nil, prevScripts,
+			isTreasuryEnabled)
+	})
+	if err != nil {
+		t.Fatalf("unable to connect block %s: %v", block.Hash(), err)
+	}
+}
+
+// newTestCoinbase returns a mock coinbase transaction that pays to each of the
+// provided scripts.
+func newTestCoinbase(height uint32, pkScripts ...[]byte) *wire.MsgTx {
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex, wire.TxTreeRegular),
+		Sequence:        wire.MaxTxInSequenceNum,
+		BlockHeight:     wire.NullBlockHeight,
+		BlockIndex:      wire.NullBlockIndex,
+		SignatureScript: []byte{0x51, 0x51},
+	})
+	var heightScript [6]byte
+	heightScript[0] = txscript.OP_RETURN
+	heightScript[1] = txscript.OP_DATA_4
+	byteOrder.PutUint32(heightScript[2:], height)
+	tx.AddTxOut(wire.NewTxOut(0, heightScript[:]))
+	for _, pkScript := range pkScripts {
+		tx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+	}
+	return tx
+}
+
+// newTestBlock returns a block at the provided height with the given regular
+// and stake transactions.
+func newTestBlock(height uint32, prevBlock *chainhash.Hash, txns, stxns []*wire.MsgTx) *dcrutil.Block {
+	msgBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:   1,
+			PrevBlock: *prevBlock,
+			Height:    height,
+			Timestamp: time.Unix(1600000000+int64(height)*300, 0),
+		},
+		Transactions:  txns,
+		STransactions: stxns,
+	}
+	return dcrutil.NewBlock(msgBlock)
+}
+
+// testP2PKHAddr returns a version 0 pay-to-pubkey-hash address for the simnet
+// network that commits to a hash160 filled with the provided byte.
+func testP2PKHAddr(t testing.TB, b byte) stdaddr.Address {
+	t.Helper()
+
+	addr, err := stdaddr.NewAddressPubKeyHashEcdsaSecp256k1V0(
+		bytes.Repeat([]byte{b}, 20), chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return addr
+}
+
+// TestAddrIndexTreasurySpend ensures the recipients of treasury spends are
+// indexed and queryable.
+func TestAddrIndexTreasurySpend(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_tspend")
+	defer teardown()
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Create a treasury spend that pays several addresses.
+	recipients := []stdaddr.Address{
+		testP2PKHAddr(t, 0x01),
+		testP2PKHAddr(t, 0x02),
+		testP2PKHAddr(t, 0x03),
+	}
+	payouts := make([]chaingen.AddressAmountTuple, 0, len(recipients))
+	for _, addr := range recipients {
+		payouts = append(payouts, chaingen.AddressAmountTuple{
+			Address: addr,
+			Amount:  1e8,
+		})
+	}
+	privKey := bytes.Repeat([]byte{0x11}, 32)
+	tspend := g.CreateTreasuryTSpend(privKey, payouts, 1000, 10)
+	if !stake.IsTSpend(tspend) {
+		t.Fatal("generated transaction is not a treasury spend")
+	}
+
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, []*wire.MsgTx{tspend})
+	connectTestBlock(t, idx, block, 1, testPrevScripter{}, true)
+
+	// Ensure every recipient of the treasury spend is indexed and refers to
+	// the treasury spend in the stake tree.
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, addr := range recipients {
+			entries, _, err := idx.EntriesForAddress(dbTx, addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 1 {
+				return fmt.Errorf("expected 1 entry for %s, got %d", addr,
+					len(entries))
+			}
+			if *entries[0].BlockRegion.Hash != *block.Hash() {
+				return fmt.Errorf("unexpected block hash for %s: got %s, "+
+					"want %s", addr, entries[0].BlockRegion.Hash,
+					block.Hash())
+			}
+			if entries[0].BlockIndex != 0 {
+				return fmt.Errorf("unexpected block index for %s: got %d, "+
+					"want 0", addr, entries[0].BlockIndex)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexTreasuryActivationReorg ensures disconnecting a block that
+// activated the treasury agenda via a notification with a stale treasury
+// agenda state removes all of the entries added when it was connected.
+func TestAddrIndexTreasuryActivationReorg(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_treasuryreorg")
+	defer teardown()
+	idx.consumer = NewSpendConsumer(idx.Name(), &idx.chainParams.GenesisHash,
+		idx.chain)
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Connect a block prior to the activation of the treasury agenda followed
+	// by a block with a treasury spend at the activation height.
+	addr := testP2PKHAddr(t, 0x01)
+	payouts := []chaingen.AddressAmountTuple{{Address: addr, Amount: 1e8}}
+	tspend := g.CreateTreasuryTSpend(bytes.Repeat([]byte{0x11}, 32), payouts,
+		1000, 10)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, nil)
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2)}, []*wire.MsgTx{tspend})
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, true)
+
+	// checkEntries ensures the recipient of the treasury spend has the
+	// expected number of entries.
+	checkEntries := func(wantEntries int) {
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			entries, _, err := idx.EntriesForAddress(dbTx, addr, 0, 10, false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != wantEntries {
+				return fmt.Errorf("unexpected number of entries: got %d, "+
+					"want %d", len(entries), wantEntries)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkEntries(1)
+
+	// Disconnect the block at the activation height with a notification
+	// that claims the treasury agenda is not active while the chain reports
+	// it is active for the block and ensure the entries of the treasury spend
+	// are removed regardless.
+	idx.chain.(*testChain).treasuryActive = true
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType:          DisconnectNtfn,
+			Block:             block2,
+			Parent:            block1,
+			PrevScripts:       testPrevScripter{},
+			IsTreasuryEnabled: false,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(0)
+	tipHeight, tipHash, err := idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != 1 || *tipHash != *block1.Hash() {
+		t.Fatalf("unexpected tip: got %v (height %d), want %v (height 1)",
+			tipHash, tipHeight, block1.Hash())
+	}
+}
+
+// TestAddrIndexTicketCommitmentDisconnect ensures connecting and then
+// disconnecting a block that contains a ticket purchase, whose reward
+// commitment address is only indexed via the commitment output, restores the
+// address index to exactly the state it was in prior to connecting the block
+// regardless of the treasury agenda state at connect and disconnect time.
+func TestAddrIndexTicketCommitmentDisconnect(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_ticketdisconnect")
+	defer teardown()
+
+	// Create addresses for the voting rights, reward commitment, change, and
+	// funding of the ticket.  The commitment is to a script hash so it is
+	// distinct from all of the other addresses.
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr, err := stdaddr.NewAddressScriptHashV0FromHash(
+		bytes.Repeat([]byte{0x02}, 20), chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	changeAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	fundingAddr := testP2PKHAddr(t, 0x04)
+	addrs := []stdaddr.Address{votingAddr, commitAddr, changeAddr, fundingAddr}
+
+	// Connect enough blocks paying to all of the addresses to nearly fill
+	// level 0 so the ticket block results in merges into higher levels.
+	var pkScripts [][]byte
+	for _, addr := range addrs {
+		_, pkScript := addr.PaymentScript()
+		pkScripts = append(pkScripts, pkScript)
+	}
+	prevHash := &idx.chainParams.GenesisHash
+	const numPriorBlocks = level0MaxEntries - 1
+	for height := uint32(1); height <= numPriorBlocks; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScripts...)}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	// Create a ticket that spends an output paying to the funding address.
+	const ticketPrice = 2e8
+	fundingOutPoint := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	fundingVer, fundingScript := fundingAddr.PaymentScript()
+	prevScripts := testPrevScripter{fundingOutPoint: {
+		version: fundingVer,
+		script:  fundingScript,
+	}}
+	voteVer, voteScript := votingAddr.VotingRightsScript()
+	commitVer, commitScript := commitAddr.RewardCommitmentScript(
+		ticketPrice+1e8, 0, ticketPrice)
+	changeVer, changeScript := changeAddr.StakeChangeScript()
+	ticket := wire.NewMsgTx()
+	ticket.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: fundingOutPoint,
+		Sequence:         wire.MaxTxInSequenceNum,
+		ValueIn:          ticketPrice + 1e8,
+	})
+	ticket.AddTxOut(&wire.TxOut{Value: ticketPrice, Version: voteVer,
+		PkScript: voteScript})
+	ticket.AddTxOut(&wire.TxOut{Value: 0, Version: commitVer,
+		PkScript: commitScript})
+	ticket.AddTxOut(&wire.TxOut{Value: 1e8, Version: changeVer,
+		PkScript: changeScript})
+	if !stake.IsSStx(ticket) {
+		t.Fatal("generated transaction is not a ticket purchase")
+	}
+
+	// Add the block that contains the ticket to the chain.  The coinbase also
+	// pays to the voting rights address so it has multiple new entries.
+	const height = numPriorBlocks + 1
+	block := newTestBlock(height, prevHash,
+		[]*wire.MsgTx{newTestCoinbase(height, pkScripts[0])},
+		[]*wire.MsgTx{ticket})
+	if err := idx.chain.(*testChain).AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return dbPutBlockIDIndexEntry(dbTx, block.Hash(), height)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, connectTreasury := range []bool{false, true} {
+		for _, disconnectTreasury := range []bool{false, true} {
+			before := dumpAddrIndex(t, idx)
+
+			err := idx.db.Update(func(dbTx database.Tx) error {
+				return idx.connectBlock(dbTx, block, nil, prevScripts,
+					connectTreasury)
+			})
+			if err != nil {
+				t.Fatalf("unable to connect block: %v", err)
+			}
+
+			// Ensure all of the addresses involved in the ticket, including
+			// the commitment address, have an entry for it.
+			for _, addr := range addrs {
+				entries, _, err := idx.EntriesForAddress(nil, addr, 0, 1,
+					true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 1 || entries[0].Tree != wire.TxTreeStake ||
+					*entries[0].BlockRegion.Hash != *block.Hash() {
+
+					t.Fatalf("missing ticket entry for %v: %+v", addr,
+						entries)
+				}
+			}
+
+			err = idx.db.Update(func(dbTx database.Tx) error {
+				return idx.disconnectBlock(dbTx, block, nil, prevScripts,
+					disconnectTreasury)
+			})
+			if err != nil {
+				t.Fatalf("unable to disconnect block: %v", err)
+			}
+
+			after := dumpAddrIndex(t, idx)
+			if len(after) != len(before) {
+				t.Fatalf("connect treasury %v, disconnect treasury %v: "+
+					"mismatched number of keys: got %d, want %d",
+					connectTreasury, disconnectTreasury, len(after),
+					len(before))
+			}
+			for k, wantV := range before {
+				if !bytes.Equal(after[k], wantV) {
+					t.Fatalf("connect treasury %v, disconnect treasury %v: "+
+						"mismatched data for key %x: got %x, want %x",
+						connectTreasury, disconnectTreasury, k, after[k],
+						wantV)
+				}
+			}
+		}
+	}
+}
+
+// newTestTicket returns a ticket purchase with an input and associated
+// commitment output that commits to the given address for each of the provided
+// amounts.  The inputs spend consecutive outputs of the transaction with the
+// provided hash.
+func newTestTicket(fundingHash chainhash.Hash, votingAddr, commitAddr stdaddr.StakeAddress, amounts ...int64) *wire.MsgTx {
+	ticket := wire.NewMsgTx()
+	var total int64
+	for i, amount := range amounts {
+		total += amount
+		ticket.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: fundingHash,
+				Index: uint32(i)},
+			Sequence: wire.MaxTxInSequenceNum,
+			ValueIn:  amount,
+		})
+	}
+	voteVer, voteScript := votingAddr.VotingRightsScript()
+	ticket.AddTxOut(&wire.TxOut{Value: total, Version: voteVer,
+		PkScript: voteScript})
+	for _, amount := range amounts {
+		commitVer, commitScript := commitAddr.RewardCommitmentScript(amount,
+			0, amount)
+		changeVer, changeScript := commitAddr.StakeChangeScript()
+		ticket.AddTxOut(&wire.TxOut{Value: 0, Version: commitVer,
+			PkScript: commitScript})
+		ticket.AddTxOut(&wire.TxOut{Value: 0, Version: changeVer,
+			PkScript: changeScript})
+	}
+	return ticket
+}
+
+// TestAddrIndexCommittedAmounts ensures the amounts committed to addresses by
+// ticket purchases are indexed and removed when the blocks that contain them
+// are disconnected.
+func TestAddrIndexCommittedAmounts(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_commitamounts")
+	defer teardown()
+
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	otherCommitAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+
+	// Connect a block with a ticket that has multiple commitments to the same
+	// address followed by a block with a ticket that commits to both the same
+	// address and another one.
+	ticket1 := newTestTicket(chainhash.Hash{0x01},
+		votingAddr, commitAddr, 1e8, 2e8)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, []*wire.MsgTx{ticket1})
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	ticket2 := newTestTicket(chainhash.Hash{0x02},
+		votingAddr, commitAddr, 5e8)
+	ticket3 := newTestTicket(chainhash.Hash{0x03},
+		votingAddr, otherCommitAddr, 7e8)
+	for _, ticket := range []*wire.MsgTx{ticket1, ticket2, ticket3} {
+		if !stake.IsSStx(ticket) {
+			t.Fatalf("generated transaction %v is not a ticket purchase",
+				ticket.TxHash())
+		}
+	}
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2)}, []*wire.MsgTx{ticket2, ticket3})
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, false)
+
+	// checkAmounts ensures the committed amounts for the provided address
+	// match the expected ones.
+	checkAmounts := func(addr stdaddr.Address, want []CommittedAmount) {
+		t.Helper()
+
+		var got []CommittedAmount
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			got, err = idx.CommittedAmountsForAddress(dbTx, addr)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch committed amounts: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("unexpected number of committed amounts for %v: got %d, "+
+				"want %d", addr, len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("mismatched committed amount %d for %v: got %+v, "+
+					"want %+v", i, addr, got[i], want[i])
+			}
+		}
+	}
+	checkAmounts(commitAddr, []CommittedAmount{
+		{TxHash: ticket1.TxHash(), BlockHeight: 1, Amount: 3e8},
+		{TxHash: ticket2.TxHash(), BlockHeight: 2, Amount: 5e8},
+	})
+	checkAmounts(otherCommitAddr, []CommittedAmount{
+		{TxHash: ticket3.TxHash(), BlockHeight: 2, Amount: 7e8},
+	})
+	checkAmounts(votingAddr, nil)
+
+	// Ensure disconnecting the blocks removes the committed amounts.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, nil, testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	checkAmounts(commitAddr, []CommittedAmount{
+		{TxHash: ticket1.TxHash(), BlockHeight: 1, Amount: 3e8},
+	})
+	checkAmounts(otherCommitAddr, nil)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block1, nil, testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	checkAmounts(commitAddr, nil)
+}
+
+// newTestVote returns a mock vote that spends the provided ticket hash and pays
+// its reward to the provided address.
+func newTestVote(t testing.TB, params *chaincfg.Params, ticketHash chainhash.Hash, rewardAddr stdaddr.StakeAddress) *wire.MsgTx {
+	t.Helper()
+
+	vote := wire.NewMsgTx()
+	vote.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{},
+			wire.MaxPrevOutIndex, wire.TxTreeRegular),
+		Sequence:        wire.MaxTxInSequenceNum,
+		BlockHeight:     wire.NullBlockHeight,
+		BlockIndex:      wire.NullBlockIndex,
+		SignatureScript: params.StakeBaseSigScript,
+	})
+	vote.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&ticketHash, 0,
+			wire.TxTreeStake),
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	voteBitsScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData([]byte{0x01, 0x00}).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vote.AddTxOut(wire.NewTxOut(0, chaingen.VoteCommitmentScript(
+		params.GenesisHash, 0)))
+	vote.AddTxOut(wire.NewTxOut(0, voteBitsScript))
+	genVer, genScript := rewardAddr.PayVoteCommitmentScript()
+	vote.AddTxOut(&wire.TxOut{Value: 1e8, Version: genVer,
+		PkScript: genScript})
+	return vote
+}
+
+// TestAddrIndexStakeTags ensures the entries for stake generation, stake
+// change, and ticket commitment outputs are tagged accordingly and can be
+// filtered by their tags.
+func TestAddrIndexStakeTags(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_staketags")
+	defer teardown()
+
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	rewardAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	payAddr := testP2PKHAddr(t, 0x04)
+
+	// Create a ticket that commits to an address and pays stake change to the
+	// same address along with a vote that pays its reward to another address.
+	ticket := newTestTicket(chainhash.Hash{0x01}, votingAddr, commitAddr,
+		1e8)
+	vote := newTestVote(t, idx.chainParams, chainhash.Hash{0x02}, rewardAddr)
+	if !stake.IsSStx(ticket) {
+		t.Fatal("generated transaction is not a ticket purchase")
+	}
+	if !stake.IsSSGen(vote, false) {
+		t.Fatal("generated transaction is not a vote")
+	}
+
+	_, payScript := payAddr.PaymentScript()
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, payScript)},
+		[]*wire.MsgTx{ticket, vote})
+	connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+
+	tests := []struct {
+		name string
+		addr stdaddr.Address
+		want StakeTag
+	}{{
+		name: "ticket voting address",
+		addr: votingAddr,
+		want: 0,
+	}, {
+		name: "ticket commitment and change address",
+		addr: commitAddr,
+		want: StakeTagCommitment | StakeTagChange,
+	}, {
+		name: "vote reward address",
+		addr: rewardAddr,
+		want: StakeTagGen,
+	}, {
+		name: "regular payment address",
+		addr: payAddr,
+		want: 0,
+	}}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, _, err := idx.EntriesForAddress(dbTx, test.addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 1 {
+				return fmt.Errorf("%s: unexpected number of entries: got "+
+					"%d, want 1", test.name, len(entries))
+			}
+			if entries[0].StakeTags != test.want {
+				return fmt.Errorf("%s: unexpected stake tags: got %#x, "+
+					"want %#x", test.name, entries[0].StakeTags, test.want)
+			}
+
+			// Ensure filtering by each of the tags only returns the entry
+			// when it has the tag.
+			allTags := []StakeTag{StakeTagGen, StakeTagChange,
+				StakeTagCommitment}
+			for _, tag := range allTags {
+				filtered, _, err := idx.EntriesForAddressByStakeTags(dbTx,
+					test.addr, tag, 0, 10, false)
+				if err != nil {
+					return err
+				}
+				wantLen := 0
+				if test.want&tag != 0 {
+					wantLen = 1
+				}
+				if len(filtered) != wantLen {
+					return fmt.Errorf("%s: unexpected number of entries "+
+						"with tag %#x: got %d, want %d", test.name, tag,
+						len(filtered), wantLen)
+				}
+			}
+		}
+
+		// Ensure filtering without any tags is rejected.
+		_, _, err := idx.EntriesForAddressByStakeTags(dbTx, commitAddr, 0, 0,
+			10, false)
+		if err == nil {
+			return errors.New("filtering without stake tags did not fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexTicketCommitmentAddrs ensures votes and revocations are also
+// indexed under the commitment addresses of the tickets they spend, both
+// confirmed and unconfirmed, when the index is configured to do so and that
+// the entries are removed when the block that contains them is disconnected.
+func TestAddrIndexTicketCommitmentAddrs(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_ticketcommitaddrs")
+	defer teardown()
+	idx.indexTicketCommitmentAddrs = true
+
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	otherCommitAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	rewardAddr := testP2PKHAddr(t, 0x04).(stdaddr.StakeAddress)
+	revokeAddr := testP2PKHAddr(t, 0x05).(stdaddr.StakeAddress)
+
+	// Connect a block with two tickets that commit to different addresses and
+	// add it to the transaction index so the spent tickets can be resolved.
+	ticket1 := newTestTicket(chainhash.Hash{0x01}, votingAddr, commitAddr, 1e8)
+	ticket2 := newTestTicket(chainhash.Hash{0x02}, votingAddr,
+		otherCommitAddr, 2e8)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, []*wire.MsgTx{ticket1, ticket2})
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.StoreBlock(block1); err != nil {
+			return err
+		}
+		return dbAddTxIndexEntries(dbTx, block1, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, true)
+
+	// Create a vote for the first ticket and a revocation of the second one
+	// that pay separate addresses.
+	vote := newTestVote(t, idx.chainParams, ticket1.TxHash(), rewardAddr)
+	revocation := wire.NewMsgTx()
+	revocation.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(ticket2.CachedTxHash(), 0,
+			wire.TxTreeStake),
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	revokeVer, revokeScript := revokeAddr.PayRevokeCommitmentScript()
+	revocation.AddTxOut(&wire.TxOut{Value: 2e8, Version: revokeVer,
+		PkScript: revokeScript})
+	if !stake.IsSSGen(vote, true) || !stake.IsSSRtx(revocation, false) {
+		t.Fatal("generated transactions are not the expected kinds")
+	}
+
+	// Ensure the unconfirmed vote and revocation are indexed under the
+	// commitment addresses of the tickets they spend.
+	err = idx.db.View(func(dbTx database.Tx) error {
+		prevScripts := txIndexPrevScripter{dbTx: dbTx}
+		idx.AddUnconfirmedTx(dcrutil.NewTx(vote), prevScripts, true)
+		idx.AddUnconfirmedTx(dcrutil.NewTx(revocation), prevScripts, true)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		addr stdaddr.Address
+		want chainhash.Hash
+	}{
+		{commitAddr, vote.TxHash()},
+		{otherCommitAddr, revocation.TxHash()},
+	} {
+		unconfirmed := idx.UnconfirmedTxnsForAddress(test.addr)
+		if len(unconfirmed) != 1 || *unconfirmed[0].Hash() != test.want {
+			t.Fatalf("unexpected unconfirmed transactions for %v: got %d, "+
+				"want %v", test.addr, len(unconfirmed), test.want)
+		}
+	}
+	idx.RemoveUnconfirmedTx(vote.CachedTxHash())
+	idx.RemoveUnconfirmedTx(revocation.CachedTxHash())
+
+	// Connect a block with the vote and revocation using the transaction index
+	// to resolve the spent tickets.
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{newTestCoinbase(2)},
+		[]*wire.MsgTx{vote, revocation})
+	if err := idx.chain.(*testChain).AddBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.StoreBlock(block2); err != nil {
+			return err
+		}
+		err := dbPutBlockIDIndexEntry(dbTx, block2.Hash(), 2)
+		if err != nil {
+			return err
+		}
+		return idx.connectBlock(dbTx, block2, block1,
+			txIndexPrevScripter{dbTx: dbTx}, true)
+	})
+	if err != nil {
+		t.Fatalf("unable to connect block: %v", err)
+	}
+
+	// checkEntries ensures the entries for the provided address reference the
+	// expected transactions with the expected classes.
+	type wantEntry struct {
+		hash  chainhash.Hash
+		class TxClass
+	}
+	checkEntries := func(addr stdaddr.Address, want []wantEntry) {
+		t.Helper()
+
+		var entries []TxIndexEntryWithHash
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			entries, _, err = idx.EntriesWithTxHashForAddress(dbTx, addr, 0,
+				10, false)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("unexpected number of entries for %v: got %d, want %d",
+				addr, len(entries), len(want))
+		}
+		for i, entry := range entries {
+			if entry.TxHash != want[i].hash || entry.Class != want[i].class {
+				t.Fatalf("mismatched entry %d for %v: got %v (class %d), "+
+					"want %v (class %d)", i, addr, entry.TxHash, entry.Class,
+					want[i].hash, want[i].class)
+			}
+		}
+	}
+	checkEntries(commitAddr, []wantEntry{
+		{ticket1.TxHash(), TxClassTicket},
+		{vote.TxHash(), TxClassVote},
+	})
+	checkEntries(otherCommitAddr, []wantEntry{
+		{ticket2.TxHash(), TxClassTicket},
+		{revocation.TxHash(), TxClassRevocation},
+	})
+	checkEntries(rewardAddr, []wantEntry{{vote.TxHash(), TxClassVote}})
+	checkEntries(revokeAddr, []wantEntry{
+		{revocation.TxHash(), TxClassRevocation},
+	})
+
+	// Ensure disconnecting the block removes the entries under the commitment
+	// addresses.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1,
+			txIndexPrevScripter{dbTx: dbTx}, true)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	checkEntries(commitAddr, []wantEntry{{ticket1.TxHash(), TxClassTicket}})
+	checkEntries(otherCommitAddr, []wantEntry{
+		{ticket2.TxHash(), TxClassTicket},
+	})
+}
+
+// TestAddrIndexRewardSourceTicket ensures the tickets that earned the reward
+// outputs of votes are recorded when the index is configured to do so, can be
+// queried via the entries of the reward addresses, and are removed when the
+// block that contains the votes is disconnected.
+func TestAddrIndexRewardSourceTicket(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_rewardsource")
+	defer teardown()
+	idx.indexRewardSources = true
+
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	rewardAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+
+	// Connect a block that purchases two tickets and add it to the
+	// transaction index so the spent tickets can be resolved.
+	ticket1 := newTestTicket(chainhash.Hash{0x01}, votingAddr, commitAddr, 1e8)
+	ticket2 := newTestTicket(chainhash.Hash{0x02}, votingAddr, commitAddr, 2e8)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, []*wire.MsgTx{ticket1, ticket2})
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.StoreBlock(block1); err != nil {
+			return err
+		}
+		return dbAddTxIndexEntries(dbTx, block1, 1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, true)
+
+	// Connect a block with votes for both tickets that pay their rewards to
+	// the same address.
+	vote1 := newTestVote(t, idx.chainParams, ticket1.TxHash(), rewardAddr)
+	vote2 := newTestVote(t, idx.chainParams, ticket2.TxHash(), rewardAddr)
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{newTestCoinbase(2)},
+		[]*wire.MsgTx{vote1, vote2})
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return dbTx.StoreBlock(block2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, true)
+
+	// Ensure the entries for the reward address map to the tickets the votes
+	// spend while entries that are not votes do not map to any tickets.
+	err = idx.db.View(func(dbTx database.Tx) error {
+		entries, _, err := idx.EntriesWithTxHashForAddress(dbTx, rewardAddr,
+			0, 10, false)
+		if err != nil {
+			return err
+		}
+		wantTickets := map[chainhash.Hash]chainhash.Hash{
+			vote1.TxHash(): ticket1.TxHash(),
+			vote2.TxHash(): ticket2.TxHash(),
+		}
+		if len(entries) != len(wantTickets) {
+			return fmt.Errorf("unexpected number of entries: got %d, want %d",
+				len(entries), len(wantTickets))
+		}
+		for _, entry := range entries {
+			ticketHash, err := idx.RewardSourceTicket(dbTx, rewardAddr,
+				&entry.TxIndexEntry)
+			if err != nil {
+				return err
+			}
+			if *ticketHash != wantTickets[entry.TxHash] {
+				return fmt.Errorf("unexpected reward source for %v: got %v, "+
+					"want %v", entry.TxHash, ticketHash,
+					wantTickets[entry.TxHash])
+			}
+		}
+
+		// Ensure the vote entries are not linked under another address.
+		_, err = idx.RewardSourceTicket(dbTx, commitAddr,
+			&entries[0].TxIndexEntry)
+		if !errors.Is(err, ErrRewardSourceNotFound) {
+			return fmt.Errorf("unexpected error for other address: %v", err)
+		}
+
+		// Ensure ticket purchases are not linked to any tickets.
+		entries, _, err = idx.EntriesWithTxHashForAddress(dbTx, commitAddr,
+			0, 10, false)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			_, err := idx.RewardSourceTicket(dbTx, commitAddr,
+				&entry.TxIndexEntry)
+			if !errors.Is(err, ErrRewardSourceNotFound) {
+				return fmt.Errorf("unexpected error for ticket entry: %v",
+					err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure disconnecting the block removes the linkage.
+	var voteEntries []TxIndexEntryWithHash
+	err = idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		voteEntries, _, err = idx.EntriesWithTxHashForAddress(dbTx,
+			rewardAddr, 0, 10, false)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1, testPrevScripter{},
+			true)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, entry := range voteEntries {
+			_, err := idx.RewardSourceTicket(dbTx, rewardAddr,
+				&entry.TxIndexEntry)
+			if !errors.Is(err, ErrRewardSourceNotFound) {
+				return fmt.Errorf("unexpected error after disconnect: %v",
+					err)
+			}
+		}
+		if dbTx.Metadata().Bucket(addrRewardSourceIndexKey).Cursor().First() {
+			return errors.New("reward sources remain after disconnect")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexTxClass ensures the entries for each kind of transaction are
+// assigned the expected class and can be filtered by it.
+func TestAddrIndexTxClass(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_txclass")
+	defer teardown()
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	payAddr := testP2PKHAddr(t, 0x01)
+	regularAddr := testP2PKHAddr(t, 0x02)
+	votingAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x04).(stdaddr.StakeAddress)
+	rewardAddr := testP2PKHAddr(t, 0x05).(stdaddr.StakeAddress)
+	revokeAddr := testP2PKHAddr(t, 0x06).(stdaddr.StakeAddress)
+	taddChangeAddr := testP2PKHAddr(t, 0x07).(stdaddr.StakeAddress)
+	tspendAddr := testP2PKHAddr(t, 0x08)
+
+	// Create a block with a coinbase that pays an address, a regular
+	// transaction that spends it, and one of each kind of stake transaction
+	// that pays a separate address.
+	_, payScript := payAddr.PaymentScript()
+	_, regularScript := regularAddr.PaymentScript()
+	coinbase := newTestCoinbase(1, payScript, payScript)
+	spentOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	regularTx := wire.NewMsgTx()
+	regularTx.AddTxIn(&wire.TxIn{PreviousOutPoint: spentOut})
+	regularTx.AddTxOut(wire.NewTxOut(1e8, regularScript))
+	ticket := newTestTicket(chainhash.Hash{0x01}, votingAddr, commitAddr, 1e8)
+	vote := newTestVote(t, idx.chainParams, chainhash.Hash{0x02}, rewardAddr)
+	revocation := wire.NewMsgTx()
+	revocation.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: *wire.NewOutPoint(&chainhash.Hash{0x03}, 0,
+			wire.TxTreeStake),
+		Sequence: wire.MaxTxInSequenceNum,
+	})
+	revokeVer, revokeScript := revokeAddr.PayRevokeCommitmentScript()
+	revocation.AddTxOut(&wire.TxOut{Value: 1e8, Version: revokeVer,
+		PkScript: revokeScript})
+	taddSpend := chaingen.MakeSpendableOutForTx(coinbase, 1, 0, 2)
+	tadd := g.CreateTreasuryTAddChange(&taddSpend, 5e7, 0, taddChangeAddr)
+	tadd.Version = wire.TxVersionTreasury
+	tspend := g.CreateTreasuryTSpend(bytes.Repeat([]byte{0x11}, 32),
+		[]chaingen.AddressAmountTuple{{Address: tspendAddr, Amount: 1e8}},
+		1000, 10)
+	if !stake.IsSSGen(vote, true) || !stake.IsSSRtx(revocation, false) ||
+		!stake.IsTAdd(tadd) || !stake.IsTSpend(tspend) {
+
+		t.Fatal("generated transactions are not the expected kinds")
+	}
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase, regularTx},
+		[]*wire.MsgTx{ticket, vote, revocation, tadd, tspend})
+	prevScripts := testPrevScripter{spentOut: {script: payScript}}
+	connectTestBlock(t, idx, block, 1, prevScripts, true)
+
+	tests := []struct {
+		name string
+		addr stdaddr.Address
+		want []TxClass
+	}{{
+		name: "coinbase and regular transaction",
+		addr: payAddr,
+		want: []TxClass{TxClassCoinbase, TxClassRegular},
+	}, {
+		name: "regular transaction",
+		addr: regularAddr,
+		want: []TxClass{TxClassRegular},
+	}, {
+		name: "ticket voting address",
+		addr: votingAddr,
+		want: []TxClass{TxClassTicket},
+	}, {
+		name: "ticket commitment address",
+		addr: commitAddr,
+		want: []TxClass{TxClassTicket},
+	}, {
+		name: "vote reward address",
+		addr: rewardAddr,
+		want: []TxClass{TxClassVote},
+	}, {
+		name: "revocation address",
+		addr: revokeAddr,
+		want: []TxClass{TxClassRevocation},
+	}, {
+		name: "treasury add change address",
+		addr: taddChangeAddr,
+		want: []TxClass{TxClassTreasuryAdd},
+	}, {
+		name: "treasury spend address",
+		addr: tspendAddr,
+		want: []TxClass{TxClassTreasurySpend},
+	}}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, _, err := idx.EntriesForAddress(dbTx, test.addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != len(test.want) {
+				return fmt.Errorf("%s: unexpected number of entries: got "+
+					"%d, want %d", test.name, len(entries), len(test.want))
+			}
+			wantCounts := make(map[TxClass]int)
+			for i, entry := range entries {
+				if entry.Class != test.want[i] {
+					return fmt.Errorf("%s: unexpected class for entry %d: "+
+						"got %d, want %d", test.name, i, entry.Class,
+						test.want[i])
+				}
+				wantCounts[test.want[i]]++
+			}
+
+			// Ensure filtering by each of the classes only returns the
+			// entries of the class.
+			for class := TxClassUnknown; class <= TxClassTreasuryBase; class++ {
+				filtered, _, err := idx.EntriesForAddressByClass(dbTx,
+					test.addr, class, 0, 10, false)
+				if err != nil {
+					return err
+				}
+				if len(filtered) != wantCounts[class] {
+					return fmt.Errorf("%s: unexpected number of entries "+
+						"with class %d: got %d, want %d", test.name, class,
+						len(filtered), wantCounts[class])
+				}
+			}
+		}
+
+		// Ensure filtering by an unknown class is rejected.
+		_, _, err := idx.EntriesForAddressByClass(dbTx, payAddr,
+			TxClassTreasuryBase+1, 0, 10, false)
+		if err == nil {
+			return errors.New("filtering by an unknown class did not fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexChangeHeuristic ensures the entries for the addresses paid by
+// the outputs of regular transactions are tagged as likely change or payments
+// according to the change heuristic when it is enabled and can be filtered by
+// their kind.
+func TestAddrIndexChangeHeuristic(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_changeheuristic")
+	defer teardown()
+	idx.changeHeuristic = true
+	if idx.optionFlags()&addrIndexOptChangeHeuristicV1 == 0 {
+		t.Fatal("change heuristic option is not persisted")
+	}
+
+	reusedAddr := testP2PKHAddr(t, 0x01)
+	payeeAddr := testP2PKHAddr(t, 0x02)
+	spenderAddr := testP2PKHAddr(t, 0x03)
+
+	// Create a block with a coinbase that pays two addresses, a transaction
+	// that spends the output of one of them and pays another address along
+	// with change back to itself, and a transaction that spends the output of
+	// the other one and only pays another address.
+	_, reusedScript := reusedAddr.PaymentScript()
+	_, payeeScript := payeeAddr.PaymentScript()
+	_, spenderScript := spenderAddr.PaymentScript()
+	coinbase := newTestCoinbase(1, reusedScript, spenderScript)
+	reusedOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	spenderOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 2}
+	changeTx := wire.NewMsgTx()
+	changeTx.AddTxIn(&wire.TxIn{PreviousOutPoint: reusedOut})
+	changeTx.AddTxOut(wire.NewTxOut(5e7, payeeScript))
+	changeTx.AddTxOut(wire.NewTxOut(4e7, reusedScript))
+	paymentTx := wire.NewMsgTx()
+	paymentTx.AddTxIn(&wire.TxIn{PreviousOutPoint: spenderOut})
+	paymentTx.AddTxOut(wire.NewTxOut(9e7, payeeScript))
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase, changeTx, paymentTx}, nil)
+	prevScripts := testPrevScripter{
+		reusedOut:  {script: reusedScript},
+		spenderOut: {script: spenderScript},
+	}
+	connectTestBlock(t, idx, block, 1, prevScripts, false)
+
+	tests := []struct {
+		name string
+		addr stdaddr.Address
+		want []OutputKind
+	}{{
+		name: "coinbase and change",
+		addr: reusedAddr,
+		want: []OutputKind{OutputKindUnknown, OutputKindChange},
+	}, {
+		name: "payments",
+		addr: payeeAddr,
+		want: []OutputKind{OutputKindPayment, OutputKindPayment},
+	}, {
+		name: "coinbase and input only",
+		addr: spenderAddr,
+		want: []OutputKind{OutputKindUnknown, OutputKindUnknown},
+	}}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, _, err := idx.EntriesForAddress(dbTx, test.addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != len(test.want) {
+				return fmt.Errorf("%s: unexpected number of entries: got "+
+					"%d, want %d", test.name, len(entries), len(test.want))
+			}
+			wantCounts := make(map[OutputKind]int)
+			for i, entry := range entries {
+				if entry.OutputKind != test.want[i] {
+					return fmt.Errorf("%s: unexpected output kind for entry "+
+						"%d: got %d, want %d", test.name, i,
+						entry.OutputKind, test.want[i])
+				}
+				wantCounts[test.want[i]]++
+			}
+
+			// Ensure filtering by each of the kinds only returns the entries
+			// of the kind.
+			for kind := OutputKindUnknown; kind <= OutputKindChange; kind++ {
+				filtered, _, err := idx.EntriesForAddressByOutputKind(dbTx,
+					test.addr, kind, 0, 10, false)
+				if err != nil {
+					return err
+				}
+				if len(filtered) != wantCounts[kind] {
+					return fmt.Errorf("%s: unexpected number of entries "+
+						"with output kind %d: got %d, want %d", test.name,
+						kind, len(filtered), wantCounts[kind])
+				}
+			}
+		}
+
+		// Ensure filtering by an unknown kind is rejected.
+		_, _, err := idx.EntriesForAddressByOutputKind(dbTx, reusedAddr,
+			OutputKindChange+1, 0, 10, false)
+		if err == nil {
+			return errors.New("filtering by an unknown output kind did not " +
+				"fail")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexCredits ensures the entries for the addresses paid by the
+// outputs of transactions are flagged as credits when the index is configured
+// to do so and that only those entries are returned by CreditsForAddress.
+func TestAddrIndexCredits(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_credits")
+	defer teardown()
+
+	// Ensure querying the credits without the option is rejected.
+	fundAddr := testP2PKHAddr(t, 0x01)
+	payAddr := testP2PKHAddr(t, 0x02)
+	_, _, err := idx.CreditsForAddress(nil, fundAddr, 0, 10, false)
+	if !errors.Is(err, ErrCreditFlagsUnavailable) {
+		t.Fatalf("unexpected error without credit flags: got %v, want %v",
+			err, ErrCreditFlagsUnavailable)
+	}
+	idx.creditFlags = true
+
+	// Connect a block that pays an address followed by a block with a
+	// transaction that spends it to pay another address.
+	_, fundScript := fundAddr.PaymentScript()
+	_, payScript := payAddr.PaymentScript()
+	coinbase := newTestCoinbase(1, fundScript)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	prevOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+	spendTx.AddTxOut(wire.NewTxOut(1e8, payScript))
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+	prevScripts := testPrevScripter{prevOut: {script: fundScript,
+		amount: 1e8}}
+	connectTestBlock(t, idx, block2, 2, prevScripts, false)
+
+	tests := []struct {
+		name        string
+		addr        stdaddr.Address
+		wantEntries int
+		wantCredits []*chainhash.Hash
+	}{{
+		name:        "funding address",
+		addr:        fundAddr,
+		wantEntries: 2,
+		wantCredits: []*chainhash.Hash{block1.Hash()},
+	}, {
+		name:        "payment address",
+		addr:        payAddr,
+		wantEntries: 1,
+		wantCredits: []*chainhash.Hash{block2.Hash()},
+	}}
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, _, err := idx.EntriesForAddress(dbTx, test.addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != test.wantEntries {
+				return fmt.Errorf("%s: unexpected number of entries: got %d, "+
+					"want %d", test.name, len(entries), test.wantEntries)
+			}
+
+			credits, _, err := idx.CreditsForAddress(dbTx, test.addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(credits) != len(test.wantCredits) {
+				return fmt.Errorf("%s: unexpected number of credits: got %d, "+
+					"want %d", test.name, len(credits), len(test.wantCredits))
+			}
+			for i, credit := range credits {
+				if !credit.Credit {
+					return fmt.Errorf("%s: credit %d is not flagged",
+						test.name, i)
+				}
+				if *credit.BlockRegion.Hash != *test.wantCredits[i] {
+					return fmt.Errorf("%s: unexpected block for credit %d: "+
+						"got %v, want %v", test.name, i,
+						credit.BlockRegion.Hash, test.wantCredits[i])
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexDisapprovedEntries ensures the entries for the regular
+// transactions of a block whose regular tree is disapproved by the votes in the
+// next block are flagged as disapproved only when the index is configured to
+// track disapprovals and that the flag is cleared when the disapproving block
+// is disconnected.
+func TestAddrIndexDisapprovedEntries(t *testing.T) {
+	t.Parallel()
+
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+
+	// newBlock returns a block at the provided height that pays the address
+	// via its coinbase with the provided vote bits.
+	newBlock := func(height uint32, prevHash *chainhash.Hash, voteBits uint16, nonce uint32) *dcrutil.Block {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+		header := &block.MsgBlock().Header
+		header.VoteBits = voteBits
+		header.Nonce = nonce
+		return dcrutil.NewBlock(block.MsgBlock())
+	}
+
+	for _, trackDisapprovals := range []bool{false, true} {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"disapproved_%v", trackDisapprovals))
+		defer teardown()
+		idx.trackDisapprovals = trackDisapprovals
+
+		// Connect a block followed by a block that approves it, and a third
+		// block that disapproves the second one.
+		block1 := newBlock(1, &idx.chainParams.GenesisHash,
+			dcrutil.BlockValid, 0)
+		block2 := newBlock(2, block1.Hash(), dcrutil.BlockValid, 0)
+		block3 := newBlock(3, block2.Hash(), 0, 0)
+		connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+		connectTestBlock(t, idx, block2, 2, testPrevScripter{}, false)
+		connectTestBlock(t, idx, block3, 3, testPrevScripter{}, false)
+
+		// checkDisapproved ensures the entries for the address are flagged
+		// as disapproved for exactly the provided blocks.
+		checkDisapproved := func(numEntries int, disapproved ...*dcrutil.Block) {
+			t.Helper()
+
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != numEntries {
+				t.Fatalf("unexpected number of entries (track disapprovals "+
+					"%v): got %d, want %d", trackDisapprovals, len(entries),
+					numEntries)
+			}
+			for _, entry := range entries {
+				var want bool
+				for _, block := range disapproved {
+					if *entry.BlockRegion.Hash == *block.Hash() {
+						want = true
+					}
+				}
+				if entry.Disapproved != want {
+					t.Fatalf("unexpected disapproved flag for entry in block "+
+						"%v (track disapprovals %v): got %v, want %v",
+						entry.BlockRegion.Hash, trackDisapprovals,
+						entry.Disapproved, want)
+				}
+			}
+		}
+		if trackDisapprovals {
+			checkDisapproved(3, block2)
+		} else {
+			checkDisapproved(3)
+		}
+
+		// Disconnect the disapproving block and ensure the flag is cleared.
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return idx.disconnectBlock(dbTx, block3, block2,
+				testPrevScripter{}, false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDisapproved(2)
+
+		// Connect a block that approves the second block in its place and
+		// ensure none of the entries are flagged.
+		err = idx.chain.(*testChain).RemoveBlock(block3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block3a := newBlock(3, block2.Hash(), dcrutil.BlockValid, 1)
+		connectTestBlock(t, idx, block3a, 3, testPrevScripter{}, false)
+		checkDisapproved(3)
+
+		// Ensure the record of the disapproval is not reported as orphaned
+		// companion data while the disapproving block is connected.
+		block4 := newBlock(4, block3a.Hash(), 0, 0)
+		connectTestBlock(t, idx, block4, 4, testPrevScripter{}, false)
+		if trackDisapprovals {
+			checkDisapproved(4, block3a)
+		}
+		err = idx.db.View(func(dbTx database.Tx) error {
+			orphans, err := idx.VerifyCompanionConsistency(dbTx)
+			if err != nil {
+				return err
+			}
+			if len(orphans) != 0 {
+				return fmt.Errorf("unexpected orphans: %+v", orphans)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestAddrIndexInputIndexes ensures the entries for debits identify the inputs
+// of the spending transaction that reference the address when the index is
+// configured to track input indices, that the input indices of entries for
+// blocks without tracked input indices are reported as unknown, and that the
+// input indices are removed when the block is disconnected.
+func TestAddrIndexInputIndexes(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_inputindexes")
+	defer teardown()
+	idx.trackInputIndexes = true
+
+	// Connect a block that pays one address via two outputs and another
+	// address via one output followed by a block with a transaction that
+	// spends all of them to pay a third address.
+	fundAddr := testP2PKHAddr(t, 0x01)
+	otherAddr := testP2PKHAddr(t, 0x02)
+	payAddr := testP2PKHAddr(t, 0x03)
+	_, fundScript := fundAddr.PaymentScript()
+	_, otherScript := otherAddr.PaymentScript()
+	_, payScript := payAddr.PaymentScript()
+	coinbase := newTestCoinbase(1, fundScript, otherScript, fundScript)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	prevScripts := make(testPrevScripter)
+	spendTx := wire.NewMsgTx()
+	for _, out := range []struct {
+		index  uint32
+		script []byte
+	}{{2, otherScript}, {1, fundScript}, {3, fundScript}} {
+		prevOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: out.index}
+		spendTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+		prevScripts[prevOut] = testPrevScript{script: out.script,
+			amount: 1e8}
+	}
+	spendTx.AddTxOut(wire.NewTxOut(3e8, payScript))
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+	connectTestBlock(t, idx, block2, 2, prevScripts, false)
+
+	// checkInputs ensures the entries for the provided address have the
+	// provided input indices in order along with whether or not they are
+	// known.
+	checkInputs := func(addr stdaddr.Address, wantKnown bool, want ...[]uint32) {
+		t.Helper()
+
+		entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("unexpected number of entries for %v: got %d, want %d",
+				addr, len(entries), len(want))
+		}
+		for i, entry := range entries {
+			if entry.InputIndexesKnown != wantKnown {
+				t.Fatalf("unexpected known flag for entry %d of %v: got %v, "+
+					"want %v", i, addr, entry.InputIndexesKnown, wantKnown)
+			}
+			if !reflect.DeepEqual(entry.InputIndexes, want[i]) {
+				t.Fatalf("unexpected input indices for entry %d of %v: got "+
+					"%v, want %v", i, addr, entry.InputIndexes, want[i])
+			}
+		}
+	}
+	checkInputs(fundAddr, true, nil, []uint32{1, 2})
+	checkInputs(otherAddr, true, nil, []uint32{0})
+	checkInputs(payAddr, true, nil)
+
+	// Ensure the input indices are not reported as orphaned companion data.
+	err := idx.db.View(func(dbTx database.Tx) error {
+		orphans, err := idx.VerifyCompanionConsistency(dbTx)
+		if err != nil {
+			return err
+		}
+		if len(orphans) != 0 {
+			return fmt.Errorf("unexpected orphans: %+v", orphans)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Disconnect the spending block and ensure its input indices are removed.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1, prevScripts, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrInputIndexKey)
+		cursor := bucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			if bytes.HasPrefix(cursor.Key(), block2.Hash()[:]) {
+				return fmt.Errorf("input indices for disconnected block "+
+					"remain under key %x", cursor.Key())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs(fundAddr, true, nil)
+
+	// Remove the marker of the first block to simulate a block connected by
+	// a version of the index that did not track input indices and ensure the
+	// input indices of its entries are reported as unknown.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrInputIndexKey)
+		return bucket.Delete(block1.Hash()[:])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs(fundAddr, false, nil)
+}
+
+// TestAddrIndexGenesisOutputs ensures the outputs of the genesis block are only
+// indexed when the index is configured to index them and that they are only
+// indexed once.
+func TestAddrIndexGenesisOutputs(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_genesisoutputs")
+	defer teardown()
+
+	// The simulation network genesis block pays to a public key.
+	genesis := idx.chainParams.GenesisBlock
+	genesisOut := genesis.Transactions[0].TxOut[0]
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(genesisOut.Version,
+		genesisOut.PkScript, idx.chainParams, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 {
+		t.Fatalf("unexpected number of genesis addresses: %d", len(addrs))
+	}
+	genesisAddr := addrs[0]
+
+	// checkEntries ensures the genesis address has the expected number of
+	// entries and that they are all for the genesis block.
+	checkEntries := func(wantEntries int) {
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			entries, _, err := idx.EntriesForAddress(dbTx, genesisAddr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != wantEntries {
+				return fmt.Errorf("unexpected number of entries: got %d, "+
+					"want %d", len(entries), wantEntries)
+			}
+			for i, entry := range entries {
+				if *entry.BlockRegion.Hash != idx.chainParams.GenesisHash {
+					return fmt.Errorf("unexpected block for entry %d: got "+
+						"%v, want %v", i, entry.BlockRegion.Hash,
+						idx.chainParams.GenesisHash)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure the genesis outputs are not indexed by default.
+	if err := idx.indexGenesisBlock(idx.chainParams); err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(0)
+
+	// Ensure the genesis outputs are indexed when enabled and that indexing
+	// them again does not add duplicate entries.
+	idx.indexGenesisOutputs = true
+	for i := 0; i < 2; i++ {
+		if err := idx.indexGenesisBlock(idx.chainParams); err != nil {
+			t.Fatal(err)
+		}
+		checkEntries(1)
+	}
+}
+
+// TestAddrIndexEntriesForHash160 ensures querying the entries for raw address
+// hashes returns the same entries as querying the corresponding addresses and
+// that unsupported address types are rejected.
+func TestAddrIndexEntriesForHash160(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_hash160")
+	defer teardown()
+
+	// Connect a block that pays a public key hash and a script hash address.
+	pkhAddr := testP2PKHAddr(t, 0x01)
+	var scriptHash [20]byte
+	scriptHash[0] = 0x02
+	shAddr, err := stdaddr.NewAddressScriptHashV0FromHash(scriptHash[:],
+		idx.chainParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pkhScript := pkhAddr.PaymentScript()
+	_, shScript := shAddr.PaymentScript()
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, pkhScript, shScript)}, nil)
+	connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+
+	var pkhHash [20]byte
+	copy(pkhHash[:], pkhAddr.(stdaddr.Hash160er).Hash160()[:])
+	tests := []struct {
+		name     string
+		addrType uint8
+		hash160  [20]byte
+		addr     stdaddr.Address
+		wantErr  error
+	}{{
+		name:     "public key hash",
+		addrType: AddrTypePubKeyHash,
+		hash160:  pkhHash,
+		addr:     pkhAddr,
+	}, {
+		name:     "public key in standard key mode",
+		addrType: AddrTypePubKey,
+		hash160:  pkhHash,
+		addr:     pkhAddr,
+	}, {
+		name:     "script hash",
+		addrType: AddrTypeScriptHash,
+		hash160:  scriptHash,
+		addr:     shAddr,
+	}, {
+		name:     "no entries for hash of other type",
+		addrType: AddrTypePubKeyHashSchnorr,
+		hash160:  pkhHash,
+	}, {
+		name:     "unsupported type",
+		addrType: 0xff,
+		hash160:  pkhHash,
+		wantErr:  ErrUnsupportedAddressType,
+	}}
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			got, _, err := idx.EntriesForHash160(dbTx, test.addrType,
+				test.hash160, 0, 10, false)
+			if !errors.Is(err, test.wantErr) {
+				return fmt.Errorf("%s: unexpected error: got %v, want %v",
+					test.name, err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				continue
+			}
+
+			var want []TxIndexEntry
+			if test.addr != nil {
+				want, _, err = idx.EntriesForAddress(dbTx, test.addr, 0, 10,
+					false)
+				if err != nil {
+					return err
+				}
+				if len(want) != 1 {
+					return fmt.Errorf("%s: unexpected number of entries: %d",
+						test.name, len(want))
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				return fmt.Errorf("%s: mismatched entries: got %v, want %v",
+					test.name, got, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexActiveBlockHeights ensures the distinct heights of the blocks
+// that involve an address are returned in ascending order with multiple
+// transactions in the same block collapsed into a single height.
+func TestAddrIndexActiveBlockHeights(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_activeheights")
+	defer teardown()
+
+	// Connect a block with multiple transactions that pay the address, a
+	// block that does not involve it, and a block with a single transaction
+	// that pays it.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	_, otherScript := testP2PKHAddr(t, 0x02).PaymentScript()
+	payTx := wire.NewMsgTx()
+	payTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: 1}, 1e8, nil))
+	payTx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, pkScript), payTx}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2, otherScript)}, nil)
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, false)
+	block3 := newTestBlock(3, block2.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(3, pkScript)}, nil)
+	connectTestBlock(t, idx, block3, 3, testPrevScripter{}, false)
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		heights, err := idx.ActiveBlockHeights(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		if want := []int64{1, 3}; !reflect.DeepEqual(heights, want) {
+			return fmt.Errorf("unexpected heights: got %v, want %v",
+				heights, want)
+		}
+
+		// Ensure an address without any entries does not have any heights.
+		heights, err = idx.ActiveBlockHeights(dbTx, testP2PKHAddr(t, 0x03))
+		if err != nil {
+			return err
+		}
+		if len(heights) != 0 {
+			return fmt.Errorf("unexpected heights for unused address: %v",
+				heights)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexEntriesByTime ensures querying the entries for an address by
+// time range filters on the timestamps of the block headers regardless of
+// whether they were stored when the blocks were connected and that timestamps
+// loaded from the headers are only stored via writable transactions.
+func TestAddrIndexEntriesByTime(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_entriesbytime")
+	defer teardown()
+
+	// Create blocks that all pay to the same address with timestamps that
+	// increase with their height except for block 5, which has a timestamp
+	// between those of blocks 2 and 3.  The timestamps of the first three
+	// blocks are stored when they are connected while those of the rest are
+	// not.
+	const numBlocks = 6
+	const baseTime = 1600000000
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	blockTime := func(height uint32) int64 {
+		if height == 5 {
+			return baseTime + 2*300 + 1
+		}
+		return baseTime + int64(height)*300
+	}
+	blocks := make([]*dcrutil.Block, 0, numBlocks)
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+		block.MsgBlock().Header.Timestamp = time.Unix(blockTime(height), 0)
+		block = dcrutil.NewBlock(block.MsgBlock())
+		idx.storeBlockTimes = height <= 3
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+
+	// checkStoredTimes ensures the timestamps of the blocks at the provided
+	// heights are the only ones that are stored.
+	checkStoredTimes := func(heights ...uint32) {
+		t.Helper()
+
+		want := make(map[uint32]struct{}, len(heights))
+		for _, height := range heights {
+			want[height] = struct{}{}
+		}
+		err := idx.db.View(func(dbTx database.Tx) error {
+			for _, block := range blocks {
+				height := block.MsgBlock().Header.Height
+				_, wantStored := want[height]
+				timestamp, stored := dbFetchAddrBlockTime(dbTx, block.Hash())
+				if stored != wantStored {
+					return fmt.Errorf("unexpected stored status for block "+
+						"%d: got %v, want %v", height, stored, wantStored)
+				}
+				if stored && timestamp != blockTime(height) {
+					return fmt.Errorf("unexpected stored time for block "+
+						"%d: got %d, want %d", height, timestamp,
+						blockTime(height))
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkStoredTimes(1, 2, 3)
+
+	// queryHeights returns the heights of the blocks of the entries returned
+	// by querying the address for the provided time range.
+	queryHeights := func(dbTx database.Tx, startUnix, endUnix int64, numToSkip, numRequested uint32, reverse bool) ([]uint32, error) {
+		entries, _, err := idx.EntriesForAddressByTime(dbTx, addr, startUnix,
+			endUnix, numToSkip, numRequested, reverse)
+		if err != nil {
+			return nil, err
+		}
+		heights := make([]uint32, 0, len(entries))
+		for _, entry := range entries {
+			for _, block := range blocks {
+				if *block.Hash() == *entry.BlockRegion.Hash {
+					heights = append(heights, block.MsgBlock().Header.Height)
+				}
+			}
+		}
+		return heights, nil
+	}
+
+	tests := []struct {
+		name         string
+		numToSkip    uint32
+		numRequested uint32
+		reverse      bool
+		want         []uint32
+	}{{
+		name:         "all in range",
+		numRequested: 10,
+		want:         []uint32{2, 3, 5},
+	}, {
+		name:         "skip one",
+		numToSkip:    1,
+		numRequested: 10,
+		want:         []uint32{3, 5},
+	}, {
+		name:         "limit one",
+		numRequested: 1,
+		want:         []uint32{2},
+	}, {
+		name:         "reversed",
+		numRequested: 10,
+		reverse:      true,
+		want:         []uint32{5, 3, 2},
+	}}
+
+	// Ensure the entries in the time range are returned via a read-only
+	// transaction without storing any timestamps.
+	startUnix, endUnix := blockTime(2), blockTime(4)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			got, err := queryHeights(dbTx, startUnix, endUnix, test.numToSkip,
+				test.numRequested, test.reverse)
+			if err != nil {
+				return fmt.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				return fmt.Errorf("%s: unexpected heights: got %v, want %v",
+					test.name, got, test.want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStoredTimes(1, 2, 3)
+
+	// Ensure the timestamps loaded from the headers are stored when querying
+	// via a writable transaction.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		got, err := queryHeights(dbTx, startUnix, endUnix, 0, 10, false)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(got, tests[0].want) {
+			return fmt.Errorf("unexpected heights: got %v, want %v", got,
+				tests[0].want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStoredTimes(1, 2, 3, 4, 5, 6)
+
+	// Ensure the timestamp of a disconnected block is removed.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, blocks[numBlocks-1],
+			blocks[numBlocks-2], testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStoredTimes(1, 2, 3, 4, 5)
+}
+
+// TestAddrIndexDeleteAddress ensures deleting an address removes all of its
+// entries, ticket commitment amounts, and totals while the entries for other
+// addresses remain intact and that deleting an address without any entries is
+// not an error.
+func TestAddrIndexDeleteAddress(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_deleteaddr")
+	defer teardown()
+	idx.trackTotals = true
+
+	// Connect enough blocks paying to two addresses to populate multiple
+	// levels where the first block also has a ticket that commits to the first
+	// address.
+	delAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	keepAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	_, delScript := delAddr.PaymentScript()
+	_, keepScript := keepAddr.PaymentScript()
+	const numBlocks = level0MaxEntries*3 + 1
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		var stxns []*wire.MsgTx
+		if height == 1 {
+			stxns = append(stxns, newTestTicket(chainhash.Hash{0x01},
+				keepAddr, delAddr, 1e8))
+		}
+		block := newTestBlock(height, prevHash, []*wire.MsgTx{
+			newTestCoinbase(height, delScript, keepScript)}, stxns)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	// checkEntries ensures the provided address has the expected number of
+	// entries.
+	checkEntries := func(addr stdaddr.Address, want int) {
+		t.Helper()
+
+		entries, _, err := idx.EntriesForAddress(nil, addr, 0, math.MaxUint32,
+			false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != want {
+			t.Fatalf("unexpected number of entries for %s: got %d, want %d",
+				addr, len(entries), want)
+		}
+	}
+	checkEntries(delAddr, numBlocks+1)
+	checkEntries(keepAddr, numBlocks+1)
+
+	// Delete the address twice to ensure deleting an address without any
+	// entries is not an error.
+	for i := 0; i < 2; i++ {
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return idx.DeleteAddress(dbTx, delAddr)
+		})
+		if err != nil {
+			t.Fatalf("unable to delete address (attempt %d): %v", i, err)
+		}
+	}
+
+	checkEntries(delAddr, 0)
+	checkEntries(keepAddr, numBlocks+1)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		hasAddr, err := idx.HasAddress(dbTx, delAddr)
+		if err != nil {
+			return err
+		}
+		if hasAddr {
+			return errors.New("deleted address still exists")
+		}
+		amounts, err := idx.CommittedAmountsForAddress(dbTx, delAddr)
+		if err != nil {
+			return err
+		}
+		if len(amounts) != 0 {
+			return fmt.Errorf("unexpected committed amounts for deleted "+
+				"address: %v", amounts)
+		}
+		credited, debited, err := idx.AddressTotals(dbTx, delAddr)
+		if err != nil {
+			return err
+		}
+		if credited != 0 || debited != 0 {
+			return fmt.Errorf("unexpected totals for deleted address: "+
+				"%v/%v", credited, debited)
+		}
+
+		// The remaining address is paid by every coinbase along with the
+		// voting rights output of the ticket.
+		credited, _, err = idx.AddressTotals(dbTx, keepAddr)
+		if err != nil {
+			return err
+		}
+		const wantCredited = dcrutil.Amount((numBlocks + 1) * 1e8)
+		if credited != wantCredited {
+			return fmt.Errorf("unexpected credited total for remaining "+
+				"address: got %v, want %v", credited, wantCredited)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexResumeDrop ensures an interrupted drop of the address index is
+// reported as in progress and is able to be resumed to completion.
+func TestAddrIndexResumeDrop(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_resumedrop")
+	defer teardown()
+
+	const numBlocks = 4
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+
+	// checkDropInProgress ensures whether or not a drop is reported as in
+	// progress matches the provided value.
+	checkDropInProgress := func(want bool) {
+		t.Helper()
+
+		got, err := idx.DropInProgress(idx.db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("unexpected drop in progress: got %v, want %v", got,
+				want)
+		}
+	}
+	checkDropInProgress(false)
+
+	// Ensure resuming when no drop is in progress does not modify the index.
+	ctx := context.Background()
+	want := dumpAddrIndex(t, idx)
+	if err := idx.ResumeDrop(ctx, idx.db); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dumpAddrIndex(t, idx), want) {
+		t.Fatal("address index modified by resume without a drop in progress")
+	}
+
+	// Begin a drop that is interrupted and ensure it is reported as in
+	// progress with the index bucket still present.
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err := idx.DropIndex(canceledCtx, idx.db)
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected drop error with canceled context: got %v, "+
+			"want %v", err, errInterruptRequested)
+	}
+	checkDropInProgress(true)
+	bucketExists := func() bool {
+		t.Helper()
+
+		var exists bool
+		err := idx.db.View(func(dbTx database.Tx) error {
+			exists = dbTx.Metadata().Bucket(addrIndexKey) != nil
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return exists
+	}
+	if !bucketExists() {
+		t.Fatal("address index bucket removed by interrupted drop")
+	}
+
+	// Ensure resuming the drop with a canceled context leaves it in
+	// progress.
+	err = idx.ResumeDrop(canceledCtx, idx.db)
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected resume error with canceled context: got %v, "+
+			"want %v", err, errInterruptRequested)
+	}
+	checkDropInProgress(true)
+
+	// Resume the drop to completion and ensure the bucket, index tip, and
+	// drop marker are all removed.
+	if err := idx.ResumeDrop(ctx, idx.db); err != nil {
+		t.Fatalf("unable to resume drop: %v", err)
+	}
+	checkDropInProgress(false)
+	if bucketExists() {
+		t.Fatal("address index bucket not removed by resumed drop")
+	}
+	exists, err := existsIndex(idx.db, addrIndexKey, addrIndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("address index tip not removed by resumed drop")
+	}
+}
+
+// TestAddrIndexRepairCorruptedAddress ensures corrupt entries for an address
+// are detected and rebuilt from the blocks they reference with the previous
+// outputs loaded via the transaction index.
+func TestAddrIndexRepairCorruptedAddress(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_repair")
+	defer teardown()
+
+	// Connect enough blocks paying to the same address to populate multiple
+	// levels.  The second block also contains a transaction that spends the
+	// output paying to the address in the first block, so the address is
+	// only involved via the input which requires the previous output script
+	// to be loaded from the transaction index when it is repaired.  All of
+	// the blocks are stored in the database and added to the transaction
+	// index so the repair is able to load them.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	_, otherPkScript := testP2PKHAddr(t, 0x02).PaymentScript()
+	const numBlocks = 12
+	var firstCoinbase *wire.MsgTx
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		txns := []*wire.MsgTx{newTestCoinbase(height, pkScript)}
+		prevScripts := testPrevScripter{}
+		if height == 1 {
+			firstCoinbase = txns[0]
+		}
+		if height == 2 {
+			spendOutPoint := wire.OutPoint{Hash: firstCoinbase.TxHash(),
+				Index: 1}
+			spendTx := wire.NewMsgTx()
+			spendTx.AddTxIn(&wire.TxIn{PreviousOutPoint: spendOutPoint})
+			spendTx.AddTxOut(wire.NewTxOut(1e8, otherPkScript))
+			txns = append(txns, spendTx)
+			prevScripts[spendOutPoint] = testPrevScript{script: pkScript}
+		}
+		block := newTestBlock(height, prevHash, txns, nil)
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+			return dbAddTxIndexEntries(dbTx, block, height)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectTestBlock(t, idx, block, height, prevScripts, false)
+		prevHash = block.Hash()
+	}
+	want := dumpAddrIndex(t, idx)
+
+	// repair attempts to repair the address after applying the provided
+	// modification to the raw data of the given level and returns whether or
+	// not it was repaired.
+	repair := func(level uint8, modify func([]byte) []byte) bool {
+		t.Helper()
+
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var repaired bool
+		err = idx.db.Update(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(addrIndexKey)
+			levelKey := keyForLevel(addrKey, level)
+			levelData := append([]byte(nil), bucket.Get(levelKey[:])...)
+			err := bucket.Put(levelKey[:], modify(levelData))
+			if err != nil {
+				return err
+			}
+			repaired, err = idx.RepairCorruptedAddress(dbTx, addr)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unable to repair address: %v", err)
+		}
+		return repaired
+	}
+
+	// Ensure entries that are not corrupt are not repaired.
+	unmodified := func(levelData []byte) []byte { return levelData }
+	if repair(0, unmodified) {
+		t.Fatal("entries without corruption were repaired")
+	}
+
+	// Ensure a level with an invalid size is repaired such that the index is
+	// identical to before it was corrupted.
+	if !repair(0, func(levelData []byte) []byte {
+		return levelData[:len(levelData)-3]
+	}) {
+		t.Fatal("entries with an invalid level size were not repaired")
+	}
+	got := dumpAddrIndex(t, idx)
+	if len(got) != len(want) {
+		t.Fatalf("mismatched number of keys: got %d, want %d", len(got),
+			len(want))
+	}
+	for k, wantV := range want {
+		if !bytes.Equal(got[k], wantV) {
+			t.Fatalf("mismatched data for key %x: got %x, want %x", k, got[k],
+				wantV)
+		}
+	}
+
+	// Ensure an entry that refers to an unknown block is repaired by removing
+	// it since the block it refers to can no longer be determined.  Since the
+	// oldest entry is the only one for the first block, it is lost.
+	if !repair(1, func(levelData []byte) []byte {
+		byteOrder.PutUint32(levelData[0:4], 999)
+		return levelData
+	}) {
+		t.Fatal("entries with an unknown block ID were not repaired")
+	}
+	entries, _, err := idx.EntriesForAddress(nil, addr, 0, numBlocks*2, false)
+	if err != nil {
+		t.Fatalf("unable to fetch repaired entries: %v", err)
+	}
+	const wantEntries = numBlocks
+	if len(entries) != wantEntries {
+		t.Fatalf("unexpected number of repaired entries: got %d, want %d",
+			len(entries), wantEntries)
+	}
+	if repair(0, unmodified) {
+		t.Fatal("repaired entries were repaired again")
+	}
+}
+
+// TestAddrIndexReindexRange ensures reindexing a range of blocks whose entries
+// were corrupted restores the entries that result from indexing all of the
+// blocks, leaves the tip unchanged, and rejects invalid ranges.
+func TestAddrIndexReindexRange(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_reindexrange")
+	defer teardown()
+
+	const numBlocks = 30
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	// walkEntries returns all of the entries in the index keyed by address.
+	walkEntries := func() map[[addrKeySize]byte][]TxIndexEntry {
+		t.Helper()
+
+		results := make(map[[addrKeySize]byte][]TxIndexEntry)
+		err := idx.db.View(func(dbTx database.Tx) error {
+			return idx.WalkAll(dbTx, func(addrKey [addrKeySize]byte,
+				entries []TxIndexEntry) error {
+
+				results[addrKey] = entries
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+	want := walkEntries()
+	wantTipHeight, wantTipHash, err := idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the start offsets of all entries that reference the blocks in
+	// the range to reindex.  The internal block IDs of the test blocks match
+	// their heights.
+	const startHeight, endHeight = 8, 12
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		corrupted := make(map[string][]byte)
+		cursor := bucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			levelData := append([]byte(nil), cursor.Value()...)
+			var modified bool
+			for offset := 0; offset < len(levelData); offset += txEntrySize {
+				blockID := byteOrder.Uint32(levelData[offset:])
+				if blockID >= startHeight && blockID <= endHeight {
+					byteOrder.PutUint32(levelData[offset+4:], 0xffffffff)
+					modified = true
+				}
+			}
+			if modified {
+				corrupted[string(cursor.Key())] = levelData
+			}
+		}
+		for key, levelData := range corrupted {
+			if err := bucket.Put([]byte(key), levelData); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(walkEntries(), want) {
+		t.Fatal("entries were not corrupted")
+	}
+
+	// Ensure invalid ranges and interrupted reindexes are rejected without
+	// modifying the index.
+	invalidRanges := [][2]int64{{0, 5}, {10, 9}, {5, numBlocks + 1}}
+	for _, r := range invalidRanges {
+		err := idx.ReindexRange(context.Background(), r[0], r[1])
+		if err == nil {
+			t.Fatalf("reindexing invalid range %v did not fail", r)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = idx.ReindexRange(ctx, startHeight, endHeight)
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected error for interrupted reindex: got %v, want %v",
+			err, errInterruptRequested)
+	}
+
+	// Ensure a reindex that is interrupted while disconnecting blocks restores
+	// the original tip.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	chain := idx.chain
+	idx.chain = &interruptingChain{ChainQueryer: chain, cancel: cancel,
+		remaining: 3}
+	err = idx.ReindexRange(ctx, startHeight, endHeight)
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected error for interrupted reindex: got %v, want %v",
+			err, errInterruptRequested)
+	}
+	idx.chain = chain
+	tipHeight, tipHash, err := idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != wantTipHeight || *tipHash != *wantTipHash {
+		t.Fatalf("unexpected tip after interrupted reindex: got %d (%s), "+
+			"want %d (%s)", tipHeight, tipHash, wantTipHeight, wantTipHash)
+	}
+
+	// Ensure reindexing the range restores the entries and tip and keeps the
+	// spend consumer tip in sync.
+	idx.consumer = NewSpendConsumer(idx.Name(), &idx.chainParams.GenesisHash,
+		idx.chain)
+	if err := idx.ReindexRange(context.Background(), startHeight,
+		endHeight); err != nil {
+
+		t.Fatalf("unable to reindex range: %v", err)
+	}
+	if got := walkEntries(); !reflect.DeepEqual(got, want) {
+		t.Fatal("reindexed entries do not match the original entries")
+	}
+	tipHeight, tipHash, err = idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != wantTipHeight || *tipHash != *wantTipHash {
+		t.Fatalf("unexpected tip: got %d (%s), want %d (%s)", tipHeight,
+			tipHash, wantTipHeight, wantTipHash)
+	}
+	if consumerTip := idx.consumer.Tip(); *consumerTip != *wantTipHash {
+		t.Fatalf("unexpected spend consumer tip: got %s, want %s",
+			consumerTip, wantTipHash)
+	}
+}
+
+// interruptingChain wraps a chain queryer to invoke the provided cancel
+// function once the provided number of blocks have been fetched.
+type interruptingChain struct {
+	ChainQueryer
+	cancel    context.CancelFunc
+	remaining int
+}
+
+// BlockByHash returns the block of the provided hash and invokes the cancel
+// function once the configured number of blocks have been fetched.
+func (c *interruptingChain) BlockByHash(hash *chainhash.Hash) (*dcrutil.Block, error) {
+	c.remaining--
+	if c.remaining == 0 {
+		c.cancel()
+	}
+	return c.ChainQueryer.BlockByHash(hash)
+}
+
+// TestAddrIndexEntriesForAddressPage ensures paging through the entries for an
+// address with page cursors in both directions returns all of the entries in
+// the expected order and that cursors are invalidated as expected.
+func TestAddrIndexEntriesForAddressPage(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_page")
+	defer teardown()
+
+	// connectBlocks connects blocks paying to the address through the
+	// provided height.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	prevHash := &idx.chainParams.GenesisHash
+	var height uint32
+	connectBlocks := func(endHeight uint32) {
+		t.Helper()
+
+		for height < endHeight {
+			height++
+			block := newTestBlock(height, prevHash,
+				[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+			connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+			prevHash = block.Hash()
+		}
+	}
+
+	// fetchPage returns the requested page of entries for the address.
+	fetchPage := func(cursor []byte, numRequested uint32, reverse bool) ([]TxIndexEntry, []byte, error) {
+		var entries []TxIndexEntry
+		var nextCursor []byte
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			entries, nextCursor, err = idx.EntriesForAddressPage(dbTx, addr,
+				cursor, numRequested, reverse)
+			return err
+		})
+		return entries, nextCursor, err
+	}
+
+	// Connect enough blocks to populate multiple levels with 1 entry in level
+	// 0, 8 in level 1, and 16 in level 2.
+	const numEntries = level0MaxEntries*3 + 1
+	connectBlocks(numEntries)
+	wantEntries, _, err := idx.EntriesForAddress(nil, addr, 0, numEntries,
+		false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure paging through all of the entries in both directions with
+	// various page sizes returns all of the entries in the expected order.
+	for _, reverse := range []bool{false, true} {
+		for _, pageSize := range []uint32{1, 3, 8, numEntries, numEntries + 5} {
+			var gotEntries []TxIndexEntry
+			var cursor []byte
+			for {
+				entries, nextCursor, err := fetchPage(cursor, pageSize,
+					reverse)
+				if err != nil {
+					t.Fatalf("reverse %v, page size %d: unexpected error: %v",
+						reverse, pageSize, err)
+				}
+				if nextCursor != nil && uint32(len(entries)) != pageSize {
+					t.Fatalf("reverse %v, page size %d: short page of %d "+
+						"entries with more remaining", reverse, pageSize,
+						len(entries))
+				}
+				gotEntries = append(gotEntries, entries...)
+				if nextCursor == nil {
+					break
+				}
+				cursor = nextCursor
+			}
+
+			if len(gotEntries) != numEntries {
+				t.Fatalf("reverse %v, page size %d: unexpected number of "+
+					"entries: got %d, want %d", reverse, pageSize,
+					len(gotEntries), numEntries)
+			}
+			for i := range gotEntries {
+				want := wantEntries[i]
+				if reverse {
+					want = wantEntries[numEntries-i-1]
+				}
+				if *gotEntries[i].BlockRegion.Hash != *want.BlockRegion.Hash {
+					t.Fatalf("reverse %v, page size %d: mismatched entry "+
+						"%d", reverse, pageSize, i)
+				}
+			}
+		}
+	}
+
+	// Ensure a cursor for the reverse direction remains valid when entries
+	// are added to level 0 without causing a merge and continues with the
+	// same entries.
+	entries, cursor, err := fetchPage(nil, 3, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || cursor == nil {
+		t.Fatalf("unexpected first page: %d entries, cursor %x", len(entries),
+			cursor)
+	}
+	connectBlocks(numEntries + 2)
+	entries, _, err = fetchPage(cursor, numEntries, true)
+	if err != nil {
+		t.Fatalf("unexpected error after adding entries: %v", err)
+	}
+	if len(entries) != numEntries-3 {
+		t.Fatalf("unexpected number of remaining entries: got %d, want %d",
+			len(entries), numEntries-3)
+	}
+	if *entries[0].BlockRegion.Hash != *wantEntries[numEntries-4].BlockRegion.Hash {
+		t.Fatal("mismatched entry after adding entries")
+	}
+
+	// Ensure a cursor is rejected when used for the other direction.
+	_, _, err = fetchPage(cursor, 1, false)
+	if !errors.Is(err, ErrInvalidPageCursor) {
+		t.Fatalf("unexpected error for cursor in other direction: got %v, "+
+			"want %v", err, ErrInvalidPageCursor)
+	}
+
+	// Ensure a cursor remains valid when entries are merged into the end of
+	// the level it refers to.  The cursor refers to level 1 which is half full
+	// at this point, so filling level 0 merges it into the end of level 1.
+	connectBlocks(numEntries + level0MaxEntries)
+	_, _, err = fetchPage(cursor, 1, true)
+	if err != nil {
+		t.Fatalf("unexpected error after merge into level: %v", err)
+	}
+
+	// Ensure a cursor is rejected once the level it refers to is merged into
+	// a higher level.
+	connectBlocks(numEntries + level0MaxEntries*2)
+	_, _, err = fetchPage(cursor, 1, true)
+	if !errors.Is(err, ErrInvalidPageCursor) {
+		t.Fatalf("unexpected error for cursor after merge: got %v, want %v",
+			err, ErrInvalidPageCursor)
+	}
+
+	// Ensure an address without any entries does not return any entries or
+	// a cursor.
+	err = idx.db.View(func(dbTx database.Tx) error {
+		entries, cursor, err := idx.EntriesForAddressPage(dbTx,
+			testP2PKHAddr(t, 0x02), nil, 10, false)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 0 || cursor != nil {
+			return fmt.Errorf("unexpected results for unknown address: %d "+
+				"entries, cursor %x", len(entries), cursor)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexSnapshot ensures queries made via a snapshot observe a
+// consistent view of the address index while blocks are concurrently connected
+// and that closed snapshots can no longer be queried.
+func TestAddrIndexSnapshot(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_snapshot")
+	defer teardown()
+
+	// Create blocks that all pay to the same address and connect the first
+	// several of them prior to taking the snapshot.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	const numBlocks = 60
+	const numInitialBlocks = 10
+	blocks := make([]*dcrutil.Block, 0, numBlocks)
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks[:numInitialBlocks], 1)
+
+	snapshot, err := idx.Snapshot()
+	if err != nil {
+		t.Fatalf("unable to create snapshot: %v", err)
+	}
+
+	// Connect the remaining blocks in parallel with reads via the snapshot.
+	connectErr := make(chan error, 1)
+	go func() {
+		for _, block := range blocks[numInitialBlocks:] {
+			err := idx.db.Update(func(dbTx database.Tx) error {
+				return idx.connectBlock(dbTx, block, nil, testPrevScripter{},
+					false)
+			})
+			if err != nil {
+				connectErr <- err
+				return
+			}
+		}
+		connectErr <- nil
+	}()
+
+	var done bool
+	for !done {
+		select {
+		case err := <-connectErr:
+			if err != nil {
+				t.Fatalf("unable to connect block: %v", err)
+			}
+			done = true
+		default:
+		}
+
+		entries, _, err := snapshot.EntriesForAddress(addr, 0, numBlocks,
+			false)
+		if err != nil {
+			t.Fatalf("unable to query snapshot: %v", err)
+		}
+		if len(entries) != numInitialBlocks {
+			t.Fatalf("unexpected number of snapshot entries: got %d, want %d",
+				len(entries), numInitialBlocks)
+		}
+		pageEntries, _, err := snapshot.EntriesForAddressPage(addr, nil,
+			numBlocks, true)
+		if err != nil {
+			t.Fatalf("unable to query snapshot page: %v", err)
+		}
+		if len(pageEntries) != numInitialBlocks {
+			t.Fatalf("unexpected number of snapshot page entries: got %d, "+
+				"want %d", len(pageEntries), numInitialBlocks)
+		}
+	}
+
+	// Ensure queries made without the snapshot observe all of the blocks.
+	entries, _, err := idx.EntriesForAddress(nil, addr, 0, numBlocks, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != numBlocks {
+		t.Fatalf("unexpected number of entries: got %d, want %d",
+			len(entries), numBlocks)
+	}
+
+	// Ensure the snapshot can no longer be queried once it is closed and that
+	// closing it again has no effect.
+	if err := snapshot.Close(); err != nil {
+		t.Fatalf("unable to close snapshot: %v", err)
+	}
+	if err := snapshot.Close(); err != nil {
+		t.Fatalf("unexpected error closing snapshot again: %v", err)
+	}
+	_, _, err = snapshot.EntriesForAddress(addr, 0, 1, false)
+	if !errors.Is(err, ErrSnapshotClosed) {
+		t.Fatalf("unexpected error querying closed snapshot: got %v, want %v",
+			err, ErrSnapshotClosed)
+	}
+	_, err = snapshot.HasAddress(addr)
+	if !errors.Is(err, ErrSnapshotClosed) {
+		t.Fatalf("unexpected error querying closed snapshot: got %v, want %v",
+			err, ErrSnapshotClosed)
+	}
+}
+
+// TestAddrIndexProcessNotificationErrors ensures failures to connect and
+// disconnect blocks are returned as the typed errors that identify the block.
+func TestAddrIndexProcessNotificationErrors(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_ntfnerrors")
+	defer teardown()
+
+	// Create a block that pays an address without an internal block ID, so it
+	// can be neither connected nor disconnected.
+	_, payScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, payScript)}, nil)
+
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType: ConnectNtfn,
+			Block:    block,
+		})
+	})
+	var cErr ConnectBlockError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("unexpected connect error type: %T (%v)", err, err)
+	}
+	if cErr.Index != idx.Name() || cErr.Hash != *block.Hash() {
+		t.Fatalf("unexpected connect error details: %+v", cErr)
+	}
+	if !errors.Is(err, errNoBlockIDEntry) {
+		t.Fatalf("unexpected connect error cause: %v", cErr.Err)
+	}
+
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType: DisconnectNtfn,
+			Block:    block,
+		})
+	})
+	var dErr DisconnectBlockError
+	if !errors.As(err, &dErr) {
+		t.Fatalf("unexpected disconnect error type: %T (%v)", err, err)
+	}
+	if dErr.Index != idx.Name() || dErr.Hash != *block.Hash() {
+		t.Fatalf("unexpected disconnect error details: %+v", dErr)
+	}
+}
+
+// TestAddrIndexNotificationOrdering ensures duplicate and out of order connects
+// and disconnects do not modify the index and that the ones which do not match
+// the index tip are rejected.
+func TestAddrIndexNotificationOrdering(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_ntfnordering")
+	defer teardown()
+
+	const numBlocks = 5
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks[:3], 1)
+	want := dumpAddrIndex(t, idx)
+
+	// connect attempts to connect the provided block to the index.
+	connect := func(block *dcrutil.Block) error {
+		return idx.db.Update(func(dbTx database.Tx) error {
+			return idx.connectBlock(dbTx, block, nil, testPrevScripter{},
+				false)
+		})
+	}
+
+	// disconnect attempts to disconnect the provided block from the index.
+	disconnect := func(block *dcrutil.Block) error {
+		return idx.db.Update(func(dbTx database.Tx) error {
+			return idx.disconnectBlock(dbTx, block, nil, testPrevScripter{},
+				false)
+		})
+	}
+
+	// checkUnchanged ensures the index matches the expected state.
+	checkUnchanged := func(desc string) {
+		t.Helper()
+
+		if got := dumpAddrIndex(t, idx); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: index was modified", desc)
+		}
+	}
+
+	// Ensure a duplicate connect of the tip is ignored.
+	if err := connect(blocks[2]); err != nil {
+		t.Fatalf("unexpected error for duplicate connect: %v", err)
+	}
+	checkUnchanged("duplicate connect")
+
+	// Ensure connects of blocks that do not extend the tip are rejected.
+	for _, block := range []*dcrutil.Block{blocks[1], blocks[4]} {
+		err := connect(block)
+		if !errors.Is(err, ErrIndexTipMismatch) {
+			t.Fatalf("unexpected error for out of order connect of block "+
+				"%s: got %v, want %v", block.Hash(), err, ErrIndexTipMismatch)
+		}
+		checkUnchanged("out of order connect")
+	}
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.connectBlocks(dbTx, []connectBlockData{{
+			block:       blocks[4],
+			prevScripts: testPrevScripter{},
+		}})
+	})
+	if !errors.Is(err, ErrIndexTipMismatch) {
+		t.Fatalf("unexpected error for out of order batch connect: got %v, "+
+			"want %v", err, ErrIndexTipMismatch)
+	}
+	checkUnchanged("out of order batch connect")
+
+	// Ensure disconnects of blocks that are not the tip are rejected.
+	for _, block := range []*dcrutil.Block{blocks[1], blocks[3]} {
+		err := disconnect(block)
+		if !errors.Is(err, ErrIndexTipMismatch) {
+			t.Fatalf("unexpected error for out of order disconnect of block "+
+				"%s: got %v, want %v", block.Hash(), err, ErrIndexTipMismatch)
+		}
+		checkUnchanged("out of order disconnect")
+	}
+
+	// Ensure a duplicate disconnect of the former tip is rejected once it has
+	// been disconnected and that connecting it again restores the index.
+	if err := disconnect(blocks[2]); err != nil {
+		t.Fatalf("unexpected error disconnecting tip: %v", err)
+	}
+	disconnected := dumpAddrIndex(t, idx)
+	err = disconnect(blocks[2])
+	if !errors.Is(err, ErrIndexTipMismatch) {
+		t.Fatalf("unexpected error for duplicate disconnect: got %v, want %v",
+			err, ErrIndexTipMismatch)
+	}
+	if got := dumpAddrIndex(t, idx); !reflect.DeepEqual(got, disconnected) {
+		t.Fatal("duplicate disconnect: index was modified")
+	}
+	if err := connect(blocks[2]); err != nil {
+		t.Fatalf("unexpected error reconnecting block: %v", err)
+	}
+	checkUnchanged("reconnect")
+}
+
+// TestAddrIndexStaleDisconnectNotification ensures a disconnect notification
+// for a stale block at the same height as the index tip, such as a block on a
+// side chain, is rejected with a typed error without modifying the index or its
+// tip.
+func TestAddrIndexStaleDisconnectNotification(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_staledisconnect")
+	defer teardown()
+
+	const numBlocks = 3
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 1)
+	want := dumpAddrIndex(t, idx)
+
+	// Create a block that competes with the tip and pays a different address
+	// along with an internal block ID so it would otherwise be possible to
+	// disconnect.  The nonce is changed since the test blocks do not commit
+	// to their transactions and would otherwise have the same hash.
+	_, staleScript := testP2PKHAddr(t, 0x05).PaymentScript()
+	tip := blocks[numBlocks-1]
+	parent := blocks[numBlocks-2]
+	staleMsg := newTestBlock(numBlocks, parent.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(numBlocks, staleScript)},
+		nil).MsgBlock()
+	staleMsg.Header.Nonce = 1
+	stale := dcrutil.NewBlock(staleMsg)
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return dbPutBlockIDIndexEntry(dbTx, stale.Hash(), numBlocks+1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType:    DisconnectNtfn,
+			Block:       stale,
+			Parent:      parent,
+			PrevScripts: testPrevScripter{},
+		})
+	})
+	var dErr DisconnectBlockError
+	if !errors.As(err, &dErr) || dErr.Hash != *stale.Hash() {
+		t.Fatalf("unexpected stale disconnect error: %v", err)
+	}
+	if !errors.Is(err, ErrIndexTipMismatch) {
+		t.Fatalf("unexpected stale disconnect error cause: got %v, want %v",
+			err, ErrIndexTipMismatch)
+	}
+
+	// Ensure neither the entries nor the tip were modified.
+	if got := dumpAddrIndex(t, idx); !reflect.DeepEqual(got, want) {
+		t.Fatal("stale disconnect modified the index")
+	}
+	tipHeight, tipHash, err := idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != numBlocks || *tipHash != *tip.Hash() {
+		t.Fatalf("unexpected tip: got %v (height %d), want %v (height %d)",
+			tipHash, tipHeight, tip.Hash(), numBlocks)
+	}
+
+	// Ensure the actual tip can still be disconnected afterwards.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, tip, parent, testPrevScripter{},
+			false)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error disconnecting tip: %v", err)
+	}
+	tipHeight, tipHash, err = idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != numBlocks-1 || *tipHash != *parent.Hash() {
+		t.Fatalf("unexpected tip: got %v (height %d), want %v (height %d)",
+			tipHash, tipHeight, parent.Hash(), numBlocks-1)
+	}
+}
+
+// TestAddrIndexSkipCoinbaseOutputs ensures the outputs of coinbases are not
+// indexed when the option to skip them is enabled and that the option is
+// persisted such that changing it is rejected.
+func TestAddrIndexSkipCoinbaseOutputs(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_skipcoinbase")
+	defer teardown()
+	idx.skipCoinbaseOutputs = true
+	if err := idx.checkOptions(); err != nil {
+		t.Fatalf("unexpected error checking options: %v", err)
+	}
+
+	// Connect a block with a coinbase that pays an address and a regular
+	// transaction that pays another address.
+	minerAddr := testP2PKHAddr(t, 0x01)
+	payAddr := testP2PKHAddr(t, 0x02)
+	_, minerScript := minerAddr.PaymentScript()
+	_, payScript := payAddr.PaymentScript()
+	coinbase := newTestCoinbase(1, minerScript)
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash(), Index: 1},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	tx.AddTxOut(wire.NewTxOut(1e8, payScript))
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase, tx}, nil)
+	connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+
+	// Ensure only the address paid by the regular transaction is indexed.
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, addr := range []stdaddr.Address{minerAddr, payAddr} {
+			entries, _, err := idx.EntriesForAddress(dbTx, addr, 0, 10,
+				false)
+			if err != nil {
+				return err
+			}
+			wantEntries := 1
+			if addr == minerAddr {
+				wantEntries = 0
+			}
+			if len(entries) != wantEntries {
+				return fmt.Errorf("unexpected number of entries for %s: "+
+					"got %d, want %d", addr, len(entries), wantEntries)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure checking the options again succeeds while attempting to use the
+	// index without skipping coinbase outputs is rejected.
+	if err := idx.checkOptions(); err != nil {
+		t.Fatalf("unexpected error checking options: %v", err)
+	}
+	idx.skipCoinbaseOutputs = false
+	err = idx.checkOptions()
+	if !errors.Is(err, ErrAddrIndexOptionsMismatch) {
+		t.Fatalf("unexpected error with mismatched options: got %v, want %v",
+			err, ErrAddrIndexOptionsMismatch)
+	}
+}
+
+// TestAddrIndexAddrTypes ensures only the addresses of the types the index is
+// configured to index are indexed and removed when blocks are connected and
+// disconnected and that the option is persisted such that changing it is
+// rejected.
+func TestAddrIndexAddrTypes(t *testing.T) {
+	t.Parallel()
+
+	// Ensure the public key types are treated the same as their public key
+	// hash variants and unknown types are ignored.
+	if flags := skipAddrTypesFlags(nil); flags != 0 {
+		t.Fatalf("unexpected flags without types: got %#x, want 0", flags)
+	}
+	flags := skipAddrTypesFlags([]uint8{AddrTypePubKey, AddrTypeScriptHash,
+		0xff})
+	want := uint8(1<<AddrTypePubKeyHashEd25519 | 1<<AddrTypePubKeyHashSchnorr)
+	if flags != want {
+		t.Fatalf("unexpected flags: got %#x, want %#x", flags, want)
+	}
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_addrtypes")
+	defer teardown()
+	idx.skipAddrTypes = skipAddrTypesFlags([]uint8{AddrTypeScriptHash})
+	if err := idx.checkOptions(); err != nil {
+		t.Fatalf("unexpected error checking options: %v", err)
+	}
+
+	// newP2SHAddr returns a pay-to-script-hash address with a hash that
+	// consists of the provided byte.
+	newP2SHAddr := func(b byte) stdaddr.Address {
+		t.Helper()
+
+		addr, err := stdaddr.NewAddressScriptHashV0FromHash(
+			bytes.Repeat([]byte{b}, 20), idx.chainParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	// Connect a block that pays a pay-to-pubkey-hash address and a
+	// pay-to-script-hash address followed by a block with a transaction that
+	// spends both of them to pay another address of each type.
+	pkhAddr, pkhAddr2 := testP2PKHAddr(t, 0x01), testP2PKHAddr(t, 0x02)
+	shAddr, shAddr2 := newP2SHAddr(0x03), newP2SHAddr(0x04)
+	_, pkhScript := pkhAddr.PaymentScript()
+	_, pkhScript2 := pkhAddr2.PaymentScript()
+	_, shScript := shAddr.PaymentScript()
+	_, shScript2 := shAddr2.PaymentScript()
+	coinbase := newTestCoinbase(1, pkhScript, shScript)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	pkhOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	shOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 2}
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(wire.NewTxIn(&pkhOut, 1e8, nil))
+	spendTx.AddTxIn(wire.NewTxIn(&shOut, 1e8, nil))
+	spendTx.AddTxOut(wire.NewTxOut(1e8, pkhScript2))
+	spendTx.AddTxOut(wire.NewTxOut(1e8, shScript2))
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+	prevScripts := testPrevScripter{
+		pkhOut: {script: pkhScript, amount: 1e8},
+		shOut:  {script: shScript, amount: 1e8},
+	}
+	connectTestBlock(t, idx, block2, 2, prevScripts, false)
+
+	// checkEntries ensures the provided addresses have the provided number
+	// of entries and that only pay-to-script-hash addresses are indexed.
+	checkEntries := func(addrs []stdaddr.Address, wantEntries []int) {
+		t.Helper()
+
+		for i, addr := range addrs {
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != wantEntries[i] {
+				t.Fatalf("unexpected number of entries for %s: got %d, "+
+					"want %d", addr, len(entries), wantEntries[i])
+			}
+		}
+		for key := range dumpAddrIndex(t, idx) {
+			if len(key) == levelKeySize && key[0] != addrKeyTypeScriptHash {
+				t.Fatalf("unexpected indexed address key %x", key)
+			}
+		}
+	}
+	addrs := []stdaddr.Address{pkhAddr, pkhAddr2, shAddr, shAddr2}
+	checkEntries(addrs, []int{0, 0, 2, 1})
+
+	// Disconnect the spending block and ensure only the entries of the
+	// indexed types are removed.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1, prevScripts, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEntries(addrs, []int{0, 0, 1, 0})
+
+	// Ensure checking the options again succeeds while attempting to use the
+	// index with a different set of address types is rejected.
+	if err := idx.checkOptions(); err != nil {
+		t.Fatalf("unexpected error checking options: %v", err)
+	}
+	for _, addrTypes := range [][]uint8{nil, {AddrTypePubKeyHash}} {
+		idx.skipAddrTypes = skipAddrTypesFlags(addrTypes)
+		err = idx.checkOptions()
+		if !errors.Is(err, ErrAddrIndexOptionsMismatch) {
+			t.Fatalf("unexpected error with mismatched types %v: got %v, "+
+				"want %v", addrTypes, err, ErrAddrIndexOptionsMismatch)
+		}
+	}
+}
+
+// TestParseAddrType ensures the address type names are parsed to the expected
+// address types and unknown names are rejected.
+func TestParseAddrType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want uint8
+	}{
+		{name: "pubkeyhash", want: AddrTypePubKeyHash},
+		{name: "pubkeyhashed25519", want: AddrTypePubKeyHashEd25519},
+		{name: "pubkeyhashschnorr", want: AddrTypePubKeyHashSchnorr},
+		{name: "scripthash", want: AddrTypeScriptHash},
+	}
+	for _, test := range tests {
+		got, err := ParseAddrType(test.name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if got != test.want {
+			t.Fatalf("%s: unexpected type: got %d, want %d", test.name, got,
+				test.want)
+		}
+	}
+
+	for _, name := range []string{"", "pubkey", "ScriptHash"} {
+		_, err := ParseAddrType(name)
+		if !errors.Is(err, ErrUnsupportedAddressType) {
+			t.Fatalf("%q: unexpected error: got %v, want %v", name, err,
+				ErrUnsupportedAddressType)
+		}
+	}
+}
+
+// TestAddrIndexDuplicates ensures duplicate entries for an address are detected
+// and removed while preserving the order of the remaining entries.
+func TestAddrIndexDuplicates(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_duplicates")
+	defer teardown()
+
+	// Seed enough entries to populate multiple levels where one of them is a
+	// duplicate of an older entry.
+	const numEntries = level0MaxEntries*3 + 3
+	const dupOf, dupAt = 5, 12
+	addr := testP2PKHAddr(t, 0x01)
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		for i := 0; i < numEntries; i++ {
+			blockID := uint32(i + 1)
+			err := dbPutBlockIDIndexEntry(dbTx, &chainhash.Hash{byte(i + 1)},
+				blockID)
+			if err != nil {
+				return err
+			}
+			if i == dupAt {
+				blockID = dupOf + 1
+			}
+			txLoc := wire.TxLoc{TxStart: 100, TxLen: 50}
+			err = dbPutAddrIndexEntry(bucket, addrKey, blockID, txLoc,
+				encodeEntryTree(wire.TxTreeRegular))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the duplicate is detected.
+	before, _, err := idx.EntriesForAddress(nil, addr, 0, numEntries, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dups []TxIndexEntry
+	err = idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		dups, err = idx.FindDuplicates(dbTx, addr)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 1 {
+		t.Fatalf("unexpected number of duplicates: got %d, want 1", len(dups))
+	}
+	if *dups[0].BlockRegion.Hash != *before[dupOf].BlockRegion.Hash {
+		t.Fatalf("unexpected duplicate block: got %s, want %s",
+			dups[0].BlockRegion.Hash, before[dupOf].BlockRegion.Hash)
+	}
+
+	// Ensure the duplicate is removed while the levels remain valid.
+	var numRemoved int
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		var err error
+		numRemoved, err = idx.RemoveDuplicates(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		return dbCheckAddrIndexEntries(dbTx, bucket, addrKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if numRemoved != 1 {
+		t.Fatalf("unexpected number of removed entries: got %d, want 1",
+			numRemoved)
+	}
+
+	// Ensure the order of the remaining entries is retained.
+	after, _, err := idx.EntriesForAddress(nil, addr, 0, numEntries, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(before[:dupAt:dupAt], before[dupAt+1:]...)
+	if len(after) != len(want) {
+		t.Fatalf("unexpected number of entries after removal: got %d, want %d",
+			len(after), len(want))
+	}
+	for i := range want {
+		if *after[i].BlockRegion.Hash != *want[i].BlockRegion.Hash {
+			t.Fatalf("mismatched entry %d after removal", i)
+		}
+	}
+
+	// Ensure there is nothing left to detect or remove.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		var err error
+		dups, err = idx.FindDuplicates(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		numRemoved, err = idx.RemoveDuplicates(dbTx, addr)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dups) != 0 || numRemoved != 0 {
+		t.Fatalf("unexpected duplicates after removal: found %d, removed %d",
+			len(dups), numRemoved)
+	}
+}
+
+// TestAddrIndexSelfPayment ensures a transaction that spends from and pays to
+// the same address, including multiple times, only results in a single entry
+// for the address for both confirmed and unconfirmed transactions.
+func TestAddrIndexSelfPayment(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_selfpayment")
+	defer teardown()
+	idx.changeHeuristic = true
+
+	// Create a transaction that spends two outputs that pay to an address and
+	// pays back to the same address twice along with another address.
+	selfAddr := testP2PKHAddr(t, 0x01)
+	otherAddr := testP2PKHAddr(t, 0x02)
+	_, selfScript := selfAddr.PaymentScript()
+	_, otherScript := otherAddr.PaymentScript()
+	prevScripts := make(testPrevScripter)
+	selfPayTx := wire.NewMsgTx()
+	for i := uint32(0); i < 2; i++ {
+		prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: i}
+		prevScripts[prevOut] = testPrevScript{script: selfScript, amount: 1e8}
+		selfPayTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+	}
+	selfPayTx.AddTxOut(wire.NewTxOut(5e7, selfScript))
+	selfPayTx.AddTxOut(wire.NewTxOut(1e8, otherScript))
+	selfPayTx.AddTxOut(wire.NewTxOut(4e7, selfScript))
+
+	// Ensure the unconfirmed transaction is only indexed once for the address.
+	tx := dcrutil.NewTx(selfPayTx)
+	idx.AddUnconfirmedTx(tx, prevScripts, false)
+	if n := idx.UnconfirmedCountForAddress(selfAddr); n != 1 {
+		t.Fatalf("unexpected number of unconfirmed txns: got %d, want 1", n)
+	}
+	idx.RemoveUnconfirmedTx(tx.Hash())
+
+	// Connect a block with a coinbase that also pays to the address along with
+	// the transaction and ensure there is exactly one entry for each of them
+	// with the entry for the transaction tagged as change.
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, selfScript), selfPayTx}, nil)
+	connectTestBlock(t, idx, block, 1, prevScripts, false)
+	entries, _, err := idx.EntriesForAddress(nil, selfAddr, 0, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("unexpected number of entries: got %d, want 2", len(entries))
+	}
+	txLocs, _, err := block.TxLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, entry := range entries {
+		if entry.BlockRegion.Offset != uint32(txLocs[i].TxStart) {
+			t.Fatalf("unexpected offset for entry %d: got %d, want %d", i,
+				entry.BlockRegion.Offset, txLocs[i].TxStart)
+		}
+	}
+	if entries[1].OutputKind != OutputKindChange {
+		t.Fatalf("unexpected output kind: got %v, want %v",
+			entries[1].OutputKind, OutputKindChange)
+	}
+
+	// Ensure disconnecting the block removes both entries.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block, nil, prevScripts, false)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	entries, _, err = idx.EntriesForAddress(nil, selfAddr, 0, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("unexpected number of entries after disconnect: got %d, "+
+			"want 0", len(entries))
+	}
+}
+
+// TestAddrIndexEntriesWithTxHash ensures the entries for an address are
+// returned along with the hashes of the transactions they identify and that the
+// transactions can be loaded from the entries.
+func TestAddrIndexEntriesWithTxHash(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_txhash")
+	defer teardown()
+
+	// Connect blocks that are stored in the database and pay the same address
+	// via both the coinbase and a regular transaction.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	const numBlocks = 5
+	var wantHashes []chainhash.Hash
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		coinbase := newTestCoinbase(height, pkScript)
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(height)}},
+		})
+		tx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+		wantHashes = append(wantHashes, coinbase.TxHash(), tx.TxHash())
+		block := newTestBlock(height, prevHash, []*wire.MsgTx{coinbase, tx},
+			nil)
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+			return dbAddTxIndexEntries(dbTx, block, height)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		entries, skipped, err := idx.EntriesWithTxHashForAddress(dbTx, addr, 3,
+			numBlocks*2, false)
+		if err != nil {
+			return err
+		}
+		if skipped != 3 {
+			return fmt.Errorf("unexpected number skipped: got %d, want 3",
+				skipped)
+		}
+		want := wantHashes[3:]
+		if len(entries) != len(want) {
+			return fmt.Errorf("unexpected number of entries: got %d, want %d",
+				len(entries), len(want))
+		}
+		for i, entry := range entries {
+			if entry.TxHash != want[i] {
+				return fmt.Errorf("mismatched hash for entry %d: got %s, "+
+					"want %s", i, entry.TxHash, want[i])
+			}
+
+			// Ensure the transaction loaded from the entry has the expected
+			// hash as well.
+			msgTx, err := idx.FetchTx(dbTx, entry.TxIndexEntry)
+			if err != nil {
+				return err
+			}
+			if txHash := msgTx.TxHash(); txHash != want[i] {
+				return fmt.Errorf("mismatched hash for fetched tx %d: got "+
+					"%s, want %s", i, txHash, want[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexEntriesWithConfirmations ensures the entries for an address are
+// returned along with their number of confirmations as of the current best
+// chain tip and that unconfirmed transactions report zero confirmations.
+func TestAddrIndexEntriesWithConfirmations(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_confs")
+	defer teardown()
+
+	// Connect blocks that pay the same address via both the coinbase and a
+	// regular transaction.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	const numBlocks = 5
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: chainhash.Hash{byte(height)}},
+		})
+		tx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+		block := newTestBlock(height, prevHash, []*wire.MsgTx{
+			newTestCoinbase(height, pkScript), tx}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	tests := []struct {
+		name         string
+		numToSkip    uint32
+		numRequested uint32
+		reverse      bool
+		want         []int64
+	}{{
+		name:         "all entries",
+		numRequested: numBlocks * 2,
+		want:         []int64{5, 5, 4, 4, 3, 3, 2, 2, 1, 1},
+	}, {
+		name:         "skip and limit",
+		numToSkip:    3,
+		numRequested: 4,
+		want:         []int64{4, 3, 3, 2},
+	}, {
+		name:         "reversed",
+		numRequested: 3,
+		reverse:      true,
+		want:         []int64{1, 1, 2},
+	}}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, skipped, err := idx.EntriesWithConfirmations(dbTx, addr,
+				test.numToSkip, test.numRequested, test.reverse)
+			if err != nil {
+				return fmt.Errorf("%s: %v", test.name, err)
+			}
+			if skipped != test.numToSkip {
+				return fmt.Errorf("%s: unexpected number skipped: got %d, "+
+					"want %d", test.name, skipped, test.numToSkip)
+			}
+			want, _, err := idx.EntriesForAddress(dbTx, addr, test.numToSkip,
+				test.numRequested, test.reverse)
+			if err != nil {
+				return err
+			}
+			if len(entries) != len(test.want) || len(want) != len(entries) {
+				return fmt.Errorf("%s: unexpected number of entries: got "+
+					"%d, want %d", test.name, len(entries), len(test.want))
+			}
+			for i, entry := range entries {
+				if !reflect.DeepEqual(entry.TxIndexEntry, want[i]) {
+					return fmt.Errorf("%s: mismatched entry %d", test.name, i)
+				}
+				if entry.Confirmations != test.want[i] {
+					return fmt.Errorf("%s: unexpected confirmations for "+
+						"entry %d: got %d, want %d", test.name, i,
+						entry.Confirmations, test.want[i])
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure unconfirmed transactions report zero confirmations.
+	if txns := idx.UnconfirmedTxnsWithConfirmations(addr); len(txns) != 0 {
+		t.Fatalf("unexpected unconfirmed txns: %d", len(txns))
+	}
+	tx := dcrutil.NewTx(newTestCoinbase(numBlocks+1, pkScript))
+	idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	txns := idx.UnconfirmedTxnsWithConfirmations(addr)
+	if len(txns) != 1 {
+		t.Fatalf("unexpected number of unconfirmed txns: got %d, want 1",
+			len(txns))
+	}
+	if *txns[0].Tx.Hash() != *tx.Hash() || txns[0].Confirmations != 0 {
+		t.Fatalf("unexpected unconfirmed tx %v with %d confirmations",
+			txns[0].Tx.Hash(), txns[0].Confirmations)
+	}
+}
+
+// TestAddrIndexAllEntriesForAddress ensures the merged view of the unconfirmed
+// and confirmed transactions for an address lists the unconfirmed ones first
+// and reports every transaction exactly once, including while transactions are
+// concurrently being mined and removed from the unconfirmed index.
+func TestAddrIndexAllEntriesForAddress(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_allentries")
+	defer teardown()
+
+	addr := testP2PKHAddr(t, 0x02)
+	_, inScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	_, outScript := addr.PaymentScript()
+	_, minerScript := testP2PKHAddr(t, 0x03).PaymentScript()
+
+	// connect stores and connects a block that contains the provided
+	// transaction to the index.
+	prevHash := &idx.chainParams.GenesisHash
+	connect := func(height uint32, tx *dcrutil.Tx) error {
+		block := newTestBlock(height, prevHash, []*wire.MsgTx{
+			newTestCoinbase(height, minerScript), tx.MsgTx()}, nil)
+		if err := idx.chain.(*testChain).AddBlock(block); err != nil {
+			return err
+		}
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+			err := dbPutBlockIDIndexEntry(dbTx, block.Hash(), height)
+			if err != nil {
+				return err
+			}
+			return idx.connectBlock(dbTx, block, nil, testPrevScripter{},
+				false)
+		})
+		if err != nil {
+			return err
+		}
+		prevHash = block.Hash()
+		return nil
+	}
+
+	// mine connects a block that contains the provided transaction and then
+	// removes it from the unconfirmed index as happens when it is mined.
+	mine := func(height uint32, tx *dcrutil.Tx) error {
+		if err := connect(height, tx); err != nil {
+			return err
+		}
+		idx.RemoveUnconfirmedTx(tx.Hash())
+		return nil
+	}
+
+	// fetchAll returns the merged entries for the address.
+	fetchAll := func(numRequested uint32) []MergedAddrEntry {
+		t.Helper()
+
+		results, err := idx.AllEntriesForAddress(nil, addr, numRequested)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	// Mine two transactions and add two more to the unconfirmed index.
+	var txns []*dcrutil.Tx
+	for i := uint32(1); i <= 4; i++ {
+		tx, prevScripts := newTestSpendTx(i, inScript, outScript)
+		idx.AddUnconfirmedTx(tx, prevScripts, false)
+		if i <= 2 {
+			if err := mine(i, tx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		txns = append(txns, tx)
+	}
+
+	// Ensure the unconfirmed transactions come first ordered from newest to
+	// oldest followed by the confirmed ones with their confirmations.
+	results := fetchAll(10)
+	wantHashes := []*chainhash.Hash{txns[3].Hash(), txns[2].Hash(),
+		txns[1].Hash(), txns[0].Hash()}
+	wantConfs := []int64{0, 0, 1, 2}
+	if len(results) != len(wantHashes) {
+		t.Fatalf("unexpected number of results: got %d, want %d",
+			len(results), len(wantHashes))
+	}
+	for i, result := range results {
+		if result.TxHash != *wantHashes[i] ||
+			result.Confirmations != wantConfs[i] ||
+			(result.Tx != nil) != (wantConfs[i] == 0) {
+
+			t.Fatalf("unexpected result %d: got %v (%d confs), want %v "+
+				"(%d confs)", i, result.TxHash, result.Confirmations,
+				wantHashes[i], wantConfs[i])
+		}
+	}
+
+	// Ensure the number requested limits the results.
+	if results := fetchAll(3); len(results) != 3 ||
+		results[2].TxHash != *txns[1].Hash() {
+
+		t.Fatalf("unexpected limited results: %v", results)
+	}
+
+	// Ensure a transaction that was mined but not yet removed from the
+	// unconfirmed index is only reported once as confirmed.
+	if err := connect(3, txns[2]); err != nil {
+		t.Fatal(err)
+	}
+	results = fetchAll(10)
+	if len(results) != 4 || results[0].TxHash != *txns[3].Hash() ||
+		results[1].TxHash != *txns[2].Hash() || results[1].Tx != nil ||
+		results[1].Confirmations != 1 {
+
+		t.Fatalf("unexpected results with mined unconfirmed tx: %v", results)
+	}
+	idx.RemoveUnconfirmedTx(txns[2].Hash())
+
+	// Concurrently mine new transactions while querying the merged view and
+	// ensure every transaction added before each query is always reported
+	// exactly once.
+	const numRaceTxns = 50
+	var numAdded int32 = int32(len(txns))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var mineErr error
+	raceTxns := make([]*dcrutil.Tx, 0, len(txns)+numRaceTxns)
+	raceTxns = append(raceTxns, txns...)
+	var raceMtx sync.Mutex
+	go func() {
+		defer wg.Done()
+		if err := mine(4, txns[3]); err != nil {
+			mineErr = err
+			return
+		}
+		for i := uint32(0); i < numRaceTxns; i++ {
+			height := i + 5
+			tx, prevScripts := newTestSpendTx(height, inScript, outScript)
+			idx.AddUnconfirmedTx(tx, prevScripts, false)
+			raceMtx.Lock()
+			raceTxns = append(raceTxns, tx)
+			raceMtx.Unlock()
+			atomic.AddInt32(&numAdded, 1)
+			if err := mine(height, tx); err != nil {
+				mineErr = err
+				return
+			}
+		}
+	}()
+	for atomic.LoadInt32(&numAdded) < int32(len(txns)+numRaceTxns) {
+		n := int(atomic.LoadInt32(&numAdded))
+		results := fetchAll(numRaceTxns * 2)
+		seen := make(map[chainhash.Hash]int, len(results))
+		for _, result := range results {
+			seen[result.TxHash]++
+		}
+		raceMtx.Lock()
+		wantTxns := raceTxns[:n]
+		raceMtx.Unlock()
+		for _, tx := range wantTxns {
+			if seen[*tx.Hash()] != 1 {
+				t.Fatalf("transaction %v reported %d times", tx.Hash(),
+					seen[*tx.Hash()])
+			}
+		}
+	}
+	wg.Wait()
+	if mineErr != nil {
+		t.Fatal(mineErr)
+	}
+
+	// Ensure a transaction that is mined while the confirmed entries are read
+	// is reported exactly once as confirmed, which also ensures the
+	// unconfirmed index is not locked while they are read.
+	height := uint32(numRaceTxns + 5)
+	tx, prevScripts := newTestSpendTx(height, inScript, outScript)
+	idx.AddUnconfirmedTx(tx, prevScripts, false)
+	db := idx.db
+	idx.db = &viewHookDB{DB: db, hook: func() {
+		if err := mine(height, tx); err != nil {
+			t.Fatal(err)
+		}
+	}}
+	results = fetchAll(2)
+	idx.db = db
+	if len(results) != 2 || results[0].TxHash != *tx.Hash() ||
+		results[0].Tx != nil || results[0].Confirmations != 1 ||
+		results[1].TxHash == *tx.Hash() {
+
+		t.Fatalf("unexpected results with tx mined during read: %v", results)
+	}
+}
+
+// viewHookDB wraps a database to invoke the provided hook once before the
+// next read-only transaction is started.
+type viewHookDB struct {
+	database.DB
+	hook func()
+}
+
+// View invokes the hook, if it has not already been invoked, before invoking
+// the passed function in the context of a managed read-only transaction.
+func (db *viewHookDB) View(fn func(dbTx database.Tx) error) error {
+	if db.hook != nil {
+		hook := db.hook
+		db.hook = nil
+		hook()
+	}
+	return db.DB.View(fn)
+}
+
+// TestAddrIndexEntriesForAddressAtTip ensures the entries for an address are
+// returned along with the index tip they reflect and that both remain
+// consistent with the database transaction when blocks are connected
+// concurrently.
+func TestAddrIndexEntriesForAddressAtTip(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_attip")
+	defer teardown()
+
+	const numBlocks = 10
+	blocks := newTestReindexBlocks(t, numBlocks+1,
+		&idx.chainParams.GenesisHash)
+	for i, block := range blocks[:numBlocks] {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	addr := testP2PKHAddr(t, 0x00)
+
+	// checkAtTip ensures the entries and tip reported using the provided
+	// database transaction reflect the provided number of blocks.
+	checkAtTip := func(dbTx database.Tx, wantBlocks int) error {
+		entries, skipped, tipHeight, tipHash, err :=
+			idx.EntriesForAddressAtTip(dbTx, addr, 0, numBlocks*2, false)
+		if err != nil {
+			return err
+		}
+		if skipped != 0 {
+			return fmt.Errorf("unexpected number skipped: %d", skipped)
+		}
+		wantHash := blocks[wantBlocks-1].Hash()
+		if tipHeight != int64(wantBlocks) || *tipHash != *wantHash {
+			return fmt.Errorf("unexpected tip: got %v (%d), want %v (%d)",
+				tipHash, tipHeight, wantHash, wantBlocks)
+		}
+		if len(entries) != wantBlocks {
+			return fmt.Errorf("unexpected number of entries: got %d, want %d",
+				len(entries), wantBlocks)
+		}
+		lastHash := entries[len(entries)-1].BlockRegion.Hash
+		if *lastHash != *wantHash {
+			return fmt.Errorf("unexpected block for last entry: got %v, "+
+				"want %v", lastHash, wantHash)
+		}
+		return nil
+	}
+
+	// Ensure connecting a block while the database transaction is open does
+	// not change the results or the reported tip.
+	err := idx.db.View(func(dbTx database.Tx) error {
+		if err := checkAtTip(dbTx, numBlocks); err != nil {
+			return err
+		}
+		connectTestBlock(t, idx, blocks[numBlocks], numBlocks+1,
+			testPrevScripter{}, false)
+		return checkAtTip(dbTx, numBlocks)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure a new database transaction reflects the newly connected block.
+	err = idx.db.View(func(dbTx database.Tx) error {
+		return checkAtTip(dbTx, numBlocks+1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// levelReadBucket is an implementation of internalBucket that records the
+// levels of the address index that are read from an underlying bucket.
+type levelReadBucket struct {
+	bucket internalBucket
+	levels map[uint8]struct{}
+}
+
+// Get records the level of the provided key and returns its value from the
+// underlying bucket.
+func (b *levelReadBucket) Get(key []byte) []byte {
+	b.levels[key[levelOffset]] = struct{}{}
+	return b.bucket.Get(key)
+}
+
+// Put stores the provided key/value pair in the underlying bucket.
+func (b *levelReadBucket) Put(key []byte, value []byte) error {
+	return b.bucket.Put(key, value)
+}
+
+// Delete removes the provided key from the underlying bucket.
+func (b *levelReadBucket) Delete(key []byte) error {
+	return b.bucket.Delete(key)
+}
+
+// TestAddrIndexEntriesForAddressSinceHeight ensures only the entries for an
+// address above a given height are returned and that the levels that only
+// house older entries are not read.
+func TestAddrIndexEntriesForAddressSinceHeight(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_sinceheight")
+	defer teardown()
+
+	// Connect enough blocks that pay the address for its entries to span
+	// several levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	addr := testP2PKHAddr(t, 0x00)
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		all, _, err := idx.EntriesForAddress(dbTx, addr, 0, numBlocks*2,
+			false)
+		if err != nil {
+			return err
+		}
+		if len(all) != numBlocks {
+			return fmt.Errorf("unexpected number of entries: got %d, want %d",
+				len(all), numBlocks)
+		}
+
+		// Determine the level that houses the entry at each height.  The
+		// entry at height h is for block h since every block pays the
+		// address once.
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		levelForHeight := make(map[int64]uint8)
+		height := int64(numBlocks)
+		for level := uint8(0); ; level++ {
+			levelKey := keyForLevel(addrKey, level)
+			levelData := bucket.Get(levelKey[:])
+			if levelData == nil {
+				break
+			}
+			for n := len(levelData) / txEntrySize; n > 0; n-- {
+				levelForHeight[height] = level
+				height--
+			}
+		}
+		maxLevel := levelForHeight[1]
+		if maxLevel < 2 {
+			return fmt.Errorf("entries only span %d levels", maxLevel+1)
+		}
+
+		fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+			return dbFetchBlockHashBySerializedID(dbTx, id)
+		}
+		var numHeightsFetched int
+		fetchBlockHeight := func(id []byte) (int64, error) {
+			numHeightsFetched++
+			return idx.blockHeightBySerializedID(dbTx, id)
+		}
+		for sinceHeight := int64(-1); sinceHeight <= numBlocks; sinceHeight++ {
+			// Ensure only the entries above the height are returned.
+			want := all
+			if sinceHeight > 0 {
+				want = all[sinceHeight:]
+			}
+			got, err := idx.EntriesForAddressSinceHeight(dbTx, addr,
+				sinceHeight)
+			if err != nil {
+				return err
+			}
+			if len(got) != len(want) || (len(want) > 0 &&
+				!reflect.DeepEqual(got, want)) {
+
+				return fmt.Errorf("mismatched entries since height %d: got "+
+					"%d entries, want %d", sinceHeight, len(got), len(want))
+			}
+
+			// Ensure no levels beyond the one that houses the entry at the
+			// height are read and only a few heights are resolved.  All of
+			// the levels, including the missing one that ends the walk, are
+			// read when every entry is above the height.
+			reads := &levelReadBucket{bucket: bucket,
+				levels: make(map[uint8]struct{})}
+			numHeightsFetched = 0
+			_, err = dbFetchAddrIndexEntriesSinceHeight(reads, addrKey,
+				sinceHeight, fetchBlockHash, fetchBlockHeight)
+			if err != nil {
+				return err
+			}
+			wantMaxLevel := maxLevel + 1
+			if sinceHeight >= 1 {
+				wantMaxLevel = levelForHeight[sinceHeight]
+			}
+			for level := range reads.levels {
+				if level > wantMaxLevel {
+					return fmt.Errorf("read level %d for height %d beyond "+
+						"level %d", level, sinceHeight, wantMaxLevel)
+				}
+			}
+			if numHeightsFetched > int(maxLevel+1)*6 {
+				return fmt.Errorf("resolved %d heights for height %d",
+					numHeightsFetched, sinceHeight)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexEntriesForAddressWithDeadline ensures queries bounded by a
+// deadline return all of the entries when the deadline is not reached and
+// return truncated results when it is reached while loading the levels,
+// deserializing the entries, or marking them.
+func TestAddrIndexEntriesForAddressWithDeadline(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_deadline")
+	defer teardown()
+
+	// Connect enough blocks for the shared addresses to have more entries
+	// than are loaded between checks of the deadline.
+	const numBlocks = deadlineCheckInterval * 2
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 32)
+	addr := testP2PKHAddr(t, 0x00)
+
+	// Ensure a deadline that is not reached returns the same results as the
+	// unbounded query.
+	want, _, err := idx.EntriesForAddress(nil, addr, 0, numBlocks, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// queryWithDeadline queries the entries for the address bounded by the
+	// provided deadline using a new database transaction.
+	queryWithDeadline := func(deadline time.Time, reverse bool) ([]TxIndexEntry, uint32, bool) {
+		t.Helper()
+
+		var entries []TxIndexEntry
+		var skipped uint32
+		var truncated bool
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			entries, skipped, truncated, err =
+				idx.EntriesForAddressWithDeadline(dbTx, addr, deadline, 0,
+					numBlocks, reverse)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries, skipped, truncated
+	}
+	got, skipped, truncated := queryWithDeadline(time.Now().Add(time.Hour),
+		false)
+	if truncated || skipped != 0 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched results before deadline: got %d entries "+
+			"(skipped %d, truncated %v), want %d", len(got), skipped,
+			truncated, len(want))
+	}
+
+	// Ensure a tiny deadline that has already passed truncates the results
+	// while loading the levels.
+	deadline := time.Now().Add(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	got, skipped, truncated = queryWithDeadline(deadline, true)
+	if !truncated || len(got) >= numBlocks || skipped != 0 {
+		t.Fatalf("unexpected results after deadline: got %d entries "+
+			"(skipped %d, truncated %v)", len(got), skipped, truncated)
+	}
+
+	// Ensure loading the levels stops once the deadline is reached and loads
+	// all of them otherwise.
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		serialized, truncated := dbFetchSerializedAddrIndexLevelsUntil(
+			bucket, addrKey, 0, numBlocks, false, deadline)
+		if !truncated || serialized != nil {
+			t.Fatalf("unexpected levels after deadline: got %d bytes "+
+				"(truncated %v)", len(serialized), truncated)
+		}
+		serialized, truncated = dbFetchSerializedAddrIndexLevelsUntil(
+			bucket, addrKey, 0, numBlocks, false, time.Time{})
+		if truncated || len(serialized) != numBlocks*txEntrySize {
+			t.Fatalf("unexpected levels without deadline: got %d bytes "+
+				"(truncated %v)", len(serialized), truncated)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure marking the entries stops once the deadline is reached after
+	// the first entries are marked.
+	idx.trackDisapprovals = true
+	idx.trackInputIndexes = true
+	err = idx.db.View(func(dbTx database.Tx) error {
+		numMarked := idx.markDisapprovedEntriesUntil(dbTx, want, deadline)
+		if numMarked != deadlineCheckInterval {
+			t.Fatalf("unexpected number of entries marked disapproved: "+
+				"got %d, want %d", numMarked, deadlineCheckInterval)
+		}
+		numMarked, err := idx.markEntryInputsUntil(dbTx, addrKey, want,
+			deadline)
+		if err != nil {
+			return err
+		}
+		if numMarked != deadlineCheckInterval {
+			t.Fatalf("unexpected number of entries marked with inputs: "+
+				"got %d, want %d", numMarked, deadlineCheckInterval)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexPrefetch ensures prefetching the entries for addresses reads all
+// of their levels and silently skips addresses that are not supported or do
+// not have any entries.
+func TestAddrIndexPrefetch(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_prefetch")
+	defer teardown()
+
+	// Connect enough blocks that pay the address for its 25 entries to span
+	// 3 levels.
+	const numBlocks = 25
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	addr := testP2PKHAddr(t, 0x00)
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		// Ensure all of the levels of the address are read along with the
+		// first missing level that terminates them.
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		reads := &levelReadBucket{bucket: bucket,
+			levels: make(map[uint8]struct{})}
+		numLevels := dbPrefetchAddrIndexLevels(reads, addrKey)
+		if numLevels != 3 {
+			return fmt.Errorf("unexpected number of prefetched levels: got "+
+				"%d, want 3", numLevels)
+		}
+		wantLevels := map[uint8]struct{}{0: {}, 1: {}, 2: {}, 3: {}}
+		if !reflect.DeepEqual(reads.levels, wantLevels) {
+			return fmt.Errorf("unexpected levels read: got %v, want %v",
+				reads.levels, wantLevels)
+		}
+
+		// Ensure prefetching a mix of addresses with entries, without
+		// entries, and with unsupported types does not panic.
+		idx.Prefetch(dbTx, []stdaddr.Address{addr, testP2PKHAddr(t, 0x01),
+			testUnsupportedAddr{}})
+		idx.Prefetch(dbTx, nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexEntriesForAddressEncoded ensures the compact encoding of the
+// entries for an address decodes to the same entries returned by
+// EntriesForAddress for various parameters both with and without the address
+// pinned.
+func TestAddrIndexEntriesForAddressEncoded(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_encoded")
+	defer teardown()
+
+	const numBlocks = 30
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	addr := testP2PKHAddr(t, 0x00)
+
+	// decode returns the entries encoded in the compact format.
+	decode := func(encoded []byte) ([]TxIndexEntry, error) {
+		if len(encoded) < 4 {
+			return nil, fmt.Errorf("missing number of entries")
+		}
+		numEntries := int(byteOrder.Uint32(encoded))
+		encoded = encoded[4:]
+		if len(encoded) != numEntries*addrIndexEncodedEntrySize {
+			return nil, fmt.Errorf("unexpected encoded length %d for %d "+
+				"entries", len(encoded), numEntries)
+		}
+		var entries []TxIndexEntry
+		for i := 0; i < numEntries; i++ {
+			var hash chainhash.Hash
+			copy(hash[:], encoded[:chainhash.HashSize])
+			flags := byteOrder.Uint32(encoded[chainhash.HashSize+8:])
+			entries = append(entries, TxIndexEntry{
+				BlockRegion: database.BlockRegion{
+					Hash:   &hash,
+					Offset: byteOrder.Uint32(encoded[chainhash.HashSize:]),
+					Len:    byteOrder.Uint32(encoded[chainhash.HashSize+4:]),
+				},
+				BlockIndex: flags & blockIndexMask,
+				Tree:       decodeEntryTree(flags),
+				StakeTags:  decodeEntryStakeTags(flags),
+				Class:      decodeEntryTxClass(flags),
+				OutputKind: decodeEntryOutputKind(flags),
+				Credit:     decodeEntryCredit(flags),
+			})
+			encoded = encoded[addrIndexEncodedEntrySize:]
+		}
+		return entries, nil
+	}
+
+	// checkEncoded ensures the encoded entries match the entries returned by
+	// EntriesForAddress for various parameters.
+	checkEncoded := func() {
+		t.Helper()
+
+		skips := []uint32{0, 7, numBlocks, numBlocks * 2}
+		requests := []uint32{0, 5, numBlocks * 2}
+		err := idx.db.View(func(dbTx database.Tx) error {
+			for _, reverse := range []bool{false, true} {
+				for _, numToSkip := range skips {
+					for _, numRequested := range requests {
+						encoded, gotSkipped, err :=
+							idx.EntriesForAddressEncoded(dbTx, addr,
+								numToSkip, numRequested, reverse)
+						if err != nil {
+							return err
+						}
+						got, err := decode(encoded)
+						if err != nil {
+							return err
+						}
+						want, wantSkipped, err := idx.EntriesForAddress(dbTx,
+							addr, numToSkip, numRequested, reverse)
+						if err != nil {
+							return err
+						}
+						if !reflect.DeepEqual(got, want) ||
+							gotSkipped != wantSkipped {
+
+							return fmt.Errorf("mismatched entries for skip "+
+								"%d, requested %d, reverse %v: got %d "+
+								"entries (skipped %d), want %d (skipped %d)",
+								numToSkip, numRequested, reverse, len(got),
+								gotSkipped, len(want), wantSkipped)
+						}
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkEncoded()
+	if err := idx.PinAddress(addr); err != nil {
+		t.Fatal(err)
+	}
+	checkEncoded()
+	checkEncoded()
+
+	// Ensure an address without any entries encodes to no entries.
+	err := idx.db.View(func(dbTx database.Tx) error {
+		encoded, _, err := idx.EntriesForAddressEncoded(dbTx,
+			testP2PKHAddr(t, 0x7f), 0, numBlocks, false)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(encoded, []byte{0, 0, 0, 0}) {
+			return fmt.Errorf("unexpected encoding for unknown address: %x",
+				encoded)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexBlockIDsForAddress ensures the block IDs for an address that
+// spans multiple levels match the block IDs of the entries returned for the
+// same parameters in both directions.
+func TestAddrIndexBlockIDsForAddress(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_blockids")
+	defer teardown()
+
+	const numBlocks = 30
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	addr := testP2PKHAddr(t, 0)
+	tests := []struct {
+		numToSkip    uint32
+		numRequested uint32
+	}{
+		{0, math.MaxUint32},
+		{0, 5},
+		{7, 12},
+		{numBlocks - 3, 10},
+		{numBlocks, 10},
+		{5, 0},
+	}
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			for _, reverse := range []bool{false, true} {
+				entries, _, err := idx.EntriesForAddress(dbTx, addr,
+					test.numToSkip, test.numRequested, reverse)
+				if err != nil {
+					return err
+				}
+				blockIDs, err := idx.BlockIDsForAddress(dbTx, addr,
+					test.numToSkip, test.numRequested, reverse)
+				if err != nil {
+					return err
+				}
+				if len(blockIDs) != len(entries) {
+					return fmt.Errorf("skip %d, requested %d, reverse %v: "+
+						"unexpected number of block IDs: got %d, want %d",
+						test.numToSkip, test.numRequested, reverse,
+						len(blockIDs), len(entries))
+				}
+				for i, entry := range entries {
+					wantID, err := dbFetchBlockIDByHash(dbTx,
+						entry.BlockRegion.Hash)
+					if err != nil {
+						return err
+					}
+					if blockIDs[i] != wantID {
+						return fmt.Errorf("skip %d, requested %d, reverse "+
+							"%v: mismatched block ID %d: got %d, want %d",
+							test.numToSkip, test.numRequested, reverse, i,
+							blockIDs[i], wantID)
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexRedeemScriptAddrs ensures the member keys of a multisignature
+// redeem script revealed by an input that spends a pay-to-script-hash output are
+// only indexed when the index is configured to do so.
+func TestAddrIndexRedeemScriptAddrs(t *testing.T) {
+	t.Parallel()
+
+	// Create a 2-of-3 multisig redeem script along with the pay-to-script-hash
+	// script that pays to it.
+	params := chaincfg.SimNetParams()
+	var pubKeys [][]byte
+	var memberAddrs []stdaddr.Address
+	for i := byte(1); i <= 3; i++ {
+		privKey := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{i}, 32))
+		pubKey := privKey.PubKey().SerializeCompressed()
+		addr, err := stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(pubKey,
+			params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeys = append(pubKeys, pubKey)
+		memberAddrs = append(memberAddrs, addr)
+	}
+	redeemScript, err := txscript.MultiSigScript(2, pubKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shAddr, err := stdaddr.NewAddressScriptHashV0(redeemScript, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p2shScript := p2shAddr.PaymentScript()
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_FALSE).
+		AddData(bytes.Repeat([]byte{0x01}, 71)).
+		AddData(bytes.Repeat([]byte{0x02}, 71)).
+		AddData(redeemScript).Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, indexRedeemScriptAddrs := range []bool{false, true} {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"redeemscript_%v", indexRedeemScriptAddrs))
+		defer teardown()
+		idx.indexRedeemScriptAddrs = indexRedeemScriptAddrs
+
+		// Connect a block that pays the multisig script followed by a block
+		// that spends it.
+		coinbase := newTestCoinbase(1, p2shScript)
+		block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+			[]*wire.MsgTx{coinbase}, nil)
+		connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+		spendOutPoint := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+		spendTx := wire.NewMsgTx()
+		spendTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: spendOutPoint,
+			SignatureScript:  sigScript,
+		})
+		spendTx.AddTxOut(wire.NewTxOut(1e8, nil))
+		block2 := newTestBlock(2, block1.Hash(),
+			[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+		prevScripts := testPrevScripter{
+			spendOutPoint: testPrevScript{script: p2shScript},
+		}
+		connectTestBlock(t, idx, block2, 2, prevScripts, false)
+
+		// Ensure the script hash is indexed for both blocks and the member
+		// keys are only indexed for the spend when configured to do so.
+		checkEntries := func(addr stdaddr.Address, wantEntries int) {
+			t.Helper()
+
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("unexpected number of entries for %s (index redeem "+
+					"script addrs %v): got %d, want %d", addr,
+					indexRedeemScriptAddrs, len(entries), wantEntries)
+			}
+		}
+		checkEntries(p2shAddr, 2)
+		for _, addr := range memberAddrs {
+			wantEntries := 0
+			if indexRedeemScriptAddrs {
+				wantEntries = 1
+			}
+			checkEntries(addr, wantEntries)
+		}
+	}
+}
+
+// TestAddrIndexAtomicSwapAddrs ensures the recipient and refund addresses
+// embedded in an atomic swap contract are indexed for the spend that reveals
+// it only when the index is configured to do so and that the script hash of
+// the contract is always indexed.
+func TestAddrIndexAtomicSwapAddrs(t *testing.T) {
+	t.Parallel()
+
+	// Create a canonical atomic swap contract along with the
+	// pay-to-script-hash script that pays to it.
+	params := chaincfg.SimNetParams()
+	recipientAddr := testP2PKHAddr(t, 0x01)
+	refundAddr := testP2PKHAddr(t, 0x02)
+	recipientHash := recipientAddr.(stdaddr.Hash160er).Hash160()
+	refundHash := refundAddr.(stdaddr.Hash160er).Hash160()
+	contract, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddOp(txscript.OP_SIZE).
+		AddInt64(32).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_SHA256).
+		AddData(bytes.Repeat([]byte{0x03}, 32)).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(recipientHash[:]).
+		AddOp(txscript.OP_ELSE).
+		AddInt64(1600086400).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(refundHash[:]).
+		AddOp(txscript.OP_ENDIF).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2shAddr, err := stdaddr.NewAddressScriptHashV0(contract, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p2shScript := p2shAddr.PaymentScript()
+
+	// The signature script of a redemption reveals the contract after the
+	// signature, public key, secret, and the flag that selects the redeem
+	// branch.
+	sigScript, err := txscript.NewScriptBuilder().
+		AddData(bytes.Repeat([]byte{0x04}, 71)).
+		AddData(bytes.Repeat([]byte{0x05}, 33)).
+		AddData(bytes.Repeat([]byte{0x06}, 32)).
+		AddOp(txscript.OP_TRUE).
+		AddData(contract).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, indexAtomicSwapAddrs := range []bool{false, true} {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"atomicswap_%v", indexAtomicSwapAddrs))
+		defer teardown()
+		idx.indexAtomicSwapAddrs = indexAtomicSwapAddrs
+
+		// Connect a block that pays the contract followed by a block that
+		// redeems it.
+		coinbase := newTestCoinbase(1, p2shScript)
+		block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+			[]*wire.MsgTx{coinbase}, nil)
+		connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+		spendOutPoint := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+		spendTx := wire.NewMsgTx()
+		spendTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: spendOutPoint,
+			SignatureScript:  sigScript,
+		})
+		spendTx.AddTxOut(wire.NewTxOut(1e8, nil))
+		block2 := newTestBlock(2, block1.Hash(),
+			[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+		prevScripts := testPrevScripter{
+			spendOutPoint: testPrevScript{script: p2shScript},
+		}
+		connectTestBlock(t, idx, block2, 2, prevScripts, false)
+
+		// Ensure the contract hash is indexed for both blocks and the
+		// participant addresses are only indexed for the redemption when
+		// configured to do so.
+		checkEntries := func(addr stdaddr.Address, wantEntries int) {
+			t.Helper()
+
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("unexpected number of entries for %s (index atomic "+
+					"swap addrs %v): got %d, want %d", addr,
+					indexAtomicSwapAddrs, len(entries), wantEntries)
+			}
+			if wantEntries == 1 &&
+				*entries[0].BlockRegion.Hash != *block2.Hash() {
+
+				t.Fatalf("unexpected block for %s: got %v, want %v", addr,
+					entries[0].BlockRegion.Hash, block2.Hash())
+			}
+		}
+		checkEntries(p2shAddr, 2)
+		for _, addr := range []stdaddr.Address{recipientAddr, refundAddr} {
+			wantEntries := 0
+			if indexAtomicSwapAddrs {
+				wantEntries = 1
+			}
+			checkEntries(addr, wantEntries)
+		}
+
+		// Ensure the participant addresses of an unconfirmed redemption
+		// are also only indexed when configured to do so.
+		unconfirmedTx := spendTx.Copy()
+		unconfirmedTx.TxIn[0].PreviousOutPoint.Index = 2
+		unconfirmedPrevScripts := testPrevScripter{
+			unconfirmedTx.TxIn[0].PreviousOutPoint: testPrevScript{
+				script: p2shScript,
+			},
+		}
+		idx.AddUnconfirmedTx(dcrutil.NewTx(unconfirmedTx),
+			unconfirmedPrevScripts, false)
+		for _, addr := range []stdaddr.Address{recipientAddr, refundAddr} {
+			wantTxns := 0
+			if indexAtomicSwapAddrs {
+				wantTxns = 1
+			}
+			txns := idx.UnconfirmedTxnsForAddress(addr)
+			if len(txns) != wantTxns {
+				t.Fatalf("unexpected number of unconfirmed txns for %s "+
+					"(index atomic swap addrs %v): got %d, want %d", addr,
+					indexAtomicSwapAddrs, len(txns), wantTxns)
+			}
+		}
+	}
+}
+
+// TestAddrIndexExtendedKeys ensures a pay-to-pubkey output and a
+// pay-to-pubkey-hash output for the same public key, which share the same
+// hash160, are only distinguishable when the index uses the extended key mode
+// and that changing the key mode rebuilds the index.
+func TestAddrIndexExtendedKeys(t *testing.T) {
+	t.Parallel()
+
+	params := chaincfg.SimNetParams()
+	privKey := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+	pubKey := privKey.PubKey().SerializeCompressed()
+	p2pkAddr, err := stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(pubKey,
+		params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkhAddr := p2pkAddr.AddressPubKeyHash()
+	_, p2pkScript := p2pkAddr.PaymentScript()
+	_, p2pkhScript := p2pkhAddr.PaymentScript()
+
+	for _, extendedKeys := range []bool{false, true} {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"extendedkeys_%v", extendedKeys))
+		defer teardown()
+		idx.extendedKeys = extendedKeys
+		if err := idx.checkOptions(); err != nil {
+			t.Fatalf("unexpected error checking options: %v", err)
+		}
+
+		// Connect a block that pays both the public key and its hash in
+		// separate transactions.
+		coinbase := newTestCoinbase(1, p2pkScript)
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash(), Index: 1},
+			Sequence:         wire.MaxTxInSequenceNum,
+		})
+		tx.AddTxOut(wire.NewTxOut(1e8, p2pkhScript))
+		block := newTestBlock(1, &idx.chainParams.GenesisHash,
+			[]*wire.MsgTx{coinbase, tx}, nil)
+		connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+
+		// Ensure both addresses are indexed under the same key in the
+		// standard key mode and are distinguishable in the extended key mode.
+		wantEntries := 2
+		if extendedKeys {
+			wantEntries = 1
+		}
+		var offsets []uint32
+		for _, addr := range []stdaddr.Address{p2pkAddr, p2pkhAddr} {
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("unexpected number of entries for %s (extended keys "+
+					"%v): got %d, want %d", addr, extendedKeys, len(entries),
+					wantEntries)
+			}
+			offsets = append(offsets, entries[0].BlockRegion.Offset)
+		}
+
+		// Ensure each address references its own transaction in the extended
+		// key mode.
+		if extendedKeys && offsets[0] == offsets[1] {
+			t.Fatal("pay-to-pubkey and pay-to-pubkey-hash entries reference " +
+				"the same transaction")
+		}
+
+		if !extendedKeys {
+			continue
+		}
+
+		// Ensure disabling the extended key mode is rejected without
+		// modifying the existing index.
+		idx.extendedKeys = false
+		err := idx.checkOptions()
+		if !errors.Is(err, ErrAddrIndexOptionsMismatch) {
+			t.Fatalf("unexpected error checking options with changed key "+
+				"mode: got %v, want %v", err, ErrAddrIndexOptionsMismatch)
+		}
+		idx.extendedKeys = true
+		entries, _, err := idx.EntriesForAddress(nil, p2pkhAddr, 0, 10, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("unexpected entries after rejected key mode change: "+
+				"got %d, want 1", len(entries))
+		}
+
+		// Ensure the key mode may be changed once the index is dropped and
+		// the new options are stored.
+		ctx := context.Background()
+		if err := DropAddrIndex(ctx, idx.db); err != nil {
+			t.Fatal(err)
+		}
+		if err := createIndex(idx, &idx.chainParams.GenesisHash); err != nil {
+			t.Fatal(err)
+		}
+		idx.extendedKeys = false
+		if err := idx.checkOptions(); err != nil {
+			t.Fatalf("unexpected error checking options: %v", err)
+		}
+		err = idx.db.View(func(dbTx database.Tx) error {
+			options, ok, err := dbFetchIndexerOptions(dbTx, idx.Key())
+			if err != nil {
+				return err
+			}
+			if !ok || options&addrIndexOptExtendedKeys != 0 {
+				return fmt.Errorf("unexpected options after rebuild: %x",
+					options)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestAddrIndexScriptAddrExtractor ensures the addresses returned by a custom
+// script address extractor are indexed for both confirmed and unconfirmed
+// transactions in addition to the standard addresses.
+func TestAddrIndexScriptAddrExtractor(t *testing.T) {
+	t.Parallel()
+
+	// Create a custom script that pushes a hash160 followed by OP_NOP10 along
+	// with an extractor that recognizes it as paying to the pubkey hash.
+	customAddr := testP2PKHAddr(t, 0x01)
+	stdAddr := testP2PKHAddr(t, 0x02)
+	customScript, err := txscript.NewScriptBuilder().
+		AddData(bytes.Repeat([]byte{0x01}, 20)).AddOp(txscript.OP_NOP10).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stdScript := stdAddr.PaymentScript()
+	extractor := func(scriptVersion uint16, pkScript []byte) [][addrKeySize]byte {
+		if scriptVersion != 0 || len(pkScript) != 22 ||
+			pkScript[0] != txscript.OP_DATA_20 ||
+			pkScript[21] != txscript.OP_NOP10 {
+
+			return nil
+		}
+		var addrKey [addrKeySize]byte
+		addrKey[0] = addrKeyTypePubKeyHash
+		copy(addrKey[1:], pkScript[1:21])
+		return [][addrKeySize]byte{addrKey}
+	}
+
+	for _, withExtractor := range []bool{false, true} {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"extractor_%v", withExtractor))
+		defer teardown()
+		if withExtractor {
+			idx.scriptAddrExtractor = extractor
+		}
+
+		// Connect a block with a coinbase that pays both scripts and add an
+		// unconfirmed transaction that pays both scripts as well.
+		coinbase := newTestCoinbase(1, customScript, stdScript)
+		block := newTestBlock(1, &idx.chainParams.GenesisHash,
+			[]*wire.MsgTx{coinbase}, nil)
+		connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+		unconfirmedTx := dcrutil.NewTx(newTestCoinbase(2, customScript,
+			stdScript))
+		idx.AddUnconfirmedTx(unconfirmedTx, testPrevScripter{}, false)
+
+		// Ensure the standard address is always indexed and the custom one is
+		// only indexed with the extractor for both kinds of transactions.
+		for _, addr := range []stdaddr.Address{customAddr, stdAddr} {
+			wantEntries := 1
+			if addr == customAddr && !withExtractor {
+				wantEntries = 0
+			}
+			entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("unexpected number of entries for %s (extractor %v): "+
+					"got %d, want %d", addr, withExtractor, len(entries),
+					wantEntries)
+			}
+			txns := idx.UnconfirmedTxnsForAddress(addr)
+			if len(txns) != wantEntries {
+				t.Fatalf("unexpected number of unconfirmed txns for %s "+
+					"(extractor %v): got %d, want %d", addr, withExtractor,
+					len(txns), wantEntries)
+			}
+		}
+	}
+}
+
+// TestAddrIndexUnindexedScriptVersions ensures the heights of the blocks that
+// contain output scripts or spent previous output scripts with unsupported
+// versions are recorded and that the records are removed when the blocks are
+// disconnected.
+func TestAddrIndexUnindexedScriptVersions(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unindexedversions")
+	defer teardown()
+
+	checkHeights := func(want []uint32) {
+		t.Helper()
+
+		heights, err := idx.UnindexedScriptVersionHeights()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(heights, want) {
+			t.Fatalf("unexpected unindexed heights: got %v, want %v", heights,
+				want)
+		}
+	}
+
+	// Connect a block that only contains supported script versions and ensure
+	// its height is not recorded.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, pkScript)}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	checkHeights(nil)
+
+	// Connect a block with an output that pays to a script with an unknown
+	// version and ensure its height is recorded while the address it pays is
+	// not indexed.
+	const unknownVersion = 0xffff
+	coinbase := newTestCoinbase(2)
+	coinbase.AddTxOut(&wire.TxOut{Value: 1e8, Version: unknownVersion,
+		PkScript: pkScript})
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{coinbase}, nil)
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, false)
+	checkHeights([]uint32{2})
+	entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("unexpected number of entries: got %d, want 1",
+			len(entries))
+	}
+
+	// Connect a block with a transaction that spends the output with the
+	// unknown version and ensure its height is recorded as well.
+	spendTx := wire.NewMsgTx()
+	prevOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	spendTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+	spendTx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+	block3 := newTestBlock(3, block2.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(3), spendTx}, nil)
+	prevScripts := testPrevScripter{prevOut: {version: unknownVersion,
+		script: pkScript, amount: 1e8}}
+	connectTestBlock(t, idx, block3, 3, prevScripts, false)
+	checkHeights([]uint32{2, 3})
+
+	// Ensure disconnecting the blocks removes the records.
+	for _, test := range []struct {
+		block, parent *dcrutil.Block
+		prevScripts   PrevScripter
+		want          []uint32
+	}{
+		{block3, block2, prevScripts, []uint32{2}},
+		{block2, block1, testPrevScripter{}, nil},
+	} {
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return idx.disconnectBlock(dbTx, test.block, test.parent,
+				test.prevScripts, false)
+		})
+		if err != nil {
+			t.Fatalf("unable to disconnect block: %v", err)
+		}
+		checkHeights(test.want)
+	}
+}
+
+// TestAddrIndexAddressTotals ensures the total amounts credited to and debited
+// from addresses are updated as blocks are connected and disconnected, that the
+// debits use the amounts of the spent outputs, that the totals are reported as
+// unavailable when they are not tracked, and that indexes created by prior
+// versions are treated as not tracking them.
+func TestAddrIndexAddressTotals(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_totals")
+	defer teardown()
+	idx.trackTotals = true
+
+	addrA, addrB, addrC := testP2PKHAddr(t, 0x0a), testP2PKHAddr(t, 0x0b),
+		testP2PKHAddr(t, 0x0c)
+	_, scriptA := addrA.PaymentScript()
+	_, scriptB := addrB.PaymentScript()
+
+	// checkTotals ensures the totals for the provided address match the
+	// expected values.
+	checkTotals := func(addr stdaddr.Address, wantCredited, wantDebited dcrutil.Amount) {
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			credited, debited, err := idx.AddressTotals(dbTx, addr)
+			if err != nil {
+				return err
+			}
+			if credited != wantCredited || debited != wantDebited {
+				t.Fatalf("unexpected totals for %s: got %v/%v, want %v/%v",
+					addr, credited, debited, wantCredited, wantDebited)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Connect a block with a coinbase that pays both addresses.
+	coinbase1 := newTestCoinbase(1, scriptA, scriptB)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase1}, nil)
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	checkTotals(addrA, 1e8, 0)
+	checkTotals(addrB, 1e8, 0)
+	checkTotals(addrC, 0, 0)
+
+	// Connect a block with a transaction that spends the output paying the
+	// first address to the second one.  The input intentionally commits to a
+	// different amount to ensure the amount of the spent output is used.
+	spentOut := wire.NewOutPoint(coinbase1.CachedTxHash(), 1,
+		wire.TxTreeRegular)
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(wire.NewTxIn(spentOut, 0, nil))
+	spendTx.AddTxOut(wire.NewTxOut(6e7, scriptB))
+	prevScripts := testPrevScripter{
+		*spentOut: {version: 0, script: scriptA, amount: 1e8},
+	}
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{
+		newTestCoinbase(2, scriptB), spendTx}, nil)
+	connectTestBlock(t, idx, block2, 2, prevScripts, false)
+	checkTotals(addrA, 1e8, 1e8)
+	checkTotals(addrB, 2e8+6e7, 0)
+
+	// Ensure disconnecting the block reverts the totals.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1, prevScripts, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTotals(addrA, 1e8, 0)
+	checkTotals(addrB, 1e8, 0)
+
+	// checkUnavailable ensures the totals for the first address are reported
+	// as unavailable.
+	checkUnavailable := func() {
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			_, _, err := idx.AddressTotals(dbTx, addrA)
+			return err
+		})
+		if !errors.Is(err, ErrAddressTotalsUnavailable) {
+			t.Fatalf("unexpected error: got %v, want %v", err,
+				ErrAddressTotalsUnavailable)
+		}
+	}
+
+	// Ensure the totals are reported as unavailable and are not updated when
+	// the index does not track them.
+	idx.trackTotals = false
+	checkUnavailable()
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.connectBlock(dbTx, block2, block1, prevScripts, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.trackTotals = true
+	checkTotals(addrA, 1e8, 0)
+	checkTotals(addrB, 1e8, 0)
+
+	// Ensure upgrading an index that was created by a prior version, which
+	// does not record any options, treats it as having been built without
+	// tracking the totals so enabling them requires the index to be rebuilt.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		err := dbPutIndexerTip(dbTx, idx.Key(), block2.Hash(), 2)
+		if err != nil {
+			return err
+		}
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(addrTotalsIndexKey); err != nil {
+			return err
+		}
+		indexesBucket := meta.Bucket(indexTipsBucketName)
+		if err := indexesBucket.Delete(indexOptionsKey(idx.Key())); err != nil {
+			return err
+		}
+		return dbPutIndexerVersion(dbTx, idx.Key(), 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.upgradeToVersion3(context.Background()); err != nil {
+		t.Fatalf("unexpected upgrade error: %v", err)
+	}
+	checkTotals(addrA, 0, 0)
+	if err := idx.checkOptions(); !errors.Is(err, ErrAddrIndexOptionsMismatch) {
+		t.Fatalf("unexpected error: got %v, want %v", err,
+			ErrAddrIndexOptionsMismatch)
+	}
+	idx.trackTotals = false
+	if err := idx.checkOptions(); err != nil {
+		t.Fatalf("unexpected options error: %v", err)
+	}
+	checkUnavailable()
+}
+
+// TestAddrIndexForEachAddress ensures iterating the address keys of the index
+// visits each distinct address exactly once and can be stopped early.
+func TestAddrIndexForEachAddress(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_foreachaddr")
+	defer teardown()
+
+	// Connect enough blocks for the addresses to span multiple levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	// The blocks pay the same four addresses along with a unique script hash
+	// address per block.
+	wantKeys := make(map[[addrKeySize]byte]struct{})
+	for i := 0; i < 4; i++ {
+		addrKey, err := addrToKey(testP2PKHAddr(t, byte(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantKeys[addrKey] = struct{}{}
+	}
+	for height := uint32(1); height <= numBlocks; height++ {
+		var addrKey [addrKeySize]byte
+		addrKey[0] = addrKeyTypeScriptHash
+		byteOrder.PutUint32(addrKey[1:], height)
+		wantKeys[addrKey] = struct{}{}
+	}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		// Ensure every address is visited exactly once in ascending order.
+		var gotKeys [][addrKeySize]byte
+		err := idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+			gotKeys = append(gotKeys, addrKey)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(gotKeys) != len(wantKeys) {
+			return fmt.Errorf("unexpected number of address keys: got %d, "+
+				"want %d", len(gotKeys), len(wantKeys))
+		}
+		for i, addrKey := range gotKeys {
+			if _, ok := wantKeys[addrKey]; !ok {
+				return fmt.Errorf("unexpected address key %x", addrKey)
+			}
+			if i > 0 && bytes.Compare(gotKeys[i-1][:], addrKey[:]) >= 0 {
+				return fmt.Errorf("address key %x is out of order", addrKey)
+			}
+		}
+
+		// Ensure returning the stop error ends the iteration without an
+		// error while any other error is returned.
+		var numVisited int
+		err = idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+			numVisited++
+			if numVisited == 2 {
+				return ErrStopForEach
+			}
+			return nil
+		})
+		if err != nil || numVisited != 2 {
+			return fmt.Errorf("unexpected result when stopping early: err %v, "+
+				"visited %d", err, numVisited)
+		}
+		errTest := errors.New("test error")
+		err = idx.ForEachAddress(dbTx, func(addrKey [addrKeySize]byte) error {
+			return errTest
+		})
+		if !errors.Is(err, errTest) {
+			return fmt.Errorf("unexpected callback error: got %v, want %v",
+				err, errTest)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexWalkAll ensures walking the entire index visits each distinct
+// address exactly once in ascending order along with the same entries that are
+// returned when querying the address directly.
+func TestAddrIndexWalkAll(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_walkall")
+	defer teardown()
+
+	// Connect enough blocks for the shared addresses to span multiple levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var numVisited int
+		var prevKey [addrKeySize]byte
+		err := idx.WalkAll(dbTx, func(addrKey [addrKeySize]byte,
+			entries []TxIndexEntry) error {
+
+			if numVisited > 0 && bytes.Compare(prevKey[:], addrKey[:]) >= 0 {
+				return fmt.Errorf("address key %x is out of order", addrKey)
+			}
+			numVisited++
+			prevKey = addrKey
+
+			want, _, err := idx.entriesForAddressKey(dbTx, addrKey, 0,
+				math.MaxUint32, false)
+			if err != nil {
+				return err
+			}
+			if len(want) == 0 || !reflect.DeepEqual(entries, want) {
+				return fmt.Errorf("mismatched entries for address key %x: "+
+					"got %d entries, want %d", addrKey, len(entries),
+					len(want))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// The blocks pay the same four addresses along with a unique script
+		// hash address per block.
+		if want := numBlocks + 4; numVisited != want {
+			return fmt.Errorf("unexpected number of addresses visited: got "+
+				"%d, want %d", numVisited, want)
+		}
+
+		// Ensure returning the stop error ends the walk without an error.
+		numVisited = 0
+		err = idx.WalkAll(dbTx, func([addrKeySize]byte, []TxIndexEntry) error {
+			numVisited++
+			return ErrStopForEach
+		})
+		if err != nil || numVisited != 1 {
+			return fmt.Errorf("unexpected result when stopping early: err %v, "+
+				"visited %d", err, numVisited)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexAddressTypeCounts ensures the distinct addresses in the index
+// are counted under their address types, including addresses that span
+// multiple levels and the public key variants of the extended key mode.
+func TestAddrIndexAddressTypeCounts(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_typecounts")
+	defer teardown()
+
+	// Connect enough blocks for the four shared pay-to-pubkey-hash addresses
+	// to span multiple levels along with a unique pay-to-script-hash address
+	// per block.
+	const numBlocks = 20
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	// Connect a block that pays two Ed25519 addresses and one secp256k1
+	// Schnorr address.
+	params := idx.chainParams
+	var pkScripts [][]byte
+	for i := byte(0); i < 3; i++ {
+		hash160 := bytes.Repeat([]byte{0xa0 + i}, 20)
+		var addr stdaddr.Address
+		var err error
+		if i < 2 {
+			addr, err = stdaddr.NewAddressPubKeyHashEd25519V0(hash160, params)
+		} else {
+			addr, err = stdaddr.NewAddressPubKeyHashSchnorrSecp256k1V0(hash160,
+				params)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, pkScript := addr.PaymentScript()
+		pkScripts = append(pkScripts, pkScript)
+	}
+	height := uint32(numBlocks + 1)
+	block := newTestBlock(height, blocks[numBlocks-1].Hash(),
+		[]*wire.MsgTx{newTestCoinbase(height, pkScripts...)}, nil)
+	connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+
+	// Add an entry for a pay-to-pubkey address as stored by the extended key
+	// mode, which is counted under the pay-to-pubkey-hash type.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		var addrKey [addrKeySize]byte
+		addrKey[0] = addrKeyTypePubKey
+		addrKey[1] = 0xff
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		return dbPutAddrIndexEntry(bucket, addrKey, 1, wire.TxLoc{}, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var counts map[uint8]uint64
+	err = idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		counts, err = idx.AddressTypeCounts(dbTx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint8]uint64{
+		addrKeyTypePubKeyHash:        5,
+		addrKeyTypePubKeyHashEdwards: 2,
+		addrKeyTypePubKeyHashSchnorr: 1,
+		addrKeyTypeScriptHash:        numBlocks,
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Fatalf("unexpected counts: got %v, want %v", counts, want)
+	}
+}
+
+// TestAddrIndexDependencyLag ensures the lag between the tx index and the
+// address index is reported as expected.
+func TestAddrIndexDependencyLag(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_dependencylag")
+	defer teardown()
+
+	// Ensure the lag is not reported without a tx index.
+	_, err := idx.DependencyLag()
+	if !errors.Is(err, ErrTxIndexRequired) {
+		t.Fatalf("unexpected error without tx index: got %v, want %v", err,
+			ErrTxIndexRequired)
+	}
+
+	// Ensure the lag is reported relative to the tx index tip.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return dbPutIndexerTip(dbTx, txIndexKey,
+			&idx.chainParams.GenesisHash, 5)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lag, err := idx.DependencyLag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lag != 5 {
+		t.Fatalf("unexpected dependency lag: got %d, want 5", lag)
+	}
+}
+
+// TestAddrIndexHealth ensures the health summary of the address index reports
+// its tip, whether it matches the chain tip, the lag behind the transaction
+// index, and the number of unconfirmed transactions.
+func TestAddrIndexHealth(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_health")
+	defer teardown()
+
+	// fetchHealth returns the health summary of the address index.
+	fetchHealth := func() (Health, error) {
+		var health Health
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			health, err = idx.Health(dbTx)
+			return err
+		})
+		return health, err
+	}
+
+	// Ensure the health is not reported without a tx index.
+	_, err := fetchHealth()
+	if !errors.Is(err, ErrTxIndexRequired) {
+		t.Fatalf("unexpected error without tx index: got %v, want %v", err,
+			ErrTxIndexRequired)
+	}
+
+	// Connect some blocks to the address index after adding them to the chain
+	// along with an unconfirmed transaction and a tx index that is ahead.
+	const numBlocks = 3
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks[:numBlocks-1], 1)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return dbPutIndexerTip(dbTx, txIndexKey, blocks[numBlocks-1].Hash(),
+			numBlocks)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pkScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	idx.AddUnconfirmedTx(dcrutil.NewTx(newTestCoinbase(numBlocks+1,
+		pkScript)), testPrevScripter{}, false)
+
+	health, err := fetchHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Health{
+		TipHeight:          numBlocks - 1,
+		TipHash:            *blocks[numBlocks-2].Hash(),
+		Synced:             false,
+		DependencyLag:      1,
+		NumUnconfirmedTxns: 1,
+	}
+	if health != want {
+		t.Fatalf("unexpected health: got %+v, want %+v", health, want)
+	}
+
+	// Ensure the index is reported as synced once it reaches the chain tip.
+	connectTestBlocksBatched(t, idx, blocks[numBlocks-1:], 1)
+	health, err = fetchHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.TipHeight = numBlocks
+	want.TipHash = *blocks[numBlocks-1].Hash()
+	want.Synced = true
+	want.DependencyLag = 0
+	if health != want {
+		t.Fatalf("unexpected health: got %+v, want %+v", health, want)
+	}
+}
+
+// TestAddrIndexSpendConsumerTip ensures the tip of the spend consumer tracks
+// the tip of the index exactly as blocks are connected and disconnected via
+// notifications and that a divergence between them is reported.
+func TestAddrIndexSpendConsumerTip(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_spendconsumertip")
+	defer teardown()
+
+	// Ensure an index without a spend consumer is rejected.
+	if _, err := idx.SpendConsumerTip(); err == nil {
+		t.Fatal("spend consumer tip without a consumer did not fail")
+	}
+	idx.consumer = NewSpendConsumer(idx.Name(), &idx.chainParams.GenesisHash,
+		idx.chain)
+
+	// checkTip ensures the tip of the spend consumer and index both match
+	// the provided block.
+	checkTip := func(wantHash *chainhash.Hash, wantHeight int64) {
+		t.Helper()
+
+		status, err := idx.SpendConsumerTip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Diverged {
+			t.Fatalf("spend consumer tip %v diverged from index tip %v",
+				status.ConsumerTip, status.IndexTipHash)
+		}
+		if status.ConsumerTip == nil || *status.ConsumerTip != *wantHash {
+			t.Fatalf("unexpected spend consumer tip: got %v, want %v",
+				status.ConsumerTip, wantHash)
+		}
+		if status.IndexTipHash != *wantHash ||
+			status.IndexTipHeight != wantHeight {
+
+			t.Fatalf("unexpected index tip: got %v (height %d), want %v "+
+				"(height %d)", status.IndexTipHash, status.IndexTipHeight,
+				wantHash, wantHeight)
+		}
+	}
+	checkTip(&idx.chainParams.GenesisHash, 0)
+
+	// processNtfn processes a notification of the provided type for the
+	// provided block and parent.
+	processNtfn := func(ntfnType IndexNtfnType, block, parent *dcrutil.Block) {
+		t.Helper()
+
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if ntfnType == ConnectNtfn {
+				err := dbPutBlockIDIndexEntry(dbTx, block.Hash(),
+					uint32(block.Height()))
+				if err != nil {
+					return err
+				}
+			}
+			return idx.ProcessNotification(dbTx, &IndexNtfn{
+				NtfnType:    ntfnType,
+				Block:       block,
+				Parent:      parent,
+				PrevScripts: testPrevScripter{},
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Connect several blocks and ensure the spend consumer tracks the tip
+	// of the index after each one.
+	const numBlocks = 3
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	genesis := dcrutil.NewBlock(idx.chainParams.GenesisBlock)
+	parents := append([]*dcrutil.Block{genesis}, blocks[:numBlocks-1]...)
+	for i, block := range blocks {
+		if err := idx.chain.(*testChain).AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		processNtfn(ConnectNtfn, block, parents[i])
+		checkTip(block.Hash(), int64(i+1))
+	}
+
+	// Disconnect the blocks and ensure the spend consumer tracks the tip of
+	// the index after each one and that the spend consumer dependency of
+	// each disconnected block is removed.
+	for i := numBlocks - 1; i >= 0; i-- {
+		processNtfn(DisconnectNtfn, blocks[i], parents[i])
+		checkTip(parents[i].Hash(), int64(i))
+		chain := idx.chain.(*testChain)
+		if !chain.IsRemovedSpendConsumerDependency(blocks[i].Hash(),
+			idx.Name()) {
+
+			t.Fatalf("spend consumer dependency for block %v not removed",
+				blocks[i].Hash())
+		}
+	}
+
+	// Ensure a spend consumer tip that differs from the index tip is
+	// reported as diverged.
+	idx.consumer.UpdateTip(blocks[0].Hash())
+	status, err := idx.SpendConsumerTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Diverged {
+		t.Fatalf("spend consumer tip %v not reported as diverged from index "+
+			"tip %v", status.ConsumerTip, status.IndexTipHash)
+	}
+}
+
+// testDepSpendConsumer is a spend consumer that depends on the spend journal
+// data of every block.
+type testDepSpendConsumer struct {
+	id string
+}
+
+// ID returns the identifier of the consumer.
+func (c *testDepSpendConsumer) ID() string {
+	return c.id
+}
+
+// NeedSpendData always returns true to signal the consumer needs the spend
+// journal data of all blocks.
+func (c *testDepSpendConsumer) NeedSpendData(*chainhash.Hash) (bool, error) {
+	return true, nil
+}
+
+// TestAddrIndexVerifyCompanionConsistency ensures orphaned entries seeded in
+// each of the companion buckets and the spend consumer dependencies are
+// detected and that consistent data does not report any orphans.
+func TestAddrIndexVerifyCompanionConsistency(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_companion")
+	defer teardown()
+
+	const numBlocks = 5
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+
+	// verify returns the orphans reported by the address index.
+	verify := func() []CompanionOrphan {
+		t.Helper()
+
+		var orphans []CompanionOrphan
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			orphans, err = idx.VerifyCompanionConsistency(dbTx)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return orphans
+	}
+
+	// Ensure consistent data does not report any orphans both with and
+	// without the spend consumer dependencies bucket.
+	if orphans := verify(); len(orphans) != 0 {
+		t.Fatalf("unexpected orphans without dependencies: %+v", orphans)
+	}
+	pruner, err := spendpruner.NewSpendJournalPruner(idx.db,
+		func(*chainhash.Hash) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orphans := verify(); len(orphans) != 0 {
+		t.Fatalf("unexpected orphans: %+v", orphans)
+	}
+
+	// Seed orphans in each of the companion buckets along with a spend
+	// consumer dependency of the index on an unknown block and one of another
+	// consumer that must be ignored.
+	indexedKey, err := idx.keyForAddr(testP2PKHAddr(t, 0x00))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingKey, err := idx.keyForAddr(testP2PKHAddr(t, 0xfe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownHash := chainhash.Hash{0xaa}
+	var commitKey1, commitKey2 [addrCommitmentKeySize]byte
+	copy(commitKey1[:], missingKey[:])
+	copy(commitKey2[:], indexedKey[:])
+	commitKey2[addrKeySize] = 0x01
+	var rewardKey [addrRewardSourceKeySize]byte
+	copy(rewardKey[:], indexedKey[:])
+	copy(rewardKey[addrKeySize:], unknownHash[:])
+	var unindexedKey [4]byte
+	byteOrder.PutUint32(unindexedKey[:], numBlocks+1)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		commitments := map[[addrCommitmentKeySize]byte]int64{commitKey1: 1}
+		if err := dbPutAddrCommitments(dbTx, 1, commitments); err != nil {
+			return err
+		}
+		commitments = map[[addrCommitmentKeySize]byte]int64{commitKey2: 1}
+		if err := dbPutAddrCommitments(dbTx, 999, commitments); err != nil {
+			return err
+		}
+		totals := map[[addrKeySize]byte]*addrTotals{
+			missingKey: {credited: 1},
+		}
+		if err := dbAddAddrTotals(dbTx, totals, false); err != nil {
+			return err
+		}
+		if err := dbPutAddrBlockTime(dbTx, &unknownHash, 1); err != nil {
+			return err
+		}
+		sources := map[[addrRewardSourceKeySize]byte]chainhash.Hash{
+			rewardKey: {0x01},
+		}
+		if err := dbPutAddrRewardSources(dbTx, sources); err != nil {
+			return err
+		}
+		return dbPutAddrUnindexedHeight(dbTx, numBlocks+1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruner.AddConsumer(&testDepSpendConsumer{id: idx.Name()})
+	if err := pruner.MaybePruneSpendData(&unknownHash, nil); err != nil {
+		t.Fatal(err)
+	}
+	pruner, err = spendpruner.NewSpendJournalPruner(idx.db,
+		func(*chainhash.Hash) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruner.AddConsumer(&testDepSpendConsumer{id: "other"})
+	otherHash := chainhash.Hash{0xbb}
+	if err := pruner.MaybePruneSpendData(&otherHash, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CompanionOrphan{{
+		Bucket: string(addrCommitmentIndexKey),
+		Key:    commitKey2[:],
+		Reason: "references a block that is not in the index",
+	}, {
+		Bucket: string(addrCommitmentIndexKey),
+		Key:    commitKey1[:],
+		Reason: "address has no entries",
+	}, {
+		Bucket: string(addrTotalsIndexKey),
+		Key:    missingKey[:],
+		Reason: "address has no entries",
+	}, {
+		Bucket: string(addrBlockTimeIndexKey),
+		Key:    unknownHash[:],
+		Reason: "references a block that is not in the index",
+	}, {
+		Bucket: string(addrRewardSourceIndexKey),
+		Key:    rewardKey[:],
+		Reason: "references a block that is not in the index",
+	}, {
+		Bucket: string(addrUnindexedVersionIndexKey),
+		Key:    unindexedKey[:],
+		Reason: "references a height above the index tip",
+	}, {
+		Bucket: spendConsumerDepsName,
+		Key:    unknownHash[:],
+		Reason: "references a block that is not known to the chain",
+	}}
+	if orphans := verify(); !reflect.DeepEqual(orphans, want) {
+		t.Fatalf("unexpected orphans:\ngot  %+v\nwant %+v", orphans, want)
+	}
+}
+
+// TestAddrIndexFirstLastSeen ensures the first and last seen heights for an
+// address are reported properly across multiple levels along with whether or
+// not the address exists, its level statistics, and its estimated size.
+func TestAddrIndexFirstLastSeen(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_seen")
+	defer teardown()
+
+	// Connect enough blocks paying to the same address to populate multiple
+	// levels.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	const numBlocks = level0MaxEntries*3 + 1
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		firstSeen, err := idx.FirstSeenHeight(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		if firstSeen != 1 {
+			return fmt.Errorf("unexpected first seen height: got %d, "+
+				"want 1", firstSeen)
+		}
+
+		lastSeen, err := idx.LastSeenHeight(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		if lastSeen != numBlocks {
+			return fmt.Errorf("unexpected last seen height: got %d, "+
+				"want %d", lastSeen, numBlocks)
+		}
+
+		// Ensure an address without any entries reports it was not found.
+		unknownAddr := testP2PKHAddr(t, 0x02)
+		_, err = idx.FirstSeenHeight(dbTx, unknownAddr)
+		if !errors.Is(err, ErrAddressNotFound) {
+			return fmt.Errorf("unexpected first seen error: got %v, "+
+				"want %v", err, ErrAddressNotFound)
+		}
+		_, err = idx.LastSeenHeight(dbTx, unknownAddr)
+		if !errors.Is(err, ErrAddressNotFound) {
+			return fmt.Errorf("unexpected last seen error: got %v, "+
+				"want %v", err, ErrAddressNotFound)
+		}
+
+		// Ensure the level statistics reflect the expected distribution.
+		// The 25 entries are split as 1 in level 0, 8 in level 1, and 16
+		// in level 2.
+		stats, err := idx.AddressLevelStats(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		wantStats := []LevelStat{{0, 1}, {1, 8}, {2, 16}}
+		if len(stats) != len(wantStats) {
+			return fmt.Errorf("unexpected number of levels: got %d, want %d",
+				len(stats), len(wantStats))
+		}
+		for i := range stats {
+			if stats[i] != wantStats[i] {
+				return fmt.Errorf("unexpected level stats: got %+v, want %+v",
+					stats[i], wantStats[i])
+			}
+		}
+		stats, err = idx.AddressLevelStats(dbTx, unknownAddr)
+		if err != nil {
+			return err
+		}
+		if len(stats) != 0 {
+			return fmt.Errorf("unexpected level stats for unknown address: "+
+				"%+v", stats)
+		}
+
+		// Ensure the estimated size accounts for the entries in all levels.
+		numBytes, err := idx.EstimatedEntryBytes(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		if numBytes != numBlocks*txEntrySize {
+			return fmt.Errorf("unexpected estimated entry bytes: got %d, "+
+				"want %d", numBytes, numBlocks*txEntrySize)
+		}
+		numBytes, err = idx.EstimatedEntryBytes(dbTx, unknownAddr)
+		if err != nil {
+			return err
+		}
+		if numBytes != 0 {
+			return fmt.Errorf("unexpected estimated entry bytes for unknown "+
+				"address: %d", numBytes)
+		}
+
+		// Ensure the existence check reports the expected results.
+		hasAddr, err := idx.HasAddress(dbTx, addr)
+		if err != nil {
+			return err
+		}
+		if !hasAddr {
+			return errors.New("address with entries reported as missing")
+		}
+		hasAddr, err = idx.HasAddress(dbTx, unknownAddr)
+		if err != nil {
+			return err
+		}
+		if hasAddr {
+			return errors.New("address without entries reported as present")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexLevelHistogram ensures the level histogram reports the expected
+// distribution of the number of levels occupied by the sampled addresses and
+// the expected fullness of each level.
+func TestAddrIndexLevelHistogram(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_levelhistogram")
+	defer teardown()
+
+	// Connect blocks that pay the first address in every block, the second
+	// address in the first 3 blocks, and the third address in the first 10
+	// blocks.  The entries of the addresses are split among the levels as
+	// follows:
+	//
+	//   address 1: 1 in level 0, 8 in level 1, and 16 in level 2
+	//   address 2: 3 in level 0
+	//   address 3: 2 in level 0 and 8 in level 1
+	const numBlocks = 25
+	var pkScripts [3][]byte
+	for i := range pkScripts {
+		_, pkScripts[i] = testP2PKHAddr(t, byte(i+1)).PaymentScript()
+	}
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		blockScripts := [][]byte{pkScripts[0]}
+		if height <= 3 {
+			blockScripts = append(blockScripts, pkScripts[1])
+		}
+		if height <= 10 {
+			blockScripts = append(blockScripts, pkScripts[2])
+		}
+		txns := []*wire.MsgTx{newTestCoinbase(height, blockScripts...)}
+		block := newTestBlock(height, prevHash, txns, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	tests := []struct {
+		name       string
+		sampleSize uint32
+		want       AddrLevelHistogram
+	}{{
+		name:       "default sample size covers all addresses",
+		sampleSize: 0,
+		want: AddrLevelHistogram{
+			NumSampled: 3,
+			NumLevels:  []int{1, 1, 1},
+			Levels: []LevelFullness{
+				{0, 8, 3, 2, 0.25},
+				{1, 16, 2, 8, 0.5},
+				{2, 32, 1, 16, 0.5},
+			},
+		},
+	}, {
+		name:       "sample of the first address",
+		sampleSize: 1,
+		want: AddrLevelHistogram{
+			NumSampled: 1,
+			NumLevels:  []int{0, 0, 1},
+			Levels: []LevelFullness{
+				{0, 8, 1, 1, 0.125},
+				{1, 16, 1, 8, 0.5},
+				{2, 32, 1, 16, 0.5},
+			},
+		},
+	}, {
+		name:       "sample larger than the index",
+		sampleSize: 100,
+		want: AddrLevelHistogram{
+			NumSampled: 3,
+			NumLevels:  []int{1, 1, 1},
+			Levels: []LevelFullness{
+				{0, 8, 3, 2, 0.25},
+				{1, 16, 2, 8, 0.5},
+				{2, 32, 1, 16, 0.5},
+			},
+		},
+	}}
+
+	for _, test := range tests {
+		err := idx.db.View(func(dbTx database.Tx) error {
+			histogram, err := idx.LevelHistogram(dbTx, test.sampleSize)
+			if err != nil {
+				return err
+			}
+			if !reflect.DeepEqual(*histogram, test.want) {
+				return fmt.Errorf("%s: unexpected histogram: got %+v, want "+
+					"%+v", test.name, *histogram, test.want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestAddrIndexSubscribeUnconfirmed ensures subscribers to the unconfirmed
+// index are signalled when transactions involving their address are added and
+// removed and that signals are coalesced when not received.
+func TestAddrIndexSubscribeUnconfirmed(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconfsubs")
+	defer teardown()
+
+	addr := testP2PKHAddr(t, 0x01)
+	otherAddr := testP2PKHAddr(t, 0x02)
+	c, unsubscribe := idx.SubscribeUnconfirmed(addr)
+	defer unsubscribe()
+
+	// assertSignalled ensures the subscription channel has the expected
+	// signal state without blocking.
+	assertSignalled := func(want bool) {
+		t.Helper()
+		select {
+		case <-c:
+			if !want {
+				t.Fatal("unexpected signal")
+			}
+		default:
+			if want {
+				t.Fatal("expected signal")
+			}
+		}
+	}
+
+	// Ensure adding a transaction that does not involve the address does not
+	// signal the subscriber.
+	_, otherScript := otherAddr.PaymentScript()
+	otherTx := dcrutil.NewTx(newTestCoinbase(1, otherScript))
+	idx.AddUnconfirmedTx(otherTx, testPrevScripter{}, false)
+	assertSignalled(false)
+
+	// Ensure adding multiple transactions that involve the address results in
+	// a single coalesced signal.
+	_, pkScript := addr.PaymentScript()
+	tx1 := dcrutil.NewTx(newTestCoinbase(2, pkScript))
+	tx2 := dcrutil.NewTx(newTestCoinbase(3, pkScript))
+	idx.AddUnconfirmedTx(tx1, testPrevScripter{}, false)
+	idx.AddUnconfirmedTx(tx2, testPrevScripter{}, false)
+	assertSignalled(true)
+	assertSignalled(false)
+
+	// Ensure removing a transaction that involves the address signals the
+	// subscriber.
+	idx.RemoveUnconfirmedTx(tx1.Hash())
+	assertSignalled(true)
+
+	// Ensure the subscriber is no longer signalled after unsubscribing and
+	// that the subscription is cleaned up.
+	unsubscribe()
+	idx.RemoveUnconfirmedTx(tx2.Hash())
+	assertSignalled(false)
+	if len(idx.unconfirmedSubs) != 0 {
+		t.Fatalf("unexpected subscriptions remain: %d",
+			len(idx.unconfirmedSubs))
+	}
+}
+
+// TestAddrIndexSubscriberStats ensures the subscriber statistics track the
+// clients waiting for updates and count the signals that are dropped because
+// the clients are not receiving them.
+func TestAddrIndexSubscriberStats(t *testing.T) {
+	t.Parallel()
+
+	idx := newAddrIndex(nil, chaincfg.SimNetParams(), nil)
+	if stats := idx.SubscriberStats(); stats != (SubscriberStats{}) {
+		t.Fatalf("unexpected initial stats: %+v", stats)
+	}
+
+	// Register a sync subscriber, a tip waiter, and an unconfirmed index
+	// subscriber that never receive from their channels.
+	idx.WaitForSync()
+	idx.mtx.Lock()
+	idx.tipWaiters[make(chan struct{}, 1)] = struct{}{}
+	idx.mtx.Unlock()
+	addr := testP2PKHAddr(t, 0x01)
+	_, unsubscribe := idx.SubscribeUnconfirmed(addr)
+	defer unsubscribe()
+
+	// Ensure only the signals after the first one to each channel are
+	// counted as dropped.
+	_, pkScript := addr.PaymentScript()
+	for i := uint32(0); i < 3; i++ {
+		idx.notifyTipWaiters()
+		tx := dcrutil.NewTx(newTestCoinbase(i, pkScript))
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	}
+	want := SubscriberStats{
+		NumSyncSubscribers:        1,
+		NumTipWaiters:             1,
+		NumUnconfirmedSubscribers: 1,
+		DroppedSignals:            4,
+	}
+	if stats := idx.SubscriberStats(); stats != want {
+		t.Fatalf("unexpected stats: got %+v, want %+v", stats, want)
+	}
+}
+
+// TestAddrIndexUnconfirmedLimit ensures the unconfirmed index evicts the oldest
+// transactions once the configured maximum is exceeded, reports the evicted
+// transactions, and that the reported statistics track the contents of the
+// index.
+func TestAddrIndexUnconfirmedLimit(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconflimit")
+	defer teardown()
+
+	// Record the transactions that are reported as evicted.  The callback
+	// removes them from the index to ensure it is invoked without any locks
+	// held.
+	var evicted []chainhash.Hash
+	idx.onUnconfirmedTxEvicted = func(hash *chainhash.Hash) {
+		evicted = append(evicted, *hash)
+		idx.RemoveUnconfirmedTx(hash)
+	}
+
+	// Add several transactions that each pay a distinct address along with
+	// a shared address.
+	sharedAddr := testP2PKHAddr(t, 0xff)
+	_, sharedScript := sharedAddr.PaymentScript()
+	var txns []*dcrutil.Tx
+	for i := 0; i < 4; i++ {
+		_, pkScript := testP2PKHAddr(t, byte(i)).PaymentScript()
+		tx := dcrutil.NewTx(newTestCoinbase(uint32(i), pkScript, sharedScript))
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+		txns = append(txns, tx)
+	}
+	stats := idx.UnconfirmedStats()
+	if stats.NumTxns != 4 || stats.NumAddrs != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	var wantBytes uint64
+	for _, tx := range txns {
+		wantBytes += uint64(tx.MsgTx().SerializeSize()) +
+			2*unconfirmedMappingOverhead
+	}
+	if stats.EstimatedBytes != wantBytes {
+		t.Fatalf("unexpected estimated bytes: got %d, want %d",
+			stats.EstimatedBytes, wantBytes)
+	}
+
+	// Ensure adding the same transactions again does not change the
+	// accounting.
+	for _, tx := range txns {
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	}
+	if got := idx.UnconfirmedStats(); got != stats {
+		t.Fatalf("unexpected stats after adding again: got %+v, want %+v",
+			got, stats)
+	}
+
+	// Lower the limit and ensure the oldest transactions are evicted and
+	// reported.
+	idx.SetMaxUnconfirmedTxns(2)
+	stats = idx.UnconfirmedStats()
+	if stats.NumTxns != 2 || stats.NumAddrs != 3 || stats.NumEvicted != 2 {
+		t.Fatalf("unexpected stats after limit: %+v", stats)
+	}
+	wantEvicted := []chainhash.Hash{*txns[0].Hash(), *txns[1].Hash()}
+	if !reflect.DeepEqual(evicted, wantEvicted) {
+		t.Fatalf("unexpected evicted txns: got %v, want %v", evicted,
+			wantEvicted)
+	}
+	for i, tx := range txns {
+		_, exists := idx.addrsByTx[*tx.Hash()]
+		if wantExists := i >= 2; exists != wantExists {
+			t.Fatalf("tx %d: unexpected existence %v", i, exists)
+		}
+	}
+
+	// Add another transaction and ensure the oldest remaining one is
+	// evicted.
+	_, pkScript := testP2PKHAddr(t, 0x10).PaymentScript()
+	tx := dcrutil.NewTx(newTestCoinbase(10, pkScript))
+	idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	if _, exists := idx.addrsByTx[*txns[2].Hash()]; exists {
+		t.Fatal("oldest transaction was not evicted")
+	}
+	if len(evicted) != 3 || evicted[2] != *txns[2].Hash() {
+		t.Fatalf("unexpected evicted txns: %v", evicted)
+	}
+	if got := len(idx.UnconfirmedTxnsForAddress(sharedAddr)); got != 1 {
+		t.Fatalf("unexpected shared address txns: got %d, want 1", got)
+	}
+
+	// Remove everything and ensure the accounting returns to zero.
+	idx.RemoveUnconfirmedTx(txns[3].Hash())
+	idx.RemoveUnconfirmedTx(tx.Hash())
+	stats = idx.UnconfirmedStats()
+	if stats != (UnconfirmedIndexStats{NumEvicted: 3}) {
+		t.Fatalf("unexpected stats after removal: %+v", stats)
+	}
+	if idx.unconfirmedOrder.Len() != 0 || len(idx.unconfirmedElems) != 0 {
+		t.Fatal("eviction tracking not cleaned up")
+	}
+}
+
+// TestAddrIndexUnconfirmedPerAddrLimit ensures flooding a single address with
+// unconfirmed transactions does not exceed the maximum number of transactions
+// per address and that the mappings in both directions remain consistent.
+func TestAddrIndexUnconfirmedPerAddrLimit(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconfperaddr")
+	defer teardown()
+
+	// checkConsistent ensures every mapping from a transaction to an address
+	// has a corresponding mapping from the address to the transaction and
+	// vice versa and that only mapped transactions are accounted for.
+	checkConsistent := func() {
+		t.Helper()
+
+		idx.unconfirmedLock.RLock()
+		defer idx.unconfirmedLock.RUnlock()
+		for hash, addrKeys := range idx.addrsByTx {
+			if len(addrKeys) == 0 {
+				t.Fatalf("tx %v is not mapped to any addresses", hash)
+			}
+			for addrKey := range addrKeys {
+				if _, ok := idx.txnsByAddr[addrKey][hash]; !ok {
+					t.Fatalf("missing mapping from address %x to tx %v",
+						addrKey, hash)
+				}
+			}
+		}
+		for addrKey, txns := range idx.txnsByAddr {
+			if idx.maxUnconfirmedPerAddr > 0 &&
+				len(txns) > idx.maxUnconfirmedPerAddr {
+
+				t.Fatalf("address %x has %d txns which exceeds the limit "+
+					"of %d", addrKey, len(txns), idx.maxUnconfirmedPerAddr)
+			}
+			for hash := range txns {
+				if _, ok := idx.addrsByTx[hash][addrKey]; !ok {
+					t.Fatalf("missing mapping from tx %v to address %x",
+						hash, addrKey)
+				}
+			}
+		}
+		if len(idx.unconfirmedElems) != len(idx.addrsByTx) {
+			t.Fatalf("mismatched number of tracked txns: got %d, want %d",
+				len(idx.unconfirmedElems), len(idx.addrsByTx))
+		}
+
+		// Ensure the estimated bytes account for every mapping exactly
+		// once.
+		var wantBytes uint64
+		for hash, addrKeys := range idx.addrsByTx {
+			var tx *dcrutil.Tx
+			for addrKey := range addrKeys {
+				tx = idx.txnsByAddr[addrKey][hash]
+				break
+			}
+			wantBytes += uint64(tx.MsgTx().SerializeSize()) +
+				uint64(len(addrKeys))*unconfirmedMappingOverhead
+		}
+		if idx.unconfirmedBytes != wantBytes {
+			t.Fatalf("unexpected estimated bytes: got %d, want %d",
+				idx.unconfirmedBytes, wantBytes)
+		}
+	}
+
+	// Flood the target address with transactions that each also pay a
+	// distinct address.
+	const maxPerAddr, numTxns = 10, 50
+	idx.SetMaxUnconfirmedTxnsPerAddr(maxPerAddr)
+	targetAddr := testP2PKHAddr(t, 0xff)
+	_, targetScript := targetAddr.PaymentScript()
+	targetKey, err := idx.keyForAddr(targetAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txns []*dcrutil.Tx
+	for i := 0; i < numTxns; i++ {
+		_, pkScript := testP2PKHAddr(t, byte(i)).PaymentScript()
+		tx := dcrutil.NewTx(newTestCoinbase(uint32(i), targetScript,
+			pkScript))
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+		txns = append(txns, tx)
+	}
+	checkConsistent()
+	if got := idx.UnconfirmedCountForAddress(targetAddr); got != maxPerAddr {
+		t.Fatalf("unexpected target address txns: got %d, want %d", got,
+			maxPerAddr)
+	}
+	for i, tx := range txns {
+		addr := testP2PKHAddr(t, byte(i))
+		if got := idx.UnconfirmedCountForAddress(addr); got != 1 {
+			t.Fatalf("tx %d: unexpected distinct address txns: got %d, "+
+				"want 1", i, got)
+		}
+		_, inTarget := idx.txnsByAddr[targetKey][*tx.Hash()]
+		if wantInTarget := i < maxPerAddr; inTarget != wantInTarget {
+			t.Fatalf("tx %d: unexpected target address mapping %v", i,
+				inTarget)
+		}
+	}
+
+	// Ensure a transaction that only pays the target address is refused
+	// entirely.
+	onlyTarget := dcrutil.NewTx(newTestCoinbase(numTxns, targetScript))
+	idx.AddUnconfirmedTx(onlyTarget, testPrevScripter{}, false)
+	checkConsistent()
+	if _, ok := idx.addrsByTx[*onlyTarget.Hash()]; ok {
+		t.Fatal("refused transaction was added")
+	}
+	if got := idx.UnconfirmedStats().NumTxns; got != numTxns {
+		t.Fatalf("unexpected number of txns: got %d, want %d", got, numTxns)
+	}
+
+	// Ensure removing a transaction for the target address allows another
+	// one to be added and that adding a transaction again is not refused.
+	idx.RemoveUnconfirmedTx(txns[0].Hash())
+	idx.AddUnconfirmedTx(onlyTarget, testPrevScripter{}, false)
+	idx.AddUnconfirmedTx(txns[1], testPrevScripter{}, false)
+	checkConsistent()
+	if _, ok := idx.addrsByTx[*onlyTarget.Hash()]; !ok {
+		t.Fatal("transaction was not added after making room")
+	}
+	if got := idx.UnconfirmedCountForAddress(targetAddr); got != maxPerAddr {
+		t.Fatalf("unexpected target address txns: got %d, want %d", got,
+			maxPerAddr)
+	}
+
+	// Ensure the limit is not enforced once it is removed and that adding a
+	// transaction again accounts for the mapping that was previously refused.
+	idx.SetMaxUnconfirmedTxnsPerAddr(0)
+	idx.AddUnconfirmedTx(txns[maxPerAddr], testPrevScripter{}, false)
+	checkConsistent()
+	if got := idx.UnconfirmedCountForAddress(targetAddr); got != maxPerAddr+1 {
+		t.Fatalf("unexpected target address txns without limit: got %d, "+
+			"want %d", got, maxPerAddr+1)
+	}
+}
+
+// TestAddrIndexUnconfirmedCount ensures the number of unconfirmed transactions
+// for an address and whether or not there are any are reported correctly
+// without any allocations.
+//
+// NOTE: This test is not run in parallel since allocation counting does not
+// support parallel tests.
+func TestAddrIndexUnconfirmedCount(t *testing.T) {
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconfcount")
+	defer teardown()
+
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	for i := 0; i < 3; i++ {
+		tx := dcrutil.NewTx(newTestCoinbase(uint32(i), pkScript))
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	}
+
+	if got := idx.UnconfirmedCountForAddress(addr); got != 3 {
+		t.Fatalf("unexpected count: got %d, want 3", got)
+	}
+	unknownAddr := testP2PKHAddr(t, 0x02)
+	if got := idx.UnconfirmedCountForAddress(unknownAddr); got != 0 {
+		t.Fatalf("unexpected count for unknown address: got %d, want 0", got)
+	}
+
+	if !idx.HasUnconfirmed(addr) {
+		t.Fatal("address does not have unconfirmed transactions")
+	}
+	if idx.HasUnconfirmed(unknownAddr) {
+		t.Fatal("unknown address has unconfirmed transactions")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		idx.UnconfirmedCountForAddress(addr)
+		idx.HasUnconfirmed(addr)
+	})
+	if allocs != 0 {
+		t.Fatalf("unexpected allocations: got %v, want 0", allocs)
+	}
+
+	// Ensure the address no longer has unconfirmed transactions once they
+	// are all removed.
+	for i := 0; i < 3; i++ {
+		tx := newTestCoinbase(uint32(i), pkScript)
+		idx.RemoveUnconfirmedTx(tx.CachedTxHash())
+	}
+	if idx.HasUnconfirmed(addr) {
+		t.Fatal("address has unconfirmed transactions after removal")
+	}
+}
+
+// TestAddrIndexUnconfirmedIsolated ensures the unconfirmed (memory-only) address
+// index of an address index created without a database, index subscriber, or
+// spend consumer correctly tracks the addresses involved in transactions as
+// they are added and removed.
+func TestAddrIndexUnconfirmedIsolated(t *testing.T) {
+	t.Parallel()
+
+	idx := newAddrIndex(nil, chaincfg.SimNetParams(), nil)
+
+	// Create a transaction that spends an output paying to one address and
+	// pays to another one.
+	fromAddr := testP2PKHAddr(t, 0x01)
+	toAddr := testP2PKHAddr(t, 0x02)
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	fromVer, fromScript := fromAddr.PaymentScript()
+	prevScripts := testPrevScripter{prevOut: {
+		version: fromVer,
+		script:  fromScript,
+		amount:  2e8,
+	}}
+	toVer, toScript := toAddr.PaymentScript()
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: prevOut,
+		Sequence:         wire.MaxTxInSequenceNum,
+		ValueIn:          2e8,
+	})
+	spendTx.AddTxOut(&wire.TxOut{Value: 1e8, Version: toVer,
+		PkScript: toScript})
+	tx := dcrutil.NewTx(spendTx)
+
+	// Also create a coinbase that only pays to the second address.
+	coinbase := dcrutil.NewTx(newTestCoinbase(1, toScript))
+
+	// checkUnconfirmed ensures the provided address is involved in exactly the
+	// provided unconfirmed transactions.
+	checkUnconfirmed := func(addr stdaddr.Address, want ...*dcrutil.Tx) {
+		t.Helper()
+
+		if got := idx.UnconfirmedCountForAddress(addr); got != len(want) {
+			t.Fatalf("unexpected count for %s: got %d, want %d", addr, got,
+				len(want))
+		}
+		if got := idx.HasUnconfirmed(addr); got != (len(want) != 0) {
+			t.Fatalf("unexpected has unconfirmed for %s: got %v", addr, got)
+		}
+		gotHashes := make(map[chainhash.Hash]struct{})
+		for _, tx := range idx.UnconfirmedTxnsForAddress(addr) {
+			gotHashes[*tx.Hash()] = struct{}{}
+		}
+		for _, tx := range want {
+			if _, ok := gotHashes[*tx.Hash()]; !ok {
+				t.Fatalf("missing unconfirmed tx %s for %s", tx.Hash(), addr)
+			}
+		}
+		if len(gotHashes) != len(want) {
+			t.Fatalf("unexpected number of unconfirmed txns for %s: got %d, "+
+				"want %d", addr, len(gotHashes), len(want))
+		}
+	}
+
+	// Ensure both the spent and paid addresses are tracked.
+	idx.AddUnconfirmedTx(tx, prevScripts, false)
+	idx.AddUnconfirmedTx(coinbase, testPrevScripter{}, false)
+	checkUnconfirmed(fromAddr, tx)
+	checkUnconfirmed(toAddr, tx, coinbase)
+
+	// Ensure adding the same transaction again does not result in duplicates.
+	idx.AddUnconfirmedTx(tx, prevScripts, false)
+	checkUnconfirmed(fromAddr, tx)
+	checkUnconfirmed(toAddr, tx, coinbase)
+
+	// Ensure removing a transaction only removes it from the addresses it
+	// involves and that removing it again is a no-op.
+	idx.RemoveUnconfirmedTx(tx.Hash())
+	checkUnconfirmed(fromAddr)
+	checkUnconfirmed(toAddr, coinbase)
+	idx.RemoveUnconfirmedTx(tx.Hash())
+	checkUnconfirmed(toAddr, coinbase)
+
+	// Ensure the memory maps are empty once all transactions are removed.
+	idx.RemoveUnconfirmedTx(coinbase.Hash())
+	checkUnconfirmed(toAddr)
+	if len(idx.txnsByAddr) != 0 || len(idx.addrsByTx) != 0 {
+		t.Fatalf("unconfirmed index not empty: %d addresses, %d txns",
+			len(idx.txnsByAddr), len(idx.addrsByTx))
+	}
+}
+
+// TestAddrIndexUnconfirmedTxnsForAddresses ensures querying the unconfirmed
+// transactions for multiple addresses returns the de-duplicated union of the
+// transactions that involve them.
+func TestAddrIndexUnconfirmedTxnsForAddresses(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconfmulti")
+	defer teardown()
+
+	// Create transactions such that the first only pays the first address,
+	// the second pays both addresses, and the third only pays an unrelated
+	// address.
+	addr1, addr2 := testP2PKHAddr(t, 0x01), testP2PKHAddr(t, 0x02)
+	otherAddr := testP2PKHAddr(t, 0x03)
+	_, script1 := addr1.PaymentScript()
+	_, script2 := addr2.PaymentScript()
+	_, otherScript := otherAddr.PaymentScript()
+	tx1 := dcrutil.NewTx(newTestCoinbase(1, script1))
+	tx2 := dcrutil.NewTx(newTestCoinbase(2, script1, script2))
+	tx3 := dcrutil.NewTx(newTestCoinbase(3, otherScript))
+	for _, tx := range []*dcrutil.Tx{tx1, tx2, tx3} {
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+	}
+
+	txns := idx.UnconfirmedTxnsForAddresses([]stdaddr.Address{addr1, addr2,
+		addr1})
+	if len(txns) != 2 {
+		t.Fatalf("unexpected number of txns: got %d, want 2", len(txns))
+	}
+	got := make(map[chainhash.Hash]struct{})
+	for _, tx := range txns {
+		got[*tx.Hash()] = struct{}{}
+	}
+	for _, tx := range []*dcrutil.Tx{tx1, tx2} {
+		if _, ok := got[*tx.Hash()]; !ok {
+			t.Fatalf("missing tx %v", tx.Hash())
+		}
+	}
+
+	if txns := idx.UnconfirmedTxnsForAddresses(nil); len(txns) != 0 {
+		t.Fatalf("unexpected txns for no addresses: %d", len(txns))
+	}
+}
+
+// TestAddrIndexAddressesForUnconfirmedTx ensures the addresses involved in an
+// unconfirmed transaction are reported correctly.
+func TestAddrIndexAddressesForUnconfirmedTx(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unconfaddrs")
+	defer teardown()
+
+	addr1, addr2 := testP2PKHAddr(t, 0x01), testP2PKHAddr(t, 0x02)
+	_, script1 := addr1.PaymentScript()
+	_, script2 := addr2.PaymentScript()
+	tx := dcrutil.NewTx(newTestCoinbase(1, script1, script2))
+	idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+
+	addrs := idx.AddressesForUnconfirmedTx(tx.Hash())
+	if len(addrs) != 2 {
+		t.Fatalf("unexpected number of addresses: got %d, want 2", len(addrs))
+	}
+	got := make(map[string]struct{})
+	for _, addr := range addrs {
+		got[addr.String()] = struct{}{}
+	}
+	for _, addr := range []stdaddr.Address{addr1, addr2} {
+		if _, ok := got[addr.String()]; !ok {
+			t.Fatalf("missing address %v", addr)
+		}
+	}
+
+	// Ensure unknown transactions do not return any addresses.
+	idx.RemoveUnconfirmedTx(tx.Hash())
+	if addrs := idx.AddressesForUnconfirmedTx(tx.Hash()); len(addrs) != 0 {
+		t.Fatalf("unexpected addresses for removed tx: %v", addrs)
+	}
+}
+
+// TestAddrIndexVerifyUnconfirmedAgainstConfirmed ensures the addresses of
+// unconfirmed transactions are consistent with the addresses of the same
+// transactions once they are connected in a block and that mismatches are
+// detected.
+func TestAddrIndexVerifyUnconfirmedAgainstConfirmed(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_verifyunconf")
+	defer teardown()
+
+	addr1 := testP2PKHAddr(t, 0x01)
+	addr2 := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	addr3 := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	_, script1 := addr1.PaymentScript()
+	_, script2 := addr2.PaymentScript()
+
+	// connectBlock connects the provided block to the address index along
+	// with storing it and adding its transactions to the transaction index.
+	connectBlock := func(block *dcrutil.Block, blockID uint32, prevScripts testPrevScripter) {
+		t.Helper()
+
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+			return dbAddTxIndexEntries(dbTx, block, blockID)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectTestBlock(t, idx, block, blockID, prevScripts, false)
+	}
+
+	// Connect a block with a coinbase that pays to the first address and add
+	// a transaction that spends it along with a ticket to the unconfirmed
+	// index.
+	coinbase := newTestCoinbase(1, script1)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase}, nil)
+	connectBlock(block1, 1, testPrevScripter{})
+	spentOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(&wire.TxIn{PreviousOutPoint: spentOut})
+	spendTx.AddTxOut(wire.NewTxOut(1e8, script2))
+	ticket := newTestTicket(chainhash.Hash{0x01}, addr2, addr3, 1e8)
+	prevScripts := testPrevScripter{spentOut: {script: script1}}
+	idx.AddUnconfirmedTx(dcrutil.NewTx(spendTx), prevScripts, false)
+	idx.AddUnconfirmedTx(dcrutil.NewTx(ticket), prevScripts, false)
+
+	// Ensure transactions that are not yet confirmed are rejected.
+	verify := func(hash chainhash.Hash) (bool, error) {
+		var matched bool
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			matched, err = idx.VerifyUnconfirmedAgainstConfirmed(dbTx, &hash)
+			return err
+		})
+		return matched, err
+	}
+	if _, err := verify(spendTx.TxHash()); err == nil {
+		t.Fatal("verified transaction that is not confirmed")
+	}
+
+	// Connect a block with both transactions and ensure their addresses match.
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{
+		newTestCoinbase(2), spendTx}, []*wire.MsgTx{ticket})
+	connectBlock(block2, 2, prevScripts)
+	for _, tx := range []*wire.MsgTx{spendTx, ticket} {
+		matched, err := verify(tx.TxHash())
+		if err != nil {
+			t.Fatalf("unable to verify tx %v: %v", tx.TxHash(), err)
+		}
+		if !matched {
+			t.Fatalf("mismatched addresses for tx %v", tx.TxHash())
+		}
+	}
+
+	// Ensure an unconfirmed transaction associated with an extra address is
+	// detected as a mismatch.
+	extraKey, err := addrToKey(addr3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.unconfirmedLock.Lock()
+	idx.addrsByTx[spendTx.TxHash()][extraKey] = struct{}{}
+	idx.unconfirmedLock.Unlock()
+	matched, err := verify(spendTx.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched {
+		t.Fatal("did not detect mismatched addresses")
+	}
+
+	// Ensure transactions that are not in the unconfirmed index are rejected.
+	idx.RemoveUnconfirmedTx(ticket.CachedTxHash())
+	if _, err := verify(ticket.TxHash()); err == nil {
+		t.Fatal("verified transaction that is not in the unconfirmed index")
+	}
+}
+
+// TestAddrIndexAddressesInBlock ensures the addresses the index associates with
+// each transaction in a block are reported along with the previous outputs they
+// spend and that they agree with the stored entries.
+func TestAddrIndexAddressesInBlock(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_addrsinblock")
+	defer teardown()
+
+	addr1 := testP2PKHAddr(t, 0x01)
+	addr2 := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	addr3 := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	_, script1 := addr1.PaymentScript()
+	_, script2 := addr2.PaymentScript()
+
+	// connectBlock connects the provided block to the address index along
+	// with storing it and adding its transactions to the transaction index.
+	connectBlock := func(block *dcrutil.Block, blockID uint32, prevScripts testPrevScripter) {
+		t.Helper()
+
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			if err := dbTx.StoreBlock(block); err != nil {
+				return err
+			}
+			return dbAddTxIndexEntries(dbTx, block, blockID)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		connectTestBlock(t, idx, block, blockID, prevScripts, false)
+	}
+
+	// Connect a block with a coinbase that pays to the first address followed
+	// by a block with a transaction that spends it along with a ticket.
+	coinbase := newTestCoinbase(1, script1)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{coinbase}, nil)
+	connectBlock(block1, 1, testPrevScripter{})
+	spentOut := wire.OutPoint{Hash: coinbase.TxHash(), Index: 1}
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(&wire.TxIn{PreviousOutPoint: spentOut})
+	spendTx.AddTxOut(wire.NewTxOut(1e8, script2))
+	ticket := newTestTicket(chainhash.Hash{0x01}, addr2, addr3, 1e8)
+	prevScripts := testPrevScripter{spentOut: {script: script1}}
+	block2 := newTestBlock(2, block1.Hash(), []*wire.MsgTx{
+		newTestCoinbase(2), spendTx}, []*wire.MsgTx{ticket})
+	connectBlock(block2, 2, prevScripts)
+
+	tests := []struct {
+		name  string
+		block *dcrutil.Block
+		want  map[chainhash.Hash][]stdaddr.Address
+	}{{
+		name:  "coinbase only",
+		block: block1,
+		want: map[chainhash.Hash][]stdaddr.Address{
+			coinbase.TxHash(): {addr1},
+		},
+	}, {
+		name:  "spend and ticket",
+		block: block2,
+		want: map[chainhash.Hash][]stdaddr.Address{
+			spendTx.TxHash(): {addr1, addr2},
+			ticket.TxHash():  {addr2, addr3},
+		},
+	}}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			got, err := idx.AddressesInBlock(dbTx, test.block.Hash())
+			if err != nil {
+				return fmt.Errorf("%s: %v", test.name, err)
+			}
+			if len(got) != len(test.want) {
+				return fmt.Errorf("%s: unexpected number of txns: got %d, "+
+					"want %d", test.name, len(got), len(test.want))
+			}
+			for txHash, wantAddrs := range test.want {
+				gotAddrs := got[txHash]
+				if len(gotAddrs) != len(wantAddrs) {
+					return fmt.Errorf("%s: unexpected number of addrs for "+
+						"tx %v: got %d, want %d", test.name, txHash,
+						len(gotAddrs), len(wantAddrs))
+				}
+				for i, addr := range gotAddrs {
+					if addr.String() != wantAddrs[i].String() {
+						return fmt.Errorf("%s: mismatched addr %d for tx "+
+							"%v: got %v, want %v", test.name, i, txHash,
+							addr, wantAddrs[i])
+					}
+
+					// Ensure the stored entries of the address include the
+					// transaction.
+					entries, _, err := idx.EntriesWithTxHashForAddress(dbTx,
+						addr, 0, 10, false)
+					if err != nil {
+						return err
+					}
+					var found bool
+					for _, entry := range entries {
+						found = found || entry.TxHash == txHash
+					}
+					if !found {
+						return fmt.Errorf("%s: tx %v not in entries for %v",
+							test.name, txHash, addr)
+					}
+				}
+			}
+		}
+
+		// Ensure unknown blocks are rejected.
+		_, err := idx.AddressesInBlock(dbTx, &chainhash.Hash{0xff})
+		if err == nil {
+			return fmt.Errorf("did not reject unknown block")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrKeyRoundTrip ensures converting addresses to address keys and back
+// works as expected for all supported address types including the collapse of
+// public key addresses into their public key hash form.
+func TestAddrKeyRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// mustDecodeHex decodes the passed hex string and fails the test if it is
+	// not valid.
+	mustDecodeHex := func(s string) []byte {
+		t.Helper()
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unable to decode hex %q: %v", s, err)
+		}
+		return b
+	}
+
+	params := chaincfg.MainNetParams()
+	hash160 := mustDecodeHex("2789d58cfa0957d206f025c2af056fc8a77cebb0")
+	secpPubKey := mustDecodeHex("0279be667ef9dcbbac55a06295ce870b07029bfcdb2" +
+		"dce28d959f2815b16f81798")
+	edPubKey := mustDecodeHex("cecc1507dc1ddd7295951c290888f095adb9044d1b73" +
+		"d696e6df065d683bd4fc")
+
+	tests := []struct {
+		name   string
+		makeFn func() (stdaddr.Address, error)
+		want   string // expected decoded address
+	}{{
+		name: "p2pkh-ecdsa-secp256k1",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyHashEcdsaSecp256k1V0(hash160, params)
+		},
+	}, {
+		name: "p2pkh-ed25519",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyHashEd25519V0(hash160, params)
+		},
+	}, {
+		name: "p2pkh-schnorr-secp256k1",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyHashSchnorrSecp256k1V0(hash160,
+				params)
+		},
+	}, {
+		name: "p2sh",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressScriptHashV0FromHash(hash160, params)
+		},
+	}, {
+		name: "p2pk-ecdsa-secp256k1",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(secpPubKey,
+				params)
+		},
+		want: "DsmcYVbP1Nmag2H4AS17UTvmWXmGeA7nLDx",
+	}, {
+		name: "p2pk-ed25519",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyEd25519V0Raw(edPubKey, params)
+		},
+	}, {
+		name: "p2pk-schnorr-secp256k1",
+		makeFn: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeySchnorrSecp256k1V0Raw(secpPubKey,
+				params)
+		},
+	}}
+
+	for _, test := range tests {
+		addr, err := test.makeFn()
+		if err != nil {
+			t.Fatalf("%s: unable to create address: %v", test.name, err)
+		}
+
+		// Determine the expected decoded address which is the public key
+		// hash variant for public key addresses.
+		want := addr.String()
+		if pkHasher, ok := addr.(stdaddr.AddressPubKeyHasher); ok {
+			want = pkHasher.AddressPubKeyHash().String()
+		}
+		if test.want != "" && test.want != want {
+			t.Fatalf("%s: unexpected p2pkh form: got %s, want %s", test.name,
+				want, test.want)
+		}
+
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error converting to key: %v", test.name,
+				err)
+		}
+		decoded, err := keyToAddr(addrKey, params)
+		if err != nil {
+			t.Fatalf("%s: unexpected error converting from key: %v",
+				test.name, err)
+		}
+		if decoded.String() != want {
+			t.Fatalf("%s: mismatched address: got %s, want %s", test.name,
+				decoded, want)
+		}
+
+		// Ensure converting the decoded address produces the same key.
+		decodedKey, err := addrToKey(decoded)
+		if err != nil {
+			t.Fatalf("%s: unexpected error converting decoded address to "+
+				"key: %v", test.name, err)
+		}
+		if decodedKey != addrKey {
+			t.Fatalf("%s: mismatched key: got %x, want %x", test.name,
+				decodedKey, addrKey)
+		}
+	}
+
+	// Ensure unsupported address key types are rejected.
+	var addrKey [addrKeySize]byte
+	addrKey[0] = addrKeyTypePubKeySchnorr + 1
+	if _, err := keyToAddr(addrKey, params); !errors.Is(err,
+		ErrUnsupportedAddressType) {
+
+		t.Fatalf("unexpected error for unsupported type: %v", err)
+	}
+}
+
+// testUnsupportedAddr is an implementation of stdaddr.Address for a type of
+// address that the address index does not support.
+type testUnsupportedAddr struct{}
+
+// String returns a placeholder encoding of the address.
+func (testUnsupportedAddr) String() string {
+	return "unsupported"
+}
+
+// PaymentScript returns an empty version 0 script.
+func (testUnsupportedAddr) PaymentScript() (uint16, []byte) {
+	return 0, nil
+}
+
+// TestAddrIndexUnsupportedAddressType ensures queries for addresses of types
+// the index does not support return an error that can be identified with
+// errors.Is.
+func TestAddrIndexUnsupportedAddressType(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_unsupportedaddr")
+	defer teardown()
+
+	addr := testUnsupportedAddr{}
+	err := idx.db.View(func(dbTx database.Tx) error {
+		_, _, err1 := idx.EntriesForAddress(dbTx, addr, 0, 10, false)
+		_, _, _, _, err2 := idx.EntriesForAddressAtTip(dbTx, addr, 0, 10,
+			false)
+		_, _, err3 := idx.EntriesForAddressEncoded(dbTx, addr, 0, 10, false)
+		_, err4 := idx.EntriesForAddressSinceHeight(dbTx, addr, 0)
+		_, err5 := idx.AllEntriesForAddress(dbTx, addr, 10)
+		for i, err := range []error{err1, err2, err3, err4, err5} {
+			if !errors.Is(err, ErrUnsupportedAddressType) {
+				return fmt.Errorf("query %d: unexpected error: got %v, "+
+					"want %v", i+1, err, ErrUnsupportedAddressType)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexEntriesByTree ensures entries record the tree of the
+// transaction they reference and that they can be filtered by it including
+// entries from prior versions of the index which have an unknown tree.
+func TestAddrIndexEntriesByTree(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_bytree")
+	defer teardown()
+
+	// Create a block with a coinbase in the regular tree that pays to the
+	// address and a transaction in the stake tree that spends from it.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	_, otherScript := testP2PKHAddr(t, 0x02).PaymentScript()
+	prevOut := wire.OutPoint{Hash: chainhash.Hash{0x01}}
+	stakeTx := wire.NewMsgTx()
+	stakeTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+	stakeTx.AddTxOut(wire.NewTxOut(1e8, otherScript))
+	prevScripts := testPrevScripter{prevOut: {script: pkScript}}
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, pkScript)},
+		[]*wire.MsgTx{stakeTx})
+	connectTestBlock(t, idx, block, 1, prevScripts, false)
+
+	// Add an entry without any tree flags to simulate an entry created by a
+	// prior version of the index.
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyTxLoc := wire.TxLoc{TxStart: 100, TxLen: 50}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		return dbPutAddrIndexEntry(bucket, addrKey, 1, legacyTxLoc, 5)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		tests := []struct {
+			tree      int8
+			wantIndex uint32
+		}{
+			{tree: wire.TxTreeRegular, wantIndex: 0},
+			{tree: wire.TxTreeStake, wantIndex: 0},
+			{tree: wire.TxTreeUnknown, wantIndex: 5},
+		}
+		for _, test := range tests {
+			entries, skipped, err := idx.EntriesForAddressByTree(dbTx, addr,
+				test.tree, 0, 10, false)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 1 || skipped != 0 {
+				return fmt.Errorf("tree %d: unexpected number of entries %d "+
+					"(skipped %d)", test.tree, len(entries), skipped)
+			}
+			if entries[0].Tree != test.tree {
+				return fmt.Errorf("tree %d: unexpected entry tree %d",
+					test.tree, entries[0].Tree)
+			}
+			if entries[0].BlockIndex != test.wantIndex {
+				return fmt.Errorf("tree %d: unexpected block index %d",
+					test.tree, entries[0].BlockIndex)
+			}
+
+			// Ensure skipping applies to the filtered entries.
+			entries, skipped, err = idx.EntriesForAddressByTree(dbTx, addr,
+				test.tree, 2, 10, true)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 0 || skipped != 1 {
+				return fmt.Errorf("tree %d: unexpected number of entries %d "+
+					"(skipped %d) when skipping", test.tree, len(entries),
+					skipped)
+			}
+		}
+
+		// Ensure the unfiltered query returns all entries.
+		entries, _, err := idx.EntriesForAddress(dbTx, addr, 0, 10, false)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 3 {
+			return fmt.Errorf("unexpected number of entries: got %d, want 3",
+				len(entries))
+		}
+
+		// Ensure invalid trees are rejected.
+		_, _, err = idx.EntriesForAddressByTree(dbTx, addr, 2, 0, 10, false)
+		if err == nil {
+			return errors.New("invalid tree was not rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexUpgradeToVersion3 ensures address indexes created by prior
+// versions are upgraded to version 3 with empty companion data buckets and that
+// the existing entries remain readable with an unknown tree, class, and input
+// indices.
+func TestAddrIndexUpgradeToVersion3(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_upgradev3")
+	defer teardown()
+
+	// Connect a block prior to the upgrade.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	block := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, pkScript)}, nil)
+	connectTestBlock(t, idx, block, 1, testPrevScripter{}, false)
+
+	// Downgrade the index by removing the companion data buckets, clearing
+	// the flags and version of the entry, and setting the version to 2.
+	bucketKeys := [][]byte{addrCommitmentIndexKey, addrTotalsIndexKey,
+		addrBlockTimeIndexKey, addrRewardSourceIndexKey,
+		addrUnindexedVersionIndexKey, addrDisapprovedIndexKey,
+		addrInputIndexKey}
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		for _, bucketKey := range bucketKeys {
+			if err := meta.DeleteBucket(bucketKey); err != nil {
+				return err
+			}
+		}
+		bucket := meta.Bucket(addrIndexKey)
+		levelKey := keyForLevel(addrKey, 0)
+		levelData := bucket.Get(levelKey[:])
+		if len(levelData) != txEntrySize {
+			return fmt.Errorf("unexpected level size: got %d, want %d",
+				len(levelData), txEntrySize)
+		}
+		legacy := make([]byte, len(levelData))
+		copy(legacy, levelData)
+		field := byteOrder.Uint32(legacy[8:12])
+		txLen, _ := decodeEntryTxLen(field)
+		byteOrder.PutUint32(legacy[8:12], encodeEntryTxLen(txLen,
+			entryVersionLegacy))
+		byteOrder.PutUint32(legacy[12:16], 0)
+		if err := bucket.Put(levelKey[:], legacy); err != nil {
+			return err
+		}
+		return dbPutIndexerVersion(dbTx, idx.Key(), 2)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.upgradeToVersion3(context.Background()); err != nil {
+		t.Fatalf("unexpected upgrade error: %v", err)
+	}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		version, err := dbFetchIndexerVersion(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if version != 3 {
+			return fmt.Errorf("unexpected version: got %d, want 3", version)
+		}
+		for _, bucketKey := range bucketKeys {
+			if dbTx.Metadata().Bucket(bucketKey) == nil {
+				return fmt.Errorf("bucket %s not created", bucketKey)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the existing entry remains readable and reports an unknown
+	// tree, class, and input indices.
+	idx.trackInputIndexes = true
+	entries, _, err := idx.EntriesForAddress(nil, addr, 0, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("unexpected number of entries: got %d, want 1", len(entries))
+	}
+	entry := entries[0]
+	if *entry.BlockRegion.Hash != *block.Hash() {
+		t.Fatalf("unexpected block hash: got %s, want %s",
+			entry.BlockRegion.Hash, block.Hash())
+	}
+	if entry.Tree != wire.TxTreeUnknown || entry.Class != TxClassUnknown ||
+		entry.StakeTags != 0 {
+
+		t.Fatalf("unexpected flags for legacy entry: tree %d, class %d, "+
+			"tags %#x", entry.Tree, entry.Class, entry.StakeTags)
+	}
+	if entry.InputIndexesKnown || entry.InputIndexes != nil {
+		t.Fatalf("unexpected input indices for legacy entry: known %v, "+
+			"indices %v", entry.InputIndexesKnown, entry.InputIndexes)
+	}
+}
+
+// TestAddrIndexEntryVersions ensures entries serialized with the legacy and
+// current versions coexist within the levels of an address and entries with
+// unsupported versions are rejected.
+func TestAddrIndexEntryVersions(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_entryversions")
+	defer teardown()
+
+	// Connect enough blocks that pay the address for its entries to span
+	// several levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	addr := testP2PKHAddr(t, 0x00)
+	addrKey, err := idx.keyForAddr(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fetchEntries returns all of the entries of the address.
+	fetchEntries := func() []TxIndexEntry {
+		t.Helper()
+
+		var entries []TxIndexEntry
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			entries, _, err = idx.EntriesForAddress(dbTx, addr, 0,
+				numBlocks*2, false)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	// countVersions returns the number of entries of the address that are
+	// serialized with each version.
+	countVersions := func() map[uint8]int {
+		t.Helper()
+
+		counts := make(map[uint8]int)
+		err := idx.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(addrIndexKey)
+			serialized := dbFetchAllSerializedAddrIndexEntries(bucket, addrKey)
+			for offset := 0; offset+txEntrySize <= len(serialized); offset +=
+				txEntrySize {
+
+				field := byteOrder.Uint32(serialized[offset+8 : offset+12])
+				_, version := decodeEntryTxLen(field)
+				counts[version]++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return counts
+	}
+
+	// Ensure all entries are written with the current version.
+	want := fetchEntries()
+	if len(want) != numBlocks {
+		t.Fatalf("unexpected number of entries: got %d, want %d", len(want),
+			numBlocks)
+	}
+	gotCounts := countVersions()
+	if !reflect.DeepEqual(gotCounts, map[uint8]int{entryVersion: numBlocks}) {
+		t.Fatalf("unexpected entry versions: %v", gotCounts)
+	}
+
+	// Downgrade every other entry of every level to the legacy version and
+	// ensure the mixed entries decode to the same values in the same order.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		for level := uint8(0); ; level++ {
+			levelKey := keyForLevel(addrKey, level)
+			levelData := bucket.Get(levelKey[:])
+			if levelData == nil {
+				return nil
+			}
+			downgraded := make([]byte, len(levelData))
+			copy(downgraded, levelData)
+			for offset := 0; offset+txEntrySize <= len(downgraded); offset +=
+				txEntrySize * 2 {
+
+				field := byteOrder.Uint32(downgraded[offset+8 : offset+12])
+				txLen, _ := decodeEntryTxLen(field)
+				byteOrder.PutUint32(downgraded[offset+8:offset+12],
+					encodeEntryTxLen(txLen, entryVersionLegacy))
+			}
+			if err := bucket.Put(levelKey[:], downgraded); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotCounts = countVersions()
+	if gotCounts[entryVersionLegacy] == 0 || gotCounts[entryVersion] == 0 {
+		t.Fatalf("entry versions are not mixed: %v", gotCounts)
+	}
+	if got := fetchEntries(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched mixed version entries:\ngot %v\nwant %v", got,
+			want)
+	}
+
+	// Ensure an entry with an unsupported version is rejected.
+	txLoc := wire.TxLoc{TxStart: 100, TxLen: 200}
+	serialized := serializeAddrIndexEntry(1, txLoc, 0)
+	byteOrder.PutUint32(serialized[8:12], encodeEntryTxLen(200,
+		entryVersion+1))
+	var entry TxIndexEntry
+	err = deserializeAddrIndexEntry(serialized, &entry,
+		func([]byte) (*chainhash.Hash, error) { return &chainhash.Hash{}, nil })
+	var dErr errDeserialize
+	if !errors.As(err, &dErr) {
+		t.Fatalf("unexpected error for unsupported version: %v", err)
+	}
+}
+
+// addTestBlocks extends the test chain associated with the provided address
+// index with the blocks and assigns sequential internal block IDs starting from
+// one to them without connecting them to the address index.
+func addTestBlocks(t testing.TB, idx *AddrIndex, blocks []*dcrutil.Block) {
+	t.Helper()
+
+	for i, block := range blocks {
+		err := idx.chain.(*testChain).AddBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = idx.db.Update(func(dbTx database.Tx) error {
+			return dbPutBlockIDIndexEntry(dbTx, block.Hash(), uint32(i+1))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestReindexBlocks returns the provided number of blocks that each pay to
+// several addresses shared among all blocks along with an address unique to
+// the block so the address index entries span multiple levels.
+func newTestReindexBlocks(t testing.TB, numBlocks int, genesisHash *chainhash.Hash) []*dcrutil.Block {
+	t.Helper()
+
+	var sharedScripts [][]byte
+	for i := 0; i < 4; i++ {
+		_, pkScript := testP2PKHAddr(t, byte(i)).PaymentScript()
+		sharedScripts = append(sharedScripts, pkScript)
+	}
+
+	blocks := make([]*dcrutil.Block, 0, numBlocks)
+	prevHash := genesisHash
+	for i := 0; i < numBlocks; i++ {
+		height := uint32(i + 1)
+		var uniqueHash [20]byte
+		byteOrder.PutUint32(uniqueHash[:], height)
+		uniqueAddr, err := stdaddr.NewAddressScriptHashV0FromHash(
+			uniqueHash[:], chaincfg.SimNetParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, uniqueScript := uniqueAddr.PaymentScript()
+		pkScripts := append([][]byte{uniqueScript}, sharedScripts...)
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScripts...)}, nil)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+	return blocks
+}
+
+// connectTestBlocksBatched connects the provided blocks, which must already
+// have been added via addTestBlocks, to the address index in batches of the
+// provided size.
+func connectTestBlocksBatched(t testing.TB, idx *AddrIndex, blocks []*dcrutil.Block, batchSize int) {
+	t.Helper()
+
+	for start := 0; start < len(blocks); start += batchSize {
+		end := start + batchSize
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		batch := make([]connectBlockData, 0, end-start)
+		for _, block := range blocks[start:end] {
+			batch = append(batch, connectBlockData{
+				block:       block,
+				prevScripts: testPrevScripter{},
+			})
+		}
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return idx.connectBlocks(dbTx, batch)
+		})
+		if err != nil {
+			t.Fatalf("unable to connect blocks: %v", err)
+		}
+	}
+}
+
+// dumpAddrIndex returns all of the key/value pairs in the address index bucket
+// along with the serialized index tip of the provided address index.
+func dumpAddrIndex(t testing.TB, idx *AddrIndex) map[string][]byte {
+	t.Helper()
+
+	results := make(map[string][]byte)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		err := bucket.ForEach(func(k, v []byte) error {
+			results[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		tipsBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		tip := tipsBucket.Get(idx.Key())
+		results["tip"] = append([]byte(nil), tip...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// recordingBucket is an implementation of internalBucket that records the
+// sequence of modifications made to an underlying bucket.
+type recordingBucket struct {
+	bucket internalBucket
+	ops    []string
+}
+
+// Get returns the value for the provided key from the underlying bucket.
+func (b *recordingBucket) Get(key []byte) []byte {
+	return b.bucket.Get(key)
+}
+
+// Put records the modification and stores the provided key/value pair in the
+// underlying bucket.
+func (b *recordingBucket) Put(key []byte, value []byte) error {
+	b.ops = append(b.ops, fmt.Sprintf("put %x %x", key, value))
+	return b.bucket.Put(key, value)
+}
+
+// Delete records the modification and removes the provided key from the
+// underlying bucket.
+func (b *recordingBucket) Delete(key []byte) error {
+	b.ops = append(b.ops, fmt.Sprintf("delete %x", key))
+	return b.bucket.Delete(key)
+}
+
+// TestAddrIndexDeterministicWrites ensures connecting the same block that pays
+// many addresses against fresh databases performs the same sequence of database
+// operations and results in identical bucket contents.
+func TestAddrIndexDeterministicWrites(t *testing.T) {
+	t.Parallel()
+
+	// Create a block with a coinbase that pays many addresses along with a
+	// transaction that pays a subset of them again.
+	var pkScripts [][]byte
+	for i := 0; i < 32; i++ {
+		_, pkScript := testP2PKHAddr(t, byte(i)).PaymentScript()
+		pkScripts = append(pkScripts, pkScript)
+	}
+	coinbase := newTestCoinbase(1, pkScripts...)
+	tx := wire.NewMsgTx()
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: coinbase.TxHash(), Index: 1},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	for _, pkScript := range pkScripts[8:24] {
+		tx.AddTxOut(wire.NewTxOut(1e8, pkScript))
+	}
+	genesisHash := chaincfg.SimNetParams().GenesisHash
+	block := newTestBlock(1, &genesisHash, []*wire.MsgTx{coinbase, tx}, nil)
+
+	var wantOps []string
+	var wantDump map[string][]byte
+	for i := 0; i < 2; i++ {
+		idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+			"deterministic_%d", i))
+		defer teardown()
+
+		// Connect the block while recording the modifications.
+		if err := idx.chain.(*testChain).AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		recorder := &recordingBucket{}
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			err := dbPutBlockIDIndexEntry(dbTx, block.Hash(), 1)
+			if err != nil {
+				return err
+			}
+			recorder.bucket = dbTx.Metadata().Bucket(addrIndexKey)
+			_, err = idx.putBlockEntries(dbTx, recorder, block,
+				testPrevScripter{}, false)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dump := dumpAddrIndex(t, idx)
+		if i == 0 {
+			wantOps, wantDump = recorder.ops, dump
+			continue
+		}
+
+		if !reflect.DeepEqual(recorder.ops, wantOps) {
+			t.Fatalf("mismatched database operations:\ngot %v\nwant %v",
+				recorder.ops, wantOps)
+		}
+		if !reflect.DeepEqual(dump, wantDump) {
+			t.Fatal("mismatched bucket contents")
+		}
+	}
+}
+
+// TestAddrIndexConnectBlocksBatched ensures connecting blocks in batches
+// produces an address index that is identical to connecting them one at a time.
+func TestAddrIndexConnectBlocksBatched(t *testing.T) {
+	t.Parallel()
+
+	const numBlocks = 75
+	individualIdx, teardown := newTestAddrIndex(t, "test_addrindex_single")
+	defer teardown()
+	blocks := newTestReindexBlocks(t, numBlocks,
+		&individualIdx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, individualIdx, block, uint32(i+1),
+			testPrevScripter{}, false)
+	}
+	want := dumpAddrIndex(t, individualIdx)
+
+	for _, batchSize := range []int{1, 7, 16, numBlocks} {
+		batchedIdx, teardown := newTestAddrIndex(t, "test_addrindex_batched")
+		addTestBlocks(t, batchedIdx, blocks)
+		connectTestBlocksBatched(t, batchedIdx, blocks, batchSize)
+		got := dumpAddrIndex(t, batchedIdx)
+		teardown()
+
+		if len(got) != len(want) {
+			t.Fatalf("batch size %d: mismatched number of keys: got %d, "+
+				"want %d", batchSize, len(got), len(want))
+		}
+		for k, wantV := range want {
+			if !bytes.Equal(got[k], wantV) {
+				t.Fatalf("batch size %d: mismatched data for key %x: got "+
+					"%x, want %x", batchSize, k, got[k], wantV)
+			}
+		}
+	}
+}
+
+// TestAddrIndexBuildFromTxIndex ensures building the address index from the
+// blocks known to the transaction index results in an index identical to one
+// built by connecting the blocks individually, including when the build
+// resumes from a partially built index.
+func TestAddrIndexBuildFromTxIndex(t *testing.T) {
+	t.Parallel()
+
+	const numBlocks = 75
+	individualIdx, teardown := newTestAddrIndex(t, "test_addrindex_single")
+	defer teardown()
+	blocks := newTestReindexBlocks(t, numBlocks,
+		&individualIdx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, individualIdx, block, uint32(i+1),
+			testPrevScripter{}, false)
+	}
+	want := dumpAddrIndex(t, individualIdx)
+
+	for _, numPrebuilt := range []int{0, 30, numBlocks} {
+		builtIdx, teardown := newTestAddrIndex(t, "test_addrindex_built")
+		builtIdx.consumer = NewSpendConsumer(builtIdx.Name(),
+			&builtIdx.chainParams.GenesisHash, builtIdx.chain)
+		addTestBlocks(t, builtIdx, blocks)
+		connectTestBlocksBatched(t, builtIdx, blocks[:numPrebuilt], 10)
+
+		// Ensure an interrupted build does not modify the index.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		before := dumpAddrIndex(t, builtIdx)
+		err := builtIdx.BuildFromTxIndex(ctx)
+		if !errors.Is(err, errInterruptRequested) {
+			teardown()
+			t.Fatalf("%d prebuilt: unexpected error for interrupted build: "+
+				"got %v, want %v", numPrebuilt, err, errInterruptRequested)
+		}
+		if !reflect.DeepEqual(dumpAddrIndex(t, builtIdx), before) {
+			teardown()
+			t.Fatalf("%d prebuilt: interrupted build modified the index",
+				numPrebuilt)
+		}
+
+		err = builtIdx.BuildFromTxIndex(context.Background())
+		got := dumpAddrIndex(t, builtIdx)
+		consumerTip := builtIdx.consumer.Tip()
+		teardown()
+		if err != nil {
+			t.Fatalf("%d prebuilt: unexpected error: %v", numPrebuilt, err)
+		}
+		if numPrebuilt != numBlocks &&
+			*consumerTip != *blocks[numBlocks-1].Hash() {
+
+			t.Fatalf("%d prebuilt: unexpected spend consumer tip: got %v, "+
+				"want %v", numPrebuilt, consumerTip, blocks[numBlocks-1].Hash())
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("%d prebuilt: mismatched number of keys: got %d, want "+
+				"%d", numPrebuilt, len(got), len(want))
+		}
+		for k, wantV := range want {
+			if !bytes.Equal(got[k], wantV) {
+				t.Fatalf("%d prebuilt: mismatched data for key %x: got %x, "+
+					"want %x", numPrebuilt, k, got[k], wantV)
+			}
+		}
+	}
+}
+
+// TestAddrIndexCatchUpBatches ensures initializing the address index with a
+// catch up batch size connects the blocks known to the transaction index in
+// batches and that a batch that fails partway through is not partially
+// committed and is connected again on the next initialization.
+func TestAddrIndexCatchUpBatches(t *testing.T) {
+	t.Parallel()
+
+	const numBlocks = 25
+	individualIdx, teardown := newTestAddrIndex(t, "test_addrindex_single")
+	defer teardown()
+	blocks := newTestReindexBlocks(t, numBlocks,
+		&individualIdx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, individualIdx, block, uint32(i+1),
+			testPrevScripter{}, false)
+	}
+	want := dumpAddrIndex(t, individualIdx)
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_catchup")
+	defer teardown()
+	idx.catchUpBatchSize = 10
+	idx.consumer = NewSpendConsumer(idx.Name(), &idx.chainParams.GenesisHash,
+		idx.chain)
+	addTestBlocks(t, idx, blocks)
+
+	// Simulate a crash partway through the second batch by making one of its
+	// blocks unavailable.
+	chain := idx.chain.(*testChain)
+	missing := blocks[14]
+	chain.mtx.Lock()
+	delete(chain.keyedByHash, missing.Hash().String())
+	chain.mtx.Unlock()
+	err := idx.Init(context.Background(), idx.chainParams)
+	if err == nil {
+		t.Fatal("initialization with a missing block did not fail")
+	}
+	tipHeight, tipHash, err := idx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != 10 || *tipHash != *blocks[9].Hash() {
+		t.Fatalf("unexpected tip after interrupted catch up: got %v (%d), "+
+			"want %v (10)", tipHash, tipHeight, blocks[9].Hash())
+	}
+	if consumerTip := idx.consumer.Tip(); *consumerTip != *tipHash {
+		t.Fatalf("unexpected spend consumer tip after interrupted catch "+
+			"up: got %v, want %v", consumerTip, tipHash)
+	}
+
+	// Ensure initializing again once the block is available connects the
+	// incomplete batch along with the remaining blocks.
+	chain.mtx.Lock()
+	chain.keyedByHash[missing.Hash().String()] = missing
+	chain.mtx.Unlock()
+	if err := idx.Init(context.Background(), idx.chainParams); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantTip := blocks[numBlocks-1].Hash()
+	if consumerTip := idx.consumer.Tip(); *consumerTip != *wantTip {
+		t.Fatalf("unexpected spend consumer tip: got %v, want %v",
+			consumerTip, wantTip)
+	}
+	got := dumpAddrIndex(t, idx)
+	if len(got) != len(want) {
+		t.Fatalf("mismatched number of keys: got %d, want %d", len(got),
+			len(want))
+	}
+	for k, wantV := range want {
+		if !bytes.Equal(got[k], wantV) {
+			t.Fatalf("mismatched data for key %x: got %x, want %x", k,
+				got[k], wantV)
+		}
+	}
+}
+
+// BenchmarkAddrIndexConnectBlocks benchmarks connecting blocks to the address
+// index one at a time as compared to connecting them in batches as is done
+// when reindexing.
+func BenchmarkAddrIndexConnectBlocks(b *testing.B) {
+	const numBlocks = 500
+	genesisHash := chaincfg.SimNetParams().GenesisHash
+	blocks := newTestReindexBlocks(b, numBlocks, &genesisHash)
+
+	for _, batchSize := range []int{1, 100} {
+		name := fmt.Sprintf("batch size %d", batchSize)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				idx, teardown := newTestAddrIndex(b, "bench_addrindex_connect")
+				addTestBlocks(b, idx, blocks)
+				b.StartTimer()
+
+				connectTestBlocksBatched(b, idx, blocks, batchSize)
+
+				b.StopTimer()
+				teardown()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// newTestMergeBlockData returns write index data for a block that involves the
+// provided number of distinct addresses with varying numbers of transactions
+// along with transaction locations that cover all of the transactions.  The
+// provided seed varies the addresses and the number of transactions for each
+// of them.
+func newTestMergeBlockData(numAddrs, seed int) (writeIndexData, []wire.TxLoc, []wire.TxLoc) {
+	const numRegularTxns, numStakeTxns = 40, 10
+	txLocs := make([]wire.TxLoc, numRegularTxns)
+	stakeTxLocs := make([]wire.TxLoc, numStakeTxns)
+	for i := range txLocs {
+		txLocs[i] = wire.TxLoc{TxStart: 200 + i*250, TxLen: 250}
+	}
+	for i := range stakeTxLocs {
+		stakeTxLocs[i] = wire.TxLoc{TxStart: 20000 + i*300, TxLen: 300}
+	}
+
+	data := make(writeIndexData)
+	for i := 0; i < numAddrs; i++ {
+		var addrKey [addrKeySize]byte
+		addrKey[0] = addrKeyTypePubKeyHash
+		byteOrder.PutUint32(addrKey[1:], uint32(i*(seed%3+1)))
+		numTxns := (i+seed)%(level0MaxEntries*2) + 1
+		for j := 0; j < numTxns; j++ {
+			txIdx := (i + j) % (numRegularTxns + numStakeTxns)
+			data[addrKey] = append(data[addrKey], indexedTx{txIdx: txIdx})
+		}
+	}
+	return data, txLocs, stakeTxLocs
+}
+
+// TestAddrIndexParallelMerge ensures computing the merges for the entries of
+// the addresses of a block concurrently produces the same results as computing
+// them sequentially.
+func TestAddrIndexParallelMerge(t *testing.T) {
+	t.Parallel()
+
+	seqBucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	parBucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	for blockID := uint32(1); blockID <= 20; blockID++ {
+		data, txLocs, stakeTxLocs := newTestMergeBlockData(300, int(blockID))
+		addrKeys := data.sortedKeys()
+		for _, addrKey := range addrKeys {
+			err := dbPutAddrBlockEntries(seqBucket, addrKey, blockID,
+				data[addrKey], txLocs, stakeTxLocs)
+			if err != nil {
+				t.Fatalf("unexpected sequential merge error: %v", err)
+			}
+		}
+		err := dbPutAddrBlockEntriesParallel(parBucket, data, addrKeys, blockID,
+			txLocs, stakeTxLocs)
+		if err != nil {
+			t.Fatalf("unexpected parallel merge error: %v", err)
+		}
+
+		if !reflect.DeepEqual(parBucket.levels, seqBucket.levels) {
+			t.Fatalf("mismatched levels after block %d", blockID)
+		}
+	}
+}
+
+// BenchmarkAddrIndexParallelMerge benchmarks computing the merges for the
+// entries of the addresses of a large block sequentially as compared to
+// concurrently.
+func BenchmarkAddrIndexParallelMerge(b *testing.B) {
+	// Populate multiple levels for all of the addresses prior to the block
+	// being benchmarked.
+	const numAddrs = 4000
+	bucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	for blockID := uint32(1); blockID <= 20; blockID++ {
+		data, txLocs, stakeTxLocs := newTestMergeBlockData(numAddrs, 0)
+		err := dbPutAddrBlockEntriesParallel(bucket, data, data.sortedKeys(),
+			blockID, txLocs, stakeTxLocs)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	data, txLocs, stakeTxLocs := newTestMergeBlockData(numAddrs, 0)
+	addrKeys := data.sortedKeys()
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			batch := newWriteBatchBucket(bucket)
+			for _, addrKey := range addrKeys {
+				err := dbPutAddrBlockEntries(batch, addrKey, 21, data[addrKey],
+					txLocs, stakeTxLocs)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			batch := newWriteBatchBucket(bucket)
+			err := dbPutAddrBlockEntriesParallel(batch, data, addrKeys, 21,
+				txLocs, stakeTxLocs)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestAddrIndexBatchedRemoval ensures removing the entries for the addresses of
+// a block in a single batch produces the same results as removing them for
+// each address individually.
+func TestAddrIndexBatchedRemoval(t *testing.T) {
+	t.Parallel()
+
+	const numBlocks = 20
+	seqBucket := &addrIndexBucket{levels: make(map[[levelKeySize]byte][]byte)}
+	blockData := make([]writeIndexData, 0, numBlocks)
+	for blockID := uint32(1); blockID <= numBlocks; blockID++ {
+		data, txLocs, stakeTxLocs := newTestMergeBlockData(300, int(blockID))
+		err := dbPutAddrBlockEntriesParallel(seqBucket, data, data.sortedKeys(),
+			blockID, txLocs, stakeTxLocs)
+		if err != nil {
+			t.Fatalf("unexpected merge error: %v", err)
+		}
+		blockData = append(blockData, data)
+	}
+	batchBucket := seqBucket.Clone()
+
+	// Remove the entries of each block from newest to oldest.
+	for i := numBlocks - 1; i >= 0; i-- {
+		data := blockData[i]
+		addrKeys := data.sortedKeys()
+		for _, addrKey := range addrKeys {
+			err := dbRemoveAddrIndexEntries(seqBucket, addrKey,
+				len(data[addrKey]))
+			if err != nil {
+				t.Fatalf("unexpected individual removal error: %v", err)
+			}
+		}
+		err := dbRemoveAddrBlockEntries(batchBucket, data, addrKeys)
+		if err != nil {
+			t.Fatalf("unexpected batched removal error: %v", err)
+		}
+
+		if !reflect.DeepEqual(batchBucket.levels, seqBucket.levels) {
+			t.Fatalf("mismatched levels after removing block %d", i+1)
+		}
+	}
+	if len(batchBucket.levels) != 0 {
+		t.Fatalf("%d levels remain after removing all entries",
+			len(batchBucket.levels))
+	}
+
+	// Ensure attempting to remove more entries than exist is rejected.
+	data, _, _ := newTestMergeBlockData(1, 0)
+	err := dbRemoveAddrBlockEntries(batchBucket, data, data.sortedKeys())
+	var aErr AssertError
+	if !errors.As(err, &aErr) {
+		t.Fatalf("unexpected error removing nonexistent entries: %v", err)
+	}
+}
+
+// BenchmarkAddrIndexDisconnectBlock benchmarks removing the entries for the
+// addresses of a large block from the address index database for each address
+// individually as compared to in a single batch as is done when disconnecting
+// blocks.
+func BenchmarkAddrIndexDisconnectBlock(b *testing.B) {
+	idx, teardown := newTestAddrIndex(b, "bench_addrindex_disconnect")
+	defer teardown()
+
+	// Populate multiple levels for all of the addresses including those of the
+	// block being benchmarked.
+	const numAddrs, numBlocks = 4000, 20
+	data, txLocs, stakeTxLocs := newTestMergeBlockData(numAddrs, 0)
+	addrKeys := data.sortedKeys()
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		for blockID := uint32(1); blockID <= numBlocks; blockID++ {
+			err := dbPutAddrBlockEntriesParallel(bucket, data, addrKeys,
+				blockID, txLocs, stakeTxLocs)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// benchRemoval runs the provided removal function against a writable
+	// database transaction that is rolled back afterwards so every iteration
+	// starts from the same state.
+	benchRemoval := func(b *testing.B, remove func(bucket internalBucket) error) {
+		for i := 0; i < b.N; i++ {
+			dbTx, err := idx.db.Begin(true)
+			if err != nil {
+				b.Fatal(err)
+			}
+			err = remove(dbTx.Metadata().Bucket(addrIndexKey))
+			if rollbackErr := dbTx.Rollback(); rollbackErr != nil {
+				b.Fatal(rollbackErr)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("per address", func(b *testing.B) {
+		benchRemoval(b, func(bucket internalBucket) error {
+			for _, addrKey := range addrKeys {
+				err := dbRemoveAddrIndexEntries(bucket, addrKey,
+					len(data[addrKey]))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		benchRemoval(b, func(bucket internalBucket) error {
+			return dbRemoveAddrBlockEntries(bucket, data, addrKeys)
+		})
+	})
+}
+
+// TestAddrIndexRecentEntriesForAddresses ensures the most recent entries across
+// multiple addresses are merged in order from newest to oldest and limited to
+// the requested number.
+func TestAddrIndexRecentEntriesForAddresses(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_recent")
+	defer teardown()
+
+	// Connect enough blocks for the shared addresses to span multiple levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 10)
+
+	// uniqueAddr returns the unique address paid by the block at the provided
+	// height.
+	uniqueAddr := func(height uint32) stdaddr.Address {
+		var hash160 [20]byte
+		byteOrder.PutUint32(hash160[:], height)
+		addr, err := stdaddr.NewAddressScriptHashV0FromHash(hash160[:],
+			chaincfg.SimNetParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	type wantEntry struct {
+		addr   stdaddr.Address
+		height int64
+	}
+	sharedAddr := testP2PKHAddr(t, 0)
+	tests := []struct {
+		name         string
+		addrs        []stdaddr.Address
+		numRequested uint32
+		want         []wantEntry
+	}{{
+		name:         "none requested",
+		addrs:        []stdaddr.Address{sharedAddr},
+		numRequested: 0,
+		want:         nil,
+	}, {
+		name:         "unique addresses with unknown address",
+		addrs:        []stdaddr.Address{uniqueAddr(5), uniqueAddr(38), uniqueAddr(numBlocks + 1)},
+		numRequested: 10,
+		want:         []wantEntry{{uniqueAddr(38), 38}, {uniqueAddr(5), 5}},
+	}, {
+		name:         "shared and unique addresses",
+		addrs:        []stdaddr.Address{uniqueAddr(38), sharedAddr, uniqueAddr(5)},
+		numRequested: 4,
+		want: []wantEntry{{sharedAddr, 40}, {sharedAddr, 39},
+			{uniqueAddr(38), 38}, {sharedAddr, 38}},
+	}, {
+		name:         "duplicate addresses",
+		addrs:        []stdaddr.Address{uniqueAddr(7), uniqueAddr(7)},
+		numRequested: 10,
+		want:         []wantEntry{{uniqueAddr(7), 7}},
+	}}
+
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			entries, err := idx.RecentEntriesForAddresses(dbTx, test.addrs,
+				test.numRequested)
+			if err != nil {
+				return fmt.Errorf("%s: %v", test.name, err)
+			}
+			if len(entries) != len(test.want) {
+				return fmt.Errorf("%s: unexpected number of entries: got %d, "+
+					"want %d", test.name, len(entries), len(test.want))
+			}
+			for i, entry := range entries {
+				want := test.want[i]
+				if entry.Address.String() != want.addr.String() ||
+					entry.BlockHeight != want.height {
+
+					return fmt.Errorf("%s: unexpected entry %d: got %s at "+
+						"height %d, want %s at height %d", test.name, i,
+						entry.Address, entry.BlockHeight, want.addr,
+						want.height)
+				}
+				wantHash := blocks[want.height-1].Hash()
+				if *entry.BlockRegion.Hash != *wantHash {
+					return fmt.Errorf("%s: unexpected block hash for entry "+
+						"%d: got %s, want %s", test.name, i,
+						entry.BlockRegion.Hash, wantHash)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestAddrIndexRetentionWindow ensures the entries that reference blocks which
+// are no longer within the retention window are pruned as blocks are connected
+// both individually and in batches while the levels remain valid.
+func TestAddrIndexRetentionWindow(t *testing.T) {
+	t.Parallel()
+
+	// uniqueAddr returns the unique address paid by the block at the provided
+	// height.
+	uniqueAddr := func(height uint32) stdaddr.Address {
+		var hash160 [20]byte
+		byteOrder.PutUint32(hash160[:], height)
+		addr, err := stdaddr.NewAddressScriptHashV0FromHash(hash160[:],
+			chaincfg.SimNetParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	const numBlocks = 60
+	for _, retentionWindow := range []uint32{0, 25} {
+		for _, batchSize := range []int{1, 7} {
+			name := fmt.Sprintf("window %d batch size %d", retentionWindow,
+				batchSize)
+			idx, teardown := newTestAddrIndex(t, fmt.Sprintf("test_addrindex_"+
+				"retention_%d_%d", retentionWindow, batchSize))
+			defer teardown()
+			idx.retentionWindow = retentionWindow
+
+			blocks := newTestReindexBlocks(t, numBlocks,
+				&idx.chainParams.GenesisHash)
+			addTestBlocks(t, idx, blocks)
+			connectTestBlocksBatched(t, idx, blocks, batchSize)
+
+			// Ensure only the unique addresses of the blocks within the window
+			// have entries.
+			oldestHeight := uint32(1)
+			if retentionWindow != 0 {
+				oldestHeight = numBlocks - retentionWindow + 1
+			}
+			for height := uint32(1); height <= numBlocks; height++ {
+				entries, _, err := idx.EntriesForAddress(nil,
+					uniqueAddr(height), 0, 10, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantEntries := 1
+				if height < oldestHeight {
+					wantEntries = 0
+				}
+				if len(entries) != wantEntries {
+					t.Fatalf("%s: unexpected number of entries for height %d: "+
+						"got %d, want %d", name, height, len(entries),
+						wantEntries)
+				}
+			}
+
+			// Ensure the shared addresses only have entries for the blocks
+			// within the window and their levels are valid.
+			for i := 0; i < 4; i++ {
+				addr := testP2PKHAddr(t, byte(i))
+				entries, _, err := idx.EntriesForAddress(nil, addr, 0,
+					numBlocks, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				wantEntries := int(numBlocks - oldestHeight + 1)
+				if len(entries) != wantEntries {
+					t.Fatalf("%s: unexpected number of entries for %s: got "+
+						"%d, want %d", name, addr, len(entries), wantEntries)
+				}
+				wantHash := blocks[oldestHeight-1].Hash()
+				if *entries[0].BlockRegion.Hash != *wantHash {
+					t.Fatalf("%s: unexpected oldest entry block for %s: got "+
+						"%s, want %s", name, addr, entries[0].BlockRegion.Hash,
+						wantHash)
+				}
+
+				addrKey, err := addrToKey(addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = idx.db.View(func(dbTx database.Tx) error {
+					bucket := dbTx.Metadata().Bucket(addrIndexKey)
+					return dbCheckAddrIndexEntries(dbTx, bucket, addrKey)
+				})
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+		}
+	}
+}
+
+// TestAddrIndexRetentionWindowCompanions ensures the ticket commitment amounts,
+// reward sources, input indices, and address totals recorded for blocks that
+// are no longer within the retention window are pruned along with their
+// entries exactly once, even when the block that caused them to fall out of the
+// window is disconnected and replaced.
+func TestAddrIndexRetentionWindowCompanions(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_retention_companions")
+	defer teardown()
+	idx.retentionWindow = 1
+	idx.trackTotals = true
+	idx.trackInputIndexes = true
+	idx.indexRewardSources = true
+
+	addrA, addrB := testP2PKHAddr(t, 0x0a), testP2PKHAddr(t, 0x0b)
+	votingAddr := testP2PKHAddr(t, 0x01).(stdaddr.StakeAddress)
+	commitAddr := testP2PKHAddr(t, 0x02).(stdaddr.StakeAddress)
+	rewardAddr := testP2PKHAddr(t, 0x03).(stdaddr.StakeAddress)
+	_, scriptA := addrA.PaymentScript()
+	_, scriptB := addrB.PaymentScript()
+
+	// checkCompanions ensures the number of keys in each of the companion
+	// buckets, the presence of the input indices marker for the first block,
+	// and the totals for the provided address match the expected values.
+	checkCompanions := func(block *dcrutil.Block, wantCommitments,
+		wantRewardSources int, wantMarker bool, addr stdaddr.Address,
+		wantCredited dcrutil.Amount) {
+
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			meta := dbTx.Metadata()
+			countKeys := func(bucketKey []byte) int {
+				var numKeys int
+				meta.Bucket(bucketKey).ForEach(func(k, v []byte) error {
+					numKeys++
+					return nil
+				})
+				return numKeys
+			}
+			if got := countKeys(addrCommitmentIndexKey); got != wantCommitments {
+				t.Fatalf("unexpected number of ticket commitments: got %d, "+
+					"want %d", got, wantCommitments)
+			}
+			got := countKeys(addrRewardSourceIndexKey)
+			if got != wantRewardSources {
+				t.Fatalf("unexpected number of reward sources: got %d, "+
+					"want %d", got, wantRewardSources)
+			}
+			marker := meta.Bucket(addrInputIndexKey).Get(block.Hash()[:])
+			if (marker != nil) != wantMarker {
+				t.Fatalf("unexpected input indices marker: got %x, want "+
+					"marker %v", marker, wantMarker)
+			}
+			credited, _, err := idx.AddressTotals(dbTx, addr)
+			if err != nil {
+				return err
+			}
+			if credited != wantCredited {
+				t.Fatalf("unexpected credited total for %s: got %v, want %v",
+					addr, credited, wantCredited)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Connect a block that pays the first address along with a ticket
+	// purchase and a vote.
+	ticket := newTestTicket(chainhash.Hash{0x01}, votingAddr, commitAddr, 1e8)
+	vote := newTestVote(t, idx.chainParams, chainhash.Hash{0x02}, rewardAddr)
+	block1 := newTestBlock(1, &idx.chainParams.GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1, scriptA)},
+		[]*wire.MsgTx{ticket, vote})
+	connectTestBlock(t, idx, block1, 1, testPrevScripter{}, false)
+	checkCompanions(block1, 1, 1, true, addrA, 1e8)
+
+	// Ensure connecting a block that causes the first block to fall out of
+	// the window prunes the data recorded for it.
+	block2 := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2, scriptB)}, nil)
+	connectTestBlock(t, idx, block2, 2, testPrevScripter{}, false)
+	checkCompanions(block1, 0, 0, false, addrA, 0)
+	checkCompanions(block1, 0, 0, false, addrB, 1e8)
+
+	// Ensure disconnecting the block that caused the first block to fall out
+	// of the window and connecting another one at the same height in its
+	// place, as happens during a reorganization, does not prune the data of
+	// the first block again.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block2, block1, testPrevScripter{},
+			false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.chain.(*testChain).RemoveBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	checkCompanions(block1, 0, 0, false, addrA, 0)
+	checkCompanions(block1, 0, 0, false, addrB, 0)
+	block2a := newTestBlock(2, block1.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(3, scriptA, scriptB)}, nil)
+	connectTestBlock(t, idx, block2a, 3, testPrevScripter{}, false)
+	checkCompanions(block1, 0, 0, false, addrA, 1e8)
+	checkCompanions(block1, 0, 0, false, addrB, 1e8)
+}
+
+// BenchmarkAddrIndexRecentEntriesForAddresses benchmarks fetching the most
+// recent entries across multiple addresses as compared to the naive approach
+// of fetching and merging the full histories of the addresses.
+func BenchmarkAddrIndexRecentEntriesForAddresses(b *testing.B) {
+	idx, teardown := newTestAddrIndex(b, "bench_addrindex_recent")
+	defer teardown()
+
+	const numBlocks = 2000
+	const numRequested = 10
+	blocks := newTestReindexBlocks(b, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(b, idx, blocks)
+	connectTestBlocksBatched(b, idx, blocks, 500)
+	var addrs []stdaddr.Address
+	for i := 0; i < 4; i++ {
+		addrs = append(addrs, testP2PKHAddr(b, byte(i)))
+	}
+
+	b.Run("recent", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := idx.db.View(func(dbTx database.Tx) error {
+				_, err := idx.RecentEntriesForAddresses(dbTx, addrs,
+					numRequested)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := idx.db.View(func(dbTx database.Tx) error {
+				var results []AddressTxIndexEntry
+				for _, addr := range addrs {
+					entries, _, err := idx.EntriesForAddress(dbTx, addr, 0,
+						math.MaxUint32, false)
+					if err != nil {
+						return err
+					}
+					for _, entry := range entries {
+						height, err := idx.chain.BlockHeightByHash(
+							entry.BlockRegion.Hash)
+						if err != nil {
+							return err
+						}
+						results = append(results, AddressTxIndexEntry{
+							TxIndexEntry: entry,
+							Address:      addr,
+							BlockHeight:  height,
+						})
+					}
+				}
+				sort.SliceStable(results, func(i, j int) bool {
+					return results[i].BlockHeight > results[j].BlockHeight
+				})
+				if len(results) > numRequested {
+					results = results[:numRequested]
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestAddrIndexAddressesWithHash160Prefix ensures searching for addresses by
+// a prefix of their hash160 returns the expected unique address keys.
+func TestAddrIndexAddressesWithHash160Prefix(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_prefix")
+	defer teardown()
+
+	// Create addresses that share prefixes of varying lengths along with a
+	// script hash address with the same hash160 as one of them.
+	hashes := [][]byte{
+		append([]byte{0xab, 0xcd, 0x01}, bytes.Repeat([]byte{0}, 17)...),
+		append([]byte{0xab, 0xcd, 0x02}, bytes.Repeat([]byte{0}, 17)...),
+		append([]byte{0xab, 0xce, 0x01}, bytes.Repeat([]byte{0}, 17)...),
+		append([]byte{0xac, 0x00, 0x00}, bytes.Repeat([]byte{0}, 17)...),
+	}
+	params := chaincfg.SimNetParams()
+	var pkScripts [][]byte
+	for _, hash := range hashes {
+		addr, err := stdaddr.NewAddressPubKeyHashEcdsaSecp256k1V0(hash, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, pkScript := addr.PaymentScript()
+		pkScripts = append(pkScripts, pkScript)
+	}
+	p2sh, err := stdaddr.NewAddressScriptHashV0FromHash(hashes[0], params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p2shScript := p2sh.PaymentScript()
+	pkScripts = append(pkScripts, p2shScript)
+
+	// Connect enough blocks for the first address to have multiple levels.
+	prevHash := &params.GenesisHash
+	for height := uint32(1); height <= level0MaxEntries+1; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScripts...)}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	tests := []struct {
+		name     string
+		typeByte byte
+		prefix   []byte
+		max      int
+		want     [][]byte // expected hash160s
+	}{{
+		name:     "two byte prefix",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   []byte{0xab, 0xcd},
+		max:      10,
+		want:     hashes[0:2],
+	}, {
+		name:     "one byte prefix",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   []byte{0xab},
+		max:      10,
+		want:     hashes[0:3],
+	}, {
+		name:     "one byte prefix limited",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   []byte{0xab},
+		max:      2,
+		want:     hashes[0:2],
+	}, {
+		name:     "full hash",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   hashes[3],
+		max:      10,
+		want:     hashes[3:4],
+	}, {
+		name:     "script hash type",
+		typeByte: addrKeyTypeScriptHash,
+		prefix:   []byte{0xab},
+		max:      10,
+		want:     hashes[0:1],
+	}, {
+		name:     "no matches",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   []byte{0xff},
+		max:      10,
+		want:     nil,
+	}, {
+		name:     "zero max",
+		typeByte: addrKeyTypePubKeyHash,
+		prefix:   []byte{0xab},
+		max:      0,
+		want:     nil,
+	}}
+
+	err = idx.db.View(func(dbTx database.Tx) error {
+		for _, test := range tests {
+			keys, err := idx.AddressesWithHash160Prefix(dbTx, test.typeByte,
+				test.prefix, test.max)
+			if err != nil {
+				return fmt.Errorf("%s: unexpected error: %v", test.name, err)
+			}
+			if len(keys) != len(test.want) {
+				return fmt.Errorf("%s: unexpected number of keys: got %d, "+
+					"want %d", test.name, len(keys), len(test.want))
+			}
+			for i, key := range keys {
+				if key[0] != test.typeByte || !bytes.Equal(key[1:],
+					test.want[i]) {
+
+					return fmt.Errorf("%s: unexpected key %d: %x", test.name,
+						i, key)
+				}
+			}
+		}
+
+		// Ensure prefixes longer than a hash160 are rejected.
+		_, err := idx.AddressesWithHash160Prefix(dbTx, addrKeyTypePubKeyHash,
+			make([]byte, 21), 10)
+		if err == nil {
+			return errors.New("overly long prefix was not rejected")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testMetrics is an in-memory implementation of the Metrics interface that
+// records the calls made to it.
+type testMetrics struct {
+	mtx             sync.Mutex
+	connectedBlocks int
+	fetchCalls      int
+	entriesFetched  int
+	entriesRemoved  int
+}
+
+// Ensure the testMetrics type implements the Metrics interface.
+var _ Metrics = (*testMetrics)(nil)
+
+// IncConnectedBlocks records a connected block.
+//
+// This is part of the Metrics interface.
+func (m *testMetrics) IncConnectedBlocks() {
+	m.mtx.Lock()
+	m.connectedBlocks++
+	m.mtx.Unlock()
+}
+
+// ObserveEntriesFetched records the number of fetched entries.
+//
+// This is part of the Metrics interface.
+func (m *testMetrics) ObserveEntriesFetched(numEntries int) {
+	m.mtx.Lock()
+	m.fetchCalls++
+	m.entriesFetched += numEntries
+	m.mtx.Unlock()
+}
+
+// IncRemovedEntries records the number of removed entries.
+//
+// This is part of the Metrics interface.
+func (m *testMetrics) IncRemovedEntries(numEntries int) {
+	m.mtx.Lock()
+	m.entriesRemoved += numEntries
+	m.mtx.Unlock()
+}
+
+// TestAddrIndexMetrics ensures the address index invokes the provided metrics
+// implementation as expected.
+func TestAddrIndexMetrics(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_metrics")
+	defer teardown()
+	metrics := new(testMetrics)
+	idx.metrics = metrics
+
+	// Connect blocks that pay to two addresses.
+	addr := testP2PKHAddr(t, 0x01)
+	_, pkScript := addr.PaymentScript()
+	_, otherScript := testP2PKHAddr(t, 0x02).PaymentScript()
+	var blocks []*dcrutil.Block
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= 3; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript, otherScript)}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+	if metrics.connectedBlocks != 3 {
+		t.Fatalf("unexpected connected blocks: got %d, want 3",
+			metrics.connectedBlocks)
+	}
+
+	// Fetch the entries for the address.
+	err := idx.db.View(func(dbTx database.Tx) error {
+		_, _, err := idx.EntriesForAddress(dbTx, addr, 0, 2, false)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.fetchCalls != 1 || metrics.entriesFetched != 2 {
+		t.Fatalf("unexpected fetch metrics: calls %d, entries %d",
+			metrics.fetchCalls, metrics.entriesFetched)
+	}
+
+	// Ensure a disconnect that is rolled back is not reported.
+	errRollback := errors.New("rollback")
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		err := idx.disconnectBlock(dbTx, blocks[2], blocks[1],
+			testPrevScripter{}, false)
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if metrics.entriesRemoved != 0 {
+		t.Fatalf("unexpected removed entries after rollback: got %d, "+
+			"want 0", metrics.entriesRemoved)
+	}
+
+	// Disconnect the final block.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, blocks[2], blocks[1],
+			testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.entriesRemoved != 2 {
+		t.Fatalf("unexpected removed entries: got %d, want 2",
+			metrics.entriesRemoved)
+	}
+}
+
+// TestAddrIndexProcessedBlocks ensures the number of processed blocks tracks
+// connected and disconnected blocks.
+func TestAddrIndexProcessedBlocks(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_processed")
+	defer teardown()
+
+	// assertProcessed ensures the number of processed blocks matches the
+	// provided value.
+	assertProcessed := func(want uint64) {
+		t.Helper()
+		got, err := idx.ProcessedBlocks()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("unexpected processed blocks: got %d, want %d", got,
+				want)
+		}
+	}
+	assertProcessed(0)
+
+	_, pkScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	var blocks []*dcrutil.Block
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= 4; height++ {
+		block := newTestBlock(height, prevHash,
+			[]*wire.MsgTx{newTestCoinbase(height, pkScript)}, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+	assertProcessed(4)
+
+	// Disconnect the final two blocks and ensure the count decreases.
+	for i := len(blocks) - 1; i >= 2; i-- {
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return idx.disconnectBlock(dbTx, blocks[i], blocks[i-1],
+				testPrevScripter{}, false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertProcessed(2)
+
+	// Ensure an index created before the count was tracked reports its tip
+	// height and continues counting from it.
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		return indexesBucket.Delete(indexProcessedBlocksKey(idx.Key()))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertProcessed(2)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.connectBlock(dbTx, blocks[2], blocks[1],
+			testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertProcessed(3)
+}
+
+// TestAddrIndexNonStandardScriptCount ensures the number of outputs with
+// non-standard scripts is tracked as blocks are connected and disconnected and
+// that it is periodically written to the database.
+func TestAddrIndexNonStandardScriptCount(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_nonstd")
+	defer teardown()
+
+	// checkCount ensures the reported and persisted counts match the provided
+	// values.
+	checkCount := func(want, wantPersisted uint64) {
+		t.Helper()
+
+		count, err := idx.NonStandardScriptCount()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Fatalf("unexpected count: got %d, want %d", count, want)
+		}
+		var persisted uint64
+		err = idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			persisted, err = dbFetchIndexerNonStandardScripts(dbTx, idx.Key())
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if persisted != wantPersisted {
+			t.Fatalf("unexpected persisted count: got %d, want %d",
+				persisted, wantPersisted)
+		}
+	}
+
+	// newBlock returns a block at the provided height that pays a standard
+	// address, a data carrier script, and the provided number of
+	// non-standard scripts.
+	_, stdScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	nullData := []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 0x01}
+	nonStandard := []byte{txscript.OP_TRUE}
+	newBlock := func(height uint32, prevHash *chainhash.Hash, numNonStandard int) *dcrutil.Block {
+		scripts := [][]byte{stdScript, nullData}
+		for i := 0; i < numNonStandard; i++ {
+			scripts = append(scripts, nonStandard)
+		}
+		coinbase := newTestCoinbase(height, scripts...)
+		return newTestBlock(height, prevHash, []*wire.MsgTx{coinbase}, nil)
+	}
+
+	// Ensure the non-standard scripts of connected blocks are counted without
+	// writing them to the database.
+	checkCount(0, 0)
+	var blocks []*dcrutil.Block
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= 3; height++ {
+		block := newBlock(height, prevHash, int(height))
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		blocks = append(blocks, block)
+		prevHash = block.Hash()
+	}
+	checkCount(6, 0)
+
+	// Ensure disconnecting a block removes its non-standard scripts.
+	tip := blocks[len(blocks)-1]
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, tip, nil, testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.chain.(*testChain).RemoveBlock(tip); err != nil {
+		t.Fatal(err)
+	}
+	checkCount(3, 0)
+
+	// Ensure the count is written to the database once enough blocks have
+	// been processed.
+	prevHash = blocks[1].Hash()
+	var batch []*dcrutil.Block
+	for height := uint32(3); height < nonStandardFlushInterval; height++ {
+		block := newBlock(height, prevHash, 1)
+		batch = append(batch, block)
+		prevHash = block.Hash()
+	}
+	for _, block := range batch {
+		if err := idx.chain.(*testChain).AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		err := idx.db.Update(func(dbTx database.Tx) error {
+			return dbPutBlockIDIndexEntry(dbTx, block.Hash(),
+				uint32(block.Height()))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure connecting the blocks in an update that is rolled back changes
+	// neither the reported nor the persisted count.
+	connectData := make([]connectBlockData, 0, len(batch))
+	for _, block := range batch {
+		connectData = append(connectData, connectBlockData{
+			block:       block,
+			prevScripts: testPrevScripter{},
+		})
+	}
+	errRollback := errors.New("rollback")
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		if err := idx.connectBlocks(dbTx, connectData[:1]); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkCount(3, 0)
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		if err := idx.connectBlocks(dbTx, connectData); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkCount(3, 0)
+
+	connectTestBlocksBatched(t, idx, batch, len(batch))
+	want := uint64(3 + len(batch))
+	checkCount(want, want)
+}
+
+// TestAddrIndexPubKeyCollapse ensures payments to the raw public key form of
+// each supported signature type and to its public key hash are indexed under
+// the same address key for both confirmed and unconfirmed transactions.
+func TestAddrIndexPubKeyCollapse(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_pkcollapse")
+	defer teardown()
+
+	// mustDecodeHex decodes the passed hex string and fails the test if it is
+	// not valid.
+	mustDecodeHex := func(s string) []byte {
+		t.Helper()
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unable to decode hex %q: %v", s, err)
+		}
+		return b
+	}
+
+	params := idx.chainParams
+	secpPubKey := mustDecodeHex("0279be667ef9dcbbac55a06295ce870b07029bfcdb2" +
+		"dce28d959f2815b16f81798")
+	edPubKey := mustDecodeHex("cecc1507dc1ddd7295951c290888f095adb9044d1b73" +
+		"d696e6df065d683bd4fc")
+	tests := []struct {
+		name     string
+		makeAddr func() (stdaddr.Address, error)
+		wantType byte
+	}{{
+		name: "ecdsa-secp256k1",
+		makeAddr: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(secpPubKey,
+				params)
+		},
+		wantType: addrKeyTypePubKeyHash,
+	}, {
+		name: "ed25519",
+		makeAddr: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeyEd25519V0Raw(edPubKey, params)
+		},
+		wantType: addrKeyTypePubKeyHashEdwards,
+	}, {
+		name: "schnorr-secp256k1",
+		makeAddr: func() (stdaddr.Address, error) {
+			return stdaddr.NewAddressPubKeySchnorrSecp256k1V0Raw(secpPubKey,
+				params)
+		},
+		wantType: addrKeyTypePubKeyHashSchnorr,
+	}}
+
+	for i, test := range tests {
+		pkAddr, err := test.makeAddr()
+		if err != nil {
+			t.Fatalf("%s: unable to create address: %v", test.name, err)
+		}
+		pkhAddr := pkAddr.(stdaddr.AddressPubKeyHasher).AddressPubKeyHash()
+		pkVersion, pkScript := pkAddr.PaymentScript()
+		pkhVersion, pkhScript := pkhAddr.PaymentScript()
+		if bytes.Equal(pkScript, pkhScript) {
+			t.Fatalf("%s: raw public key and hash scripts are identical",
+				test.name)
+		}
+
+		// Ensure both scripts are indexed under a single key with the
+		// expected type for confirmed transactions.
+		data := make(writeIndexData)
+		idx.indexPkScript(data, pkVersion, pkScript, 0, 0, 0, false, false)
+		idx.indexPkScript(data, pkhVersion, pkhScript, 1, 0, 0, false, false)
+		if len(data) != 1 {
+			t.Fatalf("%s: unexpected number of keys: got %d, want 1",
+				test.name, len(data))
+		}
+		for addrKey, txIdxs := range data {
+			if addrKey[0] != test.wantType {
+				t.Fatalf("%s: unexpected key type: got %d, want %d",
+					test.name, addrKey[0], test.wantType)
+			}
+			if len(txIdxs) != 2 {
+				t.Fatalf("%s: unexpected number of txns: got %d, want 2",
+					test.name, len(txIdxs))
+			}
+		}
+
+		// Ensure the same holds for unconfirmed transactions.
+		tx := dcrutil.NewTx(newTestCoinbase(uint32(i), pkScript, pkhScript))
+		idx.AddUnconfirmedTx(tx, testPrevScripter{}, false)
+		if n := len(idx.addrsByTx[*tx.Hash()]); n != 1 {
+			t.Fatalf("%s: unexpected number of unconfirmed keys: got %d, "+
+				"want 1", test.name, n)
+		}
+		for _, addr := range []stdaddr.Address{pkAddr, pkhAddr} {
+			if n := idx.UnconfirmedCountForAddress(addr); n != 1 {
+				t.Fatalf("%s: unexpected unconfirmed count for %v: got %d, "+
+					"want 1", test.name, addr, n)
+			}
+		}
+	}
+}
+
+// TestAddressKeysForScript ensures the address keys returned for various
+// scripts match the keys the scripts are indexed under.
+func TestAddressKeysForScript(t *testing.T) {
+	t.Parallel()
+
+	// mustDecodeHex decodes the passed hex string and fails the test if it is
+	// not valid.
+	mustDecodeHex := func(s string) []byte {
+		t.Helper()
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unable to decode hex %q: %v", s, err)
+		}
+		return b
+	}
+
+	// mustAddrKey returns the address key for the provided address and
+	// fails the test if it is not supported.
+	mustAddrKey := func(addr stdaddr.Address) [addrKeySize]byte {
+		t.Helper()
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			t.Fatalf("unable to convert address %v to key: %v", addr, err)
+		}
+		return addrKey
+	}
+
+	params := chaincfg.SimNetParams()
+	pubKey1 := mustDecodeHex("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce" +
+		"28d959f2815b16f81798")
+	pubKey2 := mustDecodeHex("02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef" +
+		"3ca7abac09b95c709ee5")
+	pkAddr1, err := stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(pubKey1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkAddr2, err := stdaddr.NewAddressPubKeyEcdsaSecp256k1V0Raw(pubKey2, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkhAddr := testP2PKHAddr(t, 0x01)
+	p2shAddr, err := stdaddr.NewAddressScriptHashV0FromHash(
+		bytes.Repeat([]byte{0x02}, 20), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiSig, err := txscript.MultiSigScript(1, pubKey1, pubKey2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dupMultiSig, err := txscript.MultiSigScript(1, pubKey1, pubKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pkScript := pkAddr1.PaymentScript()
+	_, pkhScript := pkhAddr.PaymentScript()
+	_, p2shScript := p2shAddr.PaymentScript()
+	_, commitScript := pkhAddr.(stdaddr.StakeAddress).RewardCommitmentScript(
+		1e8, 0, 1e8)
+
+	tests := []struct {
+		name     string
+		pkScript []byte
+		want     [][addrKeySize]byte
+	}{{
+		name:     "pay-to-pubkey",
+		pkScript: pkScript,
+		want:     [][addrKeySize]byte{mustAddrKey(pkAddr1)},
+	}, {
+		name:     "pay-to-pubkey-hash",
+		pkScript: pkhScript,
+		want:     [][addrKeySize]byte{mustAddrKey(pkhAddr)},
+	}, {
+		name:     "pay-to-script-hash",
+		pkScript: p2shScript,
+		want:     [][addrKeySize]byte{mustAddrKey(p2shAddr)},
+	}, {
+		name:     "bare multisig",
+		pkScript: multiSig,
+		want: [][addrKeySize]byte{mustAddrKey(pkAddr1),
+			mustAddrKey(pkAddr2)},
+	}, {
+		name:     "bare multisig with duplicate keys",
+		pkScript: dupMultiSig,
+		want:     [][addrKeySize]byte{mustAddrKey(pkAddr1)},
+	}, {
+		name:     "ticket commitment",
+		pkScript: commitScript,
+		want:     [][addrKeySize]byte{mustAddrKey(pkhAddr)},
+	}, {
+		name:     "data carrier",
+		pkScript: []byte{txscript.OP_RETURN, txscript.OP_DATA_1, 0x01},
+		want:     nil,
+	}, {
+		name:     "non-standard",
+		pkScript: []byte{txscript.OP_TRUE},
+		want:     nil,
+	}}
+
+	idx := &AddrIndex{chainParams: params}
+	for _, test := range tests {
+		got, err := idx.AddressKeysForScript(0, test.pkScript, false)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: unexpected number of keys: got %d, want %d",
+				test.name, len(got), len(test.want))
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("%s: mismatched key %d: got %x, want %x", test.name,
+					i, got[i], test.want[i])
+			}
+		}
+
+		// Ensure the returned keys match the keys the script is indexed
+		// under as an output of a ticket purchase.
+		data := make(writeIndexData)
+		idx.indexPkScript(data, 0, test.pkScript, 0, 0, 0, true, false)
+		if len(data) != len(got) {
+			t.Fatalf("%s: mismatched number of indexed keys: got %d, want %d",
+				test.name, len(data), len(got))
+		}
+		for _, addrKey := range got {
+			if _, ok := data[addrKey]; !ok {
+				t.Fatalf("%s: key %x not indexed", test.name, addrKey)
+			}
+		}
+	}
+
+	// Ensure the returned keys reflect the configuration of the index by
+	// matching the keys the scripts are indexed under for indexes that use
+	// the extended key mode, skip script hash addresses, and use a custom
+	// script address extractor.
+	var customKey [addrKeySize]byte
+	customKey[0] = addrKeyTypePubKeyHash
+	copy(customKey[1:], bytes.Repeat([]byte{0x03}, 20))
+	extractor := func(scriptVersion uint16, pkScript []byte) [][addrKeySize]byte {
+		if !bytes.Equal(pkScript, []byte{txscript.OP_TRUE}) {
+			return nil
+		}
+		return [][addrKeySize]byte{customKey}
+	}
+	configured := []struct {
+		name string
+		idx  *AddrIndex
+	}{{
+		name: "extended keys",
+		idx:  &AddrIndex{chainParams: params, extendedKeys: true},
+	}, {
+		name: "skip script hash",
+		idx: &AddrIndex{chainParams: params,
+			skipAddrTypes: 1 << addrKeyTypeScriptHash},
+	}, {
+		name: "custom extractor",
+		idx:  &AddrIndex{chainParams: params, scriptAddrExtractor: extractor},
+	}}
+	for _, config := range configured {
+		for _, test := range tests {
+			got, err := config.idx.AddressKeysForScript(0, test.pkScript,
+				false)
+			if err != nil {
+				t.Fatalf("%s: %s: unexpected error: %v", config.name,
+					test.name, err)
+			}
+			data := make(writeIndexData)
+			config.idx.indexPkScript(data, 0, test.pkScript, 0, 0, 0, true,
+				false)
+			if len(data) != len(got) {
+				t.Fatalf("%s: %s: mismatched number of indexed keys: got "+
+					"%d, want %d", config.name, test.name, len(data),
+					len(got))
+			}
+			for _, addrKey := range got {
+				if _, ok := data[addrKey]; !ok {
+					t.Fatalf("%s: %s: key %x not indexed", config.name,
+						test.name, addrKey)
+				}
+			}
+		}
+	}
+
+	// Ensure the configuration specific keys are returned.
+	got, err := configured[0].idx.AddressKeysForScript(0, pkScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] == mustAddrKey(pkAddr1) {
+		t.Fatalf("unexpected keys for pay-to-pubkey in the extended key "+
+			"mode: %x", got)
+	}
+	got, err = configured[1].idx.AddressKeysForScript(0, p2shScript, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("unexpected keys for skipped pay-to-script-hash: %x", got)
+	}
+	got, err = configured[2].idx.AddressKeysForScript(0,
+		[]byte{txscript.OP_TRUE}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != customKey {
+		t.Fatalf("unexpected keys for custom script: %x", got)
+	}
+}
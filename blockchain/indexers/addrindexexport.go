@@ -0,0 +1,1052 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/wire"
+)
+
+const (
+	// addrIndexDumpVersion is the current version of the address index dump
+	// format.
+	addrIndexDumpVersion = 2
+
+	// addrIndexDumpEntrySize is the number of bytes an entry in an address
+	// index dump consumes.  It consists of the block hash + 4 bytes for the
+	// block height + 4 bytes for the start offset + 4 bytes for the tx length
+	// + 4 bytes for the block index and flags.
+	addrIndexDumpEntrySize = chainhash.HashSize + 4 + 4 + 4 + 4
+
+	// addrIndexDumpRecordEnd, addrIndexDumpRecordAddr, and
+	// addrIndexDumpRecordCompanion are the record types in an address index
+	// dump.  The end record is the final record of a dump, an address record
+	// houses all of the entries for a single address, and a companion record
+	// houses a single key/value pair of one of the companion buckets.
+	addrIndexDumpRecordEnd       = 0
+	addrIndexDumpRecordAddr      = 1
+	addrIndexDumpRecordCompanion = 2
+
+	// addrIndexDumpCommitmentSize is the number of bytes the value of a
+	// ticket commitment amount in an address index dump consumes.  It
+	// consists of the block hash + 8 bytes for the amount.
+	addrIndexDumpCommitmentSize = chainhash.HashSize + 8
+
+	// addrIndexImportBatchEntries is the number of entries and companion
+	// records imported from an address index dump per database transaction
+	// in order to keep memory usage to reasonable levels.
+	addrIndexImportBatchEntries = 100000
+)
+
+var (
+	// addrIndexDumpMagic is the sequence of bytes that identifies an address
+	// index dump.
+	addrIndexDumpMagic = []byte("dcraddridx")
+
+	// addrIndexDumpCompanionBuckets are the keys of the companion buckets of
+	// the address index that are included in an address index dump.  The
+	// position of a bucket identifies it in the companion records.
+	addrIndexDumpCompanionBuckets = [][]byte{addrCommitmentIndexKey,
+		addrTotalsIndexKey, addrBlockTimeIndexKey, addrRewardSourceIndexKey,
+		addrUnindexedVersionIndexKey, addrDisapprovedIndexKey,
+		addrInputIndexKey}
+
+	// ErrAddrIndexDivergence is returned by MergeAddrIndex when the address
+	// indexes of the provided databases differ.
+	ErrAddrIndexDivergence = errors.New("address indexes diverge")
+)
+
+// -----------------------------------------------------------------------------
+// An address index dump is a portable representation of the full address
+// index that does not depend on the internal block IDs of the database it was
+// created from.  It allows the index to be analyzed offline or imported into
+// another database that is on the same network.
+//
+// The dump is tied to the network it was created on via the genesis block hash
+// in its header and every entry refers to its block by hash, so it may only be
+// imported into a database that knows all of the referenced blocks.
+//
+// The serialized header format is:
+//
+//   <magic><dump version><index version><genesis hash><tip hash><tip height>
+//
+//   Field           Type              Size
+//   magic           []byte            10 bytes ("dcraddridx")
+//   dump version    uint32            4 bytes
+//   index version   uint32            4 bytes
+//   genesis hash    chainhash.Hash    32 bytes
+//   tip hash        chainhash.Hash    32 bytes
+//   tip height      uint32            4 bytes
+//   -----
+//   Total: 86 bytes
+//
+// The header is followed by any number of address records, any number of
+// companion records, and a final end record.  Each record starts with a single
+// byte that identifies its type (0 = end, 1 = address, 2 = companion).  The end
+// record does not have any further data.
+//
+// The serialized address record format is:
+//
+//   <record type><addr key><num entries>[<entry>,...]
+//
+//   Field           Type              Size
+//   record type     uint8             1 byte
+//   addr key        [21]byte          21 bytes
+//   num entries     VLQ               variable
+//   entries         []entry           48 bytes * num entries
+//
+// The entries of an address are ordered from oldest to newest and the
+// serialized entry format is:
+//
+//   <block hash><block height><start offset><tx length><block index and flags>
+//
+//   Field                  Type              Size
+//   block hash             chainhash.Hash    32 bytes
+//   block height           uint32            4 bytes
+//   start offset           uint32            4 bytes
+//   tx length              uint32            4 bytes
+//   block index and flags  uint32            4 bytes
+//   -----
+//   Total: 48 bytes per entry
+//
+// The companion records house the contents of the buckets that accompany the
+// entries, such as the ticket commitment amounts and address totals, so that an
+// imported index is identical to the exported one.  The serialized companion
+// record format is:
+//
+//   <record type><bucket id><key len><key><value len><value>
+//
+//   Field           Type              Size
+//   record type     uint8             1 byte
+//   bucket id       uint8             1 byte
+//   key len         VLQ               variable
+//   key             []byte            key len
+//   value len       VLQ               variable
+//   value           []byte            value len
+//
+// The bucket id is the position of the bucket in the list of companion buckets
+// (0 = ticket commitment amounts, 1 = address totals, 2 = block times, 3 =
+// reward sources, 4 = unindexed script versions, 5 = disapprovals, 6 = input
+// indices).  The keys and values are the same as stored in the database except
+// that the block ID of a ticket commitment amount is replaced with the hash of
+// the block, so the value is the 32-byte block hash followed by the 8-byte
+// amount.
+//
+// All integers are serialized in little endian.
+// -----------------------------------------------------------------------------
+
+// AddrIndexEntryField describes the location of a fixed-size field within a
+// serialized address index entry.  All integer fields are serialized in little
+// endian.
+type AddrIndexEntryField struct {
+	Offset int
+	Size   int
+}
+
+// AddrIndexEntryBits describes the location of a bit field within the block
+// index and flags field of a serialized address index entry.  The value of the
+// bit field is obtained by masking the block index and flags field with the
+// mask and shifting the result right by the shift.
+type AddrIndexEntryBits struct {
+	Shift uint8
+	Mask  uint32
+}
+
+// AddrIndexEntryLayout describes the serialization of the entries of the address
+// index, both as stored in the database and as written to address index dumps,
+// so that external tools are able to decode raw entries without hard coding
+// their layout.
+//
+// The layout is tied to the version of the index it describes.  Consumers
+// should record the index version the layout was obtained for and treat a
+// different version, such as the one in the header of a dump, as a potential
+// change to the layout.
+type AddrIndexEntryLayout struct {
+	// IndexVersion is the version of the address index the layout describes.
+	IndexVersion uint32
+
+	// DumpVersion is the version of the address index dump format the dump
+	// fields describe.
+	DumpVersion uint32
+
+	// EntrySize is the number of bytes an entry stored in the database
+	// consumes.  The stored entries identify their block by an internal
+	// block ID which is only meaningful to the database they are stored in.
+	// EntryVersion is the serialization version of a stored entry which
+	// shares the bytes of the transaction length field that are otherwise
+	// unused.
+	EntrySize       int
+	BlockID         AddrIndexEntryField
+	TxStart         AddrIndexEntryField
+	TxLen           AddrIndexEntryField
+	EntryVersion    AddrIndexEntryField
+	BlockIndexFlags AddrIndexEntryField
+
+	// DumpHeaderSize is the number of bytes the header of an address index
+	// dump consumes and DumpEntrySize is the number of bytes an entry in a
+	// dump consumes.  The dump entries identify their block by its hash and
+	// height instead.
+	DumpHeaderSize      int
+	DumpEntrySize       int
+	DumpBlockHash       AddrIndexEntryField
+	DumpBlockHeight     AddrIndexEntryField
+	DumpTxStart         AddrIndexEntryField
+	DumpTxLen           AddrIndexEntryField
+	DumpBlockIndexFlags AddrIndexEntryField
+
+	// The following describe the bit fields of the block index and flags
+	// field which is the same for both kinds of entries.  BlockIndex is the
+	// index of the transaction within its tree and the remaining bit fields
+	// house the values of the Tree, StakeTags, Class, OutputKind, and Credit
+	// fields of TxIndexEntry.
+	BlockIndex AddrIndexEntryBits
+	Tree       AddrIndexEntryBits
+	StakeTags  AddrIndexEntryBits
+	TxClass    AddrIndexEntryBits
+	OutputKind AddrIndexEntryBits
+	Credit     AddrIndexEntryBits
+}
+
+// EntryLayout returns a descriptor of the serialization of the entries of the
+// current version of the address index.  See AddrIndexEntryLayout for details.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) EntryLayout() AddrIndexEntryLayout {
+	return AddrIndexEntryLayout{
+		IndexVersion:    addrIndexVersion,
+		DumpVersion:     addrIndexDumpVersion,
+		EntrySize:       txEntrySize,
+		BlockID:         AddrIndexEntryField{Offset: 0, Size: 4},
+		TxStart:         AddrIndexEntryField{Offset: 4, Size: 4},
+		TxLen:           AddrIndexEntryField{Offset: 8, Size: 3},
+		EntryVersion:    AddrIndexEntryField{Offset: 11, Size: 1},
+		BlockIndexFlags: AddrIndexEntryField{Offset: 12, Size: 4},
+
+		DumpHeaderSize: len(addrIndexDumpMagic) + 4 + 4 +
+			chainhash.HashSize + chainhash.HashSize + 4,
+		DumpEntrySize: addrIndexDumpEntrySize,
+		DumpBlockHash: AddrIndexEntryField{Offset: 0,
+			Size: chainhash.HashSize},
+		DumpBlockHeight:     AddrIndexEntryField{Offset: 32, Size: 4},
+		DumpTxStart:         AddrIndexEntryField{Offset: 36, Size: 4},
+		DumpTxLen:           AddrIndexEntryField{Offset: 40, Size: 4},
+		DumpBlockIndexFlags: AddrIndexEntryField{Offset: 44, Size: 4},
+
+		BlockIndex: AddrIndexEntryBits{Shift: 0, Mask: blockIndexMask},
+		Tree:       AddrIndexEntryBits{Shift: entryTreeShift, Mask: entryTreeMask},
+		StakeTags: AddrIndexEntryBits{Shift: entryStakeTagsShift,
+			Mask: entryStakeTagsMask},
+		TxClass: AddrIndexEntryBits{Shift: entryTxClassShift,
+			Mask: entryTxClassMask},
+		OutputKind: AddrIndexEntryBits{Shift: entryOutputKindShift,
+			Mask: entryOutputKindMask},
+		Credit: AddrIndexEntryBits{Shift: entryCreditShift,
+			Mask: entryCreditMask},
+	}
+}
+
+// addrIndexDumpHeader houses the header of an address index dump.
+type addrIndexDumpHeader struct {
+	dumpVersion  uint32
+	indexVersion uint32
+	genesisHash  chainhash.Hash
+	tipHash      chainhash.Hash
+	tipHeight    uint32
+}
+
+// writeAddrIndexDumpHeader serializes the provided header to the writer
+// according to the format described in detail above.
+func writeAddrIndexDumpHeader(w io.Writer, header *addrIndexDumpHeader) error {
+	var buf [4]byte
+	if _, err := w.Write(addrIndexDumpMagic); err != nil {
+		return err
+	}
+	byteOrder.PutUint32(buf[:], header.dumpVersion)
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	byteOrder.PutUint32(buf[:], header.indexVersion)
+	if _, err := w.Write(buf[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(header.genesisHash[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(header.tipHash[:]); err != nil {
+		return err
+	}
+	byteOrder.PutUint32(buf[:], header.tipHeight)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readAddrIndexDumpHeader deserializes a header from the reader according to
+// the format described in detail above and ensures it is for a supported
+// version of the dump format.
+func readAddrIndexDumpHeader(r io.Reader) (*addrIndexDumpHeader, error) {
+	magic := make([]byte, len(addrIndexDumpMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, addrIndexDumpMagic) {
+		return nil, errDeserialize("data is not an address index dump")
+	}
+
+	var buf [4 + 4 + chainhash.HashSize*2 + 4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, err
+	}
+	var header addrIndexDumpHeader
+	header.dumpVersion = byteOrder.Uint32(buf[0:4])
+	header.indexVersion = byteOrder.Uint32(buf[4:8])
+	copy(header.genesisHash[:], buf[8:40])
+	copy(header.tipHash[:], buf[40:72])
+	header.tipHeight = byteOrder.Uint32(buf[72:76])
+	if header.dumpVersion != addrIndexDumpVersion {
+		str := fmt.Sprintf("unsupported address index dump version %d",
+			header.dumpVersion)
+		return nil, errDeserialize(str)
+	}
+	return &header, nil
+}
+
+// Export writes every address in the address index along with all of its
+// entries and the contents of the companion buckets to the provided writer in
+// the self-describing dump format described in detail above.  Each entry refers to its block by hash and height instead
+// of the internal block ID, so the dump does not depend on the database it was
+// created from.
+//
+// The dump is tied to the network of the index via the genesis block hash in
+// its header and may be imported into another database on the same network
+// with ImportAddrIndex.
+//
+// The index is read with a cursor, so only the entries for a single address are
+// held in memory at a time.  The export stops and returns an error when the
+// provided context is canceled.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) Export(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+
+		// The dump does not include the index options and imported indexes
+		// are treated as having been built with the default options, so
+		// only indexes built with the default options may be exported.
+		options, _, err := dbFetchIndexerOptions(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if options != 0 {
+			return fmt.Errorf("unable to export an address index built "+
+				"with non-default options %#x", options)
+		}
+
+		err = writeAddrIndexDumpHeader(bw, &addrIndexDumpHeader{
+			dumpVersion:  addrIndexDumpVersion,
+			indexVersion: addrIndexVersion,
+			genesisHash:  idx.chainParams.GenesisHash,
+			tipHash:      *tipHash,
+			tipHeight:    uint32(tipHeight),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Resolve the block hash and height of the entries while caching
+		// the most recent result since entries for the same block are
+		// often adjacent.
+		var lastID []byte
+		var lastHash *chainhash.Hash
+		var lastHeight int64
+		var entryBuf [addrIndexDumpEntrySize]byte
+		writeEntries := func(levelData []byte) error {
+			for offset := 0; offset+txEntrySize <= len(levelData); offset +=
+				txEntrySize {
+
+				serialized := levelData[offset : offset+txEntrySize]
+				if !bytes.Equal(serialized[0:4], lastID) {
+					hash, err := dbFetchBlockHashBySerializedID(dbTx,
+						serialized[0:4])
+					if err != nil {
+						return err
+					}
+					height, err := idx.chain.BlockHeightByHash(hash)
+					if err != nil {
+						return err
+					}
+					lastID, lastHash, lastHeight = serialized[0:4], hash,
+						height
+				}
+
+				copy(entryBuf[:], lastHash[:])
+				byteOrder.PutUint32(entryBuf[32:36], uint32(lastHeight))
+				copy(entryBuf[36:], serialized[4:txEntrySize])
+				txLen, _ := decodeEntryTxLen(byteOrder.Uint32(serialized[8:12]))
+				byteOrder.PutUint32(entryBuf[40:44], txLen)
+				if _, err := bw.Write(entryBuf[:]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// writeRecord writes an address record for the provided address key
+		// and its levels ordered from the lowest (newest) level to the
+		// highest (oldest) level.
+		writeRecord := func(addrKey []byte, levels [][]byte) error {
+			var numEntries int
+			for _, levelData := range levels {
+				numEntries += len(levelData) / txEntrySize
+			}
+			if err := bw.WriteByte(addrIndexDumpRecordAddr); err != nil {
+				return err
+			}
+			if _, err := bw.Write(addrKey); err != nil {
+				return err
+			}
+			err := wire.WriteVarInt(bw, 0, uint64(numEntries))
+			if err != nil {
+				return err
+			}
+			for i := len(levels) - 1; i >= 0; i-- {
+				if err := writeEntries(levels[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Iterate every level of every address.  The levels for each
+		// address key are stored under consecutive keys in ascending order,
+		// so write the record for an address once all of its levels have
+		// been visited.
+		var curAddrKey []byte
+		var levels [][]byte
+		cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			key := cursor.Key()
+			if len(key) != levelKeySize {
+				continue
+			}
+			if curAddrKey != nil && !bytes.Equal(key[:addrKeySize],
+				curAddrKey) {
+
+				if err := writeRecord(curAddrKey, levels); err != nil {
+					return err
+				}
+				curAddrKey, levels = nil, levels[:0]
+
+				if interruptRequested(ctx) {
+					return errInterruptRequested
+				}
+			}
+			if curAddrKey == nil {
+				curAddrKey = key[:addrKeySize]
+			}
+			levels = append(levels, cursor.Value())
+		}
+		if curAddrKey != nil {
+			if err := writeRecord(curAddrKey, levels); err != nil {
+				return err
+			}
+		}
+
+		// Write the contents of the companion buckets.  The ticket
+		// commitment amounts refer to their block by internal block ID, so
+		// replace it with the block hash.
+		for i, bucketKey := range addrIndexDumpCompanionBuckets {
+			if interruptRequested(ctx) {
+				return errInterruptRequested
+			}
+			bucket := dbTx.Metadata().Bucket(bucketKey)
+			if bucket == nil {
+				continue
+			}
+			isCommitments := bytes.Equal(bucketKey, addrCommitmentIndexKey)
+			err := bucket.ForEach(func(k, v []byte) error {
+				if isCommitments {
+					if len(v) != addrCommitmentEntrySize {
+						str := fmt.Sprintf("ticket commitment amount for "+
+							"key %x has an invalid size of %d bytes", k,
+							len(v))
+						return makeDbErr(database.ErrCorruption, str)
+					}
+					hash, err := dbFetchBlockHashBySerializedID(dbTx, v[0:4])
+					if err != nil {
+						return err
+					}
+					var value [addrIndexDumpCommitmentSize]byte
+					copy(value[:], hash[:])
+					copy(value[chainhash.HashSize:], v[4:])
+					v = value[:]
+				}
+				return writeAddrIndexDumpCompanion(bw, uint8(i), k, v)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return bw.WriteByte(addrIndexDumpRecordEnd)
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// writeAddrIndexDumpCompanion serializes a companion record for the provided
+// key/value pair of the companion bucket with the given ID to the writer
+// according to the format described in detail above.
+func writeAddrIndexDumpCompanion(w *bufio.Writer, bucketID uint8, key, value []byte) error {
+	if err := w.WriteByte(addrIndexDumpRecordCompanion); err != nil {
+		return err
+	}
+	if err := w.WriteByte(bucketID); err != nil {
+		return err
+	}
+	if err := wire.WriteVarBytes(w, 0, key); err != nil {
+		return err
+	}
+	return wire.WriteVarBytes(w, 0, value)
+}
+
+// readAddrIndexDumpBytes reads a variable length byte slice that is prefixed
+// with its length from the reader.  The bytes are read without preallocating
+// based on the untrusted length so malformed dumps fail once the data runs out
+// instead of attempting a massive allocation.
+func readAddrIndexDumpBytes(r io.Reader) ([]byte, error) {
+	numBytes, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if numBytes > math.MaxInt32 {
+		str := fmt.Sprintf("companion record field of %d bytes exceeds the "+
+			"max allowed", numBytes)
+		return nil, errDeserialize(str)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(numBytes)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addrIndexDumpRecord houses an address record read from an address index
+// dump.  The entries are the serialized dump entries ordered from oldest to
+// newest.
+type addrIndexDumpRecord struct {
+	addrKey [addrKeySize]byte
+	entries []byte
+}
+
+// dbPutAddrIndexDumpRecords adds the entries of the provided address records
+// to the address index by resolving the block hash of each entry to its
+// internal block ID.
+func dbPutAddrIndexDumpRecords(dbTx database.Tx, records []addrIndexDumpRecord) error {
+	bucket := newWriteBatchBucket(dbTx.Metadata().Bucket(addrIndexKey))
+	var lastHash chainhash.Hash
+	var lastID uint32
+	var haveLast bool
+	for i := range records {
+		record := &records[i]
+		for offset := 0; offset < len(record.entries); offset +=
+			addrIndexDumpEntrySize {
+
+			entry := record.entries[offset : offset+addrIndexDumpEntrySize]
+			if !haveLast || !bytes.Equal(entry[:32], lastHash[:]) {
+				copy(lastHash[:], entry[:32])
+				blockID, err := dbFetchBlockIDByHash(dbTx, &lastHash)
+				if err != nil {
+					return fmt.Errorf("unable to import entry for block "+
+						"%s: %w", lastHash, err)
+				}
+				lastID, haveLast = blockID, true
+			}
+
+			txLoc := wire.TxLoc{
+				TxStart: int(byteOrder.Uint32(entry[36:40])),
+				TxLen:   int(byteOrder.Uint32(entry[40:44])),
+			}
+			blockIndexFlags := byteOrder.Uint32(entry[44:48])
+			err := dbPutAddrIndexEntry(bucket, record.addrKey, lastID, txLoc,
+				blockIndexFlags)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return bucket.flush()
+}
+
+// addrIndexDumpCompanion houses a companion record read from an address index
+// dump.
+type addrIndexDumpCompanion struct {
+	bucketID uint8
+	key      []byte
+	value    []byte
+}
+
+// dbPutAddrIndexDumpCompanions adds the key/value pairs of the provided
+// companion records to their companion buckets by resolving the block hash of
+// each ticket commitment amount to its internal block ID.
+func dbPutAddrIndexDumpCompanions(dbTx database.Tx, companions []addrIndexDumpCompanion) error {
+	meta := dbTx.Metadata()
+	for i := range companions {
+		companion := &companions[i]
+		bucketKey := addrIndexDumpCompanionBuckets[companion.bucketID]
+		value := companion.value
+		if bytes.Equal(bucketKey, addrCommitmentIndexKey) {
+			if len(value) != addrIndexDumpCommitmentSize {
+				str := fmt.Sprintf("ticket commitment amount for key %x "+
+					"has an invalid size of %d bytes", companion.key,
+					len(value))
+				return errDeserialize(str)
+			}
+			var hash chainhash.Hash
+			copy(hash[:], value[:chainhash.HashSize])
+			blockID, err := dbFetchBlockIDByHash(dbTx, &hash)
+			if err != nil {
+				return fmt.Errorf("unable to import ticket commitment for "+
+					"block %s: %w", hash, err)
+			}
+			var serialized [addrCommitmentEntrySize]byte
+			byteOrder.PutUint32(serialized[0:4], blockID)
+			copy(serialized[4:], value[chainhash.HashSize:])
+			value = serialized[:]
+		}
+		if err := meta.Bucket(bucketKey).Put(companion.key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportAddrIndex replaces the address index in the provided database with the
+// contents of an address index dump created by Export.
+//
+// The blocks referenced by the dump must be known to the transaction index of
+// the database since the entries are stored with its internal block IDs.  This
+// implies the database must be on the same network as the dump.  The index tip
+// is set to the tip recorded in the dump, so the address index will catch up
+// from that point the next time it is loaded.
+//
+// The dump also contains the companion data of the index, such as the amounts
+// committed to addresses by ticket purchases and the address totals, so the
+// imported index is identical to the exported one.
+//
+// The dump is imported in multiple database transactions in order to keep
+// memory usage to reasonable levels.  The index is marked as being dropped
+// until the import is complete, so an import that is interrupted or fails
+// results in the index being dropped the next time it is loaded.
+//
+// NOTE: This must not be called while the address index is loaded.
+func ImportAddrIndex(ctx context.Context, db database.DB, r io.Reader) error {
+	br := bufio.NewReader(r)
+	header, err := readAddrIndexDumpHeader(br)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the tip of the dump is known to the database before removing
+	// the existing index.
+	if header.tipHeight > 0 {
+		err := db.View(func(dbTx database.Tx) error {
+			_, err := dbFetchBlockIDByHash(dbTx, &header.tipHash)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("unable to import address index with tip %s "+
+				"(height %d): %w", header.tipHash, header.tipHeight, err)
+		}
+	}
+
+	// Remove the existing index and recreate it marked as being dropped.
+	if err := DropAddrIndex(ctx, db); err != nil {
+		return err
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		indexesBucket, err := meta.CreateBucketIfNotExists(indexTipsBucketName)
+		if err != nil {
+			return err
+		}
+		err = indexesBucket.Put(indexDropKey(addrIndexKey), addrIndexKey)
+		if err != nil {
+			return err
+		}
+		if _, err := meta.CreateBucket(addrIndexKey); err != nil {
+			return err
+		}
+		for _, bucketKey := range addrIndexDumpCompanionBuckets {
+			if _, err := meta.CreateBucketIfNotExists(bucketKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Import the address and companion records in batches.
+	var records []addrIndexDumpRecord
+	var companions []addrIndexDumpCompanion
+	var numPending int
+	flushRecords := func() error {
+		err := db.Update(func(dbTx database.Tx) error {
+			err := dbPutAddrIndexDumpRecords(dbTx, records)
+			if err != nil {
+				return err
+			}
+			return dbPutAddrIndexDumpCompanions(dbTx, companions)
+		})
+		if err != nil {
+			return err
+		}
+		records, companions, numPending = records[:0], companions[:0], 0
+		if interruptRequested(ctx) {
+			return errInterruptRequested
+		}
+		return nil
+	}
+	for {
+		recordType, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if recordType == addrIndexDumpRecordEnd {
+			break
+		}
+		if recordType == addrIndexDumpRecordCompanion {
+			var companion addrIndexDumpCompanion
+			companion.bucketID, err = br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if int(companion.bucketID) >= len(addrIndexDumpCompanionBuckets) {
+				str := fmt.Sprintf("unknown address index dump companion "+
+					"bucket %d", companion.bucketID)
+				return errDeserialize(str)
+			}
+			companion.key, err = readAddrIndexDumpBytes(br)
+			if err != nil {
+				return err
+			}
+			companion.value, err = readAddrIndexDumpBytes(br)
+			if err != nil {
+				return err
+			}
+			companions = append(companions, companion)
+			numPending++
+			if numPending >= addrIndexImportBatchEntries {
+				if err := flushRecords(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if recordType != addrIndexDumpRecordAddr {
+			str := fmt.Sprintf("unknown address index dump record type %d",
+				recordType)
+			return errDeserialize(str)
+		}
+
+		var record addrIndexDumpRecord
+		if _, err := io.ReadFull(br, record.addrKey[:]); err != nil {
+			return err
+		}
+		numEntries, err := wire.ReadVarInt(br, 0)
+		if err != nil {
+			return err
+		}
+		if numEntries > math.MaxInt64/addrIndexDumpEntrySize {
+			str := fmt.Sprintf("address record with %d entries exceeds the "+
+				"max allowed", numEntries)
+			return errDeserialize(str)
+		}
+
+		// Read the entries without preallocating based on the untrusted
+		// number of entries so malformed dumps fail once the data runs out
+		// instead of attempting a massive allocation.
+		var entries bytes.Buffer
+		numBytes := int64(numEntries) * addrIndexDumpEntrySize
+		if _, err := io.CopyN(&entries, br, numBytes); err != nil {
+			return err
+		}
+		record.entries = entries.Bytes()
+		records = append(records, record)
+		numPending += int(numEntries)
+		if numPending >= addrIndexImportBatchEntries {
+			if err := flushRecords(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(records) > 0 || len(companions) > 0 {
+		if err := flushRecords(); err != nil {
+			return err
+		}
+	}
+
+	// Set the index version and tip and remove the drop marker now that all
+	// of the entries have been imported.
+	return db.Update(func(dbTx database.Tx) error {
+		err := dbPutIndexerVersion(dbTx, addrIndexKey, addrIndexVersion)
+		if err != nil {
+			return err
+		}
+		err = dbPutIndexerTip(dbTx, addrIndexKey, &header.tipHash,
+			int32(header.tipHeight))
+		if err != nil {
+			return err
+		}
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		return indexesBucket.Delete(indexDropKey(addrIndexKey))
+	})
+}
+
+// addrIndexMergeEntry describes an address index entry independently of the
+// internal block IDs of the database it is stored in so that entries from
+// different databases can be compared.
+type addrIndexMergeEntry struct {
+	blockHash       chainhash.Hash
+	txStart         uint32
+	txLen           uint32
+	blockIndexFlags uint32
+}
+
+// addrIndexMergeCursor iterates the addresses of the address index in a
+// database in ascending order of their keys along with all of their entries.
+type addrIndexMergeCursor struct {
+	dbTx     database.Tx
+	cursor   database.Cursor
+	ok       bool
+	lastID   []byte
+	lastHash *chainhash.Hash
+}
+
+// newAddrIndexMergeCursor returns a new cursor positioned at the first address
+// of the address index in the database of the provided transaction.
+func newAddrIndexMergeCursor(dbTx database.Tx) *addrIndexMergeCursor {
+	cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+	return &addrIndexMergeCursor{dbTx: dbTx, cursor: cursor, ok: cursor.First()}
+}
+
+// next returns the key of the next address along with all of its entries
+// ordered from oldest to newest and advances the cursor past it.  The final
+// return value is false once all addresses have been returned.
+func (c *addrIndexMergeCursor) next() ([addrKeySize]byte, []addrIndexMergeEntry, bool, error) {
+	// Skip any keys that are not address level keys.
+	for c.ok && len(c.cursor.Key()) != levelKeySize {
+		c.ok = c.cursor.Next()
+	}
+	var addrKey [addrKeySize]byte
+	if !c.ok {
+		return addrKey, nil, false, nil
+	}
+
+	// The levels for each address key are stored under consecutive keys
+	// ordered from the lowest (newest) level to the highest (oldest) level.
+	copy(addrKey[:], c.cursor.Key()[:addrKeySize])
+	var levels [][]byte
+	for ; c.ok; c.ok = c.cursor.Next() {
+		key := c.cursor.Key()
+		if len(key) != levelKeySize {
+			continue
+		}
+		if !bytes.Equal(key[:addrKeySize], addrKey[:]) {
+			break
+		}
+		levels = append(levels, c.cursor.Value())
+	}
+
+	// Resolve the block hash of the entries while caching the most recent
+	// result since entries for the same block are often adjacent.
+	var entries []addrIndexMergeEntry
+	for i := len(levels) - 1; i >= 0; i-- {
+		levelData := levels[i]
+		for offset := 0; offset+txEntrySize <= len(levelData); offset +=
+			txEntrySize {
+
+			serialized := levelData[offset : offset+txEntrySize]
+			if !bytes.Equal(serialized[0:4], c.lastID) {
+				hash, err := dbFetchBlockHashBySerializedID(c.dbTx,
+					serialized[0:4])
+				if err != nil {
+					return addrKey, nil, false, err
+				}
+				c.lastID, c.lastHash = serialized[0:4], hash
+			}
+			entries = append(entries, addrIndexMergeEntry{
+				blockHash:       *c.lastHash,
+				txStart:         byteOrder.Uint32(serialized[4:8]),
+				txLen:           byteOrder.Uint32(serialized[8:12]) & entryTxLenMask,
+				blockIndexFlags: byteOrder.Uint32(serialized[12:16]),
+			})
+		}
+	}
+	return addrKey, entries, true, nil
+}
+
+// MergeAddrIndex walks the address indexes of the provided destination and
+// source databases address by address in a single pass and reconciles the
+// entries of each address, which are expected to be identical when both
+// databases are synced to the same chain.  The entries are compared by block
+// hash instead of internal block ID, so the databases do not need to share the
+// same internal block IDs.
+//
+// This is primarily intended as a validation tool to cross-check indexes built
+// by separate nodes.  An error that wraps ErrAddrIndexDivergence is returned
+// that identifies the first address and entry that differ, if any, including
+// addresses that only have entries in one of the databases.  Indexes that were
+// built with different options or that have different tips are also reported
+// as divergent since their entries are not expected to match.
+//
+// Both databases must be on the network described by the provided parameters
+// as determined by the presence of its genesis block.  Neither database is
+// modified and both are read within a single transaction each, so they must
+// not be modified while the indexes are compared.  The comparison stops and
+// returns an error when the provided context is canceled.
+func MergeAddrIndex(ctx context.Context, dst, src database.DB, chainParams *chaincfg.Params) error {
+	return src.View(func(srcTx database.Tx) error {
+		return dst.View(func(dstTx database.Tx) error {
+			return dbMergeAddrIndex(ctx, dstTx, srcTx, chainParams)
+		})
+	})
+}
+
+// dbMergeAddrIndex compares the address indexes in the databases of the provided
+// transactions as described by MergeAddrIndex.
+func dbMergeAddrIndex(ctx context.Context, dstTx, srcTx database.Tx, chainParams *chaincfg.Params) error {
+	// Ensure both databases are on the expected network and have an address
+	// index.
+	for _, dbTx := range []database.Tx{dstTx, srcTx} {
+		hasGenesis, err := dbTx.HasBlock(&chainParams.GenesisHash)
+		if err != nil {
+			return err
+		}
+		if !hasGenesis {
+			return fmt.Errorf("database does not contain the genesis block "+
+				"%s of network %s", chainParams.GenesisHash, chainParams.Name)
+		}
+		if dbTx.Metadata().Bucket(addrIndexKey) == nil {
+			return fmt.Errorf("database does not contain an address index")
+		}
+	}
+
+	// Ensure the indexes were built with the same options and are at the
+	// same tip.
+	dstOptions, _, err := dbFetchIndexerOptions(dstTx, addrIndexKey)
+	if err != nil {
+		return err
+	}
+	srcOptions, _, err := dbFetchIndexerOptions(srcTx, addrIndexKey)
+	if err != nil {
+		return err
+	}
+	if dstOptions != srcOptions {
+		return fmt.Errorf("%w: destination options %#x, source options %#x",
+			ErrAddrIndexDivergence, dstOptions, srcOptions)
+	}
+	dstTipHash, dstTipHeight, err := dbFetchIndexerTip(dstTx, addrIndexKey)
+	if err != nil {
+		return err
+	}
+	srcTipHash, srcTipHeight, err := dbFetchIndexerTip(srcTx, addrIndexKey)
+	if err != nil {
+		return err
+	}
+	if *dstTipHash != *srcTipHash {
+		return fmt.Errorf("%w: destination tip %s (height %d), source tip "+
+			"%s (height %d)", ErrAddrIndexDivergence, dstTipHash,
+			dstTipHeight, srcTipHash, srcTipHeight)
+	}
+
+	// describeAddrKey returns a human-readable description of the provided
+	// address key.
+	describeAddrKey := func(addrKey [addrKeySize]byte) string {
+		addr, err := keyToAddr(addrKey, chainParams)
+		if err != nil {
+			return fmt.Sprintf("key %x", addrKey)
+		}
+		return addr.String()
+	}
+
+	// Walk the addresses of both indexes in ascending order of their keys.
+	dstCursor := newAddrIndexMergeCursor(dstTx)
+	srcCursor := newAddrIndexMergeCursor(srcTx)
+	dstKey, dstEntries, dstOK, err := dstCursor.next()
+	if err != nil {
+		return err
+	}
+	srcKey, srcEntries, srcOK, err := srcCursor.next()
+	if err != nil {
+		return err
+	}
+	for dstOK || srcOK {
+		if interruptRequested(ctx) {
+			return errInterruptRequested
+		}
+
+		var cmp int
+		switch {
+		case !dstOK:
+			cmp = 1
+		case !srcOK:
+			cmp = -1
+		default:
+			cmp = bytes.Compare(dstKey[:], srcKey[:])
+		}
+		if cmp < 0 {
+			return fmt.Errorf("%w: address %s only has entries in the "+
+				"destination", ErrAddrIndexDivergence, describeAddrKey(dstKey))
+		}
+		if cmp > 0 {
+			return fmt.Errorf("%w: address %s only has entries in the source",
+				ErrAddrIndexDivergence, describeAddrKey(srcKey))
+		}
+
+		for i := 0; i < len(dstEntries) && i < len(srcEntries); i++ {
+			dstEntry, srcEntry := &dstEntries[i], &srcEntries[i]
+			if *dstEntry != *srcEntry {
+				return fmt.Errorf("%w: address %s entry %d: destination "+
+					"%+v, source %+v", ErrAddrIndexDivergence,
+					describeAddrKey(dstKey), i, *dstEntry, *srcEntry)
+			}
+		}
+		if len(dstEntries) != len(srcEntries) {
+			return fmt.Errorf("%w: address %s has %d entries in the "+
+				"destination and %d entries in the source",
+				ErrAddrIndexDivergence, describeAddrKey(dstKey),
+				len(dstEntries), len(srcEntries))
+		}
+
+		dstKey, dstEntries, dstOK, err = dstCursor.next()
+		if err != nil {
+			return err
+		}
+		srcKey, srcEntries, srcOK, err = srcCursor.next()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,455 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/dcrutil/v4"
+	"github.com/decred/dcrd/wire"
+)
+
+// TestAddrIndexExportImport ensures exporting an address index and importing
+// the resulting dump into another database produces an identical index.
+func TestAddrIndexExportImport(t *testing.T) {
+	t.Parallel()
+
+	const numBlocks = 40
+	srcIdx, teardown := newTestAddrIndex(t, "test_addrindex_export")
+	defer teardown()
+	blocks := newTestReindexBlocks(t, numBlocks,
+		&srcIdx.chainParams.GenesisHash)
+	addTestBlocks(t, srcIdx, blocks)
+	connectTestBlocksBatched(t, srcIdx, blocks, 10)
+
+	// Add a ticket commitment amount since the test blocks do not contain
+	// any ticket purchases.
+	var commitmentKey [addrCommitmentKeySize]byte
+	addrKey, err := srcIdx.keyForAddr(testP2PKHAddr(t, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(commitmentKey[:], addrKey[:])
+	commitmentKey[addrKeySize] = 0x01
+	commitmentBlock := blocks[5].Hash()
+	err = srcIdx.db.Update(func(dbTx database.Tx) error {
+		blockID, err := dbFetchBlockIDByHash(dbTx, commitmentBlock)
+		if err != nil {
+			return err
+		}
+		commitments := map[[addrCommitmentKeySize]byte]int64{
+			commitmentKey: 12345,
+		}
+		return dbPutAddrCommitments(dbTx, blockID, commitments)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	ctx := context.Background()
+	if err := srcIdx.Export(ctx, &dump); err != nil {
+		t.Fatalf("unable to export address index: %v", err)
+	}
+
+	// Ensure exporting with a canceled context is interrupted.
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = srcIdx.Export(canceledCtx, &bytes.Buffer{})
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected export error with canceled context: got %v, "+
+			"want %v", err, errInterruptRequested)
+	}
+
+	// Ensure importing into a database that uses the same internal block IDs
+	// produces an identical index.
+	dstIdx, teardown2 := newTestAddrIndex(t, "test_addrindex_import")
+	defer teardown2()
+	addTestBlocks(t, dstIdx, blocks)
+	err = ImportAddrIndex(ctx, dstIdx.db, bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("unable to import address index: %v", err)
+	}
+	want, got := dumpAddrIndex(t, srcIdx), dumpAddrIndex(t, dstIdx)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("imported address index does not match the exported one")
+	}
+	wantCompanions := dumpAddrIndexCompanions(t, srcIdx)
+	if len(wantCompanions[string(addrCommitmentIndexKey)]) != 1 {
+		t.Fatal("exported address index is missing companion data")
+	}
+	gotCompanions := dumpAddrIndexCompanions(t, dstIdx)
+	if !reflect.DeepEqual(gotCompanions, wantCompanions) {
+		t.Fatal("imported companion buckets do not match the exported ones")
+	}
+	err = dstIdx.db.View(func(dbTx database.Tx) error {
+		version, err := dbFetchIndexerVersion(dbTx, addrIndexKey)
+		if err != nil {
+			return err
+		}
+		if version != addrIndexVersion {
+			t.Fatalf("unexpected imported index version: got %d, want %d",
+				version, addrIndexVersion)
+		}
+		tipsBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		if tipsBucket.Get(indexDropKey(addrIndexKey)) != nil {
+			t.Fatal("drop marker still set after import")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure importing into a database that uses different internal block
+	// IDs produces the same entries.
+	offsetIdx, teardown3 := newTestAddrIndex(t, "test_addrindex_import_offset")
+	defer teardown3()
+	for i, block := range blocks {
+		err := offsetIdx.chain.(*testChain).AddBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = offsetIdx.db.Update(func(dbTx database.Tx) error {
+			return dbPutBlockIDIndexEntry(dbTx, block.Hash(), uint32(i+500))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ImportAddrIndex(ctx, offsetIdx.db, bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("unable to import address index: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		addr := testP2PKHAddr(t, byte(i))
+		wantEntries, _, err := srcIdx.EntriesForAddress(nil, addr, 0,
+			numBlocks, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotEntries, _, err := offsetIdx.EntriesForAddress(nil, addr, 0,
+			numBlocks, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gotEntries) != numBlocks {
+			t.Fatalf("unexpected number of entries for %v: got %d, want %d",
+				addr, len(gotEntries), numBlocks)
+		}
+		if !reflect.DeepEqual(gotEntries, wantEntries) {
+			t.Fatalf("mismatched entries for %v after import", addr)
+		}
+	}
+
+	// Ensure the ticket commitment amount refers to its block by the internal
+	// block ID of the database it was imported into.
+	err = offsetIdx.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Bucket(addrCommitmentIndexKey).Get(
+			commitmentKey[:])
+		if len(serialized) != addrCommitmentEntrySize {
+			t.Fatalf("unexpected imported ticket commitment %x", serialized)
+		}
+		if gotID := byteOrder.Uint32(serialized[0:4]); gotID != 505 {
+			t.Fatalf("unexpected imported ticket commitment block ID: got "+
+				"%d, want %d", gotID, 505)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure importing data that is not a dump fails without modifying the
+	// existing index.
+	err = ImportAddrIndex(ctx, dstIdx.db, bytes.NewReader([]byte("bogus data")))
+	if !isDeserializeErr(err) {
+		t.Fatalf("unexpected import error for invalid dump: %v", err)
+	}
+	if !reflect.DeepEqual(dumpAddrIndex(t, dstIdx), want) {
+		t.Fatal("address index modified by invalid dump")
+	}
+
+	// Ensure importing a truncated dump fails and leaves the index marked to
+	// be dropped.
+	truncated := dump.Bytes()[:dump.Len()-100]
+	err = ImportAddrIndex(ctx, dstIdx.db, bytes.NewReader(truncated))
+	if err == nil {
+		t.Fatal("import of truncated dump did not fail")
+	}
+	err = dstIdx.db.View(func(dbTx database.Tx) error {
+		tipsBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		if tipsBucket.Get(indexDropKey(addrIndexKey)) == nil {
+			t.Fatal("drop marker not set after failed import")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dumpAddrIndexCompanions returns the contents of the companion buckets of the
+// provided address index keyed by the bucket key.
+func dumpAddrIndexCompanions(t *testing.T, idx *AddrIndex) map[string]map[string][]byte {
+	t.Helper()
+
+	results := make(map[string]map[string][]byte)
+	err := idx.db.View(func(dbTx database.Tx) error {
+		for _, bucketKey := range addrIndexDumpCompanionBuckets {
+			contents := make(map[string][]byte)
+			bucket := dbTx.Metadata().Bucket(bucketKey)
+			err := bucket.ForEach(func(k, v []byte) error {
+				contents[string(k)] = append([]byte(nil), v...)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			results[string(bucketKey)] = contents
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// TestAddrIndexEntryLayout ensures the entry layout descriptor correctly
+// describes both the entries stored in the database and the entries of address
+// index dumps.
+func TestAddrIndexEntryLayout(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_entrylayout")
+	defer teardown()
+
+	layout := idx.EntryLayout()
+	if layout.IndexVersion != addrIndexVersion {
+		t.Fatalf("unexpected index version: got %d, want %d",
+			layout.IndexVersion, addrIndexVersion)
+	}
+
+	// field returns the value of the provided field of a serialized entry.
+	field := func(serialized []byte, f AddrIndexEntryField) uint32 {
+		var buf [4]byte
+		copy(buf[:], serialized[f.Offset:f.Offset+f.Size])
+		return byteOrder.Uint32(buf[:])
+	}
+
+	// bits returns the value of the provided bit field of a block index and
+	// flags field.
+	bits := func(flags uint32, b AddrIndexEntryBits) uint32 {
+		return (flags & b.Mask) >> b.Shift
+	}
+
+	// Ensure the fields of an entry stored in the database are decoded
+	// correctly.
+	const blockID, blockIndex = 123, 45
+	txLoc := wire.TxLoc{TxStart: 1000, TxLen: 250}
+	flags := blockIndex | encodeEntryTree(wire.TxTreeStake) |
+		encodeEntryStakeTags(StakeTagGen) | encodeEntryTxClass(TxClassVote) |
+		encodeEntryOutputKind(OutputKindChange) | encodeEntryCredit(true)
+	serialized := serializeAddrIndexEntry(blockID, txLoc, flags)
+	if len(serialized) != layout.EntrySize {
+		t.Fatalf("unexpected entry size: got %d, want %d", len(serialized),
+			layout.EntrySize)
+	}
+	gotFlags := field(serialized, layout.BlockIndexFlags)
+	tests := []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"block id", field(serialized, layout.BlockID), blockID},
+		{"tx start", field(serialized, layout.TxStart), uint32(txLoc.TxStart)},
+		{"tx len", field(serialized, layout.TxLen), uint32(txLoc.TxLen)},
+		{"entry version", field(serialized, layout.EntryVersion),
+			entryVersion},
+		{"block index", bits(gotFlags, layout.BlockIndex), blockIndex},
+		{"tree", bits(gotFlags, layout.Tree), entryTreeStake},
+		{"stake tags", bits(gotFlags, layout.StakeTags), uint32(StakeTagGen)},
+		{"tx class", bits(gotFlags, layout.TxClass), uint32(TxClassVote)},
+		{"output kind", bits(gotFlags, layout.OutputKind),
+			uint32(OutputKindChange)},
+		{"credit", bits(gotFlags, layout.Credit), 1},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Fatalf("%s: unexpected value: got %d, want %d", test.name,
+				test.got, test.want)
+		}
+	}
+
+	// Ensure the fields of the first entry of a dump of an index with a single
+	// block are decoded correctly.
+	blocks := newTestReindexBlocks(t, 1, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 1)
+	var dump bytes.Buffer
+	if err := idx.Export(context.Background(), &dump); err != nil {
+		t.Fatalf("unable to export address index: %v", err)
+	}
+	dumpVersion := byteOrder.Uint32(dump.Bytes()[len(addrIndexDumpMagic):])
+	if dumpVersion != layout.DumpVersion {
+		t.Fatalf("unexpected dump version: got %d, want %d", dumpVersion,
+			layout.DumpVersion)
+	}
+
+	// The first entry follows the record type, the address key, and the
+	// single byte number of entries of the first record.
+	offset := layout.DumpHeaderSize + 1 + addrKeySize + 1
+	entry := dump.Bytes()[offset : offset+layout.DumpEntrySize]
+	hashField := layout.DumpBlockHash
+	gotHash := entry[hashField.Offset : hashField.Offset+hashField.Size]
+	if !bytes.Equal(gotHash, blocks[0].Hash()[:]) {
+		t.Fatalf("unexpected block hash: got %x, want %s", gotHash,
+			blocks[0].Hash())
+	}
+	txLocs, _, err := blocks[0].TxLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotFlags = field(entry, layout.DumpBlockIndexFlags)
+	tests = []struct {
+		name string
+		got  uint32
+		want uint32
+	}{
+		{"dump block height", field(entry, layout.DumpBlockHeight), 1},
+		{"dump tx start", field(entry, layout.DumpTxStart),
+			uint32(txLocs[0].TxStart)},
+		{"dump tx len", field(entry, layout.DumpTxLen),
+			uint32(txLocs[0].TxLen)},
+		{"dump block index", bits(gotFlags, layout.BlockIndex), 0},
+		{"dump tree", bits(gotFlags, layout.Tree), entryTreeRegular},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Fatalf("%s: unexpected value: got %d, want %d", test.name,
+				test.got, test.want)
+		}
+	}
+}
+
+// TestMergeAddrIndex ensures comparing the address indexes of two databases
+// succeeds when they have the same entries regardless of their internal block
+// IDs and reports the first divergence otherwise.
+func TestMergeAddrIndex(t *testing.T) {
+	t.Parallel()
+
+	// Build the same index in two databases that use different internal block
+	// IDs and connect the blocks in different batch sizes.
+	const numBlocks = 20
+	srcIdx, teardown := newTestAddrIndex(t, "test_addrindex_merge_src")
+	defer teardown()
+	blocks := newTestReindexBlocks(t, numBlocks,
+		&srcIdx.chainParams.GenesisHash)
+	addTestBlocks(t, srcIdx, blocks)
+	connectTestBlocksBatched(t, srcIdx, blocks, 10)
+	dstIdx, teardown2 := newTestAddrIndex(t, "test_addrindex_merge_dst")
+	defer teardown2()
+	for i, block := range blocks {
+		err := dstIdx.chain.(*testChain).AddBlock(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = dstIdx.db.Update(func(dbTx database.Tx) error {
+			return dbPutBlockIDIndexEntry(dbTx, block.Hash(), uint32(i+500))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	connectTestBlocksBatched(t, dstIdx, blocks, 1)
+
+	// Ensure databases that do not contain the genesis block of the network
+	// are rejected.
+	ctx := context.Background()
+	params := srcIdx.chainParams
+	err := MergeAddrIndex(ctx, dstIdx.db, srcIdx.db, params)
+	if err == nil || errors.Is(err, ErrAddrIndexDivergence) {
+		t.Fatalf("unexpected error without genesis block: %v", err)
+	}
+	genesis := dcrutil.NewBlock(params.GenesisBlock)
+	for _, db := range []database.DB{srcIdx.db, dstIdx.db} {
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbTx.StoreBlock(genesis)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure identical indexes do not diverge and canceled contexts interrupt
+	// the comparison.
+	if err := MergeAddrIndex(ctx, dstIdx.db, srcIdx.db, params); err != nil {
+		t.Fatalf("unexpected error for identical indexes: %v", err)
+	}
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = MergeAddrIndex(canceledCtx, dstIdx.db, srcIdx.db, params)
+	if !errors.Is(err, errInterruptRequested) {
+		t.Fatalf("unexpected error with canceled context: got %v, want %v",
+			err, errInterruptRequested)
+	}
+
+	// Ensure an entry that differs is reported as a divergence.
+	addrKey, err := addrToKey(testP2PKHAddr(t, 0x01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	levelKey := keyForLevel(addrKey, 0)
+	var origLevel []byte
+	err = dstIdx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		origLevel = append([]byte(nil), bucket.Get(levelKey[:])...)
+		modified := append([]byte(nil), origLevel...)
+		modified[8]++
+		return bucket.Put(levelKey[:], modified)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MergeAddrIndex(ctx, dstIdx.db, srcIdx.db, params)
+	if !errors.Is(err, ErrAddrIndexDivergence) {
+		t.Fatalf("unexpected error for modified entry: got %v, want %v", err,
+			ErrAddrIndexDivergence)
+	}
+	err = dstIdx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		return bucket.Put(levelKey[:], origLevel)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure addresses that only have entries in one of the databases are
+	// reported as a divergence in both directions.
+	err = dstIdx.db.Update(func(dbTx database.Tx) error {
+		return dstIdx.DeleteAddress(dbTx, testP2PKHAddr(t, 0x02))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		dst, src database.DB
+	}{
+		{dstIdx.db, srcIdx.db},
+		{srcIdx.db, dstIdx.db},
+	} {
+		err := MergeAddrIndex(ctx, test.dst, test.src, params)
+		if !errors.Is(err, ErrAddrIndexDivergence) {
+			t.Fatalf("unexpected error for missing address: got %v, want %v",
+				err, ErrAddrIndexDivergence)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+
+	"github.com/decred/dcrd/database/v3"
+)
+
+const (
+	// addrFilterCountersPerAddr is the number of counters the address filter
+	// allocates per expected address.
+	addrFilterCountersPerAddr = 10
+
+	// addrFilterNumHashes is the number of counters each address key maps to
+	// in the address filter.  It is the optimal number of hash functions for
+	// the number of counters per address, which is ln(2) times the number of
+	// counters per address rounded to the nearest integer.
+	addrFilterNumHashes = 7
+)
+
+// addrFilter is an in-memory counting bloom filter of the address keys that
+// have entries in the address index.  It allows the index to definitively
+// determine that an address does not have any entries without accessing the
+// database.
+//
+// A counting variant is used so that the entries removed when blocks are
+// disconnected can also be removed from the filter.  Each counter tracks the
+// number of index entries for the address keys that map to it and saturates
+// at its maximum value, at which point it is never decremented again since the
+// true count is no longer known.  This ensures the filter never reports false
+// negatives.
+//
+// The filter is sized for a given number of expected distinct addresses using
+// addrFilterCountersPerAddr counters per address and addrFilterNumHashes
+// counters per address key which results in a false positive rate of roughly
+// 0.8% when the number of distinct addresses in the index matches the expected
+// number.  The rate increases as more addresses are added beyond that, for
+// example, to roughly 14% at twice the expected number.  Each counter consumes
+// a single byte.
+//
+// The filter is safe for concurrent access.  A nil filter is treated as
+// disabled and may contain every address key.
+type addrFilter struct {
+	mtx      sync.RWMutex
+	counters []uint8
+}
+
+// newAddrFilter returns a new empty address filter sized for the provided
+// expected number of distinct addresses.
+func newAddrFilter(numAddrs uint32) *addrFilter {
+	numCounters := uint64(numAddrs) * addrFilterCountersPerAddr
+	if numCounters == 0 {
+		numCounters = addrFilterCountersPerAddr
+	}
+	return &addrFilter{counters: make([]uint8, numCounters)}
+}
+
+// counterIndexes returns the indexes of the counters the provided address key
+// maps to.  The indexes are derived from two independent halves of a single
+// hash of the key via enhanced double hashing.
+func (f *addrFilter) counterIndexes(addrKey [addrKeySize]byte) [addrFilterNumHashes]uint64 {
+	hasher := fnv.New64a()
+	hasher.Write(addrKey[:])
+	sum := hasher.Sum64()
+	h1, h2 := sum>>32, sum&math.MaxUint32
+
+	var indexes [addrFilterNumHashes]uint64
+	numCounters := uint64(len(f.counters))
+	for i := uint64(0); i < addrFilterNumHashes; i++ {
+		indexes[i] = (h1 + i*h2 + (i*i*i-i)/6) % numCounters
+	}
+	return indexes
+}
+
+// add records the provided number of additional index entries for the provided
+// address key in the filter.
+func (f *addrFilter) add(addrKey [addrKeySize]byte, numEntries int) {
+	if f == nil || numEntries <= 0 {
+		return
+	}
+
+	indexes := f.counterIndexes(addrKey)
+	f.mtx.Lock()
+	for _, i := range indexes {
+		counter := int(f.counters[i]) + numEntries
+		if counter > math.MaxUint8 {
+			counter = math.MaxUint8
+		}
+		f.counters[i] = uint8(counter)
+	}
+	f.mtx.Unlock()
+}
+
+// remove records the removal of the provided number of index entries for the
+// provided address key from the filter.  Saturated counters are not modified.
+func (f *addrFilter) remove(addrKey [addrKeySize]byte, numEntries int) {
+	if f == nil || numEntries <= 0 {
+		return
+	}
+
+	indexes := f.counterIndexes(addrKey)
+	f.mtx.Lock()
+	for _, i := range indexes {
+		counter := int(f.counters[i])
+		if counter == math.MaxUint8 {
+			continue
+		}
+		counter -= numEntries
+		if counter < 0 {
+			counter = 0
+		}
+		f.counters[i] = uint8(counter)
+	}
+	f.mtx.Unlock()
+}
+
+// mayContain returns false when the provided address key definitely does not
+// have any entries in the index.  Otherwise, it returns true, which means the
+// address key might have entries.
+func (f *addrFilter) mayContain(addrKey [addrKeySize]byte) bool {
+	if f == nil {
+		return true
+	}
+
+	indexes := f.counterIndexes(addrKey)
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+	for _, i := range indexes {
+		if f.counters[i] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// loadAddrFilter returns a new address filter sized for the provided expected
+// number of distinct addresses that is populated with all of the entries that
+// are currently in the address index.
+func loadAddrFilter(ctx context.Context, db database.DB, numAddrs uint32) (*addrFilter, error) {
+	filter := newAddrFilter(numAddrs)
+	err := db.View(func(dbTx database.Tx) error {
+		cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			if interruptRequested(ctx) {
+				return errInterruptRequested
+			}
+
+			key := cursor.Key()
+			if len(key) != levelKeySize {
+				continue
+			}
+
+			var addrKey [addrKeySize]byte
+			copy(addrKey[:], key[:addrKeySize])
+			filter.add(addrKey, len(cursor.Value())/txEntrySize)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
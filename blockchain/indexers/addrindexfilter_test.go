@@ -0,0 +1,242 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/txscript/v4/stdaddr"
+)
+
+// TestAddrFilter ensures the address filter tracks additions and removals of
+// address keys including when its counters saturate and that a nil filter is
+// treated as disabled.
+func TestAddrFilter(t *testing.T) {
+	t.Parallel()
+
+	var nilFilter *addrFilter
+	var key1, key2 [addrKeySize]byte
+	key1[0], key2[0] = addrKeyTypePubKeyHash, addrKeyTypeScriptHash
+	nilFilter.add(key1, 1)
+	nilFilter.remove(key1, 1)
+	if !nilFilter.mayContain(key1) {
+		t.Fatal("nil filter does not contain key")
+	}
+
+	filter := newAddrFilter(100)
+	if filter.mayContain(key1) || filter.mayContain(key2) {
+		t.Fatal("empty filter contains key")
+	}
+
+	// Ensure a key is contained until all of its entries are removed.
+	filter.add(key1, 2)
+	if !filter.mayContain(key1) {
+		t.Fatal("filter does not contain added key")
+	}
+	if filter.mayContain(key2) {
+		t.Fatal("filter contains key that was not added")
+	}
+	filter.remove(key1, 1)
+	if !filter.mayContain(key1) {
+		t.Fatal("filter does not contain key with remaining entries")
+	}
+	filter.remove(key1, 1)
+	if filter.mayContain(key1) {
+		t.Fatal("filter contains key with all entries removed")
+	}
+
+	// Ensure saturated counters are never decremented.
+	filter.add(key2, math.MaxUint8+1)
+	filter.remove(key2, math.MaxUint8+1)
+	if !filter.mayContain(key2) {
+		t.Fatal("filter does not contain key with saturated counters")
+	}
+}
+
+// TestAddrIndexAddrFilter ensures the address filter is populated from the
+// existing entries of the address index, is updated as blocks are connected and
+// disconnected, and allows queries for addresses without any entries to be
+// answered without accessing the database.
+func TestAddrIndexAddrFilter(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_addrfilter")
+	defer teardown()
+
+	// Connect all but the final block and load the filter from the existing
+	// entries.
+	const numBlocks = 20
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks[:numBlocks-1], 10)
+	filter, err := loadAddrFilter(context.Background(), idx.db, 1000)
+	if err != nil {
+		t.Fatalf("unable to load address filter: %v", err)
+	}
+	idx.addrFilter = filter
+
+	// uniqueAddr returns the unique address paid by the block at the provided
+	// height.
+	uniqueAddr := func(height uint32) stdaddr.Address {
+		var hash160 [20]byte
+		byteOrder.PutUint32(hash160[:], height)
+		addr, err := stdaddr.NewAddressScriptHashV0FromHash(hash160[:],
+			chaincfg.SimNetParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+
+	// checkHasAddr ensures the filter and the index agree about whether or
+	// not the provided address has entries.
+	checkHasAddr := func(addr stdaddr.Address, want bool) {
+		t.Helper()
+
+		addrKey, err := addrToKey(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := idx.addrFilter.mayContain(addrKey); got != want {
+			t.Fatalf("unexpected filter result for %s: got %v, want %v",
+				addr, got, want)
+		}
+		err = idx.db.View(func(dbTx database.Tx) error {
+			hasAddr, err := idx.HasAddress(dbTx, addr)
+			if err != nil {
+				return err
+			}
+			if hasAddr != want {
+				t.Fatalf("unexpected has address result for %s: got %v, "+
+					"want %v", addr, hasAddr, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for height := uint32(1); height < numBlocks; height++ {
+		checkHasAddr(uniqueAddr(height), true)
+	}
+	checkHasAddr(testP2PKHAddr(t, 0), true)
+	checkHasAddr(uniqueAddr(numBlocks), false)
+
+	// Ensure queries for an address that is not in the filter do not access
+	// the database by providing a nil database transaction.
+	hasAddr, err := idx.HasAddress(nil, uniqueAddr(numBlocks))
+	if err != nil || hasAddr {
+		t.Fatalf("unexpected has address result: %v (err %v)", hasAddr, err)
+	}
+	entries, skipped, err := idx.EntriesForAddress(nil, uniqueAddr(numBlocks),
+		0, 10, false)
+	if err != nil || len(entries) != 0 || skipped != 0 {
+		t.Fatalf("unexpected entries result: %d entries, %d skipped (err %v)",
+			len(entries), skipped, err)
+	}
+
+	// Ensure connecting the final block adds its address to the filter.
+	connectTestBlocksBatched(t, idx, blocks[numBlocks-1:], 1)
+	checkHasAddr(uniqueAddr(numBlocks), true)
+
+	// Ensure disconnecting the final block removes its address from the filter
+	// while the addresses shared with other blocks remain.
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, blocks[numBlocks-1],
+			blocks[numBlocks-2], testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHasAddr(uniqueAddr(numBlocks), false)
+	for i := 0; i < 4; i++ {
+		checkHasAddr(testP2PKHAddr(t, byte(i)), true)
+	}
+}
+
+// TestAddrIndexAddrFilterRollback ensures the address filter is only updated
+// once the database transaction that modifies the index is committed so that
+// rolled back updates never cause it to report false negatives.
+func TestAddrIndexAddrFilterRollback(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_addrfilterrollback")
+	defer teardown()
+	idx.addrFilter = newAddrFilter(1000)
+
+	const numBlocks = 2
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	addTestBlocks(t, idx, blocks)
+	connectTestBlocksBatched(t, idx, blocks, 1)
+
+	// The address key of the unique address paid by the final block.
+	var hash160 [20]byte
+	byteOrder.PutUint32(hash160[:], numBlocks)
+	addr, err := stdaddr.NewAddressScriptHashV0FromHash(hash160[:],
+		chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrKey, err := addrToKey(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFilter := func(desc string, want bool) {
+		t.Helper()
+		if got := idx.addrFilter.mayContain(addrKey); got != want {
+			t.Fatalf("%s: unexpected filter result: got %v, want %v", desc,
+				got, want)
+		}
+	}
+	checkFilter("initial", true)
+
+	// Ensure the filter is not updated by a disconnect before it is
+	// committed nor when it is rolled back.
+	errRollback := errors.New("rollback")
+	disconnectTip := func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, blocks[1], blocks[0],
+			testPrevScripter{}, false)
+	}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		if err := disconnectTip(dbTx); err != nil {
+			return err
+		}
+		checkFilter("uncommitted disconnect", true)
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFilter("rolled back disconnect", true)
+
+	// Ensure the filter is updated once the disconnect is committed.
+	if err := idx.db.Update(disconnectTip); err != nil {
+		t.Fatal(err)
+	}
+	checkFilter("committed disconnect", false)
+
+	// Ensure the filter is not updated by a connect that is rolled back.
+	batch := []connectBlockData{{block: blocks[1],
+		prevScripts: testPrevScripter{}}}
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		if err := idx.connectBlocks(dbTx, batch); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkFilter("rolled back connect", false)
+
+	// Ensure the filter is updated once the connect is committed.
+	connectTestBlocksBatched(t, idx, blocks[1:], 1)
+	checkFilter("committed connect", true)
+}
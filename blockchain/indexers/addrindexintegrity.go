@@ -0,0 +1,215 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/database/v3"
+)
+
+const (
+	// integrityScanBatchSize is the maximum number of addresses that are
+	// visited within a single database transaction by the integrity scanner.
+	// This bounds how long each read transaction is held open.
+	integrityScanBatchSize = 1000
+
+	// integrityIssueBufferSize is the number of integrity issues that may be
+	// buffered in the channel returned by ScanIntegrity before the scanner
+	// waits for the caller to receive them.
+	integrityIssueBufferSize = 16
+)
+
+// IntegrityIssue describes a problem with the entries of an address that was
+// discovered by the integrity scanner.
+type IntegrityIssue struct {
+	// AddrKey is the key of the address the issue is for.  It consists of a
+	// single byte that identifies the type of the address followed by its
+	// hash160.  It is all zeros when the issue is a failure of the scan
+	// itself.
+	AddrKey [addrKeySize]byte
+
+	// Err describes the issue.
+	Err error
+}
+
+// nextAddrKeyPrefix returns the smallest key that sorts after the keys of all
+// of the levels of the provided address key.  The final return value is false
+// when there are no such keys because the address key is the largest one
+// possible.
+func nextAddrKeyPrefix(addrKey [addrKeySize]byte) ([]byte, bool) {
+	next := make([]byte, addrKeySize)
+	copy(next, addrKey[:])
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next, true
+		}
+	}
+	return nil, false
+}
+
+// dbForEachAddrKeyBatch invokes the provided callback for each distinct address
+// key in the index that is greater than or equal to the provided start key in
+// ascending order until the provided maximum number of address keys have been
+// visited.  It returns the key to resume from in order to visit the next batch
+// along with whether or not there are any more address keys to visit.
+func dbForEachAddrKeyBatch(dbTx database.Tx, start []byte, max int, fn func(addrKey [addrKeySize]byte) error) ([]byte, bool, error) {
+	var numVisited int
+	cursor := dbTx.Metadata().Bucket(addrIndexKey).Cursor()
+	for ok := cursor.Seek(start); ok; {
+		key := cursor.Key()
+		if len(key) != levelKeySize {
+			ok = cursor.Next()
+			continue
+		}
+
+		var addrKey [addrKeySize]byte
+		copy(addrKey[:], key[:addrKeySize])
+		if err := fn(addrKey); err != nil {
+			return nil, false, err
+		}
+
+		// Skip the remaining levels of the address key.
+		next, more := nextAddrKeyPrefix(addrKey)
+		if !more {
+			return nil, false, nil
+		}
+		numVisited++
+		if numVisited == max {
+			return next, true, nil
+		}
+		ok = cursor.Seek(next)
+	}
+	return nil, false, nil
+}
+
+// ScanIntegrity checks the entries of every address in the index for
+// corruption in the background and returns a channel that the discovered
+// issues are sent on.  The checks are the same ones performed by
+// RepairCorruptedAddress, namely that the levels have valid sizes and that
+// every entry references a block ID that is known to the index.
+//
+// The index is walked in batches of addresses that each use a separate read
+// transaction, so the scan does not hold a single large read transaction open
+// for the entire duration.  As a result, the scan does not observe a single
+// consistent view of the index, however, this is acceptable for detecting
+// corruption since each address is checked within a single transaction.
+//
+// The provided progress callback, which may be nil, is invoked after each
+// batch with the number of addresses that have been checked and the total
+// number of addresses, which is determined by an initial pass over the keys
+// of the index that is also done in batches.
+//
+// The channel is closed once the scan completes or the provided context is
+// canceled.  When the scan itself fails, such as due to a database error, a
+// final issue with an all zero address key and the error is sent before the
+// channel is closed.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) ScanIntegrity(ctx context.Context, progress func(done, total int)) (<-chan IntegrityIssue, error) {
+	err := idx.db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(addrIndexKey) == nil {
+			return fmt.Errorf("%s bucket does not exist", addrIndexName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	issues := make(chan IntegrityIssue, integrityIssueBufferSize)
+	go func() {
+		defer close(issues)
+		if err := idx.scanIntegrity(ctx, progress, issues); err != nil {
+			if errors.Is(err, errInterruptRequested) {
+				return
+			}
+			select {
+			case issues <- IntegrityIssue{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return issues, nil
+}
+
+// scanIntegrity performs the integrity scan described by ScanIntegrity and
+// sends the discovered issues on the provided channel.
+func (idx *AddrIndex) scanIntegrity(ctx context.Context, progress func(done, total int), issues chan<- IntegrityIssue) error {
+	// Count the addresses so progress can be reported.
+	var total int
+	start := []byte{}
+	for more := true; more; {
+		if interruptRequested(ctx) {
+			return errInterruptRequested
+		}
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			start, more, err = dbForEachAddrKeyBatch(dbTx, start,
+				integrityScanBatchSize, func([addrKeySize]byte) error {
+					total++
+					return nil
+				})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check the entries of each address in batches and send the issues
+	// once each batch is complete so the read transaction is not held open
+	// while waiting for the caller to receive them.
+	var done int
+	start = []byte{}
+	for more := true; more; {
+		if interruptRequested(ctx) {
+			return errInterruptRequested
+		}
+		var batchIssues []IntegrityIssue
+		err := idx.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(addrIndexKey)
+			var err error
+			start, more, err = dbForEachAddrKeyBatch(dbTx, start,
+				integrityScanBatchSize, func(addrKey [addrKeySize]byte) error {
+					done++
+					err := dbCheckAddrIndexEntries(dbTx, bucket, addrKey)
+					if err == nil {
+						return nil
+					}
+					var dbErr database.Error
+					if !errors.As(err, &dbErr) ||
+						dbErr.Err != database.ErrCorruption {
+
+						return err
+					}
+					batchIssues = append(batchIssues, IntegrityIssue{
+						AddrKey: addrKey,
+						Err:     err,
+					})
+					return nil
+				})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, issue := range batchIssues {
+			select {
+			case issues <- issue:
+			case <-ctx.Done():
+				return errInterruptRequested
+			}
+		}
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	return nil
+}
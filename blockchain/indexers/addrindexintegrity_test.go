@@ -0,0 +1,150 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/wire"
+)
+
+// TestAddrIndexScanIntegrity ensures the integrity scanner visits every
+// address in batches, reports the addresses with corrupt entries along with
+// its progress, and stops when its context is canceled.
+func TestAddrIndexScanIntegrity(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_integrity")
+	defer teardown()
+
+	// Connect blocks that each pay several addresses.
+	const numAddrs = 5
+	var pkScripts [][]byte
+	for i := 0; i < numAddrs; i++ {
+		_, pkScript := testP2PKHAddr(t, byte(i+1)).PaymentScript()
+		pkScripts = append(pkScripts, pkScript)
+	}
+	const numBlocks = 4
+	prevHash := &idx.chainParams.GenesisHash
+	for height := uint32(1); height <= numBlocks; height++ {
+		txns := []*wire.MsgTx{newTestCoinbase(height, pkScripts...)}
+		block := newTestBlock(height, prevHash, txns, nil)
+		connectTestBlock(t, idx, block, height, testPrevScripter{}, false)
+		prevHash = block.Hash()
+	}
+
+	// Ensure walking the address keys in batches smaller than the number of
+	// addresses visits each of them exactly once and in order.
+	var visited [][addrKeySize]byte
+	start := []byte{}
+	for more := true; more; {
+		err := idx.db.View(func(dbTx database.Tx) error {
+			var err error
+			start, more, err = dbForEachAddrKeyBatch(dbTx, start, 2,
+				func(addrKey [addrKeySize]byte) error {
+					visited = append(visited, addrKey)
+					return nil
+				})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(visited) != numAddrs {
+		t.Fatalf("unexpected number of visited addresses: got %d, want %d",
+			len(visited), numAddrs)
+	}
+	for i := 0; i < numAddrs; i++ {
+		wantKey, err := addrToKey(testP2PKHAddr(t, byte(i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visited[i] != wantKey {
+			t.Fatalf("unexpected address key %d: got %x, want %x", i,
+				visited[i], wantKey)
+		}
+	}
+
+	// scan runs the integrity scanner to completion and returns the issues
+	// along with the final reported progress.
+	scan := func() ([]IntegrityIssue, int, int) {
+		t.Helper()
+
+		var done, total int
+		issuesChan, err := idx.ScanIntegrity(context.Background(),
+			func(d, n int) { done, total = d, n })
+		if err != nil {
+			t.Fatalf("unable to start scan: %v", err)
+		}
+		var issues []IntegrityIssue
+		for issue := range issuesChan {
+			issues = append(issues, issue)
+		}
+		return issues, done, total
+	}
+
+	// Ensure an index without corruption does not report any issues.
+	issues, done, total := scan()
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+	if done != numAddrs || total != numAddrs {
+		t.Fatalf("unexpected progress: got %d/%d, want %d/%d", done, total,
+			numAddrs, numAddrs)
+	}
+
+	// Corrupt the size of a level of one address and ensure it is the only
+	// one reported.
+	corruptKey := visited[2]
+	err := idx.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(addrIndexKey)
+		levelKey := keyForLevel(corruptKey, 0)
+		levelData := append([]byte(nil), bucket.Get(levelKey[:])...)
+		return bucket.Put(levelKey[:], levelData[:len(levelData)-3])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues, done, total = scan()
+	if len(issues) != 1 {
+		t.Fatalf("unexpected number of issues: got %d, want 1", len(issues))
+	}
+	if issues[0].AddrKey != corruptKey {
+		t.Fatalf("unexpected address key: got %x, want %x",
+			issues[0].AddrKey, corruptKey)
+	}
+	var dbErr database.Error
+	if !errors.As(issues[0].Err, &dbErr) ||
+		dbErr.Err != database.ErrCorruption {
+
+		t.Fatalf("unexpected error: %v", issues[0].Err)
+	}
+	if done != numAddrs || total != numAddrs {
+		t.Fatalf("unexpected progress: got %d/%d, want %d/%d", done, total,
+			numAddrs, numAddrs)
+	}
+
+	// Ensure a scan with a canceled context closes the channel without
+	// reporting any progress.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var progressed bool
+	issuesChan, err := idx.ScanIntegrity(ctx, func(int, int) {
+		progressed = true
+	})
+	if err != nil {
+		t.Fatalf("unable to start scan: %v", err)
+	}
+	for issue := range issuesChan {
+		t.Fatalf("unexpected issue after cancellation: %v", issue)
+	}
+	if progressed {
+		t.Fatal("progress reported after cancellation")
+	}
+}
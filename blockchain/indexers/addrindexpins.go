@@ -0,0 +1,138 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"sync"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+)
+
+// pinnedAddr houses the cached serialized entries of a pinned address along
+// with the index tip they were loaded at.  The serialized entries are nil when
+// they have not been loaded or were invalidated.
+type pinnedAddr struct {
+	tip        chainhash.Hash
+	serialized []byte
+}
+
+// addrPinCache is an in-memory cache of the merged serialized entries of an
+// explicit set of pinned addresses, which allows the entries of frequently
+// queried addresses with many levels to be served without loading and merging
+// all of their levels from the database.
+//
+// Since the database only provides snapshot isolation, the cached entries are
+// tagged with the index tip they were loaded at and are only used by queries
+// made against the same tip.  Entries that are modified by an update to the
+// index are invalidated and marked dirty once the update is committed until the
+// tip is advanced, which prevents concurrent queries against the prior tip from
+// caching the entries in between.  Once the tip is advanced, the remaining
+// entries that were loaded at the prior tip were not modified by the update, so
+// they are carried forward to the new tip.  Invalidating and advancing only
+// after the update is committed ensures updates that are rolled back never
+// affect the cache.
+//
+// The cache is safe for concurrent access.
+type addrPinCache struct {
+	mtx   sync.Mutex
+	addrs map[[addrKeySize]byte]*pinnedAddr
+	dirty map[[addrKeySize]byte]struct{}
+}
+
+// newAddrPinCache returns a new empty address pin cache.
+func newAddrPinCache() *addrPinCache {
+	return &addrPinCache{
+		addrs: make(map[[addrKeySize]byte]*pinnedAddr),
+		dirty: make(map[[addrKeySize]byte]struct{}),
+	}
+}
+
+// pin adds the provided address key to the set of pinned addresses.  Pinning
+// an address that is already pinned has no effect.
+func (c *addrPinCache) pin(addrKey [addrKeySize]byte) {
+	c.mtx.Lock()
+	if _, ok := c.addrs[addrKey]; !ok {
+		c.addrs[addrKey] = &pinnedAddr{}
+	}
+	c.mtx.Unlock()
+}
+
+// unpin removes the provided address key from the set of pinned addresses
+// along with its cached entries.
+func (c *addrPinCache) unpin(addrKey [addrKeySize]byte) {
+	c.mtx.Lock()
+	delete(c.addrs, addrKey)
+	c.mtx.Unlock()
+}
+
+// lookup returns the cached serialized entries for the provided address key
+// that were loaded at the provided index tip.  The returned data MUST NOT be
+// modified.
+//
+// The first flag indicates whether or not the address is pinned and the second
+// one indicates whether or not the cached entries were found.
+func (c *addrPinCache) lookup(addrKey [addrKeySize]byte, tip *chainhash.Hash) ([]byte, bool, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	pinned, ok := c.addrs[addrKey]
+	if !ok {
+		return nil, false, false
+	}
+	if pinned.serialized == nil || pinned.tip != *tip {
+		return nil, true, false
+	}
+	return pinned.serialized, true, true
+}
+
+// store caches the provided serialized entries for the provided address key
+// that were loaded at the provided index tip.  Nothing is cached when the
+// address is not pinned or is being modified by an update to the index.
+func (c *addrPinCache) store(addrKey [addrKeySize]byte, tip *chainhash.Hash, serialized []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	pinned, ok := c.addrs[addrKey]
+	if !ok {
+		return
+	}
+	if _, ok := c.dirty[addrKey]; ok {
+		return
+	}
+	pinned.tip = *tip
+	pinned.serialized = serialized
+}
+
+// invalidate removes the cached entries for the provided address key and marks
+// it dirty until the next time the tip is advanced.  It must be called whenever
+// the entries for the address are modified.
+//
+// Note that the address key is marked dirty even when it is not pinned since it
+// might be pinned and queried before the update completes.
+func (c *addrPinCache) invalidate(addrKey [addrKeySize]byte) {
+	c.mtx.Lock()
+	if pinned, ok := c.addrs[addrKey]; ok {
+		pinned.serialized = nil
+	}
+	c.dirty[addrKey] = struct{}{}
+	c.mtx.Unlock()
+}
+
+// advance carries the cached entries that were loaded at the provided old tip
+// forward to the provided new tip and clears all dirty address keys.  It must
+// be called once an update to the index changes the tip after invalidating all
+// of the addresses the update modified.
+func (c *addrPinCache) advance(oldTip, newTip *chainhash.Hash) {
+	c.mtx.Lock()
+	for _, pinned := range c.addrs {
+		if pinned.serialized != nil && pinned.tip == *oldTip {
+			pinned.tip = *newTip
+		}
+	}
+	for addrKey := range c.dirty {
+		delete(c.dirty, addrKey)
+	}
+	c.mtx.Unlock()
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/wire"
+)
+
+// TestAddrIndexPinnedAddrs ensures the entries of pinned addresses are served
+// from the pin cache, match the entries loaded from the database, and are only
+// invalidated when connecting or disconnecting a block modifies them.
+func TestAddrIndexPinnedAddrs(t *testing.T) {
+	t.Parallel()
+
+	idx, teardown := newTestAddrIndex(t, "test_addrindex_pinned")
+	defer teardown()
+
+	// Connect enough blocks that pay the pinned address for its entries to
+	// span several levels.
+	const numBlocks = 40
+	blocks := newTestReindexBlocks(t, numBlocks, &idx.chainParams.GenesisHash)
+	for i, block := range blocks {
+		connectTestBlock(t, idx, block, uint32(i+1), testPrevScripter{},
+			false)
+	}
+	pinnedAddr := testP2PKHAddr(t, 0x00)
+	pinnedKey, err := idx.keyForAddr(pinnedAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.PinAddress(pinnedAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	// checkEntries ensures querying the entries of the pinned address for
+	// various parameters matches the entries loaded from the database and
+	// that the entries are cached afterwards.
+	checkEntries := func(wantNumEntries int) {
+		t.Helper()
+
+		err := idx.db.View(func(dbTx database.Tx) error {
+			fetchBlockHash := func(id []byte) (*chainhash.Hash, error) {
+				return dbFetchBlockHashBySerializedID(dbTx, id)
+			}
+			bucket := dbTx.Metadata().Bucket(addrIndexKey)
+			for _, reverse := range []bool{false, true} {
+				for _, numToSkip := range []uint32{0, 5, numBlocks * 2} {
+					for _, numRequested := range []uint32{0, 3, numBlocks * 2} {
+						got, gotSkipped, err := idx.EntriesForAddress(dbTx,
+							pinnedAddr, numToSkip, numRequested, reverse)
+						if err != nil {
+							return err
+						}
+						want, wantSkipped, err := dbFetchAddrIndexEntries(
+							bucket, pinnedKey, numToSkip, numRequested,
+							reverse, fetchBlockHash)
+						if err != nil {
+							return err
+						}
+						if !reflect.DeepEqual(got, want) ||
+							gotSkipped != wantSkipped {
+
+							return fmt.Errorf("mismatched entries for skip "+
+								"%d, requested %d, reverse %v", numToSkip,
+								numRequested, reverse)
+						}
+					}
+				}
+			}
+
+			all, _, err := idx.EntriesForAddress(dbTx, pinnedAddr, 0,
+				numBlocks*2, false)
+			if err != nil {
+				return err
+			}
+			if len(all) != wantNumEntries {
+				return fmt.Errorf("unexpected number of entries: got %d, "+
+					"want %d", len(all), wantNumEntries)
+			}
+
+			tipHash, _, err := dbFetchIndexerTip(dbTx, idx.Key())
+			if err != nil {
+				return err
+			}
+			if _, _, cached := idx.pins.lookup(pinnedKey, tipHash); !cached {
+				return fmt.Errorf("entries are not cached")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// isCached returns whether or not the entries of the pinned address are
+	// cached for the current index tip.
+	isCached := func() bool {
+		t.Helper()
+
+		_, tipHash, err := idx.Tip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, cached := idx.pins.lookup(pinnedKey, tipHash)
+		return cached
+	}
+
+	// Ensure the entries are not cached until queried.
+	if isCached() {
+		t.Fatal("entries cached before being queried")
+	}
+	checkEntries(numBlocks)
+
+	// Ensure connecting a block that does not involve the pinned address
+	// keeps its entries cached.
+	_, otherScript := testP2PKHAddr(t, 0xff).PaymentScript()
+	tipHash := blocks[len(blocks)-1].Hash()
+	otherBlock := newTestBlock(numBlocks+1, tipHash,
+		[]*wire.MsgTx{newTestCoinbase(numBlocks+1, otherScript)}, nil)
+	connectTestBlock(t, idx, otherBlock, numBlocks+1, testPrevScripter{},
+		false)
+	if !isCached() {
+		t.Fatal("entries not cached after connecting unrelated block")
+	}
+	checkEntries(numBlocks)
+
+	// Ensure connecting and disconnecting a block that pays the pinned
+	// address invalidates its cached entries.
+	_, pinnedScript := pinnedAddr.PaymentScript()
+	pinnedBlock := newTestBlock(numBlocks+2, otherBlock.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(numBlocks+2, pinnedScript)}, nil)
+	connectTestBlock(t, idx, pinnedBlock, numBlocks+2, testPrevScripter{},
+		false)
+	if isCached() {
+		t.Fatal("entries cached after connecting block that involves them")
+	}
+	checkEntries(numBlocks + 1)
+
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, pinnedBlock, nil,
+			testPrevScripter{}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.chain.(*testChain).RemoveBlock(pinnedBlock); err != nil {
+		t.Fatal(err)
+	}
+	if isCached() {
+		t.Fatal("entries cached after disconnecting block that involves them")
+	}
+	checkEntries(numBlocks)
+
+	// Ensure connecting a block that pays the pinned address in an update
+	// that is rolled back keeps its entries cached.
+	errRollback := errors.New("rollback")
+	err = idx.db.Update(func(dbTx database.Tx) error {
+		err := idx.connectBlock(dbTx, pinnedBlock, otherBlock,
+			testPrevScripter{}, false)
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isCached() {
+		t.Fatal("entries not cached after rolled back connect")
+	}
+	checkEntries(numBlocks)
+
+	// Ensure unpinning the address removes its cached entries.
+	if err := idx.UnpinAddress(pinnedAddr); err != nil {
+		t.Fatal(err)
+	}
+	if isCached() {
+		t.Fatal("entries cached after unpinning")
+	}
+}
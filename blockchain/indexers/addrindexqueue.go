@@ -0,0 +1,306 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/decred/dcrd/blockchain/stake/v4"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil/v4"
+	"github.com/decred/dcrd/wire"
+)
+
+const (
+	// maxUnconfirmedQueueLen is the maximum number of unconfirmed
+	// transactions that are queued to be indexed by the background goroutine.
+	// Transactions that are added while the queue is full are indexed
+	// synchronously by the caller instead, which bounds the memory used by
+	// the queue and applies backpressure when transactions are added faster
+	// than they are indexed.
+	maxUnconfirmedQueueLen = 5000
+)
+
+var (
+	// errUnconfirmedQueueFull is returned when attempting to queue an
+	// unconfirmed transaction while the queue is full.
+	errUnconfirmedQueueFull = errors.New("unconfirmed queue is full")
+
+	// errUnconfirmedQueueClosed is returned when attempting to queue an
+	// unconfirmed transaction after the background goroutine that indexes
+	// them has stopped.
+	errUnconfirmedQueueClosed = errors.New("unconfirmed queue is closed")
+)
+
+// prevScriptSnapshot provides the previous output scripts and ticket outputs
+// spent by an unconfirmed transaction as they were when the transaction was
+// added.  This allows the transaction to be indexed after the previous scripter
+// provided by the caller is no longer valid.
+//
+// It implements the PrevScripter and PrevTicketOutputer interfaces.
+type prevScriptSnapshot struct {
+	scripts    map[wire.OutPoint]prevScriptSnapshotEntry
+	ticketOuts map[wire.OutPoint][]*stake.MinimalOutput
+}
+
+// prevScriptSnapshotEntry houses the version and script of a previous output
+// in a previous script snapshot.
+type prevScriptSnapshotEntry struct {
+	version uint16
+	script  []byte
+}
+
+// Ensure the prevScriptSnapshot type implements the PrevScripter and
+// PrevTicketOutputer interfaces.
+var _ PrevScripter = (*prevScriptSnapshot)(nil)
+var _ PrevTicketOutputer = (*prevScriptSnapshot)(nil)
+
+// newPrevScriptSnapshot returns a snapshot of the previous output scripts spent
+// by the inputs of the passed transaction along with the outputs of any tickets
+// they spend when the provided previous scripter is able to provide them.
+func newPrevScriptSnapshot(msgTx *wire.MsgTx, prevScripts PrevScripter) *prevScriptSnapshot {
+	snapshot := &prevScriptSnapshot{
+		scripts: make(map[wire.OutPoint]prevScriptSnapshotEntry,
+			len(msgTx.TxIn)),
+	}
+	ticketOutputer, hasTicketOuts := prevScripts.(PrevTicketOutputer)
+	for _, txIn := range msgTx.TxIn {
+		origin := &txIn.PreviousOutPoint
+		version, pkScript, ok := prevScripts.PrevScript(origin)
+		if ok {
+			snapshot.scripts[*origin] = prevScriptSnapshotEntry{
+				version: version,
+				script:  pkScript,
+			}
+		}
+
+		// Only the input that spends the ticket submission output, which
+		// is the first output of a ticket, references a ticket.
+		if !hasTicketOuts || origin.Index != 0 ||
+			origin.Tree != wire.TxTreeStake {
+
+			continue
+		}
+		ticketOuts, ok := ticketOutputer.PrevTicketOutputs(origin)
+		if ok {
+			if snapshot.ticketOuts == nil {
+				snapshot.ticketOuts = make(map[wire.OutPoint][]*stake.MinimalOutput)
+			}
+			snapshot.ticketOuts[*origin] = ticketOuts
+		}
+	}
+	return snapshot
+}
+
+// PrevScript returns the script and version for the provided outpoint when it
+// is in the snapshot.
+//
+// This is part of the PrevScripter interface.
+func (s *prevScriptSnapshot) PrevScript(op *wire.OutPoint) (uint16, []byte, bool) {
+	entry, ok := s.scripts[*op]
+	return entry.version, entry.script, ok
+}
+
+// PrevTicketOutputs returns the outputs of the ticket that created the provided
+// outpoint when they are in the snapshot.
+//
+// This is part of the PrevTicketOutputer interface.
+func (s *prevScriptSnapshot) PrevTicketOutputs(op *wire.OutPoint) ([]*stake.MinimalOutput, bool) {
+	ticketOuts, ok := s.ticketOuts[*op]
+	return ticketOuts, ok
+}
+
+// queuedUnconfirmedTx houses an unconfirmed transaction that is waiting to be
+// indexed along with the details required to index it.  The canceled flag is
+// set when the transaction is removed from the unconfirmed index or added again
+// before it is indexed.
+type queuedUnconfirmedTx struct {
+	tx                *dcrutil.Tx
+	prevScripts       *prevScriptSnapshot
+	isTreasuryEnabled bool
+	canceled          bool
+}
+
+// unconfirmedQueue houses the unconfirmed transactions that are waiting to be
+// indexed by a background goroutine in the order they were added.
+//
+// The mutex is held while a processed transaction is added to the unconfirmed
+// index and while a transaction is removed from it, which ensures a removal is
+// never overtaken by the addition of the same transaction.  It must always be
+// acquired before the unconfirmed lock of the index when both are needed.
+//
+// The maxLen field is the maximum number of queued transactions and the closed
+// field is set once the background goroutine has stopped.
+type unconfirmedQueue struct {
+	mtx      sync.Mutex
+	txns     []*queuedUnconfirmedTx
+	pending  map[chainhash.Hash]*queuedUnconfirmedTx
+	inFlight *queuedUnconfirmedTx
+	signal   chan struct{}
+	idle     *sync.Cond
+	maxLen   int
+	closed   bool
+}
+
+// newUnconfirmedQueue returns a new empty unconfirmed transaction queue.
+func newUnconfirmedQueue() *unconfirmedQueue {
+	q := &unconfirmedQueue{
+		pending: make(map[chainhash.Hash]*queuedUnconfirmedTx),
+		signal:  make(chan struct{}, 1),
+		maxLen:  maxUnconfirmedQueueLen,
+	}
+	q.idle = sync.NewCond(&q.mtx)
+	return q
+}
+
+// enqueue adds the passed unconfirmed transaction to the queue along with a
+// snapshot of the previous scripts it spends and signals the background
+// goroutine.  Any earlier queued addition of the same transaction that has not
+// been indexed yet is canceled.
+//
+// errUnconfirmedQueueFull is returned without queueing the transaction when the
+// queue already has the maximum number of transactions and
+// errUnconfirmedQueueClosed is returned when the background goroutine has
+// stopped.
+//
+// This function is safe for concurrent access.
+func (q *unconfirmedQueue) enqueue(tx *dcrutil.Tx, prevScripts PrevScripter, isTreasuryEnabled bool) error {
+	q.mtx.Lock()
+	if q.closed {
+		q.mtx.Unlock()
+		return errUnconfirmedQueueClosed
+	}
+	if len(q.txns) >= q.maxLen {
+		q.mtx.Unlock()
+		return errUnconfirmedQueueFull
+	}
+	queued := &queuedUnconfirmedTx{
+		tx:                tx,
+		prevScripts:       newPrevScriptSnapshot(tx.MsgTx(), prevScripts),
+		isTreasuryEnabled: isTreasuryEnabled,
+	}
+	if prev, ok := q.pending[*tx.Hash()]; ok {
+		prev.canceled = true
+	}
+	q.pending[*tx.Hash()] = queued
+	q.txns = append(q.txns, queued)
+	q.mtx.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// add cancels any queued additions of the passed transaction that have not been
+// indexed yet and immediately adds it to the unconfirmed index of the provided
+// address index with the provided address keys.  It returns the hashes of any
+// transactions that were evicted as a result.  It is used to index transactions
+// synchronously when the queue is full.
+//
+// This function is safe for concurrent access.
+func (q *unconfirmedQueue) add(idx *AddrIndex, tx *dcrutil.Tx, addrKeys [][addrKeySize]byte) []chainhash.Hash {
+	q.mtx.Lock()
+	if queued, ok := q.pending[*tx.Hash()]; ok {
+		queued.canceled = true
+		delete(q.pending, *tx.Hash())
+	}
+	idx.unconfirmedLock.Lock()
+	evicted := idx.addUnconfirmedTx(tx, addrKeys)
+	idx.unconfirmedLock.Unlock()
+	q.mtx.Unlock()
+	return evicted
+}
+
+// remove cancels any queued additions of the transaction with the passed hash
+// that have not been indexed yet and removes the transaction from the
+// unconfirmed index of the provided address index.
+//
+// This function is safe for concurrent access.
+func (q *unconfirmedQueue) remove(idx *AddrIndex, hash *chainhash.Hash) {
+	q.mtx.Lock()
+	if queued, ok := q.pending[*hash]; ok {
+		queued.canceled = true
+		delete(q.pending, *hash)
+	}
+	idx.unconfirmedLock.Lock()
+	idx.removeUnconfirmedTx(hash)
+	idx.unconfirmedLock.Unlock()
+	q.mtx.Unlock()
+}
+
+// next removes and returns the oldest transaction in the queue while marking it
+// as in flight.  It returns nil when the queue is empty.
+//
+// This function is safe for concurrent access.
+func (q *unconfirmedQueue) next() *queuedUnconfirmedTx {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if len(q.txns) == 0 {
+		return nil
+	}
+	queued := q.txns[0]
+	q.txns[0] = nil
+	q.txns = q.txns[1:]
+	q.inFlight = queued
+	return queued
+}
+
+// processUnconfirmedTx extracts the addresses of the passed queued transaction
+// and adds it to the unconfirmed index unless it was canceled in the mean time.
+//
+// This function is safe for concurrent access.
+func (idx *AddrIndex) processUnconfirmedTx(queued *queuedUnconfirmedTx) {
+	// Extract the addresses without holding any locks.
+	addrKeys := idx.unconfirmedAddrKeys(queued.tx, queued.prevScripts,
+		queued.isTreasuryEnabled)
+
+	q := idx.unconfirmedQueue
+	q.mtx.Lock()
+	var evicted []chainhash.Hash
+	if !queued.canceled {
+		idx.unconfirmedLock.Lock()
+		evicted = idx.addUnconfirmedTx(queued.tx, addrKeys)
+		idx.unconfirmedLock.Unlock()
+		delete(q.pending, *queued.tx.Hash())
+	}
+	q.inFlight = nil
+	if len(q.txns) == 0 {
+		q.idle.Broadcast()
+	}
+	q.mtx.Unlock()
+	idx.notifyUnconfirmedEvicted(evicted)
+}
+
+// unconfirmedQueueHandler indexes the unconfirmed transactions that are added
+// to the queue of the index as they arrive.  Any transactions that remain in the
+// queue are discarded and the queue is closed so no further transactions are
+// queued when the provided context is canceled.
+//
+// It must be run as a goroutine.
+func (idx *AddrIndex) unconfirmedQueueHandler(ctx context.Context) {
+	q := idx.unconfirmedQueue
+	for {
+		select {
+		case <-q.signal:
+			for queued := q.next(); queued != nil; queued = q.next() {
+				idx.processUnconfirmedTx(queued)
+			}
+
+		case <-ctx.Done():
+			q.mtx.Lock()
+			q.txns = nil
+			q.pending = make(map[chainhash.Hash]*queuedUnconfirmedTx)
+			q.closed = true
+			q.idle.Broadcast()
+			q.mtx.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/dcrutil/v4"
+	"github.com/decred/dcrd/wire"
+)
+
+// newTestAsyncAddrIndex returns an address index that is only suitable for use
+// with the unconfirmed index and is configured to index unconfirmed
+// transactions asynchronously without starting the background goroutine.
+func newTestAsyncAddrIndex() *AddrIndex {
+	return newAddrIndex(nil, chaincfg.SimNetParams(), &AddrIndexConfig{
+		AsyncUnconfirmed: true,
+	})
+}
+
+// waitIdle blocks until the queue is empty and the most recently dequeued
+// transaction has been fully processed.
+//
+// This function is safe for concurrent access.
+func (q *unconfirmedQueue) waitIdle() {
+	q.mtx.Lock()
+	for len(q.txns) > 0 || q.inFlight != nil {
+		q.idle.Wait()
+	}
+	q.mtx.Unlock()
+}
+
+// newTestSpendTx returns a transaction that spends an output that pays to the
+// provided input script and pays to the provided output script along with a
+// previous scripter that provides the spent output.  The provided seed is used
+// to make the transaction unique.
+func newTestSpendTx(seed uint32, inScript, outScript []byte) (*dcrutil.Tx, testPrevScripter) {
+	prevOut := wire.OutPoint{Index: seed}
+	msgTx := wire.NewMsgTx()
+	msgTx.AddTxIn(wire.NewTxIn(&prevOut, 1e8, nil))
+	msgTx.AddTxOut(wire.NewTxOut(1e8, outScript))
+	prevScripts := testPrevScripter{prevOut: {script: inScript, amount: 1e8}}
+	return dcrutil.NewTx(msgTx), prevScripts
+}
+
+// TestAddrIndexAsyncUnconfirmed ensures unconfirmed transactions are indexed by
+// the background goroutine when the index is configured to index them
+// asynchronously, including when the previous scripter provided when adding
+// them is modified before they are processed, and that removing them before
+// they are processed does not leave any stale entries.
+func TestAddrIndexAsyncUnconfirmed(t *testing.T) {
+	t.Parallel()
+
+	idx := newTestAsyncAddrIndex()
+	inAddr, outAddr := testP2PKHAddr(t, 0x01), testP2PKHAddr(t, 0x02)
+	_, inScript := inAddr.PaymentScript()
+	_, outScript := outAddr.PaymentScript()
+
+	// Ensure transactions are not indexed until they are processed and that
+	// the snapshot of the previous scripts is used to process them.
+	tx1, prevScripts1 := newTestSpendTx(1, inScript, outScript)
+	idx.AddUnconfirmedTx(tx1, prevScripts1, false)
+	for op := range prevScripts1 {
+		delete(prevScripts1, op)
+	}
+	if idx.HasUnconfirmed(inAddr) || idx.HasUnconfirmed(outAddr) {
+		t.Fatal("unconfirmed transaction indexed before it was processed")
+	}
+
+	// Ensure a transaction that is removed before it is processed is never
+	// indexed and that a transaction that is added again after it is removed
+	// is indexed.
+	tx2, prevScripts2 := newTestSpendTx(2, inScript, outScript)
+	idx.AddUnconfirmedTx(tx2, prevScripts2, false)
+	idx.RemoveUnconfirmedTx(tx2.Hash())
+	tx3, prevScripts3 := newTestSpendTx(3, inScript, outScript)
+	idx.AddUnconfirmedTx(tx3, prevScripts3, false)
+	idx.RemoveUnconfirmedTx(tx3.Hash())
+	idx.AddUnconfirmedTx(tx3, prevScripts3, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go idx.unconfirmedQueueHandler(ctx)
+	idx.unconfirmedQueue.waitIdle()
+
+	wantHashes := map[chainhash.Hash]struct{}{
+		*tx1.Hash(): {},
+		*tx3.Hash(): {},
+	}
+	for _, txns := range [][]*dcrutil.Tx{
+		idx.UnconfirmedTxnsForAddress(inAddr),
+		idx.UnconfirmedTxnsForAddress(outAddr),
+	} {
+		if len(txns) != len(wantHashes) {
+			t.Fatalf("unexpected number of unconfirmed txns: got %d, want %d",
+				len(txns), len(wantHashes))
+		}
+		for _, tx := range txns {
+			if _, ok := wantHashes[*tx.Hash()]; !ok {
+				t.Fatalf("unexpected unconfirmed txn %v", tx.Hash())
+			}
+		}
+	}
+
+	// Ensure removing processed transactions removes them from the index.
+	idx.RemoveUnconfirmedTx(tx1.Hash())
+	idx.RemoveUnconfirmedTx(tx3.Hash())
+	if stats := idx.UnconfirmedStats(); stats.NumTxns != 0 {
+		t.Fatalf("unexpected number of unconfirmed txns after removal: %d",
+			stats.NumTxns)
+	}
+}
+
+// TestAddrIndexAsyncUnconfirmedRace ensures transactions that are removed
+// immediately after they are added while the background goroutine is
+// concurrently processing the queue never leave stale entries in the
+// unconfirmed index.
+func TestAddrIndexAsyncUnconfirmedRace(t *testing.T) {
+	t.Parallel()
+
+	idx := newTestAsyncAddrIndex()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go idx.unconfirmedQueueHandler(ctx)
+
+	_, inScript := testP2PKHAddr(t, 0x01).PaymentScript()
+	_, outScript := testP2PKHAddr(t, 0x02).PaymentScript()
+
+	// Concurrently add and immediately remove transactions from several
+	// goroutines while keeping every transaction added by the final one.
+	const numGoroutines = 4
+	const numTxnsPerGoroutine = 250
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < numTxnsPerGoroutine; j++ {
+				seed := uint32(i*numTxnsPerGoroutine + j)
+				tx, prevScripts := newTestSpendTx(seed, inScript, outScript)
+				idx.AddUnconfirmedTx(tx, prevScripts, false)
+				if i != numGoroutines-1 {
+					idx.RemoveUnconfirmedTx(tx.Hash())
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	idx.unconfirmedQueue.waitIdle()
+
+	stats := idx.UnconfirmedStats()
+	if stats.NumTxns != numTxnsPerGoroutine {
+		t.Fatalf("unexpected number of unconfirmed txns: got %d, want %d",
+			stats.NumTxns, numTxnsPerGoroutine)
+	}
+}
+
+// TestAddrIndexAsyncUnconfirmedBounded ensures the number of queued unconfirmed
+// transactions never exceeds the maximum by indexing the transactions that are
+// added while the queue is full synchronously and that transactions are no
+// longer queued or indexed once the background goroutine has stopped.
+func TestAddrIndexAsyncUnconfirmedBounded(t *testing.T) {
+	t.Parallel()
+
+	idx := newTestAsyncAddrIndex()
+	q := idx.unconfirmedQueue
+	const maxLen = 3
+	q.maxLen = maxLen
+	inAddr, outAddr := testP2PKHAddr(t, 0x01), testP2PKHAddr(t, 0x02)
+	_, inScript := inAddr.PaymentScript()
+	_, outScript := outAddr.PaymentScript()
+
+	// Fill the queue without running the background goroutine and ensure
+	// the transactions added once it is full are indexed immediately.
+	var txns []*dcrutil.Tx
+	for i := uint32(0); i < maxLen+2; i++ {
+		tx, prevScripts := newTestSpendTx(i, inScript, outScript)
+		idx.AddUnconfirmedTx(tx, prevScripts, false)
+		txns = append(txns, tx)
+	}
+	if len(q.txns) != maxLen {
+		t.Fatalf("unexpected number of queued txns: got %d, want %d",
+			len(q.txns), maxLen)
+	}
+	if got := idx.UnconfirmedStats().NumTxns; got != 2 {
+		t.Fatalf("unexpected number of unconfirmed txns: got %d, want 2", got)
+	}
+
+	// Ensure adding a queued transaction again while the queue is full
+	// cancels the queued addition.
+	idx.AddUnconfirmedTx(txns[0], testPrevScripter{}, false)
+	if !q.txns[0].canceled {
+		t.Fatal("queued addition was not canceled")
+	}
+
+	// Ensure the queued transactions are indexed once the background
+	// goroutine runs.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		idx.unconfirmedQueueHandler(ctx)
+		close(done)
+	}()
+	q.waitIdle()
+	if got := idx.UnconfirmedStats().NumTxns; got != len(txns) {
+		t.Fatalf("unexpected number of unconfirmed txns: got %d, want %d",
+			got, len(txns))
+	}
+
+	// Ensure transactions are neither queued nor indexed once the background
+	// goroutine has stopped.
+	cancel()
+	<-done
+	tx, prevScripts := newTestSpendTx(maxLen+2, inScript, outScript)
+	idx.AddUnconfirmedTx(tx, prevScripts, false)
+	if len(q.txns) != 0 || len(q.pending) != 0 {
+		t.Fatalf("transaction queued after stopping: %d queued, %d pending",
+			len(q.txns), len(q.pending))
+	}
+	if got := idx.UnconfirmedStats().NumTxns; got != len(txns) {
+		t.Fatalf("unexpected number of unconfirmed txns after stopping: got "+
+			"%d, want %d", got, len(txns))
+	}
+}
@@ -13,7 +13,10 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 
+	"github.com/decred/dcrd/blockchain/stake/v4"
 	"github.com/decred/dcrd/blockchain/v4/internal/progresslog"
 	"github.com/decred/dcrd/blockchain/v4/internal/spendpruner"
 	"github.com/decred/dcrd/chaincfg/chainhash"
@@ -43,6 +46,22 @@ type NeedsInputser interface {
 	NeedsInputs() bool
 }
 
+// tipWaitersNotifier provides an interface for an indexer to be signalled each
+// time an update to the index is committed so it can notify clients waiting
+// for the index to reach a given height.
+type tipWaitersNotifier interface {
+	notifyTipWaiters()
+}
+
+// updateSerializer provides an interface for an indexer to serialize the
+// updates delivered via notifications with other operations that update the
+// index over multiple database transactions.  Updates delivered via
+// notifications are not processed while the updates are locked.
+type updateSerializer interface {
+	lockUpdates()
+	unlockUpdates()
+}
+
 // PrevScripter defines an interface that provides access to scripts and their
 // associated version keyed by an outpoint.  It is used within this package as a
 // generic means to provide the scripts referenced by the inputs to transactions
@@ -52,6 +71,26 @@ type PrevScripter interface {
 	PrevScript(*wire.OutPoint) (uint16, []byte, bool)
 }
 
+// PrevAmounter defines an interface that provides access to the amounts of
+// previous outputs keyed by an outpoint.  It may optionally be implemented by
+// PrevScripter implementations in order to provide the amounts spent by the
+// inputs to transactions within a block for indexes that track them.  The
+// boolean return indicates whether or not the amount for the provided outpoint
+// was found.
+type PrevAmounter interface {
+	PrevAmount(*wire.OutPoint) (int64, bool)
+}
+
+// PrevTicketOutputer defines an interface that provides access to the minimal
+// outputs of the ticket purchases that created previous outputs keyed by an
+// outpoint.  It may optionally be implemented by PrevScripter implementations
+// in order to provide the commitments of the tickets spent by votes and
+// revocations for indexes that track them.  The boolean return indicates
+// whether or not the ticket outputs for the provided outpoint were found.
+type PrevTicketOutputer interface {
+	PrevTicketOutputs(*wire.OutPoint) ([]*stake.MinimalOutput, bool)
+}
+
 // ChainQueryer provides a generic interface that is used to provide access to
 // the chain details required by indexes.
 //
@@ -105,6 +144,78 @@ type ChainQueryer interface {
 	IsTreasuryAgendaActive(*chainhash.Hash) (bool, error)
 }
 
+// commitHookDB wraps a database so that changes to in-memory state which
+// reflect the updates made in a managed read-write transaction are only applied
+// once the transaction is committed.  This ensures the in-memory state never
+// reflects updates that were rolled back.
+//
+// It relies on the database only allowing a single read-write transaction at a
+// time.
+type commitHookDB struct {
+	database.DB
+
+	mtx   sync.Mutex
+	tx    database.Tx
+	hooks []func()
+}
+
+// newCommitHookDB returns the provided database wrapped so commit hooks may be
+// registered for its managed read-write transactions.  A nil database is
+// returned as is.
+func newCommitHookDB(db database.DB) database.DB {
+	if db == nil {
+		return nil
+	}
+	return &commitHookDB{DB: db}
+}
+
+// Update invokes the passed function in the context of a managed read-write
+// transaction and then invokes all of the commit hooks registered for the
+// transaction once it is committed.  The hooks are discarded when the
+// transaction is rolled back.
+//
+// This is part of the database.DB interface.
+func (db *commitHookDB) Update(fn func(dbTx database.Tx) error) error {
+	var hooks []func()
+	err := db.DB.Update(func(dbTx database.Tx) error {
+		db.mtx.Lock()
+		db.tx, db.hooks = dbTx, nil
+		db.mtx.Unlock()
+
+		err := fn(dbTx)
+
+		db.mtx.Lock()
+		hooks = db.hooks
+		db.tx, db.hooks = nil, nil
+		db.mtx.Unlock()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// afterCommit registers the provided hook to be invoked once the provided
+// transaction is committed.  The hook is invoked immediately when the
+// transaction is not a managed read-write transaction of the database since
+// there is no way to know when it is committed.
+func (db *commitHookDB) afterCommit(dbTx database.Tx, hook func()) {
+	db.mtx.Lock()
+	if dbTx != nil && dbTx == db.tx {
+		db.hooks = append(db.hooks, hook)
+		db.mtx.Unlock()
+		return
+	}
+	db.mtx.Unlock()
+
+	hook()
+}
+
 // Indexer defines a generic interface for an indexer.
 type Indexer interface {
 	// Key returns the key of the index as a byte slice.
@@ -164,6 +275,51 @@ func (e AssertError) Error() string {
 	return "assertion failed: " + string(e)
 }
 
+// ConnectBlockError identifies an error that occurred while an index was
+// processing a notification to connect a block.  It houses the name of the
+// index, the hash of the block, and the underlying cause.
+type ConnectBlockError struct {
+	Index string
+	Hash  chainhash.Hash
+	Err   error
+}
+
+// Error returns the connect block error as a human-readable string and
+// satisfies the error interface.
+func (e ConnectBlockError) Error() string {
+	return fmt.Sprintf("%s: unable to connect block %s: %v", e.Index, e.Hash,
+		e.Err)
+}
+
+// Unwrap returns the underlying cause of the connect block error.
+func (e ConnectBlockError) Unwrap() error {
+	return e.Err
+}
+
+// DisconnectBlockError identifies an error that occurred while an index was
+// processing a notification to disconnect a block.  It houses the name of the
+// index, the hash of the block, and the underlying cause.
+//
+// Unlike other errors, it does not halt the index subscriber since the failure
+// is logged by the index and the update is rolled back.
+type DisconnectBlockError struct {
+	Index string
+	Hash  chainhash.Hash
+	Err   error
+}
+
+// Error returns the disconnect block error as a human-readable string and
+// satisfies the error interface.
+func (e DisconnectBlockError) Error() string {
+	return fmt.Sprintf("%s: unable to disconnect block %s: %v", e.Index,
+		e.Hash, e.Err)
+}
+
+// Unwrap returns the underlying cause of the disconnect block error.
+func (e DisconnectBlockError) Unwrap() error {
+	return e.Err
+}
+
 // errDeserialize signifies that a problem was encountered when deserializing
 // data.
 type errDeserialize string
@@ -189,6 +345,99 @@ type internalBucket interface {
 	Delete(key []byte) error
 }
 
+// writeBatchBucket is an implementation of internalBucket that accumulates all
+// modifications in memory on top of an underlying bucket until they are written
+// to it with flush.  Reads consult the pending modifications first so the
+// accumulated state is observed as if it had been written.
+//
+// This allows code that performs many small modifications to the same keys to
+// only write the final value of each key to the underlying bucket.
+type writeBatchBucket struct {
+	bucket  internalBucket
+	pending map[string][]byte
+	deleted map[string]struct{}
+}
+
+// Ensure the writeBatchBucket type implements the internalBucket interface.
+var _ internalBucket = (*writeBatchBucket)(nil)
+
+// newWriteBatchBucket returns a new write batch bucket that accumulates
+// modifications to the provided bucket.
+func newWriteBatchBucket(bucket internalBucket) *writeBatchBucket {
+	return &writeBatchBucket{
+		bucket:  bucket,
+		pending: make(map[string][]byte),
+		deleted: make(map[string]struct{}),
+	}
+}
+
+// Get returns the pending value for the provided key when it has been modified
+// and the value from the underlying bucket otherwise.
+//
+// This is part of the internalBucket interface.
+func (b *writeBatchBucket) Get(key []byte) []byte {
+	if value, ok := b.pending[string(key)]; ok {
+		return value
+	}
+	if _, ok := b.deleted[string(key)]; ok {
+		return nil
+	}
+	return b.bucket.Get(key)
+}
+
+// Put stores the provided key/value pair in the pending modifications.
+//
+// This is part of the internalBucket interface.
+func (b *writeBatchBucket) Put(key []byte, value []byte) error {
+	delete(b.deleted, string(key))
+	b.pending[string(key)] = value
+	return nil
+}
+
+// Delete marks the provided key as deleted in the pending modifications.
+//
+// This is part of the internalBucket interface.
+func (b *writeBatchBucket) Delete(key []byte) error {
+	delete(b.pending, string(key))
+	b.deleted[string(key)] = struct{}{}
+	return nil
+}
+
+// flush writes all pending modifications to the underlying bucket in order of
+// their keys and resets the pending modifications.
+func (b *writeBatchBucket) flush() error {
+	return b.flushTo(b.bucket)
+}
+
+// flushTo writes all pending modifications to the provided bucket in order of
+// their keys and resets the pending modifications.
+func (b *writeBatchBucket) flushTo(bucket internalBucket) error {
+	keys := make([]string, 0, len(b.pending)+len(b.deleted))
+	for key := range b.pending {
+		keys = append(keys, key)
+	}
+	for key := range b.deleted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var err error
+		if value, ok := b.pending[key]; ok {
+			err = bucket.Put([]byte(key), value)
+		} else {
+			err = bucket.Delete([]byte(key))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	b.pending = make(map[string][]byte)
+	b.deleted = make(map[string]struct{})
+	return nil
+}
+
 // interruptRequested returns true when the provided channel has been closed.
 // This simplifies early shutdown slightly since the caller can just use an if
 // statement instead of a select.
@@ -196,6 +445,19 @@ func interruptRequested(ctx context.Context) bool {
 	return ctx.Err() != nil
 }
 
+// treasuryEnabledForBlock returns whether or not the treasury agenda is active
+// for the provided block, which is determined by the state of its parent.
+//
+// This is used when disconnecting blocks since the treasury agenda state
+// provided by a notification might be stale when a reorganization crosses the
+// activation boundary, and disconnecting a block with a different state than
+// it was connected with would classify its transactions differently and
+// therefore remove the wrong entries.
+func treasuryEnabledForBlock(chain ChainQueryer, block *dcrutil.Block) (bool, error) {
+	parentHash := &block.MsgBlock().Header.PrevBlock
+	return chain.IsTreasuryAgendaActive(parentHash)
+}
+
 // makeDbErr creates a database.Error given a set of arguments.
 func makeDbErr(kind database.ErrorKind, desc string) database.Error {
 	return database.Error{Err: kind, Description: desc}
@@ -266,6 +528,134 @@ func dbPutIndexerVersion(dbTx database.Tx, idxKey []byte, version uint32) error
 	return indexesBucket.Put(indexVersionKey(idxKey), serialized)
 }
 
+// indexProcessedBlocksKey returns the key for an index which houses the number
+// of blocks the index has processed.
+func indexProcessedBlocksKey(idxKey []byte) []byte {
+	countKey := make([]byte, len(idxKey)+1)
+	countKey[0] = 'n'
+	copy(countKey[1:], idxKey)
+	return countKey
+}
+
+// dbFetchIndexerProcessedBlocks uses an existing database transaction to
+// retrieve the number of blocks the given index has processed.  The boolean
+// return value indicates whether or not the count exists since indexes created
+// before the count was tracked do not have one.
+func dbFetchIndexerProcessedBlocks(dbTx database.Tx, idxKey []byte) (uint64, bool, error) {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	serialized := indexesBucket.Get(indexProcessedBlocksKey(idxKey))
+	if serialized == nil {
+		return 0, false, nil
+	}
+	if len(serialized) < 8 {
+		str := fmt.Sprintf("unexpected end of data for index %q processed "+
+			"blocks", string(idxKey))
+		return 0, false, makeDbErr(database.ErrCorruption, str)
+	}
+	return byteOrder.Uint64(serialized[0:8]), true, nil
+}
+
+// dbPutIndexerProcessedBlocks uses an existing database transaction to update
+// the number of blocks the given index has processed to the provided value.
+func dbPutIndexerProcessedBlocks(dbTx database.Tx, idxKey []byte, count uint64) error {
+	serialized := make([]byte, 8)
+	byteOrder.PutUint64(serialized[0:8], count)
+
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	return indexesBucket.Put(indexProcessedBlocksKey(idxKey), serialized)
+}
+
+// indexNonStandardScriptsKey returns the key for an index which houses the
+// number of non-standard scripts the index has encountered.
+func indexNonStandardScriptsKey(idxKey []byte) []byte {
+	countKey := make([]byte, len(idxKey)+1)
+	countKey[0] = 's'
+	copy(countKey[1:], idxKey)
+	return countKey
+}
+
+// dbFetchIndexerNonStandardScripts uses an existing database transaction to
+// retrieve the number of non-standard scripts the given index has encountered.
+// It returns zero when the count has not been stored.
+func dbFetchIndexerNonStandardScripts(dbTx database.Tx, idxKey []byte) (uint64, error) {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	serialized := indexesBucket.Get(indexNonStandardScriptsKey(idxKey))
+	if serialized == nil {
+		return 0, nil
+	}
+	if len(serialized) < 8 {
+		str := fmt.Sprintf("unexpected end of data for index %q non-standard "+
+			"scripts", string(idxKey))
+		return 0, makeDbErr(database.ErrCorruption, str)
+	}
+	return byteOrder.Uint64(serialized[0:8]), nil
+}
+
+// dbPutIndexerNonStandardScripts uses an existing database transaction to
+// update the number of non-standard scripts the given index has encountered to
+// the provided value.
+func dbPutIndexerNonStandardScripts(dbTx database.Tx, idxKey []byte, count uint64) error {
+	serialized := make([]byte, 8)
+	byteOrder.PutUint64(serialized[0:8], count)
+
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	return indexesBucket.Put(indexNonStandardScriptsKey(idxKey), serialized)
+}
+
+// indexOptionsKey returns the key for an index which houses the options that
+// affect which data the index contains.
+func indexOptionsKey(idxKey []byte) []byte {
+	optsKey := make([]byte, len(idxKey)+1)
+	optsKey[0] = 'o'
+	copy(optsKey[1:], idxKey)
+	return optsKey
+}
+
+// dbFetchIndexerOptions uses an existing database transaction to retrieve the
+// options the given index was created with.  The boolean return value indicates
+// whether or not the options exist since indexes created before the options
+// were tracked do not have any.
+func dbFetchIndexerOptions(dbTx database.Tx, idxKey []byte) (uint32, bool, error) {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	serialized := indexesBucket.Get(indexOptionsKey(idxKey))
+	if serialized == nil {
+		return 0, false, nil
+	}
+	if len(serialized) < 4 {
+		str := fmt.Sprintf("unexpected end of data for index %q options",
+			string(idxKey))
+		return 0, false, makeDbErr(database.ErrCorruption, str)
+	}
+	return byteOrder.Uint32(serialized[0:4]), true, nil
+}
+
+// dbPutIndexerOptions uses an existing database transaction to update the
+// options for the given index to the provided value.
+func dbPutIndexerOptions(dbTx database.Tx, idxKey []byte, options uint32) error {
+	serialized := make([]byte, 4)
+	byteOrder.PutUint32(serialized[0:4], options)
+
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	return indexesBucket.Put(indexOptionsKey(idxKey), serialized)
+}
+
+// dbFetchIndexerVersion uses an existing database transaction to retrieve the
+// version for the given index.  Indexes created before versions were tracked
+// do not have a stored version and are reported as version 1.
+func dbFetchIndexerVersion(dbTx database.Tx, idxKey []byte) (uint32, error) {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	serialized := indexesBucket.Get(indexVersionKey(idxKey))
+	if serialized == nil {
+		return 1, nil
+	}
+	if len(serialized) < 4 {
+		str := fmt.Sprintf("unexpected end of data for index %q version",
+			string(idxKey))
+		return 0, makeDbErr(database.ErrCorruption, str)
+	}
+	return byteOrder.Uint32(serialized[0:4]), nil
+}
+
 // existsIndex returns whether the index keyed by idxKey exists in the database.
 func existsIndex(db database.DB, idxKey []byte, idxName string) (bool, error) {
 	var exists bool
@@ -346,6 +736,21 @@ func dropIndexMetadata(db database.DB, idxKey []byte, idxName string) error {
 			return err
 		}
 
+		err = indexesBucket.Delete(indexProcessedBlocksKey(idxKey))
+		if err != nil {
+			return err
+		}
+
+		err = indexesBucket.Delete(indexOptionsKey(idxKey))
+		if err != nil {
+			return err
+		}
+
+		err = indexesBucket.Delete(indexNonStandardScriptsKey(idxKey))
+		if err != nil {
+			return err
+		}
+
 		return indexesBucket.Delete(indexDropKey(idxKey))
 	})
 }
@@ -564,29 +969,30 @@ func recover(ctx context.Context, idx Indexer) error {
 	return nil
 }
 
-// finishDrop determines if the provided index is in the middle
-// of being dropped and finishes dropping it when it is.  This is necessary
-// because dropping an index has to be done in several atomic steps rather
-// than one big atomic step due to the massive number of entries.
-func finishDrop(ctx context.Context, indexer Indexer) error {
+// indexDropInProgress returns whether or not the index identified by idxKey is
+// in the middle of being dropped.
+func indexDropInProgress(db database.DB, idxKey []byte) (bool, error) {
 	var drop bool
-	err := indexer.DB().View(func(dbTx database.Tx) error {
-		// The index does not need to be dropped if the index tips
-		// bucket hasn't been created yet.
+	err := db.View(func(dbTx database.Tx) error {
+		// The index is not being dropped if the index tips bucket hasn't
+		// been created yet.
 		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
 		if indexesBucket == nil {
 			return nil
 		}
 
-		// Mark the indexer as requiring a drop if one is already in
-		// progress.
-		dropKey := indexDropKey(indexer.Key())
-		if indexesBucket.Get(dropKey) != nil {
-			drop = true
-		}
-
+		drop = indexesBucket.Get(indexDropKey(idxKey)) != nil
 		return nil
 	})
+	return drop, err
+}
+
+// finishDrop determines if the provided index is in the middle
+// of being dropped and finishes dropping it when it is.  This is necessary
+// because dropping an index has to be done in several atomic steps rather
+// than one big atomic step due to the massive number of entries.
+func finishDrop(ctx context.Context, indexer Indexer) error {
+	drop, err := indexDropInProgress(indexer.DB(), indexer.Key())
 	if err != nil {
 		return err
 	}
@@ -699,9 +1105,9 @@ func maybeNotifySubscribers(ctx context.Context, indexer Indexer) error {
 	return nil
 }
 
-// notifyDependent relays the provided index notification to the dependent of
-// the provided index if there is one set.
-func notifyDependent(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
+// notifyDependents relays the provided index notification to the dependents of
+// the provided index if there are any set.
+func notifyDependents(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
 	if interruptRequested(ctx) {
 		return errInterruptRequested
 	}
@@ -712,22 +1118,29 @@ func notifyDependent(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) erro
 			indexer.Name())
 	}
 
-	// Notify the dependent subscription if set.
+	// Notify the dependent subscriptions if set.
 	sub.mtx.Lock()
-	if sub.dependent != nil {
-		err := updateIndex(ctx, sub.dependent.idx, ntfn)
+	dependents := append([]*IndexSubscription(nil), sub.dependents...)
+	sub.mtx.Unlock()
+	for _, dependent := range dependents {
+		err := updateIndex(ctx, dependent.idx, ntfn)
 		if err != nil {
-			sub.mtx.Unlock()
 			return err
 		}
 	}
-	sub.mtx.Unlock()
 
 	return nil
 }
 
-// updateIndex processes the notification for the provided index.
+// updateIndex processes the notification for the provided index.  Failures to
+// disconnect a block, which are reported as a DisconnectBlockError, are not
+// returned so the notification continues to be relayed.
 func updateIndex(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
+	if serializer, ok := indexer.(updateSerializer); ok {
+		serializer.lockUpdates()
+		defer serializer.unlockUpdates()
+	}
+
 	tip, _, err := indexer.Tip()
 	if err != nil {
 		return fmt.Errorf("%s: unable to fetch index tip: %v",
@@ -747,12 +1160,12 @@ func updateIndex(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
 
 	switch {
 	case ntfn.Block.Height() < expectedHeight:
-		// Relay the notification to the dependent if its height is less
+		// Relay the notification to the dependents if its height is less
 		// than that of the expected notification since its possible for a
 		// dependent to have a lower tip height than its prerequisite.
-		log.Tracef("%s: relaying notification for height %d to dependent",
+		log.Tracef("%s: relaying notification for height %d to dependents",
 			indexer.Name(), ntfn.Block.Height())
-		notifyDependent(ctx, indexer, ntfn)
+		notifyDependents(ctx, indexer, ntfn)
 
 	case ntfn.Block.Height() > expectedHeight:
 		// Receiving a notification with a height higher than the expected
@@ -766,10 +1179,18 @@ func updateIndex(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
 			return indexer.ProcessNotification(dbTx, ntfn)
 		})
 		if err != nil {
-			return err
+			// Failing to disconnect a block is not fatal since the index
+			// logs the failure when processing the notification and the
+			// update is rolled back, so continue relaying the notification
+			// instead of halting the subscriber.  All other failures are
+			// fatal.
+			var dErr DisconnectBlockError
+			if !errors.As(err, &dErr) {
+				return err
+			}
 		}
 
-		err = notifyDependent(ctx, indexer, ntfn)
+		err = notifyDependents(ctx, indexer, ntfn)
 		if err != nil {
 			return err
 		}
@@ -778,6 +1199,12 @@ func updateIndex(ctx context.Context, indexer Indexer, ntfn *IndexNtfn) error {
 		if err != nil {
 			return err
 		}
+
+		// Signal clients waiting for the index to reach a given height now
+		// that the update is committed.
+		if notifier, ok := indexer.(tipWaitersNotifier); ok {
+			notifier.notifyTipWaiters()
+		}
 	}
 
 	return nil
@@ -550,14 +550,18 @@ func (idx *ExistsAddrIndex) ProcessNotification(dbTx database.Tx, ntfn *IndexNtf
 		err := idx.connectBlock(dbTx, ntfn.Block, ntfn.Parent,
 			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
 		if err != nil {
-			return fmt.Errorf("%s: unable to connect block: %v", idx.Name(), err)
+			return ConnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
 		}
 
 	case DisconnectNtfn:
 		err := idx.disconnectBlock(dbTx, ntfn.Block, ntfn.Parent,
 			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
 		if err != nil {
-			log.Errorf("%s: unable to disconnect block: %v", idx.Name(), err)
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
 		}
 
 	default:
@@ -61,11 +61,12 @@ type IndexSubscription struct {
 	// indicates the subscription has no prerequisite.
 	prerequisite string
 
-	// dependent defines the index subscription that requires the subscriber
+	// dependents defines the index subscriptions that require the subscriber
 	// associated with this subscription to have processed incoming
-	// notifications before it does. A nil dependency indicates the subscription
-	// has no dependencies.
-	dependent *IndexSubscription
+	// notifications before they do. Each dependent is notified independently
+	// of the others. An empty set indicates the subscription has no
+	// dependencies.
+	dependents []*IndexSubscription
 }
 
 // newIndexSubscription initializes a new index subscription.
@@ -83,25 +84,48 @@ func newIndexSubscription(subber *IndexSubscriber, indexer Indexer, prereq strin
 func (s *IndexSubscription) stop() error {
 
 	// If the subscription has a prerequisite, find it and remove the
-	// subscription as a dependency.
+	// subscription as a dependency.  Any dependents of the subscription
+	// become dependents of the prerequisite so they continue to receive
+	// updates.
 	if s.prerequisite != noPrereqs {
-		s.mtx.Lock()
-		prereq, ok := s.subscriber.subscriptions[s.prerequisite]
-		s.mtx.Unlock()
+		s.subscriber.mtx.Lock()
+		prereq, ok := s.subscriber.findSubscription(s.prerequisite)
+		s.subscriber.mtx.Unlock()
 		if !ok {
 			return fmt.Errorf("no subscription found with id %s", s.prerequisite)
 		}
 
+		s.mtx.Lock()
+		dependents := s.dependents
+		s.dependents = nil
+		s.mtx.Unlock()
+
 		prereq.mtx.Lock()
-		prereq.dependent = nil
+		for i, dependent := range prereq.dependents {
+			if dependent == s {
+				prereq.dependents = append(prereq.dependents[:i:i],
+					prereq.dependents[i+1:]...)
+				break
+			}
+		}
+		prereq.dependents = append(prereq.dependents, dependents...)
 		prereq.mtx.Unlock()
 
+		for _, dependent := range dependents {
+			dependent.mtx.Lock()
+			dependent.prerequisite = prereq.id
+			dependent.mtx.Unlock()
+		}
+
 		return nil
 	}
 
-	// If the subscription has a dependent, stop it as well.
-	if s.dependent != nil {
-		err := s.dependent.stop()
+	// If the subscription has dependents, stop them as well.
+	s.mtx.Lock()
+	dependents := append([]*IndexSubscription(nil), s.dependents...)
+	s.mtx.Unlock()
+	for _, dependent := range dependents {
+		err := dependent.stop()
 		if err != nil {
 			return err
 		}
@@ -140,9 +164,43 @@ func NewIndexSubscriber(sCtx context.Context) *IndexSubscriber {
 	return s
 }
 
+// findDependent returns the subscription with the provided id from the
+// provided subscription and its dependents.
+func findDependent(sub *IndexSubscription, id string) (*IndexSubscription, bool) {
+	if sub.id == id {
+		return sub, true
+	}
+
+	sub.mtx.Lock()
+	dependents := append([]*IndexSubscription(nil), sub.dependents...)
+	sub.mtx.Unlock()
+	for _, dependent := range dependents {
+		if found, ok := findDependent(dependent, id); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+// findSubscription returns the subscription with the provided id from the
+// independent subscriptions and their dependents.
+//
+// This function MUST be called with the subscriber mutex held.
+func (s *IndexSubscriber) findSubscription(id string) (*IndexSubscription, bool) {
+	for _, sub := range s.subscriptions {
+		if found, ok := findDependent(sub, id); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
 // Subscribe subscribes an index for updates.  The returned index subscription
 // has functions to retrieve a channel that produces a stream of index updates
 // and to stop the stream when the caller no longer wishes to receive updates.
+//
+// Subscriptions that share a prerequisite are independent of each other and
+// each receive updates once the prerequisite has processed them.
 func (s *IndexSubscriber) Subscribe(index Indexer, prerequisite string) (*IndexSubscription, error) {
 	sub := newIndexSubscription(s, index, prerequisite)
 
@@ -150,7 +208,7 @@ func (s *IndexSubscriber) Subscribe(index Indexer, prerequisite string) (*IndexS
 	// as a dependency.
 	if prerequisite != noPrereqs {
 		s.mtx.Lock()
-		prereq, ok := s.subscriptions[prerequisite]
+		prereq, ok := s.findSubscription(prerequisite)
 		s.mtx.Unlock()
 		if !ok {
 			return nil, fmt.Errorf("no subscription found with id %s", prerequisite)
@@ -159,12 +217,7 @@ func (s *IndexSubscriber) Subscribe(index Indexer, prerequisite string) (*IndexS
 		prereq.mtx.Lock()
 		defer prereq.mtx.Unlock()
 
-		if prereq.dependent != nil {
-			return nil, fmt.Errorf("%s already has a dependent set: %s",
-				prereq.id, prereq.dependent.id)
-		}
-
-		prereq.dependent = sub
+		prereq.dependents = append(prereq.dependents, sub)
 		atomic.AddUint32(&s.subscribers, 1)
 
 		return sub, nil
@@ -192,6 +245,29 @@ func (s *IndexSubscriber) Notify(ntfn *IndexNtfn) {
 	}
 }
 
+// lowestDependentTipHeight returns the lowest of the provided height and the
+// tip heights of the dependents of the provided subscription and their own
+// dependents.
+func lowestDependentTipHeight(sub *IndexSubscription, height int64) (int64, error) {
+	for _, dependent := range sub.dependents {
+		tipHeight, _, err := dependent.idx.Tip()
+		if err != nil {
+			return 0, err
+		}
+
+		if tipHeight < height {
+			height = tipHeight
+		}
+
+		height, err = lowestDependentTipHeight(dependent, height)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return height, nil
+}
+
 // findLowestIndexTipHeight determines the lowest index tip height among
 // subscribed indexes and their dependencies.
 func (s *IndexSubscriber) findLowestIndexTipHeight(queryer ChainQueryer) (int64, int64, error) {
@@ -215,18 +291,12 @@ func (s *IndexSubscriber) findLowestIndexTipHeight(queryer ChainQueryer) (int64,
 		}
 
 		// Update the lowest tip height if a dependent has a lower tip height.
-		dependent := sub.dependent
-		for dependent != nil {
-			tipHeight, _, err := sub.dependent.idx.Tip()
-			if err != nil {
-				return 0, bestHeight, err
-			}
-
-			if tipHeight < lowestHeight {
-				lowestHeight = tipHeight
-			}
-
-			dependent = dependent.dependent
+		dependentHeight, err := lowestDependentTipHeight(sub, lowestHeight)
+		if err != nil {
+			return 0, bestHeight, err
+		}
+		if dependentHeight < lowestHeight {
+			lowestHeight = dependentHeight
 		}
 	}
 
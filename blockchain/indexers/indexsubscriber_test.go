@@ -6,10 +6,14 @@ package indexers
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/decred/dcrd/blockchain/v4/chaingen"
 	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/dcrutil/v4"
 )
 
 // TestIndexSubscriberAsync ensures the index subscriber
@@ -50,7 +54,7 @@ func TestIndexSubscriberAsync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	addrIdx, err := NewAddrIndex(subber, db, chain)
+	addrIdx, err := NewAddrIndex(subber, db, chain, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -232,3 +236,270 @@ func TestIndexSubscriberAsync(t *testing.T) {
 			bk5.Hash().String(), existsAddrIdxTipHash.String())
 	}
 }
+
+// failingIndexer wraps an indexer to return the configured error when
+// processing notifications.
+type failingIndexer struct {
+	Indexer
+	err error
+}
+
+// ProcessNotification returns the configured error without updating the
+// wrapped index.
+func (f *failingIndexer) ProcessNotification(database.Tx, *IndexNtfn) error {
+	return f.err
+}
+
+// TestUpdateIndexDisconnectFailure ensures failing to disconnect a block does
+// not halt the index subscriber while failing to connect a block does.
+func TestUpdateIndexDisconnectFailure(t *testing.T) {
+	db, path := setupDB(t, "test_updateindexdisconnect")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	addBlock(t, chain, &g, "bk1")
+	bk2 := addBlock(t, chain, &g, "bk2")
+
+	ctx, pCancel := context.WithCancel(context.Background())
+	defer pCancel()
+
+	subber := NewIndexSubscriber(ctx)
+	existsAddrIdx, err := NewExistsAddrIndex(subber, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = subber.CatchUp(ctx, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cause := errors.New("injected failure")
+	idx := &failingIndexer{Indexer: existsAddrIdx}
+
+	// Ensure a disconnect failure is tolerated.
+	idx.err = DisconnectBlockError{Index: idx.Name(), Hash: *bk2.Hash(),
+		Err: cause}
+	bk1, err := chain.BlockByHash(&bk2.MsgBlock().Header.PrevBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = updateIndex(ctx, idx, &IndexNtfn{
+		NtfnType: DisconnectNtfn,
+		Block:    bk2,
+		Parent:   bk1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected disconnect error: %v", err)
+	}
+
+	// Ensure a connect failure is returned.
+	bk3 := addBlock(t, chain, &g, "bk3")
+	idx.err = ConnectBlockError{Index: idx.Name(), Hash: *bk3.Hash(),
+		Err: cause}
+	err = updateIndex(ctx, idx, &IndexNtfn{
+		NtfnType: ConnectNtfn,
+		Block:    bk3,
+		Parent:   bk2,
+	})
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected connect error %v, got %v", cause, err)
+	}
+}
+
+// TestIndexSubscriberStaleDisconnect ensures a disconnect notification for a
+// stale block at the same height as the address index tip is skipped without
+// halting the index subscriber.
+func TestIndexSubscriberStaleDisconnect(t *testing.T) {
+	db, path := setupDB(t, "test_indexsubberstaledisconnect")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	addBlock(t, chain, &g, "bk1")
+	bk2 := addBlock(t, chain, &g, "bk2")
+	bk3 := addBlock(t, chain, &g, "bk3")
+
+	// Create a block that competes with the tip without adding it to the
+	// chain by changing the nonce of the tip.
+	staleMsg := *bk3.MsgBlock()
+	staleMsg.Header.Nonce++
+	bk3a := dcrutil.NewBlock(&staleMsg)
+
+	ctx, pCancel := context.WithCancel(context.Background())
+	defer pCancel()
+
+	subber := NewIndexSubscriber(ctx)
+	go subber.Run(ctx)
+
+	err = AddIndexSpendConsumers(db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txIdx, err := NewTxIndex(subber, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrIdx, err := NewAddrIndex(subber, db, chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = subber.CatchUp(ctx, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the stale disconnect is skipped by the address index without
+	// halting the subscriber or modifying the index tip.  The notification
+	// is delivered to the address index directly since the transaction index
+	// does not reject stale disconnects.
+	err = updateIndex(ctx, addrIdx, &IndexNtfn{
+		NtfnType: DisconnectNtfn,
+		Block:    bk3a,
+		Parent:   bk2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected stale disconnect error: %v", err)
+	}
+	if err := subber.ctx.Err(); err != nil {
+		t.Fatalf("index subscriber halted: %v", err)
+	}
+
+	tipHeight, tipHash, err := addrIdx.Tip()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tipHeight != bk3.Height() || *tipHash != *bk3.Hash() {
+		t.Fatalf("unexpected tip: got %v (height %d), want %v (height %d)",
+			tipHash, tipHeight, bk3.Hash(), bk3.Height())
+	}
+
+	// Ensure the subscriber continues to update the indexes.
+	bk4 := addBlock(t, chain, &g, "bk4")
+	notifyAndWait(t, subber, &IndexNtfn{
+		NtfnType: ConnectNtfn,
+		Block:    bk4,
+		Parent:   bk3,
+	})
+
+	for _, indexer := range []Indexer{txIdx, addrIdx} {
+		tipHeight, tipHash, err := indexer.Tip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tipHeight != bk4.Height() || *tipHash != *bk4.Hash() {
+			t.Fatalf("%s: unexpected tip: got %v (height %d), want %v "+
+				"(height %d)", indexer.Name(), tipHash, tipHeight,
+				bk4.Hash(), bk4.Height())
+		}
+	}
+}
+
+// TestIndexSubscriberPausedUpdates ensures updates to the address index
+// delivered via notifications are not processed while its updates are locked,
+// such as while it is being reindexed, and are processed once they are
+// unlocked.
+func TestIndexSubscriberPausedUpdates(t *testing.T) {
+	db, path := setupDB(t, "test_indexsubberpaused")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	addBlock(t, chain, &g, "bk1")
+	bk2 := addBlock(t, chain, &g, "bk2")
+
+	ctx, pCancel := context.WithCancel(context.Background())
+	defer pCancel()
+
+	subber := NewIndexSubscriber(ctx)
+	go subber.Run(ctx)
+
+	err = AddIndexSpendConsumers(db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewTxIndex(subber, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrIdx, err := NewAddrIndex(subber, db, chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = subber.CatchUp(ctx, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// checkTip ensures the address index tip is the provided block.
+	checkTip := func(want *dcrutil.Block) {
+		t.Helper()
+
+		tipHeight, tipHash, err := addrIdx.Tip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tipHeight != want.Height() || *tipHash != *want.Hash() {
+			t.Fatalf("unexpected tip: got %v (height %d), want %v "+
+				"(height %d)", tipHash, tipHeight, want.Hash(),
+				want.Height())
+		}
+	}
+
+	// Ensure the notification is not processed while updates are locked.
+	addrIdx.lockUpdates()
+	bk3 := addBlock(t, chain, &g, "bk3")
+	done := make(chan bool)
+	subber.Notify(&IndexNtfn{
+		NtfnType: ConnectNtfn,
+		Block:    bk3,
+		Parent:   bk2,
+		Done:     done,
+	})
+	select {
+	case <-done:
+		t.Fatal("notification processed while updates are locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	checkTip(bk2)
+
+	// Ensure the notification is processed once updates are unlocked.
+	addrIdx.unlockUpdates()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for done signal for notification")
+	}
+	checkTip(bk3)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+// Metrics defines an interface that is used to instrument index operations so
+// callers can export them to a monitoring system.  Implementations must be
+// safe for concurrent access.
+//
+// The methods that report changes to the index are only invoked once the
+// database transaction that made the changes has been committed, so changes
+// that are rolled back are never reported.
+type Metrics interface {
+	// IncConnectedBlocks is invoked each time a block is connected to the
+	// index.
+	IncConnectedBlocks()
+
+	// ObserveEntriesFetched is invoked with the number of entries returned
+	// each time entries are fetched from the index.
+	ObserveEntriesFetched(numEntries int)
+
+	// IncRemovedEntries is invoked with the number of entries removed from
+	// the index each time a block is disconnected from it or entries are
+	// pruned or deleted from it.
+	IncRemovedEntries(numEntries int)
+}
+
+// noopMetrics is an implementation of Metrics that does nothing.  It is used
+// when no metrics implementation is provided so that callers do not need to
+// check for one.
+type noopMetrics struct{}
+
+// Ensure the noopMetrics type implements the Metrics interface.
+var _ Metrics = noopMetrics{}
+
+// IncConnectedBlocks does nothing.
+//
+// This is part of the Metrics interface.
+func (noopMetrics) IncConnectedBlocks() {}
+
+// ObserveEntriesFetched does nothing.
+//
+// This is part of the Metrics interface.
+func (noopMetrics) ObserveEntriesFetched(int) {}
+
+// IncRemovedEntries does nothing.
+//
+// This is part of the Metrics interface.
+func (noopMetrics) IncRemovedEntries(int) {}
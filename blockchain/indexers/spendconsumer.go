@@ -40,6 +40,15 @@ func (s *SpendConsumer) UpdateTip(hash *chainhash.Hash) {
 	s.mtx.Unlock()
 }
 
+// Tip returns the current tip of the consumer.  It is nil when the consumer has
+// not been initialized.
+func (s *SpendConsumer) Tip() *chainhash.Hash {
+	s.mtx.Lock()
+	tipHash := s.tipHash
+	s.mtx.Unlock()
+	return tipHash
+}
+
 // NeedSpendData checks whether the associated spend journal entry
 // for the provided block hash will be needed by the indexer.
 func (s *SpendConsumer) NeedSpendData(hash *chainhash.Hash) (bool, error) {
@@ -0,0 +1,516 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/decred/dcrd/blockchain/stake/v4"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/dcrutil/v4"
+	"github.com/decred/dcrd/wire"
+)
+
+const (
+	// spendIndexName is the human-readable name for the index.
+	spendIndexName = "spend index"
+
+	// spendIndexVersion is the current version of the spend index.
+	spendIndexVersion = 1
+
+	// spendKeySize is the number of bytes a key in the spend index consumes.
+	// It consists of the hash of the transaction that created the output +
+	// 4 bytes for the output index + 1 byte for the tree.
+	spendKeySize = chainhash.HashSize + 4 + 1
+
+	// spendEntrySize is the number of bytes an entry in the spend index
+	// consumes.  It consists of a transaction entry for the spending
+	// transaction + 4 bytes for the index of the input that spends the
+	// output.
+	spendEntrySize = txEntrySize + 4
+)
+
+var (
+	// spendIndexKey is the key of the spend index and the db bucket used
+	// to house it.
+	spendIndexKey = []byte("spendidx")
+)
+
+// -----------------------------------------------------------------------------
+// The spend index maps each output that has been spent in the main chain to
+// the transaction that spends it along with the index of the spending input.
+// It requires the transaction index since it uses the internal block IDs that
+// it maintains.
+//
+// The serialized key format is:
+//
+//   <tx hash><output index><tree>
+//
+//   Field           Type              Size
+//   tx hash         chainhash.Hash    32 bytes
+//   output index    uint32            4 bytes
+//   tree            int8              1 byte
+//   -----
+//   Total: 37 bytes
+//
+// The serialized value format is:
+//
+//   <block id><start offset><tx length><block index and tree><input index>
+//
+//   Field                Type      Size
+//   block id             uint32    4 bytes
+//   start offset         uint32    4 bytes
+//   tx length            uint32    4 bytes
+//   block index and tree uint32    4 bytes
+//   input index          uint32    4 bytes
+//   -----
+//   Total: 20 bytes
+//
+// The block index and tree field houses the index of the spending transaction
+// within its tree in the low bits and the tree flags in the same bits as the
+// entries of the address index, so the spending transaction is identified
+// without having to load the block.
+// -----------------------------------------------------------------------------
+
+// SpendIndexEntry houses information about the transaction that spends an
+// output according to the spend index.
+type SpendIndexEntry struct {
+	// Spender identifies the transaction that spends the output.
+	Spender TxIndexEntry
+
+	// InputIndex is the index of the input of the spending transaction that
+	// spends the output.
+	InputIndex uint32
+}
+
+// spendKey returns the key in the spend index for the provided outpoint.
+func spendKey(outpoint *wire.OutPoint) [spendKeySize]byte {
+	var key [spendKeySize]byte
+	copy(key[:], outpoint.Hash[:])
+	byteOrder.PutUint32(key[chainhash.HashSize:], outpoint.Index)
+	key[spendKeySize-1] = byte(outpoint.Tree)
+	return key
+}
+
+// dbPutSpendIndexEntry uses an existing database transaction to update the
+// spend index to map the provided outpoint to the spending transaction
+// identified by the provided values.
+func dbPutSpendIndexEntry(bucket internalBucket, outpoint *wire.OutPoint, blockID uint32, txLoc wire.TxLoc, blockIndex uint32, tree int8, inputIndex uint32) error {
+	key := spendKey(outpoint)
+	serialized := make([]byte, spendEntrySize)
+	putTxIndexEntry(serialized, blockID, txLoc,
+		blockIndex|encodeEntryTree(tree))
+	byteOrder.PutUint32(serialized[txEntrySize:], inputIndex)
+	return bucket.Put(key[:], serialized)
+}
+
+// dbFetchSpendIndexEntry uses an existing database transaction to fetch the
+// spending transaction details for the provided outpoint from the spend index.
+// When there is no entry for the provided outpoint, nil will be returned for
+// both the entry and the error.
+func dbFetchSpendIndexEntry(dbTx database.Tx, outpoint *wire.OutPoint) (*SpendIndexEntry, error) {
+	// Load the record from the database and return now if it doesn't exist.
+	key := spendKey(outpoint)
+	serialized := dbTx.Metadata().Bucket(spendIndexKey).Get(key[:])
+	if len(serialized) == 0 {
+		return nil, nil
+	}
+
+	// Ensure the serialized data has enough bytes to properly deserialize.
+	if len(serialized) < spendEntrySize {
+		str := fmt.Sprintf("corrupt spend index entry for %v", outpoint)
+		return nil, makeDbErr(database.ErrCorruption, str)
+	}
+
+	// Load the block hash associated with the block ID.
+	hash, err := dbFetchBlockHashBySerializedID(dbTx, serialized[0:4])
+	if err != nil {
+		str := fmt.Sprintf("corrupt spend index entry for %v: %v", outpoint,
+			err)
+		return nil, makeDbErr(database.ErrCorruption, str)
+	}
+
+	// Deserialize the final entry.
+	blockIndexFlags := byteOrder.Uint32(serialized[12:16])
+	entry := SpendIndexEntry{
+		Spender: TxIndexEntry{
+			BlockRegion: database.BlockRegion{
+				Hash:   new(chainhash.Hash),
+				Offset: byteOrder.Uint32(serialized[4:8]),
+				Len:    byteOrder.Uint32(serialized[8:12]),
+			},
+			BlockIndex: blockIndexFlags & blockIndexMask,
+			Tree:       decodeEntryTree(blockIndexFlags),
+		},
+		InputIndex: byteOrder.Uint32(serialized[16:20]),
+	}
+	copy(entry.Spender.BlockRegion.Hash[:], hash[:])
+	return &entry, nil
+}
+
+// SpendIndex implements an index that maps each output spent in the main chain
+// to the transaction that spends it.
+type SpendIndex struct {
+	// The following fields are set when the instance is created and can't
+	// be changed afterwards, so there is no need to protect them with a
+	// separate mutex.
+	db    database.DB
+	chain ChainQueryer
+	sub   *IndexSubscription
+
+	subscribers map[chan bool]struct{}
+	mtx         sync.Mutex
+	cancel      context.CancelFunc
+}
+
+// Ensure the SpendIndex type implements the Indexer interface.
+var _ Indexer = (*SpendIndex)(nil)
+
+// Ensure the SpendIndex type implements the IndexDropper interface.
+var _ IndexDropper = (*SpendIndex)(nil)
+
+// Init initializes the spend index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Init(ctx context.Context, chainParams *chaincfg.Params) error {
+	if interruptRequested(ctx) {
+		return errInterruptRequested
+	}
+
+	// Finish any drops that were previously interrupted.
+	if err := finishDrop(ctx, idx); err != nil {
+		return err
+	}
+
+	// Create the initial state for the index as needed.
+	if err := createIndex(idx, &chainParams.GenesisHash); err != nil {
+		return err
+	}
+
+	// Upgrade the index as needed.
+	if err := upgradeIndex(ctx, idx, &chainParams.GenesisHash); err != nil {
+		return err
+	}
+
+	// Recover the spend index and its dependents to the main chain if
+	// needed.
+	if err := recover(ctx, idx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Key() []byte {
+	return spendIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Name() string {
+	return spendIndexName
+}
+
+// Version returns the current version of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Version() uint32 {
+	return spendIndexVersion
+}
+
+// DB returns the database of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) DB() database.DB {
+	return idx.db
+}
+
+// Queryer returns the chain queryer.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Queryer() ChainQueryer {
+	return idx.chain
+}
+
+// Tip returns the current tip of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Tip() (int64, *chainhash.Hash, error) {
+	return tip(idx.db, idx.Key())
+}
+
+// Create is invoked when the index is created for the first time.  It creates
+// the bucket for the spend index.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(spendIndexKey)
+	return err
+}
+
+// IndexSubscription returns the subscription for index updates.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) IndexSubscription() *IndexSubscription {
+	return idx.sub
+}
+
+// Subscribers returns all client channels waiting for the next index update.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) Subscribers() map[chan bool]struct{} {
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	return idx.subscribers
+}
+
+// WaitForSync subscribes clients for the next index sync update.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) WaitForSync() chan bool {
+	c := make(chan bool)
+
+	idx.mtx.Lock()
+	idx.subscribers[c] = struct{}{}
+	idx.mtx.Unlock()
+
+	return c
+}
+
+// forEachSpentOutpoint invokes the provided function with the outpoint, index
+// of the spending transaction within the combined regular and stake
+// transactions of the block, and index of the spending input for every input
+// in the provided block that spends a previous output.
+func forEachSpentOutpoint(block *dcrutil.Block, isTreasuryEnabled bool, fn func(outpoint *wire.OutPoint, txIdx int, inputIdx uint32) error) error {
+	regularTxns := block.Transactions()
+	for txIdx, tx := range regularTxns {
+		// Coinbases do not reference any inputs.
+		if txIdx == 0 {
+			continue
+		}
+
+		for i, txIn := range tx.MsgTx().TxIn {
+			err := fn(&txIn.PreviousOutPoint, txIdx, uint32(i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for txIdx, tx := range block.STransactions() {
+		msgTx := tx.MsgTx()
+		thisTxOffset := txIdx + len(regularTxns)
+
+		// Treasury bases and treasury spends do not reference any
+		// previous outputs.
+		if isTreasuryEnabled && (stake.IsTreasuryBase(msgTx) ||
+			stake.IsTSpend(msgTx)) {
+
+			continue
+		}
+
+		isSSGen := stake.IsSSGen(msgTx, isTreasuryEnabled)
+		for i, txIn := range msgTx.TxIn {
+			// Skip stakebases.
+			if isSSGen && i == 0 {
+				continue
+			}
+
+			err := fn(&txIn.PreviousOutPoint, thisTxOffset, uint32(i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// connectBlock adds a mapping for every output spent by the transactions in
+// the provided block to the spending transaction.
+func (idx *SpendIndex) connectBlock(dbTx database.Tx, block *dcrutil.Block, isTreasuryEnabled bool) error {
+	// NOTE: The fact that the block can disapprove the regular tree of the
+	// previous block is ignored for this index because even though the
+	// disapproved transactions no longer apply spend semantics, they still
+	// exist within the block.
+
+	// The offset and length of the transactions within the serialized block.
+	txLocs, stakeTxLocs, err := block.TxLoc()
+	if err != nil {
+		return err
+	}
+
+	// Get the internal block ID associated with the block.
+	blockID, err := dbFetchBlockIDByHash(dbTx, block.Hash())
+	if err != nil {
+		return err
+	}
+
+	stakeIdxsStart := len(txLocs)
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	err = forEachSpentOutpoint(block, isTreasuryEnabled,
+		func(outpoint *wire.OutPoint, txIdx int, inputIdx uint32) error {
+			// Adjust the block index and slice of transaction locations to
+			// use based on the regular or stake tree.
+			txLocations := txLocs
+			blockIndex := txIdx
+			tree := wire.TxTreeRegular
+			if txIdx >= stakeIdxsStart {
+				txLocations = stakeTxLocs
+				blockIndex -= stakeIdxsStart
+				tree = wire.TxTreeStake
+			}
+
+			return dbPutSpendIndexEntry(bucket, outpoint, blockID,
+				txLocations[blockIndex], uint32(blockIndex), tree, inputIdx)
+		})
+	if err != nil {
+		return err
+	}
+
+	// Update the current index tip.
+	return dbPutIndexerTip(dbTx, idx.Key(), block.Hash(), int32(block.Height()))
+}
+
+// disconnectBlock removes the mappings for every output spent by the
+// transactions in the provided block.
+func (idx *SpendIndex) disconnectBlock(dbTx database.Tx, block *dcrutil.Block, isTreasuryEnabled bool) error {
+	// Reject blocks that are not the current index tip since disconnecting
+	// them would remove the mappings for outputs spent by other blocks.
+	tipHash, tipHeight, err := dbFetchIndexerTip(dbTx, idx.Key())
+	if err != nil {
+		return err
+	}
+	if *tipHash != *block.Hash() {
+		return fmt.Errorf("%w: block %s (height %d) is not tip %s (height %d)",
+			ErrIndexTipMismatch, block.Hash(), block.Height(), tipHash,
+			tipHeight)
+	}
+
+	bucket := dbTx.Metadata().Bucket(spendIndexKey)
+	err = forEachSpentOutpoint(block, isTreasuryEnabled,
+		func(outpoint *wire.OutPoint, _ int, _ uint32) error {
+			key := spendKey(outpoint)
+			return bucket.Delete(key[:])
+		})
+	if err != nil {
+		return err
+	}
+
+	// Update the current index tip.
+	return dbPutIndexerTip(dbTx, idx.Key(), &block.MsgBlock().Header.PrevBlock,
+		int32(block.Height()-1))
+}
+
+// SpenderForOutpoint returns details about the transaction that spends the
+// provided outpoint in the main chain.  Nil is returned for both the entry and
+// the error when the outpoint has not been spent in the main chain.
+//
+// This function is safe for concurrent access.
+func (idx *SpendIndex) SpenderForOutpoint(outpoint *wire.OutPoint) (*SpendIndexEntry, error) {
+	var entry *SpendIndexEntry
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		entry, err = dbFetchSpendIndexEntry(dbTx, outpoint)
+		return err
+	})
+	return entry, err
+}
+
+// NewSpendIndex returns a new instance of an indexer that is used to create a
+// mapping of all spent outputs in the blockchain to the transactions that spend
+// them.
+func NewSpendIndex(subscriber *IndexSubscriber, db database.DB, chain ChainQueryer) (*SpendIndex, error) {
+	idx := &SpendIndex{
+		db:          db,
+		chain:       chain,
+		subscribers: make(map[chan bool]struct{}),
+		cancel:      subscriber.cancel,
+	}
+
+	// The spend index is an optional index.  It depends on the transaction
+	// index and as a result synchronously updates with it.
+	sub, err := subscriber.Subscribe(idx, txIndexName)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.sub = sub
+
+	err = idx.Init(subscriber.ctx, chain.ChainParams())
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// DropSpendIndex drops the spend index from the provided database if it
+// exists.
+func DropSpendIndex(ctx context.Context, db database.DB) error {
+	return dropFlatIndex(ctx, db, spendIndexKey, spendIndexName)
+}
+
+// DropIndex drops the spend index from the provided database if it exists.
+func (*SpendIndex) DropIndex(ctx context.Context, db database.DB) error {
+	return DropSpendIndex(ctx, db)
+}
+
+// ProcessNotification indexes the provided notification based on its
+// notification type.
+//
+// This is part of the Indexer interface.
+func (idx *SpendIndex) ProcessNotification(dbTx database.Tx, ntfn *IndexNtfn) error {
+	switch ntfn.NtfnType {
+	case ConnectNtfn:
+		err := idx.connectBlock(dbTx, ntfn.Block, ntfn.IsTreasuryEnabled)
+		if err != nil {
+			return ConnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+		}
+
+	case DisconnectNtfn:
+		// Determine whether or not the treasury agenda is active for the
+		// block from the chain rather than the notification since the
+		// outputs removed must be identified exactly as they were when the
+		// block was connected.
+		isTreasuryEnabled, err := treasuryEnabledForBlock(idx.chain,
+			ntfn.Block)
+		if err != nil {
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
+		}
+		if isTreasuryEnabled != ntfn.IsTreasuryEnabled {
+			log.Warnf("%s: ignoring stale treasury agenda state %v in "+
+				"disconnect notification for block %s (height %d)",
+				idx.Name(), ntfn.IsTreasuryEnabled, ntfn.Block.Hash(),
+				ntfn.Block.Height())
+		}
+
+		err = idx.disconnectBlock(dbTx, ntfn.Block, isTreasuryEnabled)
+		if err != nil {
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
+		}
+
+	default:
+		return fmt.Errorf("%s: unknown notification type received: %d",
+			idx.Name(), ntfn.NtfnType)
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+// Copyright (c) 2021 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/decred/dcrd/blockchain/v4/chaingen"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/chaincfg/v3"
+	"github.com/decred/dcrd/database/v3"
+	"github.com/decred/dcrd/wire"
+)
+
+// TestSpendIndex ensures the spend index maps spent outputs to the spending
+// transactions as blocks are connected and disconnected and that it can be
+// dropped.
+func TestSpendIndex(t *testing.T) {
+	db, path := setupDB(t, "test_spendindex")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &SpendIndex{
+		db:          db,
+		chain:       chain,
+		subscribers: make(map[chan bool]struct{}),
+	}
+	err = createIndex(idx, &chain.ChainParams().GenesisHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The spend index relies on the internal block ID buckets maintained by
+	// the transaction index.
+	err = db.Update(func(dbTx database.Tx) error {
+		return (&TxIndex{}).Create(dbTx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Create a block with a transaction that spends two outputs.
+	spentOut0 := wire.OutPoint{Hash: chainhash.Hash{0x01}, Index: 2}
+	spentOut1 := wire.OutPoint{Hash: chainhash.Hash{0x02}, Index: 0,
+		Tree: wire.TxTreeStake}
+	spendTx := wire.NewMsgTx()
+	spendTx.AddTxIn(wire.NewTxIn(&spentOut0, 1e8, nil))
+	spendTx.AddTxIn(wire.NewTxIn(&spentOut1, 1e8, nil))
+	spendTx.AddTxOut(wire.NewTxOut(2e8, []byte{0x51}))
+	// Also include a stake transaction that spends another output.
+	spentOut2 := wire.OutPoint{Hash: chainhash.Hash{0x03}, Index: 1,
+		Tree: wire.TxTreeStake}
+	stakeSpendTx := wire.NewMsgTx()
+	stakeSpendTx.AddTxIn(wire.NewTxIn(&spentOut2, 1e8, nil))
+	stakeSpendTx.AddTxOut(wire.NewTxOut(1e8, []byte{0x51}))
+	block := newTestBlock(1, &chain.ChainParams().GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1), spendTx},
+		[]*wire.MsgTx{stakeSpendTx})
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIDIndexEntry(dbTx, block.Hash(), 1)
+		if err != nil {
+			return err
+		}
+		return idx.connectBlock(dbTx, block, false)
+	})
+	if err != nil {
+		t.Fatalf("unable to connect block: %v", err)
+	}
+
+	// Ensure the spent outputs map to the spending transaction and input.
+	txLocs, stakeTxLocs, err := block.TxLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, outpoint := range []wire.OutPoint{spentOut0, spentOut1} {
+		entry, err := idx.SpenderForOutpoint(&outpoint)
+		if err != nil {
+			t.Fatalf("unexpected error fetching spender: %v", err)
+		}
+		if entry == nil {
+			t.Fatalf("no spender for %v", outpoint)
+		}
+		region := &entry.Spender.BlockRegion
+		if *region.Hash != *block.Hash() {
+			t.Fatalf("unexpected block hash: got %v, want %v", region.Hash,
+				block.Hash())
+		}
+		if region.Offset != uint32(txLocs[1].TxStart) ||
+			region.Len != uint32(txLocs[1].TxLen) {
+
+			t.Fatalf("unexpected block region: %+v", region)
+		}
+		if entry.Spender.BlockIndex != 1 {
+			t.Fatalf("unexpected block index: got %d, want 1",
+				entry.Spender.BlockIndex)
+		}
+		if entry.Spender.Tree != wire.TxTreeRegular {
+			t.Fatalf("unexpected tree: got %d, want %d", entry.Spender.Tree,
+				wire.TxTreeRegular)
+		}
+		if entry.InputIndex != uint32(i) {
+			t.Fatalf("unexpected input index: got %d, want %d",
+				entry.InputIndex, i)
+		}
+	}
+
+	// Ensure the output spent by the stake transaction maps to it along with
+	// the stake tree.
+	entry, err := idx.SpenderForOutpoint(&spentOut2)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry == nil {
+		t.Fatalf("no spender for %v", spentOut2)
+	}
+	region := &entry.Spender.BlockRegion
+	if region.Offset != uint32(stakeTxLocs[0].TxStart) ||
+		region.Len != uint32(stakeTxLocs[0].TxLen) {
+
+		t.Fatalf("unexpected block region: %+v", region)
+	}
+	if entry.Spender.BlockIndex != 0 || entry.Spender.Tree != wire.TxTreeStake {
+		t.Fatalf("unexpected block index %d and tree %d for stake spender",
+			entry.Spender.BlockIndex, entry.Spender.Tree)
+	}
+
+	// Ensure outputs that were not spent do not have a spender, including
+	// one that only differs by tree.
+	unspentOut := spentOut1
+	unspentOut.Tree = wire.TxTreeRegular
+	entry, err = idx.SpenderForOutpoint(&unspentOut)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("unexpected spender for unspent output: %+v", entry)
+	}
+
+	// Ensure disconnecting a block that is not the index tip is rejected
+	// without removing the entries.
+	staleBlock := newTestBlock(2, block.Hash(),
+		[]*wire.MsgTx{newTestCoinbase(2), spendTx}, nil)
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, staleBlock, false)
+	})
+	if !errors.Is(err, ErrIndexTipMismatch) {
+		t.Fatalf("unexpected error disconnecting stale block: got %v, want "+
+			"%v", err, ErrIndexTipMismatch)
+	}
+	entry, err = idx.SpenderForOutpoint(&spentOut0)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry == nil {
+		t.Fatal("spender removed by stale disconnect")
+	}
+
+	// Ensure disconnecting the block removes the entries.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.disconnectBlock(dbTx, block, false)
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	entry, err = idx.SpenderForOutpoint(&spentOut0)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("unexpected spender after disconnect: %+v", entry)
+	}
+
+	// Ensure the index can be dropped.
+	if err := DropSpendIndex(context.Background(), db); err != nil {
+		t.Fatalf("unable to drop spend index: %v", err)
+	}
+	exists, err := existsIndex(db, spendIndexKey, spendIndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("spend index still exists after drop")
+	}
+}
+
+// TestSpendIndexCatchUp ensures the spend index and the address index are
+// independent dependents of the transaction index and remain in sync.
+func TestSpendIndexCatchUp(t *testing.T) {
+	db, path := setupDB(t, "test_spendindex_catchup")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bk1 := newTestBlock(1, &chain.ChainParams().GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, nil)
+	if err := chain.AddBlock(bk1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subber := NewIndexSubscriber(ctx)
+	go subber.Run(ctx)
+
+	if err := AddIndexSpendConsumers(db, chain); err != nil {
+		t.Fatal(err)
+	}
+	txIdx, err := NewTxIndex(subber, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrIdx, err := NewAddrIndex(subber, db, chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spendIdx, err := NewSpendIndex(subber, db, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the spend index and the address index are both dependents of
+	// the transaction index and neither depends on the other.
+	checkDependents := func(sub *IndexSubscription, want ...*IndexSubscription) {
+		t.Helper()
+		if len(sub.dependents) != len(want) {
+			t.Fatalf("%s: unexpected number of dependents: got %d, want %d",
+				sub.id, len(sub.dependents), len(want))
+		}
+		for i := range want {
+			if sub.dependents[i] != want[i] {
+				t.Fatalf("%s: unexpected dependent %d: got %s, want %s",
+					sub.id, i, sub.dependents[i].id, want[i].id)
+			}
+		}
+	}
+	checkDependents(txIdx.sub, addrIdx.sub, spendIdx.sub)
+	checkDependents(addrIdx.sub)
+	checkDependents(spendIdx.sub)
+	if spendIdx.sub.prerequisite != txIndexName {
+		t.Fatalf("unexpected spend index prerequisite: %s",
+			spendIdx.sub.prerequisite)
+	}
+
+	if err := subber.CatchUp(ctx, db, chain); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure new blocks propagate to all dependents.
+	bk2 := newTestBlock(2, bk1.Hash(), []*wire.MsgTx{newTestCoinbase(2)}, nil)
+	if err := chain.AddBlock(bk2); err != nil {
+		t.Fatal(err)
+	}
+	notifyAndWait(t, subber, &IndexNtfn{
+		NtfnType: ConnectNtfn,
+		Block:    bk2,
+		Parent:   bk1,
+	})
+	for _, idx := range []Indexer{txIdx, addrIdx, spendIdx} {
+		height, hash, err := idx.Tip()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height != bk2.Height() || *hash != *bk2.Hash() {
+			t.Fatalf("%s: unexpected tip %d (%v)", idx.Name(), height, hash)
+		}
+	}
+
+	// Ensure stopping the address index subscription leaves the spend index
+	// as the only dependent of the transaction index.
+	if err := addrIdx.sub.stop(); err != nil {
+		t.Fatal(err)
+	}
+	checkDependents(txIdx.sub, spendIdx.sub)
+
+	// Ensure dropping the transaction index also drops the spend index since
+	// it relies on it.
+	if err := DropTxIndex(ctx, db); err != nil {
+		t.Fatalf("unable to drop tx index: %v", err)
+	}
+	exists, err := existsIndex(db, spendIndexKey, spendIndexName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Fatal("spend index still exists after dropping the tx index")
+	}
+}
+
+// TestSpendIndexTreasuryActivationReorg ensures disconnecting a block via a
+// notification with a stale treasury agenda state removes all of the mappings
+// added when the block was connected.
+func TestSpendIndexTreasuryActivationReorg(t *testing.T) {
+	db, path := setupDB(t, "test_spendindex_treasuryreorg")
+	defer teardownDB(db, path)
+
+	chain, err := newTestChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := &SpendIndex{
+		db:          db,
+		chain:       chain,
+		subscribers: make(map[chan bool]struct{}),
+	}
+	err = createIndex(idx, &chain.ChainParams().GenesisHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		return (&TxIndex{}).Create(dbTx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := chaingen.MakeGenerator(chaincfg.SimNetParams())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Connect a block with a treasury spend while the treasury agenda is not
+	// active, which records the input of the treasury spend like any other
+	// stake transaction input.
+	addr := testP2PKHAddr(t, 0x01)
+	payouts := []chaingen.AddressAmountTuple{{Address: addr, Amount: 1e8}}
+	tspend := g.CreateTreasuryTSpend(bytes.Repeat([]byte{0x11}, 32), payouts,
+		1000, 10)
+	block1 := newTestBlock(1, &chain.ChainParams().GenesisHash,
+		[]*wire.MsgTx{newTestCoinbase(1)}, []*wire.MsgTx{tspend})
+	if err := chain.AddBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(dbTx database.Tx) error {
+		err := dbPutBlockIDIndexEntry(dbTx, block1.Hash(), 1)
+		if err != nil {
+			return err
+		}
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType:          ConnectNtfn,
+			Block:             block1,
+			IsTreasuryEnabled: false,
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to connect block: %v", err)
+	}
+	spentOut := tspend.TxIn[0].PreviousOutPoint
+	entry, err := idx.SpenderForOutpoint(&spentOut)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry == nil {
+		t.Fatal("no spender for treasury spend input")
+	}
+
+	// Disconnect the block with a notification that claims the treasury
+	// agenda is active while the chain reports it is not active for the
+	// block and ensure the mapping is removed regardless.
+	err = db.Update(func(dbTx database.Tx) error {
+		return idx.ProcessNotification(dbTx, &IndexNtfn{
+			NtfnType:          DisconnectNtfn,
+			Block:             block1,
+			IsTreasuryEnabled: true,
+		})
+	})
+	if err != nil {
+		t.Fatalf("unable to disconnect block: %v", err)
+	}
+	entry, err = idx.SpenderForOutpoint(&spentOut)
+	if err != nil {
+		t.Fatalf("unexpected error fetching spender: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("unexpected spender after disconnect: %+v", entry)
+	}
+}
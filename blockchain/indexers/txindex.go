@@ -111,6 +111,55 @@ type TxIndexEntry struct {
 	// BlockIndex species the index of the transaction within the array of
 	// transactions that comprise a tree of the block.
 	BlockIndex uint32
+
+	// Tree specifies the tree of the block the transaction is in.  It is
+	// wire.TxTreeUnknown when the tree is not known, such as for entries
+	// created by versions of the address index that did not track it and
+	// for all entries of the transaction index.  It is known for the
+	// spending transactions of the spend index.
+	Tree int8
+
+	// StakeTags specifies the kinds of stake outputs of the transaction that
+	// pay to the address of an address index entry.  It is always zero for
+	// entries of the transaction index.
+	StakeTags StakeTag
+
+	// Class specifies the kind of transaction.  It is TxClassUnknown for
+	// entries created by versions of the address index prior to version 3 and
+	// for all entries of the transaction index.
+	Class TxClass
+
+	// OutputKind specifies whether the outputs of the transaction that pay to
+	// the address of an address index entry are likely change or payments.
+	// It is OutputKindUnknown when the outputs were not analyzed and for all
+	// entries of the transaction index.
+	OutputKind OutputKind
+
+	// Credit specifies whether or not any of the outputs of the transaction
+	// pay to the address of an address index entry.  It is only set when the
+	// address index is configured to flag credits and is always false for
+	// entries of the transaction index.
+	Credit bool
+
+	// Disapproved specifies whether or not the transaction is in the regular
+	// tree of a block whose regular tree was disapproved by the votes in the
+	// next block.  It is only set when the address index is configured to
+	// track disapprovals and is always false for entries of the transaction
+	// index.
+	Disapproved bool
+
+	// InputIndexes specifies the indices of the inputs of the transaction that
+	// spend outputs which pay to the address of an address index entry in the
+	// order they appear in the transaction.  It is nil when none of the inputs
+	// reference the address and when InputIndexesKnown is false.
+	InputIndexes []uint32
+
+	// InputIndexesKnown specifies whether or not the input indices of the
+	// transaction are known.  It is only set when the address index is
+	// configured to track input indices and is false for entries created by
+	// versions of the address index prior to version 3 and for all entries of
+	// the transaction index.
+	InputIndexesKnown bool
 }
 
 // dbPutBlockIDIndexEntry uses an existing database transaction to update or add
@@ -239,6 +288,7 @@ func dbFetchTxIndexEntry(dbTx database.Tx, txHash *chainhash.Hash) (*TxIndexEntr
 			Len:    byteOrder.Uint32(serializedData[8:12]),
 		},
 		BlockIndex: byteOrder.Uint32(serializedData[12:16]),
+		Tree:       wire.TxTreeUnknown,
 	}
 	copy(entry.BlockRegion.Hash[:], hash[:])
 	return &entry, nil
@@ -639,8 +689,8 @@ func dropBlockIDIndex(db database.DB) error {
 }
 
 // DropTxIndex drops the transaction index from the provided database if it
-// exists.  Since the address index relies on it, the address index will also be
-// dropped when it exists.
+// exists.  Since the address and spend indexes rely on it, they will also be
+// dropped when they exist.
 func DropTxIndex(ctx context.Context, db database.DB) error {
 	// Nothing to do if the index doesn't already exist.
 	exists, err := existsIndex(db, txIndexKey, txIndexName)
@@ -667,6 +717,13 @@ func DropTxIndex(ctx context.Context, db database.DB) error {
 		return err
 	}
 
+	// Drop the spend index if it exists, as it depends on the transaction
+	// index.
+	err = DropSpendIndex(ctx, db)
+	if err != nil {
+		return err
+	}
+
 	log.Infof("Dropping all %s entries.  This might take a while...",
 		txIndexName)
 
@@ -714,14 +771,18 @@ func (idx *TxIndex) ProcessNotification(dbTx database.Tx, ntfn *IndexNtfn) error
 		err := idx.connectBlock(dbTx, ntfn.Block, ntfn.Parent,
 			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
 		if err != nil {
-			return fmt.Errorf("%s: unable to connect block: %v", idx.Name(), err)
+			return ConnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
 		}
 
 	case DisconnectNtfn:
 		err := idx.disconnectBlock(dbTx, ntfn.Block, ntfn.Parent,
 			ntfn.PrevScripts, ntfn.IsTreasuryEnabled)
 		if err != nil {
-			log.Errorf("%s: unable to disconnect block: %v", idx.Name(), err)
+			dErr := DisconnectBlockError{Index: idx.Name(),
+				Hash: *ntfn.Block.Hash(), Err: err}
+			log.Error(dErr)
+			return dErr
 		}
 
 	default:
@@ -94,3 +94,14 @@ func dbFetchSpendConsumerDeps(dbTx database.Tx) (map[chainhash.Hash][]string, er
 
 	return consumerDeps, nil
 }
+
+// FetchSpendConsumerDeps uses an existing database transaction to fetch all
+// spend consumer dependency entries in the database keyed by the hash of the
+// block the consumers depend on.  No entries are returned when the spend
+// consumer dependencies bucket has not been created.
+func FetchSpendConsumerDeps(dbTx database.Tx) (map[chainhash.Hash][]string, error) {
+	if dbTx.Metadata().Bucket(spendConsumerDepsBucketName) == nil {
+		return nil, nil
+	}
+	return dbFetchSpendConsumerDeps(dbTx)
+}
@@ -194,6 +194,36 @@ func (view *UtxoViewpoint) PrevScript(prevOut *wire.OutPoint) (uint16, []byte, b
 	return version, pkScript, true
 }
 
+// PrevAmount returns the amount associated with the provided previous outpoint
+// along with a bool that indicates whether or not the requested entry exists.
+func (view *UtxoViewpoint) PrevAmount(prevOut *wire.OutPoint) (int64, bool) {
+	entry := view.LookupEntry(*prevOut)
+	if entry == nil {
+		return 0, false
+	}
+	return entry.Amount(), true
+}
+
+// PrevTicketOutputs returns the minimal outputs of the ticket purchase that
+// created the provided previous outpoint along with a bool that indicates
+// whether or not the requested entry exists, was created by a ticket, and has
+// well-formed minimal outputs.
+func (view *UtxoViewpoint) PrevTicketOutputs(prevOut *wire.OutPoint) ([]*stake.MinimalOutput, bool) {
+	entry := view.LookupEntry(*prevOut)
+	if entry == nil || entry.ticketMinOuts == nil {
+		return nil, false
+	}
+
+	// Ensure the minimal outputs are well formed before deserializing them
+	// since deserializing malformed data would otherwise panic.
+	serialized := entry.ticketMinOuts.data
+	if _, err := readDeserializeSizeOfMinimalOutputs(serialized); err != nil {
+		return nil, false
+	}
+	minOuts, _ := deserializeToMinimalOutputs(serialized)
+	return minOuts, true
+}
+
 // PriorityInput returns the block height and amount associated with the
 // provided previous outpoint along with a bool that indicates whether or not
 // the requested entry exists.  This ensures the caller is able to distinguish
@@ -5,6 +5,7 @@
 package blockchain
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/decred/dcrd/blockchain/v4/chaingen"
@@ -228,3 +229,54 @@ func TestFetchUtxoView(t *testing.T) {
 	}
 	testInputsSpent(view, spendB1aTx1Out0, true)
 }
+
+// TestUtxoViewpointPrevTicketOutputs ensures the ticket outputs provided by a
+// utxo viewpoint are only reported as found when they exist and decode
+// successfully.
+func TestUtxoViewpointPrevTicketOutputs(t *testing.T) {
+	t.Parallel()
+
+	// Serialize the minimal outputs of a transaction with a couple of
+	// outputs.
+	msgTx := wire.NewMsgTx()
+	msgTx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	msgTx.AddTxOut(wire.NewTxOut(2000, []byte{0x52, 0x53}))
+	tx := dcrutil.NewTx(msgTx)
+	serialized := make([]byte, serializeSizeForMinimalOutputs(tx))
+	putTxToMinimalOutputs(serialized, tx)
+
+	valid := wire.OutPoint{Index: 0}
+	truncated := wire.OutPoint{Index: 1}
+	notTicket := wire.OutPoint{Index: 2}
+	missing := wire.OutPoint{Index: 3}
+	view := NewUtxoViewpoint(nil)
+	view.entries[valid] = &UtxoEntry{
+		amount:        1000,
+		pkScript:      []byte{0x51},
+		ticketMinOuts: &ticketMinimalOutputs{data: serialized},
+	}
+	view.entries[truncated] = &UtxoEntry{
+		amount:   1000,
+		pkScript: []byte{0x51},
+		ticketMinOuts: &ticketMinimalOutputs{
+			data: serialized[:len(serialized)-1],
+		},
+	}
+	view.entries[notTicket] = &UtxoEntry{amount: 1000, pkScript: []byte{0x51}}
+
+	minOuts, ok := view.PrevTicketOutputs(&valid)
+	if !ok {
+		t.Fatal("ticket outputs for valid entry not found")
+	}
+	if len(minOuts) != 2 || minOuts[0].Value != 1000 ||
+		minOuts[1].Value != 2000 ||
+		!bytes.Equal(minOuts[1].PkScript, []byte{0x52, 0x53}) {
+
+		t.Fatalf("unexpected ticket outputs for valid entry: %+v", minOuts)
+	}
+	for _, prevOut := range []wire.OutPoint{truncated, notTicket, missing} {
+		if _, ok := view.PrevTicketOutputs(&prevOut); ok {
+			t.Fatalf("unexpected ticket outputs found for %v", prevOut)
+		}
+	}
+}
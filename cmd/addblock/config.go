@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/decred/dcrd/blockchain/v4/indexers"
 	"github.com/decred/dcrd/chaincfg/v3"
 	"github.com/decred/dcrd/database/v3"
 	_ "github.com/decred/dcrd/database/v3/ffldb"
@@ -43,7 +44,27 @@ type config struct {
 	NoExistsAddrIndex bool   `long:"noexistsaddrindex" description:"Do not build a full index of which addresses were ever seen on the blockchain"`
 	TxIndex           bool   `long:"txindex" description:"Build a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	AddrIndex         bool   `long:"addrindex" description:"Build a full address-based transaction index which makes the searchrawtransactions RPC available"`
+	SpendIndex        bool   `long:"spendindex" description:"Build a full index of the transactions that spend each output in the main chain"`
 	Progress          int    `short:"p" long:"progress" description:"Show a progress message each time this number of seconds have passed -- Use 0 to disable progress announcements"`
+
+	// Address index options.  These must match the options dcrd is run with
+	// since they are persisted with the address index.
+	AddrIndexSkipCoinbase      bool     `long:"addrindexskipcoinbase" description:"Do not index the addresses paid by the outputs of coinbase transactions in the address index"`
+	AddrIndexRedeemScripts     bool     `long:"addrindexredeemscripts" description:"Also index the addresses embedded in the redeem scripts revealed by inputs that spend pay-to-script-hash outputs"`
+	AddrIndexExtendedKeys      bool     `long:"addrindexextendedkeys" description:"Distinguish payments to public keys from payments to their hashes in the address index"`
+	AddrIndexTicketCommitments bool     `long:"addrindexticketcommitments" description:"Also index votes and revocations under the commitment addresses of the tickets they spend"`
+	AddrIndexChangeHeuristic   bool     `long:"addrindexchangeheuristic" description:"Tag the address index entries of regular transaction outputs as likely change or payments"`
+	AddrIndexRewardSources     bool     `long:"addrindexrewardsources" description:"Record the ticket that earned each reward output of a vote in the address index"`
+	AddrIndexCreditFlags       bool     `long:"addrindexcreditflags" description:"Flag the address index entries of the addresses paid by transaction outputs as credits"`
+	AddrIndexGenesisOutputs    bool     `long:"addrindexgenesisoutputs" description:"Index the outputs of the genesis block in the address index"`
+	AddrIndexAtomicSwaps       bool     `long:"addrindexatomicswaps" description:"Also index the participant addresses of the atomic swap contracts revealed by inputs that spend pay-to-script-hash outputs"`
+	AddrIndexDisapprovals      bool     `long:"addrindexdisapprovals" description:"Flag the address index entries of transactions in disapproved regular transaction trees"`
+	AddrIndexInputIndexes      bool     `long:"addrindexinputindexes" description:"Record the indices of the inputs that spend outputs paying to each address in the address index"`
+	AddrIndexTotals            bool     `long:"addrindextotals" description:"Track the total amounts credited to and debited from each address in the address index"`
+	AddrIndexTypes             []string `long:"addrindextype" description:"Only index addresses of the specified type in the address index -- may be specified multiple times {pubkeyhash, pubkeyhashed25519, pubkeyhashschnorr, scripthash}"`
+
+	// addrIdxTypes houses the parsed address types to index.
+	addrIdxTypes []uint8
 }
 
 // fileExists reports whether the named file or directory exists.
@@ -128,6 +149,20 @@ func loadConfig() (*config, []string, error) {
 	// worry about changing names per network and such.
 	cfg.DataDir = filepath.Join(cfg.DataDir, activeNetParams.Name)
 
+	// Check the address types to index are valid and save the parsed
+	// versions.
+	for _, name := range cfg.AddrIndexTypes {
+		addrType, err := indexers.ParseAddrType(name)
+		if err != nil {
+			err := fmt.Errorf("%s: invalid address index type: %w", funcName,
+				err)
+			fmt.Fprintln(os.Stderr, err)
+			parser.WriteHelp(os.Stderr)
+			return nil, nil, err
+		}
+		cfg.addrIdxTypes = append(cfg.addrIdxTypes, addrType)
+	}
+
 	// Ensure the specified block file exists.
 	if !fileExists(cfg.InFile) {
 		str := "%s: the specified block file [%v] does not exist"
@@ -56,6 +56,7 @@ type blockImporter struct {
 
 	txIndex         *indexers.TxIndex
 	addrIndex       *indexers.AddrIndex
+	spendIndex      *indexers.SpendIndex
 	existsAddrIndex *indexers.ExistsAddrIndex
 	cancel          context.CancelFunc
 }
@@ -352,13 +353,14 @@ func newBlockImporter(ctx context.Context, db database.DB, utxoDb *leveldb.DB, r
 	// Create the various indexes as needed.
 	var txIndex *indexers.TxIndex
 	var addrIndex *indexers.AddrIndex
+	var spendIndex *indexers.SpendIndex
 	var existsAddrIndex *indexers.ExistsAddrIndex
-	if cfg.TxIndex || cfg.AddrIndex {
-		// Enable transaction index if address index is enabled since it
-		// requires it.
+	if cfg.TxIndex || cfg.AddrIndex || cfg.SpendIndex {
+		// Enable transaction index if the address or spend index is enabled
+		// since they require it.
 		if !cfg.TxIndex {
 			log.Infof("Transaction index enabled because it is " +
-				"required by the address index")
+				"required by other enabled indexes")
 			cfg.TxIndex = true
 		} else {
 			log.Info("Transaction index is enabled")
@@ -371,7 +373,30 @@ func newBlockImporter(ctx context.Context, db database.DB, utxoDb *leveldb.DB, r
 	}
 	if cfg.AddrIndex {
 		log.Info("Address index is enabled")
-		addrIndex, err = indexers.NewAddrIndex(subber, db, queryer)
+		addrIndexCfg := &indexers.AddrIndexConfig{
+			SkipCoinbaseOutputs:        cfg.AddrIndexSkipCoinbase,
+			IndexRedeemScriptAddrs:     cfg.AddrIndexRedeemScripts,
+			ExtendedKeys:               cfg.AddrIndexExtendedKeys,
+			IndexTicketCommitmentAddrs: cfg.AddrIndexTicketCommitments,
+			ChangeHeuristic:            cfg.AddrIndexChangeHeuristic,
+			IndexRewardSources:         cfg.AddrIndexRewardSources,
+			CreditFlags:                cfg.AddrIndexCreditFlags,
+			IndexGenesisOutputs:        cfg.AddrIndexGenesisOutputs,
+			IndexAtomicSwapAddrs:       cfg.AddrIndexAtomicSwaps,
+			TrackDisapprovals:          cfg.AddrIndexDisapprovals,
+			TrackInputIndexes:          cfg.AddrIndexInputIndexes,
+			TrackAddrTotals:            cfg.AddrIndexTotals,
+			AddrTypes:                  cfg.addrIdxTypes,
+		}
+		addrIndex, err = indexers.NewAddrIndex(subber, db, queryer,
+			addrIndexCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SpendIndex {
+		log.Info("Spend index is enabled")
+		spendIndex, err = indexers.NewSpendIndex(subber, db, queryer)
 		if err != nil {
 			return nil, err
 		}
@@ -401,6 +426,7 @@ func newBlockImporter(ctx context.Context, db database.DB, utxoDb *leveldb.DB, r
 		startTime:       time.Now(),
 		txIndex:         txIndex,
 		addrIndex:       addrIndex,
+		spendIndex:      spendIndex,
 		existsAddrIndex: existsAddrIndex,
 		cancel:          cancel,
 	}, nil
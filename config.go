@@ -23,6 +23,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/decred/dcrd/blockchain/v4/indexers"
 	"github.com/decred/dcrd/connmgr/v3"
 	"github.com/decred/dcrd/database/v3"
 	_ "github.com/decred/dcrd/database/v3/ffldb"
@@ -222,9 +223,33 @@ type config struct {
 	DropTxIndex         bool `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits"`
 	AddrIndex           bool `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex       bool `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits"`
+	SpendIndex          bool `long:"spendindex" description:"Maintain a full index of the transactions that spend each output in the main chain"`
+	DropSpendIndex      bool `long:"dropspendindex" description:"Deletes the spend index from the database on start up and then exits"`
 	NoExistsAddrIndex   bool `long:"noexistsaddrindex" description:"Disable the exists address index, which tracks whether or not an address has even been used"`
 	DropExistsAddrIndex bool `long:"dropexistsaddrindex" description:"Deletes the exists address index from the database on start up and then exits"`
 
+	// Address index options.  The options that affect which data the address
+	// index contains are persisted with it and changing them requires
+	// dropping the index with --dropaddrindex so it is rebuilt.
+	AddrIndexSkipCoinbase      bool     `long:"addrindexskipcoinbase" description:"Do not index the addresses paid by the outputs of coinbase transactions in the address index"`
+	AddrIndexRedeemScripts     bool     `long:"addrindexredeemscripts" description:"Also index the addresses embedded in the redeem scripts revealed by inputs that spend pay-to-script-hash outputs"`
+	AddrIndexExtendedKeys      bool     `long:"addrindexextendedkeys" description:"Distinguish payments to public keys from payments to their hashes in the address index"`
+	AddrIndexFilterSize        uint32   `long:"addrindexfiltersize" description:"Expected number of distinct addresses to size the in-memory address index filter for -- Use 0 to disable the filter"`
+	AddrIndexRetention         uint32   `long:"addrindexretention" description:"Number of most recent blocks to retain address index entries for -- Use 0 to retain all entries"`
+	AddrIndexTicketCommitments bool     `long:"addrindexticketcommitments" description:"Also index votes and revocations under the commitment addresses of the tickets they spend"`
+	AddrIndexChangeHeuristic   bool     `long:"addrindexchangeheuristic" description:"Tag the address index entries of regular transaction outputs as likely change or payments"`
+	AddrIndexBlockTimes        bool     `long:"addrindexblocktimes" description:"Store the timestamps of the blocks referenced by the address index to speed up time-range queries"`
+	AddrIndexRewardSources     bool     `long:"addrindexrewardsources" description:"Record the ticket that earned each reward output of a vote in the address index"`
+	AddrIndexAsyncUnconfirmed  bool     `long:"addrindexasyncunconfirmed" description:"Index unconfirmed transactions in the address index asynchronously"`
+	AddrIndexCreditFlags       bool     `long:"addrindexcreditflags" description:"Flag the address index entries of the addresses paid by transaction outputs as credits"`
+	AddrIndexGenesisOutputs    bool     `long:"addrindexgenesisoutputs" description:"Index the outputs of the genesis block in the address index"`
+	AddrIndexCatchUpBatch      uint32   `long:"addrindexcatchupbatch" description:"Number of blocks to connect per database transaction when catching the address index up during initialization"`
+	AddrIndexAtomicSwaps       bool     `long:"addrindexatomicswaps" description:"Also index the participant addresses of the atomic swap contracts revealed by inputs that spend pay-to-script-hash outputs"`
+	AddrIndexDisapprovals      bool     `long:"addrindexdisapprovals" description:"Flag the address index entries of transactions in disapproved regular transaction trees"`
+	AddrIndexInputIndexes      bool     `long:"addrindexinputindexes" description:"Record the indices of the inputs that spend outputs paying to each address in the address index"`
+	AddrIndexTotals            bool     `long:"addrindextotals" description:"Track the total amounts credited to and debited from each address in the address index"`
+	AddrIndexTypes             []string `long:"addrindextype" description:"Only index addresses of the specified type in the address index -- may be specified multiple times {pubkeyhash, pubkeyhashed25519, pubkeyhashschnorr, scripthash}"`
+
 	// IPC options.
 	PipeRx         uint `long:"piperx" description:"File descriptor of read end pipe to enable parent -> child process communication"`
 	PipeTx         uint `long:"pipetx" description:"File descriptor of write end pipe to enable parent <- child process communication"`
@@ -236,6 +261,7 @@ type config struct {
 	oniondial     func(context.Context, string, string) (net.Conn, error)
 	dial          func(context.Context, string, string) (net.Conn, error)
 	miningAddrs   []stdaddr.Address
+	addrIdxTypes  []uint8
 	minRelayTxFee dcrutil.Amount
 	whitelists    []*net.IPNet
 	ipv4NetInfo   types.NetworksResult
@@ -1152,6 +1178,36 @@ func loadConfig(appName string) (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --spendindex and --dropspendindex do not mix.
+	if cfg.SpendIndex && cfg.DropSpendIndex {
+		err := fmt.Errorf("%s: the --spendindex and --dropspendindex "+
+			"options may not be activated at the same time",
+			funcName)
+		return nil, nil, err
+	}
+
+	// --spendindex and --droptxindex do not mix.
+	if cfg.SpendIndex && cfg.DropTxIndex {
+		err := fmt.Errorf("%s: the --spendindex and --droptxindex "+
+			"options may not be activated at the same time "+
+			"because the spend index relies on the transaction "+
+			"index", funcName)
+		return nil, nil, err
+	}
+
+	// Check the address types to index are valid and save the parsed
+	// versions.
+	cfg.addrIdxTypes = make([]uint8, 0, len(cfg.AddrIndexTypes))
+	for _, name := range cfg.AddrIndexTypes {
+		addrType, err := indexers.ParseAddrType(name)
+		if err != nil {
+			err := fmt.Errorf("%s: invalid address index type: %w",
+				funcName, err)
+			return nil, nil, err
+		}
+		cfg.addrIdxTypes = append(cfg.addrIdxTypes, addrType)
+	}
+
 	// !--noexistsaddrindex and --dropexistsaddrindex do not mix.
 	if !cfg.NoExistsAddrIndex && cfg.DropExistsAddrIndex {
 		err := fmt.Errorf("dropexistsaddrindex cannot be activated when " +
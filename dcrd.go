@@ -170,7 +170,7 @@ func dcrdMain() error {
 	// Drop indexes and exit if requested.
 	//
 	// NOTE: The order is important here because dropping the tx index also
-	// drops the address index since it relies on it.
+	// drops the address and spend indexes since they rely on it.
 	if cfg.DropAddrIndex {
 		if err := indexers.DropAddrIndex(ctx, db); err != nil {
 			dcrdLog.Errorf("%v", err)
@@ -179,6 +179,14 @@ func dcrdMain() error {
 
 		return nil
 	}
+	if cfg.DropSpendIndex {
+		if err := indexers.DropSpendIndex(ctx, db); err != nil {
+			dcrdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
 	if cfg.DropTxIndex {
 		if err := indexers.DropTxIndex(ctx, db); err != nil {
 			dcrdLog.Errorf("%v", err)
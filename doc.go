@@ -172,10 +172,61 @@ Application Options:
                                available
       --dropaddrindex          Deletes the address-based transaction index from
                                the database on start up and then exits
+      --spendindex             Maintain a full index of the transactions that
+                               spend each output in the main chain
+      --dropspendindex         Deletes the spend index from the database on
+                               start up and then exits
       --noexistsaddrindex      Disable the exists address index, which tracks
                                whether or not an address has even been used
       --dropexistsaddrindex    Deletes the exists address index from the
                                database on start up and then exits
+      --addrindexskipcoinbase  Do not index the addresses paid by the outputs of
+                               coinbase transactions in the address index
+      --addrindexredeemscripts Also index the addresses embedded in the redeem
+                               scripts revealed by inputs that spend
+                               pay-to-script-hash outputs
+      --addrindexextendedkeys  Distinguish payments to public keys from
+                               payments to their hashes in the address index
+      --addrindexfiltersize=   Expected number of distinct addresses to size
+                               the in-memory address index filter for -- Use 0
+                               to disable the filter
+      --addrindexretention=    Number of most recent blocks to retain address
+                               index entries for -- Use 0 to retain all entries
+      --addrindexticketcommitments
+                               Also index votes and revocations under the
+                               commitment addresses of the tickets they spend
+      --addrindexchangeheuristic
+                               Tag the address index entries of regular
+                               transaction outputs as likely change or payments
+      --addrindexblocktimes    Store the timestamps of the blocks referenced by
+                               the address index to speed up time-range queries
+      --addrindexrewardsources Record the ticket that earned each reward output
+                               of a vote in the address index
+      --addrindexasyncunconfirmed
+                               Index unconfirmed transactions in the address
+                               index asynchronously
+      --addrindexcreditflags   Flag the address index entries of the addresses
+                               paid by transaction outputs as credits
+      --addrindexgenesisoutputs
+                               Index the outputs of the genesis block in the
+                               address index
+      --addrindexcatchupbatch= Number of blocks to connect per database
+                               transaction when catching the address index up
+                               during initialization
+      --addrindexatomicswaps   Also index the participant addresses of the
+                               atomic swap contracts revealed by inputs that
+                               spend pay-to-script-hash outputs
+      --addrindexdisapprovals  Flag the address index entries of transactions
+                               in disapproved regular transaction trees
+      --addrindexinputindexes  Record the indices of the inputs that spend
+                               outputs paying to each address in the address
+                               index
+      --addrindextotals        Track the total amounts credited to and debited
+                               from each address in the address index
+      --addrindextype=         Only index addresses of the specified type in
+                               the address index -- may be specified multiple
+                               times {pubkeyhash, pubkeyhashed25519,
+                               pubkeyhashschnorr, scripthash}
       --piperx=                File descriptor of read end pipe to enable parent
                                -> child process communication
       --pipetx=                File descriptor of write end pipe to enable
@@ -272,6 +272,9 @@ const fileContents = `[Application Options]
 ; Delete the entire address index on start up, then exit.
 ; dropaddrindex=0
 
+; Delete the entire spend index on start up, then exit.
+; dropspendindex=0
+
 
 ; ------------------------------------------------------------------------------
 ; Optional Indexes
@@ -285,6 +288,33 @@ const fileContents = `[Application Options]
 ; searchrawtransactions RPC available.
 ; addrindex=1
 
+; Build and maintain a full index of the transactions that spend each output in
+; the main chain.
+; spendindex=1
+
+; Expected number of distinct addresses to size the in-memory address index
+; filter for.  Use 0 to disable the filter.
+; addrindexfiltersize=0
+
+; Number of most recent blocks to retain address index entries for.  Use 0 to
+; retain all entries.
+; addrindexretention=0
+
+; The following options affect which data the address index contains.  They are
+; persisted with the index and changing them requires dropping the index with
+; dropaddrindex so it is rebuilt.
+
+; Also index the addresses embedded in the redeem scripts revealed by inputs
+; that spend pay-to-script-hash outputs.
+; addrindexredeemscripts=1
+
+; Distinguish payments to public keys from payments to their hashes.
+; addrindexextendedkeys=1
+
+; Only index addresses of the specified types.  May be specified multiple times
+; with any of pubkeyhash, pubkeyhashed25519, pubkeyhashschnorr, and scripthash.
+; addrindextype=scripthash
+
 
 ; ------------------------------------------------------------------------------
 ; Signature Verification Cache
@@ -503,6 +503,7 @@ type server struct {
 	indexSubscriber *indexers.IndexSubscriber
 	txIndex         *indexers.TxIndex
 	addrIndex       *indexers.AddrIndex
+	spendIndex      *indexers.SpendIndex
 	existsAddrIndex *indexers.ExistsAddrIndex
 
 	// These following fields are used to filter duplicate block lottery data
@@ -3525,12 +3526,12 @@ func newServer(ctx context.Context, listenAddrs []string, db database.DB,
 		return nil, err
 	}
 
-	if cfg.TxIndex || cfg.AddrIndex {
-		// Enable transaction index if address index is enabled since it
-		// requires it.
+	if cfg.TxIndex || cfg.AddrIndex || cfg.SpendIndex {
+		// Enable transaction index if the address or spend index is enabled
+		// since they require it.
 		if !cfg.TxIndex {
 			indxLog.Infof("Transaction index enabled because it " +
-				"is required by the address index")
+				"is required by other enabled indexes")
 			cfg.TxIndex = true
 		} else {
 			indxLog.Info("Transaction index is enabled")
@@ -3543,7 +3544,36 @@ func newServer(ctx context.Context, listenAddrs []string, db database.DB,
 	}
 	if cfg.AddrIndex {
 		indxLog.Info("Address index is enabled")
-		s.addrIndex, err = indexers.NewAddrIndex(s.indexSubscriber, db, queryer)
+		addrIndexCfg := &indexers.AddrIndexConfig{
+			SkipCoinbaseOutputs:        cfg.AddrIndexSkipCoinbase,
+			IndexRedeemScriptAddrs:     cfg.AddrIndexRedeemScripts,
+			ExtendedKeys:               cfg.AddrIndexExtendedKeys,
+			AddrFilterSize:             cfg.AddrIndexFilterSize,
+			RetentionWindow:            cfg.AddrIndexRetention,
+			IndexTicketCommitmentAddrs: cfg.AddrIndexTicketCommitments,
+			ChangeHeuristic:            cfg.AddrIndexChangeHeuristic,
+			StoreBlockTimes:            cfg.AddrIndexBlockTimes,
+			IndexRewardSources:         cfg.AddrIndexRewardSources,
+			AsyncUnconfirmed:           cfg.AddrIndexAsyncUnconfirmed,
+			CreditFlags:                cfg.AddrIndexCreditFlags,
+			IndexGenesisOutputs:        cfg.AddrIndexGenesisOutputs,
+			CatchUpBatchSize:           cfg.AddrIndexCatchUpBatch,
+			IndexAtomicSwapAddrs:       cfg.AddrIndexAtomicSwaps,
+			TrackDisapprovals:          cfg.AddrIndexDisapprovals,
+			TrackInputIndexes:          cfg.AddrIndexInputIndexes,
+			TrackAddrTotals:            cfg.AddrIndexTotals,
+			AddrTypes:                  cfg.addrIdxTypes,
+		}
+		s.addrIndex, err = indexers.NewAddrIndex(s.indexSubscriber, db, queryer,
+			addrIndexCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.SpendIndex {
+		indxLog.Info("Spend index is enabled")
+		s.spendIndex, err = indexers.NewSpendIndex(s.indexSubscriber, db,
+			queryer)
 		if err != nil {
 			return nil, err
 		}